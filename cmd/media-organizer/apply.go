@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+)
+
+func newApplyCmd(opts *options) *cobra.Command {
+	var flags pipelineFlags
+	var jsonOutput bool
+	var journalPath string
+	var trashMode, trashDir string
+	var edited bool
+
+	applyCmd := &cobra.Command{
+		Use:   "apply [plan]",
+		Short: "Execute a plan written by organize --plan-out",
+		Long: "Execute the plan file written by organize --plan-out, as reviewed or edited, without scanning the source again.\n\n" +
+			"Only the copy and copy_renamed entries are executed, to the destinations in the plan; a sidecar follows the destination of its file. " +
+			"A source whose size or modification time changed since it was planned fails with E_SOURCE_CHANGED, one whose content no longer has its planned SHA-256 fails with E_SOURCE_MISMATCH, and a destination that already holds its source is skipped as identical. " +
+			"A plan that no longer matches its checksum is refused unless --edited is given, as is a plan with a destination outside its destination root or a destination planned for two files.\n\n" +
+			"Planning flags such as --layout have no effect; the settings of the copy, such as --verify, --write-exif or --catalog, apply.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			f, err := readPlanFile(args[0], edited)
+			if err != nil {
+				return err
+			}
+			cfg, err := flags.config(cmd)
+			if err != nil {
+				return err
+			}
+
+			src, err := openLocation(cmd.Context(), f.Source)
+			if err != nil {
+				return err
+			}
+			defer src.close()
+			dst, err := openLocation(cmd.Context(), f.Destination)
+			if err != nil {
+				return err
+			}
+			defer dst.close()
+			cfg.options = append(cfg.options, locationOptions(src, dst)...)
+			started := time.Now()
+			bin, err := openTrash(trashMode, trashDir, dst, started)
+			if err != nil {
+				return err
+			}
+			if bin != nil {
+				cfg.options = append(cfg.options, organizer.WithTrash(bin))
+			}
+			closeCatalog, err := flags.openCatalog(cmd, &cfg)
+			if err != nil {
+				return err
+			}
+			defer closeCatalog()
+
+			var res organizer.Result
+			var journalName string
+			if cfg.execute {
+				// Deferred after opening the destination and catalog, so it runs before they close.
+				defer func() {
+					run := summarizeRun("apply", true, started, res, err == nil)
+					e := historyEntry("apply", commandLine(cmd, args), notifySummary(run, src.name, dst.name, res, err), res)
+					e.Journal = journalName
+					if histErr := historyLog(cfg, dst).Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+						cmd.PrintErrf("warning: history: %v\n", histErr)
+					}
+				}()
+				if flags.archive == "" {
+					closeJournal, err := openJournal(cmd, opts, &cfg, dst, journalPath, started)
+					if err != nil {
+						return err
+					}
+					defer func() { journalName = closeJournal() }()
+				}
+			}
+			finishProgress := flags.startProgress(cmd, &cfg)
+			defer finishProgress()
+
+			res, err = organizer.Apply(cmd.Context(), organizer.PlanResult(f, src.path, dst.path), cfg.organizerOptions()...)
+			printWarnings(cmd, res)
+			printHookErrors(cmd, res)
+			if err != nil {
+				return err
+			}
+			if opts.verbose && res.RunID != "" {
+				cmd.PrintErrf("recorded run %s in %s\n", res.RunID, flags.catalog)
+			}
+			if jsonOutput {
+				return printJSONDecisions(cmd, res)
+			}
+			printDecisions(cmd, opts, res)
+			return nil
+		},
+	}
+
+	flags.bind(applyCmd)
+	applyCmd.Flags().BoolVar(&jsonOutput, "json", false, "output operations as JSON")
+	applyCmd.Flags().StringVar(&trashMode, "trash", "", "with a plan that moves files, put the sources the run removes after copying them into a trash instead of deleting them: os (the trash of the desktop) or destination (<destination>/<trash-dir>/<time>)")
+	applyCmd.Flags().StringVar(&trashDir, "trash-dir", trash.DirName, "directory below the destination that --trash destination puts the removed files in, in a directory per run")
+	applyCmd.Flags().BoolVar(&edited, "edited", false, "apply a plan that was edited after organize --plan-out wrote it, which its checksum refuses otherwise")
+	applyCmd.Flags().StringVar(&journalPath, "journal", "", "where an executed run writes the journal of the files it copied, for undo (default: .organize-<time>.jsonl in the destination)")
+
+	return applyCmd
+}
+
+// writePlanFile writes the planned result res of a run from src to dst to the plan file at path, for
+// apply. Local roots are recorded as absolute paths, so the plan can be applied from anywhere. The
+// sources to copy are read for the SHA-256 apply checks them against.
+func writePlanFile(ctx context.Context, path string, res organizer.Result, src, dst location) error {
+	f, err := res.PlanFile(ctx, src.fsys)
+	if err != nil {
+		return err
+	}
+	if f.Source, err = planRoot(src); err != nil {
+		return err
+	}
+	if f.Destination, err = planRoot(dst); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Encode(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// planRoot returns how a plan file records the location l.
+func planRoot(l location) (string, error) {
+	if l.fsys != nil {
+		return l.name, nil
+	}
+	return filepath.Abs(l.path)
+}
+
+// readPlanFile reads the plan file at path. Unless edited is set, it refuses a plan that changed since
+// it was written.
+func readPlanFile(path string, edited bool) (plan.File, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return plan.File{}, err
+	}
+	defer r.Close()
+	decode := plan.Decode
+	if edited {
+		decode = plan.DecodeEdited
+	}
+	f, err := decode(r)
+	if errors.Is(err, plan.ErrModified) {
+		return plan.File{}, fmt.Errorf("%s: %w (give --edited to apply a plan edited by hand)", path, err)
+	}
+	if err != nil {
+		return plan.File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
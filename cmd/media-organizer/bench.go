@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/bench"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/spf13/cobra"
+)
+
+func newBenchCmd() *cobra.Command {
+	var jsonOutput bool
+	var sample int64
+	var workers []int
+
+	benchCmd := &cobra.Command{
+		Use:   "bench [source] [destination]",
+		Short: "Measure scan, hash and copy throughput",
+		Long: "Measure how fast the media files of a source are scanned and hashed, with a growing number of workers, " +
+			"and copied into a destination, estimate how long organizing the source takes, and suggest a worker count.\n\n" +
+			"Copies are written to a temporary directory of the destination, which is removed afterwards. " +
+			"Every trial reads files no earlier trial read, so a source smaller than the samples ends the trials early.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			benchOpts := bench.DefaultOptions(args[0], args[1])
+			if sample <= 0 {
+				return fmt.Errorf("--sample-mb must be positive")
+			}
+			benchOpts.SampleBytes = sample << 20
+			for _, w := range workers {
+				if w <= 0 {
+					return fmt.Errorf("--workers must be positive, got %d", w)
+				}
+			}
+			if len(workers) > 0 {
+				benchOpts.Workers = workers
+			}
+
+			res, err := bench.Run(cmd.Context(), benchOpts)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(res)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "scan: %d files, %s in %s (%.0f files/s)\n",
+				res.Scan.Files, progress.FormatBytes(res.Scan.Bytes), res.Scan.Duration.Round(time.Millisecond), res.Scan.FilesPerSecond())
+			for _, h := range res.Hash {
+				fmt.Fprintf(out, "hash: %2d workers  %s/s (%d files, %s)\n",
+					h.Workers, progress.FormatBytes(int64(h.BytesPerSecond())), h.Files, progress.FormatBytes(h.Bytes))
+			}
+			fmt.Fprintf(out, "copy: %s/s (%d files, %s)\n",
+				progress.FormatBytes(int64(res.Copy.BytesPerSecond())), res.Copy.Files, progress.FormatBytes(res.Copy.Bytes))
+			fmt.Fprintf(out, "suggested workers: %d\n", res.SuggestedWorkers)
+			fmt.Fprintf(out, "estimated time to organize %s: %s\n", progress.FormatBytes(res.Scan.Bytes), res.Estimate.Round(time.Second))
+			return nil
+		},
+	}
+
+	benchCmd.Flags().BoolVar(&jsonOutput, "json", false, "output the measurements as JSON")
+	benchCmd.Flags().Int64Var(&sample, "sample-mb", 256, "MiB of data read by each hash trial and written by the copy trial")
+	benchCmd.Flags().IntSliceVar(&workers, "workers", nil, "numbers of workers to hash with, one trial each (default: 1, 2, 4, ... up to twice the CPUs)")
+
+	return benchCmd
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/quidome/media-organizer-go/pkg/compare"
+	"github.com/spf13/cobra"
+)
+
+func newCompareCmd(opts *options) *cobra.Command {
+	var jsonOutput bool
+	var mediaOnly bool
+	var hideIdentical bool
+
+	compareCmd := &cobra.Command{
+		Use:   "compare [a] [b]",
+		Short: "Compare two directory trees",
+		Long: "Compare two directory trees and report files present only in one of them, identical files, " +
+			"files that were moved to another path, and files with the same name but different content.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := compare.Trees(cmd.Context(), args[0], args[1], compare.Options{MediaOnly: mediaOnly})
+			if err != nil {
+				return err
+			}
+
+			if hideIdentical {
+				filtered := entries[:0]
+				for _, e := range entries {
+					if e.Status != compare.StatusIdentical {
+						filtered = append(filtered, e)
+					}
+				}
+				entries = filtered
+			}
+
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+
+			for _, e := range entries {
+				switch e.Status {
+				case compare.StatusOnlyA:
+					fmt.Fprintf(cmd.OutOrStdout(), "only in a: %s\n", e.PathA)
+				case compare.StatusOnlyB:
+					fmt.Fprintf(cmd.OutOrStdout(), "only in b: %s\n", e.PathB)
+				case compare.StatusDifferent:
+					fmt.Fprintf(cmd.OutOrStdout(), "different: %s\n", e.PathA)
+				case compare.StatusMoved:
+					fmt.Fprintf(cmd.OutOrStdout(), "moved: %s -> %s\n", e.PathA, e.PathB)
+				case compare.StatusIdentical:
+					fmt.Fprintf(cmd.OutOrStdout(), "identical: %s\n", e.PathA)
+				}
+			}
+
+			if opts.verbose {
+				counts := compare.Counts(entries)
+				cmd.PrintErrf("only in a: %d, only in b: %d, different: %d, moved: %d, identical: %d\n",
+					counts[compare.StatusOnlyA], counts[compare.StatusOnlyB], counts[compare.StatusDifferent],
+					counts[compare.StatusMoved], counts[compare.StatusIdentical])
+			}
+
+			return nil
+		},
+	}
+
+	compareCmd.Flags().BoolVar(&jsonOutput, "json", false, "output the comparison as JSON")
+	compareCmd.Flags().BoolVar(&mediaOnly, "media-only", false, "only compare media files")
+	compareCmd.Flags().BoolVar(&hideIdentical, "hide-identical", false, "do not list identical files")
+
+	return compareCmd
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/notify"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/schedule"
+)
+
+// defaultJournalDir is where run journals go when the config file names no directory, relative to the config file.
+const defaultJournalDir = "journal"
+
+// daemonConfig is the config file of the daemon command.
+type daemonConfig struct {
+	// Journal is the directory that receives a JSON journal of every run.
+	Journal string      `json:"journal"`
+	Jobs    []daemonJob `json:"jobs"`
+}
+
+// daemonJob is one scheduled organize run.
+type daemonJob struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+
+	// Flags holds organize flags by name, such as {"execute": true, "catalog": "/library/.catalog.db"}.
+	// Repeatable flags take a list.
+	Flags map[string]any `json:"flags"`
+
+	schedule schedule.Schedule
+}
+
+// journalEntry is the journal written for each run of a job.
+type journalEntry struct {
+	Job       string          `json:"job"`
+	Schedule  string          `json:"schedule"`
+	RunID     string          `json:"run_id,omitempty"`
+	Summary   notify.Summary  `json:"summary"`
+	Decisions []jsonOperation `json:"decisions"`
+}
+
+func newDaemonCmd(opts *options) *cobra.Command {
+	var configPath string
+	var once bool
+
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run organize jobs on a schedule",
+		Long: "Run the organize jobs of a JSON config file on their cron-like schedules until interrupted.\n\n" +
+			"A job does not start while its previous run is still going, and jobs sharing a destination run one at a time. " +
+			"Every run writes a JSON journal with its summary and decisions to the journal directory.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				return errors.New("no config file: pass --config")
+			}
+			cfg, err := loadDaemonConfig(configPath)
+			if err != nil {
+				return err
+			}
+			d := &daemon{cmd: cmd, opts: opts, journal: cfg.Journal, destinations: make(map[string]*sync.Mutex)}
+
+			if once {
+				var failed int
+				for _, job := range cfg.Jobs {
+					if err := d.run(cmd.Context(), job); err != nil {
+						failed++
+					}
+				}
+				if failed > 0 {
+					return fmt.Errorf("%d of %d jobs failed", failed, len(cfg.Jobs))
+				}
+				return nil
+			}
+
+			var wg sync.WaitGroup
+			for _, job := range cfg.Jobs {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d.schedule(cmd.Context(), job)
+				}()
+			}
+			wg.Wait()
+			return nil
+		},
+	}
+
+	daemonCmd.Flags().StringVar(&configPath, "config", defaultDaemonConfig(), "JSON config file with the jobs to run")
+	daemonCmd.Flags().BoolVar(&once, "once", false, "run every job once, one after the other, and exit")
+
+	return daemonCmd
+}
+
+// defaultDaemonConfig returns media-organizer/daemon.json in the user's config directory, if there is one.
+func defaultDaemonConfig() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "media-organizer", "daemon.json")
+}
+
+// loadDaemonConfig reads and validates the config file at path. Relative local paths in it are
+// resolved against the directory of the config file.
+func loadDaemonConfig(path string) (daemonConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return daemonConfig{}, err
+	}
+	var cfg daemonConfig
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return daemonConfig{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(cfg.Jobs) == 0 {
+		return daemonConfig{}, fmt.Errorf("%s: no jobs", path)
+	}
+
+	base := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || strings.Contains(p, "://") || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	if cfg.Journal == "" {
+		cfg.Journal = defaultJournalDir
+	}
+	cfg.Journal = resolve(cfg.Journal)
+
+	names := make(map[string]bool)
+	for i := range cfg.Jobs {
+		job := &cfg.Jobs[i]
+		switch {
+		case job.Name == "" || strings.ContainsAny(job.Name, `/\`) || job.Name == "." || job.Name == "..":
+			return daemonConfig{}, fmt.Errorf("%s: job %d: invalid name %q", path, i+1, job.Name)
+		case names[job.Name]:
+			return daemonConfig{}, fmt.Errorf("%s: duplicate job %q", path, job.Name)
+		case job.Source == "" || job.Destination == "":
+			return daemonConfig{}, fmt.Errorf("%s: job %q: source and destination are required", path, job.Name)
+		}
+		names[job.Name] = true
+		if job.schedule, err = schedule.Parse(job.Schedule); err != nil {
+			return daemonConfig{}, fmt.Errorf("%s: job %q: %w", path, job.Name, err)
+		}
+		job.Source, job.Destination = resolve(job.Source), resolve(job.Destination)
+		// Catch invalid flags now rather than at the first run.
+		if _, _, err := job.pipelineConfig(); err != nil {
+			return daemonConfig{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// pipelineConfig applies the flags of j to the flags of organize.
+func (j daemonJob) pipelineConfig() (pipelineConfig, *pipelineFlags, error) {
+	flagCmd := &cobra.Command{Use: j.Name}
+	flags := &pipelineFlags{}
+	flags.bind(flagCmd)
+	for name, value := range j.Flags {
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err := flagCmd.Flags().Set(name, fmt.Sprint(v)); err != nil {
+				return pipelineConfig{}, nil, fmt.Errorf("job %q: flag %q: %w", j.Name, name, err)
+			}
+		}
+	}
+	cfg, err := flags.config(flagCmd)
+	if err != nil {
+		return pipelineConfig{}, nil, fmt.Errorf("job %q: %w", j.Name, err)
+	}
+	if cfg.progress != nil {
+		return pipelineConfig{}, nil, fmt.Errorf("job %q: the daemon cannot report progress", j.Name)
+	}
+	return cfg, flags, nil
+}
+
+// daemon runs the jobs of a config file.
+type daemon struct {
+	cmd     *cobra.Command
+	opts    *options
+	journal string
+
+	mu sync.Mutex
+	// destinations serializes the jobs sharing a destination, which would otherwise fail on its lock.
+	destinations map[string]*sync.Mutex
+}
+
+// schedule runs job at the times of its schedule until ctx is done. Runs never overlap: the times
+// that pass while a run is in progress are skipped.
+func (d *daemon) schedule(ctx context.Context, job daemonJob) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			d.log("%s: schedule %q never fires", job.Name, job.Schedule)
+			return
+		}
+		if d.opts.verbose {
+			d.log("%s: next run at %s", job.Name, next.Format(time.RFC3339))
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		_ = d.run(ctx, job)
+		if missed := job.schedule.Next(next); !missed.IsZero() && missed.Before(time.Now()) {
+			d.log("%s: skipped the runs due while the previous run was in progress", job.Name)
+		}
+	}
+}
+
+// run runs job once and writes its journal. Failures are logged and returned.
+func (d *daemon) run(ctx context.Context, job daemonJob) (err error) {
+	unlock := d.lockDestination(job.Destination)
+	defer unlock()
+
+	started := time.Now()
+	var res organizer.Result
+	var executed bool
+	source, destination := job.Source, job.Destination
+	defer func() {
+		if ctx.Err() != nil && err != nil {
+			// Interrupted by shutdown, not a failed run worth a journal.
+			return
+		}
+		run := summarizeRun("daemon", executed, started, res, err == nil)
+		summary := notifySummary(run, source, destination, res, err)
+		d.log("%s: %s", job.Name, summary.Text)
+		if journalErr := d.writeJournal(d.journalPath(job, started), job, res, summary); journalErr != nil {
+			d.log("%s: warning: journal: %v", job.Name, journalErr)
+		}
+	}()
+
+	cfg, flags, err := job.pipelineConfig()
+	if err != nil {
+		return err
+	}
+	executed = cfg.execute
+	src, err := openLocation(ctx, job.Source)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+	source = src.name
+	dst, err := openLocation(ctx, job.Destination)
+	if err != nil {
+		return err
+	}
+	defer dst.close()
+	destination = dst.name
+	cfg.options = append(cfg.options, locationOptions(src, dst)...)
+	closeCatalog, err := flags.openCatalog(d.cmd, &cfg)
+	if err != nil {
+		return err
+	}
+	defer closeCatalog()
+	if executed {
+		// Deferred after opening the destination and catalog, so it runs before they close.
+		defer func() {
+			if ctx.Err() != nil && err != nil {
+				return
+			}
+			run := summarizeRun("daemon", executed, started, res, err == nil)
+			e := historyEntry("daemon", nil, notifySummary(run, source, destination, res, err), res)
+			e.Job = job.Name
+			e.Journal = d.journalPath(job, started)
+			if histErr := historyLog(cfg, dst).Append(context.WithoutCancel(ctx), e); histErr != nil {
+				d.log("%s: warning: history: %v", job.Name, histErr)
+			}
+		}()
+	}
+
+	res, err = organizer.Run(ctx, src.path, dst.path, cfg.organizerOptions()...)
+	for _, w := range res.Warnings {
+		d.log("%s: warning: %s", job.Name, w)
+	}
+	for _, hookErr := range res.HookErrors {
+		d.log("%s: warning: %v", job.Name, hookErr)
+	}
+	return err
+}
+
+// lockDestination waits until no other job writes to destination and returns the function that releases it.
+func (d *daemon) lockDestination(destination string) func() {
+	d.mu.Lock()
+	mu, ok := d.destinations[destination]
+	if !ok {
+		mu = &sync.Mutex{}
+		d.destinations[destination] = mu
+	}
+	d.mu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// journalPath returns where the journal of the run of job started at started goes: <journal>/<job>/<start time>.json.
+func (d *daemon) journalPath(job daemonJob, started time.Time) string {
+	return filepath.Join(d.journal, job.Name, started.Format("20060102T150405.000")+".json")
+}
+
+// writeJournal writes the journal of a run to path.
+func (d *daemon) writeJournal(path string, job daemonJob, res organizer.Result, summary notify.Summary) error {
+	entry := journalEntry{Job: job.Name, Schedule: job.Schedule, RunID: res.RunID, Summary: summary, Decisions: jsonDecisions(res)}
+	out, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o644)
+}
+
+// log writes a timestamped line to stderr. Jobs log concurrently.
+func (d *daemon) log(format string, args ...any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cmd.PrintErrf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
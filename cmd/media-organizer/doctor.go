@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/quidome/media-organizer-go/pkg/doctor"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd(opts *options) *cobra.Command {
+	var jsonOutput bool
+
+	doctorCmd := &cobra.Command{
+		Use:   "doctor [destination]",
+		Short: "Check the environment for organizing into a destination",
+		Long:  "Check destination writability and free space, filesystem capabilities (reflink, hardlink, case sensitivity) and optional external tools, and print actionable findings.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			findings := doctor.Run(doctor.DefaultOptions(args[0]))
+
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(findings); err != nil {
+					return err
+				}
+			} else {
+				for _, f := range findings {
+					fmt.Fprintf(cmd.OutOrStdout(), "[%s] %s: %s\n", f.Status, f.Check, f.Message)
+					if f.Hint != "" && (f.Status != doctor.StatusOK || opts.verbose) {
+						fmt.Fprintf(cmd.OutOrStdout(), "       hint: %s\n", f.Hint)
+					}
+				}
+			}
+
+			if doctor.HasFailures(findings) {
+				return fmt.Errorf("doctor found problems with %s", args[0])
+			}
+			return nil
+		},
+	}
+
+	doctorCmd.Flags().BoolVar(&jsonOutput, "json", false, "output findings as JSON")
+
+	return doctorCmd
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/export"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+// createExport creates the --export file at path, in the format of its extension.
+func createExport(ctx context.Context, path string) (export.Writer, error) {
+	format, err := export.FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	return export.Create(ctx, path, format)
+}
+
+// newExportRow returns the export row of a file with the created_at candidates d.
+func newExportRow(source string, size int64, modTime time.Time, d createdat.DetailedResult) export.Row {
+	row := export.Row{
+		SourcePath:         source,
+		FileSizeBytes:      size,
+		ModTime:            modTime,
+		CreatedAtCatalog:   d.Catalog,
+		CreatedAtMetadata:  d.Metadata,
+		CreatedAtFilename:  d.Filename,
+		CreatedAtDirectory: d.Directory,
+		CreatedAtFilestat:  d.Filestat,
+	}
+	// Files that were not attributed have no best candidate.
+	if d.Best.Source != "" {
+		row.BestCreatedAt = d.Best.CreatedAt
+		row.BestSource = string(d.Best.Source)
+		row.Confidence = string(d.Confidence())
+	}
+	return row
+}
+
+// exportRows returns the decisions of res as export rows, the columns of jsonDecisions.
+func exportRows(res organizer.Result) []export.Row {
+	rows := make([]export.Row, 0, len(res.Decisions))
+	for _, d := range res.Decisions {
+		row := newExportRow(d.SourcePath, res.Sizes[d.SourcePath], res.ModTimes[d.SourcePath], res.Details[d.SourcePath])
+		row.Place = res.Fields[d.SourcePath][plan.TokenPlace]
+		row.Camera = res.Fields[d.SourcePath][plan.TokenCamera]
+		row.Device = res.Fields[d.SourcePath][plan.TokenDevice]
+		row.DestinationPath = d.DestinationPath
+		row.FinalDestinationPath = d.FinalDestinationPath
+		row.Action = string(d.Action)
+		row.DuplicateOf = d.DuplicateOf
+		if d.Error != nil {
+			row.Error = d.Error.Error()
+			row.ErrorCode = string(errcode.Of(d.Error))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
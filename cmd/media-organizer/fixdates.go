@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/exifwrite"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+func newFixDatesCmd(opts *options) *cobra.Command {
+	var execute bool
+
+	fixDatesCmd := &cobra.Command{
+		Use:   "fix-dates [directory]",
+		Short: "Write determined dates into JPEGs that lack DateTimeOriginal",
+		Long: "Determine the created_at of every JPEG under a directory and write it into the EXIF DateTimeOriginal " +
+			"of files that have none, in place. Dates taken from the modification time are not written. " +
+			"Files keep their modification time. Without --execute the files that would change are only listed.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			directory := args[0]
+			fsys := os.DirFS(directory)
+
+			records, err := scan.ScanRecords(cmd.Context(), fsys, ".", scan.DefaultOptions())
+			if err != nil {
+				return err
+			}
+
+			var fixed, failed int
+			for _, record := range records {
+				if err := cmd.Context().Err(); err != nil {
+					return err
+				}
+				path := filepath.Join(directory, filepath.FromSlash(record.Path))
+				if !exifwrite.Supported(path) {
+					continue
+				}
+				res, err := createdat.Determine(cmd.Context(), fsys, record.Path, createdat.Options{Location: time.Local})
+				if err != nil {
+					failed++
+					fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", path, err)
+					continue
+				}
+				if res.Source == createdat.SourceMtime || res.Source == createdat.SourceUnknown {
+					continue
+				}
+
+				err = fixDate(path, res.CreatedAt, execute)
+				switch {
+				case errors.Is(err, exifwrite.ErrPresent), errors.Is(err, exifwrite.ErrUnsupported):
+					continue
+				case err != nil:
+					failed++
+					fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", path, err)
+					continue
+				}
+				fixed++
+				prefix := ""
+				if execute {
+					prefix = "fixed "
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s%s: DateTimeOriginal %s (from %s)\n", prefix, path, res.CreatedAt.Format("2006-01-02 15:04:05"), res.Source)
+			}
+
+			if opts.verbose {
+				cmd.PrintErrf("%d of %d media files lacked DateTimeOriginal\n", fixed, len(records))
+			}
+			if failed > 0 {
+				return fmt.Errorf("fix-dates: %d files failed", failed)
+			}
+			return nil
+		},
+	}
+
+	fixDatesCmd.Flags().BoolVarP(&execute, "execute", "x", false, "write the dates (default: dry-run)")
+
+	return fixDatesCmd
+}
+
+// fixDate writes t into the DateTimeOriginal of path, or with execute false only checks that it would.
+func fixDate(path string, t time.Time, execute bool) error {
+	if execute {
+		return exifwrite.WriteFile(path, t)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = exifwrite.SetDateTimeOriginal(data, t)
+	return err
+}
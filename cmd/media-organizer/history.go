@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/history"
+	"github.com/quidome/media-organizer-go/pkg/notify"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+func newHistoryCmd(opts *options) *cobra.Command {
+	var catalogPath string
+	var runID string
+	var last int
+	var jsonOutput bool
+
+	historyCmd := &cobra.Command{
+		Use:   "history [library]",
+		Short: "List and inspect the past runs on a library",
+		Long: "List the runs that changed a library, as recorded in its " + history.FileName + " by every executed " +
+			"organize, merge, migrate and daemon run, or in the catalog for runs with --catalog.\n\n" +
+			"With --run, one run is shown in full: its command line, counts, failures and journal. " +
+			"The library may also be a remote location URL, like the destination of organize.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if catalogPath != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var log history.Log
+			if catalogPath != "" {
+				c, err := catalog.Open(cmd.Context(), catalogPath)
+				if err != nil {
+					return err
+				}
+				defer c.Close()
+				log = history.Catalog(c)
+			} else {
+				library, err := openLocation(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+				defer library.close()
+				log = historyLog(pipelineConfig{}, library)
+			}
+			entries, err := log.Entries(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if runID != "" {
+				e, err := history.Find(entries, runID)
+				if err != nil {
+					return err
+				}
+				if jsonOutput {
+					return printJSON(cmd, e)
+				}
+				printHistoryEntry(cmd, e)
+				return nil
+			}
+
+			if last > 0 && len(entries) > last {
+				entries = entries[len(entries)-last:]
+			}
+			if jsonOutput {
+				if entries == nil {
+					entries = []history.Entry{}
+				}
+				return printJSON(cmd, entries)
+			}
+			for _, e := range entries {
+				fmt.Fprintln(cmd.OutOrStdout(), historyLine(e))
+			}
+			if opts.verbose {
+				cmd.PrintErrf("%d runs\n", len(entries))
+			}
+			return nil
+		},
+	}
+
+	historyCmd.Flags().StringVar(&catalogPath, "catalog", "", "read the history kept in this catalog instead of the library")
+	historyCmd.Flags().StringVar(&runID, "run", "", "show the run with this ID (or a unique prefix of it) in full")
+	historyCmd.Flags().IntVar(&last, "last", 0, "only list the last N runs")
+	historyCmd.Flags().BoolVar(&jsonOutput, "json", false, "output the history as JSON")
+
+	return historyCmd
+}
+
+// printJSON writes v as indented JSON.
+func printJSON(cmd *cobra.Command, v any) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// historyLine summarizes a run on one line.
+func historyLine(e history.Entry) string {
+	status := "ok"
+	if !e.Succeeded {
+		status = "aborted"
+	}
+	command := e.Command
+	if e.Job != "" {
+		command += " " + e.Job
+	}
+	copied := e.Counts[string(reconcile.ActionCopied)] + e.Counts[string(reconcile.ActionCopiedRenamed)]
+	return fmt.Sprintf("%s  %s  %-12s %d files, %d copied, %d failed in %.0fs  %s",
+		e.ID, e.Started.Local().Format("2006-01-02 15:04:05"), command, e.FilesProcessed, copied, e.Failures, e.DurationSeconds, status)
+}
+
+// printHistoryEntry writes every detail of a run.
+func printHistoryEntry(cmd *cobra.Command, e history.Entry) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "run:         %s\n", e.ID)
+	fmt.Fprintf(out, "command:     %s\n", e.Command)
+	if e.Job != "" {
+		fmt.Fprintf(out, "job:         %s\n", e.Job)
+	}
+	if len(e.Args) > 0 {
+		fmt.Fprintf(out, "args:        %s\n", strings.Join(e.Args, " "))
+	}
+	if e.Source != "" {
+		fmt.Fprintf(out, "source:      %s\n", e.Source)
+	}
+	fmt.Fprintf(out, "destination: %s\n", e.Destination)
+	fmt.Fprintf(out, "started:     %s\n", e.Started.Local().Format(time.RFC3339))
+	fmt.Fprintf(out, "duration:    %s\n", (time.Duration(e.DurationSeconds * float64(time.Second))).Round(time.Millisecond))
+	fmt.Fprintf(out, "files:       %d (%s copied)\n", e.FilesProcessed, progress.FormatBytes(e.BytesCopied))
+	actions := make([]string, 0, len(e.Counts))
+	for a := range e.Counts {
+		actions = append(actions, a)
+	}
+	sort.Strings(actions)
+	for _, a := range actions {
+		fmt.Fprintf(out, "  %-24s %d\n", a+":", e.Counts[a])
+	}
+	if e.CatalogRun != "" {
+		fmt.Fprintf(out, "catalog run: %s\n", e.CatalogRun)
+	}
+	if e.Journal != "" {
+		fmt.Fprintf(out, "journal:     %s\n", e.Journal)
+	}
+	if e.Succeeded {
+		fmt.Fprintf(out, "status:      ok\n")
+	} else {
+		fmt.Fprintf(out, "status:      aborted: %s\n", e.Error)
+	}
+	for _, f := range e.FailedFiles {
+		fmt.Fprintf(out, "failed %s: %s\n", f.SourcePath, f.Error)
+	}
+}
+
+// historyLog returns where the runs on dst are recorded: the catalog of cfg when there is one,
+// otherwise the history file in the root of dst.
+func historyLog(cfg pipelineConfig, dst location) history.Log {
+	if cfg.catalog != nil {
+		return history.Catalog(cfg.catalog)
+	}
+	return history.File(dst.fsys, filepath.Join(dst.path, history.FileName))
+}
+
+// historyEntry builds the history entry of a finished run from its summary.
+func historyEntry(command string, args []string, summary notify.Summary, res organizer.Result) history.Entry {
+	e := history.Entry{
+		ID:              history.NewID(summary.Started),
+		Command:         command,
+		Args:            args,
+		Source:          summary.Source,
+		Destination:     summary.Destination,
+		Execute:         summary.Execute,
+		Started:         summary.Started,
+		DurationSeconds: summary.DurationSeconds,
+		FilesProcessed:  summary.FilesProcessed,
+		Counts:          summary.Counts,
+		BytesCopied:     summary.BytesCopied,
+		Failures:        summary.Failures,
+		Succeeded:       summary.Succeeded,
+		Error:           summary.Error,
+		CatalogRun:      res.RunID,
+	}
+	for _, f := range summary.FailedFiles {
+		e.FailedFiles = append(e.FailedFiles, history.FailedFile{SourcePath: f.SourcePath, Error: f.Error, ErrorCode: f.ErrorCode})
+	}
+	return e
+}
+
+// commandLine returns the command line of cmd: its name, the flags set and args, with the
+// credentials of location URLs left out.
+func commandLine(cmd *cobra.Command, args []string) []string {
+	line := []string{cmd.Name()}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		line = append(line, "--"+f.Name+"="+redact(f.Value.String()))
+	})
+	for _, arg := range args {
+		line = append(line, redact(arg))
+	}
+	return line
+}
+
+// redact removes the password from a URL argument.
+func redact(arg string) string {
+	if !strings.Contains(arg, "://") {
+		return arg
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return arg
+	}
+	return u.Redacted()
+}
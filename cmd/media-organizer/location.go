@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/mtpfs"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/sftpfs"
+	"github.com/quidome/media-organizer-go/pkg/smbfs"
+	"github.com/quidome/media-organizer-go/pkg/webdavfs"
+)
+
+// location is a source or destination argument: a local path or a remote URL.
+type location struct {
+	// name identifies the location in output, without credentials.
+	name string
+
+	// path is the root of the location within fsys.
+	path string
+
+	// fsys is nil for local paths.
+	fsys destfs.FS
+
+	close func() error
+}
+
+// Environment variables holding the password when a URL has a user but no password.
+const (
+	webdavPasswordEnv = "MEDIA_ORGANIZER_WEBDAV_PASSWORD"
+	smbPasswordEnv    = "MEDIA_ORGANIZER_SMB_PASSWORD"
+)
+
+// openLocation connects to the location of arg. Arguments without a URL scheme are local paths.
+func openLocation(ctx context.Context, arg string) (location, error) {
+	local := location{name: arg, path: arg, close: func() error { return nil }}
+	if !strings.Contains(arg, "://") {
+		return local, nil
+	}
+	u, err := url.Parse(arg)
+	if err != nil {
+		return location{}, fmt.Errorf("parse location %q: %w", arg, err)
+	}
+
+	root := u.Path
+	if root == "" {
+		root = "/"
+	}
+	switch u.Scheme {
+	case sftpfs.Scheme:
+		fsys, err := sftpfs.Dial(ctx, u, sftpfs.DefaultOptions())
+		if err != nil {
+			return location{}, err
+		}
+		return location{name: u.Redacted(), path: root, fsys: fsys, close: fsys.Close}, nil
+	case webdavfs.Scheme, webdavfs.SecureScheme:
+		opts := webdavfs.Options{}
+		if _, ok := u.User.Password(); !ok && u.User != nil {
+			// Keeps app passwords out of the shell history.
+			opts.Username = u.User.Username()
+			opts.Password = os.Getenv(webdavPasswordEnv)
+		}
+		fsys, err := webdavfs.New(ctx, u, opts)
+		if err != nil {
+			return location{}, err
+		}
+		return location{name: u.Redacted(), path: root, fsys: fsys, close: fsys.Close}, nil
+	case smbfs.Scheme:
+		_, name, err := smbfs.SharePath(u)
+		if err != nil {
+			return location{}, err
+		}
+		opts := smbfs.DefaultOptions()
+		opts.Password = os.Getenv(smbPasswordEnv)
+		fsys, err := smbfs.Dial(ctx, u, opts)
+		if err != nil {
+			return location{}, err
+		}
+		return location{name: u.Redacted(), path: name, fsys: fsys, close: fsys.Close}, nil
+	case mtpfs.Scheme, mtpfs.PTPScheme:
+		fsys, err := mtpfs.Dial(ctx, u, mtpfs.DefaultOptions())
+		if err != nil {
+			return location{}, err
+		}
+		return location{name: u.String(), path: root, fsys: fsys, close: fsys.Close}, nil
+	default:
+		return location{}, fmt.Errorf("unsupported location scheme %q (supported: %s, %s, %s, %s, %s, %s)",
+			u.Scheme, sftpfs.Scheme, webdavfs.Scheme, webdavfs.SecureScheme, smbfs.Scheme, mtpfs.Scheme, mtpfs.PTPScheme)
+	}
+}
+
+// locationOptions returns the organizer options that read from source and write to destination.
+func locationOptions(source, destination location) []organizer.Option {
+	var opts []organizer.Option
+	if source.fsys != nil {
+		opts = append(opts, organizer.WithSourceFS(source.fsys))
+	}
+	if destination.fsys != nil {
+		opts = append(opts, organizer.WithDestinationFS(destination.fsys))
+	}
+	return opts
+}
@@ -2,111 +2,2035 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+	"github.com/quidome/media-organizer-go/pkg/checkpoint"
+	"github.com/quidome/media-organizer-go/pkg/history"
+	"github.com/quidome/media-organizer-go/pkg/lock"
+	"github.com/quidome/media-organizer-go/pkg/notify"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/review"
 )
 
-func TestRootCommand_PrintsVersion(t *testing.T) {
+func TestRootCommand_PrintsVersion(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Media Organizer CLI") {
+		t.Fatalf("expected output to include CLI header, got %q", output)
+	}
+	if !strings.Contains(output, "Version: "+version) {
+		t.Fatalf("expected output to include version, got %q", output)
+	}
+}
+
+func TestVersionCommand_JSON(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"version", "--json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var info buildInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if info.Version != version || info.GoVersion == "" || info.Commit == "" || info.Date == "" || info.Platform == "" {
+		t.Fatalf("incomplete build info: %+v", info)
+	}
+}
+
+func TestVersionCommand_Text(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"version"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{"media-organizer " + version, "commit:", "built:", "go:"} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected output to include %q, got %q", want, output)
+		}
+	}
+}
+
+func TestRootCommand_VerboseFlag(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"--verbose"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "Verbose mode: enabled") {
+		t.Fatalf("expected verbose line, got %q", output)
+	}
+}
+
+func TestOrganizeCommand_RequiresTwoArgs(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", "only-source"})
+
+	if err := cmd.Execute(); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestOrganizeCommand_DryRunPrintsCreatedAtRecords(t *testing.T) {
+	tmp := t.TempDir()
+
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	writeFileWithMTime(t, tmp, "holiday.jpg", time.Date(2020, 6, 7, 8, 9, 10, 0, time.UTC))
+	writeFile(t, tmp, "sub/VID_20240102_030405.mp4")
+	writeFile(t, tmp, "ignore.txt")
+
+	dest := t.TempDir()
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmp, dest})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := strings.TrimSpace(out.String())
+	lines := strings.Split(output, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), output)
+	}
+
+	// Output format is now: <source> -> <destination>
+	if !strings.Contains(lines[0], "IMG_20240102_030405.jpg -> "+dest) || !strings.Contains(lines[0], filepath.Join(dest, "2024", "01", "02", "IMG_20240102_030405.jpg")) {
+		t.Fatalf("unexpected line: %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "holiday.jpg -> "+dest) || !strings.Contains(lines[1], filepath.Join(dest, "2020", "06", "07", "holiday.jpg")) {
+		t.Fatalf("unexpected line: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "VID_20240102_030405.mp4 -> "+dest) || !strings.Contains(lines[2], filepath.Join(dest, "2024", "01", "02", "VID_20240102_030405.mp4")) {
+		t.Fatalf("unexpected line: %q", lines[2])
+	}
+}
+
+func TestOrganizeCommand_Execute(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Verify file was copied
+	destPath := filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if _, err := os.Stat(destPath); err != nil {
+		t.Errorf("file was not copied to expected destination: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "copied") {
+		t.Errorf("expected 'copied' in output, got: %s", output)
+	}
+}
+
+func TestOrganizeCommand_InPlace(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "IMG_20240102_030405.jpg")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", dir, dir})
+	if err := cmd.Execute(); err == nil {
+		t.Fatalf("expected an error organizing a directory into itself without --in-place")
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", "--in-place", dir, "--execute"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024", "01", "02", "IMG_20240102_030405.jpg")); err != nil {
+		t.Errorf("file was not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "IMG_20240102_030405.jpg")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be gone from the root, got %v", err)
+	}
+	if !strings.Contains(out.String(), "moved ") {
+		t.Errorf("expected 'moved' in output, got: %s", out)
+	}
+}
+
+func TestOrganizeCommand_Link(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", "--link", "sym", src, dst, "--execute"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg"))
+	if err != nil || target != filepath.Join(src, "IMG_20240102_030405.jpg") {
+		t.Errorf("expected a symbolic link to the source, got %q, %v", target, err)
+	}
+	if !strings.Contains(out.String(), "linked ") {
+		t.Errorf("expected 'linked' in output, got: %s", out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", "--link", "soft", src, dst})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an unknown --link mode to fail")
+	}
+}
+
+func TestOrganizeCommand_WarnsAboutNestedDestination(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+
+	cmd := newRootCmd()
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"organize", tmp, filepath.Join(tmp, "library")})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "warning: destination " + filepath.Join(tmp, "library") + " is inside source " + tmp; !strings.Contains(errOut.String(), want) {
+		t.Errorf("expected %q on stderr, got:\n%s", want, errOut)
+	}
+}
+
+func TestOrganizeCommand_PathLimits(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	dest := t.TempDir()
+
+	cmd := newRootCmd()
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"organize", tmp, dest, "--max-path-depth", "2"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "warning: destination path " + filepath.Join("2024", "01", "02", "IMG_20240102_030405.jpg") + " exceeds at most 2 directories"; !strings.Contains(errOut.String(), want) {
+		t.Errorf("expected %q on stderr, got:\n%s", want, errOut)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmp, dest, "--max-path-depth", "2", "--shorten-paths"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := filepath.Join(dest, "2024", "01-02", "IMG_20240102_030405.jpg"); !strings.Contains(out.String(), want) || strings.Contains(out.String(), "warning:") {
+		t.Errorf("expected the shortened path %s without warnings, got:\n%s", want, out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--shorten-paths"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--shorten-paths needs") {
+		t.Errorf("expected an error for --shorten-paths without limits, got %v", err)
+	}
+}
+
+func TestOrganizeCommand_BatchSize(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "a/IMG_20240102_030405.jpg")
+	writeFile(t, tmp, "b/IMG_20240103_030405.jpg")
+	writeFileWithContent(t, tmp, "c/IMG_20240104_030405.jpg", "a/IMG_20240102_030405.jpg")
+	dest := t.TempDir()
+
+	organize := func(args ...string) string {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(append([]string{"organize", tmp, dest}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("organize %v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	// Batches of single directories stream the same decisions, and the same JSON, as a single run.
+	if all, batched := organize("--json"), organize("--json", "--batch-size", "1"); batched != all {
+		t.Errorf("expected the JSON of a single run, got:\n%s\nwant:\n%s", batched, all)
+	}
+	if all, batched := organize(), organize("--batch-size", "1"); batched != all {
+		t.Errorf("expected the output of a single run, got:\n%s\nwant:\n%s", batched, all)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--batch-size", "-1"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--batch-size") {
+		t.Errorf("expected an error for a negative --batch-size, got %v", err)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--batch-size", "1", "--report", filepath.Join(t.TempDir(), "report.html")})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--report") {
+		t.Errorf("expected --report to be refused with --batch-size, got %v", err)
+	}
+}
+
+func TestOrganizeCommand_Volumes(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20230102_030405.jpg")
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	a, b := t.TempDir(), t.TempDir()
+
+	// Each file is its own name as content: there is room for one year per volume.
+	size := len("IMG_20230102_030405.jpg")
+	cmd := newRootCmd()
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"organize", tmp, "--json", "--volume", fmt.Sprintf("%s=%d", a, size), "--volume", fmt.Sprintf("%s=%dB", b, size)})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("decode: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		"IMG_20230102_030405.jpg": a,
+		"IMG_20240102_030405.jpg": b,
+	}
+	for _, op := range operations {
+		name := filepath.Base(op.SourcePath)
+		if op.Volume != want[name] || op.DestinationPath != filepath.Join(want[name], name[4:8], "01", "02", name) {
+			t.Errorf("%s: expected a copy onto %s, got %+v", name, want[name], op)
+		}
+	}
+	if !strings.Contains(errOut.String(), "volume "+a+": 2023 (23 B of 23 B)") {
+		t.Errorf("expected the plan of each volume, got:\n%s", errOut)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, a, "--volume", a + "=1TB"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected a destination with --volume to be refused")
+	}
+}
+
+func TestOrganizeCommand_Report(t *testing.T) {
+	tmp := t.TempDir()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 320, 240)), nil); err != nil {
+		t.Fatal(err)
+	}
+	writeFileWithContent(t, tmp, "IMG_20240102_030405.jpg", img.String())
+	writeFileWithContent(t, tmp, "copy/IMG_20240102_030405.jpg", img.String())
+	path := filepath.Join(t.TempDir(), "plan.html")
+
+	cmd := newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, t.TempDir(), "--report", path})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"2 files, 1 copy, 1 duplicate", "2024-01-02", `src="plan_files/`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("report lacks %q:\n%s", want, b)
+		}
+	}
+	if entries, err := os.ReadDir(filepath.Join(filepath.Dir(path), "plan_files")); err != nil || len(entries) != 2 {
+		t.Errorf("expected 2 thumbnails, got %v, %v", entries, err)
+	}
+}
+
+func TestOrganizeCommand_Resume(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFileWithContent(t, src, "IMG_20240103_030405.jpg", "b")
+
+	// An interrupted run copied the first file.
+	writeFileWithContent(t, dst, "2024/01/02/IMG_20240102_030405.jpg", "a")
+	copied := filepath.Join(src, "IMG_20240102_030405.jpg")
+	placed := filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	srcInfo, err := os.Stat(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(placed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := checkpoint.Create(nil, filepath.Join(dst, checkpoint.FileName), checkpoint.Entry{
+		Source: copied, SourceSize: srcInfo.Size(), SourceModTime: srcInfo.ModTime(),
+		Destination: placed, DestinationSize: dstInfo.Size(), DestinationModTime: dstInfo.ModTime(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", src, dst, "--execute", "--resume", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	var ops []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &ops); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, out)
+	}
+	actions := make(map[string]string)
+	for _, op := range ops {
+		actions[filepath.Base(op.SourcePath)] = op.Action
+	}
+	if actions["IMG_20240102_030405.jpg"] != "skipped_identical" || actions["IMG_20240103_030405.jpg"] != "copied" {
+		t.Errorf("unexpected actions: %v", actions)
+	}
+	if _, err := os.Stat(filepath.Join(dst, checkpoint.FileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the checkpoint to be removed: %v", err)
+	}
+}
+
+func TestOrganizeCommand_Export(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20230102_030405.jpg")
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	dest := t.TempDir()
+	path := filepath.Join(t.TempDir(), "run.db")
+
+	cmd := newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--export", path})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM files WHERE action = 'copy' AND best_source = 'filename'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 planned copies in the export, got %d", n)
+	}
+
+	parquet := filepath.Join(t.TempDir(), "scan.parquet")
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"scan", tmp, "--export", parquet})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if data, err := os.ReadFile(parquet); err != nil || !bytes.HasPrefix(data, []byte("PAR1")) {
+		t.Errorf("expected a Parquet file, got %v", err)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--export", path})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an existing export to be refused")
+	}
+}
+
+func TestOrganizeCommand_HashList(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	dest := t.TempDir()
+	archived := filepath.Join(dest, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if err := os.MkdirAll(filepath.Dir(archived), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The archived copy differs from what its audit recorded: the audit is trusted without reading it.
+	content := strings.Repeat("x", len("IMG_20240102_030405.jpg"))
+	if err := os.WriteFile(archived, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list := filepath.Join(t.TempDir(), "audit.txt")
+	audit := fmt.Sprintf("%%%%%%%% HASHDEEP-1.0\n%%%%%%%% size,sha256,filename\n%d,%x,%s\n", len(content), sha256.Sum256([]byte("IMG_20240102_030405.jpg")), archived)
+	if err := os.WriteFile(list, []byte(audit), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--json", "--hash-list", list})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("decode: %v\n%s", err, out)
+	}
+	if len(operations) != 1 || operations[0].Action != "skipped_identical" {
+		t.Errorf("expected the source to be skipped as identical to its audited copy, got %+v", operations)
+	}
+}
+
+func TestOrganizeCommand_Hash(t *testing.T) {
+	tmp := t.TempDir()
+	writeFileWithContent(t, tmp, "IMG_20240102_030405.jpg", "same")
+	writeFileWithContent(t, tmp, "copy/IMG_20240102_030405.jpg", "same")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, t.TempDir(), "--json", "--hash", "xxhash128"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("decode: %v\n%s", err, out)
+	}
+	if len(operations) != 2 || operations[1].Action != "skipped_duplicate_source" {
+		t.Errorf("expected the copy to be skipped as a duplicate, got %+v", operations)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, t.TempDir(), "--hash", "md5"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "invalid hash algorithm") {
+		t.Errorf("expected an invalid algorithm to be refused, got %v", err)
+	}
+}
+
+func TestOrganizeCommand_RetryFailed(t *testing.T) {
+	tmp := t.TempDir()
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	dest := t.TempDir()
+	source := filepath.Join(tmp, "IMG_20240102_030405.jpg")
+	final := filepath.Join(dest, "2024", "01", "02", "IMG_20240102_030405_1.jpg")
+
+	// One copy failed after its destination was resolved, one file failed before.
+	report := filepath.Join(t.TempDir(), "report.json")
+	lines := fmt.Sprintf(`{"source_path": %q, "destination_path": %q, "final_destination_path": %q, "action": "failed", "error": "disk full"}
+{"source_path": %q, "action": "failed", "error": "unreadable"}
+`, source, filepath.Join(dest, "2024", "01", "02", "IMG_20240102_030405.jpg"), final, filepath.Join(tmp, "broken.jpg"))
+	if err := os.WriteFile(report, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmp, dest, "--retry-failed", report, "--execute", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var ops []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &ops); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if len(ops) != 1 || ops[0]["action"] != "copied_renamed" || ops[0]["final_destination_path"] != final {
+		t.Fatalf("expected the failed copy retried to its resolved destination, got %v", ops)
+	}
+	if _, err := os.Stat(final); err != nil {
+		t.Errorf("expected %s to be copied: %v", final, err)
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFileWithContent(t, src, "IMG_20240103_030405.jpg", "b")
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+
+	cmd := newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", src, dst, "--plan-out", planPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	f, err := readPlanFile(planPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Entries) != 2 || f.Source != src || f.Destination != dst || f.Entries[0].SourceSHA256 == "" {
+		t.Fatalf("unexpected plan: %+v", f)
+	}
+	// The plan is reviewed and edited by hand: the second file is left out.
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := bytes.Index(data, []byte(`"source": "IMG_20240103_030405.jpg"`))
+	action := entry + bytes.Index(data[entry:], []byte(`"action": "copy"`))
+	edited := slices.Concat(data[:action], []byte(`"action": "skipped_unsupported"`), data[action+len(`"action": "copy"`):])
+	if err := os.WriteFile(planPath, edited, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"apply", planPath, "--execute"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--edited") {
+		t.Fatalf("expected the edited plan refused without --edited, got %v", err)
+	}
+
+	cmd = newRootCmd()
+	stdout := new(bytes.Buffer)
+	cmd.SetOut(stdout)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"apply", planPath, "--edited", "--execute", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	var ops []jsonOperation
+	if err := json.Unmarshal(stdout.Bytes(), &ops); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, stdout)
+	}
+	if len(ops) != 1 || ops[0].Action != "copied" {
+		t.Fatalf("unexpected operations: %+v", ops)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg")); err != nil {
+		t.Errorf("expected the planned file copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024", "01", "03", "IMG_20240103_030405.jpg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the file left out of the plan not copied: %v", err)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", src, dst, "--plan-out", planPath, "--execute"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--plan-out") {
+		t.Errorf("expected --plan-out refused with --execute, got %v", err)
+	}
+}
+
+func TestOrganizeCommand_JSONOutput(t *testing.T) {
+	tmp := t.TempDir()
+
+	writeFile(t, tmp, "IMG_20240102_030405.jpg")
+	writeFileWithMTime(t, tmp, "vacation.jpg", time.Date(2020, 8, 15, 14, 30, 0, 0, time.UTC))
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	dest := t.TempDir()
+
+	cmd.SetArgs([]string{"organize", tmp, dest, "--json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+
+	if len(operations) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(operations))
+	}
+
+	// Check first operation (filename-based)
+	if !strings.Contains(operations[0].SourcePath, "IMG_20240102_030405.jpg") {
+		t.Errorf("expected source path to contain IMG_20240102_030405.jpg, got %s", operations[0].SourcePath)
+	}
+	if operations[0].CreatedAt.Filename == "" {
+		t.Errorf("expected created_at.filename to be set")
+	}
+	if operations[0].CreatedAt.Filestat == "" {
+		t.Errorf("expected created_at.filestat to be set")
+	}
+	if operations[0].FileSizeBytes <= 0 {
+		t.Errorf("expected file_size_bytes to be > 0")
+	}
+	if operations[0].BestSource != "filename" || operations[0].BestCreatedAt != operations[0].CreatedAt.Filename || operations[0].Confidence != "medium" {
+		t.Errorf("expected the filename date with medium confidence, got %+v", operations[0].jsonAttribution)
+	}
+	if !strings.Contains(operations[0].DestinationPath, filepath.Join(dest, "2024", "01", "02")) {
+		t.Errorf("expected destination to contain 2024/01/02, got %s", operations[0].DestinationPath)
+	}
+
+	// Check second operation (mtime-based, filename doesn't match pattern)
+	if !strings.Contains(operations[1].SourcePath, "vacation.jpg") {
+		t.Errorf("expected source path to contain vacation.jpg, got %s", operations[1].SourcePath)
+	}
+	if operations[1].CreatedAt.Filename != "" {
+		t.Errorf("expected created_at.filename to be empty for vacation.jpg")
+	}
+	if operations[1].CreatedAt.Filestat == "" {
+		t.Errorf("expected created_at.filestat to be set")
+	}
+	if operations[1].FileSizeBytes <= 0 {
+		t.Errorf("expected file_size_bytes to be > 0")
+	}
+	if operations[1].BestSource != "mtime" || operations[1].Confidence != "low" {
+		t.Errorf("expected the mtime with low confidence, got %+v", operations[1].jsonAttribution)
+	}
+	if !strings.Contains(operations[1].DestinationPath, filepath.Join(dest, "2020", "08", "15")) {
+		t.Errorf("expected destination to contain 2020/08/15, got %s", operations[1].DestinationPath)
+	}
+}
+
+func TestOrganizeCommand_SidecarsTravelWithMedia(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+	writeFile(t, tmpSrc, "IMG_20240102_030405.xmp")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sidecarPath := filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.xmp")
+	if _, err := os.Stat(sidecarPath); err != nil {
+		t.Fatalf("sidecar was not copied: %v", err)
+	}
+}
+
+func TestOrganizeCommand_SidecarsRequire(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+	writeFile(t, tmpSrc, "IMG_20240102_030405.xmp")
+	writeFile(t, tmpSrc, "IMG_20240103_030405.jpg")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--sidecars", "require", "--json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(operations))
+	}
+	if operations[0].Action != "copy" || len(operations[0].Sidecars) != 1 {
+		t.Fatalf("expected first file to be copied with its sidecar, got %+v", operations[0])
+	}
+	if operations[1].Action != "failed" || operations[1].ErrorCode != "E_SIDECAR_MISSING" {
+		t.Fatalf("expected file without sidecar to fail with E_SIDECAR_MISSING, got %+v", operations[1])
+	}
+}
+
+func TestOrganizeCommand_ContinuesAfterUnreadableFile(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+	// A dangling symlink is listed by the scan but cannot be read.
+	if err := os.Symlink(filepath.Join(tmpSrc, "missing.jpg"), filepath.Join(tmpSrc, "IMG_20240103_030405.jpg")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(operations))
+	}
+	if operations[0].Action != "copy" {
+		t.Fatalf("expected readable file to be planned, got %+v", operations[0])
+	}
+	if operations[1].Action != "failed" || operations[1].ErrorCode != "E_READ_FAILED" {
+		t.Fatalf("expected unreadable file to fail with E_READ_FAILED, got %+v", operations[1])
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--fail-fast"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected --fail-fast to abort on the unreadable file")
+	}
+}
+
+func TestOrganizeCommand_FailsEmptyFiles(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", "")
+
+	for flag, want := range map[string]string{"": "E_EMPTY_FILE", "--allow-incomplete": ""} {
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		args := []string{"organize", tmpSrc, t.TempDir(), "--json"}
+		if flag != "" {
+			args = append(args, flag)
+		}
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var operations []jsonOperation
+		if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+			t.Fatalf("expected valid JSON, got %v", err)
+		}
+		if len(operations) != 1 || operations[0].ErrorCode != want {
+			t.Errorf("%q: expected error code %q, got %+v", flag, want, operations)
+		}
+	}
+}
+
+func TestOrganizeCommand_InvalidSidecarPolicy(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", t.TempDir(), t.TempDir(), "--sidecars", "sometimes"})
+
+	if err := cmd.Execute(); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestOrganizeCommand_NoDedupeKeepsIdenticalSources(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	for _, name := range []string{"a/IMG_20240102_030405.jpg", "b/IMG_20240102_030405.jpg"} {
+		path := filepath.Join(tmpSrc, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("same"), 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+
+	run := func(extra ...string) []jsonOperation {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append([]string{"organize", tmpSrc, tmpDst, "--json"}, extra...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var operations []jsonOperation
+		if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+			t.Fatalf("failed to parse JSON: %v", err)
+		}
+		return operations
+	}
+
+	if ops := run(); ops[1].Action != "skipped_duplicate_source" {
+		t.Fatalf("expected duplicate to be skipped by default, got %+v", ops[1])
+	}
+	if ops := run("--dedupe-scope", "directory"); ops[1].Action != "copy_renamed" {
+		t.Fatalf("expected directory scope to keep cross-directory copy, got %+v", ops[1])
+	}
+	if ops := run("--no-dedupe"); ops[1].Action != "copy_renamed" {
+		t.Fatalf("expected --no-dedupe to keep duplicate, got %+v", ops[1])
+	}
+}
+
+func TestOrganizeCommand_VerboseReportsSavedBytes(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFileWithContent(t, tmpSrc, "a/IMG_20240102_030405.jpg", "same")
+	writeFileWithContent(t, tmpSrc, "b/IMG_20240102_030405.jpg", "same")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--verbose"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, want := range []string{
+		"skipped 1 duplicates of 1 files, saving 4 B",
+		"4 B  " + filepath.Join(tmpSrc, "a", "IMG_20240102_030405.jpg") + " (1 duplicates)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestOrganizeCommand_CameraFilter(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", string(testjpeg.WithCamera("Canon", "Canon EOS R5")))
+	writeFileWithContent(t, tmpSrc, "IMG_20240103_030405.jpg", string(testjpeg.WithCamera("Apple", "iPhone 13")))
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--json", "--camera", "Canon EOS R5"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 1 || operations[0].Camera != "Canon EOS R5" {
+		t.Fatalf("expected only the Canon file, got %+v", operations)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--verbose"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "1        68 B  Apple iPhone 13"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out)
+	}
+}
+
+func TestOrganizeCommand_Devices(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", string(testjpeg.WithCamera("Apple", "iPhone 13")))
+	writeFileWithContent(t, tmpSrc, "PXL_20240103_030405123.mp4", "video")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--layout", "{device}/{year}"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	devices := make(map[string]string)
+	for _, op := range operations {
+		devices[filepath.Base(op.SourcePath)] = op.Device
+	}
+	if devices["IMG_20240102_030405.jpg"] != "Apple iPhone 13" || devices["PXL_20240103_030405123.mp4"] != "Google Pixel" {
+		t.Fatalf("unexpected devices %v", devices)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--verbose"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "per device:\n     1        68 B  Apple iPhone 13\n     1         5 B  Google Pixel"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out)
+	}
+}
+
+func TestOrganizeCommand_Routes(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", "a")
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.xmp", `<rdf:Description xmp:Rating="5"><dc:subject><rdf:Bag><rdf:li>best</rdf:li></rdf:Bag></dc:subject></rdf:Description>`)
+	writeFileWithContent(t, tmpSrc, "IMG_20240103_030405.jpg", "b")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--json", "--route", "rating>=4:Best/{year}"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("expected 2 operations, got %+v", operations)
+	}
+	for _, op := range operations {
+		rated := filepath.Base(op.SourcePath) == "IMG_20240102_030405.jpg"
+		if best := strings.HasPrefix(op.DestinationPath, filepath.Join(tmpDst, "Best")); best != rated {
+			t.Errorf("%s: unexpected destination %s", op.SourcePath, op.DestinationPath)
+		}
+		if want := map[bool]int{true: 5}[rated]; op.Rating != want {
+			t.Errorf("%s: rating %d, want %d", op.SourcePath, op.Rating, want)
+		}
+		if rated && (len(op.Keywords) != 1 || op.Keywords[0] != "best") {
+			t.Errorf("%s: keywords %q, want [best]", op.SourcePath, op.Keywords)
+		}
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--route", "stars>=4:Best"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for a route on an unknown field")
+	}
+}
+
+func TestOrganizeCommand_Screenshots(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "Screenshot_2024-01-02-03-04-05.png", "a")
+	writeFileWithContent(t, tmpSrc, "IMG_20240103_030405.jpg", "b")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	for _, op := range operations {
+		if want := strings.HasPrefix(filepath.Base(op.SourcePath), "Screenshot"); op.Screenshot != want {
+			t.Errorf("%s: screenshot %v, want %v", op.SourcePath, op.Screenshot, want)
+		}
+	}
+}
+
+func TestOrganizeCommand_VideoInfo(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "VID_20240102_030405.mp4", string(mp4WithDuration(2500)))
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 1 || operations[0].DurationSeconds != 2.5 {
+		t.Fatalf("expected a duration of 2.5 seconds, got %+v", operations)
+	}
+}
+
+func TestOrganizeCommand_SimilarVideos(t *testing.T) {
+	// Without ffmpeg in PATH the durations are compared.
+	t.Setenv("PATH", t.TempDir())
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "VID_20240102_030405.mp4", string(mp4WithDuration(10000))+strings.Repeat("m", 100))
+	writeFileWithContent(t, tmpSrc, "VID-20240102-WA0001.mp4", string(mp4WithDuration(10040)))
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--similar-videos"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "  ~ similar to " + filepath.Join(tmpSrc, "VID_20240102_030405.mp4") + " (re-encoded copy?)"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out)
+	}
+}
+
+func TestOrganizeCommand_NearDuplicates(t *testing.T) {
+	photo := func(width, height int) string {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for y := range height {
+			for x := range width {
+				img.Pix[img.PixOffset(x, y)] = uint8(x * x * 255 / (width * width))
+			}
+		}
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", photo(400, 300))
+	writeFileWithContent(t, tmpSrc, "IMG-20240102-WA0001.jpg", photo(200, 150))
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--near-duplicates"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("decode: %v\n%s", err, out)
+	}
+	want := map[string]string{
+		filepath.Join(tmpSrc, "IMG-20240102-WA0001.jpg"): filepath.Join(tmpSrc, "IMG_20240102_030405.jpg"),
+		filepath.Join(tmpSrc, "IMG_20240102_030405.jpg"): "",
+	}
+	if len(operations) != len(want) {
+		t.Fatalf("got %d operations, want %d: %+v", len(operations), len(want), operations)
+	}
+	for _, op := range operations {
+		if op.NearDuplicateOf != want[op.SourcePath] || op.Action != "copy" {
+			t.Errorf("unexpected operation %+v", op)
+		}
+	}
+}
+
+// mp4WithDuration returns an MP4 whose movie header records a duration of milliseconds.
+func mp4WithDuration(milliseconds uint32) []byte {
+	mvhd := make([]byte, 28)
+	copy(mvhd[4:], "mvhd")
+	binary.BigEndian.PutUint32(mvhd, 28)
+	binary.BigEndian.PutUint32(mvhd[20:], 1000)
+	binary.BigEndian.PutUint32(mvhd[24:], milliseconds)
+	moov := binary.BigEndian.AppendUint32(nil, uint32(len(mvhd)+8))
+	moov = append(moov, "moov"...)
+	moov = append(moov, mvhd...)
+	return append([]byte("\x00\x00\x00\x0Cftypisom"), moov...)
+}
+
+func TestOrganizeCommand_Bursts(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405_BURST001.jpg", "a")
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405_BURST002_COVER.jpg", "b")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--bursts", "best"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if want := "(burst shot, best is " + filepath.Join(tmpSrc, "IMG_20240102_030405_BURST002_COVER.jpg") + ")"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--bursts", "all"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for an unknown burst policy")
+	}
+}
+
+func TestOrganizeCommand_ConvertHEIC(t *testing.T) {
+	bin := t.TempDir()
+	writeFileWithContent(t, bin, "heif-convert", "#!/bin/sh\ncp \"$3\" \"$4\"\n")
+	if err := os.Chmod(filepath.Join(bin, "heif-convert"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	tmpSrc, tmpDst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.heic", "heic")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--convert-heic", "keep", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	want := filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if len(operations) != 1 || !operations[0].ConvertedToJPEG || len(operations[0].Sidecars) != 1 ||
+		operations[0].Sidecars[0].DestinationPath != want || !operations[0].Sidecars[0].Extracted {
+		t.Errorf("unexpected operations %+v", operations)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--convert-heic", "jpeg"})
+	if err := cmd.Execute(); err == nil {
+		t.Fatal("expected an error for an unknown HEIC conversion policy")
+	}
+}
+
+func TestOrganizeCommand_Timezone(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "camera/IMG_20240102_003000.jpg", "a")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--timezone", "camera=UTC"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 1 || operations[0].BestCreatedAt != "2024-01-02T00:30:00Z" {
+		t.Fatalf("expected the filename date in UTC, got %+v", operations)
+	}
+
+	for _, value := range []string{"camera", "=UTC", "camera=Mars/Olympus"} {
+		cmd = newRootCmd()
+		cmd.SetOut(new(bytes.Buffer))
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--timezone", value})
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("--timezone %s: expected error, got nil", value)
+		}
+	}
+}
+
+func TestOrganizeCommand_AssumeTimezone(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_003000.jpg", "a")
+	writeFileWithContent(t, tmpSrc, "camera/IMG_20240103_003000.jpg", "b")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--assume-timezone", "Asia/Tokyo", "--timezone", "camera=UTC"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	dates := make(map[string]string)
+	for _, op := range operations {
+		dates[filepath.Base(op.SourcePath)] = op.BestCreatedAt
+	}
+	if dates["IMG_20240102_003000.jpg"] != "2024-01-02T00:30:00+09:00" || dates["IMG_20240103_003000.jpg"] != "2024-01-03T00:30:00Z" {
+		t.Fatalf("expected the assumed timezone outside the --timezone directory, got %v", dates)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--assume-timezone", "Mars/Olympus"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an unknown --assume-timezone to fail")
+	}
+}
+
+func TestOrganizeCommand_StrictDates(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "holiday.jpg", "a")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--strict-dates"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 1 || operations[0].BestSource != "unknown" {
+		t.Fatalf("expected the file to stay undated, got %+v", operations)
+	}
+}
+
+func TestOrganizeCommand_Track(t *testing.T) {
+	tmpSrc := t.TempDir()
+	writeFileWithContent(t, tmpSrc, "camera/IMG_20240714_110500.jpg", "a")
+	gpx := `<gpx><trk><trkseg>
+<trkpt lat="46.36" lon="14.09"><time>2024-07-14T08:00:00Z</time></trkpt>
+<trkpt lat="46.37" lon="14.11"><time>2024-07-14T08:10:00Z</time></trkpt>
+</trkseg></trk></gpx>`
+	writeFileWithContent(t, tmpSrc, "tracks/bled.gpx", gpx)
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	// The camera was left on Amsterdam winter time: 11:05 summer time is 10:05.
+	cmd.SetArgs([]string{"organize", tmpSrc, t.TempDir(), "--json", "--timezone", "camera=Europe/Amsterdam",
+		"--track", filepath.Join(tmpSrc, "tracks", "bled.gpx"), "--track-offset", "1h"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	if len(operations) != 1 || operations[0].TrackPosition == nil || operations[0].ClockOffset != "1h0m0s" {
+		t.Fatalf("expected the file to be placed on the track, got %+v", operations)
+	}
+	if p := *operations[0].TrackPosition; p.Lat < 46.364 || p.Lat > 46.366 {
+		t.Errorf("expected the position halfway the track, got %+v", p)
+	}
+}
+
+func TestOrganizeCommand_Review(t *testing.T) {
+	tmpSrc, tmpDst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", "a")
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--json", "--review-below", "high", "--review-dir", "check"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	want := filepath.Join(tmpDst, "check", "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if len(operations) != 1 || operations[0].DestinationPath != want {
+		t.Fatalf("expected the filename-dated file in the review directory, got %+v", operations)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--review-below", "certain"})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an error for an unknown confidence")
+	}
+}
+
+func TestOrganizeCommand_DateCheck(t *testing.T) {
+	tmpSrc, tmpDst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, tmpSrc, "IMG_19800101_000000.jpg", "a")
+	writeFileWithContent(t, tmpSrc, "IMG_20240102_030405.jpg", "b")
+
+	run := func(args ...string) map[string]jsonOperation {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetArgs(append([]string{"organize", tmpSrc, tmpDst, "--json"}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("organize %v: %v", args, err)
+		}
+		var operations []jsonOperation
+		if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+			t.Fatalf("expected valid JSON, got %v", err)
+		}
+		byName := make(map[string]jsonOperation)
+		for _, op := range operations {
+			byName[filepath.Base(op.SourcePath)] = op
+		}
+		return byName
+	}
+
+	ops := run()
+	reset := ops["IMG_19800101_000000.jpg"]
+	if want := filepath.Join(tmpDst, "_review", "1980", "01", "01", "IMG_19800101_000000.jpg"); reset.DestinationPath != want ||
+		reset.SuspiciousDate != "dated 1980-01-01, before 1990-01-01" {
+		t.Errorf("expected the reset date in the review directory, got %+v", reset)
+	}
+	if op := ops["IMG_20240102_030405.jpg"]; op.DestinationPath != filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.jpg") || op.SuspiciousDate != "" {
+		t.Errorf("expected a plausible date under its date, got %+v", op)
+	}
+
+	for _, args := range [][]string{{"--earliest-date", "1970"}, {"--no-date-check"}} {
+		if op := run(args...)["IMG_19800101_000000.jpg"]; op.DestinationPath != filepath.Join(tmpDst, "1980", "01", "01", "IMG_19800101_000000.jpg") {
+			t.Errorf("%v: expected the file under its date, got %+v", args, op)
+		}
+	}
+}
+
+func TestOrganizeCommand_ExtractsMotionPhotoVideo(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	video := "\x00\x00\x00\x10ftypisom\x00\x00\x00\x00moov"
+	xmp := "http://ns.adobe.com/xap/1.0/\x00" + `<rdf:Description GCamera:MicroVideo="1" GCamera:MicroVideoOffset="` + strconv.Itoa(len(video)) + `"/>`
+	photo := "\xFF\xD8\xFF\xE1" + string(binary.BigEndian.AppendUint16(nil, uint16(len(xmp)+2))) + xmp + "\xFF\xD9" + video
+	writeFileWithContent(t, tmpSrc, "MVIMG_20240102_030405.jpg", photo)
+
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--json", "--motion-photos", "extract"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("expected valid JSON, got %v", err)
+	}
+	want := filepath.Join(tmpDst, "2024", "01", "02", "MVIMG_20240102_030405.mp4")
+	if len(operations) != 1 || !operations[0].MotionPhoto || len(operations[0].Sidecars) != 1 ||
+		operations[0].Sidecars[0].DestinationPath != want || !operations[0].Sidecars[0].Extracted {
+		t.Fatalf("expected a motion photo with its video as companion %s, got %+v", want, operations)
+	}
+}
+
+func TestOrganizeCommand_MetricsFile(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+	metricsPath := filepath.Join(t.TempDir(), "media_organizer.prom")
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute", "--metrics-file", metricsPath})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	b, err := os.ReadFile(metricsPath)
+	if err != nil {
+		t.Fatalf("read metrics file: %v", err)
+	}
+	want := `media_organizer_last_run_files{command="organize",mode="execute",action="copied"} 1`
+	if !strings.Contains(string(b), want) {
+		t.Fatalf("expected metrics to contain %q, got:\n%s", want, b)
+	}
+}
+
+func TestVerifyCommand_ChecksManifest(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+
+	run := func(args ...string) (string, error) {
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	if out, err := run("organize", tmpSrc, tmpDst, "--execute", "--manifest", "library"); err != nil {
+		t.Fatalf("organize: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDst, "SHA256SUMS")); err != nil {
+		t.Fatalf("no manifest: %v", err)
+	}
+	if out, err := run("verify", tmpDst); err != nil {
+		t.Fatalf("verify: %v\n%s", err, out)
+	}
+
+	writeFileWithContent(t, tmpDst, "2024/01/02/IMG_20240102_030405.jpg", "bit rot")
+	out, err := run("verify", tmpDst)
+	if err == nil || !strings.Contains(out, "changed "+filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.jpg")) {
+		t.Fatalf("expected a changed file, got %v\n%s", err, out)
+	}
+}
+
+func TestDoctorCommand_ReportsFindings(t *testing.T) {
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"doctor", t.TempDir()})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{"[ok] writable", "hardlink", "tool:exiftool"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got %q", want, output)
+		}
+	}
+}
+
+func TestBenchCommand_ReportsThroughput(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg")
+	writeFile(t, src, "VID_20240102_030405.mp4")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"bench", src, t.TempDir(), "--workers", "1,2"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	output := out.String()
+	for _, want := range []string{"scan: 2 files", "hash:  1 workers", "copy: ", "suggested workers: ", "estimated time to organize"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got %q", want, output)
+		}
+	}
+}
+
+func TestMergeCommand_IntoFirstLibrary(t *testing.T) {
+	libA := t.TempDir()
+	libB := t.TempDir()
+
+	writeFileWithContent(t, libA, "2024/01/02/IMG_20240102_030405.jpg", "shared")
+	// Same content as libA, stored under a different layout and name.
+	writeFileWithContent(t, libB, "2024/01/IMG_20240102_030405_copy.jpg", "shared")
+	writeFileWithContent(t, libB, "2024/01/IMG_20240105_030405.jpg", "only-b")
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"merge", libA, libB, "--execute", "--json"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var operations []jsonOperation
+	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if len(operations) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(operations))
+	}
+	if operations[0].Action != "skipped_identical" {
+		t.Fatalf("expected shared file to be skipped, got %+v", operations[0])
+	}
+	if operations[1].Action != "copied" {
+		t.Fatalf("expected new file to be copied, got %+v", operations[1])
+	}
+	if _, err := os.Stat(filepath.Join(libA, "2024", "01", "05", "IMG_20240105_030405.jpg")); err != nil {
+		t.Fatalf("expected merged file in libA: %v", err)
+	}
+}
+
+func TestMergeCommand_IntoOutput(t *testing.T) {
+	libA := t.TempDir()
+	libB := t.TempDir()
+	outDir := filepath.Join(t.TempDir(), "merged")
+
+	writeFileWithContent(t, libA, "2024/01/02/IMG_20240102_030405.jpg", "shared")
+	writeFileWithContent(t, libB, "2024-01/IMG_20240102_030405.jpg", "shared")
+	writeFileWithContent(t, libB, "2024-01/IMG_20240105_030405.jpg", "only-b")
+
 	cmd := newRootCmd()
 
 	out := new(bytes.Buffer)
 	cmd.SetOut(out)
 	cmd.SetErr(out)
-	cmd.SetArgs([]string{})
+	cmd.SetArgs([]string{"merge", libA, libB, outDir, "--execute"})
 
 	if err := cmd.Execute(); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	output := out.String()
-	if !strings.Contains(output, "Media Organizer CLI") {
-		t.Fatalf("expected output to include CLI header, got %q", output)
+	for _, rel := range []string{"2024/01/02/IMG_20240102_030405.jpg", "2024/01/05/IMG_20240105_030405.jpg"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s in merged library: %v", rel, err)
+		}
 	}
-	if !strings.Contains(output, "Version: "+version) {
-		t.Fatalf("expected output to include version, got %q", output)
+	if _, err := os.Stat(filepath.Join(outDir, "2024", "01", "02", "IMG_20240102_030405_1.jpg")); err == nil {
+		t.Errorf("expected shared file to be merged only once")
 	}
 }
 
-func TestRootCommand_VerboseFlag(t *testing.T) {
+func TestMigrateCommand_DailyToMonthlyAndUndo(t *testing.T) {
+	lib := t.TempDir()
+	writeFile(t, lib, "2024/01/02/IMG_20240102_030405.jpg")
+	// Dated only by a modification time a copy reset: the directory keeps its date.
+	writeFile(t, lib, "2023/05/06/holiday.jpg")
+	journal := filepath.Join(t.TempDir(), "journal.json")
+
 	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"migrate", lib, "--from", "daily", "--to", "monthly", "--execute", "--journal", journal})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("migrate: %v\n%s", err, out)
+	}
+	for _, rel := range []string{"2024/01/IMG_20240102_030405.jpg", "2023/05/holiday.jpg"} {
+		if _, err := os.Stat(filepath.Join(lib, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s after the migration: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lib, "2024", "01", "02")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied day directory to be removed, got %v", err)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"migrate", "--undo", journal, "--execute"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("migrate --undo: %v\n%s", err, out)
+	}
+	for _, rel := range []string{"2024/01/02/IMG_20240102_030405.jpg", "2023/05/06/holiday.jpg"} {
+		if _, err := os.Stat(filepath.Join(lib, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s after undoing the migration: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lib, "2023", "05", "holiday.jpg")); !os.IsNotExist(err) {
+		t.Errorf("expected the migrated file to be moved back, got %v", err)
+	}
+}
 
+func TestUndoCommand_RevertsOrganizeRun(t *testing.T) {
+	src, lib := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg")
+	writeFile(t, src, "IMG_20240102_030405.xmp")
+	writeFile(t, src, "IMG_20240203_040506.jpg")
+	journal := filepath.Join(t.TempDir(), "organize.jsonl")
+
+	cmd := newRootCmd()
 	out := new(bytes.Buffer)
 	cmd.SetOut(out)
 	cmd.SetErr(out)
-	cmd.SetArgs([]string{"--verbose"})
+	cmd.SetArgs([]string{"organize", src, lib, "--execute", "--journal", journal})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v\n%s", err, out)
+	}
+	edited := filepath.Join(lib, "2024", "02", "03", "IMG_20240203_040506.jpg")
+	if err := os.WriteFile(edited, []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
 
+	// A dry run lists what would be undone and changes nothing.
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"undo", journal, "--library", lib})
 	if err := cmd.Execute(); err != nil {
-		t.Fatalf("expected no error, got %v", err)
+		t.Fatalf("undo: %v\n%s", err, out)
+	}
+	copied := filepath.Join(lib, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if !strings.Contains(out.String(), "remove "+copied) || !strings.Contains(out.String(), "skip "+edited) {
+		t.Errorf("unexpected dry run output:\n%s", out)
+	}
+	if _, err := os.Stat(copied); err != nil {
+		t.Fatalf("dry run removed %s: %v", copied, err)
 	}
 
-	output := out.String()
-	if !strings.Contains(output, "Verbose mode: enabled") {
-		t.Fatalf("expected verbose line, got %q", output)
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"undo", journal, "--library", lib, "--execute"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "1 files could not be undone") {
+		t.Fatalf("undo: got %v, want the edited copy reported\n%s", err, out)
+	}
+	for _, path := range []string{copied, strings.TrimSuffix(copied, ".jpg") + ".xmp", filepath.Join(lib, "2024", "01")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", path, err)
+		}
+	}
+	if _, err := os.Stat(edited); err != nil {
+		t.Errorf("expected the edited copy to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "IMG_20240102_030405.jpg")); err != nil {
+		t.Errorf("expected the source to be kept: %v", err)
 	}
 }
 
-func TestOrganizeCommand_RequiresTwoArgs(t *testing.T) {
-	cmd := newRootCmd()
+func TestUndoCommand_Trash(t *testing.T) {
+	src, lib := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg")
+	journal := filepath.Join(t.TempDir(), "organize.jsonl")
 
+	cmd := newRootCmd()
 	out := new(bytes.Buffer)
 	cmd.SetOut(out)
 	cmd.SetErr(out)
-	cmd.SetArgs([]string{"organize", "only-source"})
-
+	cmd.SetArgs([]string{"organize", src, lib, "--execute", "--trash", "destination"})
 	if err := cmd.Execute(); err == nil {
-		t.Fatalf("expected error, got nil")
+		t.Fatalf("expected --trash without --move or --in-place to fail\n%s", out)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", src, lib, "--execute", "--journal", journal})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v\n%s", err, out)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"undo", journal, "--library", lib, "--execute", "--trash", "destination", "--trash-dir", "Removed"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("undo: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(lib, "2024")); !os.IsNotExist(err) {
+		t.Errorf("expected the copy to leave the library, got %v", err)
+	}
+	trashed, _ := filepath.Glob(filepath.Join(lib, "Removed", "*", "2024", "01", "02", "IMG_20240102_030405.jpg"))
+	if len(trashed) != 1 {
+		t.Errorf("expected the copy in the trash of the library, got %v", trashed)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"undo", journal, "--library", lib, "--trash", "destination", "--trash-dir", "../Removed"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "not inside the destination") {
+		t.Errorf("expected a trash directory outside the library refused, got %v\n%s", err, out)
 	}
 }
 
-func TestOrganizeCommand_DryRunPrintsCreatedAtRecords(t *testing.T) {
-	tmp := t.TempDir()
+func TestReviewCommand(t *testing.T) {
+	src, lib := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFileWithContent(t, src, "scans/scan1.jpg", "b")
+	writeFileWithContent(t, src, "scans/scan2.jpg", "c")
 
-	writeFile(t, tmp, "IMG_20240102_030405.jpg")
-	writeFileWithMTime(t, tmp, "holiday.jpg", time.Date(2020, 6, 7, 8, 9, 10, 0, time.UTC))
-	writeFile(t, tmp, "sub/VID_20240102_030405.mp4")
-	writeFile(t, tmp, "ignore.txt")
+	cmd := newRootCmd()
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", src, lib, "--execute", "--strict-dates", "--review-below", "high"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("organize: %v\n%s", err, out)
+	}
+	reviewed := filepath.Join(lib, "_review", "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if _, err := os.Stat(review.NotePath(reviewed)); err != nil {
+		t.Fatalf("expected a review note: %v", err)
+	}
+
+	// Skip the first scan, date the second one by hand and accept the filename date of the photo.
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetIn(strings.NewReader("\n1998-07-14\na\n"))
+	cmd.SetArgs([]string{"review", lib, "--execute", "--thumbnails", t.TempDir()})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("review: %v\n%s", err, out)
+	}
+	if !strings.Contains(out.String(), "filename   2024-01-02T03:04:05") {
+		t.Errorf("expected the candidates to be shown, got\n%s", out)
+	}
+	for _, rel := range []string{"unknown/scan1.jpg", "1998/07/14/scan2.jpg", "2024/01/02/IMG_20240102_030405.jpg"} {
+		if _, err := os.Stat(filepath.Join(lib, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s after the review: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lib, "_review")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied review directory and its note to be removed, got %v", err)
+	}
+
+	cmd = newRootCmd()
+	out.Reset()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"review", lib, filepath.Join(lib, "unknown"), "--date", "1998-07"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("review --date: %v\n%s", err, out)
+	}
+	want := filepath.Join(lib, "unknown", "scan1.jpg") + " -> " + filepath.Join(lib, "1998", "07", "01", "scan1.jpg")
+	if got := strings.TrimSpace(out.String()); got != want {
+		t.Errorf("expected the dry-run move %q, got %q", want, got)
+	}
+}
+
+func TestCompareCommand_ReportsDifferences(t *testing.T) {
+	a := t.TempDir()
+	b := t.TempDir()
 
-	dest := filepath.Join(tmp, "dst")
+	writeFileWithContent(t, a, "same.jpg", "same")
+	writeFileWithContent(t, a, "backup-only.jpg", "old")
+	writeFileWithContent(t, b, "same.jpg", "same")
 
 	cmd := newRootCmd()
 
 	out := new(bytes.Buffer)
 	cmd.SetOut(out)
 	cmd.SetErr(out)
-	cmd.SetArgs([]string{"organize", tmp, dest})
+	cmd.SetArgs([]string{"compare", a, b, "--hide-identical"})
 
 	if err := cmd.Execute(); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	output := strings.TrimSpace(out.String())
-	lines := strings.Split(output, "\n")
-	if len(lines) != 3 {
-		t.Fatalf("expected 3 lines, got %d: %q", len(lines), output)
+	if got := strings.TrimSpace(out.String()); got != "only in a: backup-only.jpg" {
+		t.Fatalf("unexpected output %q", got)
 	}
+}
 
-	// Output format is now: <source> -> <destination>
-	if !strings.Contains(lines[0], "IMG_20240102_030405.jpg -> "+dest) || !strings.Contains(lines[0], filepath.Join(dest, "2024", "01", "02", "IMG_20240102_030405.jpg")) {
-		t.Fatalf("unexpected line: %q", lines[0])
+func TestFixDatesCommand_WritesMissingDates(t *testing.T) {
+	dir := t.TempDir()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
 	}
-	if !strings.Contains(lines[1], "holiday.jpg -> "+dest) || !strings.Contains(lines[1], filepath.Join(dest, "2020", "06", "07", "holiday.jpg")) {
-		t.Fatalf("unexpected line: %q", lines[1])
+	writeFileWithContent(t, dir, "IMG_20240102_030405.jpg", img.String())
+	writeFileWithContent(t, dir, "holiday.jpg", img.String())
+	path := filepath.Join(dir, "IMG_20240102_030405.jpg")
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append([]string{"fix-dates", dir}, args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("fix-dates %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(out.String())
 	}
-	if !strings.Contains(lines[2], "VID_20240102_030405.mp4 -> "+dest) || !strings.Contains(lines[2], filepath.Join(dest, "2024", "01", "02", "VID_20240102_030405.mp4")) {
-		t.Fatalf("unexpected line: %q", lines[2])
+
+	// The file dated only by its mtime is left alone.
+	want := path + ": DateTimeOriginal 2024-01-02 03:04:05 (from filename)"
+	if got := run(); got != want {
+		t.Fatalf("dry-run output %q, want %q", got, want)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, img.Bytes()) {
+		t.Fatalf("dry-run modified the file")
+	}
+
+	if got := run("--execute"); got != "fixed "+want {
+		t.Fatalf("execute output %q, want %q", got, "fixed "+want)
+	}
+	if got := run("--execute"); got != "" {
+		t.Fatalf("second run changed files: %q", got)
 	}
 }
 
-func TestOrganizeCommand_Execute(t *testing.T) {
+func TestSetDateCommand(t *testing.T) {
+	src := t.TempDir()
+	writeFileWithContent(t, src, "scans/scan1.jpg", "a")
+	writeFileWithContent(t, src, "scans/scan2.jpg", "b")
+	writeFileWithContent(t, src, "scans/scan2.jpg.xmp", `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about=""/></rdf:RDF></x:xmpmeta>`)
+	writeFileWithContent(t, src, "IMG_20240102_030405.jpg", "c")
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+		return out.String()
+	}
+
+	scans := filepath.Join(src, "scans")
+	run("set-date", scans, "--date", "1998-07-14")
+	if _, err := os.Stat(filepath.Join(scans, "scan1.jpg.xmp")); !os.IsNotExist(err) {
+		t.Fatalf("dry-run wrote a sidecar: %v", err)
+	}
+	run("set-date", scans, "--date", "1998-07-14", "--execute")
+
+	// With --catalog the date is recorded for organize runs with the same catalog.
+	cat := filepath.Join(t.TempDir(), "catalog.db")
+	run("set-date", filepath.Join(src, "IMG_20240102_030405.jpg"), "--date", "2001-02-03", "--catalog", cat, "--execute")
+
+	lib := t.TempDir()
+	run("organize", src, lib, "--execute", "--catalog", cat)
+	for _, rel := range []string{"1998/07/14/scan1.jpg", "1998/07/14/scan1.jpg.xmp", "1998/07/14/scan2.jpg", "2001/02/03/IMG_20240102_030405.jpg"} {
+		if _, err := os.Stat(filepath.Join(lib, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("expected %s: %v", rel, err)
+		}
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	src := t.TempDir()
+	lib := t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg")
+	writeFile(t, src, "IMG_20240103_030405.jpg")
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(new(bytes.Buffer))
+		cmd.SetArgs(args)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+		return out.String()
+	}
+
+	run("organize", src, lib)
+	if _, err := os.Stat(filepath.Join(lib, history.FileName)); !os.IsNotExist(err) {
+		t.Fatalf("a dry-run wrote the history: %v", err)
+	}
+	run("organize", src, lib, "--execute")
+	run("migrate", lib, "--from", "daily", "--to", "monthly", "--execute", "--journal", filepath.Join(t.TempDir(), "journal.json"))
+
+	var entries []history.Entry
+	if err := json.Unmarshal([]byte(run("history", lib, "--json")), &entries); err != nil {
+		t.Fatalf("history --json: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Command != "organize" || entries[1].Command != "migrate" {
+		t.Fatalf("expected the organize and migrate runs, got %+v", entries)
+	}
+	if e := entries[0]; !e.Succeeded || e.FilesProcessed != 2 || e.Counts["copied"] != 2 || !slices.Contains(e.Args, "--execute=true") {
+		t.Errorf("unexpected organize entry %+v", e)
+	}
+	if entries[1].Journal == "" {
+		t.Errorf("expected the migration journal in the history, got %+v", entries[1])
+	}
+
+	if out := run("history", lib, "--last", "1"); strings.Count(out, "\n") != 1 || !strings.Contains(out, "migrate") {
+		t.Errorf("expected only the last run, got:\n%s", out)
+	}
+	out := run("history", lib, "--run", entries[0].ID[:len(entries[0].ID)-2])
+	for _, want := range []string{"run:         " + entries[0].ID, "command:     organize", "copied:", "status:      ok"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	// With --catalog the runs are recorded in the catalog instead.
+	cat := filepath.Join(t.TempDir(), "catalog.db")
+	run("organize", src, t.TempDir(), "--execute", "--catalog", cat)
+	if out := run("history", "--catalog", cat); strings.Count(out, "\n") != 1 || !strings.Contains(out, "2 files, 2 copied") {
+		t.Errorf("expected the run in the catalog history, got:\n%s", out)
+	}
+}
+
+func TestOrganizeCommand_ExecuteRespectsDestinationLock(t *testing.T) {
 	tmpSrc := t.TempDir()
 	tmpDst := t.TempDir()
 
 	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
 
+	held, err := lock.Acquire(tmpDst, lock.Options{})
+	if err != nil {
+		t.Fatalf("acquire lock: %v", err)
+	}
+	defer held.Release()
+
 	cmd := newRootCmd()
 
 	out := new(bytes.Buffer)
@@ -114,82 +2038,195 @@ func TestOrganizeCommand_Execute(t *testing.T) {
 	cmd.SetErr(out)
 	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute"})
 
+	err = cmd.Execute()
+	if !errors.Is(err, lock.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDst, "2024")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be copied while locked")
+	}
+}
+
+func TestOrganizeCommand_NotifyURL(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+
+	var got notify.Summary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute", "--notify-url", srv.URL})
+
 	if err := cmd.Execute(); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Verify file was copied
-	destPath := filepath.Join(tmpDst, "2024", "01", "02", "IMG_20240102_030405.jpg")
-	if _, err := os.Stat(destPath); err != nil {
-		t.Errorf("file was not copied to expected destination: %v", err)
+	if got.Command != "organize" || !got.Succeeded || got.Counts["copied"] != 1 {
+		t.Fatalf("unexpected summary: %+v", got)
 	}
-
-	output := out.String()
-	if !strings.Contains(output, "copied") {
-		t.Errorf("expected 'copied' in output, got: %s", output)
+	if !strings.Contains(got.Text, "1 copied") {
+		t.Fatalf("unexpected summary text: %q", got.Text)
 	}
 }
 
-func TestOrganizeCommand_JSONOutput(t *testing.T) {
-	tmp := t.TempDir()
+func TestOrganizeCommand_ProgressJSON(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
 
-	writeFile(t, tmp, "IMG_20240102_030405.jpg")
-	writeFileWithMTime(t, tmp, "vacation.jpg", time.Date(2020, 8, 15, 14, 30, 0, 0, time.UTC))
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+	writeFile(t, tmpSrc, "IMG_20240103_030405.jpg")
 
 	cmd := newRootCmd()
 
 	out := new(bytes.Buffer)
+	errOut := new(bytes.Buffer)
 	cmd.SetOut(out)
-	cmd.SetErr(out)
-	dest := filepath.Join(tmp, "dst")
-
-	cmd.SetArgs([]string{"organize", tmp, dest, "--json"})
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"organize", tmpSrc, tmpDst, "--execute", "--progress", "json"})
 
 	if err := cmd.Execute(); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	var operations []jsonOperation
-	if err := json.Unmarshal(out.Bytes(), &operations); err != nil {
-		t.Fatalf("failed to parse JSON: %v", err)
+	stages := make(map[string]progress.Event)
+	for _, line := range strings.Split(strings.TrimSpace(errOut.String()), "\n") {
+		var e progress.Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid progress line %q: %v", line, err)
+		}
+		stages[e.Stage] = e
 	}
 
-	if len(operations) != 2 {
-		t.Fatalf("expected 2 operations, got %d", len(operations))
+	for _, stage := range []string{progress.StageScan, progress.StageAttribute, progress.StageDedupe, progress.StagePlan, progress.StageReconcile, progress.StageCopy} {
+		if _, ok := stages[stage]; !ok {
+			t.Errorf("expected progress event for stage %q", stage)
+		}
 	}
+	if e := stages[progress.StageCopy]; e.Done != 2 || e.Total != 2 || e.Bytes <= 0 {
+		t.Errorf("unexpected final copy event: %+v", e)
+	}
+}
 
-	// Check first operation (filename-based)
-	if !strings.Contains(operations[0].SourcePath, "IMG_20240102_030405.jpg") {
-		t.Errorf("expected source path to contain IMG_20240102_030405.jpg, got %s", operations[0].SourcePath)
+func TestDaemonCommand_OnceWritesJournal(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+	configDir := t.TempDir()
+
+	writeFile(t, tmpSrc, "IMG_20240102_030405.jpg")
+	config := `{"jobs": [{"name": "card", "schedule": "*/15 * * * *", "source": "` + filepath.ToSlash(tmpSrc) +
+		`", "destination": "` + filepath.ToSlash(tmpDst) + `", "flags": {"execute": true, "layout": "{year}/{month}"}}]}`
+	writeFileWithContent(t, configDir, "daemon.json", config)
+
+	cmd := newRootCmd()
+
+	out := new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"daemon", "--config", filepath.Join(configDir, "daemon.json"), "--once"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected no error, got %v\n%s", err, out)
 	}
-	if operations[0].CreatedAt.Filename == "" {
-		t.Errorf("expected created_at.filename to be set")
+	if _, err := os.Stat(filepath.Join(tmpDst, "2024", "01", "IMG_20240102_030405.jpg")); err != nil {
+		t.Errorf("file was not copied: %v", err)
 	}
-	if operations[0].CreatedAt.Filestat == "" {
-		t.Errorf("expected created_at.filestat to be set")
+
+	journals, err := filepath.Glob(filepath.Join(configDir, "journal", "card", "*.json"))
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("expected one journal, got %v (%v)", journals, err)
 	}
-	if operations[0].FileSizeBytes <= 0 {
-		t.Errorf("expected file_size_bytes to be > 0")
+	b, err := os.ReadFile(journals[0])
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(operations[0].DestinationPath, filepath.Join(dest, "2024", "01", "02")) {
-		t.Errorf("expected destination to contain 2024/01/02, got %s", operations[0].DestinationPath)
+	var entry journalEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		t.Fatalf("invalid journal: %v\n%s", err, b)
 	}
+	if entry.Job != "card" || !entry.Summary.Succeeded || !entry.Summary.Execute || len(entry.Decisions) != 1 || entry.Decisions[0].Action != "copied" {
+		t.Errorf("unexpected journal: %s", b)
+	}
+}
 
-	// Check second operation (mtime-based, filename doesn't match pattern)
-	if !strings.Contains(operations[1].SourcePath, "vacation.jpg") {
-		t.Errorf("expected source path to contain vacation.jpg, got %s", operations[1].SourcePath)
+func TestDaemonCommand_InvalidConfig(t *testing.T) {
+	for name, config := range map[string]string{
+		"schedule": `{"jobs": [{"name": "card", "schedule": "every day", "source": "a", "destination": "b"}]}`,
+		"flag":     `{"jobs": [{"name": "card", "schedule": "@daily", "source": "a", "destination": "b", "flags": {"sidecars": "sometimes"}}]}`,
+		"no jobs":  `{"jobs": []}`,
+		"unknown":  `{"jobs": [{"name": "card", "schedule": "@daily", "source": "a", "destination": "b"}], "retries": 3}`,
+	} {
+		configDir := t.TempDir()
+		writeFileWithContent(t, configDir, "daemon.json", config)
+
+		cmd := newRootCmd()
+		out := new(bytes.Buffer)
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs([]string{"daemon", "--config", filepath.Join(configDir, "daemon.json"), "--once"})
+
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
 	}
-	if operations[1].CreatedAt.Filename != "" {
-		t.Errorf("expected created_at.filename to be empty for vacation.jpg")
+}
+
+func TestWatchCommand(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFileWithContent(t, src, "IMG_20240102_030405.jpg", "before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := newRootCmd()
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.SetOut(out)
+	cmd.SetErr(errOut)
+	cmd.SetArgs([]string{"watch", src, dst, "--execute", "--debounce", "50ms"})
+	done := make(chan error, 1)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+
+	waitFor := func(path string) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+		}
+		t.Fatalf("%s did not appear:\n%s", path, errOut)
 	}
-	if operations[1].CreatedAt.Filestat == "" {
-		t.Errorf("expected created_at.filestat to be set")
+	// Files that were there at start are organized first, then the files that arrive.
+	waitFor(filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg"))
+	writeFileWithContent(t, src, "trip/IMG_20240103_030405.jpg", "after")
+	waitFor(filepath.Join(dst, "2024", "01", "03", "IMG_20240103_030405.jpg"))
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watch: %v\n%s", err, errOut)
 	}
-	if operations[1].FileSizeBytes <= 0 {
-		t.Errorf("expected file_size_bytes to be > 0")
+	// The file organized by the first run is not reported again.
+	if n := strings.Count(out.String(), "IMG_20240102_030405.jpg ->"); n != 1 {
+		t.Errorf("expected the first file to be reported once, got %d times:\n%s", n, out)
 	}
-	if !strings.Contains(operations[1].DestinationPath, filepath.Join(dest, "2020", "08", "15")) {
-		t.Errorf("expected destination to contain 2020/08/15, got %s", operations[1].DestinationPath)
+	if !strings.Contains(errOut.String(), "stopped watching") {
+		t.Errorf("expected the shutdown to be logged, got:\n%s", errOut)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetOut(new(bytes.Buffer))
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SetArgs([]string{"watch", "sftp://host/photos", dst})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected a remote source to be refused")
 	}
 }
 
@@ -232,6 +2269,9 @@ func TestScanCommand_JSONOutput(t *testing.T) {
 		} `json:"created_at"`
 		FileSizeBytes int64     `json:"file_size_bytes"`
 		ModTime       time.Time `json:"mod_time"`
+		BestCreatedAt string    `json:"best_created_at"`
+		BestSource    string    `json:"best_source"`
+		Confidence    string    `json:"confidence"`
 	}
 	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
 		t.Fatalf("failed to parse JSON: %v", err)
@@ -251,6 +2291,9 @@ func TestScanCommand_JSONOutput(t *testing.T) {
 	if records[0].CreatedAt.Filestat == "" {
 		t.Fatalf("expected created_at.filestat to be set")
 	}
+	if records[0].BestSource != "mtime" || records[0].BestCreatedAt != records[0].CreatedAt.Filestat || records[0].Confidence != "low" {
+		t.Fatalf("expected the mtime as best with low confidence, got %+v", records[0])
+	}
 }
 
 func TestScanCommand_PrintsMediaFiles(t *testing.T) {
@@ -303,3 +2346,15 @@ func writeFileWithMTime(t *testing.T, dir string, relPath string, mtime time.Tim
 		t.Fatalf("chtimes: %v", err)
 	}
 }
+
+func writeFileWithContent(t *testing.T, dir string, relPath string, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+}
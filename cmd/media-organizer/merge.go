@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+)
+
+func newMergeCmd(opts *options) *cobra.Command {
+	var flags pipelineFlags
+	var jsonOutput bool
+
+	mergeCmd := &cobra.Command{
+		Use:   "merge [libraryA] [libraryB] [output]",
+		Short: "Combine two organized libraries",
+		Long: "Combine two already-organized libraries into one, deduplicating across them and re-planning every file into the standard layout.\n\n" +
+			"With an output directory, both libraries are merged into it. Without one, libraryB is merged into libraryA: " +
+			"files already present anywhere in libraryA (by content) are skipped, the rest are added.",
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			cfg, err := flags.config(cmd)
+			if err != nil {
+				return err
+			}
+			cfg.options = append(cfg.options, organizer.WithLibraryDedupe())
+			if jsonOutput {
+				cfg.options = append(cfg.options, organizer.WithMotionPhotoDetection())
+			}
+			closeCatalog, err := flags.openCatalog(cmd, &cfg)
+			if err != nil {
+				return err
+			}
+			defer closeCatalog()
+			finishProgress := flags.startProgress(cmd, &cfg)
+			defer finishProgress()
+
+			roots := []string{args[0], args[1]}
+			destination := args[0]
+			if len(args) == 3 {
+				destination = args[2]
+			} else {
+				roots = []string{args[1]}
+			}
+
+			started := time.Now()
+			var res organizer.Result
+			if cfg.execute {
+				defer func() {
+					run := summarizeRun("merge", true, started, res, err == nil)
+					summary := notifySummary(run, strings.Join(roots, ", "), destination, res, err)
+					e := historyEntry("merge", commandLine(cmd, args), summary, res)
+					dst := location{name: destination, path: destination}
+					if histErr := historyLog(cfg, dst).Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+						cmd.PrintErrf("warning: history: %v\n", histErr)
+					}
+				}()
+			}
+
+			res, err = organizer.RunSources(cmd.Context(), roots, destination, cfg.organizerOptions()...)
+			printWarnings(cmd, res)
+			printHookErrors(cmd, res)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				return printJSONDecisions(cmd, res)
+			}
+			printDecisions(cmd, opts, res)
+			if opts.verbose {
+				printDuplicateSavings(cmd, res)
+				printCameraStats(cmd, res)
+			}
+			return nil
+		},
+	}
+
+	flags.bind(mergeCmd)
+	mergeCmd.Flags().BoolVar(&jsonOutput, "json", false, "output operations as JSON")
+
+	return mergeCmd
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/history"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// migrationJournal records the moves of an executed migration, so it can be undone.
+type migrationJournal struct {
+	Library   string          `json:"library"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Started   time.Time       `json:"started"`
+	Decisions []jsonOperation `json:"decisions"`
+}
+
+func newMigrateCmd(opts *options) *cobra.Command {
+	var from, to, journalPath, undo, unknownDir, unknownLayout string
+	var execute, jsonOutput bool
+	var lockWait time.Duration
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [library]",
+		Short: "Move an organized library into another layout",
+		Long: "Re-plan an already-organized library from one directory layout into another and move its files in place. " +
+			"Layouts are templates such as {year}/{month} or one of the names daily, monthly and yearly.\n\n" +
+			"Files dated only by their modification time keep the date of the directory the old layout placed them in. " +
+			"Every file is moved, duplicates included; directories left empty are removed, and directories holding a " + scan.IgnoreFile + " file are left alone. An executed migration writes a journal " +
+			"that --undo moves the files back with.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if undo != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if undo != "" {
+				return undoMigration(cmd, opts, undo, execute, lockWait)
+			}
+			// The journal names absolute paths, so it can be undone from anywhere.
+			library, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			if from == "" || to == "" {
+				return fmt.Errorf("--from and --to are required")
+			}
+			fromLayout, err := plan.ParseNamedLayout(from)
+			if err != nil {
+				return err
+			}
+			toLayout, err := plan.ParseNamedLayout(to)
+			if err != nil {
+				return err
+			}
+			layout, err := reconcile.ParseUnknownLayout(unknownLayout)
+			if err != nil {
+				return err
+			}
+
+			started := time.Now()
+			var res organizer.Result
+			var journal string
+			if execute {
+				defer func() {
+					run := summarizeRun("migrate", true, started, res, err == nil)
+					e := historyEntry("migrate", commandLine(cmd, args), notifySummary(run, "", library, res, err), res)
+					e.Journal = journal
+					if histErr := historyLog(pipelineConfig{}, location{name: library, path: library}).Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+						cmd.PrintErrf("warning: history: %v\n", histErr)
+					}
+				}()
+			}
+			runOpts := []organizer.Option{
+				organizer.WithInPlace(),
+				organizer.WithPreviousLayout(fromLayout),
+				organizer.WithLayout(toLayout),
+				organizer.WithoutDedupe(),
+				organizer.WithUnknownDir(unknownDir),
+				organizer.WithUnknownLayout(layout),
+				organizer.WithLockWait(lockWait),
+				organizer.WithExecute(execute),
+			}
+			if jsonOutput {
+				runOpts = append(runOpts, organizer.WithMotionPhotoDetection())
+			}
+			res, err = organizer.Run(cmd.Context(), library, library, runOpts...)
+			if err != nil {
+				return err
+			}
+			if execute {
+				removeEmptyDirs(library, movedSources(res.Decisions))
+				if journalPath == "" {
+					journalPath = filepath.Join(library, ".migrate-"+started.Format("20060102T150405")+".json")
+				}
+				entry := migrationJournal{Library: library, From: fromLayout.String(), To: toLayout.String(), Started: started, Decisions: jsonDecisions(res)}
+				if err := writeJSONFile(journalPath, entry); err != nil {
+					return fmt.Errorf("write journal: %w", err)
+				}
+				journal = journalPath
+				cmd.PrintErrf("wrote journal %s (undo with: media-organizer migrate --undo %s --execute)\n", journalPath, journalPath)
+			}
+
+			if jsonOutput {
+				return printJSONDecisions(cmd, res)
+			}
+			printDecisions(cmd, opts, res)
+			return nil
+		},
+	}
+
+	migrateCmd.Flags().StringVar(&from, "from", "", "current layout of the library: daily, monthly, yearly or a template")
+	migrateCmd.Flags().StringVar(&to, "to", "", "new layout of the library: daily, monthly, yearly or a template")
+	migrateCmd.Flags().BoolVarP(&execute, "execute", "x", false, "move the files (default: dry-run)")
+	migrateCmd.Flags().BoolVar(&jsonOutput, "json", false, "output operations as JSON")
+	migrateCmd.Flags().StringVar(&journalPath, "journal", "", "where an executed migration writes its journal (default: .migrate-<time>.json in the library)")
+	migrateCmd.Flags().StringVar(&undo, "undo", "", "move the files of the migration recorded in this journal back")
+	migrateCmd.Flags().StringVar(&unknownDir, "unknown-dir", reconcile.DefaultUnknownDir, "library-relative directory for files without a known date")
+	migrateCmd.Flags().StringVar(&unknownLayout, "unknown-layout", string(reconcile.UnknownLayoutFlat), "layout inside the unknown directory: flat, mtime-year, mtime-month or extension")
+	migrateCmd.Flags().DurationVar(&lockWait, "lock-wait", 0, "how long to wait for another run holding the library lock (default: exit immediately)")
+
+	return migrateCmd
+}
+
+// undoMigration moves the files of the migration recorded in the journal at path back, last move first.
+func undoMigration(cmd *cobra.Command, opts *options, path string, execute bool, lockWait time.Duration) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var journal migrationJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return fmt.Errorf("read journal %s: %w", path, err)
+	}
+
+	var ops []plan.Operation
+	for i := len(journal.Decisions) - 1; i >= 0; i-- {
+		d := journal.Decisions[i]
+		if d.Action != string(reconcile.ActionCopied) && d.Action != string(reconcile.ActionCopiedRenamed) {
+			continue
+		}
+		moved := d.FinalDestinationPath
+		if moved == "" {
+			moved = d.DestinationPath
+		}
+		op := plan.Operation{SourcePath: moved, DestinationPath: d.SourcePath}
+		for _, sc := range d.Sidecars {
+			if sc.SourcePath != "" && !sc.Generated && !sc.Extracted {
+				op.Sidecars = append(op.Sidecars, plan.Operation{SourcePath: sc.DestinationPath, DestinationPath: sc.SourcePath})
+			}
+		}
+		ops = append(ops, op)
+	}
+
+	if !execute {
+		for _, op := range ops {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", op.SourcePath, op.DestinationPath)
+		}
+		return nil
+	}
+
+	release, err := organizer.AcquireLock(journal.Library, organizer.WithLockWait(lockWait))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	started := time.Now()
+	var moved []string
+	var failedFiles []history.FailedFile
+	defer func() {
+		e := history.Entry{
+			ID:              history.NewID(started),
+			Command:         "migrate",
+			Args:            commandLine(cmd, nil),
+			Destination:     journal.Library,
+			Execute:         true,
+			Started:         started.UTC(),
+			DurationSeconds: time.Since(started).Seconds(),
+			FilesProcessed:  len(ops),
+			Counts:          map[string]int{"moved_back": len(moved)},
+			Failures:        len(failedFiles),
+			FailedFiles:     failedFiles,
+			Succeeded:       err == nil,
+			Journal:         path,
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		log := historyLog(pipelineConfig{}, location{name: journal.Library, path: journal.Library})
+		if histErr := log.Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+			cmd.PrintErrf("warning: history: %v\n", histErr)
+		}
+	}()
+
+	results, err := copy.Execute(cmd.Context(), ops, copy.Options{Move: true, PreserveTimes: true})
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+			failedFiles = append(failedFiles, history.FailedFile{SourcePath: r.Operation.SourcePath, Error: fmt.Sprint(r.Error)})
+			fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", r.Operation.SourcePath, r.Error)
+			continue
+		}
+		moved = append(moved, r.Operation.SourcePath)
+		fmt.Fprintf(cmd.OutOrStdout(), "moved %s -> %s\n", r.Operation.SourcePath, r.Operation.DestinationPath)
+	}
+	removeEmptyDirs(journal.Library, moved)
+	if opts.verbose {
+		cmd.PrintErrf("moved %d of %d files back\n", len(moved), len(ops))
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be moved back", failed)
+	}
+	return nil
+}
+
+// movedSources returns the former paths of the files moved by decisions.
+func movedSources(decisions []reconcile.Decision) []string {
+	var paths []string
+	for _, d := range decisions {
+		if d.Action == reconcile.ActionCopied || d.Action == reconcile.ActionCopiedRenamed {
+			paths = append(paths, d.SourcePath)
+		}
+	}
+	return paths
+}
+
+// removeEmptyDirs removes the directories of paths, and their parents below root, that moves left empty.
+// Directories that still hold anything are kept.
+func removeEmptyDirs(root string, paths []string) {
+	root = filepath.Clean(root)
+	for _, p := range paths {
+		for dir := filepath.Dir(p); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// writeJSONFile writes v to path as indented JSON.
+func writeJSONFile(path string, v any) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o644)
+}
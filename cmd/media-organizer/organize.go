@@ -0,0 +1,1362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/archive"
+	"github.com/quidome/media-organizer-go/pkg/burst"
+	"github.com/quidome/media-organizer-go/pkg/cache"
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/checkpoint"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/edits"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/export"
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/hook"
+	"github.com/quidome/media-organizer-go/pkg/journal"
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+	"github.com/quidome/media-organizer-go/pkg/metrics"
+	"github.com/quidome/media-organizer-go/pkg/motionphoto"
+	"github.com/quidome/media-organizer-go/pkg/notify"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/profile"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/report"
+	"github.com/quidome/media-organizer-go/pkg/review"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
+	"github.com/quidome/media-organizer-go/pkg/track"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+	"github.com/quidome/media-organizer-go/pkg/volume"
+	"github.com/spf13/cobra"
+)
+
+func newOrganizeCmd(opts *options) *cobra.Command {
+	var flags pipelineFlags
+	var jsonOutput bool
+	var metricsFile string
+	var notifyURL string
+	var interactive bool
+	var inPlace bool
+	var move bool
+	var link string
+	var batchSize int
+	var overlap bool
+	var retryFailed string
+	var volumes []string
+	var volumeSplit string
+	var exportPath string
+	var reportPath string
+	var journalPath string
+	var resume bool
+	var planOut string
+	var trashMode, trashDir string
+
+	organizeCmd := &cobra.Command{
+		Use:   "organize [source] [destination]",
+		Short: "Organize media files from source to destination",
+		Long: "Organize media files from a source directory to a destination directory based on their metadata.\n\n" +
+			"Source and destination may also be sftp://[user@]host[:port]/path, webdav[s]://[user@]host[:port]/path or smb://[user@]host[:port]/share/path URLs. " +
+			"The source may also be a camera or phone connected over USB: mtp://[serial-or-port]/storage/path.\n\n" +
+			"With --in-place a single local directory is organized into itself: files are moved instead of copied.\n\n" +
+			"With --volume the destination is left out: the library is spread over the given volumes instead.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(volumes) > 0 {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			if inPlace {
+				return cobra.RangeArgs(1, 2)(cmd, args)
+			}
+			return cobra.ExactArgs(2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			line := commandLine(cmd, args)
+			vols, err := parseVolumes(volumes, volumeSplit)
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(vols) > 0:
+				// The library is planned relative to the first volume and spread from there.
+				args = append(args, vols[0].Path)
+			case len(args) == 1:
+				args = append(args, args[0])
+			}
+			source, destination := args[0], args[1]
+
+			started := time.Now()
+			var res organizer.Result
+			executed := flags.execute
+			defer func() {
+				run := summarizeRun("organize", executed, started, res, err == nil)
+				if metricsFile != "" {
+					if writeErr := metrics.WriteTextfile(metricsFile, run); writeErr != nil && err == nil {
+						err = writeErr
+					}
+				}
+				if notifyURL != "" {
+					summary := notifySummary(run, source, destination, res, err)
+					if postErr := notify.Post(cmd.Context(), nil, notifyURL, summary); postErr != nil {
+						// A failed notification does not fail an otherwise finished run.
+						cmd.PrintErrf("warning: notify: %v\n", postErr)
+					}
+				}
+			}()
+
+			cfg, err := flags.config(cmd)
+			if err != nil {
+				return err
+			}
+			if inPlace {
+				cfg.options = append(cfg.options, organizer.WithInPlace())
+			}
+			if move {
+				cfg.options = append(cfg.options, organizer.WithMove())
+			}
+			linkMode, err := copy.ParseLink(link)
+			if err != nil {
+				return err
+			}
+			if linkMode != copy.LinkNone {
+				cfg.options = append(cfg.options, organizer.WithLink(linkMode))
+			}
+			if overlap {
+				cfg.options = append(cfg.options, organizer.WithOverlap())
+			}
+			if resume {
+				cfg.options = append(cfg.options, organizer.WithResume())
+			}
+			if jsonOutput {
+				// Only the JSON output reports motion photos that are not extracted.
+				cfg.options = append(cfg.options, organizer.WithMotionPhotoDetection())
+			}
+			batched := batchSize > 0 || overlap
+			if planOut != "" && (executed || interactive || batched || retryFailed != "" || len(vols) > 0 || flags.archive != "" || linkMode != copy.LinkNone) {
+				return fmt.Errorf("--plan-out plans a dry run; it cannot be combined with --execute, --tui, --batch-size, --overlap, --retry-failed, --volume, --archive or --link")
+			}
+			if len(vols) > 0 {
+				if inPlace || batched || retryFailed != "" || interactive {
+					return fmt.Errorf("--volume cannot be combined with --in-place, --batch-size, --overlap, --retry-failed or --tui")
+				}
+				split, _ := volume.ParseSplit(volumeSplit)
+				cfg.options = append(cfg.options, organizer.WithVolumes(split, vols...))
+			}
+
+			src, err := openLocation(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer src.close()
+			source = src.name
+			dst, err := openLocation(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+			defer dst.close()
+			destination = dst.name
+			cfg.options = append(cfg.options, locationOptions(src, dst)...)
+			bin, err := openTrash(trashMode, trashDir, dst, started)
+			if err != nil {
+				return err
+			}
+			if bin != nil {
+				cfg.options = append(cfg.options, organizer.WithTrash(bin))
+			}
+			closeCatalog, err := flags.openCatalog(cmd, &cfg)
+			if err != nil {
+				return err
+			}
+			defer closeCatalog()
+			var journalName string
+			if executed {
+				// Deferred after opening the destination and catalog, so it runs before they close.
+				defer func() {
+					run := summarizeRun("organize", executed, started, res, err == nil)
+					e := historyEntry("organize", line, notifySummary(run, source, destination, res, err), res)
+					e.Journal = journalName
+					if histErr := historyLog(cfg, dst).Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+						cmd.PrintErrf("warning: history: %v\n", histErr)
+					}
+				}()
+			}
+
+			if (executed || interactive) && flags.archive == "" {
+				closeJournal, err := openJournal(cmd, opts, &cfg, dst, journalPath, started)
+				if err != nil {
+					return err
+				}
+				defer func() { journalName = closeJournal() }()
+			}
+
+			if batchSize < 0 {
+				return fmt.Errorf("--batch-size must not be negative")
+			}
+			var exporter export.Writer
+			if exportPath != "" {
+				if exporter, err = createExport(cmd.Context(), exportPath); err != nil {
+					return err
+				}
+				defer func() {
+					if closeErr := exporter.Close(); closeErr != nil && err == nil {
+						err = closeErr
+					}
+				}()
+			}
+			writeExport := func(res organizer.Result) error {
+				if exporter == nil {
+					return nil
+				}
+				return exporter.Write(cmd.Context(), exportRows(res))
+			}
+			writeReport := func(res organizer.Result) error {
+				if reportPath == "" {
+					return nil
+				}
+				sourceFS := destfs.OrOS(src.fsys)
+				err := report.Write(cmd.Context(), reportPath, res, report.Options{
+					Title: fmt.Sprintf("media-organizer %s -> %s", src.name, dst.name),
+					Open:  func(path string) (io.ReadCloser, error) { return sourceFS.Open(path) },
+				})
+				if err == nil && opts.verbose {
+					cmd.PrintErrf("wrote report %s\n", reportPath)
+				}
+				return err
+			}
+
+			if !interactive {
+				finishProgress := flags.startProgress(cmd, &cfg)
+				defer finishProgress()
+			}
+			if interactive {
+				if jsonOutput || cfg.progress != nil {
+					return fmt.Errorf("--tui cannot be combined with --json or --progress")
+				}
+				if batched || retryFailed != "" {
+					return fmt.Errorf("--tui cannot be combined with --batch-size, --overlap or --retry-failed")
+				}
+				res, executed, err = runTUI(cmd, src, dst, cfg)
+				if err != nil {
+					return err
+				}
+				printWarnings(cmd, res)
+				printDecisions(cmd, opts, res)
+				if err := writeReport(res); err != nil {
+					return err
+				}
+				return writeExport(res)
+			}
+
+			if retryFailed != "" {
+				if batched {
+					return fmt.Errorf("--retry-failed cannot be combined with --batch-size or --overlap")
+				}
+				res, err = runRetry(cmd, retryFailed, src, dst, cfg, inPlace)
+				printWarnings(cmd, res)
+				printHookErrors(cmd, res)
+				if err != nil {
+					return err
+				}
+				if err := writeReport(res); err != nil {
+					return err
+				}
+				if err := writeExport(res); err != nil {
+					return err
+				}
+				if jsonOutput {
+					return printJSONDecisions(cmd, res)
+				}
+				printDecisions(cmd, opts, res)
+				return nil
+			}
+
+			if batched {
+				if reportPath != "" {
+					return fmt.Errorf("--report needs the decisions of the whole run; it cannot be combined with --batch-size or --overlap")
+				}
+				res, err = runBatches(cmd, opts, src.path, dst.path, cfg, batchSize, jsonOutput, exporter)
+				printWarnings(cmd, res)
+				printHookErrors(cmd, res)
+				if err != nil {
+					return err
+				}
+				if opts.verbose && res.RunID != "" {
+					cmd.PrintErrf("recorded run %s in %s\n", res.RunID, flags.catalog)
+				}
+				if opts.verbose && !jsonOutput {
+					printDuplicateSavings(cmd, res)
+				}
+				return nil
+			}
+
+			res, err = organizer.Run(cmd.Context(), src.path, dst.path, cfg.organizerOptions()...)
+			printWarnings(cmd, res)
+			printHookErrors(cmd, res)
+			if err != nil {
+				return err
+			}
+			if opts.verbose && res.RunID != "" {
+				cmd.PrintErrf("recorded run %s in %s\n", res.RunID, flags.catalog)
+			}
+			if opts.verbose {
+				printPlaceStats(cmd, res)
+				printCameraStats(cmd, res)
+				printDeviceStats(cmd, res)
+			}
+			if opts.verbose && len(res.DatesWritten) > 0 {
+				cmd.PrintErrf("wrote DateTimeOriginal into %d copies\n", len(res.DatesWritten))
+			}
+			printVolumes(cmd, res)
+			if planOut != "" {
+				if err := writePlanFile(cmd.Context(), planOut, res, src, dst); err != nil {
+					return err
+				}
+				if opts.verbose {
+					cmd.PrintErrf("wrote plan %s (execute with: media-organizer apply %s --execute)\n", planOut, planOut)
+				}
+			}
+			if err := writeReport(res); err != nil {
+				return err
+			}
+			if err := writeExport(res); err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				return printJSONDecisions(cmd, res)
+			}
+			printDecisions(cmd, opts, res)
+			if opts.verbose {
+				printDuplicateSavings(cmd, res)
+			}
+			return nil
+		},
+	}
+
+	flags.bind(organizeCmd)
+	organizeCmd.Flags().BoolVar(&jsonOutput, "json", false, "output operations as JSON")
+	organizeCmd.Flags().StringVar(&metricsFile, "metrics-file", "", "write Prometheus textfile-collector metrics to this path at the end of the run")
+	organizeCmd.Flags().BoolVar(&interactive, "tui", false, "plan interactively and confirm before copying (ignores --execute)")
+	organizeCmd.Flags().BoolVar(&move, "move", false, "move the files into the destination instead of copying them, verifying copies across devices before removing the source")
+	organizeCmd.Flags().StringVar(&link, "link", "", "build the destination with links to the sources instead of copies: hard (same filesystem, no extra space) or sym (symbolic links to the absolute source paths); rewritten files, such as with --write-exif, are copied")
+	organizeCmd.Flags().BoolVar(&inPlace, "in-place", false, "organize a local directory into itself, moving files instead of copying them (destination may be omitted)")
+	organizeCmd.Flags().StringVar(&trashMode, "trash", "", "with --move or --in-place, put the sources the run removes after copying them into a trash instead of deleting them: os (the trash of the desktop) or destination (<destination>/<trash-dir>/<time>)")
+	organizeCmd.Flags().StringVar(&trashDir, "trash-dir", trash.DirName, "directory below the destination that --trash destination puts the removed files in, in a directory per run")
+	organizeCmd.Flags().IntVar(&batchSize, "batch-size", 0, "plan and copy the files in batches of about this many, printing each batch when it is done, to bound the memory of very large sources (default: all at once)")
+	organizeCmd.Flags().BoolVar(&overlap, "overlap", false, fmt.Sprintf("scan, date, plan and copy batches as a pipeline, each step working on its own batch, so reading metadata and copying overlap (default batch size: %d)", organizer.DefaultOverlapBatchSize))
+	organizeCmd.Flags().StringVar(&retryFailed, "retry-failed", "", "copy again only the files that failed in the --json report (array or NDJSON) of an earlier run of the same source and destination, to the destinations it resolved")
+	organizeCmd.Flags().StringArrayVar(&volumes, "volume", nil, "spread the library over volumes instead of a destination, as PATH=SIZE with SIZE the most to copy to the volume, e.g. /mnt/disk1=2TB; whole folders fill the volumes in order (repeatable)")
+	organizeCmd.Flags().StringVar(&volumeSplit, "volume-split", string(volume.SplitYear), "folders kept whole on one volume with --volume: year (the top-level folders of the layout) or month (the folders below them)")
+	organizeCmd.Flags().StringVar(&exportPath, "export", "", "also write the files and decisions of the run to a new SQLite database (.db, .sqlite) or Parquet file (.parquet) for analysis")
+	organizeCmd.Flags().StringVar(&reportPath, "report", "", "also write an HTML report of the operations, grouped by date and by action with thumbnails of the photos, to review a plan in a browser (thumbnails go into <report>_files)")
+	organizeCmd.Flags().StringVar(&journalPath, "journal", "", "where an executed run writes the journal of the files it copied, for undo (default: .organize-<time>.jsonl in the destination)")
+	organizeCmd.Flags().BoolVar(&resume, "resume", false, "skip the files an interrupted --execute run recorded as copied in its checkpoint ("+checkpoint.FileName+" in the destination), without reading them again")
+	organizeCmd.Flags().StringVar(&planOut, "plan-out", "", "also write the complete plan of a dry run to this JSON file, to review or edit it and execute it later with apply")
+	organizeCmd.Flags().StringVar(&notifyURL, "notify-url", "", "POST a JSON run summary to this URL when the run completes")
+
+	return organizeCmd
+}
+
+// openTrash returns the trash named by the --trash value mode for a run started at started that writes
+// to dst, or nil for none. The trash in the destination, in its directory dir (--trash-dir), needs a
+// local destination.
+func openTrash(mode, dir string, dst location, started time.Time) (trash.Trash, error) {
+	bin, err := trash.Parse(mode, dst.path, dir, started)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := bin.(trash.Dir); ok && dst.fsys != nil {
+		return nil, fmt.Errorf("--trash destination needs a local destination")
+	}
+	return bin, nil
+}
+
+// openJournal creates the journal of an executing run, at path or else in the destination root, and
+// adds it to cfg. The returned function closes it and returns its name: a journal the run wrote nothing
+// to is removed again, and its name is empty.
+func openJournal(cmd *cobra.Command, opts *options, cfg *pipelineConfig, dst location, path string, started time.Time) (func() string, error) {
+	fsys := dst.fsys
+	if path == "" {
+		path = filepath.Join(dst.path, journal.FileName(started))
+	} else {
+		fsys = nil
+	}
+	w, err := journal.Create(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	cfg.options = append(cfg.options, organizer.WithJournal(w))
+	return func() string {
+		if err := w.Close(); err != nil {
+			cmd.PrintErrf("warning: journal: %v\n", err)
+		}
+		if w.Len() == 0 {
+			destfs.OrOS(fsys).Remove(path)
+			return ""
+		}
+		name := path
+		if fsys != nil {
+			name = strings.TrimSuffix(dst.name, "/") + "/" + filepath.Base(path)
+		}
+		if opts.verbose {
+			cmd.PrintErrf("wrote journal %s (undo with: media-organizer undo %s --execute)\n", name, name)
+		}
+		return name
+	}, nil
+}
+
+// progressInterval is the minimum time between two progress events of the same stage.
+const progressInterval = 250 * time.Millisecond
+
+// pipelineFlags binds the pipeline settings shared by organize and merge.
+type pipelineFlags struct {
+	execute         bool
+	sidecarPolicy   string
+	motionPhotos    string
+	convertHEIC     string
+	edits           string
+	bursts          string
+	layout          string
+	routes          []string
+	lightroom       string
+	places          string
+	tracks          []string
+	trackOffset     time.Duration
+	trackMaxGap     time.Duration
+	cameras         []string
+	timezones       []string
+	assumeTimezone  string
+	gpsTimezone     bool
+	strictDates     bool
+	reviewBelow     string
+	reviewDir       string
+	noDateCheck     bool
+	earliestDate    string
+	maxDateDiff     int
+	profile         string
+	catalog         string
+	cache           string
+	writeEXIF       bool
+	fileTimes       bool
+	noPreserveTimes bool
+	archive         string
+	archivePeriod   string
+	manifest        string
+	hooks           []string
+	unknownDir      string
+	unknownLayout   string
+	maxPathLength   int
+	maxPathDepth    int
+	shortenPaths    bool
+	noDedupe        bool
+	payloadDedupe   bool
+	similarVideos   bool
+	nearDuplicates  bool
+	dedupeScope     string
+	hashLists       []string
+	hashAlgorithm   string
+	failFast        bool
+	verify          bool
+	allowIncomplete bool
+	lockWait        time.Duration
+	progressMode    string
+}
+
+func (f *pipelineFlags) bind(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&f.execute, "execute", "x", false, "execute copy operations (default: dry-run)")
+	cmd.Flags().StringVar(&f.sidecarPolicy, "sidecars", string(sidecar.PolicyCopy), "sidecar handling: copy, skip or require")
+	cmd.Flags().StringVar(&f.motionPhotos, "motion-photos", string(motionphoto.PolicyKeep), "motion photos (JPEGs with an embedded video): keep, or extract the video next to the photo as a companion .mp4")
+	cmd.Flags().StringVar(&f.convertHEIC, "convert-heic", string(heic.PolicyOff), "convert HEIC photos to JPEG with heif-convert, magick or sips: off, keep (also write a JPEG next to the photo) or replace (write the JPEG instead of the photo)")
+	cmd.Flags().StringVar(&f.edits, "edits", string(edits.PreferBoth), "edited copies (IMG_1234~2.jpg, IMG_1234-edited.jpg) are placed next to their original; organize both, or prefer the original or the edit")
+	cmd.Flags().StringVar(&f.bursts, "bursts", string(burst.PolicyOff), "burst sequences: off, group (keep the shots of a burst together in one directory, {burst} names it) or best (also skip all but the best shot)")
+	cmd.Flags().StringVar(&f.layout, "layout", plan.DefaultLayout, "directory layout of dated files, using {year}, {month}, {day}, {album}, {favorite}, {rating}, {keyword}, {screenshot}, {resolution}, {duration}, {codec}, {burst}, {place}, {country}, {city}, {camera} and {device}")
+	cmd.Flags().StringArrayVar(&f.routes, "route", nil, "put dated files matching a condition in their own layout, as CONDITION:LAYOUT, e.g. rating>=4:Best/{year}, screenshot:Screenshots/{year} or duration<3s:Clips/{year}; the first matching route wins (repeatable)")
+	cmd.Flags().StringVar(&f.profile, "profile", "none", "export profile for bulk import by a photo server: none, immich or photoprism (sets the default layout and XMP sidecars)")
+	cmd.Flags().StringVar(&f.catalog, "catalog", "", "record imported files (hash, created_at, source, destination, run ID) in this SQLite catalog, e.g. <destination>/"+catalog.DefaultFileName)
+	cmd.Flags().StringVar(&f.cache, "cache", "", "keep the hashes and metadata dates of local files in this SQLite cache, so repeat runs do not read unchanged files again, e.g. ~/.cache/"+cache.DefaultFileName)
+	cmd.Flags().StringVar(&f.manifest, "manifest", "none", "keep SHA-256 manifests ("+manifest.FileName+") of the copied files: none, directory (one per directory) or library (one in the destination root)")
+	cmd.Flags().BoolVar(&f.writeEXIF, "write-exif", false, "write the created_at into the EXIF DateTimeOriginal of copied JPEGs that lack it (sources are not modified)")
+	cmd.Flags().BoolVar(&f.fileTimes, "set-file-times", false, "set the modification time, and the creation time on Windows and macOS, of copied files to their created_at")
+	cmd.Flags().BoolVar(&f.noPreserveTimes, "no-preserve-times", false, "give copied files the time they were written instead of the access and modification time of their source")
+	cmd.Flags().StringVar(&f.archive, "archive", "", "write the copies into one archive per period in the destination root instead of loose files: tar or zip (e.g. 2024.tar)")
+	cmd.Flags().StringVar(&f.archivePeriod, "archive-period", string(archive.PeriodYear), "period of each archive with --archive: year or month")
+	cmd.Flags().StringVar(&f.lightroom, "lightroom-catalog", "", "read capture dates, ratings and collections from this Lightroom catalog (.lrcat)")
+	cmd.Flags().StringVar(&f.places, "places", "", "resolve GPS positions with this GeoNames cities file (e.g. cities15000.txt) instead of the bundled places; also adds place to --json output")
+	cmd.Flags().StringArrayVar(&f.tracks, "track", nil, "correlate the files with this GPS track (.gpx, .geojson): place files without a GPS position at its position at their date, and verify the date of files with one (repeatable)")
+	cmd.Flags().DurationVar(&f.trackOffset, "track-offset", 0, "how far the clock of the cameras without GPS was ahead of --track, e.g. 1h; their dates are corrected for it")
+	cmd.Flags().DurationVar(&f.trackMaxGap, "track-max-gap", track.DefaultMaxGap, "how far from the nearest --track position a date may be to be placed on the track")
+	cmd.Flags().StringArrayVar(&f.cameras, "camera", nil, "only organize files taken with this camera, by name (e.g. \"Canon EOS R5\") or model (repeatable)")
+	cmd.Flags().StringArrayVar(&f.timezones, "timezone", nil, "read dates without a timezone (EXIF, filenames) of the files in a source directory in another timezone, as DIR=ZONE with DIR relative to the source and an IANA ZONE, e.g. camera=Asia/Tokyo (repeatable)")
+	cmd.Flags().StringVar(&f.assumeTimezone, "assume-timezone", "", "read dates without a timezone (EXIF dates recorded without an offset or GPS time, filenames) outside the --timezone directories in this IANA zone instead of the local timezone, e.g. America/New_York")
+	cmd.Flags().BoolVar(&f.gpsTimezone, "gps-timezone", false, "read the dates of files with an EXIF GPS position in the timezone of that position, the local time where they were taken, instead of --timezone, --assume-timezone or the local timezone; the timezone is that of the nearest of the bundled places, or --places, so near a border between zones it can be the neighbour's")
+	cmd.Flags().BoolVar(&f.strictDates, "strict-dates", false, "never date a file by its modification time, which copies commonly reset: files without a metadata or filename date go to --unknown-dir for review")
+	cmd.Flags().StringVar(&f.reviewBelow, "review-below", "", "plan dated files whose date confidence is below this (low, medium or high) into --review-dir, with a .review.json note listing their date candidates, instead of the directory of their date")
+	cmd.Flags().StringVar(&f.reviewDir, "review-dir", reconcile.DefaultReviewDir, "destination-relative directory for files with an uncertain (--review-below) or implausible date")
+	cmd.Flags().BoolVar(&f.noDateCheck, "no-date-check", false, "keep files with an implausible date (before --earliest-date, in the future, or further than --max-date-disagreement from their filename date) under that date instead of planning them into --review-dir")
+	cmd.Flags().StringVar(&f.earliestDate, "earliest-date", createdat.DefaultEarliest.Format("2006-01-02"), "earliest plausible date; files dated before it, such as by a camera clock reset to its factory date, go to --review-dir (empty: no lower bound)")
+	cmd.Flags().IntVar(&f.maxDateDiff, "max-date-disagreement", int(createdat.DefaultMaxDisagreement/(24*time.Hour)), "how many days the metadata and filename dates of a file may be apart before it goes to --review-dir (0: not compared)")
+	cmd.Flags().StringArrayVar(&f.hooks, "hook", nil, "run an executable with a JSON document on stdin, as POINT=COMMAND with POINT after-attribute, after-copy or after-run (repeatable)")
+	cmd.Flags().StringVar(&f.unknownDir, "unknown-dir", reconcile.DefaultUnknownDir, "destination-relative directory for files without a known date")
+	cmd.Flags().StringVar(&f.unknownLayout, "unknown-layout", string(reconcile.UnknownLayoutFlat), "layout inside the unknown directory: flat, mtime-year, mtime-month or extension")
+	cmd.Flags().IntVar(&f.maxPathLength, "max-path-length", 0, "warn about destination paths longer than this many characters, relative to the destination (default: no limit)")
+	cmd.Flags().IntVar(&f.maxPathDepth, "max-path-depth", 0, "warn about destination paths with more directories than this (default: no limit)")
+	cmd.Flags().BoolVar(&f.shortenPaths, "shorten-paths", false, "shorten destination paths exceeding --max-path-length or --max-path-depth instead of warning: join the deepest directories and cut the longest names")
+	cmd.Flags().BoolVar(&f.noDedupe, "no-dedupe", false, "keep every source even if it is identical to another source")
+	cmd.Flags().BoolVar(&f.payloadDedupe, "dedupe-payload", false, "also treat JPEGs with identical image data as duplicates, ignoring their metadata (EXIF, XMP), and keep the largest")
+	cmd.Flags().BoolVar(&f.similarVideos, "similar-videos", false, "flag videos that look like a re-encoded copy of a larger video (same duration and, with ffmpeg in PATH, similar frames); they are still organized")
+	cmd.Flags().BoolVar(&f.nearDuplicates, "near-duplicates", false, "flag JPEG, PNG and GIF photos that look like a copy of a larger photo at another resolution or compression (perceptual hash); they are still organized")
+	cmd.Flags().StringVar(&f.dedupeScope, "dedupe-scope", string(reconcile.DedupeScopeRun), "source dedupe scope: run or directory")
+	cmd.Flags().StringArrayVar(&f.hashLists, "hash-list", nil, "trust the hashes of an rmlint (-o json), jdupes or hashdeep list when comparing the files it lists for duplicates, instead of reading them again (repeatable)")
+	cmd.Flags().StringVar(&f.hashAlgorithm, "hash", "", "compare files for duplicates by this content hash instead of byte for byte, reading every file once: sha256 (shares digests with sha256 --hash-list files), blake3 or xxhash128 (fastest, not collision-resistant)")
+	cmd.Flags().BoolVar(&f.verify, "verify", false, "read every copied file back from the destination and compare its SHA-256 with the source; a copy that differs is removed and fails with E_VERIFY_FAILED")
+	cmd.Flags().BoolVar(&f.allowIncomplete, "allow-incomplete", false, "organize empty files and truncated JPEGs instead of reporting them as failed")
+	cmd.Flags().BoolVar(&f.failFast, "fail-fast", false, "abort the run on the first file that cannot be read instead of reporting it as failed")
+	cmd.Flags().StringVar(&f.progressMode, "progress", string(progress.ModeAuto), "progress output on stderr: auto (a progress bar when stdout is a terminal), bar, json (NDJSON events) or none")
+	cmd.Flags().DurationVar(&f.lockWait, "lock-wait", 0, "how long to wait for another run holding the destination lock (default: exit immediately)")
+}
+
+func (f *pipelineFlags) config(cmd *cobra.Command) (pipelineConfig, error) {
+	policy, err := sidecar.ParsePolicy(f.sidecarPolicy)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	motionPolicy, err := motionphoto.ParsePolicy(f.motionPhotos)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	heicPolicy, err := heic.ParsePolicy(f.convertHEIC)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	editPreference, err := edits.ParsePreference(f.edits)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	burstPolicy, err := burst.ParsePolicy(f.bursts)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	exportProfile, err := profile.Parse(f.profile)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	layout, err := plan.ParseLayout(f.layout)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	if exportProfile != profile.None && !cmd.Flags().Changed("layout") {
+		layout = exportProfile.Layout()
+	}
+	unknownLayout, err := reconcile.ParseUnknownLayout(f.unknownLayout)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	scope, err := reconcile.ParseDedupeScope(f.dedupeScope)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	manifestMode, err := manifest.ParseMode(f.manifest)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	mode, err := progress.ParseMode(f.progressMode)
+	if err != nil {
+		return pipelineConfig{}, err
+	}
+	limits := plan.PathLimits{MaxLength: f.maxPathLength, MaxDepth: f.maxPathDepth, Shorten: f.shortenPaths}
+	if limits.MaxLength < 0 || limits.MaxDepth < 0 {
+		return pipelineConfig{}, fmt.Errorf("--max-path-length and --max-path-depth must not be negative")
+	}
+	if limits.Shorten && limits.IsZero() {
+		return pipelineConfig{}, fmt.Errorf("--shorten-paths needs --max-path-length or --max-path-depth")
+	}
+
+	// ModeAuto is left to startProgress: only organize and merge draw a bar on their own.
+	var reporter progress.Reporter
+	switch mode {
+	case progress.ModeJSON:
+		reporter = progress.NewJSONReporter(cmd.ErrOrStderr(), progressInterval)
+	case progress.ModeBar:
+		reporter = progress.NewBarReporter(cmd.ErrOrStderr(), progressInterval)
+	}
+
+	opts := []organizer.Option{
+		organizer.WithSidecarPolicy(policy),
+		organizer.WithMotionPhotos(motionPolicy),
+		organizer.WithHEICConversion(heicPolicy),
+		organizer.WithEdits(editPreference),
+		organizer.WithBursts(burstPolicy),
+		organizer.WithDedupeScope(scope),
+		organizer.WithUnknownDir(f.unknownDir),
+		organizer.WithLayout(layout),
+		organizer.WithProfile(exportProfile),
+		organizer.WithUnknownLayout(unknownLayout),
+		organizer.WithPathLimits(limits),
+		organizer.WithLockWait(f.lockWait),
+		organizer.WithManifest(manifestMode),
+		organizer.WithCameras(f.cameras...),
+		organizer.WithRatings(),
+		organizer.WithKeywords(),
+		organizer.WithScreenshots(),
+		organizer.WithVideoInfo(),
+	}
+	for _, value := range f.routes {
+		route, err := plan.ParseRoute(value)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithRoutes(route))
+	}
+	if f.lightroom != "" {
+		opts = append(opts, organizer.WithLightroomCatalog(f.lightroom))
+	}
+	if f.writeEXIF {
+		opts = append(opts, organizer.WithWriteEXIF())
+	}
+	if f.fileTimes {
+		opts = append(opts, organizer.WithFileTimes())
+	}
+	if f.noPreserveTimes {
+		opts = append(opts, organizer.WithoutPreservedTimes())
+	}
+	if f.archive != "" {
+		format, err := archive.ParseFormat(f.archive)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		period, err := archive.ParsePeriod(f.archivePeriod)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithArchive(format, period))
+	}
+	if f.places != "" {
+		geocoder, err := loadPlaces(f.places)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithGeocoder(geocoder))
+	}
+	if len(f.tracks) > 0 {
+		t, err := track.Load(f.tracks...)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		t.MaxGap = f.trackMaxGap
+		opts = append(opts, organizer.WithTrack(t), organizer.WithTrackOffset(f.trackOffset))
+	}
+	if f.assumeTimezone != "" {
+		loc, err := time.LoadLocation(f.assumeTimezone)
+		if err != nil {
+			return pipelineConfig{}, fmt.Errorf("invalid --assume-timezone: %w", err)
+		}
+		opts = append(opts, organizer.WithAssumedTimezone(loc))
+	}
+	if f.gpsTimezone {
+		opts = append(opts, organizer.WithGPSTimezone())
+	}
+	for _, value := range f.timezones {
+		dir, loc, err := parseTimezone(value)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithTimezone(dir, loc))
+	}
+	if f.strictDates {
+		opts = append(opts, organizer.WithStrictDates())
+	}
+	if f.reviewBelow != "" {
+		threshold, err := createdat.ParseConfidence(f.reviewBelow)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithReview(threshold))
+	}
+	if !f.noDateCheck {
+		sanity, err := f.dateCheck(time.Now())
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithDateCheck(sanity))
+	}
+	opts = append(opts, organizer.WithReviewDir(f.reviewDir))
+	for _, value := range f.hooks {
+		h, err := hook.Parse(value)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithHooks(h))
+	}
+	if f.noDedupe {
+		opts = append(opts, organizer.WithoutDedupe())
+	}
+	if f.payloadDedupe {
+		opts = append(opts, organizer.WithPayloadDedupe())
+	}
+	if f.similarVideos {
+		opts = append(opts, organizer.WithSimilarVideos())
+	}
+	if f.nearDuplicates {
+		opts = append(opts, organizer.WithNearDuplicates())
+	}
+	if len(f.hashLists) > 0 {
+		list := make(hashlist.List)
+		for _, path := range f.hashLists {
+			entries, err := hashlist.Load(path)
+			if err != nil {
+				return pipelineConfig{}, err
+			}
+			list.Add(entries...)
+		}
+		opts = append(opts, organizer.WithHashes(list))
+	}
+	if f.hashAlgorithm != "" {
+		algorithm, err := reconcile.ParseHashAlgorithm(f.hashAlgorithm)
+		if err != nil {
+			return pipelineConfig{}, err
+		}
+		opts = append(opts, organizer.WithHashAlgorithm(algorithm))
+	}
+	if f.failFast {
+		opts = append(opts, organizer.WithFailFast())
+	}
+	if f.verify {
+		opts = append(opts, organizer.WithVerify())
+	}
+	if f.allowIncomplete {
+		opts = append(opts, organizer.WithAllowIncomplete())
+	}
+
+	return pipelineConfig{execute: f.execute, progress: reporter, options: opts}, nil
+}
+
+// parseTimezone parses a --timezone value, DIR=ZONE.
+// dateCheck returns the bounds of --earliest-date and --max-date-disagreement for a run at now.
+func (f *pipelineFlags) dateCheck(now time.Time) (createdat.Sanity, error) {
+	if f.maxDateDiff < 0 {
+		return createdat.Sanity{}, fmt.Errorf("--max-date-disagreement must not be negative")
+	}
+	sanity := createdat.DefaultSanity(now)
+	sanity.Earliest = time.Time{}
+	if f.earliestDate != "" {
+		earliest, err := review.ParseDate(f.earliestDate, time.Local)
+		if err != nil {
+			return createdat.Sanity{}, fmt.Errorf("--earliest-date: %w", err)
+		}
+		sanity.Earliest = earliest
+	}
+	sanity.MaxDisagreement = time.Duration(f.maxDateDiff) * 24 * time.Hour
+	return sanity, nil
+}
+
+func parseTimezone(value string) (string, *time.Location, error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return "", nil, fmt.Errorf("invalid timezone %q (want DIR=ZONE, e.g. camera=Asia/Tokyo)", value)
+	}
+	loc, err := time.LoadLocation(value[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid timezone %q: %w", value, err)
+	}
+	return value[:i], loc, nil
+}
+
+// loadPlaces reads the GeoNames cities file at path.
+func loadPlaces(path string) (*geocode.Offline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := geocode.LoadGeoNames(f)
+	if err != nil {
+		return nil, fmt.Errorf("load places %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// startProgress adds a progress bar to cfg with --progress auto, when stdout and stderr are
+// terminals. The returned function ends the line of a bar left unfinished.
+func (f *pipelineFlags) startProgress(cmd *cobra.Command, cfg *pipelineConfig) func() {
+	_, stdout := terminalWidth(cmd.OutOrStdout())
+	if mode, _ := progress.ParseMode(f.progressMode); mode == progress.ModeAuto && stdout {
+		if _, stderr := terminalWidth(cmd.ErrOrStderr()); stderr {
+			cfg.progress = progress.NewBarReporter(cmd.ErrOrStderr(), progressInterval)
+		}
+	}
+	bar, ok := cfg.progress.(*progress.BarReporter)
+	if !ok {
+		return func() {}
+	}
+	if width, _ := terminalWidth(cmd.ErrOrStderr()); width > 0 {
+		bar.Width = width
+	}
+	return bar.Finish
+}
+
+// openCatalog opens the catalog given with --catalog and the cache given with --cache and adds them
+// to cfg. The returned function closes them.
+func (f *pipelineFlags) openCatalog(cmd *cobra.Command, cfg *pipelineConfig) (func(), error) {
+	var closers []func() error
+	closeAll := func() {
+		for _, fn := range closers {
+			fn()
+		}
+	}
+	if f.catalog != "" {
+		c, err := catalog.Open(cmd.Context(), f.catalog)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, c.Close)
+		cfg.catalog = c
+		cfg.options = append(cfg.options, organizer.WithCatalog(c))
+	}
+	if f.cache != "" {
+		c, err := cache.Open(cmd.Context(), f.cache)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, c.Close)
+		cfg.options = append(cfg.options, organizer.WithCache(c))
+	}
+	return closeAll, nil
+}
+
+// printDecisions writes the human-readable decision lines of res.
+func printDecisions(cmd *cobra.Command, opts *options, res organizer.Result) {
+	successCount := printDecisionLines(cmd, res)
+	if opts.verbose {
+		cmd.PrintErrf("processed %d of %d files\n", successCount, len(res.Decisions))
+	}
+}
+
+// printDecisionLines prints a line per decision of res and returns the number of files processed
+// successfully.
+func printDecisionLines(cmd *cobra.Command, res organizer.Result) int {
+	decisions := res.Decisions
+	copied := "copied"
+	switch {
+	case res.InPlace || res.Moved:
+		copied = "moved"
+	case res.Linked != copy.LinkNone:
+		copied = "linked"
+	}
+	successCount := 0
+	for _, d := range decisions {
+		switch d.Action {
+		case reconcile.ActionCopied, reconcile.ActionCopiedRenamed:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s -> %s\n", copied, d.SourcePath, d.FinalDestinationPath)
+			printSidecars(cmd, d.Sidecars)
+		case reconcile.ActionCopy, reconcile.ActionCopyRenamed:
+			fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", d.SourcePath, d.FinalDestinationPath)
+			printSidecars(cmd, d.Sidecars)
+		case reconcile.ActionSkippedIdentical:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "skipped %s -> %s (identical)\n", d.SourcePath, d.FinalDestinationPath)
+		case reconcile.ActionSkippedDuplicateSrc:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "skipped %s (duplicate of %s)\n", d.SourcePath, d.DuplicateOf)
+		case reconcile.ActionSkippedImported:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "skipped %s (imported before as %s)\n", d.SourcePath, d.FinalDestinationPath)
+		case reconcile.ActionSkippedVersion:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "skipped %s (other version of %s)\n", d.SourcePath, d.DuplicateOf)
+		case reconcile.ActionSkippedBurst:
+			successCount++
+			fmt.Fprintf(cmd.OutOrStdout(), "skipped %s (burst shot, best is %s)\n", d.SourcePath, d.DuplicateOf)
+		case reconcile.ActionFailed:
+			fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", d.SourcePath, d.Error)
+		default:
+			fmt.Fprintf(cmd.OutOrStderr(), "failed %s: unknown action\n", d.SourcePath)
+		}
+		if original := res.SimilarTo[d.SourcePath]; original != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "  ~ similar to %s (re-encoded copy?)\n", original)
+		}
+		if original := res.NearDuplicateOf[d.SourcePath]; original != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "  ≈ near-duplicate of %s\n", original)
+		}
+		if reason := res.SuspiciousDates[d.SourcePath]; reason != "" {
+			fmt.Fprintf(cmd.OutOrStdout(), "  ? suspicious date: %s\n", reason)
+		}
+	}
+	return successCount
+}
+
+// runBatches runs the organize pipeline with --batch-size or --overlap, printing the decisions of every batch as
+// soon as it is done, as lines or as the elements of the --json array, and writing them to exporter
+// unless it is nil.
+func runBatches(cmd *cobra.Command, opts *options, src, dst string, cfg pipelineConfig, size int, jsonOutput bool, exporter export.Writer) (organizer.Result, error) {
+	successCount := 0
+	stream := &jsonStream{w: cmd.OutOrStdout()}
+	var exportErr error
+	events := organizer.Events{OnBatch: func(batch organizer.Result) {
+		if exporter != nil && exportErr == nil {
+			exportErr = exporter.Write(cmd.Context(), exportRows(batch))
+		}
+		if jsonOutput {
+			stream.write(jsonDecisions(batch))
+			return
+		}
+		successCount += printDecisionLines(cmd, batch)
+	}}
+	runOpts := append(cfg.organizerOptions(), organizer.WithBatchSize(size), organizer.WithEvents(events))
+	res, err := organizer.Run(cmd.Context(), src, dst, runOpts...)
+	err = errors.Join(err, exportErr)
+	if jsonOutput {
+		// The array is closed even after a failed batch, so the output stays valid JSON.
+		return res, errors.Join(err, stream.close())
+	}
+	if err == nil && opts.verbose {
+		cmd.PrintErrf("processed %d of %d files\n", successCount, res.Totals().Files)
+	}
+	return res, err
+}
+
+// jsonStream writes a --json array one batch of elements at a time, formatted as printJSONDecisions
+// formats the whole array.
+type jsonStream struct {
+	w   io.Writer
+	n   int
+	err error
+}
+
+func (s *jsonStream) write(ops []jsonOperation) {
+	for _, op := range ops {
+		if s.err != nil {
+			return
+		}
+		b, err := json.MarshalIndent(op, "  ", "  ")
+		if err != nil {
+			s.err = err
+			return
+		}
+		sep := ",\n  "
+		if s.n == 0 {
+			sep = "[\n  "
+		}
+		_, s.err = fmt.Fprintf(s.w, "%s%s", sep, b)
+		s.n++
+	}
+}
+
+func (s *jsonStream) close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.n == 0 {
+		_, err := io.WriteString(s.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(s.w, "\n]\n")
+	return err
+}
+
+// summarizeRun aggregates the decisions of res into run metrics.
+func summarizeRun(command string, execute bool, started time.Time, res organizer.Result, succeeded bool) metrics.Run {
+	run := metrics.Run{
+		Command:         command,
+		Execute:         execute,
+		StartedUnix:     float64(started.UnixNano()) / float64(time.Second),
+		DurationSeconds: time.Since(started).Seconds(),
+		FilesByAction:   make(map[string]int),
+		Succeeded:       succeeded,
+	}
+	totals := res.Totals()
+	run.FilesProcessed = totals.Files
+	run.BytesCopied = totals.BytesCopied
+	run.BytesSaved = totals.SavedBytes
+	run.Failures = totals.Actions[reconcile.ActionFailed]
+	for action, n := range totals.Actions {
+		run.FilesByAction[string(action)] = n
+	}
+	return run
+}
+
+// notifySummary builds the webhook payload for a finished run.
+func notifySummary(run metrics.Run, source, destination string, res organizer.Result, runErr error) notify.Summary {
+	s := notify.Summary{
+		Command:         run.Command,
+		Source:          source,
+		Destination:     destination,
+		Execute:         run.Execute,
+		Started:         time.Unix(0, int64(run.StartedUnix*float64(time.Second))).UTC(),
+		DurationSeconds: run.DurationSeconds,
+		FilesProcessed:  run.FilesProcessed,
+		Counts:          run.FilesByAction,
+		BytesCopied:     run.BytesCopied,
+		Failures:        run.Failures,
+		Succeeded:       run.Succeeded,
+		SavedBytes:      run.BytesSaved,
+	}
+	for _, c := range res.Cameras() {
+		s.Cameras = append(s.Cameras, notify.CameraStats{Camera: c.Camera, Files: c.Files, Bytes: c.Bytes})
+	}
+	for _, d := range res.Devices() {
+		s.Devices = append(s.Devices, notify.DeviceStats{Device: d.Device, Files: d.Files, Bytes: d.Bytes})
+	}
+	s.DuplicatesSkipped = res.Totals().DuplicatesSkipped
+	groups, _ := res.Duplicates()
+	for _, g := range groups {
+		s.DuplicateGroups = append(s.DuplicateGroups, notify.DuplicateGroup{Kept: g.Kept, Duplicates: g.Duplicates, SavedBytes: g.SavedBytes})
+	}
+	for _, d := range res.Decisions {
+		if d.Action == reconcile.ActionFailed && d.Error != nil {
+			s.FailedFiles = append(s.FailedFiles, notify.FailedFile{SourcePath: d.SourcePath, Error: d.Error.Error(), ErrorCode: string(errcode.Of(d.Error))})
+		}
+	}
+
+	mode := "dry-run"
+	if run.Execute {
+		mode = "execute"
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+		s.Text = fmt.Sprintf("media-organizer %s (%s) %s -> %s aborted after %.0fs: %v", run.Command, mode, source, destination, run.DurationSeconds, runErr)
+		return s
+	}
+	copied := run.FilesByAction[string(reconcile.ActionCopied)] + run.FilesByAction[string(reconcile.ActionCopiedRenamed)]
+	s.Text = fmt.Sprintf("media-organizer %s (%s) %s -> %s: %d files, %d copied, %d failed in %.0fs",
+		run.Command, mode, source, destination, run.FilesProcessed, copied, run.Failures, run.DurationSeconds)
+	if s.DuplicatesSkipped > 0 {
+		s.Text += fmt.Sprintf(", %d duplicates skipped (%s saved)", s.DuplicatesSkipped, progress.FormatBytes(s.SavedBytes))
+	}
+	return s
+}
+
+// printDuplicateSavings writes the bytes saved by skipping duplicates, in total and per group of
+// identical files, most bytes saved first.
+func printDuplicateSavings(cmd *cobra.Command, res organizer.Result) {
+	groups, saved := res.Duplicates()
+	if len(groups) == 0 {
+		// A batched run keeps only its totals.
+		if totals := res.Totals(); totals.DuplicatesSkipped > 0 {
+			cmd.PrintErrf("skipped %d duplicates, saving %s\n", totals.DuplicatesSkipped, progress.FormatBytes(totals.SavedBytes))
+		}
+		return
+	}
+	var skipped int
+	for _, g := range groups {
+		skipped += len(g.Duplicates)
+	}
+	cmd.PrintErrf("skipped %d duplicates of %d files, saving %s\n", skipped, len(groups), progress.FormatBytes(saved))
+	for _, g := range groups {
+		cmd.PrintErrf("%10s  %s (%d duplicates)\n", progress.FormatBytes(g.SavedBytes), g.Kept, len(g.Duplicates))
+	}
+}
+
+// parseVolumes parses the --volume values. Volumes are local directories.
+func parseVolumes(values []string, split string) ([]volume.Volume, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	if _, err := volume.ParseSplit(split); err != nil {
+		return nil, err
+	}
+	vols := make([]volume.Volume, 0, len(values))
+	for _, value := range values {
+		v, err := volume.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(v.Path, "://") {
+			return nil, fmt.Errorf("volume %s is not a local directory", v.Path)
+		}
+		vols = append(vols, v)
+	}
+	return vols, nil
+}
+
+// printVolumes writes the folders and bytes of the run on each volume (--volume).
+func printVolumes(cmd *cobra.Command, res organizer.Result) {
+	for _, v := range res.Volumes {
+		folders := "no folders"
+		if len(v.Folders) > 0 {
+			folders = strings.Join(v.Folders, ", ")
+		}
+		cmd.PrintErrf("volume %s: %s (%s of %s)\n", v.Path, folders, progress.FormatBytes(v.Bytes), progress.FormatBytes(v.Capacity))
+	}
+}
+
+// volumeOf returns the path of the volume of res that p is on, if any.
+func volumeOf(res organizer.Result, p string) string {
+	for _, v := range res.Volumes {
+		if rel, err := filepath.Rel(v.Path, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return v.Path
+		}
+	}
+	return ""
+}
+
+// printWarnings writes the findings about the destination that did not stop the run.
+func printWarnings(cmd *cobra.Command, res organizer.Result) {
+	for _, w := range res.Warnings {
+		cmd.PrintErrf("warning: %s\n", w)
+	}
+}
+
+// printHookErrors warns about the hooks that failed without failing the run.
+func printHookErrors(cmd *cobra.Command, res organizer.Result) {
+	for _, err := range res.HookErrors {
+		cmd.PrintErrf("warning: %v\n", err)
+	}
+}
+
+// printPlaceStats writes how many files were taken in each place, most files first.
+func printPlaceStats(cmd *cobra.Command, res organizer.Result) {
+	counts := make(map[string]int)
+	for _, fields := range res.Fields {
+		if place := fields[plan.TokenPlace]; place != "" {
+			counts[place]++
+		}
+	}
+	places := make([]string, 0, len(counts))
+	for place := range counts {
+		places = append(places, place)
+	}
+	sort.Slice(places, func(i, j int) bool {
+		if counts[places[i]] != counts[places[j]] {
+			return counts[places[i]] > counts[places[j]]
+		}
+		return places[i] < places[j]
+	})
+	for _, place := range places {
+		cmd.PrintErrf("%6d  %s\n", counts[place], place)
+	}
+}
+
+// printCameraStats writes how many files, and how many bytes, were taken with each camera.
+func printCameraStats(cmd *cobra.Command, res organizer.Result) {
+	for _, c := range res.Cameras() {
+		name := c.Camera
+		if name == "" {
+			name = "unknown camera"
+		}
+		cmd.PrintErrf("%6d  %10s  %s\n", c.Files, progress.FormatBytes(c.Bytes), name)
+	}
+}
+
+// printDeviceStats writes how many files, and how many bytes, were taken with each device, when that
+// tells more than the camera statistics: when devices of one model are told apart, or files without a
+// camera were identified by their name.
+func printDeviceStats(cmd *cobra.Command, res organizer.Result) {
+	cameras, devices := res.Cameras(), res.Devices()
+	same := len(cameras) == len(devices)
+	for i := 0; same && i < len(devices); i++ {
+		same = cameras[i].Camera == devices[i].Device
+	}
+	if same {
+		return
+	}
+	cmd.PrintErrln("per device:")
+	for _, d := range devices {
+		name := d.Device
+		if name == "" {
+			name = "unknown device"
+		}
+		cmd.PrintErrf("%6d  %10s  %s\n", d.Files, progress.FormatBytes(d.Bytes), name)
+	}
+}
+
+func printSidecars(cmd *cobra.Command, sidecars []plan.Operation) {
+	for _, sc := range sidecars {
+		if sc.Content != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "  + generated -> %s\n", sc.DestinationPath)
+			continue
+		}
+		if sc.Transform != nil {
+			fmt.Fprintf(cmd.OutOrStdout(), "  + extracted -> %s\n", sc.DestinationPath)
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "  + %s -> %s\n", sc.SourcePath, sc.DestinationPath)
+	}
+}
+
+type jsonCreatedAt struct {
+	Catalog   string `json:"catalog,omitempty"`
+	Metadata  string `json:"metadata,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	Filestat  string `json:"filestat,omitempty"`
+}
+
+// newJSONCreatedAt returns the created_at candidates of d.
+func newJSONCreatedAt(d createdat.DetailedResult) jsonCreatedAt {
+	createdAt := jsonCreatedAt{}
+	if !d.Catalog.IsZero() {
+		createdAt.Catalog = d.Catalog.Format(time.RFC3339)
+	}
+	if !d.Metadata.IsZero() {
+		createdAt.Metadata = d.Metadata.Format(time.RFC3339)
+	}
+	if !d.Filename.IsZero() {
+		createdAt.Filename = d.Filename.Format(time.RFC3339)
+	}
+	if !d.Directory.IsZero() {
+		createdAt.Directory = d.Directory.Format(time.RFC3339)
+	}
+	if !d.Filestat.IsZero() {
+		createdAt.Filestat = d.Filestat.Format(time.RFC3339)
+	}
+	return createdAt
+}
+
+// jsonAttribution is the created_at candidate chosen for a file, where it came from and how far it can be trusted.
+type jsonAttribution struct {
+	BestCreatedAt string `json:"best_created_at,omitempty"`
+	BestSource    string `json:"best_source,omitempty"`
+	Confidence    string `json:"confidence,omitempty"`
+	Track         string `json:"track,omitempty"`
+	ClockOffset   string `json:"clock_offset,omitempty"`
+}
+
+// newJSONAttribution returns the attribution of d; it is empty for files that were not attributed.
+func newJSONAttribution(d createdat.DetailedResult) jsonAttribution {
+	if d.Best.Source == "" {
+		return jsonAttribution{}
+	}
+	a := jsonAttribution{BestSource: string(d.Best.Source), Confidence: string(d.Confidence()), Track: string(d.Track)}
+	if d.ClockOffset != 0 {
+		a.ClockOffset = d.ClockOffset.String()
+	}
+	if !d.Best.CreatedAt.IsZero() {
+		a.BestCreatedAt = d.Best.CreatedAt.Format(time.RFC3339)
+	}
+	return a
+}
+
+type jsonOperation struct {
+	SourcePath      string        `json:"source_path"`
+	CreatedAt       jsonCreatedAt `json:"created_at"`
+	FileSizeBytes   int64         `json:"file_size_bytes"`
+	ModTime         time.Time     `json:"mod_time"`
+	Place           string        `json:"place,omitempty"`
+	Country         string        `json:"country,omitempty"`
+	City            string        `json:"city,omitempty"`
+	TrackPosition   *jsonPosition `json:"track_position,omitempty"`
+	Camera          string        `json:"camera,omitempty"`
+	Device          string        `json:"device,omitempty"`
+	Rating          int           `json:"rating,omitempty"`
+	Favorite        bool          `json:"favorite,omitempty"`
+	Keywords        []string      `json:"keywords,omitempty"`
+	Screenshot      bool          `json:"screenshot,omitempty"`
+	Resolution      string        `json:"resolution,omitempty"`
+	DurationSeconds float64       `json:"duration_seconds,omitempty"`
+	Codec           string        `json:"codec,omitempty"`
+	Burst           string        `json:"burst,omitempty"`
+	MotionPhoto     bool          `json:"motion_photo,omitempty"`
+	ConvertedToJPEG bool          `json:"converted_to_jpeg,omitempty"`
+	EditOf          string        `json:"edit_of,omitempty"`
+	PairedWith      string        `json:"paired_with,omitempty"`
+	SimilarTo       string        `json:"similar_to,omitempty"`
+	NearDuplicateOf string        `json:"near_duplicate_of,omitempty"`
+	SuspiciousDate  string        `json:"suspicious_date,omitempty"`
+	DestinationPath string        `json:"destination_path,omitempty"`
+	Volume          string        `json:"volume,omitempty"`
+
+	jsonAttribution
+
+	Action               string `json:"action,omitempty"`
+	FinalDestinationPath string `json:"final_destination_path,omitempty"`
+	DuplicateOf          string `json:"duplicate_of,omitempty"`
+	Error                string `json:"error,omitempty"`
+	ErrorCode            string `json:"error_code,omitempty"`
+
+	Sidecars []jsonSidecar `json:"sidecars,omitempty"`
+}
+
+// jsonPosition is the position the GPS track placed a file at.
+type jsonPosition struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type jsonSidecar struct {
+	SourcePath      string `json:"source_path,omitempty"`
+	DestinationPath string `json:"destination_path"`
+	Generated       bool   `json:"generated,omitempty"`
+	Extracted       bool   `json:"extracted,omitempty"`
+}
+
+func printJSONDecisions(cmd *cobra.Command, res organizer.Result) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(jsonDecisions(res))
+}
+
+// jsonDecisions returns the decisions of res in the format of --json.
+func jsonDecisions(res organizer.Result) []jsonOperation {
+	jsonOps := make([]jsonOperation, 0, len(res.Decisions))
+
+	for _, d := range res.Decisions {
+		detailed := res.Details[d.SourcePath]
+
+		jsonOp := jsonOperation{
+			SourcePath:      d.SourcePath,
+			CreatedAt:       newJSONCreatedAt(detailed),
+			jsonAttribution: newJSONAttribution(detailed),
+			FileSizeBytes:   res.Sizes[d.SourcePath],
+			ModTime:         res.ModTimes[d.SourcePath],
+			Place:           res.Fields[d.SourcePath][plan.TokenPlace],
+			Country:         res.Fields[d.SourcePath][plan.TokenCountry],
+			City:            res.Fields[d.SourcePath][plan.TokenCity],
+			Camera:          res.Fields[d.SourcePath][plan.TokenCamera],
+			Device:          res.Fields[d.SourcePath][plan.TokenDevice],
+			MotionPhoto:     res.MotionPhotos[d.SourcePath],
+			ConvertedToJPEG: res.Converted[d.SourcePath],
+			EditOf:          res.EditOf[d.SourcePath],
+			PairedWith:      res.PairedWith[d.SourcePath],
+			SimilarTo:       res.SimilarTo[d.SourcePath],
+			NearDuplicateOf: res.NearDuplicateOf[d.SourcePath],
+			SuspiciousDate:  res.SuspiciousDates[d.SourcePath],
+			DestinationPath: d.DestinationPath,
+			Volume:          volumeOf(res, d.DestinationPath),
+			Action:          string(d.Action),
+			DuplicateOf:     d.DuplicateOf,
+		}
+		if p, ok := res.Positions[d.SourcePath]; ok {
+			jsonOp.TrackPosition = &jsonPosition{Lat: p.Lat, Lon: p.Lon}
+		}
+		if rating, err := strconv.Atoi(res.Fields[d.SourcePath][plan.TokenRating]); err == nil {
+			jsonOp.Rating = rating
+		}
+		jsonOp.Favorite = res.Fields[d.SourcePath][plan.TokenFavorite] != ""
+		jsonOp.Keywords = res.Fields[d.SourcePath].Values(plan.TokenKeyword)
+		jsonOp.Screenshot = res.Fields[d.SourcePath][plan.TokenScreenshot] != ""
+		jsonOp.Resolution = res.Fields[d.SourcePath][plan.TokenResolution]
+		jsonOp.DurationSeconds, _ = strconv.ParseFloat(res.Fields[d.SourcePath][plan.TokenDuration], 64)
+		jsonOp.Codec = res.Fields[d.SourcePath][plan.TokenCodec]
+		jsonOp.Burst = res.Fields[d.SourcePath][plan.TokenBurst]
+		if d.FinalDestinationPath != "" && d.FinalDestinationPath != d.DestinationPath {
+			jsonOp.FinalDestinationPath = d.FinalDestinationPath
+		}
+		if d.Error != nil {
+			jsonOp.Error = d.Error.Error()
+			jsonOp.ErrorCode = string(errcode.Of(d.Error))
+		}
+		for _, sc := range d.Sidecars {
+			jsonOp.Sidecars = append(jsonOp.Sidecars, jsonSidecar{SourcePath: sc.SourcePath, DestinationPath: sc.DestinationPath, Generated: sc.Content != nil, Extracted: sc.Transform != nil})
+		}
+
+		jsonOps = append(jsonOps, jsonOp)
+	}
+	return jsonOps
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+)
+
+// pipelineConfig holds the organizer settings shared by the commands that organize files.
+type pipelineConfig struct {
+	execute bool
+
+	// progress receives stage progress events; nil disables reporting.
+	progress progress.Reporter
+
+	// catalog is the catalog opened by --catalog, nil without one.
+	catalog *catalog.Catalog
+
+	// options holds the remaining stage settings.
+	options []organizer.Option
+}
+
+// organizerOptions returns every setting of c as organizer options.
+func (c pipelineConfig) organizerOptions() []organizer.Option {
+	opts := append([]organizer.Option{}, c.options...)
+	return append(opts, organizer.WithExecute(c.execute), organizer.WithProgress(c.progress))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// runRetry copies again the failed files of the organize --json report at path (organizer.RetryFailed).
+func runRetry(cmd *cobra.Command, path string, source, destination location, cfg pipelineConfig, inPlace bool) (organizer.Result, error) {
+	ops, err := readReport(path)
+	if err != nil {
+		return organizer.Result{}, err
+	}
+	previous := reportResult(ops, source.path, destination.path)
+	previous.InPlace = inPlace
+	return organizer.RetryFailed(cmd.Context(), previous, cfg.organizerOptions()...)
+}
+
+// readReport reads the failed operations of an organize --json report: a JSON array, or one JSON
+// object per line (NDJSON).
+func readReport(path string) ([]jsonOperation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	dec := json.NewDecoder(r)
+	if first, err := firstByte(r); err != nil {
+		return nil, fmt.Errorf("read report %s: %w", path, err)
+	} else if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("read report %s: %w", path, err)
+		}
+	}
+
+	var failed []jsonOperation
+	for dec.More() {
+		var op jsonOperation
+		if err := dec.Decode(&op); err != nil {
+			return nil, fmt.Errorf("read report %s: %w", path, err)
+		}
+		if op.Action == string(reconcile.ActionFailed) {
+			failed = append(failed, op)
+		}
+	}
+	return failed, nil
+}
+
+// firstByte returns the first byte of r that is not white space, without consuming it.
+func firstByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("empty report")
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// reportResult returns the result of the run that wrote the report operations ops.
+func reportResult(ops []jsonOperation, source, destination string) organizer.Result {
+	res := organizer.Result{
+		Details:     make(map[string]createdat.DetailedResult),
+		Sizes:       make(map[string]int64),
+		ModTimes:    make(map[string]time.Time),
+		Fields:      make(map[string]plan.Fields),
+		Converted:   make(map[string]bool),
+		Sources:     []string{source},
+		Destination: destination,
+	}
+	for _, op := range ops {
+		d := reconcile.Decision{
+			SourcePath:           op.SourcePath,
+			DestinationPath:      op.DestinationPath,
+			FinalDestinationPath: op.FinalDestinationPath,
+			Action:               reconcile.Action(op.Action),
+			DuplicateOf:          op.DuplicateOf,
+		}
+		for _, sc := range op.Sidecars {
+			// Generated and extracted sidecars are made from data the report does not hold.
+			if !sc.Generated && !sc.Extracted {
+				d.Sidecars = append(d.Sidecars, plan.Operation{SourcePath: sc.SourcePath, DestinationPath: sc.DestinationPath})
+			}
+		}
+		res.Decisions = append(res.Decisions, d)
+		res.Sizes[op.SourcePath] = op.FileSizeBytes
+		res.ModTimes[op.SourcePath] = op.ModTime
+		res.Details[op.SourcePath] = op.detailedResult()
+		res.Converted[op.SourcePath] = op.ConvertedToJPEG
+		fields := plan.Fields{}
+		for token, value := range map[string]string{
+			plan.TokenPlace: op.Place, plan.TokenCountry: op.Country, plan.TokenCity: op.City,
+			plan.TokenCamera: op.Camera, plan.TokenDevice: op.Device,
+		} {
+			if value != "" {
+				fields[token] = value
+			}
+		}
+		if len(fields) > 0 {
+			res.Fields[op.SourcePath] = fields
+		}
+	}
+	return res
+}
+
+// detailedResult returns the created_at candidates of op, the inverse of newJSONCreatedAt and
+// newJSONAttribution.
+func (op jsonOperation) detailedResult() createdat.DetailedResult {
+	parse := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+	offset, _ := time.ParseDuration(op.ClockOffset)
+	return createdat.DetailedResult{
+		Best:        createdat.Result{CreatedAt: parse(op.BestCreatedAt), Source: createdat.Source(op.BestSource)},
+		Catalog:     parse(op.CreatedAt.Catalog),
+		Metadata:    parse(op.CreatedAt.Metadata),
+		Filename:    parse(op.CreatedAt.Filename),
+		Directory:   parse(op.CreatedAt.Directory),
+		Filestat:    parse(op.CreatedAt.Filestat),
+		Track:       createdat.TrackMatch(op.Track),
+		ClockOffset: offset,
+	}
+}
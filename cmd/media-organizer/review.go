@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/dashboard"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/review"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
+)
+
+// reviewFile is a file of the unknown or review directory of a library.
+type reviewFile struct {
+	path     string
+	sidecars []string
+	// note is the note the file was planned with, or else one of its attribution now.
+	note review.Note
+}
+
+func newReviewCmd(opts *options) *cobra.Command {
+	var date, layout, unknownDir, reviewDir, thumbnails string
+	var accept, execute bool
+	var lockWait time.Duration
+
+	reviewCmd := &cobra.Command{
+		Use:   "review [library] [path...]",
+		Short: "Date the files of the unknown and review directories of a library",
+		Long: "Go through the files of the unknown and review directories of an organized library, showing the date candidates " +
+			"of each file and the path of a thumbnail, assign dates to them and move them into the directories of those dates.\n\n" +
+			"Each file is asked for on stdin: enter a date (YYYY-MM-DD, optionally with HH:MM[:SS], YYYY-MM or YYYY), a to accept " +
+			"its best candidate, nothing to skip it, or q to stop. --date assigns one date to all files and --accept accepts the " +
+			"best candidate of all files instead. Paths after the library limit the review to those files and directories. " +
+			"Without --execute the moves are only listed.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			library, err := filepath.Abs(args[0])
+			if err != nil {
+				return err
+			}
+			l, err := plan.ParseNamedLayout(layout)
+			if err != nil {
+				return err
+			}
+			var fixed time.Time
+			if date != "" {
+				if accept {
+					return fmt.Errorf("--date and --accept cannot be combined")
+				}
+				if fixed, err = review.ParseDate(date, time.Local); err != nil {
+					return err
+				}
+			}
+
+			files, err := findReviewFiles(cmd, library, []string{unknownDir, reviewDir}, args[1:])
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				cmd.PrintErrln("nothing to review")
+				return nil
+			}
+
+			dates := make(map[string]time.Time)
+			switch {
+			case !fixed.IsZero():
+				for _, f := range files {
+					dates[f.path] = fixed
+				}
+			case accept:
+				for _, f := range files {
+					if t, ok := f.note.Best(); ok {
+						dates[f.path] = t
+					}
+				}
+			default:
+				if dates, err = askDates(cmd, files, thumbnails); err != nil {
+					return err
+				}
+			}
+			return moveReviewed(cmd, opts, library, files, dates, l, execute, lockWait)
+		},
+	}
+
+	reviewCmd.Flags().StringVar(&date, "date", "", "assign this date to all files instead of asking: YYYY-MM-DD, optionally with HH:MM[:SS], YYYY-MM or YYYY")
+	reviewCmd.Flags().BoolVar(&accept, "accept", false, "accept the best date candidate of all files instead of asking")
+	reviewCmd.Flags().StringVar(&layout, "layout", plan.DefaultLayout, "directory layout of the library: daily, monthly, yearly or a template")
+	reviewCmd.Flags().StringVar(&unknownDir, "unknown-dir", reconcile.DefaultUnknownDir, "library-relative directory of files without a known date")
+	reviewCmd.Flags().StringVar(&reviewDir, "review-dir", reconcile.DefaultReviewDir, "library-relative directory of files with an uncertain date")
+	reviewCmd.Flags().StringVar(&thumbnails, "thumbnails", filepath.Join(os.TempDir(), "media-organizer-review"), "directory the thumbnails of photos are written to")
+	reviewCmd.Flags().BoolVarP(&execute, "execute", "x", false, "move the files (default: dry-run)")
+	reviewCmd.Flags().DurationVar(&lockWait, "lock-wait", 0, "how long to wait for another run holding the library lock (default: exit immediately)")
+
+	return reviewCmd
+}
+
+// findReviewFiles returns the media files of the directories dirs of library, limited to the files
+// and directories of only when it is not empty.
+func findReviewFiles(cmd *cobra.Command, library string, dirs, only []string) ([]reviewFile, error) {
+	for i, p := range only {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		only[i] = abs
+	}
+
+	var files []reviewFile
+	for _, dir := range dirs {
+		root := filepath.Join(library, dir)
+		if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		fsys := os.DirFS(root)
+		records, err := scan.ScanRecords(cmd.Context(), fsys, ".", scan.DefaultOptions())
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			path := filepath.Join(root, filepath.FromSlash(record.Path))
+			if !selected(path, only) {
+				continue
+			}
+			f := reviewFile{path: path}
+			for _, sc := range record.Sidecars {
+				f.sidecars = append(f.sidecars, filepath.Join(root, filepath.FromSlash(sc)))
+			}
+			f.note, err = review.ReadNote(review.NotePath(path))
+			if errors.Is(err, fs.ErrNotExist) {
+				var detailed createdat.DetailedResult
+				detailed, err = createdat.DetermineDetailed(cmd.Context(), fsys, record.Path, createdat.Options{Location: time.Local})
+				f.note = review.New(path, detailed)
+			}
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// selected reports whether path is one of only or lies below one of them; everything is with no only.
+func selected(path string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, p := range only {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// askDates shows every file with its candidates and reads the date to assign it from stdin.
+func askDates(cmd *cobra.Command, files []reviewFile, thumbnails string) (map[string]time.Time, error) {
+	out := cmd.OutOrStdout()
+	in := bufio.NewScanner(cmd.InOrStdin())
+	dates := make(map[string]time.Time)
+	for _, f := range files {
+		showReviewFile(out, f)
+		if thumb, err := writeThumbnail(f.path, thumbnails); err != nil {
+			fmt.Fprintf(out, "  thumbnail  (%v)\n", err)
+		} else if thumb != "" {
+			fmt.Fprintf(out, "  thumbnail  %s\n", thumb)
+		}
+	ask:
+		for {
+			fmt.Fprint(out, "date (YYYY-MM-DD, a to accept, empty to skip, q to stop): ")
+			if !in.Scan() {
+				fmt.Fprintln(out)
+				return dates, in.Err()
+			}
+			answer := strings.TrimSpace(in.Text())
+			switch answer {
+			case "":
+				break ask
+			case "q":
+				return dates, nil
+			case "a":
+				t, ok := f.note.Best()
+				if !ok {
+					fmt.Fprintln(out, "no date to accept")
+					continue
+				}
+				dates[f.path] = t
+				break ask
+			}
+			t, err := review.ParseDate(answer, time.Local)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			dates[f.path] = t
+			break ask
+		}
+	}
+	return dates, nil
+}
+
+// showReviewFile writes the path and date candidates of f to w.
+func showReviewFile(w io.Writer, f reviewFile) {
+	n := f.note
+	fmt.Fprintf(w, "\n%s\n", f.path)
+	if n.SourcePath != f.path {
+		fmt.Fprintf(w, "  source     %s\n", n.SourcePath)
+	}
+	if n.BestCreatedAt != "" {
+		fmt.Fprintf(w, "  best       %s (%s, %s confidence): %s\n", n.BestCreatedAt, n.BestSource, n.Confidence, n.Reason)
+	} else {
+		fmt.Fprintf(w, "  best       none: %s\n", n.Reason)
+	}
+	for _, c := range []struct{ name, value string }{
+		{"catalog", n.CreatedAt.Catalog},
+		{"metadata", n.CreatedAt.Metadata},
+		{"filename", n.CreatedAt.Filename},
+		{"directory", n.CreatedAt.Directory},
+		{"filestat", n.CreatedAt.Filestat},
+	} {
+		if c.value != "" {
+			fmt.Fprintf(w, "  %-10s %s\n", c.name, c.value)
+		}
+	}
+}
+
+// writeThumbnail writes a JPEG thumbnail of the photo at path into dir and returns its path, named
+// after the path of the photo. Files the standard library cannot decode get none.
+func writeThumbnail(path, dir string) (string, error) {
+	if !dashboard.Thumbnailable(path) {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(path))
+	thumb := filepath.Join(dir, hex.EncodeToString(sum[:8])+".jpg")
+	out, err := os.Create(thumb)
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(out, dashboard.Thumbnail(img, dashboard.ThumbnailSize), &jpeg.Options{Quality: 75}); err != nil {
+		out.Close()
+		return "", err
+	}
+	return thumb, out.Close()
+}
+
+// moveReviewed plans the files with a date in dates into the directories of layout l in library and,
+// with execute, moves them there together with their sidecars. The notes of moved files are removed.
+func moveReviewed(cmd *cobra.Command, opts *options, library string, files []reviewFile, dates map[string]time.Time, l plan.Layout, execute bool, lockWait time.Duration) error {
+	var sources []string
+	sidecars := make(map[string][]string)
+	for _, f := range files {
+		if _, ok := dates[f.path]; ok {
+			sources = append(sources, f.path)
+			sidecars[f.path] = f.sidecars
+		}
+	}
+	if len(sources) == 0 {
+		cmd.PrintErrln("no dates assigned")
+		return nil
+	}
+
+	planned, err := reconcile.PlanDestinations(library, sources, dates, reconcile.PlanOptions{Layout: l})
+	if err != nil {
+		return err
+	}
+	decisions, err := reconcile.ResolveAgainstDestination(cmd.Context(), planned)
+	if err != nil {
+		return err
+	}
+	var ops []plan.Operation
+	for _, d := range decisions {
+		if d.Action == reconcile.ActionSkippedIdentical {
+			fmt.Fprintf(cmd.OutOrStdout(), "identical %s already in %s\n", d.SourcePath, d.FinalDestinationPath)
+			continue
+		}
+		ops = append(ops, plan.Operation{
+			SourcePath:      d.SourcePath,
+			DestinationPath: d.FinalDestinationPath,
+			Sidecars:        sidecar.Plan(d.SourcePath, d.FinalDestinationPath, sidecars[d.SourcePath]),
+		})
+	}
+
+	if !execute {
+		for _, op := range ops {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", op.SourcePath, op.DestinationPath)
+		}
+		return nil
+	}
+
+	release, err := organizer.AcquireLock(library, organizer.WithLockWait(lockWait))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	results, err := copy.Execute(cmd.Context(), ops, copy.Options{Move: true, PreserveTimes: true})
+	var moved []string
+	failed := 0
+	for _, r := range results {
+		if !r.Success {
+			failed++
+			fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", r.Operation.SourcePath, r.Error)
+			continue
+		}
+		if rmErr := os.Remove(review.NotePath(r.Operation.SourcePath)); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) {
+			fmt.Fprintf(cmd.OutOrStderr(), "remove review note: %v\n", rmErr)
+		}
+		moved = append(moved, r.Operation.SourcePath)
+		fmt.Fprintf(cmd.OutOrStdout(), "moved %s -> %s\n", r.Operation.SourcePath, r.Operation.DestinationPath)
+	}
+	removeEmptyDirs(library, moved)
+	if opts.verbose {
+		cmd.PrintErrf("moved %d of %d files\n", len(moved), len(ops))
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be moved", failed)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/export"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+	"github.com/spf13/cobra"
+)
+
+func newScanCmd(opts *options) *cobra.Command {
+	var maxDepth int
+	var jsonOutput bool
+	var exportPath string
+
+	scanCmd := &cobra.Command{
+		Use:   "scan [directory]",
+		Short: "Scan a directory for media files",
+		Long:  "Scan a directory and print all media files found (relative to the scan root).",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			directory := args[0]
+
+			var exporter export.Writer
+			if exportPath != "" {
+				if exporter, err = createExport(cmd.Context(), exportPath); err != nil {
+					return err
+				}
+				defer func() {
+					if closeErr := exporter.Close(); closeErr != nil && err == nil {
+						err = closeErr
+					}
+				}()
+			}
+
+			scanOpts := scan.DefaultOptions()
+			scanOpts.MaxDepth = maxDepth
+
+			records, err := scan.ScanRecords(cmd.Context(), os.DirFS(directory), ".", scanOpts)
+			if err != nil {
+				return err
+			}
+
+			var details []createdat.DetailedResult
+			if jsonOutput || exporter != nil {
+				// Enrich scan records with created_at candidates.
+				fsys := os.DirFS(directory)
+				details = make([]createdat.DetailedResult, 0, len(records))
+				for _, record := range records {
+					detailed, err := createdat.DetermineDetailed(cmd.Context(), fsys, record.Path, createdat.Options{Location: time.Local})
+					if err != nil {
+						return err
+					}
+					details = append(details, detailed)
+				}
+			}
+
+			if exporter != nil {
+				rows := make([]export.Row, 0, len(records))
+				for i, record := range records {
+					rows = append(rows, newExportRow(filepath.Join(directory, filepath.FromSlash(record.Path)), record.FileSizeBytes, record.ModTime, details[i]))
+				}
+				if err := exporter.Write(cmd.Context(), rows); err != nil {
+					return err
+				}
+			}
+
+			if jsonOutput {
+				type scanJSONRecord struct {
+					SourcePath    string        `json:"source_path"`
+					CreatedAt     jsonCreatedAt `json:"created_at"`
+					FileSizeBytes int64         `json:"file_size_bytes"`
+					ModTime       time.Time     `json:"mod_time"`
+
+					jsonAttribution
+				}
+
+				out := make([]scanJSONRecord, 0, len(records))
+				for i, record := range records {
+					out = append(out, scanJSONRecord{
+						SourcePath:      filepath.Join(directory, filepath.FromSlash(record.Path)),
+						CreatedAt:       newJSONCreatedAt(details[i]),
+						jsonAttribution: newJSONAttribution(details[i]),
+						FileSizeBytes:   record.FileSizeBytes,
+						ModTime:         record.ModTime,
+					})
+				}
+
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(out)
+			}
+
+			for _, record := range records {
+				cmd.Println(record.Path)
+			}
+
+			if opts.verbose {
+				cmd.PrintErrf("found %d media files\n", len(records))
+			}
+
+			return nil
+		},
+	}
+
+	scanCmd.Flags().IntVar(&maxDepth, "max-depth", -1, "maximum recursion depth (0 = no recursion)")
+	scanCmd.Flags().BoolVar(&jsonOutput, "json", false, "output records as JSON")
+	scanCmd.Flags().StringVar(&exportPath, "export", "", "also write the records with their created_at candidates to a new SQLite database (.db, .sqlite) or Parquet file (.parquet)")
+
+	return scanCmd
+}
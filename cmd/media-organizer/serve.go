@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/dashboard"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// defaultListen only accepts connections from this machine; pass --listen :8080 to serve the network.
+const defaultListen = "127.0.0.1:8080"
+
+func newServeCmd(opts *options) *cobra.Command {
+	var flags pipelineFlags
+	var listen string
+
+	serveCmd := &cobra.Command{
+		Use:   "serve [source] [destination]",
+		Short: "Serve a web dashboard to preview and approve imports",
+		Long: "Serve a web dashboard that previews the import of source into destination (files to import with thumbnails, " +
+			"duplicate groups and failures) and copies the files only when the import is approved in the browser. " +
+			"Each preview and import takes the destination lock; --execute is ignored.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := flags.config(cmd)
+			if err != nil {
+				return err
+			}
+			if cfg.progress != nil {
+				return fmt.Errorf("serve cannot be combined with --progress")
+			}
+
+			src, err := openLocation(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer src.close()
+			dst, err := openLocation(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+			defer dst.close()
+			cfg.options = append(cfg.options, locationOptions(src, dst)...)
+			// Execute does not return the hook failures of an import.
+			cfg.options = append(cfg.options, organizer.WithEvents(organizer.Events{
+				OnHookError: func(err error) { cmd.PrintErrf("warning: %v\n", err) },
+			}))
+			closeCatalog, err := flags.openCatalog(cmd, &cfg)
+			if err != nil {
+				return err
+			}
+			defer closeCatalog()
+
+			board := dashboard.New(cmd.Context(), dashboardConfig(cmd, opts, src, dst, cfg))
+			ln, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			cmd.PrintErrf("serving the dashboard on http://%s\n", ln.Addr())
+
+			server := &http.Server{Handler: board, ReadHeaderTimeout: 10 * time.Second}
+			serveErr := make(chan error, 1)
+			go func() { serveErr <- server.Serve(ln) }()
+
+			select {
+			case err := <-serveErr:
+				return err
+			case <-cmd.Context().Done():
+			}
+			shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(cmd.Context()), 5*time.Second)
+			defer cancel()
+			err = server.Shutdown(shutdownCtx)
+			// A canceled import removes the file it was writing; wait for that before closing the locations.
+			board.Wait()
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		},
+	}
+
+	flags.bind(serveCmd)
+	serveCmd.Flags().StringVar(&listen, "listen", defaultListen, "address to serve the dashboard on")
+
+	return serveCmd
+}
+
+// dashboardConfig plans and executes the imports of the dashboard of source and destination.
+// The destination lock is held for each preview and each import, not in between.
+func dashboardConfig(cmd *cobra.Command, opts *options, source, destination location, cfg pipelineConfig) dashboard.Config {
+	withLock := func(fn func() error) (err error) {
+		release, err := organizer.AcquireLock(destination.path, cfg.options...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if releaseErr := release(); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}()
+		return fn()
+	}
+	sourceFS := destfs.OrOS(source.fsys)
+
+	return dashboard.Config{
+		Title: fmt.Sprintf("media-organizer %s -> %s", source.name, destination.name),
+		Plan: func(ctx context.Context, r progress.Reporter) (res organizer.Result, err error) {
+			err = withLock(func() error {
+				res, err = organizer.Plan(ctx, []string{source.path}, destination.path, pipelineConfig{progress: r, options: cfg.options}.organizerOptions()...)
+				return err
+			})
+			return res, err
+		},
+		Execute: func(ctx context.Context, res organizer.Result, r progress.Reporter) error {
+			err := withLock(func() error {
+				return organizer.Execute(ctx, res, pipelineConfig{progress: r, options: cfg.options}.organizerOptions()...)
+			})
+			if opts.verbose {
+				counts := res.Counts()
+				cmd.PrintErrf("imported %d files (%d failed)\n", counts[reconcile.ActionCopied]+counts[reconcile.ActionCopiedRenamed], counts[reconcile.ActionFailed])
+			}
+			return err
+		},
+		Open: func(path string) (io.ReadCloser, error) { return sourceFS.Open(path) },
+	}
+}
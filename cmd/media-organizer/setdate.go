@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/review"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
+	"github.com/quidome/media-organizer-go/pkg/xmpdate"
+)
+
+// datedFile is a media file set-date assigns a date to, with its existing XMP sidecar if any.
+type datedFile struct {
+	path string
+	xmp  string
+}
+
+func newSetDateCmd(opts *options) *cobra.Command {
+	var date, catalogPath string
+	var execute bool
+
+	setDateCmd := &cobra.Command{
+		Use:   "set-date [directory-or-file...]",
+		Short: "Assign a created_at to undated media such as scans",
+		Long: "Assign one created_at to the media files given, and to those below the directories given, so organize files " +
+			"them under that date instead of the dates found in the files, such as the event date of a folder of scanned prints.\n\n" +
+			"The date is written as the photoshop:DateCreated of the XMP sidecar of each file, which is created when the file has " +
+			"none and travels along when the file is organized. With --catalog it is recorded in that catalog instead, leaving the " +
+			"files alone; organize runs with the same --catalog use it. Without --execute the files are only listed.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if date == "" {
+				return fmt.Errorf("--date is required")
+			}
+			t, err := review.ParseDate(date, time.Local)
+			if err != nil {
+				return err
+			}
+			files, err := findDatedFiles(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			var c *catalog.Catalog
+			if catalogPath != "" && execute {
+				if c, err = catalog.Open(cmd.Context(), catalogPath); err != nil {
+					return err
+				}
+				defer c.Close()
+			}
+
+			failed := 0
+			for _, f := range files {
+				if err := cmd.Context().Err(); err != nil {
+					return err
+				}
+				where := catalogPath
+				switch {
+				case catalogPath != "" && execute:
+					err = c.SetDate(cmd.Context(), f.path, t)
+				case catalogPath != "":
+				case execute:
+					where, err = writeDateCreated(f, t)
+				default:
+					where = f.xmp
+					if where == "" {
+						where = xmpdate.SidecarPath(f.path)
+					}
+				}
+				if err != nil {
+					failed++
+					fmt.Fprintf(cmd.OutOrStderr(), "failed %s: %v\n", f.path, err)
+					continue
+				}
+				prefix := ""
+				if execute {
+					prefix = "set "
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s%s: created_at %s (in %s)\n", prefix, f.path, t.Format(time.RFC3339), where)
+			}
+
+			if opts.verbose {
+				cmd.PrintErrf("%d media files\n", len(files))
+			}
+			if failed > 0 {
+				return fmt.Errorf("set-date: %d files failed", failed)
+			}
+			return nil
+		},
+	}
+
+	setDateCmd.Flags().StringVar(&date, "date", "", "the created_at to assign: YYYY-MM-DD, optionally with HH:MM[:SS], YYYY-MM or YYYY (required)")
+	setDateCmd.Flags().StringVar(&catalogPath, "catalog", "", "record the date in this SQLite catalog instead of an XMP sidecar")
+	setDateCmd.Flags().BoolVarP(&execute, "execute", "x", false, "write the dates (default: dry-run)")
+
+	return setDateCmd
+}
+
+// findDatedFiles returns the media files among paths and below the directories among them.
+func findDatedFiles(cmd *cobra.Command, paths []string) ([]datedFile, error) {
+	var files []datedFile
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, datedFile{path: p, xmp: existingXMP(p)})
+			continue
+		}
+		records, err := scan.ScanRecords(cmd.Context(), os.DirFS(p), ".", scan.DefaultOptions())
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			f := datedFile{path: filepath.Join(p, filepath.FromSlash(record.Path))}
+			for _, sc := range record.Sidecars {
+				if strings.EqualFold(filepath.Ext(sc), ".xmp") {
+					f.xmp = filepath.Join(p, filepath.FromSlash(sc))
+					break
+				}
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// existingXMP returns the XMP sidecar of the media file at path, or "" when it has none.
+func existingXMP(path string) string {
+	dir := filepath.Dir(path)
+	for _, name := range sidecar.Candidates(filepath.Base(path), []string{".xmp"}) {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// writeDateCreated sets t as the photoshop:DateCreated of the XMP sidecar of f, creating the sidecar
+// when f has none, and returns its path.
+func writeDateCreated(f datedFile, t time.Time) (string, error) {
+	path := f.xmp
+	if path == "" {
+		path = xmpdate.SidecarPath(f.path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	out, err := xmpdate.Set(data, t)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return path, os.WriteFile(path, out, 0o644)
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// terminalWidth returns the number of columns of the terminal w is, and whether w is a terminal. The
+// width is not known on this platform: it is zero.
+func terminalWidth(w io.Writer) (int, bool) {
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0, false
+	}
+	info, err := f.Stat()
+	return 0, err == nil && info.Mode()&os.ModeCharDevice != 0
+}
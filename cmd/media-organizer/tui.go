@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/tui"
+)
+
+// runTUI plans an organize run interactively and executes it only after confirmation.
+//
+// The destination lock is held from planning until the program exits, so the confirmed plan
+// cannot be invalidated by a concurrent run. The returned bool reports whether files were copied.
+func runTUI(cmd *cobra.Command, source, destination location, cfg pipelineConfig) (res organizer.Result, executed bool, err error) {
+	release, err := organizer.AcquireLock(destination.path, cfg.options...)
+	if err != nil {
+		return res, false, err
+	}
+	defer func() {
+		if releaseErr := release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	ctx := cmd.Context()
+	planFn := func(r progress.Reporter) ([]reconcile.Decision, error) {
+		planned, planErr := organizer.Plan(ctx, []string{source.path}, destination.path, pipelineConfig{progress: r, options: cfg.options}.organizerOptions()...)
+		res = planned
+		return planned.Decisions, planErr
+	}
+	executeFn := func(decisions []reconcile.Decision, r progress.Reporter) error {
+		res.Decisions = decisions
+		return organizer.Execute(ctx, res, pipelineConfig{progress: r, options: cfg.options}.organizerOptions()...)
+	}
+
+	model := tui.New(fmt.Sprintf("media-organizer organize %s -> %s", source.name, destination.name), planFn, executeFn)
+	program := tea.NewProgram(model, tea.WithInput(cmd.InOrStdin()), tea.WithOutput(cmd.OutOrStdout()), tea.WithAltScreen())
+	if _, err := program.Run(); err != nil {
+		return res, false, fmt.Errorf("tui: %w", err)
+	}
+
+	res.Decisions = model.Decisions()
+	return res, model.Executed(), model.Err()
+}
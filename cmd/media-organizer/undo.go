@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/history"
+	"github.com/quidome/media-organizer-go/pkg/journal"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+)
+
+func newUndoCmd(opts *options) *cobra.Command {
+	var library, catalogPath, trashMode, trashDir string
+	var execute bool
+	var lockWait time.Duration
+
+	undoCmd := &cobra.Command{
+		Use:   "undo <journal>",
+		Short: "Revert an organize run recorded in its journal",
+		Long: "Revert the executed organize run recorded in a journal: every copy it made is removed, and files it " +
+			"moved with --move or --in-place are moved back to their source. Each file is first verified to be " +
+			"unchanged since the run wrote it; changed files are left alone. Directories left empty are removed.\n\n" +
+			"The journal may also be a remote location URL, like the destination of organize. With --catalog, the " +
+			"removed files are also forgotten by the catalog, so a later run imports them again. With --trash, the " +
+			"removed copies go into a trash instead of being deleted.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			loc, err := openLocation(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer loc.close()
+			entries, err := journal.Read(loc.fsys, loc.path)
+			if err != nil {
+				return err
+			}
+			if library == "" {
+				library = filepath.Dir(loc.path)
+			}
+
+			started := time.Now()
+			bin, err := openTrash(trashMode, trashDir, location{path: library, fsys: loc.fsys}, started)
+			if err != nil {
+				return err
+			}
+			if bin != nil && loc.fsys != nil {
+				return fmt.Errorf("--trash needs a local journal")
+			}
+
+			if !execute {
+				for i := len(entries) - 1; i >= 0; i-- {
+					printUndoResult(cmd, journal.Check(loc.fsys, entries[i]))
+				}
+				return nil
+			}
+
+			var lockOpts []organizer.Option
+			if loc.fsys != nil {
+				lockOpts = append(lockOpts, organizer.WithDestinationFS(loc.fsys))
+			}
+			release, err := organizer.AcquireLock(library, append(lockOpts, organizer.WithLockWait(lockWait))...)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			var cat *catalog.Catalog
+			if catalogPath != "" {
+				if cat, err = catalog.Open(cmd.Context(), catalogPath); err != nil {
+					return err
+				}
+				defer cat.Close()
+			}
+
+			counts := make(map[string]int)
+			var failedFiles []history.FailedFile
+			defer func() {
+				e := history.Entry{
+					ID:              history.NewID(started),
+					Command:         "undo",
+					Args:            commandLine(cmd, args),
+					Destination:     loc.name,
+					Execute:         true,
+					Started:         started.UTC(),
+					DurationSeconds: time.Since(started).Seconds(),
+					FilesProcessed:  len(entries),
+					Counts:          counts,
+					Failures:        len(failedFiles),
+					FailedFiles:     failedFiles,
+					Succeeded:       err == nil,
+					Journal:         args[0],
+				}
+				if err != nil {
+					e.Error = err.Error()
+				}
+				log := historyLog(pipelineConfig{catalog: cat}, location{name: loc.name, path: library, fsys: loc.fsys})
+				if histErr := log.Append(context.WithoutCancel(cmd.Context()), e); histErr != nil {
+					cmd.PrintErrf("warning: history: %v\n", histErr)
+				}
+			}()
+
+			results, err := journal.Undo(cmd.Context(), loc.fsys, library, entries, bin)
+			var undone []string
+			for _, r := range results {
+				printUndoResult(cmd, r)
+				counts[string(r.Action)]++
+				switch r.Action {
+				case journal.ActionFailed:
+					failedFiles = append(failedFiles, history.FailedFile{SourcePath: r.Entry.Destination, Error: fmt.Sprint(r.Err)})
+				case journal.ActionRemoved, journal.ActionMovedBack, journal.ActionMissing:
+					undone = append(undone, r.Entry.Destination)
+				}
+			}
+			if cat != nil {
+				n, forgetErr := cat.Forget(context.WithoutCancel(cmd.Context()), undone)
+				if forgetErr != nil && err == nil {
+					err = forgetErr
+				}
+				if opts.verbose {
+					cmd.PrintErrf("forgot %d files in %s\n", n, catalogPath)
+				}
+			}
+			if opts.verbose {
+				cmd.PrintErrf("undid %d of %d files\n", len(results)-len(failedFiles), len(entries))
+			}
+			if err != nil {
+				return err
+			}
+			if len(failedFiles) > 0 {
+				return fmt.Errorf("%d files could not be undone", len(failedFiles))
+			}
+			return nil
+		},
+	}
+
+	undoCmd.Flags().BoolVarP(&execute, "execute", "x", false, "remove and move back the files (default: dry-run)")
+	undoCmd.Flags().StringVar(&library, "library", "", "destination of the run, whose lock is taken and below which emptied directories are removed (default: the directory of the journal)")
+	undoCmd.Flags().StringVar(&trashMode, "trash", "", "put the removed copies into a trash instead of deleting them: os (the trash of the desktop) or destination (<library>/<trash-dir>/<time>)")
+	undoCmd.Flags().StringVar(&trashDir, "trash-dir", trash.DirName, "directory below the library that --trash destination puts the removed copies in, in a directory per run")
+	undoCmd.Flags().StringVar(&catalogPath, "catalog", "", "catalog the run recorded its files in, to forget the undone files in")
+	undoCmd.Flags().DurationVar(&lockWait, "lock-wait", 0, "how long to wait for another run holding the library lock (default: exit immediately)")
+
+	return undoCmd
+}
+
+// printUndoResult prints what undo did, or would do, with the file of r.
+func printUndoResult(cmd *cobra.Command, r journal.Result) {
+	switch r.Action {
+	case journal.ActionRemoved:
+		fmt.Fprintf(cmd.OutOrStdout(), "remove %s\n", r.Entry.Destination)
+	case journal.ActionMovedBack:
+		fmt.Fprintf(cmd.OutOrStdout(), "move %s -> %s\n", r.Entry.Destination, r.Entry.Source)
+	case journal.ActionMissing:
+		fmt.Fprintf(cmd.OutOrStdout(), "missing %s\n", r.Entry.Destination)
+	default:
+		fmt.Fprintf(cmd.OutOrStderr(), "skip %s: %v\n", r.Entry.Destination, r.Err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+)
+
+func newVerifyCmd(opts *options) *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify [library]",
+		Short: "Verify a library against its checksum manifests",
+		Long: "Verify every file listed in the " + manifest.FileName + " manifests of a library, as written by organize --manifest, " +
+			"and report files that are missing or whose content changed.\n\n" +
+			"The library may also be a remote location URL, like the destination of organize.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			library, err := openLocation(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer library.close()
+
+			report, err := manifest.Verify(cmd.Context(), library.fsys, library.path)
+			if err != nil {
+				return err
+			}
+			if report.Manifests == 0 {
+				return fmt.Errorf("no %s manifests in %s", manifest.FileName, library.name)
+			}
+			for _, p := range report.Problems {
+				switch {
+				case errors.Is(p.Err, fs.ErrNotExist):
+					fmt.Fprintf(cmd.OutOrStdout(), "missing %s\n", p.Path)
+				case errors.Is(p.Err, manifest.ErrMismatch):
+					fmt.Fprintf(cmd.OutOrStdout(), "changed %s\n", p.Path)
+				default:
+					fmt.Fprintf(cmd.OutOrStdout(), "failed %s: %v\n", p.Path, p.Err)
+				}
+			}
+			if opts.verbose {
+				cmd.PrintErrf("verified %d files in %d manifests\n", report.Checked, report.Manifests)
+			}
+			if len(report.Problems) > 0 {
+				return fmt.Errorf("%d of %d files failed verification", len(report.Problems), report.Checked)
+			}
+			return nil
+		},
+	}
+
+	return verifyCmd
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/spf13/cobra"
+)
+
+// Build metadata, overridable at link time:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.date=2024-01-01T00:00:00Z"
+var (
+	version = "0.1.0"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuildInfo returns the link-time metadata, falling back to the VCS stamp
+// recorded by the Go toolchain when the binary was built without ldflags.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String formats the build metadata on a single line.
+func (b buildInfo) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s %s)", b.Version, b.Commit, b.Date, b.GoVersion, b.Platform)
+}
+
+func newVersionCmd() *cobra.Command {
+	var jsonOutput bool
+
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print version and build information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := currentBuildInfo()
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "media-organizer %s\n", version)
+			fmt.Fprintf(cmd.OutOrStdout(), "  commit:   %s\n", info.Commit)
+			fmt.Fprintf(cmd.OutOrStdout(), "  built:    %s\n", info.Date)
+			fmt.Fprintf(cmd.OutOrStdout(), "  go:       %s\n", info.GoVersion)
+			fmt.Fprintf(cmd.OutOrStdout(), "  platform: %s\n", info.Platform)
+			return nil
+		},
+	}
+
+	versionCmd.Flags().BoolVar(&jsonOutput, "json", false, "output build information as JSON")
+
+	return versionCmd
+}
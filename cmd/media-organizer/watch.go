@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/watch"
+)
+
+func newWatchCmd(opts *options) *cobra.Command {
+	var flags pipelineFlags
+	var jsonOutput bool
+	var move bool
+	var debounce time.Duration
+	var retries int
+
+	watchCmd := &cobra.Command{
+		Use:   "watch [source] [destination]",
+		Short: "Organize new media files as they appear in a directory",
+		Long: "Watch a local source directory, such as a camera upload folder or a Syncthing share, and organize it into the destination " +
+			"whenever new files have arrived, until interrupted.\n\n" +
+			"The source is organized once at start, for the files that arrived while it was not watched, and again each time files were " +
+			"created or written and the source has been quiet for --debounce. Files still growing are waited for, temporary transfer files " +
+			"(hidden, .tmp, .part) are ignored, and files that fail as empty, truncated or changed are tried again up to --retries times.\n\n" +
+			"Every run organizes the whole source: files already in the destination are skipped as identical and not reported again. " +
+			"Use --move to empty the source as it is organized, or --cache to keep repeat runs over a large source cheap.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.Contains(args[0], "://") {
+				return fmt.Errorf("watch needs a local source directory, got %s", args[0])
+			}
+			if debounce <= 0 {
+				return fmt.Errorf("--debounce must be positive")
+			}
+			if retries < 0 {
+				return fmt.Errorf("--retries must not be negative")
+			}
+			cfg, err := flags.config(cmd)
+			if err != nil {
+				return err
+			}
+			if cfg.progress != nil {
+				return fmt.Errorf("watch cannot report progress")
+			}
+			if move {
+				cfg.options = append(cfg.options, organizer.WithMove())
+			}
+
+			src, err := openLocation(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			defer src.close()
+			dst, err := openLocation(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+			defer dst.close()
+			cfg.options = append(cfg.options, locationOptions(src, dst)...)
+			closeCatalog, err := flags.openCatalog(cmd, &cfg)
+			if err != nil {
+				return err
+			}
+			defer closeCatalog()
+
+			// Watch before the first run, so files arriving during it are not missed.
+			w, err := watch.New(src.path, debounce)
+			if err != nil {
+				return err
+			}
+			defer w.Close()
+
+			r := &watchRunner{
+				cmd: cmd, opts: opts, flags: &flags, cfg: cfg, src: src, dst: dst,
+				line: commandLine(cmd, args), jsonOutput: jsonOutput, retries: retries, attempts: make(map[string]int),
+			}
+			r.log("watching %s", src.name)
+			w.Queue(r.run(cmd.Context(), nil)...)
+			for {
+				files, err := w.Next(cmd.Context())
+				if cmd.Context().Err() != nil {
+					r.log("stopped watching %s", src.name)
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				w.Queue(r.run(cmd.Context(), files)...)
+			}
+		},
+	}
+
+	flags.bind(watchCmd)
+	watchCmd.Flags().BoolVar(&jsonOutput, "json", false, "output operations as JSON, one object per line (NDJSON)")
+	watchCmd.Flags().BoolVar(&move, "move", false, "move the files into the destination instead of copying them, verifying copies across devices before removing the source")
+	watchCmd.Flags().DurationVar(&debounce, "debounce", watch.DefaultDebounce, "how long the source must be quiet, and new files unchanged, before it is organized")
+	watchCmd.Flags().IntVar(&retries, "retries", 3, "how many times a file that failed as empty, truncated or changed while being written is tried again")
+
+	return watchCmd
+}
+
+// watchRunner organizes the source of the watch command each time files arrive.
+type watchRunner struct {
+	cmd        *cobra.Command
+	opts       *options
+	flags      *pipelineFlags
+	cfg        pipelineConfig
+	src, dst   location
+	line       []string
+	jsonOutput bool
+	retries    int
+
+	// attempts counts the consecutive failed runs of the files to retry, by source.
+	attempts map[string]int
+	// started is when the last run started.
+	started time.Time
+}
+
+// run organizes the source once and returns the files to try again: those that failed as being
+// written and, when the whole run failed, the changed files. An interrupted run returns nothing.
+func (r *watchRunner) run(ctx context.Context, changed []string) []string {
+	// Journals are named by the second their run started: runs start a second apart.
+	if next := r.started.Truncate(time.Second).Add(time.Second); time.Now().Before(next) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+	started := time.Now()
+	r.started = started
+	cfg := r.cfg
+	cfg.options = slices.Clip(cfg.options)
+	var res organizer.Result
+	var err error
+	var journalName string
+	if cfg.execute {
+		// Deferred before the journal is closed, so it records the journal name.
+		defer func() {
+			if ctx.Err() != nil && err != nil {
+				return
+			}
+			run := summarizeRun("watch", cfg.execute, started, res, err == nil)
+			e := historyEntry("watch", r.line, notifySummary(run, r.src.name, r.dst.name, res, err), res)
+			e.Journal = journalName
+			if histErr := historyLog(cfg, r.dst).Append(context.WithoutCancel(ctx), e); histErr != nil {
+				r.log("warning: history: %v", histErr)
+			}
+		}()
+		if r.flags.archive == "" {
+			var closeJournal func() string
+			if closeJournal, err = openJournal(r.cmd, r.opts, &cfg, r.dst, "", started); err != nil {
+				r.log("%v", err)
+				return r.retry(changed)
+			}
+			defer func() { journalName = closeJournal() }()
+		}
+	}
+
+	res, err = organizer.Run(ctx, r.src.path, r.dst.path, cfg.organizerOptions()...)
+	if ctx.Err() != nil && err != nil {
+		// Interrupted by shutdown.
+		return nil
+	}
+	for _, w := range res.Warnings {
+		r.log("warning: %s", w)
+	}
+	for _, hookErr := range res.HookErrors {
+		r.log("warning: %v", hookErr)
+	}
+	run := summarizeRun("watch", cfg.execute, started, res, err == nil)
+	r.log("%s", notifySummary(run, r.src.name, r.dst.name, res, err).Text)
+	if err != nil {
+		return r.retry(changed)
+	}
+
+	// Files organized by an earlier run are skipped as identical on every run; only news is reported.
+	news := res
+	news.Decisions = slices.DeleteFunc(slices.Clone(res.Decisions), func(d reconcile.Decision) bool {
+		return d.Action == reconcile.ActionSkippedIdentical
+	})
+	if r.jsonOutput {
+		if err := printNDJSONDecisions(r.cmd, news); err != nil {
+			r.log("warning: %v", err)
+		}
+	} else {
+		printDecisionLines(r.cmd, news)
+	}
+
+	var incomplete []string
+	for _, d := range res.Decisions {
+		switch errcode.Of(d.Error) {
+		case errcode.EmptyFile, errcode.Truncated, errcode.SourceChanged:
+			incomplete = append(incomplete, d.SourcePath)
+		default:
+			delete(r.attempts, d.SourcePath)
+		}
+	}
+	return r.retry(incomplete)
+}
+
+// retry counts a failed attempt of each of paths and returns those with attempts left.
+func (r *watchRunner) retry(paths []string) []string {
+	var left []string
+	for _, p := range paths {
+		r.attempts[p]++
+		if r.attempts[p] > r.retries {
+			r.log("giving up on %s after %d attempts", p, r.attempts[p])
+			delete(r.attempts, p)
+			continue
+		}
+		left = append(left, p)
+	}
+	return left
+}
+
+// log writes a timestamped line to stderr.
+func (r *watchRunner) log(format string, args ...any) {
+	r.cmd.PrintErrf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// printNDJSONDecisions writes the decisions of res in the format of --json, one object per line.
+func printNDJSONDecisions(cmd *cobra.Command, res organizer.Result) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	for _, op := range jsonDecisions(res) {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// Package ctxio makes long reads stop when their context is canceled.
+package ctxio
+
+import (
+	"context"
+	"io"
+)
+
+// NewReader returns a reader that reads from r until ctx is done, after which every Read
+// returns the context's error.
+func NewReader(ctx context.Context, r io.Reader) io.Reader {
+	return reader{ctx: ctx, r: r}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c reader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,149 @@
+// Package testjpeg builds minimal JPEG files for tests.
+package testjpeg
+
+import "encoding/binary"
+
+// Segment returns a JPEG marker segment with marker and payload.
+func Segment(marker byte, payload []byte) []byte {
+	data := binary.BigEndian.AppendUint16([]byte{0xFF, marker}, uint16(len(payload)+2))
+	return append(data, payload...)
+}
+
+// JPEG returns a JPEG with the segments between its start and end markers.
+func JPEG(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, s := range segments {
+		data = append(data, s...)
+	}
+	return append(data, 0xFF, 0xD9)
+}
+
+// Entry is a tag of a TIFF directory with its type, count and big-endian value.
+type Entry struct {
+	Tag, Type uint16
+	Count     uint32
+	Value     []byte
+}
+
+// ASCII returns an ASCII entry of s.
+func ASCII(tag uint16, s string) Entry {
+	return Entry{Tag: tag, Type: 2, Count: uint32(len(s) + 1), Value: append([]byte(s), 0)}
+}
+
+// Short returns a SHORT entry of v.
+func Short(tag, v uint16) Entry {
+	return Entry{Tag: tag, Type: 3, Count: 1, Value: binary.BigEndian.AppendUint16(nil, v)}
+}
+
+// Long returns a LONG entry of v.
+func Long(tag uint16, v uint32) Entry {
+	return Entry{Tag: tag, Type: 4, Count: 1, Value: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+// Rational returns a RATIONAL entry of whole numbers.
+func Rational(tag uint16, values ...uint32) Entry {
+	e := Entry{Tag: tag, Type: 5, Count: uint32(len(values))}
+	for _, v := range values {
+		e.Value = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(e.Value, v), 1)
+	}
+	return e
+}
+
+// EXIF returns an APP1 segment of a big-endian TIFF whose IFD0 holds ifd0 and, when they are not nil,
+// pointers to an EXIF sub-IFD holding exif and a GPS sub-IFD holding gps.
+func EXIF(ifd0, exif, gps []Entry) []byte {
+	// The sub-IFDs follow IFD0 in order, so their offsets follow from the sizes of the directories before.
+	ifd0 = append([]Entry{}, ifd0...)
+	pointers := 0
+	if exif != nil {
+		pointers++
+	}
+	if gps != nil {
+		pointers++
+	}
+	offset := 8 + ifdSize(ifd0) + uint32(12*pointers)
+	if exif != nil {
+		ifd0 = append(ifd0, Long(0x8769, offset))
+		offset += ifdSize(exif)
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, Long(0x8825, offset))
+	}
+
+	tiff := appendIFD([]byte{'M', 'M', 0, 42, 0, 0, 0, 8}, ifd0)
+	if exif != nil {
+		tiff = appendIFD(tiff, exif)
+	}
+	if gps != nil {
+		tiff = appendIFD(tiff, gps)
+	}
+	return Segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// WithEXIF returns a JPEG whose only segment is the EXIF block of [EXIF].
+func WithEXIF(ifd0, exif, gps []Entry) []byte {
+	return JPEG(EXIF(ifd0, exif, gps))
+}
+
+// WithCamera returns a minimal JPEG whose EXIF block holds only the Make and Model tags.
+func WithCamera(maker, model string) []byte {
+	return WithEXIF([]Entry{ASCII(0x010F, maker), ASCII(0x0110, model)}, nil, nil)
+}
+
+// WithGPS returns a minimal JPEG whose EXIF block holds only a GPS position of degrees, minutes and
+// seconds in tenths, with refs like 'N' and 'E'.
+func WithGPS(latRef byte, lat [3]uint32, lonRef byte, lon [3]uint32) []byte {
+	dms := func(tag uint16, v [3]uint32) Entry {
+		e := Entry{Tag: tag, Type: 5, Count: 3}
+		for i, den := range [3]uint32{1, 1, 10} {
+			e.Value = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(e.Value, v[i]), den)
+		}
+		return e
+	}
+	gps := []Entry{ASCII(0x0001, string(latRef)), dms(0x0002, lat), ASCII(0x0003, string(lonRef)), dms(0x0004, lon)}
+	return WithEXIF(nil, nil, gps)
+}
+
+// WithThumbnail returns a minimal JPEG whose EXIF block holds only thumb, as the thumbnail in IFD1.
+func WithThumbnail(thumb []byte) []byte {
+	// IFD0 is empty and links to IFD1, whose entries point at thumb right after it.
+	tiff := appendIFD([]byte{'M', 'M', 0, 42, 0, 0, 0, 8}, nil)
+	binary.BigEndian.PutUint32(tiff[len(tiff)-4:], uint32(len(tiff)))
+	ifd1 := []Entry{Long(0x0201, 0), Long(0x0202, uint32(len(thumb)))}
+	ifd1[0] = Long(0x0201, uint32(len(tiff))+ifdSize(ifd1))
+	tiff = append(appendIFD(tiff, ifd1), thumb...)
+	return JPEG(Segment(0xE1, append([]byte("Exif\x00\x00"), tiff...)))
+}
+
+// ifdSize returns the size of a TIFF directory of entries with the values that do not fit an entry.
+func ifdSize(entries []Entry) uint32 {
+	n := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.Value) > 4 {
+			n += uint32(len(e.Value))
+		}
+	}
+	return n
+}
+
+// appendIFD appends a TIFF directory of entries to tiff, followed by the values that do not fit an entry.
+func appendIFD(tiff []byte, entries []Entry) []byte {
+	bo := binary.BigEndian
+	values := uint32(len(tiff) + 2 + 12*len(entries) + 4)
+	tiff = bo.AppendUint16(tiff, uint16(len(entries)))
+	var data []byte
+	for _, e := range entries {
+		tiff = bo.AppendUint16(tiff, e.Tag)
+		tiff = bo.AppendUint16(tiff, e.Type)
+		tiff = bo.AppendUint32(tiff, e.Count)
+		if len(e.Value) <= 4 {
+			tiff = append(tiff, e.Value...)
+			tiff = append(tiff, make([]byte, 4-len(e.Value))...)
+			continue
+		}
+		tiff = bo.AppendUint32(tiff, values+uint32(len(data)))
+		data = append(data, e.Value...)
+	}
+	tiff = bo.AppendUint32(tiff, 0)
+	return append(tiff, data...)
+}
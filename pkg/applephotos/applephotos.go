@@ -0,0 +1,245 @@
+// Package applephotos reads Apple Photos libraries (.photoslibrary bundles) so their originals can be
+// organized directly, with the dates, albums and favorites recorded in Photos.sqlite, instead of
+// going through a lossy export.
+//
+// Libraries of Photos 5 (macOS 10.15) and later are supported. Originals that are only stored in
+// iCloud ("Optimize Mac Storage") are listed but have no local file.
+package applephotos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// BundleExt is the extension of an Apple Photos library bundle.
+const BundleExt = ".photoslibrary"
+
+// DatabasePath is the bundle-relative path of the library database.
+const DatabasePath = "database/Photos.sqlite"
+
+// coreDataEpoch is the reference date of Core Data timestamps.
+var coreDataEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Asset is a photo or video of the library.
+type Asset struct {
+	// Path is the bundle-relative, slash-separated path of the original.
+	Path string
+
+	// OriginalFilename is the name of the file when it was imported, e.g. IMG_1234.HEIC.
+	OriginalFilename string
+
+	// CreatedAt is the date shown in Photos, including adjustments made there.
+	CreatedAt time.Time
+
+	// Favorite reports whether the asset is marked as favorite.
+	Favorite bool
+
+	// Albums holds the titles of the user albums containing the asset, sorted.
+	Albums []string
+}
+
+// IsLibrary reports whether dir is an Apple Photos library bundle.
+func IsLibrary(dir string) bool {
+	if !strings.EqualFold(filepath.Ext(strings.TrimRight(dir, `/\`)), BundleExt) {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(DatabasePath)))
+	return err == nil && !info.IsDir()
+}
+
+// ReadAssets returns the assets of the library bundle, in database order. Trashed assets are left out.
+func ReadAssets(ctx context.Context, bundle string) ([]Asset, error) {
+	dbPath := filepath.Join(bundle, filepath.FromSlash(DatabasePath))
+	// Read-only, so a library open in Photos is never modified.
+	dsn := "file:" + (&url.URL{Path: dbPath}).EscapedPath() + "?mode=ro"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dbPath, err)
+	}
+	defer db.Close()
+
+	assetTable, err := assetTableName(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	albums, err := readAlbums(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT a.Z_PK, a.ZDIRECTORY, a.ZFILENAME, a.ZDATECREATED, COALESCE(a.ZFAVORITE, 0),
+		       COALESCE(attr.ZORIGINALFILENAME, '')
+		FROM %s a
+		LEFT JOIN ZADDITIONALASSETATTRIBUTES attr ON attr.ZASSET = a.Z_PK
+		WHERE COALESCE(a.ZTRASHEDSTATE, 0) = 0
+		ORDER BY a.Z_PK`, assetTable)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("read assets: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []Asset
+	for rows.Next() {
+		var (
+			pk           int64
+			dir, name    sql.NullString
+			created      sql.NullFloat64
+			favorite     int64
+			originalName string
+		)
+		if err := rows.Scan(&pk, &dir, &name, &created, &favorite, &originalName); err != nil {
+			return nil, fmt.Errorf("read assets: %w", err)
+		}
+		if !name.Valid || name.String == "" {
+			continue
+		}
+		a := Asset{
+			Path:             path.Join("originals", dir.String, name.String),
+			OriginalFilename: originalName,
+			Favorite:         favorite != 0,
+			Albums:           albums[pk],
+		}
+		if a.OriginalFilename == "" {
+			a.OriginalFilename = name.String
+		}
+		if created.Valid {
+			a.CreatedAt = coreDataEpoch.Add(time.Duration(created.Float64 * float64(time.Second)))
+		}
+		assets = append(assets, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read assets: %w", err)
+	}
+	return assets, nil
+}
+
+// assetTableName returns the asset table, which was renamed from ZGENERICASSET to ZASSET in Photos 6.
+func assetTableName(ctx context.Context, db *sql.DB) (string, error) {
+	for _, name := range []string{"ZASSET", "ZGENERICASSET"} {
+		ok, err := tableExists(ctx, db, name)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported Photos library: no asset table")
+}
+
+func tableExists(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("read schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// reJoinColumn matches the columns of the album-asset join table, e.g. Z_26ALBUMS and Z_3ASSETS.
+var reJoinColumn = regexp.MustCompile(`^Z_\d+(ALBUMS|ASSETS)$`)
+
+// readAlbums returns the sorted user album titles per asset primary key.
+//
+// The join table and its columns are numbered by entity (e.g. Z_26ASSETS with Z_26ALBUMS and Z_3ASSETS)
+// and the numbers differ between Photos versions, so they are looked up in the schema.
+func readAlbums(ctx context.Context, db *sql.DB) (map[int64][]string, error) {
+	albums := make(map[int64][]string)
+	if ok, err := tableExists(ctx, db, "ZGENERICALBUM"); err != nil || !ok {
+		return albums, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name GLOB 'Z_[0-9]*ASSETS'`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("read schema: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		albumCol, assetCol, err := joinColumns(ctx, db, table)
+		if err != nil {
+			return nil, err
+		}
+		if albumCol == "" || assetCol == "" {
+			continue
+		}
+
+		// ZKIND 2 is a user album; smart albums, shared streams and folders are left out.
+		query := fmt.Sprintf(`
+			SELECT j.%s, al.ZTITLE
+			FROM %s j JOIN ZGENERICALBUM al ON al.Z_PK = j.%s
+			WHERE al.ZKIND = 2 AND COALESCE(al.ZTRASHEDSTATE, 0) = 0 AND COALESCE(al.ZTITLE, '') <> ''`,
+			assetCol, table, albumCol)
+		albumRows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("read albums: %w", err)
+		}
+		for albumRows.Next() {
+			var pk int64
+			var title string
+			if err := albumRows.Scan(&pk, &title); err != nil {
+				albumRows.Close()
+				return nil, fmt.Errorf("read albums: %w", err)
+			}
+			albums[pk] = append(albums[pk], title)
+		}
+		err = albumRows.Err()
+		albumRows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read albums: %w", err)
+		}
+	}
+
+	for pk := range albums {
+		sort.Strings(albums[pk])
+	}
+	return albums, nil
+}
+
+// joinColumns returns the album and asset columns of an album-asset join table, or empty strings
+// for other Z_nASSETS tables (e.g. keyword or moment joins).
+func joinColumns(ctx context.Context, db *sql.DB, table string) (albumCol, assetCol string, err error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return "", "", fmt.Errorf("read schema of %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return "", "", fmt.Errorf("read schema of %s: %w", table, err)
+		}
+		m := reJoinColumn.FindStringSubmatch(col)
+		switch {
+		case m == nil:
+		case m[1] == "ALBUMS":
+			albumCol = col
+		default:
+			assetCol = col
+		}
+	}
+	return albumCol, assetCol, rows.Err()
+}
@@ -0,0 +1,104 @@
+package applephotos
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// schema is the subset of a Photos 8 database read by this package.
+const schema = `
+CREATE TABLE ZASSET (Z_PK INTEGER PRIMARY KEY, ZUUID VARCHAR, ZDIRECTORY VARCHAR, ZFILENAME VARCHAR,
+	ZDATECREATED TIMESTAMP, ZFAVORITE INTEGER, ZTRASHEDSTATE INTEGER);
+CREATE TABLE ZADDITIONALASSETATTRIBUTES (Z_PK INTEGER PRIMARY KEY, ZASSET INTEGER, ZORIGINALFILENAME VARCHAR);
+CREATE TABLE ZGENERICALBUM (Z_PK INTEGER PRIMARY KEY, ZKIND INTEGER, ZTITLE VARCHAR, ZTRASHEDSTATE INTEGER);
+CREATE TABLE Z_28ASSETS (Z_28ALBUMS INTEGER, Z_3ASSETS INTEGER, Z_FOK_3ASSETS INTEGER);
+CREATE TABLE Z_31ASSETS (Z_31KEYWORDS INTEGER, Z_3ASSETS INTEGER);
+
+INSERT INTO ZASSET VALUES
+	(1, 'U1', 'A', 'A1B2.heic', 700000000.5, 1, 0),
+	(2, 'U2', '0', '0C3D.mov', 700003600, 0, 0),
+	(3, 'U3', 'F', 'F4E5.jpg', 700007200, 0, 1);
+INSERT INTO ZADDITIONALASSETATTRIBUTES VALUES (10, 1, 'IMG_0001.HEIC'), (11, 3, 'IMG_0003.JPG');
+INSERT INTO ZGENERICALBUM VALUES
+	(20, 2, 'Vacation', 0),
+	(21, 2, 'Best of', 0),
+	(22, 1507, 'Smart Album', 0),
+	(23, 2, 'Deleted', 1);
+INSERT INTO Z_28ASSETS VALUES (20, 1, 1), (21, 1, 1), (22, 2, 1), (23, 2, 1);
+`
+
+func newLibrary(t *testing.T) string {
+	t.Helper()
+	bundle := filepath.Join(t.TempDir(), "Photos Library.photoslibrary")
+	if err := os.MkdirAll(filepath.Join(bundle, "database"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(bundle, filepath.FromSlash(DatabasePath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestIsLibrary(t *testing.T) {
+	bundle := newLibrary(t)
+	if !IsLibrary(bundle) {
+		t.Errorf("IsLibrary(%s) = false", bundle)
+	}
+	if IsLibrary(filepath.Dir(bundle)) {
+		t.Errorf("IsLibrary of a plain directory = true")
+	}
+	empty := filepath.Join(t.TempDir(), "Empty.photoslibrary")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if IsLibrary(empty) {
+		t.Errorf("IsLibrary of a bundle without database = true")
+	}
+}
+
+func TestReadAssets(t *testing.T) {
+	bundle := newLibrary(t)
+
+	assets, err := ReadAssets(context.Background(), bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Asset{
+		{
+			Path:             "originals/A/A1B2.heic",
+			OriginalFilename: "IMG_0001.HEIC",
+			CreatedAt:        time.Date(2023, 3, 8, 20, 26, 40, 500_000_000, time.UTC),
+			Favorite:         true,
+			Albums:           []string{"Best of", "Vacation"},
+		},
+		{
+			// No additional attributes: the stored name is used.
+			Path:             "originals/0/0C3D.mov",
+			OriginalFilename: "0C3D.mov",
+			CreatedAt:        time.Date(2023, 3, 8, 21, 26, 40, 0, time.UTC),
+		},
+	}
+	for i := range assets {
+		assets[i].CreatedAt = assets[i].CreatedAt.UTC()
+	}
+	if !reflect.DeepEqual(assets, want) {
+		t.Errorf("got %+v\nwant %+v", assets, want)
+	}
+}
+
+func TestReadAssets_MissingDatabase(t *testing.T) {
+	if _, err := ReadAssets(context.Background(), t.TempDir()); err == nil {
+		t.Errorf("expected an error for a directory without database")
+	}
+}
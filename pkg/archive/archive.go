@@ -0,0 +1,496 @@
+// Package archive writes organized files into tar or zip archives, one per year or month, instead of
+// loose files: for cold storage of old years, where one object per period is cheaper to keep and
+// restore than thousands of small ones.
+//
+// Copies are streamed into the archive as they are read. Each archive ends with an index (IndexName)
+// listing its members with their size, SHA-256 and created_at, so an archive can be checked and
+// searched without the catalog that made it.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/internal/ctxio"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+// IndexName is the name of the index member written last into every archive.
+const IndexName = "media-organizer-index.json"
+
+// UnknownName is the period name of files without a known date.
+const UnknownName = "unknown"
+
+// Format is the container format of archives.
+type Format string
+
+// Archive formats.
+const (
+	FormatTar Format = "tar"
+	FormatZip Format = "zip"
+)
+
+// ParseFormat parses an archive format: tar or zip.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatTar, FormatZip:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q (want tar or zip)", s)
+}
+
+// Ext returns the file extension of archives of format f, with the dot.
+func (f Format) Ext() string { return "." + string(f) }
+
+// Period is the span of time an archive holds.
+type Period string
+
+// Archive periods.
+const (
+	PeriodYear  Period = "year"
+	PeriodMonth Period = "month"
+)
+
+// ParsePeriod parses an archive period: year or month.
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(strings.ToLower(s)); p {
+	case PeriodYear, PeriodMonth:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown archive period %q (want year or month)", s)
+}
+
+// Name returns the name of the archive of period p holding t, such as 2024 or 2024-07.
+// The zero time is UnknownName.
+func (p Period) Name(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return UnknownName
+	case p == PeriodMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006")
+}
+
+// IndexEntry describes a member of an archive.
+type IndexEntry struct {
+	// Name is the slash-separated path of the member in the archive.
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// SourcePath is the file the member was copied from; empty for generated sidecars.
+	SourcePath string `json:"source_path,omitempty"`
+}
+
+// Writer writes one archive. It is not safe for concurrent use.
+type Writer struct {
+	fsys destfs.FS
+	path string
+	f    destfs.File
+	tar  *tar.Writer
+	zip  *zip.Writer
+}
+
+// Create creates the archive at path of fsys, failing with fs.ErrExist when it exists.
+func Create(fsys destfs.FS, path string, format Format) (*Writer, error) {
+	fsys = destfs.OrOS(fsys)
+	f, err := fsys.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{fsys: fsys, path: path, f: f}
+	switch format {
+	case FormatTar:
+		w.tar = tar.NewWriter(f)
+	case FormatZip:
+		w.zip = zip.NewWriter(f)
+	default:
+		f.Close()
+		fsys.Remove(path)
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+	return w, nil
+}
+
+// Add writes a member of size bytes read from r. A read that ends early, or a failed write, leaves the
+// archive unusable: Abort it.
+func (w *Writer) Add(name string, r io.Reader, size int64, modTime time.Time) (IndexEntry, error) {
+	h := sha256.New()
+	var dst io.Writer
+	switch {
+	case w.tar != nil:
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: modTime, Format: tar.FormatPAX}
+		if err := w.tar.WriteHeader(hdr); err != nil {
+			return IndexEntry{}, err
+		}
+		dst = w.tar
+	default:
+		// Media is compressed already.
+		hdr := &zip.FileHeader{Name: name, Method: zip.Store, Modified: modTime}
+		hdr.SetMode(0o644)
+		zw, err := w.zip.CreateHeader(hdr)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+		dst = zw
+	}
+	n, err := io.Copy(io.MultiWriter(dst, h), r)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	if n != size {
+		return IndexEntry{}, fmt.Errorf("%s: read %d bytes, expected %d", name, n, size)
+	}
+	return IndexEntry{Name: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Close writes index as the last member, IndexName, and finishes the archive. An archive that cannot
+// be finished is removed.
+func (w *Writer) Close(index []IndexEntry) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := w.Add(IndexName, bytes.NewReader(data), int64(len(data)), time.Now()); err != nil {
+		w.Abort()
+		return err
+	}
+	if w.tar != nil {
+		err = w.tar.Close()
+	} else {
+		err = w.zip.Close()
+	}
+	if err == nil {
+		err = w.f.Sync()
+	}
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		w.fsys.Remove(w.path)
+	}
+	return err
+}
+
+// Abort closes and removes the unfinished archive.
+func (w *Writer) Abort() {
+	w.f.Close()
+	w.fsys.Remove(w.path)
+}
+
+// ReadIndex reads the index of the archive at path of fsys.
+func ReadIndex(fsys destfs.FS, path string) ([]IndexEntry, error) {
+	f, err := destfs.OrOS(fsys).Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var index io.Reader
+	switch strings.ToLower(filepath.Ext(path)) {
+	case FormatZip.Ext():
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		m, err := zr.Open(IndexName)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		defer m.Close()
+		index = m
+	default:
+		tr := tar.NewReader(f)
+		for index == nil {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil, fmt.Errorf("read %s: no %s: %w", path, IndexName, fs.ErrNotExist)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", path, err)
+			}
+			if hdr.Name == IndexName {
+				index = tr
+			}
+		}
+	}
+	var entries []IndexEntry
+	if err := json.NewDecoder(index).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("read %s index: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Split returns the archive and member name of a path planned into an archive below root:
+// <root>/<archive>/<member>.
+func Split(root, p string) (archive, member string, err error) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return "", "", err
+	}
+	name, member, ok := strings.Cut(filepath.ToSlash(rel), "/")
+	if !ok || name == ".." {
+		return "", "", fmt.Errorf("%s is not in an archive below %s", p, root)
+	}
+	return filepath.Join(root, name), member, nil
+}
+
+// Options configures Execute.
+type Options struct {
+	Format Format
+
+	// Root is the directory the archives are written to; planned destinations are <Root>/<archive>/<member>.
+	Root string
+
+	// Checksum sets Result.SHA256 to the SHA-256 of the source content.
+	Checksum bool
+
+	// Source and Destination are the filesystems files are read from and archives written to;
+	// nil means the local filesystem.
+	Source      destfs.FS
+	Destination destfs.FS
+
+	// CreatedAt returns the created_at recorded for a source in the index.
+	CreatedAt func(source string) time.Time
+
+	// OnStart and OnResult are called like those of copy.Options. The results of the files of an
+	// archive are reported once the archive is complete.
+	OnStart  func(op plan.Operation)
+	OnResult func(done int, r copy.Result)
+}
+
+// Execute writes the sources of operations, with their sidecars, into the archives their destinations
+// are planned in. An operation that cannot be read fails on its own; a failure while an archive is
+// written fails all its operations and removes it. When ctx is canceled, the archive being written is
+// removed and Execute returns the results of the archives finished so far together with ctx.Err().
+func Execute(ctx context.Context, operations []plan.Operation, opts Options) ([]copy.Result, error) {
+	results := make([]copy.Result, 0, len(operations))
+	report := func(r copy.Result) {
+		results = append(results, r)
+		if opts.OnResult != nil {
+			opts.OnResult(len(results), r)
+		}
+	}
+	var order []string
+	byArchive := make(map[string][]plan.Operation)
+	for _, op := range operations {
+		archive, _, err := Split(opts.Root, op.DestinationPath)
+		if err != nil {
+			report(copy.Result{Operation: op, Error: err})
+			continue
+		}
+		if _, ok := byArchive[archive]; !ok {
+			order = append(order, archive)
+		}
+		byArchive[archive] = append(byArchive[archive], op)
+	}
+
+	for _, archive := range order {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		archiveResults := writeArchive(ctx, archive, byArchive[archive], opts)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		for _, r := range archiveResults {
+			report(r)
+		}
+	}
+	return results, nil
+}
+
+// writeArchive writes ops into a new archive and returns their results.
+func writeArchive(ctx context.Context, archive string, ops []plan.Operation, opts Options) []copy.Result {
+	results := make([]copy.Result, 0, len(ops))
+	// fail fails every operation not failed on its own: none of them is in an archive.
+	fail := func(err error) []copy.Result {
+		if !errors.Is(err, copy.ErrDestinationExists) {
+			err = errcode.Wrap(errcode.WriteFailed, fmt.Errorf("write %s: %w", archive, err))
+		}
+		for i := range results {
+			if results[i].Success {
+				results[i] = copy.Result{Operation: results[i].Operation, Error: err}
+			}
+		}
+		for _, op := range ops[len(results):] {
+			results = append(results, copy.Result{Operation: op, Error: err})
+		}
+		return results
+	}
+
+	dst := destfs.OrOS(opts.Destination)
+	if err := dst.MkdirAll(filepath.Dir(archive), 0o755); err != nil {
+		return fail(fmt.Errorf("create directory: %w", err))
+	}
+	w, err := Create(dst, archive, opts.Format)
+	if errors.Is(err, fs.ErrExist) {
+		return fail(copy.ErrDestinationExists)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	var index []IndexEntry
+	for _, op := range ops {
+		if opts.OnStart != nil {
+			opts.OnStart(op)
+		}
+		r, entries, err := addOperation(ctx, w, archive, op, opts)
+		if err != nil {
+			// The archive holds a partial member.
+			w.Abort()
+			return fail(err)
+		}
+		index = append(index, entries...)
+		results = append(results, r)
+	}
+	if err := w.Close(index); err != nil {
+		return fail(err)
+	}
+	return results
+}
+
+// member is the content of a member to be written.
+type member struct {
+	name    string
+	source  string
+	r       io.Reader
+	size    int64
+	modTime time.Time
+	close   func()
+}
+
+// addOperation adds the source of op and its sidecars to w. Every file is opened before anything is
+// written, so a file that cannot be read fails only op, in the result. A returned error leaves w
+// unusable.
+func addOperation(ctx context.Context, w *Writer, archive string, op plan.Operation, opts Options) (copy.Result, []IndexEntry, error) {
+	result := copy.Result{Operation: op}
+	var sum hash.Hash
+	if opts.Checksum {
+		sum = sha256.New()
+	}
+
+	if err := copy.CheckSource(opts.Source, op); err != nil {
+		result.Error = err
+		return result, nil, nil
+	}
+
+	var members []member
+	defer func() {
+		for _, m := range members {
+			m.close()
+		}
+	}()
+	for i, o := range append([]plan.Operation{op}, op.Sidecars...) {
+		var h hash.Hash
+		if i == 0 {
+			h = sum
+		}
+		m, err := openMember(ctx, opts.Source, o, h)
+		if err != nil {
+			if i > 0 {
+				err = fmt.Errorf("sidecar %s: %w", o.SourcePath, err)
+			}
+			result.Error = err
+			return result, nil, nil
+		}
+		m.name = memberName(archive, o.DestinationPath)
+		members = append(members, m)
+	}
+
+	var createdAt time.Time
+	if opts.CreatedAt != nil {
+		createdAt = opts.CreatedAt(op.SourcePath)
+	}
+	entries := make([]IndexEntry, 0, len(members))
+	for _, m := range members {
+		e, err := w.Add(m.name, m.r, m.size, m.modTime)
+		if err != nil {
+			return result, nil, err
+		}
+		e.CreatedAt, e.SourcePath = createdAt, m.source
+		entries = append(entries, e)
+	}
+	result.Success = true
+	if sum != nil {
+		result.SHA256 = hex.EncodeToString(sum.Sum(nil))
+		result.DestinationSHA256 = entries[0].SHA256
+	}
+	return result, entries, nil
+}
+
+// memberName returns the member name of a destination planned into archive.
+func memberName(archive, dest string) string {
+	if rel, err := filepath.Rel(archive, dest); err == nil {
+		return path.Clean(filepath.ToSlash(rel))
+	}
+	return filepath.Base(dest)
+}
+
+// openMember opens the content of op: its generated Content, or its source, transformed when op has a
+// Transform. sum, when set, receives the source content as it is read.
+func openMember(ctx context.Context, fsys destfs.FS, op plan.Operation, sum hash.Hash) (member, error) {
+	if op.Content != nil {
+		return member{r: bytes.NewReader(op.Content), size: int64(len(op.Content)), modTime: time.Now(), close: func() {}}, nil
+	}
+	src := op.SourcePath
+	f, err := destfs.OrOS(fsys).Open(src)
+	if err != nil {
+		return member{}, &errcode.FileError{Op: "open source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return member{}, &errcode.FileError{Op: "stat source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	m := member{source: src, size: info.Size(), modTime: info.ModTime(), close: func() { f.Close() }}
+	if !op.CreatedAt.IsZero() {
+		m.modTime = op.CreatedAt
+	}
+	m.r = ctxio.NewReader(ctx, f)
+	if sum != nil {
+		m.r = io.TeeReader(m.r, sum)
+	}
+	if op.Transform == nil {
+		return m, nil
+	}
+	// A transform needs the whole content, and the archive its size up front.
+	data, err := io.ReadAll(m.r)
+	f.Close()
+	m.close = func() {}
+	if err != nil {
+		return member{}, &errcode.FileError{Op: "read source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if data, err = op.Transform(data); err != nil {
+		return member{}, fmt.Errorf("transform %s: %w", src, err)
+	}
+	m.r, m.size = bytes.NewReader(data), int64(len(data))
+	return m, nil
+}
@@ -0,0 +1,178 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+func writeSource(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// members returns the content of the members of the archive at path.
+func members(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	if filepath.Ext(path) == FormatZip.Ext() {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("open zip: %v", err)
+		}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(r)
+			r.Close()
+			got[f.Name] = string(content)
+		}
+		return got
+	}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(content)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	for _, format := range []Format{FormatTar, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			a := writeSource(t, src, "a.jpg", "aaa")
+			xmp := writeSource(t, src, "a.jpg.xmp", "<xmp/>")
+			b := writeSource(t, src, "b.jpg", "bb")
+			c := writeSource(t, src, "c.jpg", "c")
+			y2023, y2024 := filepath.Join(dst, "2023"+format.Ext()), filepath.Join(dst, "2024"+format.Ext())
+			created := time.Date(2024, 7, 14, 10, 0, 0, 0, time.UTC)
+			ops := []plan.Operation{
+				{SourcePath: a, DestinationPath: filepath.Join(y2024, "2024", "07", "14", "a.jpg"), Sidecars: []plan.Operation{
+					{SourcePath: xmp, DestinationPath: filepath.Join(y2024, "2024", "07", "14", "a.jpg.xmp")},
+					{DestinationPath: filepath.Join(y2024, "2024", "07", "14", "a.jpg.txt"), Content: []byte("note")},
+				}},
+				{SourcePath: filepath.Join(src, "missing.jpg"), DestinationPath: filepath.Join(y2024, "2024", "07", "14", "missing.jpg")},
+				{SourcePath: b, DestinationPath: filepath.Join(y2023, "2023", "01", "02", "b.jpg"), Transform: func(data []byte) ([]byte, error) {
+					return append(data, "-rewritten"...), nil
+				}},
+				{SourcePath: c, DestinationPath: filepath.Join(dst, "c.jpg")},
+			}
+
+			results, err := Execute(context.Background(), ops, Options{
+				Format: format, Root: dst, Checksum: true,
+				CreatedAt: func(string) time.Time { return created },
+			})
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			bySource := make(map[string]copy.Result)
+			for _, r := range results {
+				bySource[r.Operation.SourcePath] = r
+			}
+			if len(results) != 4 || !bySource[a].Success || !bySource[b].Success || bySource[filepath.Join(src, "missing.jpg")].Success || bySource[c].Success {
+				t.Fatalf("unexpected results: %+v", results)
+			}
+			if r := bySource[b]; r.SHA256 == r.DestinationSHA256 || r.SHA256 == "" {
+				t.Errorf("expected the checksums of the source and the rewritten member, got %+v", r)
+			}
+
+			got := members(t, y2024)
+			for name, want := range map[string]string{"2024/07/14/a.jpg": "aaa", "2024/07/14/a.jpg.xmp": "<xmp/>", "2024/07/14/a.jpg.txt": "note"} {
+				if got[name] != want {
+					t.Errorf("member %s = %q, want %q", name, got[name], want)
+				}
+			}
+			if _, ok := got["2024/07/14/missing.jpg"]; ok {
+				t.Errorf("the unreadable file is in the archive")
+			}
+			if got := members(t, y2023)["2023/01/02/b.jpg"]; got != "bb-rewritten" {
+				t.Errorf("expected the transformed content, got %q", got)
+			}
+
+			index, err := ReadIndex(nil, y2024)
+			if err != nil {
+				t.Fatalf("ReadIndex: %v", err)
+			}
+			if len(index) != 3 || index[0].Name != "2024/07/14/a.jpg" || index[0].Size != 3 || index[0].SourcePath != a || !index[0].CreatedAt.Equal(created) || index[0].SHA256 != bySource[a].SHA256 {
+				t.Errorf("unexpected index: %+v", index)
+			}
+
+			// An archive is never appended to.
+			results, err = Execute(context.Background(), ops[:1], Options{Format: format, Root: dst})
+			if err != nil || results[0].Success || !errors.Is(results[0].Error, copy.ErrDestinationExists) {
+				t.Errorf("expected an existing archive to fail, got %+v, %v", results, err)
+			}
+		})
+	}
+}
+
+func TestExecute_ShortReadRemovesArchive(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	a := writeSource(t, src, "a.jpg", "aaa")
+	archive := filepath.Join(dst, "2024.tar")
+	ops := []plan.Operation{
+		{SourcePath: a, DestinationPath: filepath.Join(archive, "a.jpg")},
+		{SourcePath: a, DestinationPath: filepath.Join(archive, "b.jpg"), Sidecars: []plan.Operation{
+			// A directory opens, but cannot be read.
+			{SourcePath: src, DestinationPath: filepath.Join(archive, "b.jpg.xmp")},
+		}},
+	}
+	results, err := Execute(context.Background(), ops, Options{Format: FormatTar, Root: dst})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, r := range results {
+		if r.Success {
+			t.Errorf("expected every file of the broken archive to fail, got %+v", r)
+		}
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("expected the broken archive to be removed: %v", err)
+	}
+}
+
+func TestPeriodName(t *testing.T) {
+	at := time.Date(2024, 7, 14, 10, 0, 0, 0, time.UTC)
+	if got := PeriodYear.Name(at); got != "2024" {
+		t.Errorf("year: got %q", got)
+	}
+	if got := PeriodMonth.Name(at); got != "2024-07" {
+		t.Errorf("month: got %q", got)
+	}
+	if got := PeriodMonth.Name(time.Time{}); got != UnknownName {
+		t.Errorf("zero time: got %q", got)
+	}
+	if _, err := ParsePeriod("week"); err == nil {
+		t.Errorf("expected an error for an unknown period")
+	}
+	if _, err := ParseFormat("rar"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,280 @@
+// Package bench measures how fast the hardware of a run scans, hashes and copies media files, to tell
+// how long organizing a large library will take before committing to it, and how many files to read at
+// once.
+//
+// Every trial reads files no earlier trial has read, so the page cache does not inflate the results;
+// a source smaller than the samples ends the hash trials early.
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// Options configures Run.
+type Options struct {
+	// Source is the local directory whose media files are scanned, hashed and copied.
+	Source string
+
+	// Destination is the local directory copies are written to, below a temporary directory that is
+	// removed afterwards.
+	Destination string
+
+	// SampleBytes is the amount of data read by each hash trial and written by the copy trial.
+	SampleBytes int64
+
+	// Workers lists the numbers of files hashed at once, one trial each, in order.
+	Workers []int
+}
+
+// DefaultOptions returns the trials of the bench command: 256 MiB samples, hashed by 1, 2, 4 and up
+// to twice the number of CPUs workers at once.
+func DefaultOptions(source, destination string) Options {
+	var workers []int
+	for w := 1; w <= 2*runtime.NumCPU() && w <= 16; w *= 2 {
+		workers = append(workers, w)
+	}
+	return Options{
+		Source:      source,
+		Destination: destination,
+		SampleBytes: 256 << 20,
+		Workers:     workers,
+	}
+}
+
+// Rate is the outcome of a trial: the files and bytes it handled, and how long that took.
+type Rate struct {
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// FilesPerSecond returns the number of files handled per second.
+func (r Rate) FilesPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Files) / r.Duration.Seconds()
+}
+
+// BytesPerSecond returns the number of bytes handled per second.
+func (r Rate) BytesPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Duration.Seconds()
+}
+
+// HashRate is the outcome of a hash trial with a number of workers.
+type HashRate struct {
+	Workers int `json:"workers"`
+	Rate
+}
+
+// Result holds the outcome of the trials of Run.
+type Result struct {
+	// Scan counts the media files of the source and their total size.
+	Scan Rate `json:"scan"`
+
+	// Hash holds the SHA-256 throughput per number of workers.
+	Hash []HashRate `json:"hash"`
+
+	// Copy is the throughput of copying files into the destination, synced to disk.
+	Copy Rate `json:"copy"`
+
+	// SuggestedWorkers is the fewest workers hashing within 10% of the best throughput: beyond it,
+	// reading more files at once only adds contention.
+	SuggestedWorkers int `json:"suggested_workers"`
+
+	// Estimate is how long scanning, hashing and copying every media file of the source takes at the
+	// rates of the first hash trial, a single worker by default, as media-organizer organize reads one
+	// file at a time.
+	Estimate time.Duration `json:"estimate_ns"`
+}
+
+// ErrNoFiles is returned by Run for a source without media files.
+var ErrNoFiles = errors.New("no media files to benchmark")
+
+// Run scans the source, hashes samples of its files with every number of workers of opts, and copies
+// a sample into the destination.
+func Run(ctx context.Context, opts Options) (Result, error) {
+	var res Result
+	start := time.Now()
+	records, err := scan.ScanRecords(ctx, os.DirFS(opts.Source), ".", scan.DefaultOptions())
+	if err != nil {
+		return res, fmt.Errorf("scan %s: %w", opts.Source, err)
+	}
+	res.Scan = Rate{Files: len(records), Duration: time.Since(start)}
+	for _, r := range records {
+		res.Scan.Bytes += r.FileSizeBytes
+	}
+	if len(records) == 0 {
+		return res, ErrNoFiles
+	}
+
+	// Every trial takes the next files, up to SampleBytes.
+	next := 0
+	sample := func() []scan.Record {
+		first := next
+		var size int64
+		for next < len(records) && size < opts.SampleBytes {
+			size += records[next].FileSizeBytes
+			next++
+		}
+		return records[first:next]
+	}
+
+	for _, workers := range opts.Workers {
+		files := sample()
+		if len(files) == 0 {
+			break
+		}
+		rate, err := hashFiles(ctx, opts.Source, files, workers)
+		if err != nil {
+			return res, err
+		}
+		res.Hash = append(res.Hash, HashRate{Workers: workers, Rate: rate})
+	}
+
+	files := sample()
+	if len(files) == 0 {
+		// The hash trials read every file; copying them again reads from the cache, but still
+		// writes to the destination.
+		next = 0
+		files = sample()
+	}
+	if res.Copy, err = copyFiles(ctx, opts.Source, opts.Destination, files); err != nil {
+		return res, err
+	}
+
+	res.SuggestedWorkers = suggestWorkers(res.Hash)
+	var perByte float64
+	if len(res.Hash) > 0 && res.Hash[0].BytesPerSecond() > 0 {
+		perByte += 1 / res.Hash[0].BytesPerSecond()
+	}
+	if res.Copy.BytesPerSecond() > 0 {
+		perByte += 1 / res.Copy.BytesPerSecond()
+	}
+	res.Estimate = res.Scan.Duration + time.Duration(perByte*float64(res.Scan.Bytes)*float64(time.Second))
+	return res, nil
+}
+
+// hashFiles computes the SHA-256 of files, relative to root, with workers files at once.
+func hashFiles(ctx context.Context, root string, files []scan.Record, workers int) (Rate, error) {
+	workers = max(workers, 1)
+	rate := Rate{Files: len(files)}
+	paths := make(chan string)
+	errs := make(chan error, workers)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				n, err := hashFile(p)
+				if err != nil {
+					errs <- err
+					return
+				}
+				mu.Lock()
+				rate.Bytes += n
+				mu.Unlock()
+			}
+		}()
+	}
+	var err error
+send:
+	for _, f := range files {
+		select {
+		case paths <- filepath.Join(root, f.Path):
+		case err = <-errs:
+			break send
+		case <-ctx.Done():
+			err = ctx.Err()
+			break send
+		}
+	}
+	close(paths)
+	wg.Wait()
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	rate.Duration = time.Since(start)
+	return rate, err
+}
+
+// hashFile returns the number of bytes of the file at path, read through SHA-256.
+func hashFile(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := io.Copy(sha256.New(), f)
+	if err != nil {
+		return n, fmt.Errorf("hash %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// copyFiles copies files, relative to root, into a temporary directory of destination, which it removes.
+func copyFiles(ctx context.Context, root, destination string, files []scan.Record) (Rate, error) {
+	if err := os.MkdirAll(destination, 0o755); err != nil {
+		return Rate{}, err
+	}
+	dir, err := os.MkdirTemp(destination, ".media-organizer-bench-")
+	if err != nil {
+		return Rate{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	ops := make([]plan.Operation, 0, len(files))
+	for i, f := range files {
+		// Files of different directories may share a name.
+		dst := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(f.Path)))
+		ops = append(ops, plan.Operation{SourcePath: filepath.Join(root, f.Path), DestinationPath: dst})
+	}
+	start := time.Now()
+	results, err := copy.Execute(ctx, ops, copy.Options{})
+	rate := Rate{Duration: time.Since(start)}
+	if err != nil {
+		return rate, err
+	}
+	for i, r := range results {
+		if !r.Success {
+			return rate, r.Error
+		}
+		rate.Files++
+		rate.Bytes += files[i].FileSizeBytes
+	}
+	return rate, nil
+}
+
+// suggestWorkers returns the fewest workers of rates hashing within 10% of the best throughput.
+func suggestWorkers(rates []HashRate) int {
+	var best float64
+	for _, r := range rates {
+		best = max(best, r.BytesPerSecond())
+	}
+	for _, r := range rates {
+		if r.BytesPerSecond() >= 0.9*best {
+			return r.Workers
+		}
+	}
+	return 1
+}
@@ -0,0 +1,70 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for i := range 8 {
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprintf("IMG_%d.jpg", i)), []byte(strings.Repeat("x", 1000)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "notes.txt"), []byte("not media"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions(src, dst)
+	opts.SampleBytes = 2000
+	opts.Workers = []int{1, 2, 4, 8}
+	res, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Scan.Files != 8 || res.Scan.Bytes != 8000 {
+		t.Errorf("scan: got %+v", res.Scan)
+	}
+	// Four samples of two files each; the 8 workers trial finds no unread files left.
+	if len(res.Hash) != 4 {
+		t.Fatalf("expected 4 hash trials, got %+v", res.Hash)
+	}
+	for _, h := range res.Hash {
+		if h.Files != 2 || h.Bytes != 2000 {
+			t.Errorf("hash with %d workers: got %+v", h.Workers, h.Rate)
+		}
+	}
+	if res.Copy.Files != 2 || res.Copy.Bytes != 2000 {
+		t.Errorf("copy: got %+v", res.Copy)
+	}
+	if res.SuggestedWorkers < 1 || res.Estimate <= 0 {
+		t.Errorf("unexpected suggestion %d and estimate %s", res.SuggestedWorkers, res.Estimate)
+	}
+	if entries, err := os.ReadDir(dst); err != nil || len(entries) != 0 {
+		t.Errorf("expected the copies to be removed, got %v, %v", entries, err)
+	}
+}
+
+func TestRun_NoFiles(t *testing.T) {
+	if _, err := Run(context.Background(), DefaultOptions(t.TempDir(), t.TempDir())); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("expected ErrNoFiles, got %v", err)
+	}
+}
+
+func TestSuggestWorkers(t *testing.T) {
+	rates := []HashRate{
+		{Workers: 1, Rate: Rate{Bytes: 100, Duration: 1e9}},
+		{Workers: 2, Rate: Rate{Bytes: 190, Duration: 1e9}},
+		{Workers: 4, Rate: Rate{Bytes: 200, Duration: 1e9}},
+		{Workers: 8, Rate: Rate{Bytes: 195, Duration: 1e9}},
+	}
+	if got := suggestWorkers(rates); got != 2 {
+		t.Errorf("suggestWorkers = %d, want 2", got)
+	}
+}
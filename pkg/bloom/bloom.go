@@ -0,0 +1,68 @@
+// Package bloom implements a Bloom filter: a set that holds its keys in a few bits each and answers
+// whether a key may have been added, with a bounded rate of false positives and no false negatives.
+// Deduplication uses it to rule out the many files without a duplicate before holding or reading them.
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// Filter is a Bloom filter. Create one with New.
+type Filter struct {
+	bits     []uint64
+	m        uint64
+	k        int
+	n        int
+	seeds    [2]maphash.Seed
+	capacity int
+}
+
+// New returns a filter sized for n keys with a false positive rate of p, such as 0.01. More keys can
+// be added, at a growing false positive rate.
+func New(n int, p float64) *Filter {
+	n = max(n, 1)
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (max(m, 64) + 63) / 64 * 64
+	k := max(int(math.Round(float64(m)/float64(n)*math.Ln2)), 1)
+	return &Filter{
+		bits:     make([]uint64, m/64),
+		m:        m,
+		k:        k,
+		seeds:    [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+		capacity: n,
+	}
+}
+
+// Add adds key to the filter.
+func (f *Filter) Add(key []byte) {
+	h1, h2 := f.hash(key)
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.n++
+}
+
+// Has reports whether key may have been added. A false result is certain.
+func (f *Filter) Has(key []byte) bool {
+	h1, h2 := f.hash(key)
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Full reports whether the filter holds the number of keys it was sized for.
+func (f *Filter) Full() bool {
+	return f.n >= f.capacity
+}
+
+// hash returns the two hashes of key the bit positions are derived from.
+func (f *Filter) hash(key []byte) (uint64, uint64) {
+	// An odd step visits distinct positions for every k below m.
+	return maphash.Bytes(f.seeds[0], key), maphash.Bytes(f.seeds[1], key) | 1
+}
@@ -0,0 +1,48 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func key(i int) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(i))
+}
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := range n {
+		f.Add(key(i))
+	}
+	if !f.Full() {
+		t.Error("expected a full filter")
+	}
+	for i := range n {
+		if !f.Has(key(i)) {
+			t.Fatalf("key %d was added but is missing", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := n; i < 2*n; i++ {
+		if f.Has(key(i)) {
+			falsePositives++
+		}
+	}
+	// 1% of n, with room for chance.
+	if falsePositives > 2*n/100 {
+		t.Errorf("expected about %d false positives, got %d", n/100, falsePositives)
+	}
+}
+
+func TestFilter_Empty(t *testing.T) {
+	f := New(0, 0.01)
+	if f.Has(key(1)) || f.Full() {
+		t.Error("expected an empty filter")
+	}
+	f.Add(key(1))
+	if !f.Has(key(1)) {
+		t.Error("expected the added key")
+	}
+}
@@ -0,0 +1,175 @@
+// Package burst recognizes burst sequences: photos a camera or phone took in rapid succession.
+//
+// A burst is recognized by the names phones give its shots (IMG_20240102_030405_BURST001.jpg,
+// 00000IMG_00000_BURST20240102030405123_COVER.jpg) or, for cameras, by shots of one camera in one
+// directory whose recorded times are at most MaxGap apart.
+package burst
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Policy selects what happens to the shots of a burst.
+type Policy string
+
+const (
+	// PolicyOff does not recognize bursts.
+	PolicyOff Policy = "off"
+	// PolicyGroup keeps the shots of a burst together: they are dated like its first shot and fill {burst}.
+	PolicyGroup Policy = "group"
+	// PolicyBest groups the shots of a burst like PolicyGroup and skips all but the best shot.
+	PolicyBest Policy = "best"
+)
+
+// ParsePolicy converts a CLI value into a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PolicyOff, PolicyGroup, PolicyBest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid burst policy %q (want off, group or best)", s)
+	}
+}
+
+const (
+	// MaxGap is the longest time between two shots of a burst recognized by time.
+	MaxGap = time.Second
+	// MinShots is the number of shots a burst recognized by time has at least.
+	MinShots = 3
+)
+
+// Shot is a photo considered for a burst.
+type Shot struct {
+	Path string
+	// Time is when the shot was taken, with the fraction of a second where it is recorded.
+	Time time.Time
+	// Timed reports whether Time was recorded by the camera; only such shots are grouped by time.
+	Timed bool
+	// Camera names the camera that took the shot; shots of different cameras are no burst.
+	Camera string
+	// Size is the file size in bytes.
+	Size int64
+}
+
+// Burst is a burst sequence among shots.
+type Burst struct {
+	// Name names the burst after the time of its first shot, such as "Burst 2024-01-02 03.04.05".
+	Name string
+	// Shots are the indexes of the shots of the burst, in the order they were taken.
+	Shots []int
+	// Best is the index of the best shot: the cover shot the phone picked, or else the largest file,
+	// which holds the most detail.
+	Best int
+}
+
+var (
+	// rePixel matches the shots of a Pixel burst, "00001IMG_00001_BURST20240102030405123", by its
+	// burst timestamp.
+	rePixel = regexp.MustCompile(`(?i)^\d+IMG_\d+_BURST(\d+)(_COVER)?$`)
+	// reBurst matches the shots of an Android burst, "IMG_20240102_030405_BURST001", by their prefix.
+	reBurst = regexp.MustCompile(`(?i)^(.+)_BURST\d+(_COVER)?$`)
+)
+
+// nameKey returns the key shared by the shots of a burst named like name, whether name is the cover
+// shot, and whether name is the name of a burst shot at all.
+func nameKey(name string) (key string, cover, ok bool) {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if m := rePixel.FindStringSubmatch(stem); m != nil {
+		return m[1], m[2] != "", true
+	}
+	if m := reBurst.FindStringSubmatch(stem); m != nil {
+		return strings.ToLower(m[1]), m[2] != "", true
+	}
+	return "", false, false
+}
+
+// Find returns the bursts among shots, ordered by the index of their first shot. Shots are only
+// grouped with shots in the same directory. Paths use the separator of the OS.
+func Find(shots []Shot) []Burst {
+	var bursts []Burst
+	covers := make(map[int]bool)
+
+	// Bursts named by the phone.
+	named := make(map[string][]int)
+	var keys []string
+	for i, s := range shots {
+		key, cover, ok := nameKey(filepath.Base(s.Path))
+		if !ok {
+			continue
+		}
+		key = filepath.Dir(s.Path) + string(filepath.Separator) + key
+		if _, seen := named[key]; !seen {
+			keys = append(keys, key)
+		}
+		named[key] = append(named[key], i)
+		covers[i] = cover
+	}
+	for _, key := range keys {
+		if group := named[key]; len(group) >= 2 {
+			bursts = append(bursts, newBurst(shots, group, covers))
+		}
+	}
+
+	// Bursts recognized by time, among the other timed shots of each directory and camera.
+	byCamera := make(map[string][]int)
+	keys = keys[:0]
+	for i, s := range shots {
+		if _, _, ok := nameKey(filepath.Base(s.Path)); ok || !s.Timed {
+			continue
+		}
+		key := filepath.Dir(s.Path) + "\x00" + s.Camera
+		if _, seen := byCamera[key]; !seen {
+			keys = append(keys, key)
+		}
+		byCamera[key] = append(byCamera[key], i)
+	}
+	for _, key := range keys {
+		group := byCamera[key]
+		sort.SliceStable(group, func(a, b int) bool { return shots[group[a]].Time.Before(shots[group[b]].Time) })
+		start := 0
+		for i := 1; i <= len(group); i++ {
+			if i < len(group) && shots[group[i]].Time.Sub(shots[group[i-1]].Time) <= MaxGap {
+				continue
+			}
+			if i-start >= MinShots {
+				bursts = append(bursts, newBurst(shots, group[start:i], covers))
+			}
+			start = i
+		}
+	}
+
+	sort.Slice(bursts, func(a, b int) bool { return minIndex(bursts[a].Shots) < minIndex(bursts[b].Shots) })
+	return bursts
+}
+
+// newBurst returns the burst of the shots at indexes group.
+func newBurst(shots []Shot, group []int, covers map[int]bool) Burst {
+	group = append([]int(nil), group...)
+	sort.SliceStable(group, func(a, b int) bool { return shots[group[a]].Time.Before(shots[group[b]].Time) })
+	b := Burst{Shots: group, Best: group[0]}
+	for _, i := range group {
+		if covers[i] {
+			b.Best = i
+			break
+		}
+		if shots[i].Size > shots[b.Best].Size {
+			b.Best = i
+		}
+	}
+	b.Name = "Burst " + shots[group[0]].Time.Format("2006-01-02 15.04.05")
+	return b
+}
+
+// minIndex returns the smallest of indexes.
+func minIndex(indexes []int) int {
+	m := indexes[0]
+	for _, i := range indexes[1:] {
+		m = min(m, i)
+	}
+	return m
+}
@@ -0,0 +1,69 @@
+package burst
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, s := range []string{"off", "Group", " best "} {
+		if _, err := ParsePolicy(s); err != nil {
+			t.Errorf("ParsePolicy(%q): %v", s, err)
+		}
+	}
+	if _, err := ParsePolicy("all"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestFind_ByName(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	shots := []Shot{
+		{Path: filepath.Join("a", "IMG_20240102_030405_BURST001.jpg"), Time: at, Size: 900},
+		{Path: filepath.Join("a", "IMG_20240102_030405_BURST002_COVER.jpg"), Time: at, Size: 100},
+		{Path: filepath.Join("a", "IMG_20240102_030405_BURST003.jpg"), Time: at, Size: 500},
+		{Path: filepath.Join("a", "00000IMG_00000_BURST20240102030406123_COVER.jpg"), Time: at.Add(time.Second), Size: 100},
+		{Path: filepath.Join("a", "00001IMG_00001_BURST20240102030406123.jpg"), Time: at.Add(time.Second), Size: 200},
+		{Path: filepath.Join("b", "IMG_20240102_030405_BURST004.jpg"), Time: at, Size: 500},
+		{Path: filepath.Join("a", "IMG_1234.jpg"), Time: at, Size: 500},
+	}
+	got := Find(shots)
+	want := []Burst{
+		{Name: "Burst 2024-01-02 03.04.05", Shots: []int{0, 1, 2}, Best: 1},
+		{Name: "Burst 2024-01-02 03.04.06", Shots: []int{3, 4}, Best: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %+v, want %+v", got, want)
+	}
+}
+
+func TestFind_ByTime(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	shot := func(name string, offset time.Duration, size int64) Shot {
+		return Shot{Path: filepath.Join("card", name), Time: at.Add(offset), Timed: true, Camera: "Canon EOS R5", Size: size}
+	}
+	shots := []Shot{
+		shot("DSC_0003.JPG", 400*time.Millisecond, 300),
+		shot("DSC_0001.JPG", 0, 100),
+		shot("DSC_0002.JPG", 200*time.Millisecond, 500),
+		shot("DSC_0004.JPG", 10*time.Second, 100),
+		shot("DSC_0005.JPG", 10*time.Second+500*time.Millisecond, 100),
+		// Not timed by the camera, such as files dated by their modification time.
+		{Path: filepath.Join("card", "copy1.jpg"), Time: at, Size: 100},
+		{Path: filepath.Join("card", "copy2.jpg"), Time: at, Size: 100},
+		{Path: filepath.Join("card", "copy3.jpg"), Time: at, Size: 100},
+	}
+	got := Find(shots)
+	want := []Burst{{Name: "Burst 2024-01-02 03.04.05", Shots: []int{1, 2, 0}, Best: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %+v, want %+v", got, want)
+	}
+
+	// Shots of another camera break the sequence.
+	shots[2].Camera = "iPhone 13"
+	if got := Find(shots); len(got) != 0 {
+		t.Errorf("expected no burst, got %+v", got)
+	}
+}
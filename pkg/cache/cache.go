@@ -0,0 +1,255 @@
+// Package cache keeps what reading a source file costs to learn, its content hashes and the date of
+// its embedded metadata, in an SQLite database, so repeat runs over the same source do not read the
+// files again.
+//
+// Everything kept of a file is tied to the size and modification time it had when it was read: a file
+// that changed since is read again, and what was kept of it is dropped. The cache is an optimization
+// only. A lookup that fails is a miss, and a write that fails leaves the file to be read again next run.
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+)
+
+// DefaultFileName is the suggested name of a cache. It describes sources rather than a library, so it
+// is best kept outside both, such as in the user cache directory.
+const DefaultFileName = "media-organizer-cache.db"
+
+// Cache is an open cache database. It is safe for concurrent use.
+type Cache struct {
+	db *sql.DB
+}
+
+// migrations create the schema; migrations[i] upgrades a database at user_version i.
+// Released migrations must never change.
+var migrations = []string{
+	`CREATE TABLE files (
+		path     TEXT PRIMARY KEY,
+		size     INTEGER NOT NULL,
+		mod_time INTEGER NOT NULL
+	);
+	CREATE TABLE hashes (
+		path      TEXT NOT NULL REFERENCES files(path) ON DELETE CASCADE,
+		algorithm TEXT NOT NULL,
+		sum       TEXT NOT NULL,
+		PRIMARY KEY (path, algorithm)
+	);
+	CREATE TABLE dates (
+		path       TEXT NOT NULL REFERENCES files(path) ON DELETE CASCADE,
+		zone       TEXT NOT NULL,
+		created_at INTEGER,
+		PRIMARY KEY (path, zone)
+	);`,
+	// EXIF dates are read in the UTC offset they were recorded with, which is kept with them; dates
+	// read before are read again.
+	`DELETE FROM dates;
+	ALTER TABLE dates ADD COLUMN utc_offset INTEGER;`,
+}
+
+// Open opens the cache at path, creating it and upgrading its schema as needed.
+func Open(ctx context.Context, path string) (*Cache, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("open cache %s: %w", path, err)
+	}
+	// A lost cache is only read again, so writes are not synced to disk one by one.
+	dsn := "file:" + (&url.URL{Path: abs}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=synchronous(OFF)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open cache %s: %w", path, err)
+	}
+	c := &Cache{db: db}
+	if err := c.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Cache) migrate(ctx context.Context) error {
+	var version int
+	if err := c.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("cache schema version %d is newer than supported (%d)", version, len(migrations))
+	}
+	for v := version; v < len(migrations); v++ {
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+// Hashes returns the hashes kept of the file at path while it has size and modTime.
+func (c *Cache) Hashes(path string, size int64, modTime time.Time) []hashlist.Hash {
+	rows, err := c.db.Query(`
+		SELECT h.algorithm, h.sum FROM hashes h JOIN files f ON f.path = h.path
+		WHERE f.path = ? AND f.size = ? AND f.mod_time = ?`, key(path), size, modTime.UnixNano())
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var hashes []hashlist.Hash
+	for rows.Next() {
+		var h hashlist.Hash
+		if err := rows.Scan(&h.Algorithm, &h.Sum); err != nil {
+			return nil
+		}
+		hashes = append(hashes, h)
+	}
+	if rows.Err() != nil {
+		return nil
+	}
+	return hashes
+}
+
+// AddHash keeps h as a hash of the file at path while it has size and modTime.
+func (c *Cache) AddHash(path string, size int64, modTime time.Time, h hashlist.Hash) {
+	_ = c.update(path, size, modTime, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO hashes (path, algorithm, sum) VALUES (?, ?, ?)`, key(path), h.Algorithm, h.Sum)
+		return err
+	})
+}
+
+// date returns the metadata date kept of the file at path while it has size and modTime, read in
+// zone, whether the file has one, and whether one was kept at all.
+func (c *Cache) date(path string, size int64, modTime time.Time, loc *time.Location) (t time.Time, found, ok bool) {
+	var n, offset sql.NullInt64
+	err := c.db.QueryRow(`
+		SELECT d.created_at, d.utc_offset FROM dates d JOIN files f ON f.path = d.path
+		WHERE f.path = ? AND f.size = ? AND f.mod_time = ? AND d.zone = ?`, key(path), size, modTime.UnixNano(), loc.String()).Scan(&n, &offset)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	if !n.Valid {
+		return time.Time{}, false, true
+	}
+	t = time.Unix(0, n.Int64).In(loc)
+	if offset.Valid {
+		t = t.In(time.FixedZone("", int(offset.Int64)))
+	}
+	return t, true, true
+}
+
+// setDate keeps t, or that the file has no date when t is zero, as the metadata date of the file at
+// path read in loc while it has size and modTime. The UTC offset of t is kept when t is not in loc, as
+// for an EXIF date recorded with its offset.
+func (c *Cache) setDate(path string, size int64, modTime time.Time, loc *time.Location, t time.Time) {
+	var n, offset sql.NullInt64
+	if !t.IsZero() {
+		n = sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+		if t.Location() != loc {
+			_, seconds := t.Zone()
+			offset = sql.NullInt64{Int64: int64(seconds), Valid: true}
+		}
+	}
+	_ = c.update(path, size, modTime, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO dates (path, zone, created_at, utc_offset) VALUES (?, ?, ?, ?)`, key(path), loc.String(), n, offset)
+		return err
+	})
+}
+
+// update runs fn in a transaction after recording the file at path with size and modTime. What was
+// kept of the file while it had another size or modification time is dropped first.
+func (c *Cache) update(path string, size int64, modTime time.Time, fn func(tx *sql.Tx) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldSize, oldModTime int64
+	err = tx.QueryRow(`SELECT size, mod_time FROM files WHERE path = ?`, key(path)).Scan(&oldSize, &oldModTime)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case oldSize != size || oldModTime != modTime.UnixNano():
+		if _, err := tx.Exec(`DELETE FROM files WHERE path = ?`, key(path)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO files (path, size, mod_time) VALUES (?, ?, ?)`, key(path), size, modTime.UnixNano()); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Metadata returns the extractor of the embedded date of the file at path, which has size and modTime:
+// createdat.DefaultMetadata in loc, or time.Local if nil, whose result is kept, or the result kept of
+// an earlier run. Failures to read the metadata are not kept.
+func (c *Cache) Metadata(path string, size int64, modTime time.Time, loc *time.Location) createdat.MetadataExtractor {
+	if loc == nil {
+		loc = time.Local
+	}
+	return metadataExtractor{c: c, path: path, size: size, modTime: modTime, loc: loc}
+}
+
+// metadataExtractor is the extractor of Cache.Metadata. Dates without a timezone are read in loc, so
+// the dates kept of a file are told apart by its name.
+type metadataExtractor struct {
+	c       *Cache
+	path    string
+	size    int64
+	modTime time.Time
+	loc     *time.Location
+}
+
+func (m metadataExtractor) CreatedAt(path string, r io.Reader) (time.Time, bool, error) {
+	if t, found, ok := m.c.date(m.path, m.size, m.modTime, m.loc); ok {
+		return t, found, nil
+	}
+	t, found, err := createdat.DefaultMetadata(path, m.loc).CreatedAt(path, r)
+	if err != nil {
+		return t, found, err
+	}
+	if !found {
+		t = time.Time{}
+	}
+	m.c.setDate(m.path, m.size, m.modTime, m.loc, t)
+	return t, found, nil
+}
+
+// key returns the key of path in the cache: runs over a source may start in different working directories.
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
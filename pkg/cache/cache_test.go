@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+)
+
+func openTemp(t *testing.T) (*Cache, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	c, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, path
+}
+
+func TestHashes(t *testing.T) {
+	c, path := openTemp(t)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	sha := hashlist.Hash{Algorithm: "sha256", Sum: "aa"}
+	xxh := hashlist.Hash{Algorithm: "xxhash128", Sum: "bb"}
+	c.AddHash("/card/a.jpg", 10, modTime, sha)
+	c.AddHash("/card/a.jpg", 10, modTime, xxh)
+
+	// The hashes survive reopening.
+	c.Close()
+	c, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer c.Close()
+	if got := c.Hashes("/card/a.jpg", 10, modTime); len(got) != 2 {
+		t.Fatalf("got %+v, want both hashes", got)
+	}
+
+	// A file of another size or modification time has no hashes.
+	if got := c.Hashes("/card/a.jpg", 11, modTime); len(got) != 0 {
+		t.Errorf("other size: got %+v", got)
+	}
+	if got := c.Hashes("/card/a.jpg", 10, modTime.Add(time.Second)); len(got) != 0 {
+		t.Errorf("other modification time: got %+v", got)
+	}
+
+	// A hash of the changed file drops those of the old one.
+	c.AddHash("/card/a.jpg", 11, modTime, sha)
+	if got := c.Hashes("/card/a.jpg", 11, modTime); len(got) != 1 || got[0] != sha {
+		t.Errorf("changed file: got %+v", got)
+	}
+	if got := c.Hashes("/card/a.jpg", 10, modTime); len(got) != 0 {
+		t.Errorf("expected the hashes of the old file to be dropped, got %+v", got)
+	}
+}
+
+// jpegWithDate returns a JPEG with an EXIF DateTimeOriginal of date, formatted like 2024:01:02 03:04:05.
+func jpegWithDate(date string) []byte {
+	return testjpeg.WithEXIF([]testjpeg.Entry{testjpeg.ASCII(0x9003, date)}, nil, nil)
+}
+
+// jpegWithOffsetDate returns a JPEG whose EXIF sub-IFD holds a DateTimeOriginal of date and an
+// OffsetTimeOriginal of offset, formatted like +09:00.
+func jpegWithOffsetDate(date, offset string) []byte {
+	return testjpeg.WithEXIF(nil, []testjpeg.Entry{testjpeg.ASCII(0x9003, date), testjpeg.ASCII(0x9011, offset)}, nil)
+}
+
+func TestMetadata(t *testing.T) {
+	c, _ := openTemp(t)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tokyo := time.FixedZone("Tokyo", 9*3600)
+
+	extract := func(data []byte, size int64, modTime time.Time, loc *time.Location) (time.Time, bool) {
+		t.Helper()
+		got, found, err := c.Metadata("/card/a.jpg", size, modTime, loc).CreatedAt("a.jpg", bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("CreatedAt: %v", err)
+		}
+		return got, found
+	}
+
+	want := time.Date(2023, 5, 6, 7, 8, 9, 0, tokyo)
+	if got, found := extract(jpegWithDate("2023:05:06 07:08:09"), 10, modTime, tokyo); !found || !got.Equal(want) {
+		t.Fatalf("first read: got %v, %v; want %v", got, found, want)
+	}
+
+	// An unchanged file is not read again: its date is the one kept.
+	got, found := extract(nil, 10, modTime, tokyo)
+	if !found || !got.Equal(want) || got.Location() != tokyo {
+		t.Errorf("cached: got %v, %v; want %v", got, found, want)
+	}
+
+	// Another timezone reads the wall-clock time of the EXIF date again.
+	utc := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	if got, found := extract(jpegWithDate("2023:05:06 07:08:09"), 10, modTime, time.UTC); !found || !got.Equal(utc) {
+		t.Errorf("other timezone: got %v, %v; want %v", got, found, utc)
+	}
+
+	// A changed file is read again, and that it has no date is kept too.
+	if _, found := extract([]byte("not a photo"), 10, modTime.Add(time.Second), tokyo); found {
+		t.Errorf("changed file: expected no date")
+	}
+	if _, found := extract(jpegWithDate("2023:05:06 07:08:09"), 10, modTime.Add(time.Second), tokyo); found {
+		t.Errorf("expected the missing date of the changed file to be kept")
+	}
+
+	// A date recorded with its UTC offset keeps it.
+	newYork := time.Date(2023, 5, 6, 7, 8, 9, 0, time.FixedZone("", -4*3600))
+	if got, found := extract(jpegWithOffsetDate("2023:05:06 07:08:09", "-04:00"), 12, modTime, tokyo); !found || !got.Equal(newYork) {
+		t.Fatalf("offset: got %v, %v; want %v", got, found, newYork)
+	}
+	if got, found := extract(nil, 12, modTime, tokyo); !found || !got.Equal(newYork) || got.Hour() != 7 {
+		t.Errorf("cached offset: got %v, %v; want %v", got, found, newYork)
+	}
+}
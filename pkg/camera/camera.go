@@ -0,0 +1,106 @@
+// Package camera reads the camera a media file was taken with from the EXIF Make and Model tags,
+// and the serial number of its body where the device records one.
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Camera is the make and model recorded by a device, trimmed of padding.
+type Camera struct {
+	Make  string `json:"make,omitempty"`
+	Model string `json:"model,omitempty"`
+
+	// Serial is the serial number of the camera body (EXIF BodySerialNumber). Most cameras record it,
+	// most phones do not.
+	Serial string `json:"serial,omitempty"`
+}
+
+// String returns the display name of the camera: the make's first word followed by the model, such as
+// "Canon EOS R5" or "Apple iPhone 13". Models that already start with the make are not prefixed again,
+// so NIKON CORPORATION / NIKON D850 is "NIKON D850".
+func (c Camera) String() string {
+	brand, _, _ := strings.Cut(c.Make, " ")
+	switch {
+	case c.Model == "":
+		return c.Make
+	case brand == "" || strings.HasPrefix(strings.ToLower(c.Model), strings.ToLower(brand)):
+		return c.Model
+	default:
+		return brand + " " + c.Model
+	}
+}
+
+// IsZero reports whether no make or model was recorded.
+func (c Camera) IsZero() bool { return c.Make == "" && c.Model == "" }
+
+// Matches reports whether name, compared case-insensitively, is the display name or the model of the camera.
+func (c Camera) Matches(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || c.IsZero() {
+		return false
+	}
+	return strings.EqualFold(name, c.String()) || strings.EqualFold(name, c.Model)
+}
+
+// Read returns the camera in the EXIF data read from r.
+// ok is false when r has no EXIF data or the data names no camera.
+func Read(r io.Reader) (Camera, bool, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		// Files without EXIF (videos, PNGs) simply name no camera.
+		if !exif.IsCriticalError(err) || strings.HasPrefix(err.Error(), "exif: decode failed") {
+			return Camera{}, false, fmt.Errorf("decode exif: %w", err)
+		}
+		return Camera{}, false, nil
+	}
+	c := Camera{Make: stringTag(x, exif.Make), Model: stringTag(x, exif.Model)}
+	if !c.IsZero() {
+		c.Serial = bodySerial(x)
+	}
+	return c, !c.IsZero(), nil
+}
+
+// bodySerialNumber is the EXIF 2.3 BodySerialNumber tag, which goexif does not load.
+const bodySerialNumber exif.FieldName = "BodySerialNumber"
+
+// bodySerial returns the BodySerialNumber in the EXIF sub-IFD of x, or "".
+func bodySerial(x *exif.Exif) string {
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return ""
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil || offset < 0 || offset >= int64(len(x.Raw)) {
+		return ""
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return ""
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return ""
+	}
+	x.LoadTags(dir, map[uint16]exif.FieldName{0xA431: bodySerialNumber}, false)
+	return stringTag(x, bodySerialNumber)
+}
+
+// stringTag returns the value of an ASCII tag without the NUL and space padding some devices write.
+func stringTag(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Trim(s, "\x00 "))
+}
@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+func TestRead(t *testing.T) {
+	c, ok, err := Read(bytes.NewReader(testjpeg.WithCamera("Canon", "Canon EOS R5")))
+	if err != nil || !ok {
+		t.Fatalf("Read: %v, %v", ok, err)
+	}
+	if c != (Camera{Make: "Canon", Model: "Canon EOS R5"}) {
+		t.Errorf("got %+v", c)
+	}
+
+	if _, ok, err := Read(strings.NewReader("no exif")); ok || err != nil {
+		t.Errorf("expected no camera and no error for a file without EXIF, got %v, %v", ok, err)
+	}
+}
+
+func TestRead_Serial(t *testing.T) {
+	c, ok, err := Read(bytes.NewReader(jpegWithSerial("Canon", "Canon EOS R5", "012345678901")))
+	if err != nil || !ok {
+		t.Fatalf("Read: %v, %v", ok, err)
+	}
+	if want := (Camera{Make: "Canon", Model: "Canon EOS R5", Serial: "012345678901"}); c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, tc := range []struct {
+		camera Camera
+		want   string
+	}{
+		{Camera{Make: "Canon", Model: "Canon EOS R5"}, "Canon EOS R5"},
+		{Camera{Make: "Apple", Model: "iPhone 13"}, "Apple iPhone 13"},
+		{Camera{Make: "NIKON CORPORATION", Model: "NIKON D850"}, "NIKON D850"},
+		{Camera{Make: "SONY"}, "SONY"},
+		{Camera{Model: "DSC-RX100"}, "DSC-RX100"},
+	} {
+		if got := tc.camera.String(); got != tc.want {
+			t.Errorf("%+v: got %q, want %q", tc.camera, got, tc.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	c := Camera{Make: "Apple", Model: "iPhone 13"}
+	for name, want := range map[string]bool{"Apple iPhone 13": true, "iphone 13": true, " APPLE IPHONE 13 ": true, "iPhone": false, "": false} {
+		if got := c.Matches(name); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// jpegWithSerial returns a minimal JPEG whose EXIF block holds the Make and Model tags and, in the EXIF
+// sub-IFD, the BodySerialNumber tag.
+func jpegWithSerial(maker, model, serial string) []byte {
+	return testjpeg.WithEXIF([]testjpeg.Entry{testjpeg.ASCII(0x010F, maker), testjpeg.ASCII(0x0110, model)}, []testjpeg.Entry{testjpeg.ASCII(0xA431, serial)}, nil)
+}
@@ -0,0 +1,487 @@
+// Package catalog records every file imported into a library in an SQLite database: its content
+// hash, created_at, where it came from, where it went and the run that imported it.
+//
+// The catalog is optional. It is what incremental imports, verification, undo and statistics
+// are built on; the organized tree itself stays the source of truth for the files.
+package catalog
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+)
+
+// DefaultFileName is the suggested name of a catalog kept in the destination root.
+const DefaultFileName = ".media-organizer.db"
+
+// ErrRunNotFound is returned for an unknown run ID.
+var ErrRunNotFound = errors.New("run not found")
+
+// Entry is one imported file.
+type Entry struct {
+	// RunID is the run that imported the file.
+	RunID string
+
+	// SHA256 is the hex-encoded SHA-256 of the file content.
+	SHA256 string
+
+	// Size is the file size in bytes.
+	Size int64
+
+	// CreatedAt and CreatedAtSource are the attributed creation time and where it came from.
+	// CreatedAt is zero for files without a known created_at.
+	CreatedAt       time.Time
+	CreatedAtSource createdat.Source
+
+	// SourcePath is the path the file was imported from, as seen by the run.
+	SourcePath string
+
+	// SourceModTime is the modification time of the source when it was imported; zero if unknown.
+	SourceModTime time.Time
+
+	// DestinationPath is the path the file was copied to.
+	DestinationPath string
+
+	// DestinationSize and DestinationModTime are the size and modification time of the copy when it
+	// was recorded, to tell whether it is still there unchanged; DestinationModTime is zero if unknown.
+	DestinationSize    int64
+	DestinationModTime time.Time
+
+	// ImportedAt is when the file was recorded.
+	ImportedAt time.Time
+}
+
+// Run is one organize or merge run that imported files.
+type Run struct {
+	ID string
+
+	// Sources and Destination are the roots of the run.
+	Sources     []string
+	Destination string
+
+	StartedAt time.Time
+
+	// FinishedAt is zero while the run is in progress or when it was interrupted.
+	FinishedAt time.Time
+
+	// Imported is the number of entries recorded by the run.
+	Imported int
+}
+
+// Catalog is an open catalog database. It is safe for concurrent use.
+type Catalog struct {
+	db *sql.DB
+}
+
+// migrations create the schema; migrations[i] upgrades a database at user_version i.
+// Released migrations must never change.
+var migrations = []string{
+	`CREATE TABLE runs (
+		id          TEXT PRIMARY KEY,
+		sources     TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		started_at  INTEGER NOT NULL,
+		finished_at INTEGER
+	);
+	CREATE TABLE files (
+		id                INTEGER PRIMARY KEY,
+		run_id            TEXT NOT NULL REFERENCES runs(id),
+		sha256            TEXT NOT NULL,
+		size              INTEGER NOT NULL,
+		created_at        INTEGER,
+		created_at_source TEXT NOT NULL,
+		source_path       TEXT NOT NULL,
+		destination_path  TEXT NOT NULL,
+		imported_at       INTEGER NOT NULL
+	);
+	CREATE INDEX files_sha256 ON files(sha256);
+	CREATE INDEX files_run_id ON files(run_id);
+	CREATE INDEX files_destination_path ON files(destination_path);`,
+
+	`ALTER TABLE files ADD COLUMN source_mod_time INTEGER;
+	CREATE INDEX files_size ON files(size);
+	CREATE INDEX files_source_path ON files(source_path);`,
+
+	`ALTER TABLE files ADD COLUMN destination_size INTEGER;
+	ALTER TABLE files ADD COLUMN destination_mod_time INTEGER;`,
+
+	`CREATE TABLE dates (
+		source_path TEXT PRIMARY KEY,
+		created_at  INTEGER NOT NULL,
+		set_at      INTEGER NOT NULL
+	);`,
+
+	`CREATE TABLE history (
+		id         TEXT PRIMARY KEY,
+		started_at INTEGER NOT NULL,
+		entry      TEXT NOT NULL
+	);`,
+}
+
+// Open opens the catalog at path, creating it and upgrading its schema as needed.
+func Open(ctx context.Context, path string) (*Catalog, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("open catalog %s: %w", path, err)
+	}
+	// A busy timeout lets a second process wait for a write instead of failing immediately.
+	dsn := "file:" + (&url.URL{Path: abs}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open catalog %s: %w", path, err)
+	}
+	c := &Catalog{db: db}
+	if err := c.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Catalog) migrate(ctx context.Context) error {
+	var version int
+	if err := c.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("catalog schema version %d is newer than supported (%d)", version, len(migrations))
+	}
+	for v := version; v < len(migrations); v++ {
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// BeginRun records the start of a run and returns it with a new, unique ID.
+func (c *Catalog) BeginRun(ctx context.Context, sources []string, destination string) (Run, error) {
+	run := Run{
+		ID:          newRunID(time.Now()),
+		Sources:     append([]string(nil), sources...),
+		Destination: destination,
+		StartedAt:   time.Now(),
+	}
+	_, err := c.db.ExecContext(ctx, `INSERT INTO runs (id, sources, destination, started_at) VALUES (?, ?, ?, ?)`,
+		run.ID, strings.Join(run.Sources, "\n"), run.Destination, run.StartedAt.UnixNano())
+	if err != nil {
+		return Run{}, fmt.Errorf("begin run: %w", err)
+	}
+	return run, nil
+}
+
+// newRunID returns a sortable run ID such as 20240102T030405Z-9f86d081.
+func newRunID(now time.Time) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+// Record adds the entries of a run in one transaction. Entries without ImportedAt get the current time.
+func (c *Catalog) Record(ctx context.Context, runID string, entries []Entry) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO files
+		(run_id, sha256, size, created_at, created_at_source, source_path, source_mod_time, destination_path,
+		 destination_size, destination_mod_time, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, e := range entries {
+		importedAt := e.ImportedAt
+		if importedAt.IsZero() {
+			importedAt = now
+		}
+		createdAt, modTime, destModTime := nullTime(e.CreatedAt), nullTime(e.SourceModTime), nullTime(e.DestinationModTime)
+		source := e.CreatedAtSource
+		if source == "" {
+			source = createdat.SourceUnknown
+		}
+		destSize := sql.NullInt64{Int64: e.DestinationSize, Valid: destModTime.Valid}
+		if _, err := stmt.ExecContext(ctx, runID, e.SHA256, e.Size, createdAt, string(source),
+			e.SourcePath, modTime, e.DestinationPath, destSize, destModTime, importedAt.UnixNano()); err != nil {
+			return fmt.Errorf("record %s: %w", e.SourcePath, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return nil
+}
+
+func nullTime(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+// FinishRun marks a run as finished.
+func (c *Catalog) FinishRun(ctx context.Context, runID string) error {
+	res, err := c.db.ExecContext(ctx, `UPDATE runs SET finished_at = ? WHERE id = ?`, time.Now().UnixNano(), runID)
+	if err != nil {
+		return fmt.Errorf("finish run %s: %w", runID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("finish run %s: %w", runID, ErrRunNotFound)
+	}
+	return nil
+}
+
+// Runs returns every run, oldest first.
+func (c *Catalog) Runs(ctx context.Context) ([]Run, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT r.id, r.sources, r.destination, r.started_at, r.finished_at, COUNT(f.id)
+		FROM runs r LEFT JOIN files f ON f.run_id = r.id
+		GROUP BY r.id ORDER BY r.started_at, r.id`)
+	if err != nil {
+		return nil, fmt.Errorf("list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var (
+			r        Run
+			sources  string
+			started  int64
+			finished sql.NullInt64
+		)
+		if err := rows.Scan(&r.ID, &sources, &r.Destination, &started, &finished, &r.Imported); err != nil {
+			return nil, fmt.Errorf("list runs: %w", err)
+		}
+		if sources != "" {
+			r.Sources = strings.Split(sources, "\n")
+		}
+		r.StartedAt = time.Unix(0, started)
+		if finished.Valid {
+			r.FinishedAt = time.Unix(0, finished.Int64)
+		}
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list runs: %w", err)
+	}
+	return runs, nil
+}
+
+// RunEntries returns the entries recorded by a run, in the order they were recorded.
+func (c *Catalog) RunEntries(ctx context.Context, runID string) ([]Entry, error) {
+	var n int
+	if err := c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM runs WHERE id = ?`, runID).Scan(&n); err != nil {
+		return nil, fmt.Errorf("run %s: %w", runID, err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("run %s: %w", runID, ErrRunNotFound)
+	}
+	return c.entries(ctx, `WHERE run_id = ? ORDER BY id`, runID)
+}
+
+// BySHA256 returns the entries of files with the given hex-encoded SHA-256, oldest first.
+func (c *Catalog) BySHA256(ctx context.Context, sum string) ([]Entry, error) {
+	return c.entries(ctx, `WHERE sha256 = ? ORDER BY id`, strings.ToLower(sum))
+}
+
+// BySource returns the entries of files imported from path, oldest first.
+func (c *Catalog) BySource(ctx context.Context, path string) ([]Entry, error) {
+	return c.entries(ctx, `WHERE source_path = ? ORDER BY id`, path)
+}
+
+// Sizes returns the set of sizes of the imported files. Only files of one of these sizes
+// can have been imported before, so other files need not be hashed.
+func (c *Catalog) Sizes(ctx context.Context) (map[int64]bool, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT DISTINCT size FROM files`)
+	if err != nil {
+		return nil, fmt.Errorf("list sizes: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[int64]bool)
+	for rows.Next() {
+		var size int64
+		if err := rows.Scan(&size); err != nil {
+			return nil, fmt.Errorf("list sizes: %w", err)
+		}
+		sizes[size] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list sizes: %w", err)
+	}
+	return sizes, nil
+}
+
+// Forget removes the entries of the files copied to destinations, such as those removed again by an
+// undo, so a later run imports their sources again. It returns the number of entries removed.
+func (c *Catalog) Forget(ctx context.Context, destinations []string) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("forget files: %w", err)
+	}
+	defer tx.Rollback()
+	var n int64
+	for _, path := range destinations {
+		res, err := tx.ExecContext(ctx, `DELETE FROM files WHERE destination_path = ?`, path)
+		if err != nil {
+			return 0, fmt.Errorf("forget %s: %w", path, err)
+		}
+		removed, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("forget %s: %w", path, err)
+		}
+		n += removed
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("forget files: %w", err)
+	}
+	return int(n), nil
+}
+
+// SetDate records t as the created_at of the file at path, overriding the dates found in the file
+// itself, such as for a scanned print. An earlier date of path is replaced.
+func (c *Catalog) SetDate(ctx context.Context, path string, t time.Time) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO dates (source_path, created_at, set_at) VALUES (?, ?, ?)
+		ON CONFLICT (source_path) DO UPDATE SET created_at = excluded.created_at, set_at = excluded.set_at`,
+		datePath(path), t.UnixNano(), time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("set date of %s: %w", path, err)
+	}
+	return nil
+}
+
+// Date returns the created_at recorded for the file at path with SetDate, and whether there is one.
+func (c *Catalog) Date(ctx context.Context, path string) (time.Time, bool, error) {
+	var n int64
+	err := c.db.QueryRowContext(ctx, `SELECT created_at FROM dates WHERE source_path = ?`, datePath(path)).Scan(&n)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return time.Time{}, false, nil
+	case err != nil:
+		return time.Time{}, false, fmt.Errorf("date of %s: %w", path, err)
+	}
+	return time.Unix(0, n), true, nil
+}
+
+// AppendHistory adds an entry to the run history. The catalog keeps entry as it is: the history
+// package defines what it holds.
+func (c *Catalog) AppendHistory(ctx context.Context, id string, started time.Time, entry []byte) error {
+	_, err := c.db.ExecContext(ctx, `INSERT INTO history (id, started_at, entry) VALUES (?, ?, ?)`,
+		id, started.UnixNano(), string(entry))
+	if err != nil {
+		return fmt.Errorf("append history %s: %w", id, err)
+	}
+	return nil
+}
+
+// History returns the entries of the run history, oldest first.
+func (c *Catalog) History(ctx context.Context) ([][]byte, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT entry FROM history ORDER BY started_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries [][]byte
+	for rows.Next() {
+		var entry string
+		if err := rows.Scan(&entry); err != nil {
+			return nil, fmt.Errorf("read history: %w", err)
+		}
+		entries = append(entries, []byte(entry))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return entries, nil
+}
+
+// datePath returns the key of path in the dates table: dates are set and looked up from different
+// working directories.
+func datePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Entries returns every entry, in the order they were recorded.
+func (c *Catalog) Entries(ctx context.Context) ([]Entry, error) {
+	return c.entries(ctx, `ORDER BY id`)
+}
+
+func (c *Catalog) entries(ctx context.Context, where string, args ...any) ([]Entry, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT run_id, sha256, size, created_at, created_at_source, source_path, source_mod_time, destination_path,
+			destination_size, destination_mod_time, imported_at
+		FROM files `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var (
+			e                                         Entry
+			createdAt, modTime, destSize, destModTime sql.NullInt64
+			source                                    string
+			importedAt                                int64
+		)
+		if err := rows.Scan(&e.RunID, &e.SHA256, &e.Size, &createdAt, &source, &e.SourcePath, &modTime, &e.DestinationPath,
+			&destSize, &destModTime, &importedAt); err != nil {
+			return nil, fmt.Errorf("list entries: %w", err)
+		}
+		if createdAt.Valid {
+			e.CreatedAt = time.Unix(0, createdAt.Int64)
+		}
+		if modTime.Valid {
+			e.SourceModTime = time.Unix(0, modTime.Int64)
+		}
+		if destModTime.Valid {
+			e.DestinationSize, e.DestinationModTime = destSize.Int64, time.Unix(0, destModTime.Int64)
+		}
+		e.CreatedAtSource = createdat.Source(source)
+		e.ImportedAt = time.Unix(0, importedAt)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list entries: %w", err)
+	}
+	return entries, nil
+}
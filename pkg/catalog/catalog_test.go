@@ -0,0 +1,170 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+)
+
+func openTemp(t *testing.T) (*Catalog, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	c, err := Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, path
+}
+
+func TestRecordAndQuery(t *testing.T) {
+	ctx := context.Background()
+	c, path := openTemp(t)
+
+	run, err := c.BeginRun(ctx, []string{"/card", "/phone"}, "/library")
+	if err != nil {
+		t.Fatalf("BeginRun: %v", err)
+	}
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []Entry{
+		{SHA256: "aa", Size: 1, CreatedAt: createdAt, CreatedAtSource: createdat.SourceMetadata, SourcePath: "/card/a.jpg", DestinationPath: "/library/2024/01/02/a.jpg",
+			DestinationSize: 3, DestinationModTime: createdAt.Add(time.Hour)},
+		{SHA256: "bb", Size: 2, SourcePath: "/phone/b.jpg", DestinationPath: "/library/unknown/b.jpg"},
+	}
+	if err := c.Record(ctx, run.ID, entries); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := c.FinishRun(ctx, run.ID); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	// The data survives reopening.
+	c.Close()
+	c, err = Open(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer c.Close()
+
+	runs, err := c.Runs(ctx)
+	if err != nil {
+		t.Fatalf("Runs: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || runs[0].Imported != 2 || runs[0].FinishedAt.IsZero() ||
+		len(runs[0].Sources) != 2 || runs[0].Destination != "/library" {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+
+	got, err := c.RunEntries(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("RunEntries: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if !got[0].CreatedAt.Equal(createdAt) || got[0].CreatedAtSource != createdat.SourceMetadata || got[0].RunID != run.ID || got[0].ImportedAt.IsZero() {
+		t.Errorf("unexpected first entry: %+v", got[0])
+	}
+	if got[0].DestinationSize != 3 || !got[0].DestinationModTime.Equal(createdAt.Add(time.Hour)) {
+		t.Errorf("unexpected stat of the first copy: %+v", got[0])
+	}
+	if !got[1].CreatedAt.IsZero() || got[1].CreatedAtSource != createdat.SourceUnknown || !got[1].DestinationModTime.IsZero() {
+		t.Errorf("unexpected undated entry: %+v", got[1])
+	}
+
+	bySource, err := c.BySource(ctx, "/card/a.jpg")
+	if err != nil || len(bySource) != 1 || bySource[0].SHA256 != "aa" {
+		t.Errorf("unexpected BySource result: %+v, %v", bySource, err)
+	}
+	sizes, err := c.Sizes(ctx)
+	if err != nil || len(sizes) != 2 || !sizes[1] || !sizes[2] {
+		t.Errorf("unexpected sizes: %v, %v", sizes, err)
+	}
+
+	bySum, err := c.BySHA256(ctx, "BB")
+	if err != nil {
+		t.Fatalf("BySHA256: %v", err)
+	}
+	if len(bySum) != 1 || bySum[0].SourcePath != "/phone/b.jpg" {
+		t.Errorf("unexpected lookup result: %+v", bySum)
+	}
+}
+
+func TestUnknownRun(t *testing.T) {
+	ctx := context.Background()
+	c, _ := openTemp(t)
+
+	if _, err := c.RunEntries(ctx, "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("RunEntries: got %v, want ErrRunNotFound", err)
+	}
+	if err := c.FinishRun(ctx, "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("FinishRun: got %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestRunIDsAreUnique(t *testing.T) {
+	ctx := context.Background()
+	c, _ := openTemp(t)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		run, err := c.BeginRun(ctx, nil, "/library")
+		if err != nil {
+			t.Fatalf("BeginRun: %v", err)
+		}
+		if seen[run.ID] {
+			t.Fatalf("duplicate run ID %s", run.ID)
+		}
+		seen[run.ID] = true
+	}
+}
+
+func TestSetDate(t *testing.T) {
+	ctx := context.Background()
+	c, _ := openTemp(t)
+	path := filepath.Join(t.TempDir(), "scans", "scan1.jpg")
+
+	if _, ok, err := c.Date(ctx, path); err != nil || ok {
+		t.Fatalf("Date before SetDate = %v, %v", ok, err)
+	}
+	for _, want := range []time.Time{time.Date(1998, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(1998, 7, 14, 0, 0, 0, 0, time.UTC)} {
+		if err := c.SetDate(ctx, path, want); err != nil {
+			t.Fatalf("SetDate: %v", err)
+		}
+		got, ok, err := c.Date(ctx, filepath.Join(filepath.Dir(path), ".", "scan1.jpg"))
+		if err != nil || !ok || !got.Equal(want) {
+			t.Errorf("Date = %v, %v, %v; want %v", got, ok, err, want)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	ctx := context.Background()
+	c, _ := openTemp(t)
+	run, err := c.BeginRun(ctx, []string{"/card"}, "/library")
+	if err != nil {
+		t.Fatalf("BeginRun: %v", err)
+	}
+	entries := []Entry{
+		{SHA256: "aa", Size: 1, SourcePath: "/card/a.jpg", DestinationPath: "/library/a.jpg"},
+		{SHA256: "bb", Size: 2, SourcePath: "/card/b.jpg", DestinationPath: "/library/b.jpg"},
+	}
+	if err := c.Record(ctx, run.ID, entries); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	n, err := c.Forget(ctx, []string{"/library/a.jpg", "/library/missing.jpg"})
+	if err != nil || n != 1 {
+		t.Fatalf("Forget = %d, %v; want 1", n, err)
+	}
+	if got, err := c.BySource(ctx, "/card/a.jpg"); err != nil || len(got) != 0 {
+		t.Errorf("forgotten entry still there: %+v, %v", got, err)
+	}
+	if got, err := c.BySource(ctx, "/card/b.jpg"); err != nil || len(got) != 1 {
+		t.Errorf("other entry: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package checkpoint records the copies an executing organize run has finished, one JSON line per file,
+// so a run that is interrupted can be resumed: the files it copied are skipped by their size and
+// modification time, without planning, reading or hashing them again.
+//
+// The checkpoint is kept in the destination root while a run copies and removed when the run finishes.
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// FileName is the name of the checkpoint in the destination root.
+const FileName = ".media-organizer-checkpoint.jsonl"
+
+// Entry is a file copied by a run.
+type Entry struct {
+	// Source is the path the file was copied from, with its size and modification time at the time.
+	Source        string    `json:"source"`
+	SourceSize    int64     `json:"source_size"`
+	SourceModTime time.Time `json:"source_mod_time"`
+
+	// Destination is the path of the copy, with its size and modification time as written.
+	Destination        string    `json:"destination"`
+	DestinationSize    int64     `json:"destination_size"`
+	DestinationModTime time.Time `json:"destination_mod_time"`
+}
+
+// Writer appends entries to a checkpoint. It is safe for concurrent use.
+type Writer struct {
+	path string
+
+	mu sync.Mutex
+	f  destfs.File
+	n  int
+}
+
+// Create creates the checkpoint at path in fsys, replacing an existing one, and writes entries to it
+// first: those of the run being resumed. nil is the local file system.
+func Create(fsys destfs.FS, path string, entries ...Entry) (*Writer, error) {
+	f, err := destfs.OrOS(fsys).OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create checkpoint: %w", err)
+	}
+	w := &Writer{path: path, f: f}
+	if len(entries) > 0 {
+		if err := w.Append(entries...); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Path returns the path of the checkpoint.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Append adds entries to the checkpoint and syncs it, so it lists every file copied before an
+// interruption.
+func (w *Writer) Append(entries ...Entry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("append to checkpoint: %w", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("append to checkpoint %s: %w", w.path, err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("append to checkpoint %s: %w", w.path, err)
+	}
+	w.n += len(entries)
+	return nil
+}
+
+// Len returns the number of entries written, including those Create started with.
+func (w *Writer) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Close closes the checkpoint.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// Read returns the entries of the checkpoint at path in fsys; nil is the local file system. A missing
+// checkpoint is an error matching fs.ErrNotExist. A partial last line, left by an interrupted write, is
+// skipped.
+func Read(fsys destfs.FS, path string) ([]Entry, error) {
+	f, err := destfs.OrOS(fsys).Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", path, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	var entries []Entry
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("read checkpoint %s line %d: %w", path, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
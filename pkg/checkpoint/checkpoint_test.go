@@ -0,0 +1,66 @@
+package checkpoint
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if _, err := Read(nil, path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Read of a missing checkpoint = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := Entry{Source: "/card/a.jpg", SourceSize: 1, SourceModTime: mtime, Destination: "/lib/a.jpg", DestinationSize: 1, DestinationModTime: mtime}
+	second := Entry{Source: "/card/b.jpg", SourceSize: 2, SourceModTime: mtime, Destination: "/lib/b.jpg", DestinationSize: 2, DestinationModTime: mtime}
+	w, err := Create(nil, path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Append(first); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The partial last line of an interrupted write is skipped.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"source":"/card/c.jpg","sour`)
+	f.Close()
+	got, err := Read(nil, path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := []Entry{first}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %+v, want %+v", got, want)
+	}
+
+	// A resumed run starts over from the entries it carries over.
+	w, err = Create(nil, path, got...)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Append(second); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Read(nil, path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if want := []Entry{first, second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %+v, want %+v", got, want)
+	}
+}
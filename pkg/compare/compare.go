@@ -0,0 +1,195 @@
+// Package compare diffs two directory trees by path and by content.
+package compare
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// Status classifies a file in the comparison.
+type Status string
+
+const (
+	// StatusIdentical means both trees have the file at the same path with the same content.
+	StatusIdentical Status = "identical"
+	// StatusMoved means the content exists in both trees, but at different paths.
+	StatusMoved Status = "moved"
+	// StatusDifferent means both trees have the path, but the content differs.
+	StatusDifferent Status = "different"
+	// StatusOnlyA means the content only exists in tree A.
+	StatusOnlyA Status = "only_a"
+	// StatusOnlyB means the content only exists in tree B.
+	StatusOnlyB Status = "only_b"
+)
+
+var statusOrder = map[Status]int{
+	StatusOnlyA:     0,
+	StatusDifferent: 1,
+	StatusMoved:     2,
+	StatusOnlyB:     3,
+	StatusIdentical: 4,
+}
+
+// Entry is a single line of the comparison. Paths are root-relative with forward slashes.
+type Entry struct {
+	Status Status `json:"status"`
+	PathA  string `json:"path_a,omitempty"`
+	PathB  string `json:"path_b,omitempty"`
+}
+
+// Options configures Trees.
+type Options struct {
+	// MediaOnly restricts the comparison to media files recognized by scan.
+	MediaOnly bool
+}
+
+// Trees compares the files below rootA and rootB.
+//
+// Files are first matched by relative path; the remaining files are matched by content,
+// so a file that was reorganized into another folder is reported as moved rather than missing.
+// Entries are sorted by status (most actionable first) and path.
+func Trees(ctx context.Context, rootA, rootB string, opts Options) ([]Entry, error) {
+	filesA, err := listFiles(ctx, rootA, opts)
+	if err != nil {
+		return nil, err
+	}
+	filesB, err := listFiles(ctx, rootB, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	var onlyA []string
+	unmatchedB := make(map[string]bool)
+	for p := range filesB {
+		unmatchedB[p] = true
+	}
+
+	for p, sizeA := range filesA {
+		sizeB, ok := filesB[p]
+		if !ok {
+			onlyA = append(onlyA, p)
+			continue
+		}
+		delete(unmatchedB, p)
+
+		identical := false
+		if sizeA == sizeB {
+			identical, err = reconcile.Identical(ctx, abs(rootA, p), abs(rootB, p))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if identical {
+			entries = append(entries, Entry{Status: StatusIdentical, PathA: p, PathB: p})
+		} else {
+			entries = append(entries, Entry{Status: StatusDifferent, PathA: p, PathB: p})
+		}
+	}
+
+	// Match the remaining files by content.
+	bySizeB := make(map[int64][]string)
+	for p := range unmatchedB {
+		bySizeB[filesB[p]] = append(bySizeB[filesB[p]], p)
+	}
+	for _, candidates := range bySizeB {
+		sort.Strings(candidates)
+	}
+	sort.Strings(onlyA)
+
+	for _, p := range onlyA {
+		match := ""
+		for _, candidate := range bySizeB[filesA[p]] {
+			if !unmatchedB[candidate] {
+				continue
+			}
+			identical, err := reconcile.Identical(ctx, abs(rootA, p), abs(rootB, candidate))
+			if err != nil {
+				return nil, err
+			}
+			if identical {
+				match = candidate
+				break
+			}
+		}
+		if match == "" {
+			entries = append(entries, Entry{Status: StatusOnlyA, PathA: p})
+			continue
+		}
+		delete(unmatchedB, match)
+		entries = append(entries, Entry{Status: StatusMoved, PathA: p, PathB: match})
+	}
+
+	for p := range unmatchedB {
+		entries = append(entries, Entry{Status: StatusOnlyB, PathB: p})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if statusOrder[entries[i].Status] != statusOrder[entries[j].Status] {
+			return statusOrder[entries[i].Status] < statusOrder[entries[j].Status]
+		}
+		if entries[i].PathA != entries[j].PathA {
+			return entries[i].PathA < entries[j].PathA
+		}
+		return entries[i].PathB < entries[j].PathB
+	})
+	return entries, nil
+}
+
+// Counts returns the number of entries per status.
+func Counts(entries []Entry) map[Status]int {
+	counts := make(map[Status]int)
+	for _, e := range entries {
+		counts[e.Status]++
+	}
+	return counts
+}
+
+// listFiles returns the regular files below root keyed by relative path, with their sizes.
+func listFiles(ctx context.Context, root string, opts Options) (map[string]int64, error) {
+	files := make(map[string]int64)
+	fsys := os.DirFS(root)
+
+	if opts.MediaOnly {
+		records, err := scan.ScanRecords(ctx, fsys, ".", scan.DefaultOptions())
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			files[r.Path] = r.FileSizeBytes
+		}
+		return files, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[p] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func abs(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
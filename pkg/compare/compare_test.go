@@ -0,0 +1,77 @@
+package compare
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTrees(t *testing.T) {
+	a := t.TempDir()
+	b := t.TempDir()
+
+	writeTree(t, a, map[string]string{
+		"same.jpg":       "same",
+		"changed.jpg":    "old",
+		"old/moved.jpg":  "moved",
+		"gone.jpg":       "gone",
+		"notes/todo.txt": "todo",
+	})
+	writeTree(t, b, map[string]string{
+		"same.jpg":           "same",
+		"changed.jpg":        "new",
+		"2024/01/moved.jpg":  "moved",
+		"new.jpg":            "new file",
+		"notes/todo.txt":     "todo",
+		"notes/elsewhere.md": "x",
+	})
+
+	entries, err := Trees(context.Background(), a, b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Entry{
+		{Status: StatusOnlyA, PathA: "gone.jpg"},
+		{Status: StatusDifferent, PathA: "changed.jpg", PathB: "changed.jpg"},
+		{Status: StatusMoved, PathA: "old/moved.jpg", PathB: "2024/01/moved.jpg"},
+		{Status: StatusOnlyB, PathB: "new.jpg"},
+		{Status: StatusOnlyB, PathB: "notes/elsewhere.md"},
+		{Status: StatusIdentical, PathA: "notes/todo.txt", PathB: "notes/todo.txt"},
+		{Status: StatusIdentical, PathA: "same.jpg", PathB: "same.jpg"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("unexpected entries\n got: %+v\nwant: %+v", entries, want)
+	}
+}
+
+func TestTrees_MediaOnly(t *testing.T) {
+	a := t.TempDir()
+	b := t.TempDir()
+
+	writeTree(t, a, map[string]string{"a.jpg": "a", "notes.txt": "n"})
+	writeTree(t, b, map[string]string{"a.jpg": "a"})
+
+	entries, err := Trees(context.Background(), a, b, Options{MediaOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := Counts(entries); counts[StatusIdentical] != 1 || len(entries) != 1 {
+		t.Fatalf("expected only the media file to be compared, got %+v", entries)
+	}
+}
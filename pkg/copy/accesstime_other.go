@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !windows
+
+package copy
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime returns the modification time of the file of info: its access time is not known on this
+// platform.
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,24 @@
+//go:build darwin
+
+package copy
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setCreationTime sets the creation time of the file at path with setattrlist. File systems without
+// one, such as FAT volumes, keep the time they have.
+func setCreationTime(path string, t time.Time) error {
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	created := unix.NsecToTimespec(t.UnixNano())
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&created)), unsafe.Sizeof(created))
+	err := unix.Setattrlist(path, &attrs, buf, unix.FSOPT_NOFOLLOW)
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil
+	}
+	return err
+}
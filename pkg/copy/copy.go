@@ -1,18 +1,33 @@
 package copy
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/quidome/media-organizer-go/internal/ctxio"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
 	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/trash"
 )
 
 var (
 	// ErrDestinationExists is returned when attempting to copy to an existing file
-	ErrDestinationExists = errors.New("destination file already exists")
+	ErrDestinationExists = errcode.ErrDestinationConflict
+
+	// ErrRemoteTrash is returned for a move from a remote source with Options.Trash: the source is kept.
+	ErrRemoteTrash = errors.New("trash needs a local source")
 )
 
 // Result contains the outcome of a copy operation.
@@ -20,6 +35,18 @@ type Result struct {
 	Operation plan.Operation
 	Success   bool
 	Error     error
+
+	// SHA256 is the hex-encoded SHA-256 of the source content, set when Options.Checksum is true.
+	SHA256 string
+
+	// DestinationSHA256 is the hex-encoded SHA-256 of the content written, set when Options.Checksum
+	// is true. It differs from SHA256 only for operations with a Transform.
+	DestinationSHA256 string
+
+	// PartialError is what failed after a move removed the source of a successful operation: setting
+	// the times of the file, or one of its sidecars. The file stays moved; Operation.Sidecars then only
+	// holds the sidecars that were written.
+	PartialError error
 }
 
 // Options configures the copy behavior.
@@ -27,6 +54,73 @@ type Options struct {
 	// Overwrite allows overwriting existing files.
 	// Default should be false for safety.
 	Overwrite bool
+
+	// Move moves files instead of copying them: the source, and its sidecars, are removed once the
+	// destination is written. On the local filesystem, a file whose content is not transformed is
+	// renamed; otherwise it is copied and the source removed.
+	Move bool
+
+	// Trash, if set, takes the sources Move removes after copying them, instead of deleting them.
+	// Such moves then need a local source. Renamed files are not removed, so never reach it.
+	Trash trash.Trash
+
+	// Link links files into the destination instead of copying them, with hard or symbolic links (see
+	// Link). Content that is transformed or generated is written as usual. Linked files keep the times
+	// they share with their source: PreserveTimes and Operation.CreatedAt do not apply to them.
+	// It has no effect with Move.
+	Link Link
+
+	// Checksum computes the SHA-256 of every copied file while it is copied (Result.SHA256).
+	Checksum bool
+
+	// Verify reads every copied media file back from the destination and compares its SHA-256 with
+	// that of the content copied. A copy that differs is removed and fails with errcode.ErrVerifyFailed.
+	// Moves that copy are always verified before their source is removed; renamed files are not read.
+	Verify bool
+
+	// PreserveTimes gives every copy on the local filesystem, and its sidecars, the access and
+	// modification time of its source, instead of the time it was written. Operations with a CreatedAt
+	// get that time instead.
+	PreserveTimes bool
+
+	// Source and Destination are the filesystems files are read from and written to;
+	// nil means the local filesystem.
+	Source      destfs.FS
+	Destination destfs.FS
+
+	// OnStart, if set, is called before each operation is copied.
+	OnStart func(op plan.Operation)
+
+	// OnResult, if set, is called after each operation with the number of
+	// operations finished so far and the operation's result.
+	OnResult func(done int, r Result)
+
+	// OnProgress, if set, is called while the media file of op is copied with the number of bytes read
+	// from its source so far. Files renamed into place are not read, unless Checksum is set.
+	OnProgress func(op plan.Operation, read int64)
+}
+
+// Link is how Options.Link places files in the destination.
+type Link string
+
+const (
+	// LinkNone copies files.
+	LinkNone Link = ""
+	// LinkHard makes a hard link to the source, which takes no extra space but needs the source and the
+	// destination on one filesystem.
+	LinkHard Link = "hard"
+	// LinkSym makes a symbolic link to the absolute path of the source, which breaks when the source moves.
+	LinkSym Link = "sym"
+)
+
+// ParseLink converts a CLI value into a Link; the empty string is LinkNone.
+func ParseLink(s string) (Link, error) {
+	switch l := Link(strings.ToLower(strings.TrimSpace(s))); l {
+	case LinkNone, LinkHard, LinkSym:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid link mode %q (want hard or sym)", s)
+	}
 }
 
 // Execute performs copy operations for the given plans.
@@ -34,48 +128,280 @@ type Options struct {
 // It will:
 // - Create destination directories if they don't exist
 // - Never overwrite existing files (unless Overwrite is true)
-// - Copy files preserving content
-func Execute(operations []plan.Operation, opts Options) ([]Result, error) {
+// - Copy files preserving content, or move them with Options.Move
+//
+// When ctx is canceled, the file being copied is removed and Execute returns the
+// results of the operations finished so far together with ctx.Err().
+func Execute(ctx context.Context, operations []plan.Operation, opts Options) ([]Result, error) {
+	src, dst := destfs.OrOS(opts.Source), destfs.OrOS(opts.Destination)
 	results := make([]Result, 0, len(operations))
+	report := func(r Result) {
+		results = append(results, r)
+		if opts.OnResult != nil {
+			opts.OnResult(len(results), r)
+		}
+	}
 
 	for _, op := range operations {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
 		result := Result{Operation: op, Success: false}
+		if opts.OnStart != nil {
+			opts.OnStart(op)
+		}
+
+		// A source still being written, such as by a phone sync, is left for a later run.
+		if err := CheckSource(src, op); err != nil {
+			result.Error = err
+			report(result)
+			continue
+		}
 
 		// Create destination directory
 		destDir := filepath.Dir(op.DestinationPath)
-		if err := os.MkdirAll(destDir, 0o755); err != nil {
-			result.Error = fmt.Errorf("create directory: %w", err)
-			results = append(results, result)
+		if err := dst.MkdirAll(destDir, 0o755); err != nil {
+			result.Error = errcode.Wrap(errcode.WriteFailed, fmt.Errorf("create directory: %w", err))
+			report(result)
 			continue
 		}
 
 		// Copy the file (destination path is assumed finalized by planning/reconcile stages).
-		if err := copyFile(op.SourcePath, op.DestinationPath, opts.Overwrite); err != nil {
+		var sum, written hash.Hash
+		if opts.Checksum {
+			sum = sha256.New()
+			if op.Transform != nil {
+				written = sha256.New()
+			}
+		}
+		read, out := io.Writer(sum), io.Writer(written)
+		if opts.OnProgress != nil {
+			read = teeWriter(read, &progressWriter{op: op, fn: opts.OnProgress})
+		}
+		var expected hash.Hash
+		if opts.Verify && !opts.Move {
+			expected = sha256.New()
+			if op.Transform != nil {
+				out = teeWriter(out, expected)
+			} else {
+				read = teeWriter(read, expected)
+			}
+		}
+		linked := opts.linked(op)
+		// The source is gone once moved: its times are read before.
+		var times *fileTimes
+		if opts.PreserveTimes && op.CreatedAt.IsZero() && destfs.IsOS(dst) && !linked {
+			times = sourceTimes(src, op.SourcePath)
+		}
+		transfer := copyFile
+		switch {
+		case opts.Move:
+			transfer = opts.moveFile
+		case linked:
+			transfer = opts.Link.file
+		}
+		if err := transfer(ctx, src, dst, op, opts.Overwrite, read, out); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return results, ctxErr
+			}
 			result.Error = fmt.Errorf("copy file: %w", err)
-			results = append(results, result)
+			report(result)
 			continue
 		}
+		if expected != nil {
+			if err := verifyCopy(dst, op.DestinationPath, expected.Sum(nil)); err != nil {
+				if !opts.Overwrite {
+					_ = dst.Remove(op.DestinationPath)
+				}
+				result.Error = err
+				report(result)
+				continue
+			}
+		}
+
+		// Sidecars travel with the media file; a failed sidecar, like failed times, fails the operation
+		// with its copy in place. A moved file has no source left to fail with: the move succeeds with a
+		// PartialError, so it is still recorded.
+		var after error
+		if !op.CreatedAt.IsZero() && destfs.IsOS(dst) && !linked {
+			if err := setFileTimes(op.DestinationPath, op.CreatedAt); err != nil {
+				after = errcode.Wrap(errcode.WriteFailed, fmt.Errorf("set file times: %w", err))
+			}
+		}
+		if after == nil {
+			if err := times.apply(op.DestinationPath); err != nil {
+				after = errcode.Wrap(errcode.WriteFailed, fmt.Errorf("preserve file times: %w", err))
+			}
+		}
+		sidecars := 0
+		if after == nil {
+			sidecars, after = copySidecars(ctx, src, dst, op, opts)
+			if ctxErr := ctx.Err(); after != nil && ctxErr != nil && !opts.Move {
+				return results, ctxErr
+			}
+		}
+		if after != nil {
+			if !opts.Move {
+				result.Error = after
+				report(result)
+				continue
+			}
+			result.Operation.Sidecars = op.Sidecars[:sidecars]
+			result.PartialError = after
+		}
 
 		result.Success = true
-		results = append(results, result)
+		if sum != nil {
+			result.SHA256 = hex.EncodeToString(sum.Sum(nil))
+			result.DestinationSHA256 = result.SHA256
+		}
+		if written != nil {
+			result.DestinationSHA256 = hex.EncodeToString(written.Sum(nil))
+		}
+		report(result)
 	}
 
 	return results, nil
 }
 
-// copyFile copies a single file from src to dst.
-// If allowOverwrite is true, existing files will be overwritten.
-func copyFile(src, dst string, allowOverwrite bool) error {
-	srcFile, err := os.Open(src)
+// CheckSource returns an error matching errcode.ErrSourceChanged when the source of op no longer has
+// the size and modification time it was planned with, and one matching errcode.ErrSourceMismatch when
+// it no longer has its SourceSHA256. Operations without a SourceModTime or SourceSHA256 are not
+// checked for it.
+func CheckSource(fsys destfs.FS, op plan.Operation) error {
+	fsys = destfs.OrOS(fsys)
+	if !op.SourceModTime.IsZero() {
+		info, err := fsys.Stat(op.SourcePath)
+		if err != nil {
+			return &errcode.FileError{Op: "stat source", Path: op.SourcePath, Kind: errcode.ErrUnreadableSource, Err: err}
+		}
+		if info.Size() != op.SourceSize || !info.ModTime().Equal(op.SourceModTime) {
+			return &errcode.FileError{Op: "check source", Path: op.SourcePath, Kind: errcode.ErrSourceChanged, Err: fmt.Errorf(
+				"changed since it was planned: %d bytes modified %s, planned as %d bytes modified %s",
+				info.Size(), info.ModTime().Format(time.RFC3339), op.SourceSize, op.SourceModTime.Format(time.RFC3339))}
+		}
+	}
+	if op.SourceSHA256 == "" {
+		return nil
+	}
+	f, err := fsys.Open(op.SourcePath)
 	if err != nil {
-		return fmt.Errorf("open source: %w", err)
+		return &errcode.FileError{Op: "open source", Path: op.SourcePath, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return &errcode.FileError{Op: "read source", Path: op.SourcePath, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, op.SourceSHA256) {
+		return &errcode.FileError{Op: "check source", Path: op.SourcePath, Kind: errcode.ErrSourceMismatch, Err: fmt.Errorf(
+			"content changed since it was planned: SHA-256 %s, planned as %s", sum, op.SourceSHA256)}
+	}
+	return nil
+}
+
+// copySidecars copies or moves the sidecars of the media file of op, which has been transferred
+// already, in order. It returns how many it wrote, including one whose times then failed to be set.
+func copySidecars(ctx context.Context, src, dst destfs.FS, op plan.Operation, opts Options) (int, error) {
+	for i, sc := range op.Sidecars {
+		if sc.Content != nil {
+			if err := writeFile(dst, sc.DestinationPath, sc.Content, opts.Overwrite); err != nil {
+				return i, fmt.Errorf("write sidecar %s: %w", sc.DestinationPath, err)
+			}
+			continue
+		}
+		linked := opts.linked(sc)
+		var times *fileTimes
+		if opts.PreserveTimes && destfs.IsOS(dst) && !linked {
+			times = sourceTimes(src, sc.SourcePath)
+		}
+		var err error
+		switch {
+		case linked:
+			err = opts.Link.file(ctx, src, dst, sc, opts.Overwrite, nil, nil)
+		case opts.Move && sc.SourcePath == op.SourcePath:
+			// Derived from the media file (such as the video of a motion photo), which has moved.
+			sc.SourcePath = op.DestinationPath
+			err = copyFile(ctx, dst, dst, sc, opts.Overwrite, nil, nil)
+		case opts.Move:
+			err = opts.moveFile(ctx, src, dst, sc, opts.Overwrite, nil, nil)
+		default:
+			err = copyFile(ctx, src, dst, sc, opts.Overwrite, nil, nil)
+		}
+		if err != nil {
+			return i, fmt.Errorf("copy sidecar %s: %w", sc.SourcePath, err)
+		}
+		if err := times.apply(sc.DestinationPath); err != nil {
+			return i + 1, errcode.Wrap(errcode.WriteFailed, fmt.Errorf("preserve file times of sidecar %s: %w", sc.DestinationPath, err))
+		}
+	}
+	return len(op.Sidecars), nil
+}
+
+// writeFile writes generated content to dst in dstFS, with the same overwrite rules as copyFile.
+func writeFile(dstFS destfs.FS, dst string, content []byte, allowOverwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE
+	if !allowOverwrite {
+		flags |= os.O_EXCL
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	dstFile, err := dstFS.OpenFile(dst, flags, 0o644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return ErrDestinationExists
+		}
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("create destination: %w", err))
+	}
+	defer dstFile.Close()
+
+	if _, err := dstFile.Write(content); err != nil {
+		if !allowOverwrite {
+			_ = dstFS.Remove(dst)
+		}
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("write content: %w", err))
+	}
+	if err := dstFile.Sync(); err != nil {
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("sync: %w", err))
+	}
+	return nil
+}
+
+// copyFile copies the source of op in srcFS to its destination in dstFS, through op.Transform if set.
+// If allowOverwrite is true, existing files will be overwritten. A non-nil sum receives the source content
+// and a non-nil written the transformed content.
+func copyFile(ctx context.Context, srcFS, dstFS destfs.FS, op plan.Operation, allowOverwrite bool, sum, written io.Writer) error {
+	src, dst := op.SourcePath, op.DestinationPath
+	srcFile, err := srcFS.Open(src)
+	if err != nil {
+		return &errcode.FileError{Op: "open source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 	defer srcFile.Close()
 
 	// Get source file info for permissions
 	srcInfo, err := srcFile.Stat()
 	if err != nil {
-		return fmt.Errorf("stat source: %w", err)
+		return &errcode.FileError{Op: "stat source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+
+	// Copy content
+	var r io.Reader = ctxio.NewReader(ctx, srcFile)
+	if sum != nil {
+		r = io.TeeReader(r, sum)
+	}
+	if op.Transform != nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return &errcode.FileError{Op: "read source", Path: src, Kind: errcode.ErrUnreadableSource, Err: err}
+		}
+		if data, err = op.Transform(data); err != nil {
+			return fmt.Errorf("transform %s: %w", src, err)
+		}
+		if written != nil {
+			written.Write(data)
+		}
+		r = bytes.NewReader(data)
 	}
 
 	// Create destination file
@@ -86,28 +412,219 @@ func copyFile(src, dst string, allowOverwrite bool) error {
 		flags |= os.O_TRUNC
 	}
 
-	dstFile, err := os.OpenFile(dst, flags, srcInfo.Mode())
+	dstFile, err := dstFS.OpenFile(dst, flags, srcInfo.Mode())
 	if err != nil {
-		if os.IsExist(err) {
+		if errors.Is(err, fs.ErrExist) {
 			return ErrDestinationExists
 		}
-		return fmt.Errorf("create destination: %w", err)
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("create destination: %w", err))
 	}
 	defer dstFile.Close()
 
-	// Copy content
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
+	if _, err := io.Copy(dstFile, r); err != nil {
 		// Try to clean up partial file on error (only if we created it)
 		if !allowOverwrite {
-			_ = os.Remove(dst)
+			_ = dstFS.Remove(dst)
 		}
 		return fmt.Errorf("copy content: %w", err)
 	}
 
 	// Ensure data is written to disk
 	if err := dstFile.Sync(); err != nil {
-		return fmt.Errorf("sync: %w", err)
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("sync: %w", err))
+	}
+
+	return nil
+}
+
+// moveFile moves the source of op in srcFS to its destination in dstFS, with the same arguments as copyFile.
+// Files on the local filesystem that are not transformed are renamed, unless the filesystem cannot
+// (different devices, no hard links); the others are copied, and the source is only removed once the
+// copy reads back as written, into Options.Trash when set.
+func (o Options) moveFile(ctx context.Context, srcFS, dstFS destfs.FS, op plan.Operation, allowOverwrite bool, sum, written io.Writer) error {
+	if destfs.IsOS(srcFS) && destfs.IsOS(dstFS) && op.Transform == nil {
+		err := rename(op.SourcePath, op.DestinationPath, allowOverwrite)
+		if errors.Is(err, fs.ErrExist) {
+			return ErrDestinationExists
+		}
+		if err == nil {
+			if sum != nil {
+				return hashFile(op.DestinationPath, sum)
+			}
+			return nil
+		}
+	}
+
+	expected := sha256.New()
+	if op.Transform != nil {
+		written = teeWriter(written, expected)
+	} else {
+		sum = teeWriter(sum, expected)
+	}
+	if err := copyFile(ctx, srcFS, dstFS, op, allowOverwrite, sum, written); err != nil {
+		return err
+	}
+	if err := verifyCopy(dstFS, op.DestinationPath, expected.Sum(nil)); err != nil {
+		if !allowOverwrite {
+			_ = dstFS.Remove(op.DestinationPath)
+		}
+		// A move whose copy differs keeps its source, and the code it has always had.
+		return errcode.Wrap(errcode.WriteFailed, err)
+	}
+	if err := o.removeSource(srcFS, op.SourcePath); err != nil {
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("remove source: %w", err))
+	}
+	return nil
+}
+
+// removeSource removes the moved source at path in srcFS, or puts it into Options.Trash. A source
+// that cannot go into the trash is kept rather than deleted.
+func (o Options) removeSource(srcFS destfs.FS, path string) error {
+	if o.Trash == nil {
+		return srcFS.Remove(path)
+	}
+	if !destfs.IsOS(srcFS) {
+		return ErrRemoteTrash
+	}
+	return o.Trash.Put(path)
+}
+
+// linked reports whether op is linked rather than copied or moved.
+func (o Options) linked(op plan.Operation) bool {
+	return o.Link != LinkNone && !o.Move && op.Transform == nil
+}
+
+// file links the source of op in srcFS to its destination in dstFS, with the same arguments as copyFile.
+// Both must be the local filesystem.
+func (l Link) file(_ context.Context, srcFS, dstFS destfs.FS, op plan.Operation, allowOverwrite bool, sum, _ io.Writer) error {
+	if !destfs.IsOS(srcFS) || !destfs.IsOS(dstFS) {
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("%s link %s: links need the local filesystem", l, op.SourcePath))
+	}
+	if _, err := os.Stat(op.SourcePath); err != nil {
+		return &errcode.FileError{Op: "stat source", Path: op.SourcePath, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if allowOverwrite {
+		if err := os.Remove(op.DestinationPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("replace destination: %w", err))
+		}
+	}
+	var err error
+	switch l {
+	case LinkHard:
+		err = os.Link(op.SourcePath, op.DestinationPath)
+	case LinkSym:
+		var target string
+		if target, err = filepath.Abs(op.SourcePath); err == nil {
+			err = os.Symlink(target, op.DestinationPath)
+		}
+	default:
+		err = fmt.Errorf("invalid link mode %q", l)
 	}
+	switch {
+	case errors.Is(err, fs.ErrExist):
+		return ErrDestinationExists
+	case err != nil:
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("%s link: %w", l, err))
+	case sum != nil:
+		return hashFile(op.DestinationPath, sum)
+	}
+	return nil
+}
 
+// verifyCopy reads the file at path in fsys back and checks that its SHA-256 is want. A copy that
+// differs fails with errcode.ErrVerifyFailed.
+func verifyCopy(fsys destfs.FS, path string, want []byte) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("verify copy: %w", err))
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return errcode.Wrap(errcode.WriteFailed, fmt.Errorf("verify copy: %w", err))
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return &errcode.FileError{Op: "verify copy", Path: path, Kind: errcode.ErrVerifyFailed, Err: fmt.Errorf(
+			"SHA-256 %x read back does not match %x copied", got, want)}
+	}
 	return nil
 }
+
+// teeWriter returns a writer writing to w, when not nil, and h.
+func teeWriter(w io.Writer, h io.Writer) io.Writer {
+	if w == nil {
+		return h
+	}
+	return io.MultiWriter(w, h)
+}
+
+// rename renames src to dst on the local filesystem. Without allowOverwrite an existing dst fails
+// with fs.ErrExist: the file is linked under its new name before the old one is removed, since
+// os.Rename replaces its target.
+func rename(src, dst string, allowOverwrite bool) error {
+	if allowOverwrite {
+		return os.Rename(src, dst)
+	}
+	if err := os.Link(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// setFileTimes sets the access, modification and, where the platform keeps one, creation time of
+// the local file at path to t: Windows Explorer and some NAS indexers sort by creation time.
+func setFileTimes(path string, t time.Time) error {
+	if err := os.Chtimes(path, t, t); err != nil {
+		return err
+	}
+	return setCreationTime(path, t)
+}
+
+// fileTimes are the access and modification time of a source, for Options.PreserveTimes.
+type fileTimes struct {
+	atime, mtime time.Time
+}
+
+// sourceTimes returns the times of the source at path in fsys, or nil when it cannot be stat'ed: the
+// copy then reports why it cannot be read.
+func sourceTimes(fsys destfs.FS, path string) *fileTimes {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return nil
+	}
+	return &fileTimes{atime: accessTime(info), mtime: info.ModTime()}
+}
+
+// apply sets the times of the local file at path to t. A nil t leaves them as they are.
+func (t *fileTimes) apply(path string) error {
+	if t == nil {
+		return nil
+	}
+	return os.Chtimes(path, t.atime, t.mtime)
+}
+
+// hashFile writes the content of the local file at path to h.
+func hashFile(path string, h io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return &errcode.FileError{Op: "open destination", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return &errcode.FileError{Op: "read destination", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	return nil
+}
+
+// progressWriter counts the bytes of op written to it for Options.OnProgress.
+type progressWriter struct {
+	op plan.Operation
+	fn func(op plan.Operation, read int64)
+	n  int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	p.fn(p.op, p.n)
+	return len(b), nil
+}
@@ -1,11 +1,19 @@
 package copy
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
 	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/trash"
 )
 
 func TestExecute_CopiesFileAndCreatesDirs(t *testing.T) {
@@ -21,7 +29,7 @@ func TestExecute_CopiesFileAndCreatesDirs(t *testing.T) {
 	destPath := filepath.Join(tmpDst, "2023", "11", "15", "test.jpg")
 	ops := []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}
 
-	results, err := Execute(ops, Options{Overwrite: false})
+	results, err := Execute(context.Background(), ops, Options{Overwrite: false})
 	if err != nil {
 		t.Fatalf("Execute: %v", err)
 	}
@@ -56,13 +64,16 @@ func TestExecute_DoesNotOverwrite(t *testing.T) {
 	}
 
 	op := plan.Operation{SourcePath: srcPath, DestinationPath: destPath}
-	results, err := Execute([]plan.Operation{op}, Options{Overwrite: false})
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{Overwrite: false})
 	if err != nil {
 		t.Fatalf("Execute: %v", err)
 	}
 	if results[0].Success {
 		t.Fatalf("expected failure when destination exists")
 	}
+	if code := errcode.Of(results[0].Error); code != errcode.DestExists {
+		t.Fatalf("error code = %q, want %q", code, errcode.DestExists)
+	}
 
 	got, err := os.ReadFile(destPath)
 	if err != nil {
@@ -73,6 +84,80 @@ func TestExecute_DoesNotOverwrite(t *testing.T) {
 	}
 }
 
+func TestExecute_MissingSourceIsReadFailure(t *testing.T) {
+	tmp := t.TempDir()
+
+	op := plan.Operation{SourcePath: filepath.Join(tmp, "gone.jpg"), DestinationPath: filepath.Join(tmp, "out", "gone.jpg")}
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success {
+		t.Fatalf("expected failure for missing source")
+	}
+	if code := errcode.Of(results[0].Error); code != errcode.ReadFailed {
+		t.Fatalf("error code = %q, want %q", code, errcode.ReadFailed)
+	}
+	if !errors.Is(results[0].Error, errcode.ErrUnreadableSource) || !errors.Is(results[0].Error, fs.ErrNotExist) {
+		t.Fatalf("expected ErrUnreadableSource wrapping fs.ErrNotExist, got %v", results[0].Error)
+	}
+}
+
+func TestExecute_ChangedSourceIsNotCopied(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "a.jpg")
+	if err := os.WriteFile(src, []byte("synced"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := plan.Operation{SourcePath: src, DestinationPath: filepath.Join(tmp, "out", "a.jpg"), SourceSize: info.Size(), SourceModTime: info.ModTime()}
+	changed := op
+	changed.DestinationPath = filepath.Join(tmp, "out", "b.jpg")
+	changed.SourceSize = 3
+	results, err := Execute(context.Background(), []plan.Operation{op, changed}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Errorf("expected the unchanged source to be copied: %v", results[0].Error)
+	}
+	if results[1].Success || errcode.Of(results[1].Error) != errcode.SourceChanged || !errors.Is(results[1].Error, errcode.ErrSourceChanged) {
+		t.Fatalf("expected E_SOURCE_CHANGED, got %v", results[1].Error)
+	}
+	if _, err := os.Stat(changed.DestinationPath); !os.IsNotExist(err) {
+		t.Errorf("expected the changed source not to be copied: %v", err)
+	}
+}
+
+func TestExecute_CanceledContext(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	srcPath := filepath.Join(tmpSrc, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("data"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	destPath := filepath.Join(tmpDst, "out", "test.jpg")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := Execute(ctx, []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}, Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no results, got %+v", results)
+	}
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Fatalf("destination should not exist, stat err = %v", err)
+	}
+}
+
 func TestExecute_OverwriteWhenEnabled(t *testing.T) {
 	tmpSrc := t.TempDir()
 	tmpDst := t.TempDir()
@@ -88,7 +173,7 @@ func TestExecute_OverwriteWhenEnabled(t *testing.T) {
 	}
 
 	op := plan.Operation{SourcePath: srcPath, DestinationPath: destPath}
-	results, err := Execute([]plan.Operation{op}, Options{Overwrite: true})
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{Overwrite: true})
 	if err != nil {
 		t.Fatalf("Execute: %v", err)
 	}
@@ -123,7 +208,7 @@ func TestExecute_MultipleOperations(t *testing.T) {
 		{SourcePath: s2, DestinationPath: filepath.Join(tmpDst, "2023", "11", "16", "b.jpg")},
 	}
 
-	results, err := Execute(ops, Options{Overwrite: false})
+	results, err := Execute(context.Background(), ops, Options{Overwrite: false})
 	if err != nil {
 		t.Fatalf("Execute: %v", err)
 	}
@@ -136,3 +221,663 @@ func TestExecute_MultipleOperations(t *testing.T) {
 		}
 	}
 }
+
+func TestExecute_CopiesSidecars(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	srcPath := filepath.Join(tmpSrc, "IMG_1.jpg")
+	sidecarPath := filepath.Join(tmpSrc, "IMG_1.xmp")
+	if err := os.WriteFile(srcPath, []byte("media"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := os.WriteFile(sidecarPath, []byte("xmp"), 0o644); err != nil {
+		t.Fatalf("write sidecar: %v", err)
+	}
+
+	destDir := filepath.Join(tmpDst, "2023", "11", "15")
+	op := plan.Operation{
+		SourcePath:      srcPath,
+		DestinationPath: filepath.Join(destDir, "IMG_1.jpg"),
+		Sidecars: []plan.Operation{
+			{SourcePath: sidecarPath, DestinationPath: filepath.Join(destDir, "IMG_1.xmp")},
+		},
+	}
+
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+
+	got, err := os.ReadFile(filepath.Join(destDir, "IMG_1.xmp"))
+	if err != nil {
+		t.Fatalf("read sidecar destination: %v", err)
+	}
+	if string(got) != "xmp" {
+		t.Fatalf("sidecar content mismatch: %q", got)
+	}
+}
+
+func TestExecute_WritesGeneratedSidecars(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	srcPath := filepath.Join(tmpSrc, "IMG_1.jpg")
+	if err := os.WriteFile(srcPath, []byte("media"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	sidecarDst := filepath.Join(tmpDst, "IMG_1.jpg.xmp")
+	if err := os.WriteFile(sidecarDst, []byte("existing"), 0o644); err != nil {
+		t.Fatalf("write existing sidecar: %v", err)
+	}
+
+	op := plan.Operation{
+		SourcePath:      srcPath,
+		DestinationPath: filepath.Join(tmpDst, "IMG_1.jpg"),
+		Sidecars:        []plan.Operation{{DestinationPath: sidecarDst, Content: []byte("generated")}},
+	}
+
+	// A generated sidecar never replaces an existing file.
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success || !errors.Is(results[0].Error, ErrDestinationExists) {
+		t.Fatalf("expected a destination conflict, got %v", results[0].Error)
+	}
+
+	if err := os.Remove(sidecarDst); err != nil {
+		t.Fatal(err)
+	}
+	op.DestinationPath = filepath.Join(tmpDst, "IMG_2.jpg")
+	results, err = Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+	got, err := os.ReadFile(sidecarDst)
+	if err != nil {
+		t.Fatalf("read generated sidecar: %v", err)
+	}
+	if string(got) != "generated" {
+		t.Fatalf("sidecar content mismatch: %q", got)
+	}
+}
+
+func TestExecute_SetsFileTimes(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+	srcPath := filepath.Join(tmpSrc, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("test content"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	created := time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)
+	destPath := filepath.Join(tmpDst, "2019", "06", "01", "test.jpg")
+	ops := []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath, CreatedAt: created}}
+	results, err := Execute(context.Background(), ops, Options{})
+	if err != nil || !results[0].Success {
+		t.Fatalf("Execute: %v, %+v", err, results)
+	}
+	info, err := os.Stat(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(created) {
+		t.Errorf("expected mtime %v, got %v", created, info.ModTime())
+	}
+
+	// Destinations without file times are written as they are.
+	mem := destfs.NewMem()
+	results, err = Execute(context.Background(), ops, Options{Destination: mem})
+	if err != nil || !results[0].Success {
+		t.Fatalf("Execute on a destination filesystem: %v, %+v", err, results)
+	}
+}
+
+func TestExecute_PreservesSourceTimes(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+	srcPath := filepath.Join(tmpSrc, "test.jpg")
+	sidecarPath := filepath.Join(tmpSrc, "test.xmp")
+	if err := os.WriteFile(srcPath, []byte("test content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sidecarPath, []byte("xmp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	atime := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	mtime := time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC)
+	for _, p := range []string{srcPath, sidecarPath} {
+		if err := os.Chtimes(p, atime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	destPath := filepath.Join(tmpDst, "test.jpg")
+	ops := []plan.Operation{{
+		SourcePath: srcPath, DestinationPath: destPath,
+		Sidecars: []plan.Operation{{SourcePath: sidecarPath, DestinationPath: filepath.Join(tmpDst, "test.xmp")}},
+	}}
+	results, err := Execute(context.Background(), ops, Options{PreserveTimes: true})
+	if err != nil || !results[0].Success {
+		t.Fatalf("Execute: %v, %+v", err, results)
+	}
+	for _, p := range []string{destPath, filepath.Join(tmpDst, "test.xmp")} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected mtime %v, got %v", filepath.Base(p), mtime, info.ModTime())
+		}
+	}
+
+	// Without PreserveTimes the copy has the time it was written.
+	ops = []plan.Operation{{SourcePath: srcPath, DestinationPath: filepath.Join(tmpDst, "copy.jpg")}}
+	if _, err := Execute(context.Background(), ops, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(ops[0].DestinationPath); err != nil || info.ModTime().Equal(mtime) {
+		t.Errorf("expected the copy to have the time it was written, got %v", err)
+	}
+}
+
+func TestExecute_Checksum(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	srcPath := filepath.Join(tmpSrc, "a.jpg")
+	if err := os.WriteFile(srcPath, []byte("abc"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	op := plan.Operation{SourcePath: srcPath, DestinationPath: filepath.Join(tmpDst, "a.jpg")}
+
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{Checksum: true})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if results[0].SHA256 != want || results[0].DestinationSHA256 != want {
+		t.Errorf("got checksums %q and %q, want %q", results[0].SHA256, results[0].DestinationSHA256, want)
+	}
+}
+
+func TestExecute_TransformRewritesContent(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	srcPath := filepath.Join(tmpSrc, "a.jpg")
+	if err := os.WriteFile(srcPath, []byte("abc"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	destPath := filepath.Join(tmpDst, "a.jpg")
+	op := plan.Operation{SourcePath: srcPath, DestinationPath: destPath, Transform: func(b []byte) ([]byte, error) {
+		return bytes.ToUpper(b), nil
+	}}
+
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{Checksum: true})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("copy failed: %v", results[0].Error)
+	}
+	if got, _ := os.ReadFile(destPath); string(got) != "ABC" {
+		t.Errorf("destination content %q, want ABC", got)
+	}
+	// The checksum is of the source, so the file is recognized on a later import.
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if results[0].SHA256 != want {
+		t.Errorf("got checksum %q, want %q", results[0].SHA256, want)
+	}
+	// sha256("ABC")
+	const wantWritten = "b5d4045c3f466fa91fe2cc6abe79232a1a57cdf104f7a26e716e0a1e2789df78"
+	if results[0].DestinationSHA256 != wantWritten {
+		t.Errorf("got destination checksum %q, want %q", results[0].DestinationSHA256, wantWritten)
+	}
+
+	op.DestinationPath = filepath.Join(tmpDst, "b.jpg")
+	op.Transform = func([]byte) ([]byte, error) { return nil, errors.New("boom") }
+	results, err = Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success {
+		t.Fatalf("expected the failed transform to fail the copy")
+	}
+	if _, err := os.Stat(op.DestinationPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no destination file, got %v", err)
+	}
+}
+
+func TestExecute_OnResultReportsEachOperation(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	s1 := filepath.Join(tmpSrc, "a.jpg")
+	if err := os.WriteFile(s1, []byte("a"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	ops := []plan.Operation{
+		{SourcePath: s1, DestinationPath: filepath.Join(tmpDst, "a.jpg")},
+		{SourcePath: filepath.Join(tmpSrc, "missing.jpg"), DestinationPath: filepath.Join(tmpDst, "missing.jpg")},
+	}
+
+	var dones []int
+	var successes []bool
+	_, err := Execute(context.Background(), ops, Options{OnResult: func(done int, r Result) {
+		dones = append(dones, done)
+		successes = append(successes, r.Success)
+	}})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(dones) != 2 || dones[0] != 1 || dones[1] != 2 {
+		t.Fatalf("unexpected done counts %v", dones)
+	}
+	if !successes[0] || successes[1] {
+		t.Fatalf("unexpected successes %v", successes)
+	}
+}
+
+func TestExecute_OnProgressReportsBytesRead(t *testing.T) {
+	tmpSrc := t.TempDir()
+	tmpDst := t.TempDir()
+
+	src := filepath.Join(tmpSrc, "a.mp4")
+	content := bytes.Repeat([]byte("a"), 100_000)
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	var last int64
+	calls := 0
+	op := plan.Operation{SourcePath: src, DestinationPath: filepath.Join(tmpDst, "a.mp4")}
+	_, err := Execute(context.Background(), []plan.Operation{op}, Options{OnProgress: func(got plan.Operation, read int64) {
+		if got.SourcePath != src || read <= last {
+			t.Errorf("unexpected progress %s %d after %d", got.SourcePath, read, last)
+		}
+		last = read
+		calls++
+	}})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if last != int64(len(content)) || calls < 2 {
+		t.Errorf("got %d bytes in %d calls, want %d in several", last, calls, len(content))
+	}
+}
+
+func TestExecute_WritesToDestinationFS(t *testing.T) {
+	tmpSrc := t.TempDir()
+	srcPath := filepath.Join(tmpSrc, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("new"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	dst := destfs.NewMem()
+	existing := filepath.Join(string(filepath.Separator), "lib", "taken.jpg")
+	dst.WriteFile(existing, []byte("old"))
+	destPath := filepath.Join(string(filepath.Separator), "lib", "2023", "11", "15", "test.jpg")
+
+	ops := []plan.Operation{
+		{SourcePath: srcPath, DestinationPath: destPath},
+		{SourcePath: srcPath, DestinationPath: existing},
+	}
+	results, err := Execute(context.Background(), ops, Options{Destination: dst})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+	if got, err := dst.ReadFile(destPath); err != nil || string(got) != "new" {
+		t.Fatalf("destination content = %q, %v", got, err)
+	}
+	if results[1].Success || !errors.Is(results[1].Error, ErrDestinationExists) {
+		t.Fatalf("expected ErrDestinationExists, got %v", results[1].Error)
+	}
+}
+
+func TestExecute_Move(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return p
+	}
+	srcPath := write("IMG_1.jpg", "media")
+	sidecarPath := write("IMG_1.xmp", "xmp")
+	takenPath := write("IMG_2.jpg", "other")
+	existing := write("taken.jpg", "old")
+
+	destDir := filepath.Join(dir, "2023", "11", "15")
+	ops := []plan.Operation{
+		{
+			SourcePath:      srcPath,
+			DestinationPath: filepath.Join(destDir, "IMG_1.jpg"),
+			Sidecars: []plan.Operation{
+				{SourcePath: sidecarPath, DestinationPath: filepath.Join(destDir, "IMG_1.xmp")},
+				{SourcePath: srcPath, DestinationPath: filepath.Join(destDir, "IMG_1.txt"), Transform: func(b []byte) ([]byte, error) { return bytes.ToUpper(b), nil }},
+			},
+		},
+		{SourcePath: takenPath, DestinationPath: existing},
+	}
+	results, err := Execute(context.Background(), ops, Options{Move: true, Checksum: true})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+	for name, want := range map[string]string{"IMG_1.jpg": "media", "IMG_1.xmp": "xmp", "IMG_1.txt": "MEDIA"} {
+		if got, err := os.ReadFile(filepath.Join(destDir, name)); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	for _, p := range []string{srcPath, sidecarPath} {
+		if _, err := os.Stat(p); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s to be moved, got %v", p, err)
+		}
+	}
+	if results[0].SHA256 == "" {
+		t.Errorf("expected the checksum of a renamed file")
+	}
+
+	if results[1].Success || !errors.Is(results[1].Error, ErrDestinationExists) {
+		t.Fatalf("expected ErrDestinationExists, got %v", results[1].Error)
+	}
+	if got, err := os.ReadFile(existing); err != nil || string(got) != "old" {
+		t.Errorf("existing destination = %q, %v", got, err)
+	}
+	if _, err := os.Stat(takenPath); err != nil {
+		t.Errorf("expected the source of a failed move to stay: %v", err)
+	}
+}
+
+func TestExecute_Link(t *testing.T) {
+	for _, mode := range []Link{LinkHard, LinkSym} {
+		t.Run(string(mode), func(t *testing.T) {
+			dir := t.TempDir()
+			write := func(name, content string) string {
+				p := filepath.Join(dir, name)
+				if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+					t.Fatalf("write %s: %v", name, err)
+				}
+				return p
+			}
+			srcPath := write("IMG_1.jpg", "media")
+			sidecarPath := write("IMG_1.xmp", "xmp")
+			takenPath := write("IMG_2.jpg", "other")
+			existing := write("taken.jpg", "old")
+			info, err := os.Stat(srcPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			destDir := filepath.Join(dir, "2023", "11", "15")
+			ops := []plan.Operation{
+				{
+					SourcePath:      srcPath,
+					DestinationPath: filepath.Join(destDir, "IMG_1.jpg"),
+					CreatedAt:       time.Date(2023, 11, 15, 10, 0, 0, 0, time.UTC),
+					Sidecars: []plan.Operation{
+						{SourcePath: sidecarPath, DestinationPath: filepath.Join(destDir, "IMG_1.xmp")},
+						{SourcePath: srcPath, DestinationPath: filepath.Join(destDir, "IMG_1.txt"), Transform: func(b []byte) ([]byte, error) { return bytes.ToUpper(b), nil }},
+					},
+				},
+				{SourcePath: takenPath, DestinationPath: existing},
+			}
+			results, err := Execute(context.Background(), ops, Options{Link: mode, Checksum: true, PreserveTimes: true})
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if !results[0].Success || results[0].SHA256 == "" {
+				t.Fatalf("expected success with a checksum, got %+v", results[0])
+			}
+			for name, src := range map[string]string{"IMG_1.jpg": srcPath, "IMG_1.xmp": sidecarPath} {
+				dst := filepath.Join(destDir, name)
+				lst, err := os.Lstat(dst)
+				if err != nil {
+					t.Fatal(err)
+				}
+				srcInfo, _ := os.Stat(src)
+				dstInfo, _ := os.Stat(dst)
+				if symlink := lst.Mode()&fs.ModeSymlink != 0; symlink != (mode == LinkSym) || !os.SameFile(srcInfo, dstInfo) {
+					t.Errorf("%s: expected a %s link to %s, got mode %v", name, mode, src, lst.Mode())
+				}
+			}
+			if target, err := os.Readlink(filepath.Join(destDir, "IMG_1.jpg")); mode == LinkSym && (err != nil || target != srcPath) {
+				t.Errorf("symlink target %q, %v; want %q", target, err, srcPath)
+			}
+			if got, err := os.ReadFile(filepath.Join(destDir, "IMG_1.txt")); err != nil || string(got) != "MEDIA" {
+				t.Errorf("expected a transformed sidecar to be written, got %q, %v", got, err)
+			}
+			if after, err := os.Stat(srcPath); err != nil || !after.ModTime().Equal(info.ModTime()) {
+				t.Errorf("expected the times of the source to be left alone, got %v, %v", after.ModTime(), err)
+			}
+
+			if results[1].Success || !errors.Is(results[1].Error, ErrDestinationExists) {
+				t.Fatalf("expected ErrDestinationExists, got %v", results[1].Error)
+			}
+			if got, err := os.ReadFile(existing); err != nil || string(got) != "old" {
+				t.Errorf("existing destination = %q, %v", got, err)
+			}
+		})
+	}
+
+	if _, err := ParseLink("copy"); err == nil {
+		t.Errorf("expected an unknown link mode to fail")
+	}
+}
+
+func TestExecute_MoveOnDestinationFS(t *testing.T) {
+	fsys := destfs.NewMem()
+	srcPath := filepath.Join(string(filepath.Separator), "lib", "test.jpg")
+	destPath := filepath.Join(string(filepath.Separator), "lib", "2023", "11", "15", "test.jpg")
+	fsys.WriteFile(srcPath, []byte("content"))
+
+	ops := []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}
+	results, err := Execute(context.Background(), ops, Options{Move: true, Source: fsys, Destination: fsys})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+	if got, err := fsys.ReadFile(destPath); err != nil || string(got) != "content" {
+		t.Fatalf("destination content = %q, %v", got, err)
+	}
+	if _, err := fsys.Stat(srcPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the source to be removed, got %v", err)
+	}
+}
+
+func TestExecute_MoveToTrash(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := trash.Dir{Path: filepath.Join(dir, "trash")}
+	dst := destfs.NewMem()
+	destPath := filepath.Join(string(filepath.Separator), "lib", "test.jpg")
+
+	results, err := Execute(context.Background(), []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}, Options{Move: true, Destination: dst, Trash: bin})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if !results[0].Success {
+		t.Fatalf("expected success, got %v", results[0].Error)
+	}
+	if _, err := os.Stat(srcPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the source to be moved, got %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(bin.Path, "test.jpg")); err != nil || string(got) != "content" {
+		t.Fatalf("trashed source = %q, %v", got, err)
+	}
+
+	// A remote source cannot go into a local trash, and is kept.
+	src := destfs.NewMem()
+	src.WriteFile(destPath, []byte("content"))
+	results, err = Execute(context.Background(), []plan.Operation{{SourcePath: destPath, DestinationPath: filepath.Join(dir, "out.jpg")}}, Options{Move: true, Source: src, Trash: bin})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success || !errors.Is(results[0].Error, ErrRemoteTrash) {
+		t.Fatalf("expected ErrRemoteTrash, got %v", results[0].Error)
+	}
+	if _, err := src.Stat(destPath); err != nil {
+		t.Fatalf("expected the remote source to be kept, got %v", err)
+	}
+}
+
+// lossyFS drops the last byte of every write to the files it creates, while reporting it as written.
+type lossyFS struct {
+	*destfs.Mem
+}
+
+func (l lossyFS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	f, err := l.Mem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return lossyFile{f}, nil
+}
+
+type lossyFile struct {
+	destfs.File
+}
+
+func (f lossyFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := f.File.Write(p[:len(p)-1]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestExecute_MoveKeepsSourceWhenCopyDiffers(t *testing.T) {
+	tmp := t.TempDir()
+	srcPath := filepath.Join(tmp, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst := lossyFS{destfs.NewMem()}
+	destPath := filepath.Join(string(filepath.Separator), "lib", "test.jpg")
+
+	results, err := Execute(context.Background(), []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}, Options{Move: true, Destination: dst})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success || errcode.Of(results[0].Error) != errcode.WriteFailed {
+		t.Fatalf("expected the move to fail verification, got %v", results[0].Error)
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		t.Errorf("expected the source to stay: %v", err)
+	}
+	if _, err := dst.Stat(destPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the bad copy to be removed, got %v", err)
+	}
+}
+
+func TestExecute_MoveWithFailedSidecar(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return p
+	}
+	srcPath := write("IMG_1.jpg", "media")
+	xmpPath := write("IMG_1.xmp", "xmp")
+	aaePath := write("IMG_1.aae", "aae")
+	destDir := filepath.Join(dir, "2023")
+	write(filepath.Join("2023", "IMG_1.aae"), "taken")
+
+	op := plan.Operation{
+		SourcePath:      srcPath,
+		DestinationPath: filepath.Join(destDir, "IMG_1.jpg"),
+		Sidecars: []plan.Operation{
+			{SourcePath: xmpPath, DestinationPath: filepath.Join(destDir, "IMG_1.xmp")},
+			{SourcePath: aaePath, DestinationPath: filepath.Join(destDir, "IMG_1.aae")},
+		},
+	}
+	results, err := Execute(context.Background(), []plan.Operation{op}, Options{Move: true})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	// The media file has moved, so the operation is done; the sidecar that failed is reported apart.
+	r := results[0]
+	if !r.Success || r.Error != nil || r.PartialError == nil {
+		t.Fatalf("expected a successful move with a partial error, got %+v", r)
+	}
+	if len(r.Operation.Sidecars) != 1 || r.Operation.Sidecars[0].SourcePath != xmpPath {
+		t.Errorf("expected only the moved sidecar in the result, got %+v", r.Operation.Sidecars)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "IMG_1.jpg")); err != nil {
+		t.Errorf("expected the media file moved: %v", err)
+	}
+	if _, err := os.Stat(aaePath); err != nil {
+		t.Errorf("expected the sidecar that failed to stay in the source: %v", err)
+	}
+
+	// A copy keeps its source, and still fails.
+	srcPath = write("IMG_2.jpg", "media")
+	op = plan.Operation{SourcePath: srcPath, DestinationPath: filepath.Join(destDir, "IMG_2.jpg"), Sidecars: []plan.Operation{
+		{SourcePath: aaePath, DestinationPath: filepath.Join(destDir, "IMG_1.aae")},
+	}}
+	results, err = Execute(context.Background(), []plan.Operation{op}, Options{})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success || results[0].Error == nil {
+		t.Errorf("expected a copy with a failed sidecar to fail, got %+v", results[0])
+	}
+}
+
+func TestExecute_VerifyRemovesCopyThatDiffers(t *testing.T) {
+	tmp := t.TempDir()
+	srcPath := filepath.Join(tmp, "test.jpg")
+	if err := os.WriteFile(srcPath, []byte("content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(string(filepath.Separator), "lib", "test.jpg")
+	ops := []plan.Operation{{SourcePath: srcPath, DestinationPath: destPath}}
+
+	good := destfs.NewMem()
+	results, err := Execute(context.Background(), ops, Options{Verify: true, Destination: good})
+	if err != nil || !results[0].Success {
+		t.Fatalf("expected a verified copy, got %v, %v", err, results[0].Error)
+	}
+
+	dst := lossyFS{destfs.NewMem()}
+	results, err = Execute(context.Background(), ops, Options{Verify: true, Destination: dst})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if results[0].Success || errcode.Of(results[0].Error) != errcode.VerifyFailed || !errors.Is(results[0].Error, errcode.ErrVerifyFailed) {
+		t.Fatalf("expected the copy to fail verification, got %v", results[0].Error)
+	}
+	if _, err := dst.Stat(destPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the bad copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		t.Errorf("expected the source to stay: %v", err)
+	}
+}
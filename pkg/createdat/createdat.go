@@ -1,28 +1,41 @@
 package createdat
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/video"
 )
 
 // Source describes where a CreatedAt timestamp was derived from.
 //
 // The priority order is:
-//  1. metadata
-//  2. filename
-//  3. mtime
-//  4. unknown
+//  1. catalog
+//  2. metadata
+//  3. filename
+//  4. directory
+//  5. mtime
+//  6. unknown
 type Source string
 
 const (
+	// SourceCatalog is a date recorded by a photo management application (e.g. Apple Photos),
+	// which may include corrections the user made there, or a date assigned by hand (set-date).
+	SourceCatalog  Source = "catalog"
 	SourceMetadata Source = "metadata"
 	SourceFilename Source = "filename"
-	SourceMtime    Source = "mtime"
-	SourceUnknown  Source = "unknown"
+	// SourceDirectory is the date of the directory an earlier layout placed the file in, set with WithDirectory.
+	SourceDirectory Source = "directory"
+	SourceMtime     Source = "mtime"
+	SourceUnknown   Source = "unknown"
 )
 
 // Result contains a best-effort creation timestamp and its source.
@@ -33,9 +46,12 @@ type Result struct {
 
 // DetailedResult contains all considered timestamps from different sources.
 type DetailedResult struct {
-	// Best is the chosen timestamp using priority: metadata > filename > mtime
+	// Best is the chosen timestamp using priority: catalog > metadata > filename > mtime
 	Best Result
 
+	// Catalog is the timestamp recorded by a photo catalog, set with WithCatalog.
+	Catalog time.Time
+
 	// Metadata is the timestamp extracted from embedded metadata (EXIF, etc.)
 	Metadata time.Time
 
@@ -44,6 +60,185 @@ type DetailedResult struct {
 
 	// Filestat is the mtime from filesystem metadata
 	Filestat time.Time
+
+	// Directory is the date of the directory the file was found in, set with WithDirectory.
+	Directory time.Time
+
+	// Track is how a GPS track agrees with Best, set with WithTrack.
+	Track TrackMatch
+
+	// ClockOffset is how far the camera clock was ahead of the real time; Best is corrected for it.
+	// Set with WithClockOffset.
+	ClockOffset time.Duration
+
+	// MetadataErr is the error of the metadata extractor, if any. It does not fail
+	// the attribution; the filename and mtime candidates are still used.
+	MetadataErr error
+}
+
+// WithCatalog returns d with a catalog timestamp, which takes priority over every other candidate.
+// A zero t leaves d unchanged.
+func (d DetailedResult) WithCatalog(t time.Time) DetailedResult {
+	if t.IsZero() {
+		return d
+	}
+	d.Catalog = t
+	d.Best = Result{CreatedAt: t, Source: SourceCatalog}
+	return d
+}
+
+// WithDirectory returns d with the date of the directory an earlier layout placed the file in, which
+// is chosen over the modification time but not over a metadata or filename date. A zero t leaves d unchanged.
+func (d DetailedResult) WithDirectory(t time.Time) DetailedResult {
+	if t.IsZero() {
+		return d
+	}
+	d.Directory = t
+	switch d.Best.Source {
+	case SourceMtime, SourceUnknown, "":
+		d.Best = Result{CreatedAt: t, Source: SourceDirectory}
+	}
+	return d
+}
+
+// TrackMatch is how a GPS track agrees with the chosen timestamp of a file that has a GPS position.
+type TrackMatch string
+
+const (
+	// TrackAgrees means the track was at the position of the file at its timestamp.
+	TrackAgrees TrackMatch = "agrees"
+	// TrackDisagrees means the track was elsewhere at the timestamp of the file: the clock that
+	// dated it was probably off.
+	TrackDisagrees TrackMatch = "disagrees"
+)
+
+// WithTrack returns d with how a GPS track agrees with its metadata or filename timestamp, which
+// raises or lowers its confidence by one level. Other timestamps are left unchanged.
+func (d DetailedResult) WithTrack(m TrackMatch) DetailedResult {
+	switch d.Best.Source {
+	case SourceMetadata, SourceFilename:
+		d.Track = m
+	}
+	return d
+}
+
+// WithClockOffset returns d with its metadata or filename timestamp corrected for a camera clock that
+// was offset ahead of the real time, such as one left on winter time. Other timestamps are left unchanged.
+func (d DetailedResult) WithClockOffset(offset time.Duration) DetailedResult {
+	switch d.Best.Source {
+	case SourceMetadata, SourceFilename:
+		d.ClockOffset = offset
+		d.Best.CreatedAt = d.Best.CreatedAt.Add(-offset)
+	}
+	return d
+}
+
+// WithTimezone returns d with its metadata and filename timestamps in zone, the timezone where the file
+// was taken, instead of loc, the Options.Location it was determined with. Timestamps read in loc, which
+// recorded no timezone, keep their wall clock; the others, whose instant is known, are converted to zone.
+// Other timestamps are left unchanged.
+func (d DetailedResult) WithTimezone(zone, loc *time.Location) DetailedResult {
+	in := func(t time.Time) time.Time {
+		switch {
+		case t.IsZero():
+			return t
+		case t.Location() == loc:
+			return inZone(t, zone)
+		}
+		return t.In(zone)
+	}
+	d.Metadata, d.Filename = in(d.Metadata), in(d.Filename)
+	switch d.Best.Source {
+	case SourceMetadata:
+		d.Best.CreatedAt = d.Metadata
+	case SourceFilename:
+		d.Best.CreatedAt = d.Filename
+	}
+	return d
+}
+
+// Confidence rates how trustworthy the chosen timestamp of a DetailedResult is.
+type Confidence string
+
+const (
+	// ConfidenceHigh is a date recorded by a photo catalog, or embedded metadata no other candidate contradicts.
+	// A GPS track agreeing or disagreeing with a metadata or filename date moves it one level up or down.
+	ConfidenceHigh Confidence = "high"
+	// ConfidenceMedium is a date parsed from the filename, or embedded metadata the filename contradicts.
+	ConfidenceMedium Confidence = "medium"
+	// ConfidenceLow is a filesystem timestamp, which copies and downloads commonly reset, or the date of
+	// the directory an earlier run placed the file in based on one.
+	ConfidenceLow Confidence = "low"
+	// ConfidenceNone means no timestamp was found.
+	ConfidenceNone Confidence = "none"
+)
+
+// ParseConfidence converts a CLI value into a Confidence.
+func ParseConfidence(s string) (Confidence, error) {
+	switch c := Confidence(strings.ToLower(strings.TrimSpace(s))); c {
+	case ConfidenceHigh, ConfidenceMedium, ConfidenceLow, ConfidenceNone:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid confidence %q (want high, medium, low or none)", s)
+	}
+}
+
+// Below reports whether c is less trustworthy than threshold.
+func (c Confidence) Below(threshold Confidence) bool {
+	return c.rank() < threshold.rank()
+}
+
+func (c Confidence) rank() int {
+	switch c {
+	case ConfidenceHigh:
+		return 3
+	case ConfidenceMedium:
+		return 2
+	case ConfidenceLow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// conflictThreshold is how far apart the metadata and filename candidates may be before they
+// contradict each other. It absorbs timezone differences between the two.
+const conflictThreshold = 24 * time.Hour
+
+// Confidence rates the chosen timestamp by its source and by whether the other candidates and a GPS
+// track (WithTrack) agree with it.
+func (d DetailedResult) Confidence() Confidence {
+	c := d.sourceConfidence()
+	switch {
+	case d.Track == TrackAgrees && c == ConfidenceMedium:
+		return ConfidenceHigh
+	case d.Track == TrackDisagrees && c == ConfidenceHigh:
+		return ConfidenceMedium
+	case d.Track == TrackDisagrees && c == ConfidenceMedium:
+		return ConfidenceLow
+	}
+	return c
+}
+
+// sourceConfidence rates the chosen timestamp by its source and the other candidates.
+func (d DetailedResult) sourceConfidence() Confidence {
+	switch d.Best.Source {
+	case SourceCatalog:
+		return ConfidenceHigh
+	case SourceMetadata:
+		if !d.Filename.IsZero() {
+			if diff := d.Metadata.Sub(d.Filename); diff > conflictThreshold || diff < -conflictThreshold {
+				return ConfidenceMedium
+			}
+		}
+		return ConfidenceHigh
+	case SourceFilename:
+		return ConfidenceMedium
+	case SourceDirectory, SourceMtime:
+		return ConfidenceLow
+	default:
+		return ConfidenceNone
+	}
 }
 
 // MetadataExtractor extracts an embedded creation timestamp from a media stream.
@@ -57,19 +252,41 @@ type MetadataExtractor interface {
 
 // Options configures Determine.
 type Options struct {
-	// Location is used for timestamps parsed from filenames that contain no timezone.
-	// If nil, time.Local is used.
+	// Location is used for timestamps without a timezone: those parsed from filenames and the EXIF
+	// dates the default extractor reads without a recorded offset or GPS time. Video creation times, which are in UTC, are converted to
+	// it. If nil, time.Local is used.
 	Location *time.Location
 
 	// Metadata optionally extracts embedded timestamps.
 	//
-	// If nil, a default EXIF-based extractor is used.
+	// If nil, DefaultMetadata is used.
 	Metadata MetadataExtractor
+
+	// Sidecars lists the paths in the file system of the sidecars of the file, such as scan.Record.Sidecars.
+	// When the file itself has no metadata date, the date of its XMP sidecar is used as one.
+	Sidecars []string
+
+	// IgnoreMtime never chooses the modification time, which bulk copies commonly reset: a file
+	// without a metadata or filename date is left unknown. Filestat is still filled in.
+	IgnoreMtime bool
+}
+
+// DefaultMetadata returns the extractor Determine uses for path without Options.Metadata: the movie
+// header of MP4 and QuickTime videos, the eXIf and XMP chunks of PNGs, the EXIF data of other files,
+// read in loc.
+func DefaultMetadata(path string, loc *time.Location) MetadataExtractor {
+	switch {
+	case video.IsCandidate(path):
+		return quicktimeExtractor{loc: loc}
+	case strings.EqualFold(filepath.Ext(path), ".png"):
+		return pngExtractor{loc: loc}
+	}
+	return exifExtractor{loc: loc}
 }
 
 // Determine returns the best-effort created-at timestamp for a path.
-func Determine(fsys fs.FS, path string, opts Options) (Result, error) {
-	detailed, err := DetermineDetailed(fsys, path, opts)
+func Determine(ctx context.Context, fsys fs.FS, path string, opts Options) (Result, error) {
+	detailed, err := DetermineDetailed(ctx, fsys, path, opts)
 	if err != nil {
 		return Result{}, err
 	}
@@ -77,42 +294,53 @@ func Determine(fsys fs.FS, path string, opts Options) (Result, error) {
 }
 
 // DetermineDetailed returns all considered timestamps for a path.
-func DetermineDetailed(fsys fs.FS, path string, opts Options) (DetailedResult, error) {
+func DetermineDetailed(ctx context.Context, fsys fs.FS, path string, opts Options) (DetailedResult, error) {
+	if err := ctx.Err(); err != nil {
+		return DetailedResult{}, err
+	}
 	path = filepath.Clean(path)
 
 	info, err := fs.Stat(fsys, path)
 	if err != nil {
-		return DetailedResult{}, err
+		return DetailedResult{}, &errcode.FileError{Op: "stat", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 	if info.IsDir() {
-		return DetailedResult{}, fs.ErrInvalid
+		return DetailedResult{}, &errcode.FileError{Op: "attribute", Path: path, Kind: errcode.ErrNotMedia, Err: fs.ErrInvalid}
 	}
 
 	var result DetailedResult
 
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
 	// Try metadata
 	metadata := opts.Metadata
 	if metadata == nil {
-		metadata = exifExtractor{}
+		metadata = DefaultMetadata(path, loc)
 	}
 
 	if metadata != nil {
 		f, openErr := fsys.Open(path)
 		if openErr != nil {
-			return DetailedResult{}, openErr
+			return DetailedResult{}, &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: openErr}
 		}
 		createdAt, ok, metaErr := metadata.CreatedAt(path, f)
 		_ = f.Close()
 		if metaErr == nil && ok {
 			result.Metadata = createdAt
 		}
+		result.MetadataErr = metaErr
 	}
 
-	// Try filename
-	loc := opts.Location
-	if loc == nil {
-		loc = time.Local
+	if result.Metadata.IsZero() {
+		if t, ok := sidecarDate(fsys, opts.Sidecars, loc); ok {
+			result.Metadata = t
+		}
 	}
+
+	// Try filename
 	if createdAt, ok := parseFromFilename(filepath.Base(path), loc); ok {
 		result.Filename = createdAt
 	}
@@ -128,7 +356,7 @@ func DetermineDetailed(fsys fs.FS, path string, opts Options) (DetailedResult, e
 		result.Best = Result{CreatedAt: result.Metadata, Source: SourceMetadata}
 	} else if !result.Filename.IsZero() {
 		result.Best = Result{CreatedAt: result.Filename, Source: SourceFilename}
-	} else if !result.Filestat.IsZero() {
+	} else if !result.Filestat.IsZero() && !opts.IgnoreMtime {
 		result.Best = Result{CreatedAt: result.Filestat, Source: SourceMtime}
 	} else {
 		result.Best = Result{CreatedAt: time.Time{}, Source: SourceUnknown}
@@ -138,7 +366,7 @@ func DetermineDetailed(fsys fs.FS, path string, opts Options) (DetailedResult, e
 }
 
 var (
-	reImgVidDateTime = regexp.MustCompile(`(?i)^(?:IMG|VID)_(\d{8})_(\d{6})`)
+	reImgVidDateTime = regexp.MustCompile(`(?i)^(?:IMG|VID|MVIMG)_(\d{8})_(\d{6})`)
 	rePxlDateTimeMs  = regexp.MustCompile(`(?i)^PXL_(\d{8})_(\d{6})\d{3,}`)
 	reDashDots       = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})[ _](\d{2})\.(\d{2})\.(\d{2})`)
 	reImgWhatsApp    = regexp.MustCompile(`(?i)^IMG-(\d{8})-WA\d+`)
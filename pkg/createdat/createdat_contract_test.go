@@ -3,6 +3,7 @@
 package createdat_test
 
 import (
+	"context"
 	"errors"
 	"io"
 	"io/fs"
@@ -34,6 +35,7 @@ func TestDetermine_Priorities_MetadataThenFilenameThenMtime(t *testing.T) {
 		metadataTime  time.Time
 		metadataFound bool
 		metadataErr   error
+		ignoreMtime   bool
 		wantTime      time.Time
 		wantSource    createdat.Source
 	}{
@@ -71,6 +73,24 @@ func TestDetermine_Priorities_MetadataThenFilenameThenMtime(t *testing.T) {
 			wantTime:      mtime,
 			wantSource:    createdat.SourceMtime,
 		},
+		{
+			name:          "unknown when mtime is ignored",
+			path:          "root/holiday.jpg",
+			modTime:       mtime,
+			metadataFound: false,
+			ignoreMtime:   true,
+			wantTime:      time.Time{},
+			wantSource:    createdat.SourceUnknown,
+		},
+		{
+			name:          "filename used when mtime is ignored",
+			path:          "root/IMG_20240102_030405.jpg",
+			modTime:       mtime,
+			metadataFound: false,
+			ignoreMtime:   true,
+			wantTime:      time.Date(2024, 1, 2, 3, 4, 5, 0, loc),
+			wantSource:    createdat.SourceFilename,
+		},
 		{
 			name:          "unknown when no metadata, no filename, zero mtime",
 			path:          "root/holiday.jpg",
@@ -93,7 +113,7 @@ func TestDetermine_Priorities_MetadataThenFilenameThenMtime(t *testing.T) {
 				err:       tc.metadataErr,
 			}
 
-			res, err := createdat.Determine(fsys, tc.path, createdat.Options{Location: loc, Metadata: metadata})
+			res, err := createdat.Determine(context.Background(), fsys, tc.path, createdat.Options{Location: loc, Metadata: metadata, IgnoreMtime: tc.ignoreMtime})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -126,6 +146,11 @@ func TestDetermine_FilenamePatterns(t *testing.T) {
 			path: "root/VID_20250102_030405.mp4",
 			want: time.Date(2025, 1, 2, 3, 4, 5, 0, loc),
 		},
+		{
+			name: "MVIMG_YYYYMMDD_HHMMSS",
+			path: "root/MVIMG_20250102_030405.jpg",
+			want: time.Date(2025, 1, 2, 3, 4, 5, 0, loc),
+		},
 		{
 			name: "PXL_YYYYMMDD_HHMMSSfff",
 			path: "root/PXL_20250102_030405123.jpg",
@@ -154,7 +179,7 @@ func TestDetermine_FilenamePatterns(t *testing.T) {
 				tc.path: &fstest.MapFile{Data: []byte("x"), ModTime: mtime},
 			}
 
-			res, err := createdat.Determine(fsys, tc.path, createdat.Options{Location: loc})
+			res, err := createdat.Determine(context.Background(), fsys, tc.path, createdat.Options{Location: loc})
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -171,7 +196,7 @@ func TestDetermine_FilenamePatterns(t *testing.T) {
 func TestDetermine_MissingFileReturnsError(t *testing.T) {
 	fsys := fstest.MapFS{}
 
-	_, err := createdat.Determine(fsys, "root/missing.jpg", createdat.Options{})
+	_, err := createdat.Determine(context.Background(), fsys, "root/missing.jpg", createdat.Options{})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -185,7 +210,7 @@ func TestDetermine_DirectoryReturnsError(t *testing.T) {
 		"root": &fstest.MapFile{Mode: fs.ModeDir},
 	}
 
-	_, err := createdat.Determine(fsys, "root", createdat.Options{})
+	_, err := createdat.Determine(context.Background(), fsys, "root", createdat.Options{})
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -204,3 +229,127 @@ func (f *fakeMetadataExtractor) CreatedAt(path string, r io.Reader) (time.Time,
 	_, _ = io.ReadAll(r)
 	return f.createdAt, f.found, f.err
 }
+
+func TestDetailedResult_WithCatalogTakesPriority(t *testing.T) {
+	metadata := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	catalog := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	d := createdat.DetailedResult{
+		Best:     createdat.Result{CreatedAt: metadata, Source: createdat.SourceMetadata},
+		Metadata: metadata,
+	}
+
+	if got := d.WithCatalog(time.Time{}); got.Best != d.Best || !got.Catalog.IsZero() {
+		t.Fatalf("zero catalog changed the result: %+v", got)
+	}
+
+	got := d.WithCatalog(catalog)
+	if got.Best.Source != createdat.SourceCatalog || !got.Best.CreatedAt.Equal(catalog) {
+		t.Fatalf("expected catalog as best, got %+v", got.Best)
+	}
+	if !got.Metadata.Equal(metadata) {
+		t.Fatalf("expected metadata candidate to be kept, got %v", got.Metadata)
+	}
+}
+
+func TestDetailedResult_WithDirectory(t *testing.T) {
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	dir := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	d := createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceMtime}, Filestat: taken}.WithDirectory(dir)
+	if d.Best != (createdat.Result{CreatedAt: dir, Source: createdat.SourceDirectory}) || !d.Directory.Equal(dir) {
+		t.Errorf("expected the directory date to replace the mtime, got %+v", d)
+	}
+	d = createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceFilename}, Filename: taken}.WithDirectory(dir)
+	if d.Best.Source != createdat.SourceFilename || !d.Directory.Equal(dir) {
+		t.Errorf("expected the filename date to be kept, got %+v", d)
+	}
+}
+
+func TestDetailedResult_Confidence(t *testing.T) {
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name string
+		d    createdat.DetailedResult
+		want createdat.Confidence
+	}{
+		{"catalog", createdat.DetailedResult{}.WithCatalog(taken), createdat.ConfidenceHigh},
+		{"metadata", createdat.DetailedResult{
+			Best:     createdat.Result{CreatedAt: taken, Source: createdat.SourceMetadata},
+			Metadata: taken,
+			Filename: taken.Add(2 * time.Hour),
+		}, createdat.ConfidenceHigh},
+		{"metadata contradicted by filename", createdat.DetailedResult{
+			Best:     createdat.Result{CreatedAt: taken, Source: createdat.SourceMetadata},
+			Metadata: taken,
+			Filename: taken.AddDate(1, 0, 0),
+		}, createdat.ConfidenceMedium},
+		{"filename", createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceFilename}}, createdat.ConfidenceMedium},
+		{"mtime", createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceMtime}}, createdat.ConfidenceLow},
+		{"directory", createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceMtime}}.WithDirectory(taken), createdat.ConfidenceLow},
+		{"unknown", createdat.DetailedResult{Best: createdat.Result{Source: createdat.SourceUnknown}}, createdat.ConfidenceNone},
+		{"filename on the track", createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceFilename}}.WithTrack(createdat.TrackAgrees), createdat.ConfidenceHigh},
+		{"metadata off the track", createdat.DetailedResult{
+			Best:     createdat.Result{CreatedAt: taken, Source: createdat.SourceMetadata},
+			Metadata: taken,
+		}.WithTrack(createdat.TrackDisagrees), createdat.ConfidenceMedium},
+		{"mtime on the track", createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceMtime}}.WithTrack(createdat.TrackAgrees), createdat.ConfidenceLow},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Confidence(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetailedResult_WithClockOffset(t *testing.T) {
+	taken := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	d := createdat.DetailedResult{Best: createdat.Result{CreatedAt: taken, Source: createdat.SourceMetadata}, Metadata: taken}.WithClockOffset(time.Hour)
+	if !d.Best.CreatedAt.Equal(taken.Add(-time.Hour)) || !d.Metadata.Equal(taken) || d.ClockOffset != time.Hour {
+		t.Errorf("expected the metadata date to be corrected and kept as a candidate, got %+v", d)
+	}
+	d = createdat.DetailedResult{}.WithCatalog(taken).WithClockOffset(time.Hour)
+	if !d.Best.CreatedAt.Equal(taken) || d.ClockOffset != 0 {
+		t.Errorf("expected a catalog date to be left alone, got %+v", d)
+	}
+}
+
+func TestDetailedResult_WithTimezone(t *testing.T) {
+	home := time.FixedZone("home", 2*3600)
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("no timezone database: %v", err)
+	}
+	wall := time.Date(2023, 7, 1, 12, 0, 0, 0, home)
+	recorded := time.Date(2023, 7, 1, 12, 0, 0, 0, time.FixedZone("", 9*3600))
+	d := createdat.DetailedResult{Best: createdat.Result{CreatedAt: wall, Source: createdat.SourceMetadata}, Metadata: wall, Filename: recorded}.WithTimezone(rome, home)
+	if want := time.Date(2023, 7, 1, 12, 0, 0, 0, rome); !d.Best.CreatedAt.Equal(want) || d.Best.CreatedAt.Location() != rome || !d.Metadata.Equal(want) {
+		t.Errorf("expected the wall clock to be kept in Rome, got %v", d.Best.CreatedAt)
+	}
+	if !d.Filename.Equal(recorded) || d.Filename.Location() != rome {
+		t.Errorf("expected a date with a timezone to keep its instant, got %v", d.Filename)
+	}
+	d = createdat.DetailedResult{Filestat: wall}.WithCatalog(wall).WithTimezone(rome, home)
+	if d.Best.CreatedAt != wall || d.Filestat != wall {
+		t.Errorf("expected catalog and filesystem dates to be left alone, got %+v", d)
+	}
+}
+
+func TestConfidence_Below(t *testing.T) {
+	threshold, err := createdat.ParseConfidence(" Medium")
+	if err != nil || threshold != createdat.ConfidenceMedium {
+		t.Fatalf("ParseConfidence = %q, %v", threshold, err)
+	}
+	for c, want := range map[createdat.Confidence]bool{
+		createdat.ConfidenceHigh:   false,
+		createdat.ConfidenceMedium: false,
+		createdat.ConfidenceLow:    true,
+		createdat.ConfidenceNone:   true,
+	} {
+		if got := c.Below(threshold); got != want {
+			t.Errorf("%s.Below(medium) = %v, want %v", c, got, want)
+		}
+	}
+	if _, err := createdat.ParseConfidence("certain"); err == nil {
+		t.Error("expected an error for an unknown confidence")
+	}
+}
@@ -1,5 +1,6 @@
 // Package createdat provides best-effort attribution of a media file's creation timestamp.
 //
-// The timestamp attribution follows a priority order (metadata, filename, filesystem timestamps)
-// as described in PIPELINE.md.
+// The timestamp attribution follows a priority order (catalog, metadata, filename, filesystem timestamps)
+// as described in PIPELINE.md. Catalog dates come from photo management applications and are
+// added by the caller with DetailedResult.WithCatalog.
 package createdat
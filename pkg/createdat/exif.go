@@ -1,45 +1,83 @@
 package createdat
 
 import (
+	"bytes"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
 )
 
-type exifExtractor struct{}
+// exifExtractor reads the EXIF date of a photo. EXIF dates are recorded in the time of the camera
+// clock; they are read in the offset the camera recorded with them, or the one their GPS time implies,
+// and else in loc, or time.Local if nil.
+type exifExtractor struct {
+	loc *time.Location
+}
 
 func (e exifExtractor) CreatedAt(path string, r io.Reader) (time.Time, bool, error) {
 	x, err := exif.Decode(r)
 	if err != nil {
-		// Best-effort: if decode isn't critical, try to salvage timestamps.
-		if !exif.IsCriticalError(err) {
-			// exif.Decode returns a partially-populated *Exif in these cases.
-			// Unfortunately the library doesn't expose it when returning error,
-			// so treat it as "not found".
-			return time.Time{}, false, nil
+		// A missing EXIF block is not an error; a block that is present but broken is.
+		if !exif.IsCriticalError(err) || strings.HasPrefix(err.Error(), "exif: decode failed") {
+			return time.Time{}, false, &errcode.FileError{Op: "decode exif", Path: path, Kind: errcode.ErrMetadataCorrupt, Err: err}
 		}
 		return time.Time{}, false, nil
 	}
 
-	// Prefer DateTimeOriginal, then DateTimeDigitized, then DateTime.
-	if tm, ok, err := exifTimeFromTag(x, exif.DateTimeOriginal); err == nil && ok {
-		return tm, true, nil
-	}
-	if tm, ok, err := exifTimeFromTag(x, exif.DateTimeDigitized); err == nil && ok {
-		return tm, true, nil
+	tm, ok := exifDate(x, e.loc)
+	return tm, ok, nil
+}
+
+// The EXIF 2.31 offset tags, which goexif does not load: the UTC offset of the camera clock when the
+// DateTime, DateTimeOriginal and DateTimeDigitized tags were recorded, as "+09:00".
+const (
+	offsetTime          exif.FieldName = "OffsetTime"
+	offsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	offsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+)
+
+// exifDate returns the date of the EXIF data x. It prefers DateTimeOriginal, then DateTimeDigitized,
+// then DateTime, each with the fraction of a second recorded next to it, which tells apart the shots of
+// a burst. The date is read in the offset recorded with it, else in the offset between it and the GPS
+// time of x, else in loc, or time.Local if nil.
+func exifDate(x *exif.Exif, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = time.Local
 	}
-	if tm, ok, err := exifTimeFromTag(x, exif.DateTime); err == nil && ok {
-		return tm, true, nil
+	loadOffsets(x)
+	gps, hasGPS := gpsTime(x)
+	for _, tags := range []struct{ date, subSec, offset exif.FieldName }{
+		{exif.DateTimeOriginal, exif.SubSecTimeOriginal, offsetTimeOriginal},
+		{exif.DateTimeDigitized, exif.SubSecTimeDigitized, offsetTimeDigitized},
+		{exif.DateTime, exif.SubSecTime, offsetTime},
+	} {
+		tm, ok, err := exifTimeFromTag(x, tags.date, tags.subSec, loc)
+		if err != nil || !ok {
+			continue
+		}
+		if zone, ok := offsetZone(x, tags.offset); ok {
+			return inZone(tm, zone), true
+		}
+		if hasGPS {
+			if zone, ok := gpsZone(tm, gps); ok {
+				return inZone(tm, zone), true
+			}
+		}
+		return tm, true
 	}
 	if t, err := x.DateTime(); err == nil {
-		return t, true, nil
+		return t, true
 	}
 
-	return time.Time{}, false, nil
+	return time.Time{}, false
 }
 
-func exifTimeFromTag(x *exif.Exif, tag exif.FieldName) (time.Time, bool, error) {
+func exifTimeFromTag(x *exif.Exif, tag, subSecTag exif.FieldName, loc *time.Location) (time.Time, bool, error) {
 	f, err := x.Get(tag)
 	if err != nil {
 		return time.Time{}, false, nil
@@ -51,11 +89,133 @@ func exifTimeFromTag(x *exif.Exif, tag exif.FieldName) (time.Time, bool, error)
 	}
 
 	// EXIF DateTime format: "2006:01:02 15:04:05".
-	// It often has no timezone; interpret as Local.
-	tm, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+	// It has no timezone; interpret in loc.
+	tm, err := time.ParseInLocation("2006:01:02 15:04:05", s, loc)
 	if err != nil {
 		return time.Time{}, false, nil
 	}
 
-	return tm, true, nil
+	return tm.Add(subSeconds(x, subSecTag)), true, nil
+}
+
+// loadOffsets loads the offset tags of the EXIF sub-IFD of x.
+func loadOffsets(x *exif.Exif) {
+	ptr, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return
+	}
+	offset, err := ptr.Int64(0)
+	if err != nil || offset < 0 || offset >= int64(len(x.Raw)) {
+		return
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return
+	}
+	x.LoadTags(dir, map[uint16]exif.FieldName{0x9010: offsetTime, 0x9011: offsetTimeOriginal, 0x9012: offsetTimeDigitized}, false)
+}
+
+// offsetZone returns the zone of the offset tag of x, such as "+09:00" or "-03:30".
+func offsetZone(x *exif.Exif, tag exif.FieldName) (*time.Location, bool) {
+	f, err := x.Get(tag)
+	if err != nil {
+		return nil, false
+	}
+	s, err := f.StringVal()
+	if err != nil {
+		return nil, false
+	}
+	t, err := time.Parse("-07:00", strings.TrimSpace(strings.TrimRight(s, "\x00")))
+	if err != nil {
+		return nil, false
+	}
+	_, offset := t.Zone()
+	return fixedZone(offset)
+}
+
+// gpsTime returns the UTC time of the GPSDateStamp and GPSTimeStamp tags of x.
+func gpsTime(x *exif.Exif) (time.Time, bool) {
+	dateTag, err := x.Get(exif.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	date, err := dateTag.StringVal()
+	if err != nil {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006:01:02", strings.TrimSpace(strings.TrimRight(date, "\x00")))
+	if err != nil {
+		return time.Time{}, false
+	}
+	timeTag, err := x.Get(exif.GPSTimeStamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var clock time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		num, den, err := timeTag.Rat2(i)
+		if err != nil || den == 0 {
+			return time.Time{}, false
+		}
+		clock += time.Duration(float64(num) / float64(den) * float64(unit))
+	}
+	return day.Add(clock), true
+}
+
+// maxGPSLag is how far the GPS time of a photo may be from the camera clock, once the offset of the
+// clock is taken off: the GPS time is that of the last position fix, which may be somewhat older.
+const maxGPSLag = 5 * time.Minute
+
+// gpsZone returns the zone of the camera clock that recorded tm, whose wall clock is that of the zone,
+// as the offset between it and the UTC time gps: the nearest quarter hour, if the rest is within
+// maxGPSLag.
+func gpsZone(tm, gps time.Time) (*time.Location, bool) {
+	wall := time.Date(tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), time.UTC)
+	diff := wall.Sub(gps)
+	offset := diff.Round(15 * time.Minute)
+	if lag := diff - offset; lag > maxGPSLag || lag < -maxGPSLag {
+		return nil, false
+	}
+	return fixedZone(int(offset / time.Second))
+}
+
+// fixedZone returns the zone of a UTC offset in seconds, if it is one in use: from -12:00 to +14:00.
+func fixedZone(offset int) (*time.Location, bool) {
+	if offset < -12*3600 || offset > 14*3600 {
+		return nil, false
+	}
+	return time.FixedZone("", offset), true
+}
+
+// inZone returns the time with the wall clock of tm in zone.
+func inZone(tm time.Time, zone *time.Location) time.Time {
+	return time.Date(tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), zone)
+}
+
+// subSeconds returns the fraction of a second in the SubSecTime tag of x: its digits are the decimals
+// of the second, so "5" is half a second and "053" 53 milliseconds.
+func subSeconds(x *exif.Exif, tag exif.FieldName) time.Duration {
+	f, err := x.Get(tag)
+	if err != nil {
+		return 0
+	}
+	s, err := f.StringVal()
+	if err != nil {
+		return 0
+	}
+	digits := strings.TrimRight(strings.TrimSpace(s), "\x00")
+	var d time.Duration
+	unit := time.Second
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		unit /= 10
+		d += time.Duration(c-'0') * unit
+	}
+	return d
 }
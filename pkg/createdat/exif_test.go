@@ -2,9 +2,15 @@ package createdat
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io/fs"
 	"testing"
 	"testing/fstest"
 	"time"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
 )
 
 func TestDefaultExifExtractor_ExtractsDateTimeOriginal(t *testing.T) {
@@ -17,7 +23,7 @@ func TestDefaultExifExtractor_ExtractsDateTimeOriginal(t *testing.T) {
 		"a.jpg": &fstest.MapFile{Data: b, ModTime: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
 	}
 
-	res, err := Determine(fsys, "a.jpg", Options{Location: time.UTC})
+	res, err := Determine(context.Background(), fsys, "a.jpg", Options{Location: time.FixedZone("", 3600)})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -25,13 +31,86 @@ func TestDefaultExifExtractor_ExtractsDateTimeOriginal(t *testing.T) {
 		t.Fatalf("expected metadata source, got %q", res.Source)
 	}
 
-	// The fixture contains EXIF DateTimeOriginal = 2012-11-04 05:42:02 +0100.
+	// The fixture contains EXIF DateTimeOriginal = 2012:11:04 05:42:02, read in Options.Location.
 	want := time.Date(2012, 11, 4, 5, 42, 2, 0, time.FixedZone("", 3600))
 	if !res.CreatedAt.Equal(want) {
 		t.Fatalf("unexpected CreatedAt\n got: %v\nwant: %v", res.CreatedAt, want)
 	}
 }
 
+func TestDefaultExifExtractor_ReadsInLocation(t *testing.T) {
+	b, err := testdataFS.ReadFile("testdata/f1-exif.jpg")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	fsys := fstest.MapFS{"a.jpg": &fstest.MapFile{Data: b}}
+
+	tokyo := time.FixedZone("JST", 9*3600)
+	res, err := Determine(context.Background(), fsys, "a.jpg", Options{Location: tokyo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Date(2012, 11, 4, 5, 42, 2, 0, tokyo)
+	if !res.CreatedAt.Equal(want) || res.CreatedAt.Location() != tokyo {
+		t.Fatalf("unexpected CreatedAt\n got: %v\nwant: %v", res.CreatedAt, want)
+	}
+}
+
+// jpegWithDateTimeOriginal returns a JPEG whose EXIF sub-IFD holds DateTimeOriginal and SubSecTimeOriginal.
+func jpegWithDateTimeOriginal(dateTime, subSec string) []byte {
+	return testjpeg.WithEXIF(nil, []testjpeg.Entry{testjpeg.ASCII(0x9003, dateTime), testjpeg.ASCII(0x9291, subSec)}, nil)
+}
+
+func TestExifExtractor_Offsets(t *testing.T) {
+	loc := time.FixedZone("", 3600)
+	date := testjpeg.ASCII(0x9003, "2024:01:02 03:04:05")
+	gps := []testjpeg.Entry{testjpeg.ASCII(0x1D, "2024:01:01"), testjpeg.Rational(0x07, 18, 2, 30)}
+	for name, tc := range map[string]struct {
+		exif, gps []testjpeg.Entry
+		offset    int
+	}{
+		"offset tag":              {exif: []testjpeg.Entry{date, testjpeg.ASCII(0x9011, "+09:00")}, offset: 9 * 3600},
+		"half-hour offset":        {exif: []testjpeg.Entry{date, testjpeg.ASCII(0x9011, "-03:30")}, offset: -(3*3600 + 1800)},
+		"offset before gps":       {exif: []testjpeg.Entry{date, testjpeg.ASCII(0x9011, "+08:00")}, gps: gps, offset: 8 * 3600},
+		"gps time":                {exif: []testjpeg.Entry{date}, gps: gps, offset: 9 * 3600},
+		"gps fix minutes old":     {exif: []testjpeg.Entry{date}, gps: []testjpeg.Entry{testjpeg.ASCII(0x1D, "2024:01:01"), testjpeg.Rational(0x07, 18, 0, 5)}, offset: 9 * 3600},
+		"gps fix far off":         {exif: []testjpeg.Entry{date}, gps: []testjpeg.Entry{testjpeg.ASCII(0x1D, "2024:01:01"), testjpeg.Rational(0x07, 18, 25, 0)}, offset: 3600},
+		"blank offset tag":        {exif: []testjpeg.Entry{date, testjpeg.ASCII(0x9011, "   :  ")}, offset: 3600},
+		"offset of another date":  {exif: []testjpeg.Entry{date, testjpeg.ASCII(0x9010, "+09:00")}, offset: 3600},
+		"no offset and no gps":    {exif: []testjpeg.Entry{date}, offset: 3600},
+		"implausible gps offset":  {exif: []testjpeg.Entry{date}, gps: []testjpeg.Entry{testjpeg.ASCII(0x1D, "2023:12:31"), testjpeg.Rational(0x07, 3, 4, 5)}, offset: 3600},
+		"digitized offset":        {exif: []testjpeg.Entry{testjpeg.ASCII(0x9004, "2024:01:02 03:04:05"), testjpeg.ASCII(0x9012, "+09:00")}, offset: 9 * 3600},
+		"modification offset tag": {exif: []testjpeg.Entry{testjpeg.ASCII(0x0132, "2024:01:02 03:04:05"), testjpeg.ASCII(0x9010, "+09:00")}, offset: 9 * 3600},
+	} {
+		tm, ok, err := (exifExtractor{loc: loc}).CreatedAt("a.jpg", bytes.NewReader(testjpeg.WithEXIF(nil, tc.exif, tc.gps)))
+		if err != nil || !ok {
+			t.Fatalf("%s: %v, %v", name, ok, err)
+		}
+		want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", tc.offset))
+		if _, offset := tm.Zone(); !tm.Equal(want) || offset != tc.offset {
+			t.Errorf("%s: got %v, want %v", name, tm, want)
+		}
+	}
+}
+
+func TestExifExtractor_SubSeconds(t *testing.T) {
+	loc := time.FixedZone("", 3600)
+	for subSec, want := range map[string]time.Duration{
+		"5":   500 * time.Millisecond,
+		"053": 53 * time.Millisecond,
+		"":    0,
+		"x1":  0,
+	} {
+		tm, ok, err := (exifExtractor{loc: loc}).CreatedAt("a.jpg", bytes.NewReader(jpegWithDateTimeOriginal("2024:01:02 03:04:05", subSec)))
+		if err != nil || !ok {
+			t.Fatalf("SubSecTimeOriginal %q: %v, %v", subSec, ok, err)
+		}
+		if want := time.Date(2024, 1, 2, 3, 4, 5, 0, loc).Add(want); !tm.Equal(want) {
+			t.Errorf("SubSecTimeOriginal %q: got %v, want %v", subSec, tm, want)
+		}
+	}
+}
+
 func TestExifExtractor_NonExifDataIsNotFound(t *testing.T) {
 	tm, ok, err := (exifExtractor{}).CreatedAt("a.jpg", bytes.NewReader([]byte("not a jpeg")))
 	if err != nil {
@@ -44,3 +123,34 @@ func TestExifExtractor_NonExifDataIsNotFound(t *testing.T) {
 		t.Fatalf("expected zero time")
 	}
 }
+
+func TestExifExtractor_CorruptExifIsReported(t *testing.T) {
+	// A JPEG with an APP1 EXIF block whose TIFF payload is garbage.
+	payload := append([]byte("Exif\x00\x00"), []byte("garbage!")...)
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, byte(len(payload) + 2)}
+	jpeg = append(jpeg, payload...)
+
+	_, ok, err := (exifExtractor{}).CreatedAt("a.jpg", bytes.NewReader(jpeg))
+	if ok {
+		t.Fatalf("expected ok=false")
+	}
+	if !errors.Is(err, errcode.ErrMetadataCorrupt) {
+		t.Fatalf("expected ErrMetadataCorrupt, got %v", err)
+	}
+}
+
+func TestDetermineDetailed_TypedErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/a.jpg": &fstest.MapFile{Data: []byte("a")},
+	}
+
+	_, err := DetermineDetailed(context.Background(), fsys, "dir", Options{})
+	if !errors.Is(err, errcode.ErrNotMedia) || !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("expected ErrNotMedia wrapping fs.ErrInvalid, got %v", err)
+	}
+
+	_, err = DetermineDetailed(context.Background(), fsys, "missing.jpg", Options{})
+	if !errors.Is(err, errcode.ErrUnreadableSource) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected ErrUnreadableSource wrapping fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package createdat
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/xmpdate"
+)
+
+// pngSignature starts every PNG.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// maxPNGChunk bounds the metadata chunks read into memory.
+const maxPNGChunk = 1 << 24
+
+// pngExtractor reads the date of a PNG from its eXIf chunk, like the EXIF date of a JPEG, or else from
+// the XMP packet of its iTXt chunk: the photoshop:DateCreated, then the xmp:CreateDate. Dates without a
+// timezone are read in loc, or time.Local if nil. Only the chunks before the image data are read.
+type pngExtractor struct {
+	loc *time.Location
+}
+
+func (p pngExtractor) CreatedAt(path string, r io.Reader) (time.Time, bool, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil || !bytes.Equal(sig[:], pngSignature) {
+		return time.Time{}, false, nil
+	}
+	loc := p.loc
+	if loc == nil {
+		loc = time.Local
+	}
+
+	var xmp []byte
+	var exifErr error
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		kind := string(header[4:])
+		if kind == "IDAT" || kind == "IEND" || length > maxPNGChunk {
+			break
+		}
+		// The chunk data followed by its CRC.
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return time.Time{}, false, &errcode.FileError{Op: "read png", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+		}
+		data = data[:length]
+		switch kind {
+		case "eXIf":
+			x, err := exif.Decode(bytes.NewReader(data))
+			if err != nil {
+				exifErr = err
+				continue
+			}
+			if t, ok := exifDate(x, loc); ok {
+				return t, true, nil
+			}
+		case "iTXt":
+			if text, ok := pngXMP(data); ok && xmp == nil {
+				xmp = text
+			}
+		}
+	}
+
+	if t, ok := xmpdate.Read(xmp, loc); ok {
+		return t, true, nil
+	}
+	if t, ok := xmpdate.ReadCreateDate(xmp, loc); ok {
+		return t, true, nil
+	}
+	if exifErr != nil {
+		return time.Time{}, false, &errcode.FileError{Op: "decode exif", Path: path, Kind: errcode.ErrMetadataCorrupt, Err: exifErr}
+	}
+	return time.Time{}, false, nil
+}
+
+// pngXMP returns the text of the iTXt chunk data when it is the XMP packet of the PNG.
+func pngXMP(data []byte) ([]byte, bool) {
+	// An iTXt chunk is a keyword, a compression flag and method, a language tag, a translated keyword
+	// and the text; the strings are null-terminated.
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || string(keyword) != "XML:com.adobe.xmp" || len(rest) < 2 {
+		return nil, false
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	for range 2 {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return nil, false
+		}
+	}
+	if !compressed {
+		return rest, true
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
+	if err != nil {
+		return nil, false
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(io.LimitReader(zr, maxPNGChunk))
+	return text, err == nil
+}
@@ -0,0 +1,100 @@
+package createdat
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+)
+
+// pngWithChunks returns a 1x1 PNG with the chunks, given as type and data, between its header and image data.
+func pngWithChunks(chunks ...string) []byte {
+	chunk := func(out []byte, kind string, data []byte) []byte {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+		out = append(append(out, kind...), data...)
+		return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+	}
+	out := append([]byte{}, pngSignature...)
+	out = chunk(out, "IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})
+	for i := 0; i+1 < len(chunks); i += 2 {
+		out = chunk(out, chunks[i], []byte(chunks[i+1]))
+	}
+	out = chunk(out, "IDAT", nil)
+	return chunk(out, "IEND", nil)
+}
+
+// pngEXIF returns the data of an eXIf chunk with DateTimeOriginal: the TIFF structure of a JPEG's APP1 segment.
+func pngEXIF(dateTime string) string {
+	jpeg := jpegWithDateTimeOriginal(dateTime, "")
+	return string(jpeg[len("\xFF\xD8\xFF\xE1\x00\x00Exif\x00\x00") : len(jpeg)-2])
+}
+
+// pngXMPChunk returns the data of an iTXt chunk holding the XMP packet, compressed or not.
+func pngXMPChunk(packet string, compress bool) string {
+	if !compress {
+		return "XML:com.adobe.xmp\x00\x00\x00\x00\x00" + packet
+	}
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write([]byte(packet))
+	zw.Close()
+	return "XML:com.adobe.xmp\x00\x01\x00\x00\x00" + b.String()
+}
+
+func TestPNGExtractor(t *testing.T) {
+	loc := time.FixedZone("", 3600)
+	exifDate := time.Date(2022, 8, 9, 10, 11, 12, 0, loc)
+	xmpDate := time.Date(2021, 3, 4, 5, 6, 7, 0, loc)
+	createDate := `<x:xmpmeta><rdf:RDF><rdf:Description xmp:CreateDate="2021-03-04T05:06:07"/></rdf:RDF></x:xmpmeta>`
+
+	tests := map[string]struct {
+		data  []byte
+		want  time.Time
+		found bool
+	}{
+		"exif":            {pngWithChunks("eXIf", pngEXIF("2022:08:09 10:11:12")), exifDate, true},
+		"xmp create date": {pngWithChunks("iTXt", pngXMPChunk(createDate, false)), xmpDate, true},
+		"compressed xmp":  {pngWithChunks("iTXt", pngXMPChunk(createDate, true)), xmpDate, true},
+		"exif before xmp": {pngWithChunks("iTXt", pngXMPChunk(createDate, false), "eXIf", pngEXIF("2022:08:09 10:11:12")), exifDate, true},
+		"date created":    {pngWithChunks("iTXt", pngXMPChunk(`<rdf:Description photoshop:DateCreated="2021-03-04T05:06:07" xmp:CreateDate="2024-01-01"/>`, false)), xmpDate, true},
+		"other text":      {pngWithChunks("tEXt", "Software\x00gnome-screenshot"), time.Time{}, false},
+		"not a png":       {[]byte("GIF89a"), time.Time{}, false},
+	}
+	for name, tc := range tests {
+		got, found, err := pngExtractor{loc: loc}.CreatedAt("a.png", bytes.NewReader(tc.data))
+		if err != nil || found != tc.found || !got.Equal(tc.want) {
+			t.Errorf("%s: got %v, %v, %v; want %v, %v", name, got, found, err, tc.want, tc.found)
+		}
+	}
+
+	// A broken eXIf chunk is reported when no XMP date stands in for it.
+	_, _, err := pngExtractor{loc: loc}.CreatedAt("a.png", bytes.NewReader(pngWithChunks("eXIf", "MM\x00\x2a\x00\x00\xff\xff")))
+	if !errors.Is(err, errcode.ErrMetadataCorrupt) {
+		t.Errorf("broken eXIf: got %v, want ErrMetadataCorrupt", err)
+	}
+	got, found, err := pngExtractor{loc: loc}.CreatedAt("a.png", bytes.NewReader(pngWithChunks(
+		"eXIf", "MM\x00\x2a\x00\x00\xff\xff", "iTXt", pngXMPChunk(createDate, false))))
+	if err != nil || !found || !got.Equal(xmpDate) {
+		t.Errorf("broken eXIf with XMP: got %v, %v, %v", got, found, err)
+	}
+}
+
+func TestDetermine_PNGMetadata(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Screenshot.PNG": &fstest.MapFile{Data: pngWithChunks("eXIf", pngEXIF("2022:08:09 10:11:12")), ModTime: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	res, err := Determine(context.Background(), fsys, "Screenshot.PNG", Options{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != SourceMetadata || !res.CreatedAt.Equal(time.Date(2022, 8, 9, 10, 11, 12, 0, time.UTC)) {
+		t.Errorf("got %v from %q, want the eXIf date", res.CreatedAt, res.Source)
+	}
+}
@@ -0,0 +1,31 @@
+package createdat
+
+import (
+	"io"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/video"
+)
+
+// quicktimeExtractor reads the creation time in the movie header of an MP4 or QuickTime video. The
+// header records it in UTC; it is returned in loc, or time.Local if nil, so that a video is filed
+// under the day it was recorded on like the photos taken next to it.
+type quicktimeExtractor struct {
+	loc *time.Location
+}
+
+func (q quicktimeExtractor) CreatedAt(path string, r io.Reader) (time.Time, bool, error) {
+	info, ok, err := video.Read(r)
+	if err != nil {
+		return time.Time{}, false, &errcode.FileError{Op: "read movie header", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if !ok || info.CreatedAt.IsZero() {
+		return time.Time{}, false, nil
+	}
+	loc := q.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	return info.CreatedAt.In(loc), true, nil
+}
@@ -0,0 +1,52 @@
+package createdat
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// quicktimeMovie returns a minimal MP4 whose movie header records created, or no creation time when zero.
+func quicktimeMovie(created time.Time) []byte {
+	mvhd := make([]byte, 20)
+	if !created.IsZero() {
+		epoch := time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+		binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(epoch)/time.Second))
+	}
+	binary.BigEndian.PutUint32(mvhd[12:], 600)
+	moov := binary.BigEndian.AppendUint32(nil, uint32(len(mvhd)+16))
+	moov = append(moov, "moov"...)
+	moov = binary.BigEndian.AppendUint32(moov, uint32(len(mvhd)+8))
+	moov = append(moov, "mvhd"...)
+	return append(moov, mvhd...)
+}
+
+func TestDetermine_VideoCreationTime(t *testing.T) {
+	recorded := time.Date(2023, 7, 14, 22, 30, 5, 0, time.UTC)
+	mtime := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"clip.MOV":                &fstest.MapFile{Data: quicktimeMovie(recorded), ModTime: mtime},
+		"VID_20230101_120000.mp4": &fstest.MapFile{Data: quicktimeMovie(time.Time{}), ModTime: mtime},
+	}
+	loc := time.FixedZone("", 2*3600)
+
+	res, err := Determine(context.Background(), fsys, "clip.MOV", Options{Location: loc})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The UTC header time is reported in Options.Location, a day later here.
+	if res.Source != SourceMetadata || !res.CreatedAt.Equal(recorded) || res.CreatedAt.Day() != 15 {
+		t.Fatalf("got %v from %q, want %v from metadata", res.CreatedAt, res.Source, recorded.In(loc))
+	}
+
+	// Without a creation time in the header the filename is used.
+	res, err = Determine(context.Background(), fsys, "VID_20230101_120000.mp4", Options{Location: loc})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Source != SourceFilename {
+		t.Fatalf("got source %q, want filename", res.Source)
+	}
+}
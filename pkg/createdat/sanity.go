@@ -0,0 +1,64 @@
+package createdat
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultEarliest is the earliest plausible timestamp of DefaultSanity. Consumer digital cameras came
+// later; an earlier date is usually a camera clock reset to its epoch or a corrupt tag.
+var DefaultEarliest = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultMaxDisagreement is how far apart DefaultSanity lets the metadata and filename timestamps be.
+const DefaultMaxDisagreement = 30 * 24 * time.Hour
+
+// Sanity bounds the timestamps a file can plausibly have been created at. A timestamp outside them is
+// more likely a reset camera clock, a corrupt tag or a misread filename than the real date.
+type Sanity struct {
+	// Earliest is the earliest plausible timestamp; zero sets no lower bound.
+	Earliest time.Time
+
+	// Latest is the latest plausible timestamp, such as the time of the run; zero sets no upper bound.
+	Latest time.Time
+
+	// MaxDisagreement is how far apart the metadata and filename timestamps may be; zero does not
+	// compare them.
+	MaxDisagreement time.Duration
+}
+
+// DefaultSanity returns the bounds of a run at now: not before DefaultEarliest, not more than a day
+// after now, which absorbs timezones, and metadata and filename within DefaultMaxDisagreement.
+func DefaultSanity(now time.Time) Sanity {
+	return Sanity{Earliest: DefaultEarliest, Latest: now.Add(conflictThreshold), MaxDisagreement: DefaultMaxDisagreement}
+}
+
+// IsZero reports whether s checks nothing.
+func (s Sanity) IsZero() bool {
+	return s.Earliest.IsZero() && s.Latest.IsZero() && s.MaxDisagreement == 0
+}
+
+// Check returns why the chosen timestamp of d is implausible, and false when it is plausible. Files
+// without a timestamp are not checked, and neither are dates recorded by a photo catalog, which were
+// set or confirmed there.
+func (s Sanity) Check(d DetailedResult) (string, bool) {
+	best := d.Best.CreatedAt
+	if best.IsZero() || d.Best.Source == SourceCatalog {
+		return "", false
+	}
+	switch {
+	case !s.Earliest.IsZero() && best.Before(s.Earliest):
+		return fmt.Sprintf("dated %s, before %s", best.Format("2006-01-02"), s.Earliest.Format("2006-01-02")), true
+	case !s.Latest.IsZero() && best.After(s.Latest):
+		return fmt.Sprintf("dated %s, in the future", best.Format("2006-01-02")), true
+	}
+	if s.MaxDisagreement > 0 && d.Best.Source == SourceMetadata && !d.Filename.IsZero() {
+		diff := d.Metadata.Sub(d.Filename)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > s.MaxDisagreement {
+			return fmt.Sprintf("the metadata and filename dates are %d days apart", int(diff.Hours()/24)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,49 @@
+package createdat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSanityCheck(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := DefaultSanity(now)
+	at := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+	for name, tc := range map[string]struct {
+		d      DetailedResult
+		reason string
+	}{
+		"plausible": {
+			d: DetailedResult{Best: Result{CreatedAt: at(2024, 1, 2), Source: SourceMetadata}, Metadata: at(2024, 1, 2), Filename: at(2024, 1, 3)},
+		},
+		"clock reset": {
+			d:      DetailedResult{Best: Result{CreatedAt: at(1980, 1, 1), Source: SourceMetadata}, Metadata: at(1980, 1, 1)},
+			reason: "dated 1980-01-01, before 1990-01-01",
+		},
+		"future": {
+			d:      DetailedResult{Best: Result{CreatedAt: at(2024, 6, 3), Source: SourceMtime}, Filestat: at(2024, 6, 3)},
+			reason: "dated 2024-06-03, in the future",
+		},
+		"later today": {
+			d: DetailedResult{Best: Result{CreatedAt: now.Add(6 * time.Hour), Source: SourceFilename}, Filename: now.Add(6 * time.Hour)},
+		},
+		"disagreement": {
+			d:      DetailedResult{Best: Result{CreatedAt: at(2023, 1, 1), Source: SourceMetadata}, Metadata: at(2023, 1, 1), Filename: at(2024, 1, 1)},
+			reason: "the metadata and filename dates are 365 days apart",
+		},
+		"catalog": {
+			d: DetailedResult{Best: Result{CreatedAt: at(1975, 7, 14), Source: SourceCatalog}, Catalog: at(1975, 7, 14)},
+		},
+		"no date": {
+			d: DetailedResult{Best: Result{Source: SourceUnknown}},
+		},
+	} {
+		reason, ok := s.Check(tc.d)
+		if reason != tc.reason || ok != (tc.reason != "") {
+			t.Errorf("%s: Check = %q, %v, want %q", name, reason, ok, tc.reason)
+		}
+	}
+	if _, ok := (Sanity{}).Check(DetailedResult{Best: Result{CreatedAt: at(1980, 1, 1), Source: SourceMetadata}}); ok {
+		t.Error("expected the zero Sanity to check nothing")
+	}
+}
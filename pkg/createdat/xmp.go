@@ -0,0 +1,33 @@
+package createdat
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/xmpdate"
+)
+
+// sidecarDate returns the date recorded in the first XMP sidecar among sidecars, paths in fsys, that
+// has one: its photoshop:DateCreated, else its xmp:CreateDate, read in loc. Raw converters and photo
+// managers such as Lightroom, darktable and digiKam write them for files whose own metadata they do
+// not change. A sidecar that cannot be read is passed over.
+func sidecarDate(fsys fs.FS, sidecars []string, loc *time.Location) (time.Time, bool) {
+	for _, sc := range sidecars {
+		if !strings.EqualFold(path.Ext(sc), ".xmp") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, sc)
+		if err != nil {
+			continue
+		}
+		if t, ok := xmpdate.Read(data, loc); ok {
+			return t, true
+		}
+		if t, ok := xmpdate.ReadCreateDate(data, loc); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,40 @@
+package createdat
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDetermineDetailed_SidecarDate(t *testing.T) {
+	mtime := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"DSC_0001.NEF":     &fstest.MapFile{Data: []byte("raw"), ModTime: mtime},
+		"DSC_0001.NEF.xmp": &fstest.MapFile{Data: []byte(`<rdf:Description xmp:CreateDate="2019-06-07T08:09:10"/>`)},
+		"DSC_0001.json":    &fstest.MapFile{Data: []byte(`{}`)},
+		"DSC_0002.NEF":     &fstest.MapFile{Data: []byte("raw"), ModTime: mtime},
+		"DSC_0002.xmp":     &fstest.MapFile{Data: []byte(`<rdf:Description xmp:Rating="3"/>`)},
+	}
+	loc := time.FixedZone("", 3600)
+
+	d, err := DetermineDetailed(context.Background(), fsys, "DSC_0001.NEF", Options{
+		Location: loc,
+		Sidecars: []string{"DSC_0001.json", "DSC_0001.NEF.xmp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2019, 6, 7, 8, 9, 10, 0, loc); d.Best.Source != SourceMetadata || !d.Best.CreatedAt.Equal(want) {
+		t.Errorf("got %v from %q, want %v from the sidecar", d.Best.CreatedAt, d.Best.Source, want)
+	}
+
+	// A sidecar without a date leaves the file to its other candidates.
+	d, err = DetermineDetailed(context.Background(), fsys, "DSC_0002.NEF", Options{Location: loc, Sidecars: []string{"DSC_0002.xmp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Best.Source != SourceMtime {
+		t.Errorf("got source %q, want mtime", d.Best.Source)
+	}
+}
@@ -0,0 +1,541 @@
+// Package dashboard serves a small web frontend for organize runs, so imports can be previewed
+// and approved from a browser instead of the command line.
+//
+// The page shows the files a dry-run would import (with thumbnails), the duplicate groups and the
+// failures of the preview, and copies nothing until the import is approved.
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// PlanFunc computes a dry-run, reporting progress to r.
+type PlanFunc func(ctx context.Context, r progress.Reporter) (organizer.Result, error)
+
+// ExecuteFunc copies the planned files of res, updating res.Decisions in place and reporting progress to r.
+type ExecuteFunc func(ctx context.Context, res organizer.Result, r progress.Reporter) error
+
+// OpenFunc opens a source file for reading.
+type OpenFunc func(path string) (io.ReadCloser, error)
+
+// Config configures a Server.
+type Config struct {
+	// Title is shown at the top of the page.
+	Title string
+
+	Plan    PlanFunc
+	Execute ExecuteFunc
+
+	// Open reads sources for thumbnails; nil disables thumbnails.
+	Open OpenFunc
+}
+
+// ThumbnailSize is the longest side of a thumbnail in pixels.
+const ThumbnailSize = 160
+
+// maxListed bounds the number of rows per section, so a preview of a whole card stays a usable page.
+const maxListed = 500
+
+type phase int
+
+const (
+	phaseIdle phase = iota
+	phasePlanning
+	phaseConfirm
+	phaseExecuting
+	phaseDone
+)
+
+// Server is the http.Handler of the dashboard. Only one preview or import runs at a time.
+//
+// Every form of the page carries a token of the Server, and POSTs without it are refused, so
+// another site open in the same browser cannot start a preview or approve an import.
+type Server struct {
+	cfg   Config
+	token string
+
+	// ctx bounds the previews and imports; they outlive the request that started them.
+	ctx  context.Context
+	jobs sync.WaitGroup
+
+	mu    sync.Mutex
+	phase phase
+	// res is replaced, never updated in place: a running import updates a copy of its decisions.
+	res      organizer.Result
+	err      error
+	stages   map[string]progress.Event
+	planned  time.Time
+	executed bool
+	// thumbs caches the encoded thumbnails of the preview by source path; a new preview replaces it.
+	thumbs map[string][]byte
+}
+
+// New returns a dashboard whose previews and imports stop when ctx is canceled.
+func New(ctx context.Context, cfg Config) *Server {
+	return &Server{cfg: cfg, token: newToken(), ctx: ctx, stages: make(map[string]progress.Event), thumbs: make(map[string][]byte)}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// allowPost reports whether r is a POST from the page of this Server, writing an error if it is not.
+func (s *Server) allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.FormValue("token")), []byte(s.token)) != 1 {
+		http.Error(w, "invalid session token; reload the page", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Report implements progress.Reporter, recording the latest event of every stage.
+func (s *Server) Report(e progress.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stages[e.Stage] = e
+}
+
+// Wait blocks until the running preview or import, if any, has finished.
+func (s *Server) Wait() { s.jobs.Wait() }
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		s.serveIndex(w, r)
+	case "/plan":
+		s.servePlan(w, r)
+	case "/execute":
+		s.serveExecute(w, r)
+	case "/thumbnail":
+		s.serveThumbnail(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) servePlan(w http.ResponseWriter, r *http.Request) {
+	if !s.allowPost(w, r) {
+		return
+	}
+	s.mu.Lock()
+	if s.phase == phasePlanning || s.phase == phaseExecuting {
+		s.mu.Unlock()
+		http.Error(w, "a run is in progress", http.StatusConflict)
+		return
+	}
+	s.phase, s.res, s.err, s.executed = phasePlanning, organizer.Result{}, nil, false
+	s.stages, s.thumbs = make(map[string]progress.Event), make(map[string][]byte)
+	s.mu.Unlock()
+
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		res, err := s.cfg.Plan(s.ctx, s)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.res, s.err, s.planned = res, err, time.Now()
+		s.phase = phaseConfirm
+		if err != nil || pendingCopies(res.Decisions) == 0 {
+			s.phase = phaseDone
+		}
+	}()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) serveExecute(w http.ResponseWriter, r *http.Request) {
+	if !s.allowPost(w, r) {
+		return
+	}
+	s.mu.Lock()
+	// The form carries the time of the preview it shows, so a stale page cannot approve a newer preview.
+	if s.phase != phaseConfirm || r.FormValue("planned") != strconv.FormatInt(s.planned.UnixNano(), 10) {
+		s.mu.Unlock()
+		http.Error(w, "no preview to approve; refresh the page", http.StatusConflict)
+		return
+	}
+	s.phase = phaseExecuting
+	res := s.res
+	res.Decisions = slices.Clone(s.res.Decisions)
+	s.mu.Unlock()
+
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		err := s.cfg.Execute(s.ctx, res, s)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.res, s.err, s.executed, s.phase = res, err, true, phaseDone
+	}()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// serveThumbnail writes a JPEG thumbnail of the source of the decision with index i in the preview.
+// Sources are only addressed by index, so the dashboard never reads files outside the run.
+func (s *Server) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(r.FormValue("i"))
+	s.mu.Lock()
+	decisions, thumbs := s.res.Decisions, s.thumbs
+	s.mu.Unlock()
+	if err != nil || i < 0 || i >= len(decisions) || s.cfg.Open == nil || !Thumbnailable(decisions[i].SourcePath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := decisions[i].SourcePath
+	s.mu.Lock()
+	thumb, ok := thumbs[path]
+	s.mu.Unlock()
+	if !ok {
+		f, err := s.cfg.Open(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		thumb, err = readThumbnail(f, path)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		s.mu.Lock()
+		if len(thumbs) < maxCachedThumbnails {
+			thumbs[path] = thumb
+		}
+		s.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	_, _ = w.Write(thumb)
+}
+
+// Limits on the photos a thumbnail is decoded from, so one large file cannot exhaust the memory of
+// the dashboard. The thumbnail a camera embedded in a JPEG is used whatever the size of the photo.
+const (
+	maxThumbnailBytes  = 64 << 20
+	maxThumbnailPixels = 50_000_000
+)
+
+// maxCachedThumbnails bounds the thumbnails of a preview kept in memory, of a few KB each.
+const maxCachedThumbnails = 4 * maxListed
+
+var errTooLarge = errors.New("too large for a thumbnail")
+
+// readThumbnail returns the thumbnail of the image at path read from r, encoded as JPEG: the
+// thumbnail embedded in the EXIF data of a JPEG when it is at least ThumbnailSize, otherwise the
+// image decoded whole and scaled down.
+func readThumbnail(r io.Reader, path string) ([]byte, error) {
+	limited := &io.LimitedReader{R: r, N: maxThumbnailBytes}
+	// The metadata segments read for the embedded thumbnail are kept to decode the image from.
+	var head bytes.Buffer
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jpg" || ext == ".jpeg" {
+		if img := embeddedThumbnail(io.TeeReader(limited, &head)); img != nil {
+			return encodeThumbnail(img)
+		}
+	}
+
+	var header bytes.Buffer
+	src := io.MultiReader(&head, limited)
+	cfg, _, err := image.DecodeConfig(io.TeeReader(src, &header))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxThumbnailPixels {
+		return nil, fmt.Errorf("%dx%d pixels: %w", cfg.Width, cfg.Height, errTooLarge)
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, src))
+	if err != nil {
+		if limited.N == 0 {
+			return nil, fmt.Errorf("more than %d MB: %w", maxThumbnailBytes>>20, errTooLarge)
+		}
+		return nil, err
+	}
+	return encodeThumbnail(Thumbnail(img, ThumbnailSize))
+}
+
+// embeddedThumbnail returns the thumbnail in IFD1 of the EXIF data of the JPEG read from r, or nil
+// when it has none of at least ThumbnailSize. Only the metadata segments are read.
+func embeddedThumbnail(r io.Reader) image.Image {
+	segs, err := jpegseg.NewReader(r)
+	if err != nil {
+		return nil
+	}
+	for {
+		seg, err := segs.Next()
+		if err != nil {
+			return nil
+		}
+		if seg.Marker != jpegseg.APP1 {
+			continue
+		}
+		segment, err := segs.Payload()
+		if err != nil {
+			return nil
+		}
+		if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			continue
+		}
+		x, err := exif.Decode(bytes.NewReader(segment[6:]))
+		if err != nil {
+			return nil
+		}
+		img, err := jpeg.Decode(bytes.NewReader(exifThumbnail(x)))
+		if err != nil {
+			return nil
+		}
+		if b := img.Bounds(); max(b.Dx(), b.Dy()) < ThumbnailSize {
+			return nil
+		}
+		return Thumbnail(img, ThumbnailSize)
+	}
+}
+
+// exifThumbnail returns the JPEG thumbnail of x, checking the bounds goexif's JpegThumbnail does not.
+func exifThumbnail(x *exif.Exif) []byte {
+	var v [2]int
+	for i, name := range []exif.FieldName{exif.ThumbJPEGInterchangeFormat, exif.ThumbJPEGInterchangeFormatLength} {
+		tag, err := x.Get(name)
+		if err != nil {
+			return nil
+		}
+		if v[i], err = tag.Int(0); err != nil {
+			return nil
+		}
+	}
+	start, n := v[0], v[1]
+	if start < 0 || n <= 0 || start > len(x.Raw)-n {
+		return nil
+	}
+	return x.Raw[start : start+n]
+}
+
+func encodeThumbnail(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Thumbnailable reports whether the image decoders of the standard library can read path.
+func Thumbnailable(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// Thumbnail scales img down so its longest side is at most size, averaging the source pixels
+// that make up each thumbnail pixel.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+				}
+			}
+			out.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: 0xffff})
+		}
+	}
+	return out
+}
+
+func pendingCopies(decisions []reconcile.Decision) int {
+	n := 0
+	for _, d := range decisions {
+		if d.Action == reconcile.ActionCopy || d.Action == reconcile.ActionCopyRenamed {
+			n++
+		}
+	}
+	return n
+}
+
+//go:embed dashboard.html
+var pageSource string
+
+var page = template.Must(template.New("dashboard").Parse(pageSource))
+
+// row is a file shown on the page.
+type row struct {
+	Index       int
+	Source      string
+	Destination string
+	CreatedAt   string
+	Action      reconcile.Action
+	Error       string
+	Thumbnail   bool
+}
+
+// group is a set of identical sources, or of shots of a burst, of which only Kept is imported.
+type group struct {
+	Kept       row
+	Duplicates []row
+}
+
+// view is the data of the page template.
+type view struct {
+	Title    string
+	Token    string
+	Phase    string
+	Busy     bool
+	Stages   []progress.Event
+	Planned  string
+	Err      string
+	Executed bool
+	Counts   []count
+	Pending  int
+	Imports  []row
+	More     int
+	Groups   []group
+	Failures []row
+}
+
+type count struct {
+	Action reconcile.Action
+	N      int
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	v := s.view()
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// view builds the page data; s.mu is held.
+func (s *Server) view() view {
+	v := view{
+		Title:    s.cfg.Title,
+		Token:    s.token,
+		Phase:    [...]string{"idle", "planning", "confirm", "executing", "done"}[s.phase],
+		Busy:     s.phase == phasePlanning || s.phase == phaseExecuting,
+		Planned:  strconv.FormatInt(s.planned.UnixNano(), 10),
+		Executed: s.executed,
+	}
+	if s.err != nil {
+		v.Err = s.err.Error()
+	}
+	for _, stage := range []string{progress.StageScan, progress.StageAttribute, progress.StageDedupe, progress.StagePlan, progress.StageReconcile, progress.StageCopy} {
+		if e, ok := s.stages[stage]; ok {
+			v.Stages = append(v.Stages, e)
+		}
+	}
+	// The decisions of a running import are shown once it has finished.
+	if v.Busy {
+		return v
+	}
+
+	for action, n := range s.res.Counts() {
+		v.Counts = append(v.Counts, count{Action: action, N: n})
+	}
+	sort.Slice(v.Counts, func(i, j int) bool { return v.Counts[i].Action < v.Counts[j].Action })
+	v.Pending = pendingCopies(s.res.Decisions)
+
+	groups := make(map[string]*group)
+	var kept []string
+	rowOf := make(map[string]row, len(s.res.Decisions))
+	for i, d := range s.res.Decisions {
+		rw := row{
+			Index:       i,
+			Source:      d.SourcePath,
+			Destination: d.FinalDestinationPath,
+			Action:      d.Action,
+			Thumbnail:   s.cfg.Open != nil && Thumbnailable(d.SourcePath),
+		}
+		if best := s.res.Details[d.SourcePath].Best; !best.CreatedAt.IsZero() {
+			rw.CreatedAt = best.CreatedAt.Format("2006-01-02 15:04")
+		}
+		if d.Error != nil {
+			rw.Error = d.Error.Error()
+		}
+		rowOf[d.SourcePath] = rw
+
+		switch d.Action {
+		case reconcile.ActionCopy, reconcile.ActionCopyRenamed, reconcile.ActionCopied, reconcile.ActionCopiedRenamed:
+			if len(v.Imports) < maxListed {
+				v.Imports = append(v.Imports, rw)
+			} else {
+				v.More++
+			}
+		case reconcile.ActionFailed:
+			v.Failures = append(v.Failures, rw)
+		case reconcile.ActionSkippedDuplicateSrc, reconcile.ActionSkippedBurst:
+			g, ok := groups[d.DuplicateOf]
+			if !ok {
+				g = &group{}
+				groups[d.DuplicateOf] = g
+				kept = append(kept, d.DuplicateOf)
+			}
+			g.Duplicates = append(g.Duplicates, rw)
+		}
+	}
+	for _, src := range kept {
+		g := groups[src]
+		g.Kept = rowOf[src]
+		if g.Kept.Source == "" {
+			g.Kept.Source = src
+		}
+		v.Groups = append(v.Groups, *g)
+	}
+	return v
+}
@@ -0,0 +1,234 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+func TestServer_PreviewAndApprove(t *testing.T) {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 640, 480)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var executed []reconcile.Decision
+	s := New(context.Background(), Config{
+		Title: "card -> library",
+		Plan: func(ctx context.Context, r progress.Reporter) (organizer.Result, error) {
+			r.Report(progress.Event{Stage: progress.StageScan, Done: 3, Total: 3})
+			return organizer.Result{Decisions: []reconcile.Decision{
+				{SourcePath: "/card/a.jpg", FinalDestinationPath: "/library/2024/01/02/a.jpg", Action: reconcile.ActionCopy},
+				{SourcePath: "/card/copy-of-a.jpg", Action: reconcile.ActionSkippedDuplicateSrc, DuplicateOf: "/card/a.jpg"},
+				{SourcePath: "/card/b.mov", Action: reconcile.ActionFailed, Error: errors.New("permission denied")},
+			}}, nil
+		},
+		Execute: func(ctx context.Context, res organizer.Result, r progress.Reporter) error {
+			res.Decisions[0].Action = reconcile.ActionCopied
+			executed = res.Decisions
+			return nil
+		},
+		Open: func(path string) (io.ReadCloser, error) {
+			if path != "/card/a.jpg" {
+				t.Errorf("opened %s", path)
+			}
+			return io.NopCloser(bytes.NewReader(img.Bytes())), nil
+		},
+	})
+
+	if body := get(t, s, "/"); !strings.Contains(body, "Preview import") {
+		t.Fatalf("idle page: %s", body)
+	}
+	if code := post(t, s, "/execute", url.Values{"token": {s.token}}); code != http.StatusConflict {
+		t.Errorf("approve without preview: got status %d", code)
+	}
+
+	post(t, s, "/plan", url.Values{"token": {s.token}})
+	s.Wait()
+	body := get(t, s, "/")
+	for _, want := range []string{"Import 1 files", "/library/2024/01/02/a.jpg", "/card/copy-of-a.jpg", "permission denied", "scan 3/3", `src="/thumbnail?i=0"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("preview page lacks %q:\n%s", want, body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thumbnail?i=0", nil))
+	thumb, err := jpeg.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != ThumbnailSize || b.Dy() != 120 {
+		t.Errorf("got a %dx%d thumbnail", b.Dx(), b.Dy())
+	}
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thumbnail?i=2", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("thumbnail of a video: got status %d", rec.Code)
+	}
+
+	if code := post(t, s, "/execute", url.Values{"token": {s.token}, "planned": {"1"}}); code != http.StatusConflict {
+		t.Errorf("approve a stale preview: got status %d", code)
+	}
+	s.mu.Lock()
+	planned := s.view().Planned
+	s.mu.Unlock()
+	post(t, s, "/execute", url.Values{"token": {s.token}, "planned": {planned}})
+	s.Wait()
+	if len(executed) != 3 {
+		t.Fatalf("execute got %d decisions", len(executed))
+	}
+	if body := get(t, s, "/"); !strings.Contains(body, "The import has finished") || !strings.Contains(body, "1 copied") {
+		t.Errorf("done page: %s", body)
+	}
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	planned := false
+	s := New(context.Background(), Config{
+		Plan: func(ctx context.Context, r progress.Reporter) (organizer.Result, error) {
+			planned = true
+			return organizer.Result{}, nil
+		},
+	})
+
+	if body := get(t, s, "/"); !strings.Contains(body, `name="token" value="`+s.token+`"`) {
+		t.Fatalf("page lacks the session token:\n%s", body)
+	}
+	for _, form := range []url.Values{nil, {"token": {"guess"}}} {
+		if code := post(t, s, "/plan", form); code != http.StatusForbidden {
+			t.Errorf("POST /plan with %v: got status %d", form, code)
+		}
+	}
+	s.Wait()
+	if planned {
+		t.Error("a POST without the session token started a preview")
+	}
+	if s2 := New(context.Background(), Config{}); s2.token == s.token {
+		t.Error("two servers share a session token")
+	}
+}
+
+func TestServer_ExecuteDoesNotUpdateServedDecisions(t *testing.T) {
+	release := make(chan struct{})
+	s := New(context.Background(), Config{
+		Plan: func(ctx context.Context, r progress.Reporter) (organizer.Result, error) {
+			return organizer.Result{Decisions: []reconcile.Decision{
+				{SourcePath: "/card/a.jpg", FinalDestinationPath: "/library/a.jpg", Action: reconcile.ActionCopy},
+			}}, nil
+		},
+		Execute: func(ctx context.Context, res organizer.Result, r progress.Reporter) error {
+			res.Decisions[0].Action = reconcile.ActionCopied
+			<-release
+			return nil
+		},
+		Open: func(path string) (io.ReadCloser, error) { return nil, errors.New("unreadable") },
+	})
+	post(t, s, "/plan", url.Values{"token": {s.token}})
+	s.Wait()
+	s.mu.Lock()
+	planned := s.view().Planned
+	s.mu.Unlock()
+	post(t, s, "/execute", url.Values{"token": {s.token}, "planned": {planned}})
+
+	// Thumbnails are served from the preview while the import runs.
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thumbnail?i=0", nil))
+	s.mu.Lock()
+	during := s.res.Decisions[0].Action
+	s.mu.Unlock()
+	if during != reconcile.ActionCopy {
+		t.Errorf("the served decisions were updated by the running import: %s", during)
+	}
+
+	close(release)
+	s.Wait()
+	if body := get(t, s, "/"); !strings.Contains(body, "1 copied") {
+		t.Errorf("done page lacks the import's decisions: %s", body)
+	}
+}
+
+func TestServer_Thumbnail(t *testing.T) {
+	var thumb, large bytes.Buffer
+	if err := jpeg.Encode(&thumb, image.NewGray(image.Rect(0, 0, 160, 120)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&large, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// The start-of-frame segment of the large photo claims 30000x30000 pixels.
+	sof := bytes.Index(large.Bytes(), []byte{0xFF, 0xC0})
+	copy(large.Bytes()[sof+5:], []byte{0x75, 0x30, 0x75, 0x30})
+	files := map[string][]byte{
+		// The photo has no image data, so only its embedded thumbnail can be shown.
+		"/card/a.jpg": testjpeg.WithThumbnail(thumb.Bytes()),
+		"/card/b.jpg": large.Bytes(),
+	}
+	opened := make(map[string]int)
+	s := New(context.Background(), Config{
+		Plan: func(ctx context.Context, r progress.Reporter) (organizer.Result, error) {
+			return organizer.Result{Decisions: []reconcile.Decision{
+				{SourcePath: "/card/a.jpg", Action: reconcile.ActionCopy},
+				{SourcePath: "/card/b.jpg", Action: reconcile.ActionCopy},
+			}}, nil
+		},
+		Open: func(path string) (io.ReadCloser, error) {
+			opened[path]++
+			return io.NopCloser(bytes.NewReader(files[path])), nil
+		},
+	})
+	post(t, s, "/plan", url.Values{"token": {s.token}})
+	s.Wait()
+
+	for range 2 {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thumbnail?i=0", nil))
+		img, err := jpeg.Decode(rec.Body)
+		if err != nil {
+			t.Fatalf("decode embedded thumbnail: %v", err)
+		}
+		if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 120 {
+			t.Errorf("got a %dx%d thumbnail", b.Dx(), b.Dy())
+		}
+	}
+	if opened["/card/a.jpg"] != 1 {
+		t.Errorf("opened the photo %d times, want the cached thumbnail served", opened["/card/a.jpg"])
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/thumbnail?i=1", nil))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "too large") {
+		t.Errorf("thumbnail of a 30000x30000 photo: got status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func get(t *testing.T, h http.Handler, path string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func post(t *testing.T, h http.Handler, path string, form url.Values) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
@@ -0,0 +1,157 @@
+// Package destfs abstracts the writable filesystem a library is organized into,
+// so destinations do not have to be local paths. Remote sources are read through the same interface.
+//
+// Names are paths in the form used by the rest of the pipeline (filepath-joined, usually absolute);
+// each implementation decides how to map them onto its storage.
+package destfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// File is an open destination file.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Stat() (fs.FileInfo, error)
+	Sync() error
+}
+
+// FS is a writable filesystem.
+//
+// Errors must match the io/fs sentinels (fs.ErrNotExist, fs.ErrExist, fs.ErrPermission) with errors.Is.
+type FS interface {
+	// Stat returns the file info of name.
+	Stat(name string) (fs.FileInfo, error)
+
+	// Open opens name for reading.
+	Open(name string) (File, error)
+
+	// OpenFile opens name with os.OpenFile flags. Implementations must honor os.O_CREATE,
+	// os.O_EXCL (failing with fs.ErrExist) and os.O_TRUNC.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+
+	// ReadDir returns the entries of the directory name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// MkdirAll creates a directory and any missing parents.
+	MkdirAll(name string, perm fs.FileMode) error
+
+	// Remove removes a file.
+	Remove(name string) error
+}
+
+// OS returns the local filesystem.
+func OS() FS { return osFS{} }
+
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+// OrOS returns fsys, or the local filesystem when fsys is nil.
+func OrOS(fsys FS) FS {
+	if fsys == nil {
+		return OS()
+	}
+	return fsys
+}
+
+// IsOS reports whether fsys is the local filesystem (or nil).
+func IsOS(fsys FS) bool {
+	switch fsys.(type) {
+	case nil, osFS:
+		return true
+	}
+	return false
+}
+
+// DirFS returns a read-only io/fs view of the tree rooted at root in fsys,
+// for the scan and createdat stages.
+func DirFS(fsys FS, root string) fs.FS {
+	if IsOS(fsys) {
+		return os.DirFS(root)
+	}
+	return dirFS{fsys: fsys, root: root}
+}
+
+type dirFS struct {
+	fsys FS
+	root string
+}
+
+func (d dirFS) join(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(d.root, filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	full, err := d.join("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.fsys.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return dirFile{info: info}, nil
+	}
+	return d.fsys.Open(full)
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := d.join("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fsys.Stat(full)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := d.join("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return d.fsys.ReadDir(full)
+}
+
+// dirFile is an opened directory; its entries are listed through dirFS.ReadDir.
+type dirFile struct {
+	info fs.FileInfo
+}
+
+func (f dirFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (f dirFile) Close() error { return nil }
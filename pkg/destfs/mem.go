@@ -0,0 +1,207 @@
+package destfs
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mem is an in-memory filesystem, mainly for tests. The zero value is not usable; use NewMem.
+type Mem struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	dirs  map[string]bool
+	now   func() time.Time
+}
+
+type memData struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMem returns an empty in-memory filesystem.
+func NewMem() *Mem {
+	return &Mem{
+		files: make(map[string]*memData),
+		dirs:  map[string]bool{string(filepath.Separator): true, ".": true},
+		now:   time.Now,
+	}
+}
+
+// WriteFile creates or replaces name with data, creating parent directories.
+func (m *Mem) WriteFile(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	m.mkdirAll(filepath.Dir(name))
+	m.files[name] = &memData{data: append([]byte(nil), data...), mode: 0o644, modTime: m.now()}
+}
+
+// ReadFile returns the content of name.
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), d.data...), nil
+}
+
+// Files returns the names of all files, sorted.
+func (m *Mem) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stat implements FS.
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if d, ok := m.files[name]; ok {
+		return memInfo{name: filepath.Base(name), size: int64(len(d.data)), mode: d.mode, modTime: d.modTime}, nil
+	}
+	if m.dirs[name] {
+		return memInfo{name: filepath.Base(name), mode: fs.ModeDir | 0o755}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// Open implements FS.
+func (m *Mem) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile implements FS.
+func (m *Mem) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+
+	d, exists := m.files[name]
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !exists:
+		if !m.dirs[filepath.Dir(name)] {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		d = &memData{mode: perm, modTime: m.now()}
+		m.files[name] = d
+	case flag&os.O_TRUNC != 0:
+		d.data = nil
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	return &memFile{fs: m, name: name, d: d, r: bytes.NewReader(append([]byte(nil), d.data...)), writable: writable}, nil
+}
+
+// ReadDir implements FS.
+func (m *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for dir := range m.dirs {
+		if dir != name && filepath.Dir(dir) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(dir), mode: fs.ModeDir | 0o755}))
+		}
+	}
+	for file, d := range m.files {
+		if filepath.Dir(file) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(file), size: int64(len(d.data)), mode: d.mode, modTime: d.modTime}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// MkdirAll implements FS.
+func (m *Mem) MkdirAll(name string, _ fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	m.mkdirAll(name)
+	return nil
+}
+
+func (m *Mem) mkdirAll(name string) {
+	for !m.dirs[name] {
+		m.dirs[name] = true
+		name = filepath.Dir(name)
+	}
+}
+
+// Remove implements FS.
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+type memFile struct {
+	fs       *Mem
+	name     string
+	d        *memData
+	r        *bytes.Reader
+	writable bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	f.d.data = append(f.d.data, p...)
+	f.d.modTime = f.fs.now()
+	return len(p), nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.fs.Stat(f.name) }
+
+func (f *memFile) Sync() error { return nil }
+
+func (f *memFile) Close() error { return nil }
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() any           { return nil }
@@ -0,0 +1,62 @@
+package destfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMem_OpenFileHonorsFlags(t *testing.T) {
+	m := NewMem()
+	dir := filepath.Join(string(filepath.Separator), "lib", "a")
+	name := filepath.Join(dir, "f.jpg")
+
+	if _, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o644); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("create without parent: got %v, want fs.ErrNotExist", err)
+	}
+	if err := m.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, "data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("exclusive create of existing file: got %v, want fs.ErrExist", err)
+	}
+
+	info, err := m.Stat(name)
+	if err != nil || info.Size() != 4 {
+		t.Fatalf("stat = %v, %v", info, err)
+	}
+	if info, err := m.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("stat dir = %v, %v", info, err)
+	}
+
+	f, err = m.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, _ := m.ReadFile(name); len(got) != 0 {
+		t.Fatalf("expected truncated file, got %q", got)
+	}
+
+	if err := m.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat removed file: got %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package device identifies the device a media file was taken with, so the files of several phones or
+// cameras, even of the same model, can be kept apart.
+//
+// The identity is the camera recorded in the EXIF data, followed by the serial number of its body when
+// the device records one ("Canon EOS R5 #012345678901"). Files that name no camera, such as videos,
+// are identified by the device family their filename is typical of: PXL_20240102_030405123.mp4 is
+// from a Google Pixel, GOPR0001.MP4 from a GoPro.
+package device
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/camera"
+)
+
+// Identify returns the device name of the file name taken with c (the zero Camera when its EXIF data
+// names none), or "" when nothing identifies the device.
+func Identify(c camera.Camera, name string) string {
+	if c.IsZero() {
+		family, _ := FromFilename(name)
+		return family
+	}
+	if c.Serial == "" {
+		return c.String()
+	}
+	return c.String() + " #" + c.Serial
+}
+
+// filenamePrefixes map the filenames devices give their files to the device family.
+// The first matching pattern wins.
+var filenamePrefixes = []struct {
+	pattern *regexp.Regexp
+	family  string
+}{
+	{regexp.MustCompile(`(?i)^PXL_\d{8}_\d{6}`), "Google Pixel"},
+	{regexp.MustCompile(`^IMG-\d{8}-WA\d+`), "WhatsApp"},
+	{regexp.MustCompile(`(?i)^(?:IMG|VID|MVIMG)_\d{8}_\d{6}`), "Android"},
+	{regexp.MustCompile(`^(?:GOPR|GP\d{2}|GH\d{2}|GX\d{2})\d{4}`), "GoPro"},
+	{regexp.MustCompile(`^DJI_\d{4}`), "DJI"},
+	{regexp.MustCompile(`^DSCF\d{4}`), "Fujifilm"},
+	{regexp.MustCompile(`^DSCN\d{4}`), "Nikon"},
+	{regexp.MustCompile(`^MVI_\d{4}`), "Canon"},
+	{regexp.MustCompile(`^P\d{7}$`), "Panasonic"},
+}
+
+// FromFilename returns the device family the file name is typical of, and whether there is one.
+func FromFilename(name string) (string, bool) {
+	stem := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	for _, p := range filenamePrefixes {
+		if p.pattern.MatchString(stem) {
+			return p.family, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,49 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/quidome/media-organizer-go/pkg/camera"
+)
+
+func TestIdentify(t *testing.T) {
+	for _, tc := range []struct {
+		camera camera.Camera
+		name   string
+		want   string
+	}{
+		{camera.Camera{Make: "Canon", Model: "Canon EOS R5", Serial: "012345678901"}, "IMG_0001.JPG", "Canon EOS R5 #012345678901"},
+		{camera.Camera{Make: "Apple", Model: "iPhone 13"}, "IMG_0001.HEIC", "Apple iPhone 13"},
+		{camera.Camera{}, "PXL_20240102_030405123.mp4", "Google Pixel"},
+		{camera.Camera{}, "holiday.mov", ""},
+	} {
+		if got := Identify(tc.camera, tc.name); got != tc.want {
+			t.Errorf("Identify(%+v, %s) = %q, want %q", tc.camera, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"PXL_20240102_030405123.MP.jpg": "Google Pixel",
+		"IMG-20240102-WA0001.jpg":       "WhatsApp",
+		"VID_20240102_030405.mp4":       "Android",
+		"GOPR0001.MP4":                  "GoPro",
+		"GX010042.MP4":                  "GoPro",
+		"DJI_0042.JPG":                  "DJI",
+		"DSCF1234.RAF":                  "Fujifilm",
+		"DSCN1234.JPG":                  "Nikon",
+		"MVI_1234.MOV":                  "Canon",
+		"P1010001.JPG":                  "Panasonic",
+	}
+	for name, want := range tests {
+		if got, ok := FromFilename(name); !ok || got != want {
+			t.Errorf("FromFilename(%s) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"IMG_1234.JPG", "DSC01234.ARW", "Screenshot_2024-01-02-03-04-05.png", "holiday.jpg"} {
+		if got, ok := FromFilename(name); ok {
+			t.Errorf("FromFilename(%s) = %q, want none", name, got)
+		}
+	}
+}
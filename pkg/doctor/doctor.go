@@ -0,0 +1,196 @@
+// Package doctor inspects the environment the organizer runs in and reports actionable findings.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/quidome/media-organizer-go/pkg/progress"
+)
+
+// Status is the severity of a Finding.
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusInfo Status = "info"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Finding is the outcome of a single check.
+type Finding struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// Options configures Run.
+type Options struct {
+	// Destination is the library root that will be written to.
+	Destination string
+
+	// MinFreeBytes is the free-space threshold below which a warning is reported.
+	MinFreeBytes uint64
+
+	// Tools lists optional external executables to look up in PATH.
+	Tools []string
+}
+
+// DefaultOptions returns the checks run by the doctor command.
+func DefaultOptions(destination string) Options {
+	return Options{
+		Destination:  destination,
+		MinFreeBytes: 1 << 30,
+		Tools:        []string{"exiftool", "ffprobe"},
+	}
+}
+
+// Run performs all checks and returns their findings in a stable order.
+func Run(opts Options) []Finding {
+	var findings []Finding
+
+	dir, finding := existingDir(opts.Destination)
+	findings = append(findings, finding)
+	if dir == "" {
+		return append(findings, toolFindings(opts.Tools)...)
+	}
+
+	probeDir, err := os.MkdirTemp(dir, ".media-organizer-doctor-")
+	if err != nil {
+		findings = append(findings, Finding{
+			Check:   "writable",
+			Status:  StatusFail,
+			Message: fmt.Sprintf("cannot write to %s: %v", dir, err),
+			Hint:    "fix permissions or choose a different destination",
+		})
+	} else {
+		defer os.RemoveAll(probeDir)
+		findings = append(findings, Finding{Check: "writable", Status: StatusOK, Message: fmt.Sprintf("%s is writable", dir)})
+		findings = append(findings, capabilityFindings(probeDir)...)
+	}
+
+	findings = append(findings, freeSpaceFinding(dir, opts.MinFreeBytes))
+	findings = append(findings, toolFindings(opts.Tools)...)
+	return findings
+}
+
+// HasFailures reports whether any finding has StatusFail.
+func HasFailures(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// existingDir returns the destination, or its nearest existing ancestor when it does not exist yet.
+func existingDir(dest string) (string, Finding) {
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return "", Finding{Check: "destination", Status: StatusFail, Message: fmt.Sprintf("resolve %s: %v", dest, err)}
+	}
+
+	info, err := os.Stat(abs)
+	if err == nil {
+		if !info.IsDir() {
+			return "", Finding{Check: "destination", Status: StatusFail, Message: fmt.Sprintf("%s is not a directory", abs)}
+		}
+		return abs, Finding{Check: "destination", Status: StatusOK, Message: fmt.Sprintf("%s exists", abs)}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", Finding{Check: "destination", Status: StatusFail, Message: fmt.Sprintf("stat %s: %v", abs, err)}
+	}
+
+	parent := abs
+	for {
+		next := filepath.Dir(parent)
+		if next == parent {
+			return "", Finding{Check: "destination", Status: StatusFail, Message: fmt.Sprintf("no existing parent for %s", abs)}
+		}
+		parent = next
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			break
+		}
+	}
+	return parent, Finding{
+		Check:   "destination",
+		Status:  StatusInfo,
+		Message: fmt.Sprintf("%s does not exist yet; checks run against %s", abs, parent),
+		Hint:    "the destination is created on the first --execute run",
+	}
+}
+
+func capabilityFindings(dir string) []Finding {
+	src := filepath.Join(dir, "Probe")
+	if err := os.WriteFile(src, []byte("media-organizer doctor probe"), 0o644); err != nil {
+		return []Finding{{Check: "filesystem", Status: StatusFail, Message: fmt.Sprintf("write probe file: %v", err)}}
+	}
+
+	var findings []Finding
+
+	if _, err := os.Stat(filepath.Join(dir, "probe")); err == nil {
+		findings = append(findings, Finding{
+			Check:   "case-sensitivity",
+			Status:  StatusWarn,
+			Message: "destination filesystem is case-insensitive",
+			Hint:    "IMG_1.JPG and img_1.jpg will be treated as collisions and renamed",
+		})
+	} else {
+		findings = append(findings, Finding{Check: "case-sensitivity", Status: StatusOK, Message: "destination filesystem is case-sensitive"})
+	}
+
+	if err := os.Link(src, filepath.Join(dir, "hardlink")); err != nil {
+		findings = append(findings, Finding{Check: "hardlink", Status: StatusInfo, Message: fmt.Sprintf("hardlinks not supported: %v", err)})
+	} else {
+		findings = append(findings, Finding{Check: "hardlink", Status: StatusOK, Message: "hardlinks supported"})
+	}
+
+	if err := reflink(src, filepath.Join(dir, "reflink")); err != nil {
+		findings = append(findings, Finding{Check: "reflink", Status: StatusInfo, Message: fmt.Sprintf("reflinks not supported: %v", err)})
+	} else {
+		findings = append(findings, Finding{Check: "reflink", Status: StatusOK, Message: "reflinks (copy-on-write clones) supported"})
+	}
+
+	return findings
+}
+
+func freeSpaceFinding(dir string, minFree uint64) Finding {
+	free, err := freeBytes(dir)
+	if err != nil {
+		return Finding{Check: "free-space", Status: StatusInfo, Message: fmt.Sprintf("cannot determine free space: %v", err)}
+	}
+	if free < minFree {
+		return Finding{
+			Check:   "free-space",
+			Status:  StatusWarn,
+			Message: fmt.Sprintf("only %s free on %s", progress.FormatBytes(int64(free)), dir),
+			Hint:    "free up space before running --execute",
+		}
+	}
+	return Finding{Check: "free-space", Status: StatusOK, Message: fmt.Sprintf("%s free on %s", progress.FormatBytes(int64(free)), dir)}
+}
+
+func toolFindings(tools []string) []Finding {
+	findings := make([]Finding, 0, len(tools))
+	for _, tool := range tools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			findings = append(findings, Finding{
+				Check:   "tool:" + tool,
+				Status:  StatusInfo,
+				Message: fmt.Sprintf("optional tool %s not found in PATH", tool),
+				Hint:    fmt.Sprintf("install %s for richer metadata extraction", tool),
+			})
+			continue
+		}
+		findings = append(findings, Finding{Check: "tool:" + tool, Status: StatusOK, Message: fmt.Sprintf("%s found at %s", tool, path)})
+	}
+	return findings
+}
@@ -0,0 +1,74 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func findingFor(t *testing.T, findings []Finding, check string) Finding {
+	t.Helper()
+	for _, f := range findings {
+		if f.Check == check {
+			return f
+		}
+	}
+	t.Fatalf("no finding for %q in %+v", check, findings)
+	return Finding{}
+}
+
+func TestRun_WritableDestination(t *testing.T) {
+	dest := t.TempDir()
+
+	findings := Run(Options{Destination: dest, Tools: []string{"definitely-not-installed-tool"}})
+
+	if f := findingFor(t, findings, "writable"); f.Status != StatusOK {
+		t.Fatalf("expected writable destination, got %+v", f)
+	}
+	if f := findingFor(t, findings, "hardlink"); f.Status != StatusOK {
+		t.Fatalf("expected hardlink support on temp dir, got %+v", f)
+	}
+	findingFor(t, findings, "case-sensitivity")
+	findingFor(t, findings, "reflink")
+	findingFor(t, findings, "free-space")
+	if f := findingFor(t, findings, "tool:definitely-not-installed-tool"); f.Status != StatusInfo || f.Hint == "" {
+		t.Fatalf("expected missing tool to be reported with a hint, got %+v", f)
+	}
+	if HasFailures(findings) {
+		t.Fatalf("expected no failures, got %+v", findings)
+	}
+
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected probe files to be cleaned up, got %d entries", len(entries))
+	}
+}
+
+func TestRun_MissingDestinationChecksParent(t *testing.T) {
+	parent := t.TempDir()
+
+	findings := Run(Options{Destination: filepath.Join(parent, "library", "photos")})
+
+	f := findingFor(t, findings, "destination")
+	if f.Status != StatusInfo {
+		t.Fatalf("expected info finding for missing destination, got %+v", f)
+	}
+	if f := findingFor(t, findings, "writable"); f.Status != StatusOK {
+		t.Fatalf("expected parent to be writable, got %+v", f)
+	}
+}
+
+func TestRun_DestinationIsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	findings := Run(Options{Destination: file})
+	if !HasFailures(findings) {
+		t.Fatalf("expected failure for file destination, got %+v", findings)
+	}
+}
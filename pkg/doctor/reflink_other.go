@@ -0,0 +1,9 @@
+//go:build !linux
+
+package doctor
+
+import "errors"
+
+func reflink(src, dst string) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package doctor
+
+import "errors"
+
+func freeBytes(dir string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
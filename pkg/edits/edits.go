@@ -0,0 +1,97 @@
+// Package edits recognizes edited copies of photos by their filename and links them to their original.
+//
+// Phones and photo apps save an edit next to its original under a derived name: IMG_1234~2.jpg
+// and PXL_20240102_030405123~2.jpg (Android, Google Photos), IMG_1234-edited.jpg (Google Takeout)
+// and IMG_E1234.JPG (iPhone exports).
+package edits
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Preference selects which versions of a photo with an edit are organized.
+type Preference string
+
+const (
+	// PreferBoth organizes the original and its edits, side by side.
+	PreferBoth Preference = "both"
+	// PreferOriginal organizes only the original and skips its edits.
+	PreferOriginal Preference = "original"
+	// PreferEdit organizes only the edits and skips their original.
+	PreferEdit Preference = "edit"
+)
+
+// ParsePreference converts a CLI value into a Preference.
+func ParsePreference(s string) (Preference, error) {
+	switch p := Preference(strings.ToLower(strings.TrimSpace(s))); p {
+	case PreferBoth, PreferOriginal, PreferEdit:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid edit preference %q (want both, original or edit)", s)
+	}
+}
+
+var (
+	// reTilde matches the numbered copies of Android and Google Photos, "IMG_1234~2".
+	reTilde = regexp.MustCompile(`^(.+)~\d+$`)
+	// reEdited matches the edits of Google Takeout, "IMG_1234-edited".
+	reEdited = regexp.MustCompile(`(?i)^(.+)-edited$`)
+	// reAppleEdit matches the edits of iPhone exports, "IMG_E1234" for IMG_1234.
+	reAppleEdit = regexp.MustCompile(`^(IMG_)E(\d{4})$`)
+)
+
+// Original returns the stem (the name without extension) of the original of the file name, and whether
+// name is the name of an edit at all. The original may have a different extension than its edit.
+func Original(name string) (string, bool) {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if m := reTilde.FindStringSubmatch(stem); m != nil {
+		return m[1], true
+	}
+	if m := reEdited.FindStringSubmatch(stem); m != nil {
+		return m[1], true
+	}
+	if m := reAppleEdit.FindStringSubmatch(stem); m != nil {
+		return m[1] + m[2], true
+	}
+	return "", false
+}
+
+// Link pairs the edits among paths with their original: the file in the same directory whose stem is the
+// original's, preferring one with the same extension. It returns the original of each edit that has one.
+// Paths use the separator of the OS; names are compared case-insensitively.
+func Link(paths []string) map[string]string {
+	// Originals by directory and lower-case stem.
+	originals := make(map[string][]string)
+	for _, p := range paths {
+		name := filepath.Base(p)
+		if _, ok := Original(name); ok {
+			continue
+		}
+		key := filepath.Join(filepath.Dir(p), strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))))
+		originals[key] = append(originals[key], p)
+	}
+
+	links := make(map[string]string)
+	for _, p := range paths {
+		stem, ok := Original(filepath.Base(p))
+		if !ok {
+			continue
+		}
+		candidates := originals[filepath.Join(filepath.Dir(p), strings.ToLower(stem))]
+		if len(candidates) == 0 {
+			continue
+		}
+		original := candidates[0]
+		for _, c := range candidates {
+			if strings.EqualFold(filepath.Ext(c), filepath.Ext(p)) {
+				original = c
+				break
+			}
+		}
+		links[p] = original
+	}
+	return links
+}
@@ -0,0 +1,57 @@
+package edits
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOriginal(t *testing.T) {
+	tests := map[string]string{
+		"IMG_1234~2.jpg":                  "IMG_1234",
+		"PXL_20240102_030405123~2.jpg":    "PXL_20240102_030405123",
+		"PXL_20240102_030405123.MP~3.jpg": "PXL_20240102_030405123.MP",
+		"IMG_1234-edited.jpg":             "IMG_1234",
+		"IMG_1234-EDITED.JPG":             "IMG_1234",
+		"IMG_E1234.JPG":                   "IMG_1234",
+	}
+	for name, want := range tests {
+		if got, ok := Original(name); !ok || got != want {
+			t.Errorf("Original(%s) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"IMG_1234.jpg", "IMG_EDIT.jpg", "holiday~.jpg", "edited.jpg"} {
+		if got, ok := Original(name); ok {
+			t.Errorf("Original(%s) = %q, want no edit", name, got)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	p := func(parts ...string) string { return filepath.Join(append([]string{"src"}, parts...)...) }
+	paths := []string{
+		p("IMG_1234.HEIC"), p("IMG_1234.JPG"), p("IMG_1234~2.jpg"),
+		p("IMG_E1234.HEIC"),
+		p("a", "IMG_5678-edited.jpg"), p("b", "IMG_5678.jpg"),
+		p("img_9999.jpg"), p("IMG_9999-edited.jpg"),
+	}
+	want := map[string]string{
+		p("IMG_1234~2.jpg"):      p("IMG_1234.JPG"),
+		p("IMG_E1234.HEIC"):      p("IMG_1234.HEIC"),
+		p("IMG_9999-edited.jpg"): p("img_9999.jpg"),
+	}
+	if got := Link(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParsePreference(t *testing.T) {
+	for _, in := range []string{"both", "Original", " edit "} {
+		if _, err := ParsePreference(in); err != nil {
+			t.Errorf("ParsePreference(%q): %v", in, err)
+		}
+	}
+	if _, err := ParsePreference("newest"); err == nil {
+		t.Errorf("expected an error for an unknown preference")
+	}
+}
@@ -0,0 +1,137 @@
+// Package errcode defines the error values shared by the pipeline packages and classifies
+// per-file failures into stable, machine-readable codes so automation consuming JSON output
+// can branch on the failure class.
+package errcode
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Code identifies a class of failure. Codes are part of the JSON output and must stay stable.
+type Code string
+
+const (
+	// Unknown is reported for errors that carry no more specific code.
+	Unknown Code = "E_UNKNOWN"
+	// DestExists means the destination file appeared between planning and copying.
+	DestExists Code = "E_DEST_EXISTS"
+	// ReadFailed means the source file could not be opened or read.
+	ReadFailed Code = "E_READ_FAILED"
+	// WriteFailed means the destination file or directory could not be created or written.
+	WriteFailed Code = "E_WRITE_FAILED"
+	// NotFound means a file disappeared while the run was in progress.
+	NotFound Code = "E_NOT_FOUND"
+	// PermissionDenied means the operating system refused access.
+	PermissionDenied Code = "E_PERMISSION_DENIED"
+	// NotMedia means the path is not a media file (for example a directory).
+	NotMedia Code = "E_NOT_MEDIA"
+	// MetadataCorrupt means embedded metadata was present but could not be parsed.
+	MetadataCorrupt Code = "E_METADATA_CORRUPT"
+	// SidecarMissing means the sidecar policy requires a sidecar the media file does not have.
+	SidecarMissing Code = "E_SIDECAR_MISSING"
+	// HookRejected means an after-attribute hook exited non-zero for the file.
+	HookRejected Code = "E_HOOK_REJECTED"
+	// EmptyFile means the source file has no content, as left by a failed transfer.
+	EmptyFile Code = "E_EMPTY_FILE"
+	// Truncated means the source file ends before its format says it does.
+	Truncated Code = "E_TRUNCATED"
+	// VolumeFull means no destination volume has room left for the folder of the file.
+	VolumeFull Code = "E_VOLUME_FULL"
+	// DestIgnored means the destination lies in a directory marked to be left alone.
+	DestIgnored Code = "E_DEST_IGNORED"
+	// SourceChanged means the source file changed between planning and copying.
+	SourceChanged Code = "E_SOURCE_CHANGED"
+	// SourceMismatch means the content of the source file differs from the content it was planned with.
+	SourceMismatch Code = "E_SOURCE_MISMATCH"
+	// VerifyFailed means a copy read back from the destination does not match its source.
+	VerifyFailed Code = "E_VERIFY_FAILED"
+)
+
+// Sentinel errors shared across scan, createdat, reconcile and copy. Match them with errors.Is;
+// the errors returned by those packages also still match the underlying fs errors.
+var (
+	// ErrNotMedia is returned for paths that are not media files.
+	ErrNotMedia = New(NotMedia, "not a media file")
+	// ErrUnreadableSource is returned when a source file cannot be opened or read.
+	ErrUnreadableSource = New(ReadFailed, "unreadable source")
+	// ErrDestinationConflict is returned when a destination file already exists.
+	ErrDestinationConflict = New(DestExists, "destination file already exists")
+	// ErrMetadataCorrupt is returned when embedded metadata is present but cannot be parsed.
+	ErrMetadataCorrupt = New(MetadataCorrupt, "corrupt metadata")
+	// ErrEmptyFile is returned for source files without content.
+	ErrEmptyFile = New(EmptyFile, "empty file")
+	// ErrTruncated is returned for source files that are cut off.
+	ErrTruncated = New(Truncated, "truncated file")
+	// ErrDestinationIgnored is returned for destinations in a directory marked to be left alone.
+	ErrDestinationIgnored = New(DestIgnored, "destination directory is ignored")
+	// ErrSourceChanged is returned for source files whose size or modification time changed since they
+	// were planned.
+	ErrSourceChanged = New(SourceChanged, "source changed since it was planned")
+	// ErrSourceMismatch is returned for source files whose SHA-256 differs from the one they were
+	// planned with, even when their size and modification time did not change.
+	ErrSourceMismatch = New(SourceMismatch, "source content differs from the plan")
+	// ErrVerifyFailed is returned for copies whose content, read back, differs from what was copied.
+	ErrVerifyFailed = New(VerifyFailed, "copy does not match its source")
+)
+
+// FileError records a failed operation on a file.
+//
+// It matches both its Kind (one of the sentinel errors) and its underlying Err with errors.Is,
+// and Of reports the code of its Kind.
+type FileError struct {
+	Op   string
+	Path string
+	Kind error
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.Op + " " + e.Path + ": " + e.Err.Error() }
+
+func (e *FileError) Unwrap() []error { return []error{e.Kind, e.Err} }
+
+// Error attaches a Code to an underlying error. Its message is that of the underlying error.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns a sentinel error with the given code and message.
+func New(code Code, msg string) error {
+	return &Error{Code: code, Err: errors.New(msg)}
+}
+
+// Wrap attaches code to err. A nil err stays nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Of returns the code of err.
+//
+// The outermost code attached with Wrap or New wins; otherwise permission and
+// not-exist errors from the filesystem are recognized, and anything else is Unknown.
+// A nil err has no code.
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return PermissionDenied
+	case errors.Is(err, fs.ErrNotExist):
+		return NotFound
+	default:
+		return Unknown
+	}
+}
@@ -0,0 +1,65 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	sentinel := New(DestExists, "destination file already exists")
+
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"nil", nil, ""},
+		{"sentinel", sentinel, DestExists},
+		{"wrapped sentinel", fmt.Errorf("copy file: %w", sentinel), DestExists},
+		{"outermost code wins", Wrap(ReadFailed, fmt.Errorf("open: %w", Wrap(WriteFailed, errors.New("x")))), ReadFailed},
+		{"coded permission", Wrap(ReadFailed, fs.ErrPermission), ReadFailed},
+		{"permission", fmt.Errorf("open: %w", fs.ErrPermission), PermissionDenied},
+		{"not exist", fmt.Errorf("stat: %w", fs.ErrNotExist), NotFound},
+		{"plain", errors.New("boom"), Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.err); got != tt.want {
+				t.Fatalf("Of(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_KeepsMessageAndChain(t *testing.T) {
+	err := Wrap(ReadFailed, fs.ErrNotExist)
+	if err.Error() != fs.ErrNotExist.Error() {
+		t.Fatalf("message = %q", err.Error())
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("expected wrapped error to match fs.ErrNotExist")
+	}
+	if Wrap(ReadFailed, nil) != nil {
+		t.Fatal("Wrap(nil) must be nil")
+	}
+}
+
+func TestFileError_MatchesKindAndCause(t *testing.T) {
+	err := fmt.Errorf("copy file: %w", &FileError{Op: "open source", Path: "/a.jpg", Kind: ErrUnreadableSource, Err: fs.ErrNotExist})
+
+	if !errors.Is(err, ErrUnreadableSource) || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v to match both kind and cause", err)
+	}
+	var fe *FileError
+	if !errors.As(err, &fe) || fe.Path != "/a.jpg" {
+		t.Fatalf("errors.As failed for %v", err)
+	}
+	if code := Of(err); code != ReadFailed {
+		t.Fatalf("Of = %q, want %q", code, ReadFailed)
+	}
+	if got, want := fe.Error(), "open source /a.jpg: file does not exist"; got != want {
+		t.Fatalf("message = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+// Package exifwrite writes a created_at into the EXIF DateTimeOriginal tag of JPEG files that lack it,
+// so a date attributed from a filename or a catalog survives outside this tool.
+//
+// Existing EXIF data is never rewritten: the IFDs that change are copied to the end of the EXIF block
+// and the pointers to them are patched, so tag data at its old offsets (maker notes included) stays valid.
+package exifwrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+var (
+	// ErrUnsupported is returned for files that are not JPEG.
+	ErrUnsupported = errors.New("exifwrite: unsupported file format")
+
+	// ErrPresent is returned when the file already has a DateTimeOriginal tag.
+	ErrPresent = errors.New("exifwrite: DateTimeOriginal already set")
+
+	// ErrMalformed is returned when the JPEG or its EXIF block cannot be parsed.
+	ErrMalformed = errors.New("exifwrite: malformed file")
+)
+
+const (
+	tagExifIFDPointer   = 0x8769
+	tagDateTimeOriginal = 0x9003
+
+	typeASCII = 2
+	typeLong  = 4
+
+	// maxSegment is the largest APP1 payload, after the two length bytes.
+	maxSegment = 0xFFFF - 2
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Supported reports whether path has an extension exifwrite can write to.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// SetDateTimeOriginal returns a copy of the JPEG data with DateTimeOriginal set to t, in t's location.
+// It returns ErrPresent when the tag is already set and ErrUnsupported when data is not a JPEG.
+func SetDateTimeOriginal(data []byte, t time.Time) ([]byte, error) {
+	segs, err := jpegseg.NewReader(bytes.NewReader(data))
+	if err != nil || len(data) < 4 {
+		return nil, ErrUnsupported
+	}
+
+	// Walk the segments up to the image data, looking for the EXIF block.
+	insertAt := 2
+	for {
+		seg, err := segs.Next()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+		if seg.Marker == jpegseg.EOI || seg.Marker == jpegseg.SOS {
+			break
+		}
+		pos, end := int(seg.Offset), int(seg.End)
+		if end > len(data) {
+			return nil, fmt.Errorf("%w: bad segment length at offset %d", ErrMalformed, pos)
+		}
+		payload := data[pos+4 : end]
+		if seg.Marker == jpegseg.APP1 && bytes.HasPrefix(payload, exifHeader) {
+			tiff, err := addDateTimeOriginal(payload[len(exifHeader):], t)
+			if err != nil {
+				return nil, err
+			}
+			return splice(data, pos, end, tiff)
+		}
+		// A new EXIF block goes after a leading JFIF APP0 segment, which must come first.
+		if seg.Marker == jpegseg.APP0 && pos == 2 {
+			insertAt = end
+		}
+	}
+
+	return splice(data, insertAt, insertAt, newTIFF(t))
+}
+
+// WriteFile sets DateTimeOriginal of the JPEG at path to t. The file is replaced atomically and keeps
+// its permissions and modification time.
+func WriteFile(path string, t time.Time) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := SetDateTimeOriginal(data, t)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// splice replaces data[start:end] with an APP1 segment holding tiff.
+func splice(data []byte, start, end int, tiff []byte) ([]byte, error) {
+	size := len(exifHeader) + len(tiff)
+	if size > maxSegment {
+		return nil, fmt.Errorf("%w: EXIF block would exceed %d bytes", ErrMalformed, maxSegment)
+	}
+	out := make([]byte, 0, len(data)-(end-start)+size+4)
+	out = append(out, data[:start]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(size+2))
+	out = append(out, exifHeader...)
+	out = append(out, tiff...)
+	return append(out, data[end:]...), nil
+}
+
+// dateTime formats t as an EXIF ASCII value, including the terminating NUL.
+func dateTime(t time.Time) []byte {
+	return append([]byte(t.Format("2006:01:02 15:04:05")), 0)
+}
+
+// newTIFF returns a big-endian TIFF structure with an IFD0 pointing to an Exif IFD holding only DateTimeOriginal.
+func newTIFF(t time.Time) []byte {
+	bo := binary.BigEndian
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	b = appendIFD(bo, b, []entry{longEntry(bo, tagExifIFDPointer, 8+ifdSize(1))}, 0)
+	return appendExifIFD(bo, b, nil, 0, t)
+}
+
+// byteOrder reads and appends integers in the byte order of a TIFF structure.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// entry is a raw 12-byte IFD entry in the byte order of its TIFF structure.
+type entry [12]byte
+
+func (e entry) tag(bo byteOrder) uint16 { return bo.Uint16(e[0:]) }
+
+func longEntry(bo byteOrder, tag uint16, value uint32) entry {
+	var e entry
+	bo.PutUint16(e[0:], tag)
+	bo.PutUint16(e[2:], typeLong)
+	bo.PutUint32(e[4:], 1)
+	bo.PutUint32(e[8:], value)
+	return e
+}
+
+func ifdSize(entries int) uint32 { return uint32(2 + 12*entries + 4) }
+
+// appendIFD appends an IFD with entries, sorted by tag as TIFF requires, and the given next-IFD offset.
+func appendIFD(bo byteOrder, b []byte, entries []entry, next uint32) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag(bo) < entries[j].tag(bo) })
+	b = bo.AppendUint16(b, uint16(len(entries)))
+	for _, e := range entries {
+		b = append(b, e[:]...)
+	}
+	return bo.AppendUint32(b, next)
+}
+
+// appendExifIFD appends an Exif IFD holding entries plus DateTimeOriginal, followed by the date value.
+func appendExifIFD(bo byteOrder, b []byte, entries []entry, next uint32, t time.Time) []byte {
+	value := dateTime(t)
+	var e entry
+	bo.PutUint16(e[0:], tagDateTimeOriginal)
+	bo.PutUint16(e[2:], typeASCII)
+	bo.PutUint32(e[4:], uint32(len(value)))
+	bo.PutUint32(e[8:], uint32(len(b))+ifdSize(len(entries)+1))
+	b = appendIFD(bo, b, append(entries, e), next)
+	return append(b, value...)
+}
+
+// addDateTimeOriginal returns tiff with DateTimeOriginal added to its Exif IFD.
+func addDateTimeOriginal(tiff []byte, t time.Time) ([]byte, error) {
+	if len(tiff) < 8 {
+		return nil, fmt.Errorf("%w: short TIFF header", ErrMalformed)
+	}
+	var bo byteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: bad TIFF byte order", ErrMalformed)
+	}
+
+	ifd0Offset := bo.Uint32(tiff[4:])
+	ifd0, ifd0Next, err := readIFD(bo, tiff, ifd0Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new IFDs are appended at a word boundary, after the existing data.
+	b := append([]byte{}, tiff...)
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+
+	for i, e := range ifd0 {
+		if e.tag(bo) != tagExifIFDPointer {
+			continue
+		}
+		exifIFD, exifNext, err := readIFD(bo, tiff, bo.Uint32(e[8:]))
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range exifIFD {
+			if x.tag(bo) == tagDateTimeOriginal {
+				return nil, ErrPresent
+			}
+		}
+		// Point the existing IFD0 entry at the new Exif IFD.
+		bo.PutUint32(b[ifd0Offset+2+12*uint32(i)+8:], uint32(len(b)))
+		return appendExifIFD(bo, b, exifIFD, exifNext, t), nil
+	}
+
+	// No Exif IFD yet: copy IFD0 with a pointer to a new one, keeping its link to IFD1 (the thumbnail).
+	newIFD0 := uint32(len(b))
+	exifOffset := newIFD0 + ifdSize(len(ifd0)+1)
+	b = appendIFD(bo, b, append(ifd0, longEntry(bo, tagExifIFDPointer, exifOffset)), ifd0Next)
+	bo.PutUint32(b[4:], newIFD0)
+	return appendExifIFD(bo, b, nil, 0, t), nil
+}
+
+// readIFD returns the entries and next-IFD offset of the IFD at offset.
+func readIFD(bo byteOrder, tiff []byte, offset uint32) ([]entry, uint32, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, 0, fmt.Errorf("%w: IFD offset %d out of range", ErrMalformed, offset)
+	}
+	n := uint32(bo.Uint16(tiff[offset:]))
+	end := uint64(offset) + uint64(ifdSize(int(n)))
+	if end > uint64(len(tiff)) {
+		return nil, 0, fmt.Errorf("%w: IFD at %d out of range", ErrMalformed, offset)
+	}
+	entries := make([]entry, n)
+	for i := range entries {
+		copy(entries[i][:], tiff[offset+2+12*uint32(i):])
+	}
+	return entries, bo.Uint32(tiff[end-4:]), nil
+}
@@ -0,0 +1,167 @@
+package exifwrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func plainJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withEXIF inserts an APP1 EXIF segment holding tiff after the SOI marker of a plain JPEG.
+func withEXIF(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	data := plainJPEG(t)
+	out, err := splice(data, 2, 2, tiff)
+	if err != nil {
+		t.Fatalf("splice: %v", err)
+	}
+	return out
+}
+
+func checkDate(t *testing.T, data []byte, want string) *exif.Exif {
+	t.Helper()
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("image no longer decodes: %v", err)
+	}
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("exif.Decode: %v", err)
+	}
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		t.Fatalf("DateTimeOriginal: %v", err)
+	}
+	if got, _ := tag.StringVal(); got != want {
+		t.Errorf("DateTimeOriginal = %q, want %q", got, want)
+	}
+	return x
+}
+
+func TestSetDateTimeOriginalWithoutEXIF(t *testing.T) {
+	createdAt := time.Date(2021, 6, 7, 8, 9, 10, 0, time.FixedZone("", 7200))
+
+	out, err := SetDateTimeOriginal(plainJPEG(t), createdAt)
+	if err != nil {
+		t.Fatalf("SetDateTimeOriginal: %v", err)
+	}
+	checkDate(t, out, "2021:06:07 08:09:10")
+
+	if _, err := SetDateTimeOriginal(out, createdAt); !errors.Is(err, ErrPresent) {
+		t.Errorf("second write: got %v, want ErrPresent", err)
+	}
+}
+
+func TestSetDateTimeOriginalKeepsExistingTags(t *testing.T) {
+	createdAt := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Little-endian IFD0 with Make and an Exif IFD holding only ISOSpeedRatings.
+	bo := binary.LittleEndian
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	tiff = bo.AppendUint16(tiff, 2)
+	tiff = appendRaw(bo, tiff, 0x010F, typeASCII, 6, 8+ifdSize(2)+ifdSize(1))
+	tiff = appendRaw(bo, tiff, tagExifIFDPointer, typeLong, 1, 8+ifdSize(2))
+	tiff = bo.AppendUint32(tiff, 0)
+	tiff = bo.AppendUint16(tiff, 1)
+	tiff = appendRaw(bo, tiff, 0x8827, 3, 1, 100)
+	tiff = bo.AppendUint32(tiff, 0)
+	tiff = append(tiff, "Canon\x00"...)
+
+	out, err := SetDateTimeOriginal(withEXIF(t, tiff), createdAt)
+	if err != nil {
+		t.Fatalf("SetDateTimeOriginal: %v", err)
+	}
+	x := checkDate(t, out, "2019:01:02 03:04:05")
+	if mk, err := x.Get(exif.Make); err != nil {
+		t.Errorf("Make lost: %v", err)
+	} else if s, _ := mk.StringVal(); s != "Canon" {
+		t.Errorf("Make = %q", s)
+	}
+	if iso, err := x.Get(exif.ISOSpeedRatings); err != nil {
+		t.Errorf("ISOSpeedRatings lost: %v", err)
+	} else if v, _ := iso.Int(0); v != 100 {
+		t.Errorf("ISOSpeedRatings = %d", v)
+	}
+}
+
+func TestSetDateTimeOriginalAddsExifIFD(t *testing.T) {
+	// Big-endian IFD0 with only an Orientation tag.
+	bo := binary.BigEndian
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	tiff = bo.AppendUint16(tiff, 1)
+	tiff = appendRaw(bo, tiff, 0x0112, 3, 1, 6<<16)
+	tiff = bo.AppendUint32(tiff, 0)
+
+	out, err := SetDateTimeOriginal(withEXIF(t, tiff), time.Date(2020, 12, 31, 23, 59, 58, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("SetDateTimeOriginal: %v", err)
+	}
+	x := checkDate(t, out, "2020:12:31 23:59:58")
+	if o, err := x.Get(exif.Orientation); err != nil {
+		t.Errorf("Orientation lost: %v", err)
+	} else if v, _ := o.Int(0); v != 6 {
+		t.Errorf("Orientation = %d", v)
+	}
+}
+
+func TestSetDateTimeOriginalRejectsOtherFormats(t *testing.T) {
+	if _, err := SetDateTimeOriginal([]byte("\x89PNG\r\n\x1a\n"), time.Now()); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want ErrUnsupported", err)
+	}
+	truncated := plainJPEG(t)[:10]
+	if _, err := SetDateTimeOriginal(truncated, time.Now()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v, want ErrMalformed", err)
+	}
+}
+
+func TestWriteFileKeepsModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "IMG_1.jpg")
+	if err := os.WriteFile(path, plainJPEG(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDate(t, data, "2022:03:04 05:06:07")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) || info.Mode().Perm() != 0o600 {
+		t.Errorf("mode %v, mtime %v; want 0600, %v", info.Mode().Perm(), info.ModTime(), mtime)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func appendRaw(bo byteOrder, b []byte, tag, typ uint16, count, value uint32) []byte {
+	b = bo.AppendUint16(b, tag)
+	b = bo.AppendUint16(b, typ)
+	b = bo.AppendUint32(b, count)
+	return bo.AppendUint32(b, value)
+}
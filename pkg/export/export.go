@@ -0,0 +1,165 @@
+// Package export writes the files of a scan or organize run, with their dates and decisions, to a
+// SQLite database or a Parquet file, so the results of large runs can be queried with SQL or loaded
+// into a data frame instead of parsing JSON.
+//
+// Both formats have one row per file with the columns of Columns. Missing values, such as the
+// decision of a scanned file, are NULL. Times are stored in UTC: as RFC 3339 text in SQLite and as
+// millisecond timestamps in Parquet.
+package export
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Format is the file format of an export.
+type Format string
+
+const (
+	// FormatSQLite writes a SQLite database with the table Table.
+	FormatSQLite Format = "sqlite"
+	// FormatParquet writes a Parquet file.
+	FormatParquet Format = "parquet"
+)
+
+// FormatOf returns the format of an export file by its extension: .db, .sqlite or .sqlite3 for
+// SQLite, .parquet for Parquet.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return FormatSQLite, nil
+	case ".parquet":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("unknown export format of %s (want a .db, .sqlite, .sqlite3 or .parquet file)", path)
+	}
+}
+
+// Table is the name of the SQLite table holding the rows.
+const Table = "files"
+
+// Row is one file of a run.
+type Row struct {
+	SourcePath    string
+	FileSizeBytes int64
+	ModTime       time.Time
+
+	// The created_at candidates of the file.
+	CreatedAtCatalog   time.Time
+	CreatedAtMetadata  time.Time
+	CreatedAtFilename  time.Time
+	CreatedAtDirectory time.Time
+	CreatedAtFilestat  time.Time
+
+	// The candidate chosen, where it came from and how far it can be trusted.
+	BestCreatedAt time.Time
+	BestSource    string
+	Confidence    string
+
+	Place  string
+	Camera string
+	Device string
+
+	// The decision of an organize run.
+	DestinationPath      string
+	FinalDestinationPath string
+	Action               string
+	DuplicateOf          string
+	Error                string
+	ErrorCode            string
+}
+
+// kind is the type of a column.
+type kind int
+
+const (
+	kindText kind = iota
+	kindInt
+	kindTime
+)
+
+// column is a column of the export and how to read it from a row. Optional columns are NULL for
+// zero values.
+type column struct {
+	name     string
+	kind     kind
+	optional bool
+	value    func(r *Row) any
+}
+
+// columns are the columns of the export, in order.
+var columns = []column{
+	{"source_path", kindText, false, func(r *Row) any { return r.SourcePath }},
+	{"file_size_bytes", kindInt, false, func(r *Row) any { return r.FileSizeBytes }},
+	{"mod_time", kindTime, true, func(r *Row) any { return r.ModTime }},
+	{"created_at_catalog", kindTime, true, func(r *Row) any { return r.CreatedAtCatalog }},
+	{"created_at_metadata", kindTime, true, func(r *Row) any { return r.CreatedAtMetadata }},
+	{"created_at_filename", kindTime, true, func(r *Row) any { return r.CreatedAtFilename }},
+	{"created_at_directory", kindTime, true, func(r *Row) any { return r.CreatedAtDirectory }},
+	{"created_at_filestat", kindTime, true, func(r *Row) any { return r.CreatedAtFilestat }},
+	{"best_created_at", kindTime, true, func(r *Row) any { return r.BestCreatedAt }},
+	{"best_source", kindText, true, func(r *Row) any { return r.BestSource }},
+	{"confidence", kindText, true, func(r *Row) any { return r.Confidence }},
+	{"place", kindText, true, func(r *Row) any { return r.Place }},
+	{"camera", kindText, true, func(r *Row) any { return r.Camera }},
+	{"device", kindText, true, func(r *Row) any { return r.Device }},
+	{"destination_path", kindText, true, func(r *Row) any { return r.DestinationPath }},
+	{"final_destination_path", kindText, true, func(r *Row) any { return r.FinalDestinationPath }},
+	{"action", kindText, true, func(r *Row) any { return r.Action }},
+	{"duplicate_of", kindText, true, func(r *Row) any { return r.DuplicateOf }},
+	{"error", kindText, true, func(r *Row) any { return r.Error }},
+	{"error_code", kindText, true, func(r *Row) any { return r.ErrorCode }},
+}
+
+// Columns returns the names of the columns of an export, in order.
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// isNull reports whether v, a value of column c, is written as NULL.
+func (c column) isNull(v any) bool {
+	if !c.optional {
+		return false
+	}
+	switch v := v.(type) {
+	case string:
+		return v == ""
+	case time.Time:
+		return v.IsZero()
+	}
+	return false
+}
+
+// Writer writes rows to an export file. Rows may be written in several calls, such as one per batch
+// of a run; the file is complete once Close returns.
+type Writer interface {
+	Write(ctx context.Context, rows []Row) error
+	Close() error
+}
+
+// Create creates the export file at path in format. An existing file is not overwritten.
+func Create(ctx context.Context, path string, format Format) (Writer, error) {
+	var (
+		w   Writer
+		err error
+	)
+	switch format {
+	case FormatSQLite:
+		w, err = createSQLite(ctx, path)
+	case FormatParquet:
+		w, err = createParquet(path)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create export %s: %w", path, err)
+	}
+	return w, nil
+}
@@ -0,0 +1,195 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRows(n int) []Row {
+	rows := make([]Row, n)
+	for i := range rows {
+		rows[i] = Row{
+			SourcePath:    fmt.Sprintf("/src/IMG_%05d.jpg", i),
+			FileSizeBytes: int64(i),
+			ModTime:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+		if i%2 == 0 {
+			rows[i].BestCreatedAt = time.Date(2023, 6, 15, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+			rows[i].BestSource = "metadata"
+			rows[i].Action = "copy"
+		}
+	}
+	return rows
+}
+
+func TestFormatOf(t *testing.T) {
+	for path, want := range map[string]Format{"run.db": FormatSQLite, "run.SQLITE": FormatSQLite, "run.sqlite3": FormatSQLite, "run.parquet": FormatParquet} {
+		if got, err := FormatOf(path); err != nil || got != want {
+			t.Errorf("FormatOf(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	if _, err := FormatOf("run.csv"); err == nil {
+		t.Error("expected an error for an unknown extension")
+	}
+}
+
+func TestCreate_SQLite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "run.db")
+	w, err := Create(ctx, path, FormatSQLite)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	rows := testRows(3)
+	if err := w.Write(ctx, rows[:2]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Write(ctx, rows[2:]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n, copies int
+	if err := db.QueryRow(`SELECT count(*), count(action) FROM files`).Scan(&n, &copies); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || copies != 2 {
+		t.Errorf("expected 3 rows with 2 actions, got %d and %d", n, copies)
+	}
+	var best string
+	if err := db.QueryRow(`SELECT best_created_at FROM files WHERE source_path = ?`, rows[0].SourcePath).Scan(&best); err != nil {
+		t.Fatal(err)
+	}
+	if best != "2023-06-15T10:00:00Z" {
+		t.Errorf("expected the best created_at in UTC, got %q", best)
+	}
+
+	if _, err := Create(ctx, path, FormatSQLite); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected an existing export to be refused, got %v", err)
+	}
+}
+
+func TestCreate_Parquet(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "run.parquet")
+	w, err := Create(ctx, path, FormatParquet)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	rows := testRows(rowGroupSize + 10)
+	if err := w.Write(ctx, rows); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatal("expected the Parquet magic at both ends")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := (&thriftReader{b: data[len(data)-8-size : len(data)-8]}).structure()
+	if footer[3] != int64(len(rows)) {
+		t.Errorf("expected %d rows, got %v", len(rows), footer[3])
+	}
+	schema := footer[2].([]any)
+	if len(schema) != len(columns)+1 || string(schema[1].(map[int16]any)[4].([]byte)) != "source_path" {
+		t.Errorf("unexpected schema %v", schema)
+	}
+	groups := footer[4].([]any)
+	if len(groups) != 2 || groups[1].(map[int16]any)[3] != int64(10) {
+		t.Fatalf("expected a full and a partial row group, got %v", groups)
+	}
+
+	// The source_path page of the second row group: 10 PLAIN values with a length prefix each.
+	chunk := groups[1].(map[int16]any)[1].([]any)[0].(map[int16]any)
+	r := &thriftReader{b: data, p: int(chunk[3].(map[int16]any)[9].(int64))}
+	if header := r.structure(); header[2] != int64(10*(4+len(rows[rowGroupSize].SourcePath))) {
+		t.Errorf("unexpected page header %v", header)
+	}
+	n := int(binary.LittleEndian.Uint32(data[r.p:]))
+	if got := string(data[r.p+4 : r.p+4+n]); got != rows[rowGroupSize].SourcePath {
+		t.Errorf("expected %s, got %s", rows[rowGroupSize].SourcePath, got)
+	}
+}
+
+// thriftReader decodes the Thrift compact protocol, enough to check the metadata of a Parquet file.
+type thriftReader struct {
+	b []byte
+	p int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.p:])
+	r.p += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case 5, 6:
+		return r.varint()
+	case 8:
+		n := int(r.uvarint())
+		r.p += n
+		return r.b[r.p-n : r.p]
+	case 9:
+		h := r.b[r.p]
+		r.p++
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		h := r.b[r.p]
+		r.p++
+		if h == 0 {
+			return fields
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+}
@@ -0,0 +1,335 @@
+package export
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+// rowGroupSize is the number of rows of a Parquet row group; the rows of a group are held in memory
+// until it is written.
+const rowGroupSize = 1 << 16
+
+// Parquet physical types, encodings and converted types (parquet.thrift).
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+// parquetWriter writes rows to a Parquet file: a row group per rowGroupSize rows with one
+// uncompressed, PLAIN encoded data page per column, which every Parquet reader understands.
+type parquetWriter struct {
+	f       *os.File
+	offset  int64
+	pending []Row
+	groups  []parquetGroup
+	rows    int64
+	err     error
+}
+
+// parquetGroup is a row group written to the file.
+type parquetGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetChunk is a column chunk written to the file.
+type parquetChunk struct {
+	offset, size, values int64
+}
+
+var parquetMagic = []byte("PAR1")
+
+func createParquet(path string) (*parquetWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w := &parquetWriter{f: f}
+	w.write(parquetMagic)
+	if w.err != nil {
+		f.Close()
+		return nil, w.err
+	}
+	return w, nil
+}
+
+// Write adds rows to the file, writing every row group that is full.
+func (w *parquetWriter) Write(_ context.Context, rows []Row) error {
+	for len(rows) > 0 && w.err == nil {
+		n := min(rowGroupSize-len(w.pending), len(rows))
+		w.pending = append(w.pending, rows[:n]...)
+		rows = rows[n:]
+		if len(w.pending) == rowGroupSize {
+			w.flush()
+		}
+	}
+	if w.err != nil {
+		return fmt.Errorf("export: %w", w.err)
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer.
+func (w *parquetWriter) Close() error {
+	if len(w.pending) > 0 {
+		w.flush()
+	}
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write(parquetMagic)
+	if err := w.f.Close(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return fmt.Errorf("export: %w", w.err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.f.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// flush writes the pending rows as a row group.
+func (w *parquetWriter) flush() {
+	group := parquetGroup{rows: int64(len(w.pending))}
+	for _, c := range columns {
+		page := c.page(w.pending)
+		var header thriftWriter
+		header.begin()
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.beginStruct(5)
+		header.i32(1, int32(len(w.pending)))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.end()
+		header.end()
+
+		chunk := parquetChunk{offset: w.offset, size: int64(len(header.buf) + len(page)), values: int64(len(w.pending))}
+		w.write(header.buf)
+		w.write(page)
+		group.chunks = append(group.chunks, chunk)
+	}
+	w.groups = append(w.groups, group)
+	w.rows += group.rows
+	w.pending = w.pending[:0]
+}
+
+// page returns the data page of column c of rows: the definition levels of an optional column, then
+// the values that are not NULL.
+func (c column) page(rows []Row) []byte {
+	var levels, values []byte
+	var run int
+	var present bool
+	for i := range rows {
+		v := c.value(&rows[i])
+		null := c.isNull(v)
+		if c.optional {
+			if run > 0 && present == null {
+				levels = appendRun(levels, run, present)
+				run = 0
+			}
+			present = !null
+			run++
+		}
+		if null {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			values = binary.LittleEndian.AppendUint32(values, uint32(len(v)))
+			values = append(values, v...)
+		case int64:
+			values = binary.LittleEndian.AppendUint64(values, uint64(v))
+		case time.Time:
+			values = binary.LittleEndian.AppendUint64(values, uint64(v.UnixMilli()))
+		}
+	}
+	if !c.optional {
+		return values
+	}
+	if run > 0 {
+		levels = appendRun(levels, run, present)
+	}
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	return append(page, values...)
+}
+
+// appendRun appends a run of n equal definition levels in the RLE/bit-packing hybrid encoding with a
+// bit width of 1.
+func appendRun(b []byte, n int, present bool) []byte {
+	b = binary.AppendUvarint(b, uint64(n)<<1)
+	if present {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// footer returns the FileMetaData of the file.
+func (w *parquetWriter) footer() []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // version
+	t.beginList(2, thriftStruct, len(columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(columns)))
+	t.end()
+	for _, c := range columns {
+		t.begin()
+		t.i32(1, c.physicalType())
+		repetition := int32(parquetRequired)
+		if c.optional {
+			repetition = parquetOptional
+		}
+		t.i32(3, repetition)
+		t.binary(4, c.name)
+		switch c.kind {
+		case kindText:
+			t.i32(6, convertedUTF8)
+		case kindTime:
+			t.i32(6, convertedTimestampMillis)
+		}
+		t.end()
+	}
+	t.i64(3, w.rows)
+	t.beginList(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.begin()
+		var size int64
+		t.beginList(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			size += chunk.size
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.beginStruct(3)
+			t.i32(1, columns[i].physicalType())
+			t.beginList(2, thriftI32, 2)
+			t.appendI32(encodingPlain)
+			t.appendI32(encodingRLE)
+			t.beginList(3, thriftBinary, 1)
+			t.appendBinary(columns[i].name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.binary(6, "media-organizer")
+	t.end()
+	return t.buf
+}
+
+func (c column) physicalType() int32 {
+	if c.kind == kindText {
+		return parquetByteArray
+	}
+	return parquetInt64
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Parquet metadata structures in the Thrift compact protocol.
+type thriftWriter struct {
+	buf []byte
+	// last holds the ID of the last field written of each open struct.
+	last []int16
+}
+
+// begin opens a struct: the top-level one, or an element of a list of structs.
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+// end closes the innermost open struct.
+func (t *thriftWriter) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// varint appends v zigzag-encoded.
+func (t *thriftWriter) varint(v int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(v<<1)^uint64(v>>63))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.appendBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// beginList writes the header of a list of n elements of type elem; the elements follow.
+func (t *thriftWriter) beginList(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
+
+func (t *thriftWriter) appendI32(v int32) { t.varint(int64(v)) }
+
+func (t *thriftWriter) appendBinary(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// sqliteWriter inserts rows into the table Table of a new SQLite database.
+type sqliteWriter struct {
+	db     *sql.DB
+	insert string
+}
+
+func createSQLite(ctx context.Context, path string) (*sqliteWriter, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(abs); err == nil {
+		return nil, fs.ErrExist
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: abs}).EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]string, len(columns))
+	for i, c := range columns {
+		typ := "TEXT"
+		if c.kind == kindInt {
+			typ = "INTEGER"
+		}
+		if !c.optional {
+			typ += " NOT NULL"
+		}
+		defs[i] = c.name + " " + typ
+	}
+	schema := fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", Table, strings.Join(defs, ",\n\t"))
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)", Table, strings.Join(Columns(), ", "), strings.Repeat(", ?", len(columns)-1))
+	return &sqliteWriter{db: db, insert: insert}, nil
+}
+
+// Write inserts rows in one transaction.
+func (w *sqliteWriter) Write(ctx context.Context, rows []Row) error {
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, w.insert)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	defer stmt.Close()
+
+	args := make([]any, len(columns))
+	for i := range rows {
+		for j, c := range columns {
+			v := c.value(&rows[i])
+			switch {
+			case c.isNull(v):
+				v = nil
+			case c.kind == kindTime:
+				v = v.(time.Time).UTC().Format(time.RFC3339)
+			}
+			args[j] = v
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("export %s: %w", rows[i].SourcePath, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	return w.db.Close()
+}
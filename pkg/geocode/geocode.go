@@ -0,0 +1,245 @@
+// Package geocode resolves the GPS coordinates recorded in media files to places (city and country).
+//
+// Geocoder is the extension point; Offline is the built-in implementation. It needs no network:
+// coordinates are matched to the nearest entry of a places dataset, either the one bundled with
+// the binary (capitals, large cities and popular destinations) or a GeoNames cities dump loaded
+// with LoadGeoNames for finer coverage. Both record the IANA timezone of their places, and the
+// timezone database is embedded, so Place.Location works on systems without one.
+package geocode
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Point is a WGS84 coordinate in decimal degrees.
+type Point struct {
+	Lat, Lon float64
+}
+
+// Place is the result of reverse geocoding. City is empty when no city is close enough.
+// Timezone is the IANA timezone of the nearest place, such as "Europe/Rome", empty when unknown.
+type Place struct {
+	City     string `json:"city,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// String returns "City, Country", or only the part that is known.
+func (p Place) String() string {
+	switch {
+	case p.City == "":
+		return p.Country
+	case p.Country == "":
+		return p.City
+	}
+	return p.City + ", " + p.Country
+}
+
+// Location returns the timezone of p. ok is false when p has none, or one the timezone database does not know.
+func (p Place) Location() (loc *time.Location, ok bool) {
+	if p.Timezone == "" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// Geocoder resolves a point to a place. ok is false when the point is not near any known place.
+type Geocoder interface {
+	Reverse(ctx context.Context, p Point) (place Place, ok bool, err error)
+}
+
+// ReadPoint returns the GPS position in the EXIF data read from r.
+// ok is false when r has no EXIF data or no position.
+func ReadPoint(r io.Reader) (Point, bool, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		// Files without EXIF (videos, PNGs) simply have no position.
+		if !exif.IsCriticalError(err) || strings.HasPrefix(err.Error(), "exif: decode failed") {
+			return Point{}, false, fmt.Errorf("decode exif: %w", err)
+		}
+		return Point{}, false, nil
+	}
+	lat, lon, err := x.LatLong()
+	if err != nil {
+		return Point{}, false, nil
+	}
+	// 0,0 is what some devices record without a fix.
+	if math.IsNaN(lat) || math.IsNaN(lon) || (lat == 0 && lon == 0) {
+		return Point{}, false, nil
+	}
+	return Point{Lat: lat, Lon: lon}, true, nil
+}
+
+// Default radii of Offline.
+const (
+	DefaultCityRadiusKm    = 50
+	DefaultCountryRadiusKm = 300
+)
+
+// entry is a place of the dataset.
+type entry struct {
+	name     string
+	country  string
+	timezone string
+	point    Point
+}
+
+// Offline is a Geocoder backed by an in-memory places dataset. It is safe for concurrent use.
+//
+// A point resolves to the nearest place. Within CityRadiusKm the place's city and country are returned;
+// within CountryRadiusKm only its country, which is a guess near borders. Both come with the timezone of the place.
+type Offline struct {
+	CityRadiusKm    float64
+	CountryRadiusKm float64
+
+	// entries is sorted by latitude, so a lookup only scans a band around the point.
+	entries []entry
+}
+
+//go:embed data/places.tsv
+var bundledPlaces string
+
+//go:embed data/countries.tsv
+var bundledCountries string
+
+var countryNames = sync.OnceValue(func() map[string]string {
+	names := make(map[string]string)
+	for _, line := range strings.Split(bundledCountries, "\n") {
+		if code, name, ok := strings.Cut(line, "\t"); ok {
+			names[code] = name
+		}
+	}
+	return names
+})
+
+// countryName returns the English name of an ISO 3166-1 alpha-2 code, or the code itself when unknown.
+func countryName(code string) string {
+	if name, ok := countryNames()[code]; ok {
+		return name
+	}
+	return code
+}
+
+var bundled = sync.OnceValue(func() *Offline {
+	var entries []entry
+	for _, line := range strings.Split(bundledPlaces, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		lat, err1 := strconv.ParseFloat(f[2], 64)
+		lon, err2 := strconv.ParseFloat(f[3], 64)
+		if err := errors.Join(err1, err2); err != nil {
+			panic(fmt.Sprintf("geocode: bundled place %q: %v", line, err))
+		}
+		entries = append(entries, entry{name: f[0], country: countryName(f[1]), timezone: f[4], point: Point{lat, lon}})
+	}
+	return newOffline(entries)
+})
+
+// Bundled returns the Offline geocoder of the dataset bundled with the binary.
+func Bundled() *Offline { return bundled() }
+
+func newOffline(entries []entry) *Offline {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].point.Lat < entries[j].point.Lat })
+	return &Offline{CityRadiusKm: DefaultCityRadiusKm, CountryRadiusKm: DefaultCountryRadiusKm, entries: entries}
+}
+
+// LoadGeoNames reads a GeoNames cities dump (e.g. cities15000.txt from download.geonames.org):
+// tab-separated lines with the name in column 2, the coordinates in columns 5 and 6,
+// the country code in column 9 and, when present, the timezone in column 18.
+func LoadGeoNames(r io.Reader) (*Offline, error) {
+	var entries []entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) < 9 {
+			return nil, fmt.Errorf("geonames line %d: want at least 9 columns, got %d", n, len(f))
+		}
+		lat, err := strconv.ParseFloat(f[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geonames line %d: latitude: %w", n, err)
+		}
+		lon, err := strconv.ParseFloat(f[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("geonames line %d: longitude: %w", n, err)
+		}
+		e := entry{name: f[1], country: countryName(f[8]), point: Point{lat, lon}}
+		if len(f) > 17 {
+			e.timezone = f[17]
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("geonames: no places found")
+	}
+	return newOffline(entries), nil
+}
+
+// Len returns the number of places in the dataset.
+func (o *Offline) Len() int { return len(o.entries) }
+
+// Reverse returns the place nearest to p.
+func (o *Offline) Reverse(_ context.Context, p Point) (Place, bool, error) {
+	radius := math.Max(o.CityRadiusKm, o.CountryRadiusKm)
+	band := radius / kmPerDegree
+
+	// Only entries within the latitude band can be within radius.
+	lo := sort.Search(len(o.entries), func(i int) bool { return o.entries[i].point.Lat >= p.Lat-band })
+	best, bestKm := -1, math.Inf(1)
+	for i := lo; i < len(o.entries) && o.entries[i].point.Lat <= p.Lat+band; i++ {
+		if km := DistanceKm(p, o.entries[i].point); km < bestKm {
+			best, bestKm = i, km
+		}
+	}
+
+	if best < 0 {
+		return Place{}, false, nil
+	}
+	e := o.entries[best]
+	switch {
+	case bestKm <= o.CityRadiusKm:
+		return Place{City: e.name, Country: e.country, Timezone: e.timezone}, true, nil
+	case bestKm <= o.CountryRadiusKm:
+		return Place{Country: e.country, Timezone: e.timezone}, true, nil
+	}
+	return Place{}, false, nil
+}
+
+// kmPerDegree is the length of a degree of latitude.
+const kmPerDegree = 111.2
+
+// DistanceKm returns the great-circle distance between a and b.
+func DistanceKm(a, b Point) float64 {
+	const earthRadiusKm = 6371
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(b.Lat-a.Lat), rad(b.Lon-a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
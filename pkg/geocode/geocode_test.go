@@ -0,0 +1,128 @@
+package geocode
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+func TestBundledReverse(t *testing.T) {
+	g := Bundled()
+	if g.Len() < 100 {
+		t.Fatalf("bundled dataset has only %d places", g.Len())
+	}
+
+	for _, tt := range []struct {
+		name string
+		p    Point
+		want string
+		ok   bool
+	}{
+		{"colosseum", Point{41.890, 12.492}, "Rome, Italy", true},
+		{"southern hemisphere", Point{-33.857, 151.215}, "Sydney, Australia", true},
+		{"west of greenwich", Point{51.501, -0.142}, "London, United Kingdom", true},
+		{"countryside", Point{52.2, 26.0}, "Belarus", true},
+		{"mid-atlantic", Point{30.0, -40.0}, "", false},
+	} {
+		place, ok, err := g.Reverse(context.Background(), tt.p)
+		if err != nil || ok != tt.ok || place.String() != tt.want {
+			t.Errorf("%s: got %q, %v, %v; want %q, %v", tt.name, place, ok, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBundledTimezones(t *testing.T) {
+	for _, e := range Bundled().entries {
+		if _, ok := (Place{Timezone: e.timezone}).Location(); !ok {
+			t.Errorf("%s, %s: unknown timezone %q", e.name, e.country, e.timezone)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		p    Point
+		want string
+	}{
+		{"city", Point{41.890, 12.492}, "Europe/Rome"},
+		{"zone of a city in a country with several", Point{36.170, -115.140}, "America/Los_Angeles"},
+		{"countryside", Point{52.2, 26.0}, "Europe/Minsk"},
+	} {
+		place, _, _ := Bundled().Reverse(context.Background(), tt.p)
+		if place.Timezone != tt.want {
+			t.Errorf("%s: got timezone %q, want %q", tt.name, place.Timezone, tt.want)
+		}
+	}
+	if _, ok := (Place{Country: "Italy"}).Location(); ok {
+		t.Errorf("expected no location for a place without a timezone")
+	}
+}
+
+func TestBundledReverse_TimezoneBorders(t *testing.T) {
+	// The timezone is that of the nearest bundled place, not of the zone the point lies in: near a border
+	// between zones the nearest place can be across it.
+	winter := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name   string
+		p      Point
+		want   string
+		offset int
+	}{
+		{"Tui, Spain, nearest to a Spanish place", Point{42.047, -8.644}, "Europe/Madrid", 3600},
+		{"Ayamonte, Spain, nearest to Faro across the Guadiana", Point{37.213, -7.407}, "Europe/Lisbon", 0},
+		{"Braniewo, Poland, nearest to Kaliningrad across the border", Point{54.380, 19.822}, "Europe/Kaliningrad", 2 * 3600},
+	} {
+		place, ok, err := Bundled().Reverse(context.Background(), tt.p)
+		if err != nil || !ok || place.Timezone != tt.want {
+			t.Errorf("%s: got %+v, %v, %v; want timezone %s", tt.name, place, ok, err, tt.want)
+			continue
+		}
+		loc, _ := place.Location()
+		if _, offset := winter.In(loc).Zone(); offset != tt.offset {
+			t.Errorf("%s: got offset %d, want %d", tt.name, offset, tt.offset)
+		}
+	}
+}
+
+func TestLoadGeoNames(t *testing.T) {
+	dump := strings.Join([]string{
+		"2759794\tAmsterdam\tAmsterdam\t\t52.37403\t4.88969\tP\tPPLC\tNL\t\t07\t0363\t\t\t741636\t\t13\tEurope/Amsterdam\t2022-01-11",
+		"2747891\tRotterdam\tRotterdam\t\t51.9225\t4.47917\tP\tPPLA2\tNL\t\t11\t0599\t\t\t598199\t\t5\tEurope/Amsterdam\t2022-01-11",
+		"",
+	}, "\n")
+	g, err := LoadGeoNames(strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("LoadGeoNames: %v", err)
+	}
+	place, ok, err := g.Reverse(context.Background(), Point{51.92, 4.48})
+	if err != nil || !ok || place != (Place{City: "Rotterdam", Country: "Netherlands", Timezone: "Europe/Amsterdam"}) {
+		t.Errorf("got %+v, %v, %v", place, ok, err)
+	}
+
+	if _, err := LoadGeoNames(strings.NewReader("not\ta\tdump\n")); err == nil {
+		t.Errorf("expected an error for a malformed dump")
+	}
+}
+
+func TestReadPoint(t *testing.T) {
+	// Bled, Slovenia: 46°22'8.4"N 14°6'50.4"E.
+	data := testjpeg.WithGPS('N', [3]uint32{46, 22, 84}, 'E', [3]uint32{14, 6, 504})
+	p, ok, err := ReadPoint(bytes.NewReader(data))
+	if err != nil || !ok {
+		t.Fatalf("ReadPoint: %v, %v", ok, err)
+	}
+	if p.Lat < 46.3689 || p.Lat > 46.3691 || p.Lon < 14.1139 || p.Lon > 14.1141 {
+		t.Errorf("got %+v", p)
+	}
+	place, _, _ := Bundled().Reverse(context.Background(), p)
+	if place.String() != "Bled, Slovenia" {
+		t.Errorf("got place %q", place)
+	}
+
+	if _, ok, err := ReadPoint(strings.NewReader("no exif")); ok || err != nil {
+		t.Errorf("expected no point and no error for a file without EXIF, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,328 @@
+// Package hashlist reads the checksum lists other tools write of a tree, so deduplication can trust
+// their hashes instead of reading the files again.
+//
+// Supported are the JSON output of rmlint (`rmlint -o json`), the JSON and default output of jdupes
+// (`jdupes -j`, `jdupes -r`) and the output of hashdeep. rmlint and hashdeep record digests; jdupes only
+// records sets of identical files, which are compared with each other but cannot be checked against
+// other files.
+package hashlist
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Hash is a digest of the content of a file.
+type Hash struct {
+	// Algorithm names the digest, such as "sha256". Digests of different algorithms are never compared.
+	Algorithm string
+	// Sum is the lower-case hex-encoded digest.
+	Sum string
+}
+
+// Entry is a file of a list with its recorded hashes.
+type Entry struct {
+	Path string
+	// Size is the recorded size of the file, or -1 when the list does not record it.
+	Size int64
+	// ModTime is the recorded modification time of the file; the zero time when the list does not record it.
+	ModTime time.Time
+	Hashes  []Hash
+}
+
+// List holds the hashes of files by absolute, cleaned path.
+type List map[string]Entry
+
+// Add adds entries to l; the hashes of a file listed before are added to its entry.
+func (l List) Add(entries ...Entry) {
+	for _, e := range entries {
+		key := key(e.Path)
+		if old, ok := l[key]; ok {
+			e.Hashes = append(old.Hashes, e.Hashes...)
+		}
+		e.Path = key
+		l[key] = e
+	}
+}
+
+// Lookup returns the hashes of the file at path with the stat info info. A file whose size or
+// modification time differs from the recorded one has changed since the list was written, and has none.
+func (l List) Lookup(path string, info fs.FileInfo) []Hash {
+	e, ok := l[key(path)]
+	if !ok {
+		return nil
+	}
+	if e.Size >= 0 && e.Size != info.Size() {
+		return nil
+	}
+	// Lists and filesystems keep modification times at different precisions.
+	if !e.ModTime.IsZero() && e.ModTime.Unix() != info.ModTime().Unix() {
+		return nil
+	}
+	return e.Hashes
+}
+
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Match compares the hashes a and b of two files. It reports whether the files are identical, and
+// whether a and b have a digest of the same algorithm to tell.
+func Match(a, b []Hash) (identical, ok bool) {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Algorithm == y.Algorithm {
+				return x.Sum == y.Sum, true
+			}
+		}
+	}
+	return false, false
+}
+
+// New returns a hash.Hash computing the digests of algorithm, and false when it cannot be computed.
+func New(algorithm string) (hash.Hash, bool) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), true
+	case "sha1":
+		return sha1.New(), true
+	case "sha256":
+		return sha256.New(), true
+	case "sha512":
+		return sha512.New(), true
+	case "blake2b":
+		h, _ := blake2b.New512(nil)
+		return h, true
+	case "blake3":
+		return blake3.New(), true
+	case "xxhash128":
+		return xxh128{xxh3.New()}, true
+	}
+	return nil, false
+}
+
+// xxh128 computes the 128-bit XXH3 digest; xxh3.Hasher itself sums the 64-bit one.
+type xxh128 struct {
+	*xxh3.Hasher
+}
+
+func (h xxh128) Size() int { return 16 }
+
+func (h xxh128) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
+
+// Load reads the list at path, in the format its content has (see Parse).
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := Parse(f, path)
+	if err != nil {
+		return nil, fmt.Errorf("hash list %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Parse reads a list of rmlint, jdupes or hashdeep, recognized by its content. name identifies the
+// list: the sets of identical files of a jdupes list are only compared with the sets of the same list.
+// Relative paths are taken relative to the directory hashdeep was invoked from, or else to the
+// current directory.
+func Parse(r io.Reader, name string) ([]Entry, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	head = bytes.TrimLeft(head, " \t\r\n\ufeff")
+	switch {
+	case bytes.HasPrefix(head, []byte("%%%% HASHDEEP")):
+		return parseHashdeep(br)
+	case bytes.HasPrefix(head, []byte("[")):
+		return parseRmlint(br)
+	case bytes.HasPrefix(head, []byte("{")):
+		return parseJdupesJSON(br, name)
+	default:
+		return parseJdupes(br, name)
+	}
+}
+
+// parseHashdeep reads the output of hashdeep: a header naming the columns, then a line per file of
+// its size, its digests and its name.
+func parseHashdeep(r io.Reader) ([]Entry, error) {
+	var columns []string
+	var dir string
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "%%%% size,"):
+			columns = strings.Split(strings.TrimPrefix(line, "%%%% "), ",")
+			continue
+		case strings.HasPrefix(line, "## Invoked from: "):
+			dir = strings.TrimPrefix(line, "## Invoked from: ")
+			continue
+		case strings.HasPrefix(line, "%%%%"), strings.HasPrefix(line, "##"):
+			continue
+		}
+		if len(columns) < 2 || columns[len(columns)-1] != "filename" {
+			return nil, fmt.Errorf("line %d: file before the hashdeep column header", n)
+		}
+		// The name is the last column and may itself contain commas.
+		fields := strings.SplitN(line, ",", len(columns))
+		if len(fields) != len(columns) {
+			return nil, fmt.Errorf("line %d: want %d columns, got %d", n, len(columns), len(fields))
+		}
+		e := Entry{Path: fields[len(fields)-1], Size: -1}
+		if !filepath.IsAbs(e.Path) && dir != "" {
+			e.Path = filepath.Join(dir, e.Path)
+		}
+		for i, column := range columns[:len(columns)-1] {
+			if column == "size" {
+				size, err := strconv.ParseInt(fields[i], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid size %q", n, fields[i])
+				}
+				e.Size = size
+				continue
+			}
+			e.Hashes = append(e.Hashes, Hash{Algorithm: column, Sum: strings.ToLower(fields[i])})
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// parseRmlint reads the JSON output of rmlint: a header naming the checksum type, the files found,
+// and a footer. Only files with a checksum are returned.
+func parseRmlint(r io.Reader) ([]Entry, error) {
+	var items []struct {
+		ChecksumType string  `json:"checksum_type"`
+		Type         string  `json:"type"`
+		Path         string  `json:"path"`
+		Size         *int64  `json:"size"`
+		MTime        float64 `json:"mtime"`
+		Checksum     string  `json:"checksum"`
+	}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("rmlint json: %w", err)
+	}
+	// blake2b is the default checksum of rmlint.
+	algorithm := "blake2b"
+	var entries []Entry
+	for _, item := range items {
+		if item.ChecksumType != "" {
+			algorithm = strings.ToLower(item.ChecksumType)
+		}
+		if item.Path == "" || item.Checksum == "" || (item.Type != "duplicate_file" && item.Type != "unique_file") {
+			continue
+		}
+		e := Entry{Path: item.Path, Size: -1, Hashes: []Hash{{Algorithm: algorithm, Sum: strings.ToLower(item.Checksum)}}}
+		if item.Size != nil {
+			e.Size = *item.Size
+		}
+		if item.MTime > 0 {
+			sec, frac := math.Modf(item.MTime)
+			e.ModTime = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseJdupesJSON reads the JSON output of jdupes: its sets of identical files.
+func parseJdupesJSON(r io.Reader, name string) ([]Entry, error) {
+	var out struct {
+		MatchSets []struct {
+			FileSize int64 `json:"fileSize"`
+			FileList []struct {
+				FilePath string `json:"filePath"`
+			} `json:"fileList"`
+		} `json:"matchSets"`
+	}
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return nil, fmt.Errorf("jdupes json: %w", err)
+	}
+	var entries []Entry
+	for i, set := range out.MatchSets {
+		for _, f := range set.FileList {
+			entries = append(entries, Entry{Path: f.FilePath, Size: set.FileSize, Hashes: []Hash{jdupesSet(name, i)}})
+		}
+	}
+	return entries, nil
+}
+
+// parseJdupes reads the default output of jdupes: the paths of each set of identical files, one per
+// line, with a blank line after each set. The "N bytes each:" lines of -S are skipped.
+func parseJdupes(r io.Reader, name string) ([]Entry, error) {
+	var entries []Entry
+	var set []string
+	sets := 0
+	flush := func(n int) error {
+		switch len(set) {
+		case 0:
+			return nil
+		case 1:
+			return fmt.Errorf("line %d: a jdupes set of a single file; not a list of rmlint, jdupes or hashdeep", n)
+		}
+		for _, p := range set {
+			entries = append(entries, Entry{Path: p, Size: -1, Hashes: []Hash{jdupesSet(name, sets)}})
+		}
+		set = set[:0]
+		sets++
+		return nil
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	n := 1
+	for ; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		switch {
+		case line == "":
+			if err := flush(n); err != nil {
+				return nil, err
+			}
+		case strings.HasSuffix(line, " bytes each:") || strings.HasSuffix(line, " byte each:"):
+		default:
+			set = append(set, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(n); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// jdupesSet returns the Hash of the files of set i of the jdupes list name.
+func jdupesSet(name string, i int) Hash {
+	return Hash{Algorithm: "jdupes:" + key(name), Sum: strconv.Itoa(i)}
+}
@@ -0,0 +1,144 @@
+package hashlist
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse_Hashdeep(t *testing.T) {
+	list := `%%%% HASHDEEP-1.0
+%%%% size,md5,sha256,filename
+## Invoked from: /archive
+## $ hashdeep -r -c md5,sha256 .
+##
+4,1C4E4A7A4F0C1B0E2B4E0F1E1F2A3B4C,8d3c...,./2019/a,b.jpg
+7,aaaa,bbbb,/photos/c.jpg
+`
+	entries, err := Parse(strings.NewReader(list), "list.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Path != filepath.Join("/archive", "2019", "a,b.jpg") || e.Size != 4 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if len(e.Hashes) != 2 || e.Hashes[0] != (Hash{Algorithm: "md5", Sum: "1c4e4a7a4f0c1b0e2b4e0f1e1f2a3b4c"}) || e.Hashes[1].Algorithm != "sha256" {
+		t.Errorf("unexpected hashes %+v", e.Hashes)
+	}
+	if entries[1].Path != "/photos/c.jpg" {
+		t.Errorf("expected an absolute path to be kept, got %s", entries[1].Path)
+	}
+}
+
+func TestParse_Rmlint(t *testing.T) {
+	list := `[
+{"description": "rmlint json-dump of lint files", "cwd": "/", "checksum_type": "sha256"},
+{"id": 1, "type": "duplicate_file", "checksum": "ABCD", "path": "/archive/a.jpg", "size": 4, "mtime": 1700000000.25, "is_original": true},
+{"id": 2, "type": "emptyfile", "path": "/archive/empty.jpg", "size": 0},
+{"aborted": false, "total_files": 3}
+]`
+	entries, err := Parse(strings.NewReader(list), "rmlint.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Path != "/archive/a.jpg" || e.Size != 4 || e.Hashes[0] != (Hash{Algorithm: "sha256", Sum: "abcd"}) || e.ModTime.Unix() != 1700000000 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestParse_Jdupes(t *testing.T) {
+	text := "/a/1.jpg\n/b/1.jpg\n\n12 bytes each:\n/a/2.jpg\n/b/2.jpg\n/c/2.jpg\n"
+	entries, err := Parse(strings.NewReader(text), "dupes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %+v", entries)
+	}
+	if same, ok := Match(entries[0].Hashes, entries[1].Hashes); !ok || !same {
+		t.Error("expected the files of a set to match")
+	}
+	if same, ok := Match(entries[1].Hashes, entries[2].Hashes); !ok || same {
+		t.Error("expected the files of different sets to differ")
+	}
+
+	json := `{"jdupesVersion": "1.27.3", "matchSets": [{"fileSize": 3, "fileList": [{"filePath": "/a/1.jpg"}, {"filePath": "/b/1.jpg"}]}]}`
+	other, err := Parse(strings.NewReader(json), "dupes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 2 || other[0].Size != 3 {
+		t.Fatalf("unexpected entries %+v", other)
+	}
+	if _, ok := Match(entries[0].Hashes, other[0].Hashes); ok {
+		t.Error("expected the sets of different lists not to be compared")
+	}
+
+	if _, err := Parse(strings.NewReader("/a/1.jpg\n\n/b/1.jpg\n"), "single.txt"); err == nil {
+		t.Error("expected a set of one file to be refused")
+	}
+}
+
+func TestList_Lookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(path, []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := []Hash{{Algorithm: "sha256", Sum: "x"}}
+
+	for _, tt := range []struct {
+		name  string
+		entry Entry
+		want  bool
+	}{
+		{"unchanged", Entry{Path: path, Size: 4, ModTime: mtime.Add(300 * time.Millisecond), Hashes: hashes}, true},
+		{"size unknown", Entry{Path: path, Size: -1, Hashes: hashes}, true},
+		{"size changed", Entry{Path: path, Size: 5, Hashes: hashes}, false},
+		{"modified", Entry{Path: path, Size: 4, ModTime: mtime.Add(time.Hour), Hashes: hashes}, false},
+	} {
+		list := make(List)
+		list.Add(tt.entry)
+		if got := len(list.Lookup(path, info)) > 0; got != tt.want {
+			t.Errorf("%s: Lookup found hashes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for algorithm, want := range map[string]string{
+		"sha256":    "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"blake3":    "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		"xxhash128": "99aa06d3014798d86001c324468d497f",
+	} {
+		h, ok := New(algorithm)
+		if !ok {
+			t.Errorf("%s: not supported", algorithm)
+			continue
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != want || h.Size() != len(want)/2 {
+			t.Errorf("%s: empty digest %s (size %d), want %s", algorithm, got, h.Size(), want)
+		}
+	}
+	if _, ok := New("crc32"); ok {
+		t.Errorf("expected crc32 to be unsupported")
+	}
+}
@@ -0,0 +1,120 @@
+// Package heic converts HEIC photos to JPEG, for TVs, photo frames and older software that cannot show
+// them.
+//
+// HEIC has no decoder in the Go standard library; a conversion runs the first converter found in
+// PATH: heif-convert (libheif), ImageMagick's magick, or sips on macOS. All of them keep the EXIF data.
+package heic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Policy controls what happens to HEIC photos when organizing.
+type Policy string
+
+const (
+	// PolicyOff organizes HEIC photos as they are.
+	PolicyOff Policy = "off"
+	// PolicyKeep copies HEIC photos intact and also writes a JPEG next to each copy as a companion.
+	PolicyKeep Policy = "keep"
+	// PolicyReplace writes a JPEG instead of each HEIC photo; the original is not copied.
+	PolicyReplace Policy = "replace"
+)
+
+// ParsePolicy converts a CLI value into a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PolicyOff, PolicyKeep, PolicyReplace:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid HEIC conversion policy %q (want off, keep or replace)", s)
+	}
+}
+
+// Quality is the JPEG quality conversions use, high enough that the JPEG shows no artifacts.
+const Quality = 92
+
+// ErrNoConverter is returned when no converter is found in PATH.
+var ErrNoConverter = errors.New("no HEIC converter found in PATH (install heif-convert from libheif, or ImageMagick)")
+
+// IsCandidate reports whether the file name is a HEIC or HEIF photo.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".heic", ".heif":
+		return true
+	}
+	return false
+}
+
+// JPEGPath returns the name or path of the JPEG converted from the photo at path: its extension
+// replaced by .jpg.
+func JPEGPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".jpg"
+}
+
+// converter is an external program converting a HEIC file to a JPEG file.
+type converter struct {
+	name string
+	args func(in, out string) []string
+}
+
+// converters lists the supported converters, in order of preference.
+var converters = []converter{
+	{"heif-convert", func(in, out string) []string { return []string{"-q", strconv.Itoa(Quality), in, out} }},
+	{"magick", func(in, out string) []string { return []string{in, "-quality", strconv.Itoa(Quality), out} }},
+	{"sips", func(in, out string) []string {
+		return []string{"-s", "format", "jpeg", "-s", "formatOptions", strconv.Itoa(Quality), in, "--out", out}
+	}},
+}
+
+// Converter returns the name of the converter conversions run, or ErrNoConverter.
+func Converter() (string, error) {
+	c, err := find()
+	if err != nil {
+		return "", err
+	}
+	return c.name, nil
+}
+
+// find returns the first converter in PATH.
+func find() (converter, error) {
+	for _, c := range converters {
+		if _, err := exec.LookPath(c.name); err == nil {
+			return c, nil
+		}
+	}
+	return converter{}, ErrNoConverter
+}
+
+// ToJPEG returns the HEIC photo data converted to a JPEG. It has the signature of plan.Operation's
+// Transform, so the JPEG can be written by copying the photo. The conversion goes through temporary
+// files, as the converters read and write files only.
+func ToJPEG(data []byte) ([]byte, error) {
+	c, err := find()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "media-organizer-heic-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "photo.heic"), filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, err
+	}
+	if output, err := exec.Command(c.name, c.args(in, out)...).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", c.name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return os.ReadFile(out)
+}
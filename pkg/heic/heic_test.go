@@ -0,0 +1,56 @@
+package heic
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, s := range []string{"off", "Keep", " replace "} {
+		if _, err := ParsePolicy(s); err != nil {
+			t.Errorf("ParsePolicy(%q): %v", s, err)
+		}
+	}
+	if _, err := ParsePolicy("jpeg"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestJPEGPath(t *testing.T) {
+	if got := JPEGPath("/lib/2024/IMG_0001.HEIC"); got != "/lib/2024/IMG_0001.jpg" {
+		t.Errorf("JPEGPath = %q", got)
+	}
+	if !IsCandidate("IMG_0001.HEIC") || !IsCandidate("a.heif") || IsCandidate("a.jpg") {
+		t.Error("IsCandidate mismatch")
+	}
+}
+
+func TestToJPEG(t *testing.T) {
+	// A stand-in heif-convert, called as heif-convert -q QUALITY IN OUT.
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$2\" = 92 ] || exit 1\nprintf 'JPEG:' > \"$4\"\ncat \"$3\" >> \"$4\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "heif-convert"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if name, err := Converter(); err != nil || name != "heif-convert" {
+		t.Fatalf("Converter = %q, %v", name, err)
+	}
+	got, err := ToJPEG([]byte("heic"))
+	if err != nil {
+		t.Fatalf("ToJPEG: %v", err)
+	}
+	if string(got) != "JPEG:heic" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestToJPEG_NoConverter(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := ToJPEG([]byte("heic")); !errors.Is(err, ErrNoConverter) {
+		t.Errorf("expected ErrNoConverter, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Package history keeps the run history of a library: an append-only log with an entry per run that
+// changed it, with its command line, counts, duration, failures and the journal it wrote.
+//
+// The history is kept in FileName in the library root, one JSON entry per line, or in the catalog
+// when the runs use one.
+package history
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// FileName is the name of the history file in the library root.
+const FileName = ".media-organizer-history.jsonl"
+
+// ErrNotFound is returned by Find for an ID that matches no entry.
+var ErrNotFound = errors.New("run not found in history")
+
+// Entry is a run in the history.
+type Entry struct {
+	// ID identifies the entry, such as 20240102T030405Z-9f86d081; NewID makes one.
+	ID string `json:"id"`
+
+	// Command is the subcommand of the run; Job the daemon job that ran it.
+	Command string `json:"command"`
+	Job     string `json:"job,omitempty"`
+
+	// Args is the command line of the run, without credentials.
+	Args []string `json:"args,omitempty"`
+
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Execute     bool   `json:"execute"`
+
+	Started         time.Time      `json:"started"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	FilesProcessed  int            `json:"files_processed"`
+	Counts          map[string]int `json:"counts,omitempty"`
+	BytesCopied     int64          `json:"bytes_copied"`
+	Failures        int            `json:"failures"`
+	FailedFiles     []FailedFile   `json:"failed_files,omitempty"`
+
+	// Succeeded is false when the run aborted with Error.
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error,omitempty"`
+
+	// CatalogRun is the ID of the run in the catalog, for runs that recorded their files in one.
+	CatalogRun string `json:"catalog_run,omitempty"`
+
+	// Journal is the path of the journal the run wrote, such as that of a migration or a daemon run.
+	Journal string `json:"journal,omitempty"`
+}
+
+// FailedFile is a file a run could not organize.
+type FailedFile struct {
+	SourcePath string `json:"source_path"`
+	Error      string `json:"error"`
+	ErrorCode  string `json:"error_code,omitempty"`
+}
+
+// NewID returns a sortable, unique ID for an entry of a run started at started.
+func NewID(started time.Time) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return started.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+// Log is where the history of a library is kept.
+type Log interface {
+	// Append adds e to the end of the history.
+	Append(ctx context.Context, e Entry) error
+
+	// Entries returns the history, oldest first.
+	Entries(ctx context.Context) ([]Entry, error)
+}
+
+// File returns the history kept in the file at path of fsys; nil is the local file system.
+func File(fsys destfs.FS, path string) Log {
+	return fileLog{fsys: destfs.OrOS(fsys), path: path}
+}
+
+type fileLog struct {
+	fsys destfs.FS
+	path string
+}
+
+func (l fileLog) Append(_ context.Context, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	line = append(line, '\n')
+	if err := l.append(line); err != nil {
+		return fmt.Errorf("append history %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// append writes line to the end of the file. Remote backends do not append, and an interrupted
+// write leaves a partial last line: then the file is read and written back whole, as the manifest is.
+func (l fileLog) append(line []byte) error {
+	if destfs.IsOS(l.fsys) && endsInNewline(l.path) {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	existing, err := l.read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		// Drop the partial line of an interrupted write.
+		existing = existing[:bytes.LastIndexByte(existing, '\n')+1]
+	}
+	f, err := l.fsys.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(existing, line...)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// endsInNewline reports whether the local file at path is missing, empty or ends in a newline.
+func endsInNewline(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if info.Size() == 0 {
+		return true
+	}
+	var last [1]byte
+	_, err = f.ReadAt(last[:], info.Size()-1)
+	return err == nil && last[0] == '\n'
+}
+
+func (l fileLog) read() ([]byte, error) {
+	f, err := l.fsys.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Entries returns the entries of the file. A missing file is an empty history; a partial last line,
+// left by an interrupted run, is skipped.
+func (l fileLog) Entries(_ context.Context) ([]Entry, error) {
+	data, err := l.read()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	var entries []Entry
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("read history %s line %d: %w", l.path, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Catalog returns the history kept in catalog c.
+func Catalog(c *catalog.Catalog) Log {
+	return catalogLog{c: c}
+}
+
+type catalogLog struct {
+	c *catalog.Catalog
+}
+
+func (l catalogLog) Append(ctx context.Context, e Entry) error {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("append history: %w", err)
+	}
+	return l.c.AppendHistory(ctx, e.ID, e.Started, entry)
+}
+
+func (l catalogLog) Entries(ctx context.Context) ([]Entry, error) {
+	rows, err := l.c.History(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		var e Entry
+		if err := json.Unmarshal(row, &e); err != nil {
+			return nil, fmt.Errorf("read history: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Find returns the entry of entries whose ID is id or starts with it. An ambiguous prefix is an error.
+func Find(entries []Entry, id string) (Entry, error) {
+	var found []Entry
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+		if id != "" && strings.HasPrefix(e.ID, id) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Entry{}, fmt.Errorf("%s: %w", id, ErrNotFound)
+	case 1:
+		return found[0], nil
+	}
+	return Entry{}, fmt.Errorf("%s matches %d runs: %s, ...", id, len(found), found[0].ID)
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+func entries(t *testing.T, log Log) []Entry {
+	t.Helper()
+	got, err := log.Entries(context.Background())
+	if err != nil {
+		t.Fatalf("Entries: %v", err)
+	}
+	return got
+}
+
+func appendRuns(t *testing.T, log Log, commands ...string) {
+	t.Helper()
+	started := time.Date(2024, 7, 14, 10, 0, 0, 0, time.UTC)
+	for i, command := range commands {
+		at := started.Add(time.Duration(i) * time.Hour)
+		e := Entry{ID: NewID(at), Command: command, Execute: true, Started: at, FilesProcessed: i + 1, Counts: map[string]int{"copied": i + 1}, Succeeded: true}
+		if err := log.Append(context.Background(), e); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	for name, fsys := range map[string]destfs.FS{"local": nil, "remote": destfs.NewMem()} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if fsys != nil {
+				fsys.MkdirAll(dir, 0o755)
+			}
+			path := filepath.Join(dir, FileName)
+			log := File(fsys, path)
+			if got := entries(t, log); len(got) != 0 {
+				t.Fatalf("expected an empty history for a missing file, got %+v", got)
+			}
+			appendRuns(t, log, "organize", "migrate")
+			got := entries(t, log)
+			if len(got) != 2 || got[0].Command != "organize" || got[1].Command != "migrate" || got[1].Counts["copied"] != 2 {
+				t.Fatalf("expected both runs in order, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestFile_PartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	log := File(nil, path)
+	appendRuns(t, log, "organize")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"interrupted","comm`)
+	f.Close()
+
+	if got := entries(t, log); len(got) != 1 {
+		t.Fatalf("expected the partial line to be skipped, got %+v", got)
+	}
+	appendRuns(t, log, "merge")
+	if got := entries(t, log); len(got) != 2 || got[1].Command != "merge" {
+		t.Fatalf("expected the next run after the complete one, got %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("not json\n{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Entries(context.Background()); err == nil {
+		t.Errorf("expected an error for a damaged line")
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	c, err := catalog.Open(context.Background(), filepath.Join(t.TempDir(), catalog.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	log := Catalog(c)
+	appendRuns(t, log, "organize", "merge", "daemon")
+	got := entries(t, log)
+	if len(got) != 3 || got[2].Command != "daemon" || !got[0].Started.Equal(time.Date(2024, 7, 14, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the three runs in order, got %+v", got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	runs := []Entry{{ID: "20240714T100000Z-aaaa1111"}, {ID: "20240714T110000Z-bbbb2222"}, {ID: "20240714T110000Z-bbbb3333"}}
+	if e, err := Find(runs, "20240714T10"); err != nil || e.ID != runs[0].ID {
+		t.Errorf("Find by prefix = %+v, %v", e, err)
+	}
+	if e, err := Find(runs, runs[2].ID); err != nil || e.ID != runs[2].ID {
+		t.Errorf("Find by ID = %+v, %v", e, err)
+	}
+	if _, err := Find(runs, "20240714T11"); err == nil {
+		t.Errorf("expected an error for an ambiguous prefix")
+	}
+	if _, err := Find(runs, "2023"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package hook runs user-specified executables at defined points of a run, so notification,
+// tagging or custom validation can be integrated without Go code.
+//
+// A hook receives one JSON document on stdin describing the file or run (File or Run) and the
+// point in the MEDIA_ORGANIZER_HOOK environment variable. A hook that exits non-zero fails;
+// its stderr becomes part of the error.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Point names when a hook runs.
+type Point string
+
+const (
+	// AfterAttribute runs for every file once its created_at is determined. A failing hook rejects
+	// the file, which makes this the point for custom validation.
+	AfterAttribute Point = "after-attribute"
+	// AfterCopy runs for every file an executing run copied or failed to copy.
+	AfterCopy Point = "after-copy"
+	// AfterRun runs once at the end of a run, dry-runs included.
+	AfterRun Point = "after-run"
+)
+
+// DefaultTimeout bounds how long a single hook invocation may take.
+const DefaultTimeout = 30 * time.Second
+
+// Hook is an executable run at a point.
+type Hook struct {
+	Point Point
+
+	// Command is the path of the executable. It is run directly, not through a shell.
+	Command string
+
+	// Timeout bounds each invocation; zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Parse converts a CLI value of the form POINT=COMMAND into a Hook.
+func Parse(s string) (Hook, error) {
+	point, command, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(command) == "" {
+		return Hook{}, fmt.Errorf("invalid hook %q (want POINT=COMMAND)", s)
+	}
+	switch p := Point(strings.TrimSpace(point)); p {
+	case AfterAttribute, AfterCopy, AfterRun:
+		return Hook{Point: p, Command: strings.TrimSpace(command)}, nil
+	default:
+		return Hook{}, fmt.Errorf("invalid hook point %q (want after-attribute, after-copy or after-run)", point)
+	}
+}
+
+// File is the stdin document of the per-file points.
+type File struct {
+	Event           Point             `json:"event"`
+	SourcePath      string            `json:"source_path"`
+	FileSizeBytes   int64             `json:"file_size_bytes"`
+	ModTime         time.Time         `json:"mod_time"`
+	CreatedAt       *time.Time        `json:"created_at,omitempty"`
+	CreatedAtSource string            `json:"created_at_source,omitempty"`
+	Fields          map[string]string `json:"fields,omitempty"`
+
+	// The remaining fields are set for AfterCopy.
+	DestinationPath string `json:"destination_path,omitempty"`
+	Success         bool   `json:"success,omitempty"`
+	SHA256          string `json:"sha256,omitempty"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"`
+}
+
+// Run is the stdin document of AfterRun.
+type Run struct {
+	Event       Point          `json:"event"`
+	Sources     []string       `json:"sources"`
+	Destination string         `json:"destination"`
+	Execute     bool           `json:"execute"`
+	RunID       string         `json:"run_id,omitempty"`
+	Files       int            `json:"files_processed"`
+	Counts      map[string]int `json:"counts"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// Exec runs h with doc encoded as JSON on stdin. Output on stdout is discarded.
+func (h Hook) Exec(ctx context.Context, doc any) error {
+	input, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("hook %s: encode input: %w", h.Command, err)
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "MEDIA_ORGANIZER_HOOK="+string(h.Point))
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("hook %s: %w: %s", h.Command, err, msg)
+		}
+		return fmt.Errorf("hook %s: %w", h.Command, err)
+	}
+	return nil
+}
+
+// At returns the hooks of hooks that run at p, in order.
+func At(hooks []Hook, p Point) []Hook {
+	var at []Hook
+	for _, h := range hooks {
+		if h.Point == p {
+			at = append(at, h)
+		}
+	}
+	return at
+}
@@ -0,0 +1,77 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// script writes an executable shell script with body to dir and returns its path.
+func script(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestParse(t *testing.T) {
+	h, err := Parse("after-copy=/usr/local/bin/tag")
+	if err != nil || h != (Hook{Point: AfterCopy, Command: "/usr/local/bin/tag"}) {
+		t.Errorf("got %+v, %v", h, err)
+	}
+	for _, s := range []string{"after-copy", "after-copy=", "before-run=/bin/true"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): expected an error", s)
+		}
+	}
+}
+
+func TestExec_PassesJSONOnStdin(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	h := Hook{Point: AfterRun, Command: script(t, dir, "hook", `{ cat; echo; echo "$MEDIA_ORGANIZER_HOOK"; } > "`+out+`"`)}
+
+	if err := h.Exec(context.Background(), Run{Event: AfterRun, Files: 3, Counts: map[string]int{"copied": 3}}); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, point, _ := strings.Cut(strings.TrimSpace(string(got)), "\n")
+	var run Run
+	if err := json.Unmarshal([]byte(doc), &run); err != nil {
+		t.Fatalf("decode %q: %v", doc, err)
+	}
+	if run.Event != AfterRun || run.Files != 3 || run.Counts["copied"] != 3 {
+		t.Errorf("got %+v", run)
+	}
+	if point != string(AfterRun) {
+		t.Errorf("got MEDIA_ORGANIZER_HOOK %q", point)
+	}
+}
+
+func TestExec_Failure(t *testing.T) {
+	dir := t.TempDir()
+	h := Hook{Point: AfterAttribute, Command: script(t, dir, "reject", "echo 'no camera model' >&2; exit 3")}
+	err := h.Exec(context.Background(), File{Event: AfterAttribute})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") || !strings.Contains(err.Error(), "no camera model") {
+		t.Errorf("got %v", err)
+	}
+
+	slow := Hook{Point: AfterRun, Command: script(t, dir, "slow", "exec sleep 5"), Timeout: 50 * time.Millisecond}
+	if err := slow.Exec(context.Background(), Run{}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v", err)
+	}
+
+	missing := Hook{Point: AfterRun, Command: filepath.Join(dir, "missing")}
+	if err := missing.Exec(context.Background(), Run{}); err == nil {
+		t.Errorf("expected an error for a missing executable")
+	}
+}
@@ -0,0 +1,67 @@
+// Package imagehash hashes the image data of a JPEG without its metadata, so a copy exported with its
+// EXIF or XMP stripped or rewritten hashes the same as its original even though their bytes differ.
+package imagehash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+// IsCandidate reports whether the file name is a JPEG, the only format hashed.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// JPEG returns the SHA-256 of the image data of the JPEG read from r: every segment except the
+// application segments (APP0 to APP15, holding JFIF, EXIF, XMP, ICC profiles and maker data) and
+// comments, followed by the compressed image stream up to and including the end-of-image marker.
+// Data after the marker, such as the video of a motion photo, is ignored. ok is false when r is not a
+// complete JPEG.
+func JPEG(r io.Reader) (sum [32]byte, ok bool, err error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return sum, false, err
+	}
+	segs, err := jpegseg.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return sum, false, nil
+	}
+
+	h := sha256.New()
+	var pos int
+	for {
+		seg, err := segs.Next()
+		if err != nil || seg.End > int64(len(data)) {
+			return sum, false, nil
+		}
+		if !isMetadata(seg.Marker) {
+			h.Write(data[seg.Offset:seg.End])
+		}
+		if seg.Marker == jpegseg.SOS {
+			pos = int(seg.End)
+			break
+		}
+	}
+	// In the image data a 0xFF byte is followed by 0x00 or a restart marker, so 0xFF 0xD9 is the end.
+	eoi := bytes.Index(data[pos:], []byte{0xFF, 0xD9})
+	if eoi < 0 {
+		return sum, false, nil
+	}
+	h.Write(data[pos : pos+eoi+2])
+	copy(sum[:], h.Sum(nil))
+	return sum, true, nil
+}
+
+// isMetadata reports whether marker starts an application segment or a comment.
+func isMetadata(marker byte) bool {
+	return marker >= jpegseg.APP0 && marker <= 0xEF || marker == jpegseg.COM
+}
@@ -0,0 +1,56 @@
+package imagehash
+
+import (
+	"bytes"
+	"testing"
+)
+
+// image is the image data of a minimal JPEG: a quantization table, a scan and the end marker.
+var image = []byte{
+	0xFF, 0xDB, 0x00, 0x04, 0x00, 0x01,
+	0xFF, 0xDA, 0x00, 0x02, 0x01, 0xFF, 0x00, 0x02,
+	0xFF, 0xD9,
+}
+
+// jpeg returns a JPEG with the segments meta before image and trailer after it.
+func jpeg(meta, trailer string) []byte {
+	data := append([]byte{0xFF, 0xD8}, meta...)
+	data = append(data, image...)
+	return append(data, trailer...)
+}
+
+func TestJPEG(t *testing.T) {
+	original, ok, err := JPEG(bytes.NewReader(jpeg("\xFF\xE1\x00\x06Exif", "")))
+	if err != nil || !ok {
+		t.Fatalf("JPEG: %v, %v", ok, err)
+	}
+	for name, data := range map[string][]byte{
+		"stripped":     jpeg("", ""),
+		"rewritten":    jpeg("\xFF\xE0\x00\x04JF\xFF\xE1\x00\x05XMP\xFF\xFE\x00\x03c", ""),
+		"motion photo": jpeg("\xFF\xE1\x00\x06Exif", "\x00\x00\x00\x14ftypmp42"),
+	} {
+		sum, ok, err := JPEG(bytes.NewReader(data))
+		if err != nil || !ok || sum != original {
+			t.Errorf("%s: got %x, %v, %v; want the hash of the original", name, sum, ok, err)
+		}
+	}
+
+	changed := jpeg("\xFF\xE1\x00\x06Exif", "")
+	changed[len(changed)-3] = 0x03
+	if sum, ok, _ := JPEG(bytes.NewReader(changed)); !ok || sum == original {
+		t.Errorf("expected different image data to hash differently")
+	}
+}
+
+func TestJPEG_NotComplete(t *testing.T) {
+	complete := jpeg("", "")
+	for name, data := range map[string][]byte{
+		"not a jpeg": []byte("not a jpeg"),
+		"truncated":  complete[:len(complete)-2],
+		"no scan":    complete[:8],
+	} {
+		if _, ok, err := JPEG(bytes.NewReader(data)); ok || err != nil {
+			t.Errorf("%s: got %v, %v; want not ok", name, ok, err)
+		}
+	}
+}
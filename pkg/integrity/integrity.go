@@ -0,0 +1,84 @@
+// Package integrity recognizes media files that cannot be complete: empty files, as failed phone
+// transfers leave behind, and JPEGs cut off before their end-of-image marker.
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+var (
+	errNoContent = errors.New("no content")
+	errNoEOI     = errors.New("no end-of-image marker")
+)
+
+// Check returns an error matching errcode.ErrEmptyFile for a file of size 0, and one matching
+// errcode.ErrTruncated for a JPEG read from r that ends before its end-of-image marker. r is only read
+// for JPEGs; when it is an io.Seeker, a JPEG that ends with the marker is not read further.
+func Check(path string, size int64, r io.Reader) error {
+	if size == 0 {
+		return &errcode.FileError{Op: "check", Path: path, Kind: errcode.ErrEmptyFile, Err: errNoContent}
+	}
+	if !Reads(path) {
+		return nil
+	}
+
+	if s, ok := r.(io.ReadSeeker); ok && size >= 4 {
+		// Most JPEGs end with the marker; only those with a trailer (motion photos) need a scan.
+		tail := make([]byte, 2)
+		if _, err := s.Seek(size-2, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(s, tail); err == nil && tail[0] == 0xFF && tail[1] == 0xD9 {
+				return nil
+			}
+		}
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return &errcode.FileError{Op: "check", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return &errcode.FileError{Op: "check", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if !jpegComplete(data) {
+		return &errcode.FileError{Op: "check", Path: path, Kind: errcode.ErrTruncated, Err: errNoEOI}
+	}
+	return nil
+}
+
+// Reads reports whether Check reads the content of a file named name, or only needs its size.
+func Reads(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// jpegComplete reports whether the JPEG data reaches its end-of-image marker. Data that is not a JPEG
+// at all is left to the other stages and counts as complete.
+func jpegComplete(data []byte) bool {
+	segs, err := jpegseg.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return true
+	}
+	// Skip the segments before the image data, whose payload may hold any bytes.
+	for {
+		seg, err := segs.Next()
+		if err != nil || seg.End > int64(len(data)) {
+			return false
+		}
+		switch seg.Marker {
+		case jpegseg.EOI:
+			return true
+		case jpegseg.SOS:
+			// In the image data a 0xFF byte is followed by 0x00 or a restart marker, so 0xFF 0xD9 is the end.
+			return bytes.Contains(data[seg.End:], []byte{0xFF, 0xD9})
+		}
+	}
+}
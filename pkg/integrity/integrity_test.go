@@ -0,0 +1,46 @@
+package integrity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+)
+
+// jpeg is a minimal JPEG: an APP1 segment whose payload holds 0xFF 0xD9, a scan and the end marker.
+var jpeg = []byte{
+	0xFF, 0xD8,
+	0xFF, 0xE1, 0x00, 0x04, 0xFF, 0xD9,
+	0xFF, 0xDA, 0x00, 0x02, 0x01, 0xFF, 0x00, 0x02,
+	0xFF, 0xD9,
+}
+
+func TestCheck(t *testing.T) {
+	tests := map[string]struct {
+		path string
+		data []byte
+		want error
+	}{
+		"complete":            {"a.jpg", jpeg, nil},
+		"motion photo":        {"a.jpg", append(append([]byte(nil), jpeg...), "\x00\x00\x00\x14ftypmp42"...), nil},
+		"cut in the image":    {"a.JPG", jpeg[:len(jpeg)-2], errcode.ErrTruncated},
+		"cut in the metadata": {"a.jpeg", jpeg[:7], errcode.ErrTruncated},
+		"empty":               {"a.mp4", nil, errcode.ErrEmptyFile},
+		"not a jpeg":          {"a.jpg", []byte("not a jpeg"), nil},
+		"other format":        {"a.png", jpeg[:7], nil},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Both with and without seeking to the end first.
+			for _, r := range []io.Reader{bytes.NewReader(tc.data), strings.NewReader(string(tc.data)), io.MultiReader(bytes.NewReader(tc.data))} {
+				err := Check(tc.path, int64(len(tc.data)), r)
+				if tc.want == nil && err != nil || tc.want != nil && !errors.Is(err, tc.want) {
+					t.Errorf("Check(%T) = %v, want %v", r, err, tc.want)
+				}
+			}
+		})
+	}
+}
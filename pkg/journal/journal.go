@@ -0,0 +1,268 @@
+// Package journal records the files an executing organize run writes, so the run can be undone: every
+// copy with its source and the SHA-256 it was written with, one JSON line per file.
+//
+// Undo removes the copies that are still as they were written, and moves files a moving run took
+// from their source back there. Copies changed since, such as edited photos, are left alone.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+)
+
+// Entry is a file written by a run.
+type Entry struct {
+	// Source is the path the file was copied or moved from.
+	Source string `json:"source"`
+
+	// Destination is the path the file was written to.
+	Destination string `json:"destination"`
+
+	// Size and SHA256 are those of the file as written.
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// Moved is set when the source was removed, by --move or --in-place.
+	Moved bool `json:"moved,omitempty"`
+
+	// RemoteSource is set for files moved from a remote source, which Undo cannot move back.
+	RemoteSource bool `json:"remote_source,omitempty"`
+}
+
+// FileName returns the name of the journal of a run started at started, kept in the destination root.
+func FileName(started time.Time) string {
+	return ".organize-" + started.UTC().Format("20060102T150405Z") + ".jsonl"
+}
+
+// Writer appends entries to a journal. It is safe for concurrent use.
+type Writer struct {
+	path string
+
+	mu sync.Mutex
+	f  destfs.File
+	n  int
+}
+
+// Create creates the journal at path in fsys; nil is the local file system. An existing file is not
+// overwritten.
+func Create(fsys destfs.FS, path string) (*Writer, error) {
+	f, err := destfs.OrOS(fsys).OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create journal: %w", err)
+	}
+	return &Writer{path: path, f: f}, nil
+}
+
+// Path returns the path of the journal.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Append adds entries to the journal and syncs it, so the journal of an interrupted run lists every
+// file written before the interruption.
+func (w *Writer) Append(entries ...Entry) error {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("append to journal: %w", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("append to journal %s: %w", w.path, err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("append to journal %s: %w", w.path, err)
+	}
+	w.n += len(entries)
+	return nil
+}
+
+// Len returns the number of entries appended.
+func (w *Writer) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Close closes the journal.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.f.Close()
+}
+
+// Read returns the entries of the journal at path in fsys; nil is the local file system. A partial last
+// line, left by an interrupted write, is skipped.
+func Read(fsys destfs.FS, path string) ([]Entry, error) {
+	f, err := destfs.OrOS(fsys).Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read journal %s: %w", path, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	var entries []Entry
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("read journal %s line %d: %w", path, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// HashFile returns the size and hex-encoded SHA-256 of the file at path in fsys.
+func HashFile(fsys destfs.FS, path string) (int64, string, error) {
+	f, err := destfs.OrOS(fsys).Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ErrModified is the error of an entry whose file changed since the run wrote it.
+var ErrModified = errors.New("changed since it was written")
+
+// ErrRemoteSource is the error of an entry moved from a remote source.
+var ErrRemoteSource = errors.New("moved from a remote source; move it back by hand")
+
+// Action is what Undo did with the file of an entry.
+type Action string
+
+const (
+	// ActionRemoved means the copy was removed.
+	ActionRemoved Action = "removed"
+	// ActionMovedBack means the file was moved back to its source.
+	ActionMovedBack Action = "moved_back"
+	// ActionMissing means the file was no longer there; nothing was done.
+	ActionMissing Action = "missing"
+	// ActionFailed means the file was left in place, for the reason in Result.Err.
+	ActionFailed Action = "failed"
+)
+
+// Result is the outcome of undoing an entry.
+type Result struct {
+	Entry  Entry
+	Action Action
+	Err    error
+}
+
+// Undo undoes the entries of a journal, last entry first: every file still as it was written is
+// removed, or moved back to its local source when the run moved it there from. fsys holds the
+// destination files; nil is the local file system. Directories below root the files leave empty are
+// removed. With bin, the removed files go into that trash instead, which needs them local.
+func Undo(ctx context.Context, fsys destfs.FS, root string, entries []Entry, bin trash.Trash) ([]Result, error) {
+	fsys = destfs.OrOS(fsys)
+	results := make([]Result, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		r := undo(ctx, fsys, entries[i], bin)
+		if r.Action == ActionRemoved || r.Action == ActionMovedBack {
+			removeEmptyDirs(fsys, root, r.Entry.Destination)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// Check returns what Undo would do with the file of e, without changing anything: the file is
+// verified to be as the run wrote it.
+func Check(fsys destfs.FS, e Entry) Result {
+	size, sum, err := HashFile(fsys, e.Destination)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Result{Entry: e, Action: ActionMissing}
+	case err != nil:
+		return Result{Entry: e, Action: ActionFailed, Err: err}
+	case size != e.Size || sum != e.SHA256:
+		return Result{Entry: e, Action: ActionFailed, Err: ErrModified}
+	case !e.Moved:
+		return Result{Entry: e, Action: ActionRemoved}
+	case e.RemoteSource:
+		return Result{Entry: e, Action: ActionFailed, Err: ErrRemoteSource}
+	}
+	return Result{Entry: e, Action: ActionMovedBack}
+}
+
+func undo(ctx context.Context, fsys destfs.FS, e Entry, bin trash.Trash) Result {
+	r := Check(fsys, e)
+	switch r.Action {
+	case ActionRemoved:
+		if err := remove(fsys, e.Destination, bin); err != nil {
+			return Result{Entry: e, Action: ActionFailed, Err: err}
+		}
+	case ActionMovedBack:
+		op := plan.Operation{SourcePath: e.Destination, DestinationPath: e.Source}
+		results, err := copy.Execute(ctx, []plan.Operation{op}, copy.Options{Move: true, Source: fsys, PreserveTimes: true, Trash: bin})
+		if err == nil && len(results) == 1 && !results[0].Success {
+			err = results[0].Error
+		}
+		if err != nil {
+			return Result{Entry: e, Action: ActionFailed, Err: err}
+		}
+	}
+	return r
+}
+
+// remove removes the file at path in fsys, or puts it into bin when set.
+func remove(fsys destfs.FS, path string, bin trash.Trash) error {
+	if bin == nil {
+		return fsys.Remove(path)
+	}
+	if !destfs.IsOS(fsys) {
+		return copy.ErrRemoteTrash
+	}
+	return bin.Put(path)
+}
+
+// removeEmptyDirs removes the directory of path, and its parents below root, while they are empty.
+func removeEmptyDirs(fsys destfs.FS, root, path string) {
+	root = filepath.Clean(root)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if entries, err := fsys.ReadDir(dir); err != nil || len(entries) > 0 {
+			return
+		}
+		if fsys.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/trash"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// entryOf returns the entry of the file at destination as it is now.
+func entryOf(t *testing.T, source, destination string, moved bool) Entry {
+	t.Helper()
+	size, sum, err := HashFile(nil, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Entry{Source: source, Destination: destination, Size: size, SHA256: sum, Moved: moved}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if filepath.Base(path) != ".organize-20240102T030405Z.jsonl" {
+		t.Errorf("FileName = %s", filepath.Base(path))
+	}
+	w, err := Create(nil, path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	want := []Entry{
+		{Source: "/card/a.jpg", Destination: "/lib/a.jpg", Size: 1, SHA256: "aa"},
+		{Source: "/card/a.xmp", Destination: "/lib/a.xmp", Size: 2, SHA256: "bb", Moved: true},
+	}
+	if err := w.Append(want...); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if w.Len() != 2 {
+		t.Errorf("Len = %d, want 2", w.Len())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(nil, path); err == nil {
+		t.Errorf("expected an existing journal not to be overwritten")
+	}
+
+	// The partial last line of an interrupted write is skipped.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"source":"/card/b.jpg","desti`)
+	f.Close()
+
+	got, err := Read(nil, path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Read = %+v, want %+v", got, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	src, lib := t.TempDir(), t.TempDir()
+	copied := filepath.Join(lib, "2024", "01", "02", "a.jpg")
+	edited := filepath.Join(lib, "2024", "01", "03", "b.jpg")
+	moved := filepath.Join(lib, "2024", "02", "c.jpg")
+	writeFile(t, copied, "a")
+	writeFile(t, edited, "b")
+	writeFile(t, moved, "c")
+	entries := []Entry{
+		entryOf(t, filepath.Join(src, "a.jpg"), copied, false),
+		entryOf(t, filepath.Join(src, "b.jpg"), edited, false),
+		entryOf(t, filepath.Join(src, "c.jpg"), moved, true),
+		{Source: filepath.Join(src, "d.jpg"), Destination: filepath.Join(lib, "gone.jpg"), Size: 1, SHA256: "dd"},
+	}
+	writeFile(t, edited, "edited")
+
+	// Check changes nothing.
+	if r := Check(nil, entries[0]); r.Action != ActionRemoved {
+		t.Errorf("Check = %+v, want %s", r, ActionRemoved)
+	}
+	if _, err := os.Stat(copied); err != nil {
+		t.Fatalf("Check removed the copy: %v", err)
+	}
+
+	results, err := Undo(context.Background(), nil, lib, entries, nil)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	want := []Action{ActionMissing, ActionMovedBack, ActionFailed, ActionRemoved}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, r := range results {
+		if r.Action != want[i] {
+			t.Errorf("%s: got %s (%v), want %s", r.Entry.Destination, r.Action, r.Err, want[i])
+		}
+	}
+	if !errors.Is(results[2].Err, ErrModified) {
+		t.Errorf("edited copy: got %v, want ErrModified", results[2].Err)
+	}
+
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("expected the copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(lib, "2024", "01", "02")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(edited); err != nil {
+		t.Errorf("expected the edited copy to be kept: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(src, "c.jpg")); err != nil || string(data) != "c" {
+		t.Errorf("expected the moved file back in the source: %q, %v", data, err)
+	}
+	if _, err := os.Stat(lib); err != nil {
+		t.Errorf("expected the library root to be kept: %v", err)
+	}
+}
+
+func TestUndo_ToTrash(t *testing.T) {
+	src, lib := t.TempDir(), t.TempDir()
+	copied := filepath.Join(lib, "2024", "01", "02", "a.jpg")
+	writeFile(t, copied, "a")
+	entries := []Entry{entryOf(t, filepath.Join(src, "a.jpg"), copied, false)}
+	bin := trash.Dir{Path: trash.DestinationDir(lib, "", time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)), Root: lib}
+
+	results, err := Undo(context.Background(), nil, lib, entries, bin)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if len(results) != 1 || results[0].Action != ActionRemoved {
+		t.Fatalf("results = %+v, want one %s", results, ActionRemoved)
+	}
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("expected the copy to leave the library, got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(bin.Path, "2024", "01", "02", "a.jpg")); err != nil || string(data) != "a" {
+		t.Errorf("expected the copy in the trash: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(lib, "2024", "01", "02")); !os.IsNotExist(err) {
+		t.Errorf("expected the emptied directory to be removed, got %v", err)
+	}
+}
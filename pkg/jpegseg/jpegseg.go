@@ -0,0 +1,141 @@
+// Package jpegseg iterates over the marker segments of a JPEG file up to its image data, where the
+// EXIF, XMP and IPTC metadata of the file is kept.
+package jpegseg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNotJPEG is returned by NewReader for data that does not start with a start-of-image marker.
+	ErrNotJPEG = errors.New("jpegseg: not a JPEG file")
+
+	// ErrMalformed is returned by Next and Payload for a segment that cannot be parsed or that the
+	// file ends in.
+	ErrMalformed = errors.New("jpegseg: malformed segment")
+)
+
+// Markers the packages reading JPEG metadata look for.
+const (
+	SOI   = 0xD8 // start of image
+	EOI   = 0xD9 // end of image
+	SOS   = 0xDA // start of scan, followed by the image data
+	APP0  = 0xE0 // JFIF
+	APP1  = 0xE1 // EXIF or XMP
+	APP13 = 0xED // Photoshop image resources, holding IPTC
+	COM   = 0xFE // comment
+)
+
+// XMPNamespace starts the payload of the APP1 segment holding the XMP packet.
+var XMPNamespace = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// Segment is a marker segment of a JPEG.
+type Segment struct {
+	// Marker is the byte following 0xFF, such as APP1.
+	Marker byte
+	// Offset is the position of the marker in the file and End the position right after the segment.
+	Offset, End int64
+}
+
+// Reader returns the segments of a JPEG one by one.
+type Reader struct {
+	r    io.Reader
+	pos  int64
+	end  int64
+	done bool
+}
+
+// NewReader reads the start-of-image marker of the JPEG read from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotJPEG
+		}
+		return nil, err
+	}
+	if soi != [2]byte{0xFF, SOI} {
+		return nil, ErrNotJPEG
+	}
+	return &Reader{r: r, pos: 2, end: 2}, nil
+}
+
+// Next returns the next segment. The start-of-scan segment and an end-of-image marker are the last
+// ones: after them Next returns io.EOF. The payload of the previous segment is skipped unless it was
+// read with Payload, seeking when r is an io.Seeker.
+func (r *Reader) Next() (Segment, error) {
+	if r.done {
+		return Segment{}, io.EOF
+	}
+	if err := r.skip(); err != nil {
+		return Segment{}, err
+	}
+	var header [4]byte
+	if err := r.read(header[:2]); err != nil {
+		return Segment{}, err
+	}
+	seg := Segment{Marker: header[1], Offset: r.pos - 2}
+	if header[0] != 0xFF {
+		return Segment{}, fmt.Errorf("%w: no marker at offset %d", ErrMalformed, seg.Offset)
+	}
+	if seg.Marker == EOI {
+		r.done, seg.End, r.end = true, r.pos, r.pos
+		return seg, nil
+	}
+	if err := r.read(header[2:]); err != nil {
+		return Segment{}, err
+	}
+	length := int64(binary.BigEndian.Uint16(header[2:]))
+	if length < 2 {
+		return Segment{}, fmt.Errorf("%w: bad length at offset %d", ErrMalformed, seg.Offset)
+	}
+	seg.End = seg.Offset + 2 + length
+	r.end, r.done = seg.End, seg.Marker == SOS
+	return seg, nil
+}
+
+// Payload reads the payload of the segment last returned by Next: the bytes after its length.
+func (r *Reader) Payload() ([]byte, error) {
+	if r.pos >= r.end {
+		return nil, nil
+	}
+	p := make([]byte, r.end-r.pos)
+	if err := r.read(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// read fills p, reporting a file that ends early as malformed.
+func (r *Reader) read(p []byte) error {
+	n, err := io.ReadFull(r.r, p)
+	r.pos += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: file ends at offset %d", ErrMalformed, r.pos)
+	}
+	return err
+}
+
+// skip moves past the unread payload of the current segment.
+func (r *Reader) skip() error {
+	n := r.end - r.pos
+	if n <= 0 {
+		return nil
+	}
+	if s, ok := r.r.(io.Seeker); ok {
+		if _, err := s.Seek(n, io.SeekCurrent); err != nil {
+			return err
+		}
+		r.pos = r.end
+		return nil
+	}
+	m, err := io.CopyN(io.Discard, r.r, n)
+	r.pos += m
+	if err == io.EOF {
+		return fmt.Errorf("%w: file ends at offset %d", ErrMalformed, r.pos)
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package jpegseg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+// segment returns a marker segment with the given payload.
+func segment(marker byte, payload string) []byte {
+	return testjpeg.Segment(marker, []byte(payload))
+}
+
+func TestReader_Segments(t *testing.T) {
+	data := testjpeg.JPEG(segment(APP0, "JFIF\x00"), segment(APP1, "Exif\x00\x00tiff"), segment(SOS, "sos"), []byte{1, 2})
+
+	// Both a reader that seeks and one that does not skip the payloads left unread.
+	for _, r := range []io.Reader{bytes.NewReader(data), io.MultiReader(bytes.NewReader(data))} {
+		segs, err := NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var markers []byte
+		for {
+			seg, err := segs.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			markers = append(markers, seg.Marker)
+			if seg.Marker == APP1 {
+				payload, err := segs.Payload()
+				if err != nil || string(payload) != "Exif\x00\x00tiff" {
+					t.Errorf("APP1 payload %q, %v", payload, err)
+				}
+				if seg.Offset != 11 || seg.End != 25 {
+					t.Errorf("APP1 at %d-%d", seg.Offset, seg.End)
+				}
+			}
+			if seg.Marker == SOS && !bytes.Equal(data[seg.End:], []byte{1, 2, 0xFF, EOI}) {
+				t.Errorf("image data after SOS: %v", data[seg.End:])
+			}
+		}
+		if !bytes.Equal(markers, []byte{APP0, APP1, SOS}) {
+			t.Errorf("got markers %X", markers)
+		}
+	}
+}
+
+func TestReader_EndOfImage(t *testing.T) {
+	segs, err := NewReader(bytes.NewReader(testjpeg.JPEG(segment(APP1, "x"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs.Next()
+	if seg, err := segs.Next(); err != nil || seg.Marker != EOI {
+		t.Fatalf("got %+v, %v; want EOI", seg, err)
+	}
+	if _, err := segs.Next(); err != io.EOF {
+		t.Fatalf("after EOI got %v, want io.EOF", err)
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	for _, data := range [][]byte{nil, {0xFF}, []byte("PNG")} {
+		if _, err := NewReader(bytes.NewReader(data)); !errors.Is(err, ErrNotJPEG) {
+			t.Errorf("NewReader(%q) = %v, want ErrNotJPEG", data, err)
+		}
+	}
+
+	// These streams end without an end marker, so they are not built with testjpeg.JPEG.
+	soi := []byte{0xFF, SOI}
+	for name, data := range map[string][]byte{
+		"no marker":       slices.Concat(soi, []byte{0x00, 0x01, 0x02, 0x03}),
+		"bad length":      slices.Concat(soi, []byte{0xFF, APP1, 0x00, 0x01}),
+		"truncated":       slices.Concat(soi, segment(APP1, "payload")[:6]),
+		"truncated later": slices.Concat(soi, segment(APP1, "payload")[:6], segment(APP0, "x")),
+	} {
+		segs, err := NewReader(io.MultiReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			if _, err = segs.Next(); err == nil {
+				_, err = segs.Payload()
+			}
+		}
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want ErrMalformed", name, err)
+		}
+	}
+}
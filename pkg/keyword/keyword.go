@@ -0,0 +1,136 @@
+// Package keyword reads the keywords (tags) photo applications record in a file: the dc:subject of its
+// XMP metadata or the IPTC Keywords of a JPEG.
+package keyword
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+var (
+	// xmpSubject matches the dc:subject of an XMP packet, a bag of keywords.
+	xmpSubject = regexp.MustCompile(`(?s)<dc:subject>(.*?)</dc:subject>`)
+	// xmpItem matches an item of an RDF bag.
+	xmpItem = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+)
+
+// FromXMP returns the keywords in the XMP data, such as an .xmp sidecar, in the order they are listed.
+func FromXMP(data []byte) []string {
+	m := xmpSubject.FindSubmatch(data)
+	if m == nil {
+		return nil
+	}
+	var keywords []string
+	for _, item := range xmpItem.FindAllSubmatch(m[1], -1) {
+		keywords = appendKeyword(keywords, html.UnescapeString(string(item[1])))
+	}
+	return keywords
+}
+
+// IsCandidate reports whether the file name is a JPEG, the only format whose embedded keywords are read.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// FromJPEG returns the keywords embedded in the JPEG read from r. The XMP keywords win over the IPTC
+// ones, which applications keep in sync. Only the metadata segments before the image data are read.
+func FromJPEG(r io.Reader) ([]string, error) {
+	segs, err := jpegseg.NewReader(r)
+	if err != nil {
+		return nil, nil
+	}
+	var iptc []string
+	for {
+		seg, err := segs.Next()
+		if err == io.EOF || errors.Is(err, jpegseg.ErrMalformed) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seg.Marker != jpegseg.APP1 && seg.Marker != jpegseg.APP13 {
+			continue
+		}
+		segment, err := segs.Payload()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case seg.Marker == jpegseg.APP1 && bytes.HasPrefix(segment, jpegseg.XMPNamespace):
+			if keywords := FromXMP(segment); len(keywords) > 0 {
+				return keywords, nil
+			}
+		case seg.Marker == jpegseg.APP13 && bytes.HasPrefix(segment, []byte("Photoshop 3.0\x00")) && iptc == nil:
+			iptc = fromPhotoshop(segment[len("Photoshop 3.0\x00"):])
+		}
+	}
+	return iptc, nil
+}
+
+// fromPhotoshop returns the IPTC keywords of the Photoshop image resources of an APP13 segment.
+func fromPhotoshop(data []byte) []string {
+	for len(data) >= 12 && bytes.HasPrefix(data, []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[4:])
+		// The resource name is a Pascal string padded to an even length.
+		nameLen := 1 + int(data[6])
+		nameLen += nameLen % 2
+		if 6+nameLen+4 > len(data) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[6+nameLen:]))
+		start := 6 + nameLen + 4
+		if size < 0 || start+size > len(data) {
+			return nil
+		}
+		if id == 0x0404 {
+			return fromIPTC(data[start : start+size])
+		}
+		data = data[start+size+size%2:]
+	}
+	return nil
+}
+
+// fromIPTC returns the Keywords datasets (2:25) of IPTC-IIM data.
+func fromIPTC(data []byte) []string {
+	var keywords []string
+	for len(data) >= 5 && data[0] == 0x1C {
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:]))
+		if size&0x8000 != 0 || 5+size > len(data) {
+			// Extended datasets are only used for large binary data, never for keywords.
+			break
+		}
+		if record == 2 && dataset == 25 {
+			keywords = appendKeyword(keywords, string(data[5:5+size]))
+		}
+		data = data[5+size:]
+	}
+	return keywords
+}
+
+// appendKeyword appends the keyword k, its runs of white space and line breaks collapsed to a single
+// space, unless it is empty or already listed, ignoring case.
+func appendKeyword(keywords []string, k string) []string {
+	k = strings.Join(strings.Fields(k), " ")
+	if k == "" {
+		return keywords
+	}
+	for _, have := range keywords {
+		if strings.EqualFold(have, k) {
+			return keywords
+		}
+	}
+	return append(keywords, k)
+}
@@ -0,0 +1,64 @@
+package keyword
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+// photoshopPayload returns an APP13 payload whose IPTC resource holds keywords.
+func photoshopPayload(keywords ...string) []byte {
+	var iptc []byte
+	iptc = append(iptc, 0x1C, 2, 0, 0, 2, 0, 4) // Record version.
+	for _, k := range keywords {
+		iptc = append(iptc, 0x1C, 2, 25)
+		iptc = binary.BigEndian.AppendUint16(iptc, uint16(len(k)))
+		iptc = append(iptc, k...)
+	}
+	data := []byte("Photoshop 3.0\x00")
+	// A resource before the IPTC one, with a name.
+	data = append(data, "8BIM\x03\xED\x03abc\x00\x00\x00\x02\x00\x01"...)
+	data = append(data, "8BIM\x04\x04\x00\x00"...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(iptc)))
+	return append(data, iptc...)
+}
+
+func TestFromXMP(t *testing.T) {
+	xmp := `<rdf:Description><dc:subject><rdf:Bag>
+  <rdf:li>scan</rdf:li>
+  <rdf:li>Tom &amp; Anna</rdf:li>
+  <rdf:li>Scan</rdf:li>
+  <rdf:li> </rdf:li>
+</rdf:Bag></dc:subject></rdf:Description>`
+	want := []string{"scan", "Tom & Anna"}
+	if got := FromXMP([]byte(xmp)); !reflect.DeepEqual(got, want) {
+		t.Errorf("FromXMP = %q, want %q", got, want)
+	}
+	if got := FromXMP([]byte(`<rdf:Description xmp:Rating="4"/>`)); got != nil {
+		t.Errorf("expected no keywords, got %q", got)
+	}
+}
+
+func TestFromJPEG(t *testing.T) {
+	xmp := testjpeg.Segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<dc:subject><rdf:Bag><rdf:li>xmp</rdf:li></rdf:Bag></dc:subject>"))
+	iptc := testjpeg.Segment(0xED, photoshopPayload("scan", "family"))
+	tests := map[string]struct {
+		data []byte
+		want []string
+	}{
+		"xmp":        {testjpeg.JPEG(xmp), []string{"xmp"}},
+		"iptc":       {testjpeg.JPEG(iptc), []string{"scan", "family"}},
+		"xmp wins":   {testjpeg.JPEG(iptc, xmp), []string{"xmp"}},
+		"none":       {testjpeg.JPEG(testjpeg.Segment(0xE0, []byte("JFIF\x00"))), nil},
+		"not a jpeg": {[]byte("not a jpeg"), nil},
+	}
+	for name, tc := range tests {
+		got, err := FromJPEG(bytes.NewReader(tc.data))
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, %v; want %q", name, got, err, tc.want)
+		}
+	}
+}
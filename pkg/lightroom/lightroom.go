@@ -0,0 +1,164 @@
+// Package lightroom reads Adobe Lightroom Classic catalogs (.lrcat), so the capture dates,
+// ratings and collections curated in Lightroom can be used while organizing the files it manages.
+//
+// The catalog is opened read-only. Lightroom holds a lock on an open catalog; close Lightroom
+// (or work on a copy of the catalog) before reading it.
+package lightroom
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Photo is what the catalog records about a file.
+type Photo struct {
+	// Path is the absolute path of the file.
+	Path string
+
+	// CaptureTime is the capture date, including edits made in Lightroom. Zero if unknown.
+	CaptureTime time.Time
+
+	// Rating is the star rating, 0 (unrated) to 5.
+	Rating int
+
+	// Collections holds the names of the regular collections containing the photo, sorted.
+	// Smart collections are not included.
+	Collections []string
+}
+
+// Catalog is the content of a Lightroom catalog, indexed by file path.
+type Catalog struct {
+	photos map[string]Photo
+}
+
+// captureTimeLayouts are the formats of Adobe_images.captureTime. Times without an offset are camera
+// local time; partial dates (only a year, or a year and month) are left out.
+var captureTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// Open reads the catalog at path. Capture times without an offset are interpreted in loc.
+func Open(ctx context.Context, path string, loc *time.Location) (*Catalog, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("open catalog %s: %w", path, err)
+	}
+	db, err := sql.Open("sqlite", "file:"+(&url.URL{Path: abs}).EscapedPath()+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("open catalog %s: %w", path, err)
+	}
+	defer db.Close()
+
+	collections, err := readCollections(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("read catalog %s: %w", path, err)
+	}
+
+	// Virtual copies share the file of their master and are left out.
+	rows, err := db.QueryContext(ctx, `
+		SELECT img.id_local, root.absolutePath, folder.pathFromRoot, file.baseName, COALESCE(file.extension, ''),
+		       COALESCE(img.captureTime, ''), COALESCE(img.rating, 0)
+		FROM Adobe_images img
+		JOIN AgLibraryFile file ON file.id_local = img.rootFile
+		JOIN AgLibraryFolder folder ON folder.id_local = file.folder
+		JOIN AgLibraryRootFolder root ON root.id_local = folder.rootFolder
+		WHERE img.masterImage IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("read catalog %s: %w", path, err)
+	}
+	defer rows.Close()
+
+	c := &Catalog{photos: make(map[string]Photo)}
+	for rows.Next() {
+		var (
+			id                         int64
+			rootPath, folderPath, base string
+			ext, captureTime           string
+			rating                     float64
+		)
+		if err := rows.Scan(&id, &rootPath, &folderPath, &base, &ext, &captureTime, &rating); err != nil {
+			return nil, fmt.Errorf("read catalog %s: %w", path, err)
+		}
+		name := base
+		if ext != "" {
+			name += "." + ext
+		}
+		p := Photo{
+			Path:        filepath.Clean(filepath.FromSlash(rootPath + folderPath + name)),
+			CaptureTime: parseCaptureTime(captureTime, loc),
+			Rating:      int(rating),
+			Collections: collections[id],
+		}
+		c.photos[p.Path] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// readCollections returns the sorted regular collection names per image.
+func readCollections(ctx context.Context, db *sql.DB) (map[int64][]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT ci.image, c.name
+		FROM AgLibraryCollectionImage ci
+		JOIN AgLibraryCollection c ON c.id_local = ci.collection
+		WHERE c.creationId = 'com.adobe.ag.library.collection' AND COALESCE(c.name, '') <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := make(map[int64][]string)
+	for rows.Next() {
+		var image int64
+		var name string
+		if err := rows.Scan(&image, &name); err != nil {
+			return nil, err
+		}
+		collections[image] = append(collections[image], name)
+	}
+	for image := range collections {
+		sort.Strings(collections[image])
+	}
+	return collections, rows.Err()
+}
+
+func parseCaptureTime(s string, loc *time.Location) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range captureTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Len returns the number of photos in the catalog.
+func (c *Catalog) Len() int { return len(c.photos) }
+
+// Lookup returns the catalog entry of the file at path. Relative paths are resolved against
+// the working directory.
+func (c *Catalog) Lookup(path string) (Photo, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Photo{}, false
+	}
+	p, ok := c.photos[abs]
+	return p, ok
+}
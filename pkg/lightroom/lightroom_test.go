@@ -0,0 +1,121 @@
+package lightroom
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// schema is the subset of a Lightroom Classic catalog read by this package.
+const schema = `
+CREATE TABLE AgLibraryRootFolder (id_local INTEGER PRIMARY KEY, absolutePath UNIQUE NOT NULL DEFAULT '', name NOT NULL DEFAULT '');
+CREATE TABLE AgLibraryFolder (id_local INTEGER PRIMARY KEY, pathFromRoot NOT NULL DEFAULT '', rootFolder INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, baseName NOT NULL DEFAULT '', extension NOT NULL DEFAULT '', folder INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, captureTime, masterImage INTEGER, rating, rootFile INTEGER NOT NULL DEFAULT 0);
+CREATE TABLE AgLibraryCollection (id_local INTEGER PRIMARY KEY, creationId NOT NULL DEFAULT '', name NOT NULL DEFAULT '');
+CREATE TABLE AgLibraryCollectionImage (id_local INTEGER PRIMARY KEY, collection INTEGER NOT NULL DEFAULT 0, image INTEGER NOT NULL DEFAULT 0);
+`
+
+func newCatalog(t *testing.T, root string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "Catalog.lrcat")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO AgLibraryRootFolder VALUES (1, ?, 'Photos');
+		INSERT INTO AgLibraryFolder VALUES (2, '2019/', 1), (3, '', 1);
+		INSERT INTO AgLibraryFile VALUES (10, 'DSC_0001', 'NEF', 2), (11, 'scan', 'tif', 3), (12, 'DSC_0002', 'NEF', 2);
+		INSERT INTO Adobe_images VALUES
+			(20, '2019-05-04T12:34:56.25', NULL, 4, 10),
+			(21, '1987', NULL, NULL, 11),
+			(22, '2019-05-04T13:00:00', 20, 1, 10),
+			(23, '2019-05-05T08:00:00+02:00', NULL, 0, 12);
+		INSERT INTO AgLibraryCollection VALUES
+			(30, 'com.adobe.ag.library.collection', 'Portfolio'),
+			(31, 'com.adobe.ag.library.collection', 'Family'),
+			(32, 'com.adobe.ag.library.smart_collection', 'Five stars');
+		INSERT INTO AgLibraryCollectionImage VALUES (40, 30, 20), (41, 31, 20), (42, 32, 20);
+	`, filepath.ToSlash(root)+"/"); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Photos")
+	loc := time.FixedZone("CET", 3600)
+
+	c, err := Open(context.Background(), newCatalog(t, root), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 3 {
+		t.Fatalf("got %d photos, want 3 (virtual copies are left out)", c.Len())
+	}
+
+	for _, tt := range []struct {
+		path string
+		want Photo
+	}{
+		{
+			path: filepath.Join(root, "2019", "DSC_0001.NEF"),
+			want: Photo{
+				CaptureTime: time.Date(2019, 5, 4, 12, 34, 56, 250_000_000, loc),
+				Rating:      4,
+				Collections: []string{"Family", "Portfolio"},
+			},
+		},
+		{
+			// A partial date is no capture time.
+			path: filepath.Join(root, "scan.tif"),
+			want: Photo{},
+		},
+		{
+			path: filepath.Join(root, "2019", "DSC_0002.NEF"),
+			want: Photo{CaptureTime: time.Date(2019, 5, 5, 8, 0, 0, 0, time.FixedZone("", 2*3600))},
+		},
+	} {
+		got, ok := c.Lookup(tt.path)
+		if !ok {
+			t.Errorf("%s: not found", tt.path)
+			continue
+		}
+		tt.want.Path = tt.path
+		if !got.CaptureTime.Equal(tt.want.CaptureTime) {
+			t.Errorf("%s: capture time %v, want %v", tt.path, got.CaptureTime, tt.want.CaptureTime)
+		}
+		got.CaptureTime, tt.want.CaptureTime = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, ok := c.Lookup(filepath.Join(root, "missing.jpg")); ok {
+		t.Errorf("unexpected entry for a file outside the catalog")
+	}
+}
+
+func TestOpen_NotACatalog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.lrcat")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE t (x)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, err := Open(context.Background(), path, nil); err == nil {
+		t.Errorf("expected an error for a database without catalog tables")
+	}
+}
@@ -0,0 +1,197 @@
+// Package lock provides a destination lock file that prevents concurrent runs
+// from racing on collision resolution.
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileName is the name of the lock file created in the destination root.
+const FileName = ".media-organizer.lock"
+
+// ErrLocked is returned when the destination is locked by another live run.
+var ErrLocked = errors.New("destination is locked by another run")
+
+// unreadableGrace is how long a lock file that cannot be read as Info, such as one left empty by a run
+// that crashed right after creating it, is left to its writer before it is taken over.
+const unreadableGrace = time.Minute
+
+// Info is the content of a lock file.
+type Info struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Started  time.Time `json:"started"`
+}
+
+// Options configures Acquire.
+type Options struct {
+	// Wait is how long to wait for a held lock before giving up. Zero means do not wait.
+	Wait time.Duration
+
+	// PollInterval is how often a held lock is re-checked while waiting.
+	// If zero, one second is used.
+	PollInterval time.Duration
+
+	// StaleAfter treats locks older than this as abandoned when their owner cannot be
+	// checked (e.g. it runs on another host). Zero disables the age check.
+	StaleAfter time.Duration
+}
+
+// DefaultOptions returns the options used by the CLI.
+func DefaultOptions() Options {
+	return Options{
+		PollInterval: time.Second,
+		StaleAfter:   24 * time.Hour,
+	}
+}
+
+// Lock is a held destination lock.
+type Lock struct {
+	path string
+	info Info
+}
+
+// Acquire locks the destination directory dir, creating it if needed.
+//
+// A lock left behind by a process that no longer runs on this host, a lock whose owner
+// cannot be checked that is older than opts.StaleAfter, and a lock file that cannot be
+// read and was last written over a minute ago are considered stale and taken over. When
+// the lock is held, Acquire waits up to opts.Wait and then returns an error wrapping
+// ErrLocked.
+func Acquire(dir string, opts Options) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create destination: %w", err)
+	}
+
+	poll := opts.PollInterval
+	if poll <= 0 {
+		poll = time.Second
+	}
+
+	host, _ := os.Hostname()
+	l := &Lock{
+		path: filepath.Join(dir, FileName),
+		info: Info{PID: os.Getpid(), Hostname: host, Started: time.Now().UTC()},
+	}
+
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		err := l.create()
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("create lock: %w", err)
+		}
+
+		held, readErr := Read(l.path)
+		if readErr != nil {
+			if errors.Is(readErr, os.ErrNotExist) {
+				// Released between our create and read; try again.
+				continue
+			}
+			return nil, readErr
+		}
+		if isStale(held, host, opts.StaleAfter) || unreadableStale(l.path, held) {
+			if err := removeIfUnchanged(l.path, held); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: pid %d on %s since %s (%s)", ErrLocked, held.PID, held.Hostname, held.Started.Format(time.RFC3339), l.path)
+		}
+		time.Sleep(poll)
+	}
+}
+
+// Release removes the lock file.
+func (l *Lock) Release() error {
+	held, err := Read(l.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if held != l.info {
+		// Someone else took over the lock (we were considered stale); leave theirs alone.
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove lock: %w", err)
+	}
+	return nil
+}
+
+// Read returns the content of the lock file at path.
+func Read(path string) (Info, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(b, &info); err != nil {
+		// A partially written lock file is treated as held by nobody in particular.
+		return Info{}, nil
+	}
+	return info, nil
+}
+
+func (l *Lock) create() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(l.info); err != nil {
+		_ = f.Close()
+		_ = os.Remove(l.path)
+		return fmt.Errorf("write lock: %w", err)
+	}
+	return f.Close()
+}
+
+// isStale reports whether the lock held was abandoned: its process no longer runs on this host or,
+// when that cannot be checked, it is older than staleAfter.
+func isStale(held Info, host string, staleAfter time.Duration) bool {
+	if held.PID > 0 && held.Hostname == host {
+		if alive, known := processAlive(held.PID); known {
+			return !alive
+		}
+	}
+	return staleAfter > 0 && !held.Started.IsZero() && time.Since(held.Started) > staleAfter
+}
+
+// unreadableStale reports whether the lock file at path, read as held, could not be read as Info and
+// was last written longer than unreadableGrace ago.
+func unreadableStale(path string, held Info) bool {
+	if held != (Info{}) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > unreadableGrace
+}
+
+// removeIfUnchanged removes a stale lock unless it was replaced in the meantime.
+func removeIfUnchanged(path string, stale Info) error {
+	current, err := Read(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if current != stale {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove stale lock: %w", err)
+	}
+	return nil
+}
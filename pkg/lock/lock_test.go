@@ -0,0 +1,132 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire_SecondAcquireFails(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Acquire(dir, Options{})
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	if _, err := Acquire(dir, Options{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected lock file to be removed, got %v", err)
+	}
+
+	l2, err := Acquire(dir, Options{})
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	_ = l2.Release()
+}
+
+func TestAcquire_WaitsForRelease(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Acquire(dir, Options{})
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = l.Release()
+	}()
+
+	l2, err := Acquire(dir, Options{Wait: 5 * time.Second, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("expected to acquire after waiting, got %v", err)
+	}
+	_ = l2.Release()
+}
+
+func TestAcquire_TakesOverStaleLock(t *testing.T) {
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		name string
+		info Info
+	}{
+		{name: "dead process on this host", info: Info{PID: deadPID(t), Hostname: host, Started: time.Now()}},
+		{name: "expired lock from another host", info: Info{PID: 1, Hostname: "elsewhere", Started: time.Now().Add(-48 * time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			b, _ := json.Marshal(tt.info)
+			if err := os.WriteFile(filepath.Join(dir, FileName), b, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := Acquire(dir, DefaultOptions())
+			if err != nil {
+				t.Fatalf("expected stale lock to be taken over, got %v", err)
+			}
+			_ = l.Release()
+		})
+	}
+}
+
+func TestAcquire_KeepsLongRunningLock(t *testing.T) {
+	host, _ := os.Hostname()
+	dir := t.TempDir()
+	// A run on this host that is still alive keeps its lock, however long it takes.
+	b, _ := json.Marshal(Info{PID: os.Getpid(), Hostname: host, Started: time.Now().Add(-48 * time.Hour)})
+	if err := os.WriteFile(filepath.Join(dir, FileName), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(dir, DefaultOptions()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for a live run older than StaleAfter, got %v", err)
+	}
+}
+
+func TestAcquire_UnreadableLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty lock may still be being written.
+	if _, err := Acquire(dir, DefaultOptions()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for a fresh empty lock, got %v", err)
+	}
+
+	// Once it was left alone for longer than the grace period, it is taken over.
+	old := time.Now().Add(-2 * unreadableGrace)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Acquire(dir, DefaultOptions())
+	if err != nil {
+		t.Fatalf("expected the abandoned empty lock to be taken over, got %v", err)
+	}
+	_ = l.Release()
+}
+
+// deadPID returns a PID that is very unlikely to belong to a running process.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	for pid := 999999; pid > 900000; pid-- {
+		if alive, _ := processAlive(pid); !alive {
+			return pid
+		}
+	}
+	t.Skip("no free PID found")
+	return 0
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package lock
+
+// processAlive cannot tell whether a process runs here; Options.StaleAfter decides instead.
+func processAlive(pid int) (alive, known bool) {
+	return false, false
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code GetExitCodeProcess reports for a process that has not exited.
+const stillActive = 259
+
+// processAlive reports whether the process pid runs, and whether it could tell.
+func processAlive(pid int) (alive, known bool) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	switch {
+	case errors.Is(err, windows.ERROR_INVALID_PARAMETER):
+		return false, true
+	case errors.Is(err, windows.ERROR_ACCESS_DENIED):
+		return true, true
+	case err != nil:
+		return false, false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false, false
+	}
+	return code == stillActive, true
+}
@@ -0,0 +1,286 @@
+// Package manifest writes and verifies SHA-256 checksum manifests of an organized library.
+//
+// Manifests use the format of GNU sha256sum, so `sha256sum -c SHA256SUMS` run in the directory of a
+// manifest checks it without this tool. Paths in a manifest are slash-separated and relative to the
+// directory of the manifest.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/internal/ctxio"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// FileName is the name of every manifest file.
+const FileName = "SHA256SUMS"
+
+// Mode selects which manifests a run keeps up to date.
+type Mode string
+
+const (
+	// ModeNone writes no manifests.
+	ModeNone Mode = ""
+	// ModeDirectory keeps a manifest in every directory that receives files, listing the files in it.
+	ModeDirectory Mode = "directory"
+	// ModeLibrary keeps a single manifest in the destination root, listing every file of the library.
+	ModeLibrary Mode = "library"
+)
+
+// ParseMode converts a CLI value into a Mode. "none" and the empty string are ModeNone.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ModeNone, "none":
+		return ModeNone, nil
+	case ModeDirectory, ModeLibrary:
+		return m, nil
+	default:
+		return ModeNone, fmt.Errorf("invalid manifest mode %q (want none, directory or library)", s)
+	}
+}
+
+// ErrMismatch is reported for a file whose content does not match its manifest entry.
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Entry is one line of a manifest.
+type Entry struct {
+	// SHA256 is the hex-encoded SHA-256 of the file.
+	SHA256 string
+	// Path is slash-separated and relative to the directory of the manifest.
+	Path string
+}
+
+// Parse reads the entries of a manifest. Lines may mark binary mode ("hash *name") and escape
+// backslashes and newlines in names the way sha256sum does.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, `\`)
+		if escaped {
+			line = line[1:]
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 2*sha256.Size || !isHex(sum) || name == "" || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("line %d: not a SHA-256 manifest line", n)
+		}
+		name = name[1:]
+		if escaped {
+			name = unescape(name)
+		}
+		entries = append(entries, Entry{SHA256: strings.ToLower(sum), Path: name})
+	}
+	return entries, sc.Err()
+}
+
+// Write writes entries sorted by path.
+func Write(w io.Writer, entries []Entry) error {
+	sorted := append([]Entry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	bw := bufio.NewWriter(w)
+	for _, e := range sorted {
+		name := e.Path
+		if strings.ContainsAny(name, "\\\n") {
+			bw.WriteString(`\`)
+			name = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name)
+		}
+		fmt.Fprintf(bw, "%s  %s\n", e.SHA256, name)
+	}
+	return bw.Flush()
+}
+
+// Update adds files, a map of file path to hex-encoded SHA-256, to the manifests of the library at
+// root in fsys (nil means the local filesystem). Existing entries of other files are kept; the entry
+// of a file listed again is replaced. Files outside root are ignored.
+func Update(fsys destfs.FS, root string, mode Mode, files map[string]string) error {
+	if mode == ModeNone || len(files) == 0 {
+		return nil
+	}
+	fsys = destfs.OrOS(fsys)
+
+	// Entries by manifest path.
+	updates := make(map[string][]Entry)
+	for file, sum := range files {
+		dir := root
+		if mode == ModeDirectory {
+			dir = filepath.Dir(file)
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		manifestPath := filepath.Join(dir, FileName)
+		updates[manifestPath] = append(updates[manifestPath], Entry{SHA256: sum, Path: filepath.ToSlash(rel)})
+	}
+
+	var errs []error
+	for manifestPath, added := range updates {
+		if err := update(fsys, manifestPath, added); err != nil {
+			errs = append(errs, fmt.Errorf("update manifest %s: %w", manifestPath, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func update(fsys destfs.FS, manifestPath string, added []Entry) error {
+	existing, err := readManifest(fsys, manifestPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	byPath := make(map[string]Entry, len(existing)+len(added))
+	for _, e := range existing {
+		byPath[e.Path] = e
+	}
+	for _, e := range added {
+		byPath[e.Path] = e
+	}
+	entries := make([]Entry, 0, len(byPath))
+	for _, e := range byPath {
+		entries = append(entries, e)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		return err
+	}
+	f, err := fsys.OpenFile(manifestPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readManifest(fsys destfs.FS, manifestPath string) ([]Entry, error) {
+	f, err := fsys.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Problem is a manifest entry that failed verification.
+type Problem struct {
+	// Manifest is the path of the manifest listing the file.
+	Manifest string
+	// Path is the path of the file.
+	Path string
+	// Err wraps ErrMismatch, fs.ErrNotExist or the error reading the file.
+	Err error
+}
+
+// Report is the outcome of Verify.
+type Report struct {
+	// Manifests is the number of manifests found.
+	Manifests int
+	// Checked is the number of entries verified.
+	Checked int
+	// Problems lists the entries that failed, in the order they were checked.
+	Problems []Problem
+}
+
+// Verify checks every file listed in the manifests found under root in fsys (nil means the local
+// filesystem). A manifest that cannot be read or parsed aborts the verification.
+func Verify(ctx context.Context, fsys destfs.FS, root string) (Report, error) {
+	fsys = destfs.OrOS(fsys)
+	var manifests []string
+	err := fs.WalkDir(destfs.DirFS(fsys, root), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == FileName {
+			manifests = append(manifests, p)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Manifests: len(manifests)}
+	for _, m := range manifests {
+		manifestPath := filepath.Join(root, filepath.FromSlash(m))
+		entries, err := readManifest(fsys, manifestPath)
+		if err != nil {
+			return report, fmt.Errorf("read manifest %s: %w", manifestPath, err)
+		}
+		dir := path.Dir(m)
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			file := filepath.Join(root, filepath.FromSlash(path.Join(dir, e.Path)))
+			report.Checked++
+			sum, err := fileSHA256(ctx, fsys, file)
+			if err == nil && sum != e.SHA256 {
+				err = fmt.Errorf("%w: want %s, got %s", ErrMismatch, e.SHA256, sum)
+			}
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return report, ctxErr
+				}
+				report.Problems = append(report.Problems, Problem{Manifest: manifestPath, Path: file, Err: err})
+			}
+		}
+	}
+	return report, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the file at name.
+func fileSHA256(ctx context.Context, fsys destfs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, f)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	for in, want := range map[string]Mode{"": ModeNone, "none": ModeNone, "Directory": ModeDirectory, " library ": ModeLibrary} {
+		got, err := ParseMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseMode("file"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
+
+func TestWriteAndParse(t *testing.T) {
+	entries := []Entry{
+		{SHA256: sum("b"), Path: "2024/01/b.jpg"},
+		{SHA256: sum("a"), Path: `odd\name` + "\n.jpg"},
+		{SHA256: sum("c"), Path: "a b.jpg"},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	if want := sum("b") + "  2024/01/b.jpg\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected line %q in:\n%s", want, buf.String())
+	}
+
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Entry{entries[0], entries[2], entries[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Binary mode, as written by sha256sum -b.
+	got, err = Parse(strings.NewReader(strings.ToUpper(sum("a")) + " *a.jpg\r\n"))
+	if err != nil || len(got) != 1 || got[0] != (Entry{SHA256: sum("a"), Path: "a.jpg"}) {
+		t.Errorf("binary mode: got %q, %v", got, err)
+	}
+	if _, err := Parse(strings.NewReader("abc  a.jpg\n")); err == nil {
+		t.Errorf("expected an error for a malformed line")
+	}
+}
+
+func TestUpdateAndVerify(t *testing.T) {
+	for _, mode := range []Mode{ModeDirectory, ModeLibrary} {
+		t.Run(string(mode), func(t *testing.T) {
+			root := t.TempDir()
+			files := map[string]string{}
+			for _, rel := range []string{"2024/01/02/a.jpg", "2024/01/02/b.jpg", "2024/03/04/c.jpg"} {
+				files[writeFile(t, root, rel, rel)] = sum(rel)
+			}
+			if err := Update(nil, root, mode, files); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			// A later run adds a file to an existing manifest.
+			d := writeFile(t, root, "2024/01/02/d.jpg", "d")
+			if err := Update(nil, root, mode, map[string]string{d: sum("d")}); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			manifest := filepath.Join(root, "2024", "01", "02", FileName)
+			if mode == ModeLibrary {
+				manifest = filepath.Join(root, FileName)
+			}
+			b, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(string(b), "\n"); (mode == ModeDirectory && n != 3) || (mode == ModeLibrary && n != 4) {
+				t.Errorf("unexpected manifest:\n%s", b)
+			}
+
+			report, err := Verify(context.Background(), nil, root)
+			if err != nil || report.Checked != 4 || len(report.Problems) != 0 {
+				t.Fatalf("Verify = %+v, %v", report, err)
+			}
+
+			writeFile(t, root, "2024/01/02/a.jpg", "bit rot")
+			if err := os.Remove(filepath.Join(root, "2024", "03", "04", "c.jpg")); err != nil {
+				t.Fatal(err)
+			}
+			report, err = Verify(context.Background(), nil, root)
+			if err != nil || len(report.Problems) != 2 {
+				t.Fatalf("Verify = %+v, %v", report, err)
+			}
+			if !errors.Is(report.Problems[0].Err, ErrMismatch) || !errors.Is(report.Problems[1].Err, fs.ErrNotExist) {
+				t.Errorf("unexpected problems: %+v", report.Problems)
+			}
+		})
+	}
+}
+
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func writeFile(t *testing.T, root, rel, content string) string {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,129 @@
+// Package metrics exports run statistics in the Prometheus text exposition format,
+// suitable for node_exporter's textfile collector.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Run holds the statistics of a single organize run.
+type Run struct {
+	// Command is the subcommand that produced the run (e.g. "organize").
+	Command string
+
+	// Execute is true when files were actually copied (not a dry-run).
+	Execute bool
+
+	// StartedUnix is the start time of the run in seconds since the epoch.
+	StartedUnix float64
+
+	// DurationSeconds is the wall-clock duration of the run.
+	DurationSeconds float64
+
+	// FilesProcessed is the number of media files considered.
+	FilesProcessed int
+
+	// FilesByAction counts decisions per action.
+	FilesByAction map[string]int
+
+	// BytesCopied is the number of media bytes written to the destination.
+	BytesCopied int64
+
+	// BytesSaved is the size of the files skipped because identical content is kept elsewhere.
+	BytesSaved int64
+
+	// Failures is the number of files that could not be organized.
+	Failures int
+
+	// Succeeded is false when the run aborted with an error.
+	Succeeded bool
+}
+
+// Encode writes r in the Prometheus text exposition format.
+func Encode(w io.Writer, r Run) error {
+	bw := bufio.NewWriter(w)
+	labels := fmt.Sprintf(`command=%q,mode=%q`, r.Command, mode(r.Execute))
+
+	gauge := func(name, help string, value string, extraLabels string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(bw, "%s{%s%s} %s\n", name, labels, extraLabels, value)
+	}
+
+	gauge("media_organizer_last_run_timestamp_seconds", "Start time of the last run.", formatFloat(r.StartedUnix), "")
+	gauge("media_organizer_last_run_duration_seconds", "Duration of the last run.", formatFloat(r.DurationSeconds), "")
+	gauge("media_organizer_last_run_success", "Whether the last run completed without aborting.", boolValue(r.Succeeded), "")
+	gauge("media_organizer_last_run_files_processed", "Media files considered by the last run.", fmt.Sprint(r.FilesProcessed), "")
+	gauge("media_organizer_last_run_bytes_copied", "Media bytes copied by the last run.", fmt.Sprint(r.BytesCopied), "")
+	gauge("media_organizer_last_run_bytes_saved", "Bytes of duplicate files the last run skipped.", fmt.Sprint(r.BytesSaved), "")
+	gauge("media_organizer_last_run_failures", "Files that failed in the last run.", fmt.Sprint(r.Failures), "")
+
+	actions := make([]string, 0, len(r.FilesByAction))
+	for a := range r.FilesByAction {
+		actions = append(actions, a)
+	}
+	sort.Strings(actions)
+
+	const name = "media_organizer_last_run_files"
+	fmt.Fprintf(bw, "# HELP %s Files per decision action in the last run.\n", name)
+	fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+	for _, a := range actions {
+		fmt.Fprintf(bw, "%s{%s,action=%q} %d\n", name, labels, a, r.FilesByAction[a])
+	}
+
+	return bw.Flush()
+}
+
+// WriteTextfile atomically writes r to path.
+//
+// The file is written to a temporary file in the same directory and renamed into place,
+// so the textfile collector never reads a partially written file.
+func WriteTextfile(path string, r Run) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("create metrics file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := Encode(tmp, r); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write metrics file: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("chmod metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close metrics file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("rename metrics file: %w", err)
+	}
+	return nil
+}
+
+func mode(execute bool) string {
+	if execute {
+		return "execute"
+	}
+	return "dry-run"
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncode_WritesGaugesPerAction(t *testing.T) {
+	run := Run{
+		Command:         "organize",
+		Execute:         true,
+		StartedUnix:     1700000000.5,
+		DurationSeconds: 1.25,
+		FilesProcessed:  3,
+		FilesByAction:   map[string]int{"copied": 2, "failed": 1},
+		BytesCopied:     42,
+		BytesSaved:      7,
+		Failures:        1,
+		Succeeded:       true,
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, run); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		`media_organizer_last_run_timestamp_seconds{command="organize",mode="execute"} 1700000000.5`,
+		`media_organizer_last_run_bytes_copied{command="organize",mode="execute"} 42`,
+		`media_organizer_last_run_bytes_saved{command="organize",mode="execute"} 7`,
+		`media_organizer_last_run_success{command="organize",mode="execute"} 1`,
+		`media_organizer_last_run_files{command="organize",mode="execute",action="copied"} 2`,
+		`media_organizer_last_run_files{command="organize",mode="execute",action="failed"} 1`,
+		"# TYPE media_organizer_last_run_failures gauge",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteTextfile_ReplacesAtomically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "media_organizer.prom")
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteTextfile(path, Run{Command: "organize"}); err != nil {
+		t.Fatalf("WriteTextfile: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "media_organizer_last_run_success") {
+		t.Fatalf("unexpected metrics file content: %q", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary files to be cleaned up, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,276 @@
+// Package motionphoto detects motion photos, JPEGs with a short MP4 video appended to them, and extracts
+// their video.
+//
+// Two formats are recognized: the Google format (MVIMG_*.jpg and PXL_*.MP.jpg of Pixel phones, and
+// recent Samsung phones), whose XMP metadata records the length of the video at the end of the file,
+// and the trailer Samsung phones append to their JPEGs, whose MotionPhoto_Data entry holds the video.
+package motionphoto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+// Policy controls what happens to motion photos when organizing.
+type Policy string
+
+const (
+	// PolicyKeep organizes motion photos as they are, video included.
+	PolicyKeep Policy = "keep"
+	// PolicyExtract also writes the video of each motion photo next to it as a companion .mp4.
+	// The photo itself is still copied intact.
+	PolicyExtract Policy = "extract"
+)
+
+// ParsePolicy converts a CLI value into a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PolicyKeep, PolicyExtract:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid motion photo policy %q (want keep or extract)", s)
+	}
+}
+
+// ErrNoVideo is returned by Video for a file that is not a motion photo.
+var ErrNoVideo = errors.New("no embedded video")
+
+// IsCandidate reports whether the file name is a JPEG, the only format motion photos use.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// Detect reports whether the JPEG read from r is a motion photo. When r is an io.ReaderAt and an
+// io.Seeker, such as an *os.File, only the XMP segment and the end of the file are read; other readers
+// are read to the end.
+func Detect(r io.Reader) (bool, error) {
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return false, err
+	}
+	_, _, ok, err := locate(ra, size)
+	return ok, err
+}
+
+// Video returns the embedded video of the motion photo data. It has the signature of plan.Operation's
+// Transform, so the video can be written by copying the photo.
+func Video(data []byte) ([]byte, error) {
+	start, end, ok, err := locate(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoVideo
+	}
+	return data[start:end], nil
+}
+
+// CompanionPath returns where the video of a motion photo placed at photo goes: next to it, with the
+// extension replaced by .mp4.
+func CompanionPath(photo string) string {
+	return strings.TrimSuffix(photo, filepath.Ext(photo)) + ".mp4"
+}
+
+// readerAt returns r as an io.ReaderAt together with its size, reading r into memory when it cannot
+// be read at an offset.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if s, ok := r.(io.Seeker); ok {
+			if size, err := s.Seek(0, io.SeekEnd); err == nil {
+				return ra, size, nil
+			}
+		}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// readAt fills p from r at off. A file shorter than off+len(p) reports io.ErrUnexpectedEOF.
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// locate returns the byte range of the video embedded in the JPEG of size bytes read from r.
+func locate(r io.ReaderAt, size int64) (start, end int64, ok bool, err error) {
+	var soi [2]byte
+	if size < 4 || readAt(r, soi[:], 0) != nil || soi != [2]byte{0xFF, jpegseg.SOI} {
+		return 0, 0, false, nil
+	}
+	xmp, err := readXMP(r, size)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if length, found := xmpVideoLength(xmp); found && length > 0 && length < size {
+		if ok, err := isMP4(r, size-length, size); ok || err != nil {
+			return size - length, size, ok, err
+		}
+	}
+	return samsungVideo(r, size)
+}
+
+var (
+	// microVideoOffset is the offset of the video from the end of the file in the older Google format.
+	microVideoOffset = regexp.MustCompile(`GCamera:MicroVideoOffset="(\d+)"`)
+	// containerItem is an item of the container directory of the current Google format.
+	containerItem = regexp.MustCompile(`<Container:Item\b[^>]*>`)
+	itemLength    = regexp.MustCompile(`Item:Length="(\d+)"`)
+)
+
+// xmpVideoLength returns the length of the video at the end of the file recorded in the XMP packet.
+func xmpVideoLength(xmp []byte) (int64, bool) {
+	if xmp == nil {
+		return 0, false
+	}
+	if m := microVideoOffset.FindSubmatch(xmp); m != nil {
+		n, err := strconv.ParseInt(string(m[1]), 10, 64)
+		return n, err == nil
+	}
+	for _, item := range containerItem.FindAll(xmp, -1) {
+		if !bytes.Contains(item, []byte(`Item:Semantic="MotionPhoto"`)) {
+			continue
+		}
+		if m := itemLength.FindSubmatch(item); m != nil {
+			n, err := strconv.ParseInt(string(m[1]), 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+// readXMP returns the XMP packet of the JPEG of size bytes read from r, or nil. Only the segments
+// before the image data are searched, and of them only the payload of the XMP segment is read.
+func readXMP(r io.ReaderAt, size int64) ([]byte, error) {
+	segs, err := jpegseg.NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, ignoreMalformed(err)
+	}
+	ns := jpegseg.XMPNamespace
+	for {
+		seg, err := segs.Next()
+		if err != nil {
+			return nil, ignoreMalformed(err)
+		}
+		payload := seg.End - seg.Offset - 4
+		if seg.Marker != jpegseg.APP1 || payload < int64(len(ns)) || seg.End > size {
+			continue
+		}
+		prefix := make([]byte, len(ns))
+		if err := readAt(r, prefix, seg.Offset+4); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(prefix, ns) {
+			continue
+		}
+		packet := make([]byte, payload-int64(len(ns)))
+		if err := readAt(r, packet, seg.Offset+4+int64(len(ns))); err != nil {
+			return nil, err
+		}
+		return packet, nil
+	}
+}
+
+// ignoreMalformed drops the errors of data that is not a well-formed JPEG, which has no XMP packet.
+func ignoreMalformed(err error) error {
+	if err == io.EOF || errors.Is(err, jpegseg.ErrNotJPEG) || errors.Is(err, jpegseg.ErrMalformed) {
+		return nil
+	}
+	return err
+}
+
+// samsungVideoName names the entry of the Samsung trailer holding the video.
+const samsungVideoName = "MotionPhoto_Data"
+
+// maxSamsungDirectory bounds the directory of a Samsung trailer, which holds a few entries.
+const maxSamsungDirectory = 1 << 16
+
+// samsungVideo returns the range of the MotionPhoto_Data entry of the Samsung trailer of the file of
+// size bytes read from r.
+//
+// The trailer ends with a directory: "SEFH", a version, the entry count and 12 bytes per entry
+// (2 bytes padding, 2 bytes type, the distance from the directory back to the entry's data and the
+// data length), followed by the directory length and "SEFT". Each entry's data starts with 2 bytes
+// padding, 2 bytes type and the length of the name that precedes the payload. Numbers are little-endian.
+func samsungVideo(r io.ReaderAt, size int64) (start, end int64, ok bool, err error) {
+	var tail [8]byte
+	if size < 8 {
+		return 0, 0, false, nil
+	}
+	if err := readAt(r, tail[:], size-8); err != nil {
+		return 0, 0, false, err
+	}
+	le := binary.LittleEndian
+	dirLen := int64(le.Uint32(tail[:]))
+	dir := size - 8 - dirLen
+	if string(tail[4:]) != "SEFT" || dir < 0 || dirLen < 12 || dirLen > maxSamsungDirectory {
+		return 0, 0, false, nil
+	}
+	directory := make([]byte, dirLen)
+	if err := readAt(r, directory, dir); err != nil {
+		return 0, 0, false, err
+	}
+	if string(directory[:4]) != "SEFH" {
+		return 0, 0, false, nil
+	}
+	count := int(le.Uint32(directory[8:]))
+	for i := 0; i < count; i++ {
+		entry := 12 + 12*i
+		if entry+12 > len(directory) {
+			return 0, 0, false, nil
+		}
+		blockStart := dir - int64(le.Uint32(directory[entry+4:]))
+		blockEnd := blockStart + int64(le.Uint32(directory[entry+8:]))
+		if blockStart < 0 || blockEnd > dir || blockStart+8 > blockEnd {
+			continue
+		}
+		var head [8 + len(samsungVideoName)]byte
+		if blockStart+int64(len(head)) > blockEnd {
+			continue
+		}
+		if err := readAt(r, head[:], blockStart); err != nil {
+			return 0, 0, false, err
+		}
+		if le.Uint32(head[4:]) != uint32(len(samsungVideoName)) || string(head[8:]) != samsungVideoName {
+			continue
+		}
+		nameEnd := blockStart + int64(len(head))
+		if ok, err := isMP4(r, nameEnd, blockEnd); ok || err != nil {
+			return nameEnd, blockEnd, ok, err
+		}
+	}
+	return 0, 0, false, nil
+}
+
+// isMP4 reports whether the bytes of r from start to end start with the ftyp box of an MP4 file.
+func isMP4(r io.ReaderAt, start, end int64) (bool, error) {
+	var box [8]byte
+	if end-start < int64(len(box)) {
+		return false, nil
+	}
+	if err := readAt(r, box[:], start); err != nil {
+		return false, err
+	}
+	return string(box[4:]) == "ftyp", nil
+}
@@ -0,0 +1,154 @@
+package motionphoto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+// video is a stand-in for an MP4 file: an ftyp box and some payload.
+var video = append([]byte("\x00\x00\x00\x14ftypmp42\x00\x00\x00\x00mp42"), bytes.Repeat([]byte{0x42}, 64)...)
+
+func TestVideo(t *testing.T) {
+	tests := map[string][]byte{
+		"micro video": withXMP(fmt.Sprintf(`<rdf:Description GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d"/>`, len(video)), video),
+		"container": withXMP(fmt.Sprintf(`<Container:Directory><rdf:Seq>`+
+			`<rdf:li><Container:Item Item:Mime="image/jpeg" Item:Semantic="Primary" Item:Length="0"/></rdf:li>`+
+			`<rdf:li><Container:Item Item:Mime="video/mp4" Item:Semantic="MotionPhoto" Item:Length="%d"/></rdf:li>`+
+			`</rdf:Seq></Container:Directory>`, len(video)), video),
+		"samsung": withSamsungTrailer(withXMP("", nil), video),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Video(data)
+			if err != nil {
+				t.Fatalf("Video: %v", err)
+			}
+			if !bytes.Equal(got, video) {
+				t.Errorf("got %q, want the video", got)
+			}
+			if ok, err := Detect(bytes.NewReader(data)); !ok || err != nil {
+				t.Errorf("Detect = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestVideo_PlainJPEG(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"no xmp":          withXMP("", nil),
+		"offset mismatch": withXMP(`GCamera:MicroVideoOffset="20"`, video),
+		"not a jpeg":      video,
+	} {
+		if _, err := Video(data); !errors.Is(err, ErrNoVideo) {
+			t.Errorf("%s: expected ErrNoVideo, got %v", name, err)
+		}
+		if ok, err := Detect(bytes.NewReader(data)); ok || err != nil {
+			t.Errorf("%s: Detect = %v, %v", name, ok, err)
+		}
+	}
+}
+
+func TestCompanionPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"PXL_20240102_030405123.MP.jpg": "PXL_20240102_030405123.MP.mp4",
+		"MVIMG_20190102_030405.jpg":     "MVIMG_20190102_030405.mp4",
+		"20240102_030405_1.JPEG":        "20240102_030405_1.mp4",
+	} {
+		if got := CompanionPath(filepath.Join("lib", in)); got != filepath.Join("lib", want) {
+			t.Errorf("CompanionPath(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, in := range []string{"keep", " Extract "} {
+		if _, err := ParsePolicy(in); err != nil {
+			t.Errorf("ParsePolicy(%q): %v", in, err)
+		}
+	}
+	if _, err := ParsePolicy("strip"); err == nil {
+		t.Errorf("expected an error for an unknown policy")
+	}
+}
+
+func TestDetect_ReadsOnlyXMPAndTrailer(t *testing.T) {
+	bigVideo := append(append([]byte(nil), video[:16]...), make([]byte, 1<<20)...)
+	exif := append([]byte("Exif\x00\x00"), make([]byte, 60000)...)
+	exifSegment := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(exif)+2))
+	exifSegment = append(exifSegment, exif...)
+	withEXIF := func(jpeg []byte) []byte {
+		return append(append(append([]byte(nil), jpeg[:2]...), exifSegment...), jpeg[2:]...)
+	}
+
+	for name, data := range map[string][]byte{
+		"micro video": withEXIF(withXMP(fmt.Sprintf(`GCamera:MicroVideoOffset="%d"`, len(bigVideo)), bigVideo)),
+		"samsung":     withSamsungTrailer(withEXIF(withXMP("", nil)), bigVideo),
+	} {
+		r := &countingReader{Reader: bytes.NewReader(data)}
+		if ok, err := Detect(r); !ok || err != nil {
+			t.Fatalf("%s: Detect = %v, %v", name, ok, err)
+		}
+		if r.n > 1024 {
+			t.Errorf("%s: Detect read %d of %d bytes", name, r.n, len(data))
+		}
+	}
+}
+
+// countingReader counts the bytes read from a bytes.Reader.
+type countingReader struct {
+	*bytes.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.n += n
+	return n, err
+}
+
+// withXMP returns a minimal JPEG with the XMP packet xmp, followed by trailer.
+func withXMP(xmp string, trailer []byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	if xmp != "" {
+		segment := append(append([]byte(nil), jpegseg.XMPNamespace...), xmp...)
+		data = append(data, 0xFF, 0xE1)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(segment)+2))
+		data = append(data, segment...)
+	}
+	data = append(data, 0xFF, 0xDA, 0x00, 0x02, 0x01, 0x02, 0xFF, 0xD9)
+	return append(data, trailer...)
+}
+
+// withSamsungTrailer appends a Samsung trailer holding video as its MotionPhoto_Data entry.
+func withSamsungTrailer(jpeg, video []byte) []byte {
+	le := binary.LittleEndian
+	const name = "MotionPhoto_Data"
+	block := le.AppendUint16(nil, 0)
+	block = le.AppendUint16(block, 0x0a30)
+	block = le.AppendUint32(block, uint32(len(name)))
+	block = append(append(block, name...), video...)
+
+	data := append(append([]byte(nil), jpeg...), block...)
+	dir := []byte("SEFH")
+	dir = le.AppendUint32(dir, 106)
+	dir = le.AppendUint32(dir, 1)
+	dir = le.AppendUint16(dir, 0)
+	dir = le.AppendUint16(dir, 0x0a30)
+	dir = le.AppendUint32(dir, uint32(len(block)))
+	dir = le.AppendUint32(dir, uint32(len(block)))
+	data = append(data, dir...)
+	data = le.AppendUint32(data, uint32(len(dir)))
+	return append(data, "SEFT"...)
+}
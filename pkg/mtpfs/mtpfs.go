@@ -0,0 +1,421 @@
+// Package mtpfs implements a read-only destfs.FS over PTP/MTP, so cameras and phones plugged in over USB,
+// which do not mount as filesystems on Linux, can be used as a source directly:
+//
+//	media-organizer organize 'mtp:///Internal shared storage/DCIM' /library
+//
+// The first path element is the storage as the device names it (for example "Internal shared storage"
+// or "SD card"); the rest is the path within the storage. The host selects the device by serial number
+// or USB port (for example "1-2") and may be empty when a single device is connected.
+//
+// Devices are accessed through the Linux usbfs (/dev/bus/usb); no libusb is needed.
+package mtpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// Scheme and PTPScheme are the URL schemes handled by this package. MTP extends PTP, so both
+// reach the same devices.
+const (
+	Scheme    = "mtp"
+	PTPScheme = "ptp"
+)
+
+// Options configures the USB connection.
+type Options struct {
+	// Timeout limits every USB transfer.
+	Timeout time.Duration
+}
+
+// DefaultOptions returns the default connection options.
+func DefaultOptions() Options {
+	return Options{Timeout: 10 * time.Second}
+}
+
+// errReadOnly is returned for every write; devices are only read.
+var errReadOnly = fmt.Errorf("mtp: device is read-only: %w", fs.ErrPermission)
+
+// readChunk is the amount of object data fetched per transaction.
+const readChunk = 256 << 10
+
+// FS is an opened PTP/MTP device. Names are absolute paths whose first element is a storage.
+// It is safe for concurrent use; transactions are serialized.
+type FS struct {
+	mu     sync.Mutex
+	s      session
+	ops    map[uint16]bool
+	model  string
+	root   *node
+	closed bool
+}
+
+var _ destfs.FS = (*FS)(nil)
+
+// node is a storage, directory or file of the device.
+type node struct {
+	name    string
+	storage uint32
+	handle  uint32 // zero for the root and storages
+	dir     bool
+	size    int64
+	modTime time.Time
+
+	// children is filled when the directory is first listed.
+	children []*node
+	listed   bool
+}
+
+// Dial opens the device selected by the host of an mtp:// or ptp:// URL. ctx bounds opening the device.
+func Dial(ctx context.Context, u *url.URL, opts Options) (*FS, error) {
+	if u.Scheme != Scheme && u.Scheme != PTPScheme {
+		return nil, fmt.Errorf("mtp: unsupported scheme %q", u.Scheme)
+	}
+	t, err := openDevice(ctx, u.Host, opts)
+	if err != nil {
+		return nil, err
+	}
+	f, err := New(t)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// New opens a session on the device behind t and lists its storages.
+func New(t Transport) (*FS, error) {
+	f := &FS{s: session{t: t}, root: &node{name: "/", dir: true, listed: true}}
+	// OpenSession is the first transaction of a session.
+	var respErr *ResponseError
+	if _, _, err := f.s.do(opOpenSession, 1); err != nil && !(errors.As(err, &respErr) && respErr.Code == respSessionOpen) {
+		return nil, fmt.Errorf("mtp: open session: %w", err)
+	}
+	data, _, err := f.s.do(opGetDeviceInfo)
+	if err != nil {
+		return nil, fmt.Errorf("mtp: get device info: %w", err)
+	}
+	info, err := parseDeviceInfo(data)
+	if err != nil {
+		return nil, fmt.Errorf("mtp: device info: %w", err)
+	}
+	f.ops, f.model = info.Operations, info.Model
+
+	data, _, err = f.s.do(opGetStorageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("mtp: list storages: %w", err)
+	}
+	d := dataset{b: data}
+	ids := d.u32s()
+	if d.err != nil {
+		return nil, fmt.Errorf("mtp: list storages: %w", d.err)
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		// A logical storage ID of zero is a slot without media, such as an empty card slot.
+		if id&0xFFFF == 0 {
+			continue
+		}
+		data, _, err := f.s.do(opGetStorageInfo, id)
+		if err != nil {
+			return nil, fmt.Errorf("mtp: storage %08x: %w", id, err)
+		}
+		name, err := storageDescription(data)
+		if err != nil {
+			return nil, fmt.Errorf("mtp: storage %08x: %w", id, err)
+		}
+		name = strings.ReplaceAll(strings.TrimSpace(name), "/", "_")
+		if name == "" || seen[name] {
+			name = strings.TrimSpace(fmt.Sprintf("%s %08x", name, id))
+		}
+		seen[name] = true
+		f.root.children = append(f.root.children, &node{name: name, storage: id, dir: true})
+	}
+	return f, nil
+}
+
+// Model returns the model name the device reports.
+func (f *FS) Model() string { return f.model }
+
+// Close ends the session and releases the device.
+func (f *FS) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	_, _, err := f.s.do(opCloseSession)
+	if closeErr := f.s.t.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Stat implements destfs.FS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{n}, nil
+}
+
+// Open implements destfs.FS.
+func (f *FS) Open(name string) (destfs.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if n.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	return &file{fs: f, node: n, name: name}, nil
+}
+
+// OpenFile implements destfs.FS. Only reading is supported.
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errReadOnly}
+	}
+	return f.Open(name)
+}
+
+// ReadDir implements destfs.FS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	if err := f.list(n); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(fileInfo{c}))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// MkdirAll implements destfs.FS; devices are read-only.
+func (f *FS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: errReadOnly}
+}
+
+// Remove implements destfs.FS; devices are read-only.
+func (f *FS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+// lookup returns the node of name, listing directories on the way as needed. f.mu is held.
+func (f *FS) lookup(op, name string) (*node, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrClosed}
+	}
+	n := f.root
+	for _, elem := range strings.Split(strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		if !n.dir {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if err := f.list(n); err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		var next *node
+		for _, c := range n.children {
+			if c.name == elem {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// list fills the children of the directory n. f.mu is held.
+func (f *FS) list(n *node) error {
+	if n.listed {
+		return nil
+	}
+	parent := n.handle
+	if parent == 0 {
+		parent = rootParent
+	}
+	data, _, err := f.s.do(opGetObjectHandles, n.storage, 0, parent)
+	if err != nil {
+		return err
+	}
+	d := dataset{b: data}
+	handles := d.u32s()
+	if d.err != nil {
+		return d.err
+	}
+
+	children := make([]*node, 0, len(handles))
+	for _, h := range handles {
+		data, _, err := f.s.do(opGetObjectInfo, h)
+		if err != nil {
+			return err
+		}
+		info, err := parseObjectInfo(data)
+		if err != nil {
+			return fmt.Errorf("object %08x: %w", h, err)
+		}
+		// Some devices answer with every object of the storage instead of the children of parent.
+		if info.Parent != n.handle && !(n.handle == 0 && info.Parent == rootParent) {
+			continue
+		}
+		c := &node{
+			name:    strings.ReplaceAll(info.Filename, "/", "_"),
+			storage: n.storage,
+			handle:  h,
+			dir:     info.Format == formatAssociation,
+			size:    int64(info.CompressedSize),
+		}
+		if t, ok := parseDate(info.ModificationDate); ok {
+			c.modTime = t
+		} else if t, ok := parseDate(info.CaptureDate); ok {
+			c.modTime = t
+		}
+		if !c.dir && info.CompressedSize == unknownCompressedSize {
+			// Objects of 4 GiB and more report their size as a property.
+			if c.size, err = f.objectSize(h); err != nil {
+				return fmt.Errorf("object %08x: %w", h, err)
+			}
+		}
+		children = append(children, c)
+	}
+	n.children, n.listed = children, true
+	return nil
+}
+
+// objectSize returns the 64-bit size of object h. f.mu is held.
+func (f *FS) objectSize(h uint32) (int64, error) {
+	if !f.ops[opGetObjectPropValue] {
+		return 0, errors.New("size of 4 GiB or more is not reported by the device")
+	}
+	data, _, err := f.s.do(opGetObjectPropValue, h, propObjectSize)
+	if err != nil {
+		return 0, err
+	}
+	d := dataset{b: data}
+	size := d.u64()
+	return int64(size), d.err
+}
+
+// readAt returns up to n bytes of the object of file at off. f.mu is held.
+func (f *FS) readAt(fl *file, off int64, n int) ([]byte, error) {
+	h := fl.node.handle
+	switch {
+	case off+int64(n) <= 0xFFFFFFFF && f.ops[opGetPartialObject]:
+		data, _, err := f.s.do(opGetPartialObject, h, uint32(off), uint32(n))
+		return data, err
+	case f.ops[opGetPartialObject64]:
+		data, _, err := f.s.do(opGetPartialObject64, h, uint32(off), uint32(off>>32), uint32(n))
+		return data, err
+	case off > 0xFFFFFFFF:
+		return nil, errors.New("reading beyond 4 GiB is not supported by the device")
+	}
+	// Without partial reads the whole object is transferred once.
+	if fl.whole == nil {
+		data, _, err := f.s.do(opGetObject, h)
+		if err != nil {
+			return nil, err
+		}
+		fl.whole = data
+	}
+	if off >= int64(len(fl.whole)) {
+		return nil, nil
+	}
+	return fl.whole[off:min(off+int64(n), int64(len(fl.whole)))], nil
+}
+
+// file is an opened object, read in chunks of readChunk.
+type file struct {
+	fs    *FS
+	node  *node
+	name  string
+	off   int64
+	buf   []byte
+	whole []byte
+}
+
+func (fl *file) Read(p []byte) (int, error) {
+	if len(fl.buf) == 0 {
+		if fl.off >= fl.node.size {
+			return 0, io.EOF
+		}
+		fl.fs.mu.Lock()
+		data, err := fl.fs.readAt(fl, fl.off, int(min(readChunk, fl.node.size-fl.off)))
+		fl.fs.mu.Unlock()
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: fl.name, Err: err}
+		}
+		if len(data) == 0 {
+			return 0, &fs.PathError{Op: "read", Path: fl.name, Err: io.ErrUnexpectedEOF}
+		}
+		fl.buf = data
+	}
+	n := copy(p, fl.buf)
+	fl.buf = fl.buf[n:]
+	fl.off += int64(n)
+	return n, nil
+}
+
+func (fl *file) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: fl.name, Err: errReadOnly}
+}
+
+func (fl *file) Stat() (fs.FileInfo, error) { return fileInfo{fl.node}, nil }
+
+func (fl *file) Sync() error { return nil }
+
+func (fl *file) Close() error {
+	fl.buf, fl.whole = nil, nil
+	return nil
+}
+
+// fileInfo describes a node.
+type fileInfo struct{ n *node }
+
+func (i fileInfo) Name() string       { return i.n.name }
+func (i fileInfo) Size() int64        { return i.n.size }
+func (i fileInfo) ModTime() time.Time { return i.n.modTime }
+func (i fileInfo) IsDir() bool        { return i.n.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.n.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
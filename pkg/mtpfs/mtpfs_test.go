@@ -0,0 +1,292 @@
+package mtpfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// fakeObject is an object of fakeDevice.
+type fakeObject struct {
+	parent   uint32
+	name     string
+	dir      bool
+	data     []byte
+	modified string
+}
+
+// fakeDevice is a PTP responder with one storage, answering in transfers of at most packet bytes.
+type fakeDevice struct {
+	t         *testing.T
+	ops       []uint16
+	objects   map[uint32]fakeObject
+	packet    int
+	pending   [][]byte
+	sessionOK bool
+	closed    bool
+}
+
+const fakeStorage = 0x00010001
+
+func (d *fakeDevice) Send(p []byte) error {
+	length := binary.LittleEndian.Uint32(p)
+	if int(length) != len(p) || binary.LittleEndian.Uint16(p[4:]) != containerCommand {
+		d.t.Fatalf("unexpected container % x", p)
+	}
+	code := binary.LittleEndian.Uint16(p[6:])
+	tid := binary.LittleEndian.Uint32(p[8:])
+	var params []uint32
+	for b := p[containerHeaderSize:]; len(b) >= 4; b = b[4:] {
+		params = append(params, binary.LittleEndian.Uint32(b))
+	}
+
+	var data []byte
+	resp := uint16(respOK)
+	switch code {
+	case opOpenSession:
+		d.sessionOK = true
+	case opCloseSession:
+		d.sessionOK = false
+	case opGetDeviceInfo:
+		data = d.deviceInfo()
+	case opGetStorageIDs:
+		// The second storage is an empty card slot.
+		data = appendU32s(nil, fakeStorage, 0x00020000)
+	case opGetStorageInfo:
+		data = make([]byte, 2+2+2+8+8+4)
+		data = appendString(data, "Internal shared storage")
+		data = appendString(data, "")
+	case opGetObjectHandles:
+		var handles []uint32
+		for h, o := range d.objects {
+			if o.parent == params[2] || (params[2] == rootParent && o.parent == 0) {
+				handles = append(handles, h)
+			}
+		}
+		data = appendU32s(nil, handles...)
+	case opGetObjectInfo:
+		o := d.objects[params[0]]
+		format := uint16(0x3801)
+		if o.dir {
+			format = formatAssociation
+		}
+		data = binary.LittleEndian.AppendUint32(nil, fakeStorage)
+		data = binary.LittleEndian.AppendUint16(data, format)
+		data = binary.LittleEndian.AppendUint16(data, 0)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(o.data)))
+		data = append(data, make([]byte, 2+4*6)...)
+		data = binary.LittleEndian.AppendUint32(data, o.parent)
+		data = append(data, make([]byte, 2+4+4)...)
+		data = appendString(data, o.name)
+		data = appendString(data, "")
+		data = appendString(data, o.modified)
+		data = appendString(data, "")
+	case opGetPartialObject, opGetPartialObject64:
+		if !d.sessionOK {
+			resp = 0x2003 // SessionNotOpen
+			break
+		}
+		o := d.objects[params[0]]
+		off, n := int(params[1]), int(params[2])
+		if code == opGetPartialObject64 {
+			off, n = int(params[1])|int(params[2])<<32, int(params[3])
+		}
+		data = o.data[min(off, len(o.data)):min(off+n, len(o.data))]
+	case opGetObject:
+		data = d.objects[params[0]].data
+	default:
+		resp = 0x2005 // OperationNotSupported
+	}
+
+	if data != nil {
+		d.queue(containerData, code, tid, data)
+	}
+	d.queue(containerResponse, resp, tid, nil)
+	return nil
+}
+
+// queue splits a container into transfers the way a device with packet-sized transfers would.
+func (d *fakeDevice) queue(typ, code uint16, tid uint32, payload []byte) {
+	c := binary.LittleEndian.AppendUint32(nil, uint32(containerHeaderSize+len(payload)))
+	c = binary.LittleEndian.AppendUint16(c, typ)
+	c = binary.LittleEndian.AppendUint16(c, code)
+	c = binary.LittleEndian.AppendUint32(c, tid)
+	c = append(c, payload...)
+	for len(c) > 0 {
+		n := min(len(c), d.packet)
+		d.pending = append(d.pending, c[:n])
+		c = c[n:]
+	}
+	if (containerHeaderSize+len(payload))%d.packet == 0 {
+		d.pending = append(d.pending, nil)
+	}
+}
+
+func (d *fakeDevice) Receive(p []byte) (int, error) {
+	if len(d.pending) == 0 {
+		return 0, errors.New("nothing to receive")
+	}
+	n := copy(p, d.pending[0])
+	d.pending = d.pending[1:]
+	return n, nil
+}
+
+func (d *fakeDevice) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *fakeDevice) deviceInfo() []byte {
+	b := binary.LittleEndian.AppendUint16(nil, 100)
+	b = binary.LittleEndian.AppendUint32(b, 6)
+	b = binary.LittleEndian.AppendUint16(b, 100)
+	b = appendString(b, "microsoft.com: 1.0;")
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(d.ops)))
+	for _, op := range d.ops {
+		b = binary.LittleEndian.AppendUint16(b, op)
+	}
+	for range 4 {
+		b = binary.LittleEndian.AppendUint32(b, 0)
+	}
+	b = appendString(b, "Acme")
+	b = appendString(b, "Pixel Test")
+	b = appendString(b, "1.0")
+	return appendString(b, "ABC123")
+}
+
+func appendU32s(b []byte, vs ...uint32) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(vs)))
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// appendString encodes s as a PTP string.
+func appendString(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, 0)
+	}
+	chars := append(utf16.Encode([]rune(s)), 0)
+	b = append(b, byte(len(chars)))
+	for _, c := range chars {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func newFakeDevice(t *testing.T, ops ...uint16) *fakeDevice {
+	photo := bytes.Repeat([]byte("jpeg"), 200_000)
+	return &fakeDevice{
+		t:      t,
+		ops:    ops,
+		packet: 512,
+		objects: map[uint32]fakeObject{
+			1: {parent: 0, name: "DCIM", dir: true},
+			2: {parent: 1, name: "Camera", dir: true},
+			3: {parent: 2, name: "IMG_20240102_030405.jpg", data: photo, modified: "20240102T030405"},
+			4: {parent: 2, name: "VID_20240103_101112.mp4", data: []byte("mp4"), modified: "20240103T101112.0Z"},
+		},
+	}
+}
+
+func TestFS_ListStatAndRead(t *testing.T) {
+	dev := newFakeDevice(t, opGetDeviceInfo, opOpenSession, opGetObjectHandles, opGetObjectInfo, opGetObject, opGetPartialObject)
+	f, err := New(dev)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if f.Model() != "Pixel Test" {
+		t.Errorf("got model %q", f.Model())
+	}
+
+	entries, err := f.ReadDir("/")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "Internal shared storage" || !entries[0].IsDir() {
+		t.Fatalf("ReadDir(/) = %v, %v", entries, err)
+	}
+	entries, err = f.ReadDir("/Internal shared storage/DCIM/Camera")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "IMG_20240102_030405.jpg" {
+		t.Fatalf("ReadDir(Camera) = %v, %v", entries, err)
+	}
+
+	info, err := f.Stat("/Internal shared storage/DCIM/Camera/VID_20240103_101112.mp4")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size() != 3 || !info.ModTime().Equal(time.Date(2024, 1, 3, 10, 11, 12, 0, time.UTC)) {
+		t.Errorf("got size %d, mtime %v", info.Size(), info.ModTime())
+	}
+	if _, err := f.Stat("/Internal shared storage/DCIM/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing file: %v", err)
+	}
+
+	file, err := f.Open("/Internal shared storage/DCIM/Camera/IMG_20240102_030405.jpg")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || !bytes.Equal(got, dev.objects[3].data) {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+
+	if _, err := f.OpenFile("/Internal shared storage/new.jpg", os.O_WRONLY|os.O_CREATE, 0o644); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("OpenFile for writing: %v", err)
+	}
+	if err := f.Close(); err != nil || !dev.closed || dev.sessionOK {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestFS_ReadWithoutPartialObjects(t *testing.T) {
+	dev := newFakeDevice(t, opGetDeviceInfo, opOpenSession, opGetObjectHandles, opGetObjectInfo, opGetObject)
+	f, err := New(dev)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	file, err := f.Open("/Internal shared storage/DCIM/Camera/IMG_20240102_030405.jpg")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, err := io.ReadAll(file)
+	if err != nil || !bytes.Equal(got, dev.objects[3].data) {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"20240102T030405", time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local), true},
+		{"20240102T030405.0Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), true},
+		{"20240102T030405+0100", time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC), true},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	} {
+		got, ok := parseDate(tt.in)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	dev := newFakeDevice(t, opGetDeviceInfo)
+	s := session{t: dev}
+	_, _, err := s.do(0x9999)
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Code != 0x2005 || !strings.Contains(err.Error(), "0x9999") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,332 @@
+package mtpfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Transport carries PTP containers over the bulk endpoints of a USB device.
+type Transport interface {
+	// Send writes p to the bulk-out endpoint as one transfer.
+	Send(p []byte) error
+
+	// Receive reads one transfer from the bulk-in endpoint into p. Zero-length transfers are allowed.
+	Receive(p []byte) (int, error)
+
+	Close() error
+}
+
+// Container types.
+const (
+	containerCommand  = 1
+	containerData     = 2
+	containerResponse = 3
+)
+
+// containerHeaderSize is the size of length, type, code and transaction ID.
+const containerHeaderSize = 12
+
+// Operation codes used by this package. Codes 0x9xxx are MTP extensions.
+const (
+	opGetDeviceInfo       = 0x1001
+	opOpenSession         = 0x1002
+	opCloseSession        = 0x1003
+	opGetStorageIDs       = 0x1004
+	opGetStorageInfo      = 0x1005
+	opGetObjectHandles    = 0x1007
+	opGetObjectInfo       = 0x1008
+	opGetObject           = 0x1009
+	opGetPartialObject    = 0x101B
+	opGetObjectPropValue  = 0x9803
+	opGetPartialObject64  = 0x95C1
+	respOK                = 0x2001
+	respSessionOpen       = 0x201E
+	formatAssociation     = 0x3001
+	propObjectSize        = 0xDC04
+	rootParent            = 0xFFFFFFFF
+	unknownCompressedSize = 0xFFFFFFFF
+)
+
+// ResponseError is returned when the device answers an operation with a response code other than OK.
+type ResponseError struct {
+	Op   uint16
+	Code uint16
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("ptp: operation 0x%04x failed with response 0x%04x", e.Op, e.Code)
+}
+
+// receiveBufferSize is the size of a single bulk-in transfer.
+const receiveBufferSize = 512 << 10
+
+// session runs PTP transactions over a transport. It is not safe for concurrent use.
+type session struct {
+	t   Transport
+	tid uint32
+	buf []byte
+}
+
+// do runs the operation code with params and returns the data phase, if any, and the response parameters.
+func (s *session) do(code uint16, params ...uint32) (data []byte, resp []uint32, err error) {
+	tid := s.tid
+	s.tid++
+
+	cmd := make([]byte, containerHeaderSize, containerHeaderSize+4*len(params))
+	binary.LittleEndian.PutUint32(cmd[0:], uint32(containerHeaderSize+4*len(params)))
+	binary.LittleEndian.PutUint16(cmd[4:], containerCommand)
+	binary.LittleEndian.PutUint16(cmd[6:], code)
+	binary.LittleEndian.PutUint32(cmd[8:], tid)
+	for _, p := range params {
+		cmd = binary.LittleEndian.AppendUint32(cmd, p)
+	}
+	if err := s.t.Send(cmd); err != nil {
+		return nil, nil, fmt.Errorf("ptp: send operation 0x%04x: %w", code, err)
+	}
+
+	for {
+		typ, respCode, respTID, payload, err := s.receive()
+		if err != nil {
+			return nil, nil, fmt.Errorf("ptp: operation 0x%04x: %w", code, err)
+		}
+		if respTID != tid {
+			return nil, nil, fmt.Errorf("ptp: operation 0x%04x: got transaction %d, want %d", code, respTID, tid)
+		}
+		switch typ {
+		case containerData:
+			data = payload
+		case containerResponse:
+			if respCode != respOK {
+				return nil, nil, &ResponseError{Op: code, Code: respCode}
+			}
+			for len(payload) >= 4 {
+				resp = append(resp, binary.LittleEndian.Uint32(payload))
+				payload = payload[4:]
+			}
+			return data, resp, nil
+		default:
+			return nil, nil, fmt.Errorf("ptp: operation 0x%04x: unexpected container type %d", code, typ)
+		}
+	}
+}
+
+// receive reads one container, which may span several transfers.
+func (s *session) receive() (typ, code uint16, tid uint32, payload []byte, err error) {
+	if s.buf == nil {
+		s.buf = make([]byte, receiveBufferSize)
+	}
+	var n int
+	// A container whose length is a multiple of the packet size is followed by a zero-length transfer.
+	for n == 0 {
+		if n, err = s.t.Receive(s.buf); err != nil {
+			return 0, 0, 0, nil, err
+		}
+	}
+	if n < containerHeaderSize {
+		return 0, 0, 0, nil, fmt.Errorf("short container of %d bytes", n)
+	}
+	length := int(binary.LittleEndian.Uint32(s.buf[0:]))
+	typ = binary.LittleEndian.Uint16(s.buf[4:])
+	code = binary.LittleEndian.Uint16(s.buf[6:])
+	tid = binary.LittleEndian.Uint32(s.buf[8:])
+	if length < containerHeaderSize {
+		return 0, 0, 0, nil, fmt.Errorf("invalid container length %d", length)
+	}
+
+	payload = make([]byte, 0, length-containerHeaderSize)
+	payload = append(payload, s.buf[containerHeaderSize:min(n, length)]...)
+	for len(payload) < length-containerHeaderSize {
+		n, err := s.t.Receive(s.buf)
+		if err != nil {
+			return 0, 0, 0, nil, err
+		}
+		if n == 0 {
+			return 0, 0, 0, nil, fmt.Errorf("container truncated at %d of %d bytes", containerHeaderSize+len(payload), length)
+		}
+		payload = append(payload, s.buf[:min(n, length-containerHeaderSize-len(payload))]...)
+	}
+	return typ, code, tid, payload, nil
+}
+
+// deviceInfo is the part of the DeviceInfo dataset this package uses.
+type deviceInfo struct {
+	Model        string
+	SerialNumber string
+	Operations   map[uint16]bool
+}
+
+func parseDeviceInfo(b []byte) (deviceInfo, error) {
+	d := dataset{b: b}
+	d.u16() // StandardVersion
+	d.u32() // VendorExtensionID
+	d.u16() // VendorExtensionVersion
+	d.str() // VendorExtensionDesc
+	d.u16() // FunctionalMode
+	ops := d.u16s()
+	d.u16s() // EventsSupported
+	d.u16s() // DevicePropertiesSupported
+	d.u16s() // CaptureFormats
+	d.u16s() // ImageFormats
+	d.str()  // Manufacturer
+	info := deviceInfo{Model: d.str(), Operations: make(map[uint16]bool, len(ops))}
+	d.str() // DeviceVersion
+	info.SerialNumber = d.str()
+	for _, op := range ops {
+		info.Operations[op] = true
+	}
+	return info, d.err
+}
+
+// storageDescription returns the StorageDescription of a StorageInfo dataset.
+func storageDescription(b []byte) (string, error) {
+	d := dataset{b: b}
+	d.u16() // StorageType
+	d.u16() // FilesystemType
+	d.u16() // AccessCapability
+	d.u64() // MaxCapacity
+	d.u64() // FreeSpaceInBytes
+	d.u32() // FreeSpaceInObjects
+	return d.str(), d.err
+}
+
+// objectInfo is the part of the ObjectInfo dataset this package uses.
+type objectInfo struct {
+	Format           uint16
+	CompressedSize   uint32
+	Parent           uint32
+	Filename         string
+	CaptureDate      string
+	ModificationDate string
+}
+
+func parseObjectInfo(b []byte) (objectInfo, error) {
+	d := dataset{b: b}
+	var info objectInfo
+	d.u32() // StorageID
+	info.Format = d.u16()
+	d.u16() // ProtectionStatus
+	info.CompressedSize = d.u32()
+	d.u16() // ThumbFormat
+	d.u32() // ThumbCompressedSize
+	d.u32() // ThumbPixWidth
+	d.u32() // ThumbPixHeight
+	d.u32() // ImagePixWidth
+	d.u32() // ImagePixHeight
+	d.u32() // ImageBitDepth
+	info.Parent = d.u32()
+	d.u16() // AssociationType
+	d.u32() // AssociationDesc
+	d.u32() // SequenceNumber
+	info.Filename = d.str()
+	info.CaptureDate = d.str()
+	info.ModificationDate = d.str()
+	return info, d.err
+}
+
+// parseDate parses a PTP date such as "20240102T030405" or "20240102T030405.0+0100".
+// Dates without a zone are in the device's local time, which is assumed to be time.Local.
+func parseDate(s string) (time.Time, bool) {
+	if len(s) < 15 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("20060102T150405", s[:15], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	zone := strings.TrimLeft(s[15:], ".0123456789")
+	switch {
+	case zone == "Z":
+		t, _ = time.ParseInLocation("20060102T150405", s[:15], time.UTC)
+	case len(zone) == 5:
+		if zt, err := time.Parse("20060102T150405-0700", s[:15]+zone); err == nil {
+			t = zt
+		}
+	}
+	return t, true
+}
+
+// dataset decodes the little-endian fields of a PTP dataset. The first error sticks.
+type dataset struct {
+	b   []byte
+	err error
+}
+
+var errShortDataset = errors.New("ptp: dataset too short")
+
+func (d *dataset) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.b) < n {
+		d.err = errShortDataset
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *dataset) u16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *dataset) u32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *dataset) u64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *dataset) u16s() []uint16 {
+	n := d.u32()
+	if d.err == nil && uint64(n)*2 > uint64(len(d.b)) {
+		d.err = errShortDataset
+	}
+	var out []uint16
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		out = append(out, d.u16())
+	}
+	return out
+}
+
+func (d *dataset) u32s() []uint32 {
+	n := d.u32()
+	if d.err == nil && uint64(n)*4 > uint64(len(d.b)) {
+		d.err = errShortDataset
+	}
+	var out []uint32
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		out = append(out, d.u32())
+	}
+	return out
+}
+
+// str decodes a PTP string: a character count including the terminating NUL, then UTF-16LE characters.
+func (d *dataset) str() string {
+	var n int
+	if b := d.take(1); b != nil {
+		n = int(b[0])
+	}
+	chars := make([]uint16, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		chars = append(chars, d.u16())
+	}
+	if len(chars) > 0 && chars[len(chars)-1] == 0 {
+		chars = chars[:len(chars)-1]
+	}
+	return string(utf16.Decode(chars))
+}
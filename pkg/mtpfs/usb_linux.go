@@ -0,0 +1,246 @@
+//go:build linux
+
+package mtpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sysfsDevices lists the USB devices and interfaces known to the kernel.
+const sysfsDevices = "/sys/bus/usb/devices"
+
+// usbfs ioctl request numbers from linux/usbdevice_fs.h.
+const (
+	usbdevfsClaimInterface   = 0x8004550F // _IOR('U', 15, unsigned int)
+	usbdevfsReleaseInterface = 0x80045510 // _IOR('U', 16, unsigned int)
+	usbdevfsClearHalt        = 0x80045515 // _IOR('U', 21, unsigned int)
+)
+
+// bulkTransfer is struct usbdevfs_bulktransfer.
+type bulkTransfer struct {
+	ep      uint32
+	len     uint32
+	timeout uint32 // milliseconds
+	data    unsafe.Pointer
+}
+
+// usbdevfsBulk is _IOWR('U', 2, struct usbdevfs_bulktransfer); the size depends on the pointer size.
+var usbdevfsBulk = uintptr(0xC0005502 | unsafe.Sizeof(bulkTransfer{})<<16)
+
+// usbInterface is a PTP or MTP interface of a connected device.
+type usbInterface struct {
+	// port is the sysfs name of the device, such as "1-2" or "3-1.4".
+	port         string
+	product      string
+	serial       string
+	bus, dev     int
+	number       uint32
+	epIn, epOut  uint32
+	maxPacketIn  int
+	maxPacketOut int
+}
+
+func (i usbInterface) String() string {
+	s := i.port
+	if i.product != "" {
+		s += " (" + i.product
+		if i.serial != "" {
+			s += ", serial " + i.serial
+		}
+		s += ")"
+	}
+	return s
+}
+
+// openDevice opens the PTP/MTP interface selected by the serial number or port in selector,
+// or the only one connected when selector is empty.
+func openDevice(ctx context.Context, selector string, opts Options) (Transport, error) {
+	ifaces, err := findInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	var matches []usbInterface
+	for _, i := range ifaces {
+		if selector == "" || strings.EqualFold(selector, i.serial) || selector == i.port {
+			matches = append(matches, i)
+		}
+	}
+	switch {
+	case len(matches) == 0 && selector == "":
+		return nil, errors.New("mtp: no camera or phone found; unlock the phone and select \"File transfer\" or \"PTP\" for USB")
+	case len(matches) == 0:
+		return nil, fmt.Errorf("mtp: no camera or phone with serial number or port %q", selector)
+	case len(matches) > 1:
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = m.String()
+		}
+		return nil, fmt.Errorf("mtp: several devices found, select one by serial number or port in the URL (mtp://PORT/...): %s", strings.Join(names, "; "))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return openUSB(matches[0], opts)
+}
+
+// findInterfaces lists the still-image (PTP) interfaces and the interfaces named "MTP", which is
+// how Android phones announce MTP on a vendor-specific interface.
+func findInterfaces() ([]usbInterface, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysfsDevices, "*:*"))
+	if err != nil {
+		return nil, err
+	}
+	var found []usbInterface
+	for _, dir := range dirs {
+		class := readSysfs(dir, "bInterfaceClass")
+		sub := readSysfs(dir, "bInterfaceSubClass")
+		proto := readSysfs(dir, "bInterfaceProtocol")
+		if !(class == "06" && sub == "01" && proto == "01") && readSysfs(dir, "interface") != "MTP" {
+			continue
+		}
+		port, _, _ := strings.Cut(filepath.Base(dir), ":")
+		devDir := filepath.Join(sysfsDevices, port)
+		i := usbInterface{
+			port:    port,
+			product: readSysfs(devDir, "product"),
+			serial:  readSysfs(devDir, "serial"),
+		}
+		var errs []error
+		i.bus, err = strconv.Atoi(readSysfs(devDir, "busnum"))
+		errs = append(errs, err)
+		i.dev, err = strconv.Atoi(readSysfs(devDir, "devnum"))
+		errs = append(errs, err)
+		number, err := strconv.ParseUint(readSysfs(dir, "bInterfaceNumber"), 16, 8)
+		errs = append(errs, err)
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("mtp: read %s: %w", dir, err)
+		}
+		i.number = uint32(number)
+
+		eps, _ := filepath.Glob(filepath.Join(dir, "ep_*"))
+		for _, ep := range eps {
+			if readSysfs(ep, "type") != "Bulk" {
+				continue
+			}
+			addr, err := strconv.ParseUint(readSysfs(ep, "bEndpointAddress"), 16, 8)
+			if err != nil {
+				continue
+			}
+			maxPacket, _ := strconv.ParseUint(readSysfs(ep, "wMaxPacketSize"), 16, 16)
+			if readSysfs(ep, "direction") == "in" {
+				i.epIn, i.maxPacketIn = uint32(addr), int(maxPacket)
+			} else {
+				i.epOut, i.maxPacketOut = uint32(addr), int(maxPacket)
+			}
+		}
+		if i.epIn == 0 || i.epOut == 0 {
+			continue
+		}
+		found = append(found, i)
+	}
+	return found, nil
+}
+
+func readSysfs(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// usbTransport is a claimed interface opened through usbfs.
+type usbTransport struct {
+	f       *os.File
+	iface   usbInterface
+	timeout time.Duration
+}
+
+func openUSB(i usbInterface, opts Options) (*usbTransport, error) {
+	name := fmt.Sprintf("/dev/bus/usb/%03d/%03d", i.bus, i.dev)
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrPermission) {
+		return nil, fmt.Errorf("mtp: %w (install the udev rules of libmtp or add your user to the group owning the device)", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mtp: %w", err)
+	}
+	t := &usbTransport{f: f, iface: i, timeout: opts.Timeout}
+	if err := t.ioctl(usbdevfsClaimInterface, uintptr(unsafe.Pointer(&i.number))); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EBUSY) {
+			return nil, fmt.Errorf("mtp: %s is in use by another program, such as a file manager that mounted it: %w", i, err)
+		}
+		return nil, fmt.Errorf("mtp: claim %s: %w", i, err)
+	}
+	return t, nil
+}
+
+func (t *usbTransport) ioctl(req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.f.Fd(), req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bulk runs one bulk transfer on ep and returns the number of bytes transferred.
+func (t *usbTransport) bulk(ep uint32, p []byte) (int, error) {
+	bt := bulkTransfer{ep: ep, len: uint32(len(p)), timeout: uint32(t.timeout.Milliseconds())}
+	if len(p) > 0 {
+		bt.data = unsafe.Pointer(&p[0])
+	}
+	n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, t.f.Fd(), usbdevfsBulk, uintptr(unsafe.Pointer(&bt)))
+	runtime.KeepAlive(p)
+	switch {
+	case errno == syscall.EPIPE:
+		// A stalled endpoint must be cleared before it can be used again.
+		_ = t.ioctl(usbdevfsClearHalt, uintptr(unsafe.Pointer(&ep)))
+		return 0, fmt.Errorf("usb endpoint %02x stalled: %w", ep, errno)
+	case errno == syscall.ETIMEDOUT:
+		return 0, fmt.Errorf("usb transfer timed out after %s", t.timeout)
+	case errno != 0:
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// Send implements Transport.
+func (t *usbTransport) Send(p []byte) error {
+	n, err := t.bulk(t.iface.epOut, p)
+	if err != nil {
+		return err
+	}
+	if n != len(p) {
+		return fmt.Errorf("short usb write of %d of %d bytes", n, len(p))
+	}
+	// A transfer that fills its last packet is ended by a zero-length packet.
+	if t.iface.maxPacketOut > 0 && len(p)%t.iface.maxPacketOut == 0 {
+		_, err = t.bulk(t.iface.epOut, nil)
+	}
+	return err
+}
+
+// Receive implements Transport.
+func (t *usbTransport) Receive(p []byte) (int, error) {
+	return t.bulk(t.iface.epIn, p)
+}
+
+// Close implements Transport.
+func (t *usbTransport) Close() error {
+	err := t.ioctl(usbdevfsReleaseInterface, uintptr(unsafe.Pointer(&t.iface.number)))
+	if closeErr := t.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package mtpfs
+
+import (
+	"context"
+	"errors"
+)
+
+func openDevice(ctx context.Context, selector string, opts Options) (Transport, error) {
+	return nil, errors.New("mtp: USB devices are only supported on Linux")
+}
@@ -0,0 +1,109 @@
+// Package notify posts run summaries to a webhook (ntfy, Slack, Home Assistant, ...).
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeout bounds how long a notification may take.
+const DefaultTimeout = 10 * time.Second
+
+// Summary is the JSON document posted when a run completes.
+type Summary struct {
+	// Text is a one-line human-readable summary; chat webhooks (e.g. Slack) display it as the message.
+	Text string `json:"text"`
+
+	Command         string         `json:"command"`
+	Source          string         `json:"source,omitempty"`
+	Destination     string         `json:"destination,omitempty"`
+	Execute         bool           `json:"execute"`
+	Started         time.Time      `json:"started"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	FilesProcessed  int            `json:"files_processed"`
+	Counts          map[string]int `json:"counts"`
+	BytesCopied     int64          `json:"bytes_copied"`
+	Failures        int            `json:"failures"`
+	FailedFiles     []FailedFile   `json:"failed_files,omitempty"`
+	Succeeded       bool           `json:"succeeded"`
+	Error           string         `json:"error,omitempty"`
+
+	// DuplicatesSkipped counts the files skipped because identical content is kept elsewhere;
+	// SavedBytes is their total size and DuplicateGroups lists them by the file kept.
+	DuplicatesSkipped int              `json:"duplicates_skipped"`
+	SavedBytes        int64            `json:"saved_bytes"`
+	DuplicateGroups   []DuplicateGroup `json:"duplicate_groups,omitempty"`
+
+	// Cameras breaks the processed files down by the camera they were taken with.
+	Cameras []CameraStats `json:"cameras,omitempty"`
+	// Devices breaks them down by the device they were taken with, telling apart devices of one model.
+	Devices []DeviceStats `json:"devices,omitempty"`
+}
+
+// FailedFile describes a file that could not be organized.
+type FailedFile struct {
+	SourcePath string `json:"source_path"`
+	Error      string `json:"error"`
+	// ErrorCode is the stable failure class (see package errcode).
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// DuplicateGroup is a kept file and the identical files skipped in its favor.
+type DuplicateGroup struct {
+	Kept       string   `json:"kept"`
+	Duplicates []string `json:"duplicates"`
+	SavedBytes int64    `json:"saved_bytes"`
+}
+
+// CameraStats is the number and total size of the files taken with a camera.
+// Camera is empty for the files that name none.
+type CameraStats struct {
+	Camera string `json:"camera"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// DeviceStats is the number and total size of the files taken with a device.
+// Device is empty for the files that identify none.
+type DeviceStats struct {
+	Device string `json:"device"`
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Post sends s as JSON to url.
+//
+// Non-2xx responses are reported as errors.
+func Post(ctx context.Context, client *http.Client, url string, s Summary) error {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	body, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode summary: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post %s: unexpected status %s", url, resp.Status)
+	}
+	return nil
+}
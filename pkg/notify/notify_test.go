@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPost_SendsJSONSummary(t *testing.T) {
+	var got Summary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	s := Summary{Text: "organize: 2 copied", Command: "organize", Counts: map[string]int{"copied": 2}, Succeeded: true}
+	if err := Post(context.Background(), srv.Client(), srv.URL, s); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if got.Text != s.Text || got.Counts["copied"] != 2 || !got.Succeeded {
+		t.Fatalf("unexpected summary received: %+v", got)
+	}
+}
+
+func TestPost_ReportsErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := Post(context.Background(), srv.Client(), srv.URL, Summary{}); err == nil {
+		t.Fatalf("expected error for 500 response")
+	}
+}
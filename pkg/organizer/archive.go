@@ -0,0 +1,103 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+
+	"github.com/quidome/media-organizer-go/pkg/archive"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// checkArchive reports why cfg cannot write a run into archives.
+func checkArchive(cfg config) error {
+	switch {
+	case cfg.archive == "":
+		return nil
+	case cfg.inPlace:
+		return errors.New("archives cannot be combined with in-place organizing")
+	case cfg.move:
+		return errors.New("archives cannot be combined with moving files")
+	case len(cfg.volumes) > 0:
+		return errors.New("archives cannot be combined with volumes")
+	case cfg.manifest != manifest.ModeNone:
+		return errors.New("archives cannot be combined with manifests; every archive holds an index")
+	case cfg.verify:
+		return errors.New("archives cannot be combined with verifying copies")
+	}
+	return nil
+}
+
+// archiveStage moves the planned destination of every file to be copied, and of its sidecars, into
+// the archive of the period of its created_at (WithArchive).
+type archiveStage struct {
+	destination string
+	cfg         config
+}
+
+func (s archiveStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	dst := destfs.OrOS(s.cfg.destFS)
+	// archives maps a period to the archive the run writes it into.
+	archives := make(map[string]string)
+	for i := range items {
+		d := &items[i].Decision
+		if d.Action != reconcile.ActionCopy && d.Action != reconcile.ActionCopyRenamed {
+			continue
+		}
+		period := archive.UnknownName
+		if best := items[i].CreatedAt.Best; best.Source != createdat.SourceUnknown {
+			period = s.cfg.archivePeriod.Name(best.CreatedAt)
+		}
+		path, ok := archives[period]
+		if !ok {
+			var err error
+			if path, err = s.newArchive(ctx, dst, period); err != nil {
+				return nil, err
+			}
+			archives[period] = path
+		}
+
+		d.DestinationPath = filepath.Join(path, s.rel(d.DestinationPath))
+		d.FinalDestinationPath = filepath.Join(path, s.rel(d.FinalDestinationPath))
+		for j := range d.Sidecars {
+			d.Sidecars[j].DestinationPath = filepath.Join(path, s.rel(d.Sidecars[j].DestinationPath))
+		}
+	}
+	return items, nil
+}
+
+// rel returns path relative to the destination, as planned without archives.
+func (s archiveStage) rel(path string) string {
+	if rel, err := filepath.Rel(s.destination, path); err == nil {
+		return rel
+	}
+	return filepath.Base(path)
+}
+
+// newArchive returns the path of the archive of period that does not exist yet: <period>.tar, or with
+// a suffix like collisions, <period>_1.tar.
+func (s archiveStage) newArchive(ctx context.Context, dst destfs.FS, period string) (string, error) {
+	for n := 0; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		name := period
+		if n > 0 {
+			name += "_" + strconv.Itoa(n)
+		}
+		path := filepath.Join(s.destination, name+s.cfg.archive.Ext())
+		_, err := dst.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return path, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("stat %s: %w", path, err)
+		}
+	}
+}
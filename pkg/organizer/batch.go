@@ -0,0 +1,715 @@
+package organizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/quidome/media-organizer-go/pkg/applephotos"
+	"github.com/quidome/media-organizer-go/pkg/bloom"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// batchState is the state a run with WithBatchSize carries from one batch to the next.
+type batchState struct {
+	// kept indexes the sources whose content an earlier batch kept, by size.
+	kept *spillIndex
+
+	// headers holds the sizes and header hashes (reconcile.ContentKey) of the kept sources hashed so
+	// far, in filters of growing capacity: a pending file whose key no filter has is unique.
+	headers []*bloom.Filter
+
+	// hashed counts the kept sources of each size whose key is in headers; kept sources are indexed in
+	// order, so those are the first of their size.
+	hashed map[int64]int
+
+	// planned holds the destination paths planned by earlier batches of a dry-run. An executing run
+	// finds them in the destination instead.
+	planned *plannedPaths
+
+	// copying holds the destinations of the batches planned but not copied yet, with WithOverlap.
+	copying *pathSet
+
+	// failed holds the kept sources whose copy failed, with WithOverlap: they went into kept when their
+	// batch was planned, before the copy was known to fail.
+	failed *pathSet
+}
+
+// copyFailed reports whether the copy of the kept source path failed.
+func (b *batchState) copyFailed(path string) bool {
+	return b.failed != nil && b.failed.Has(path)
+}
+
+// pathSet is a set of paths safe for concurrent use.
+type pathSet struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func newPathSet() *pathSet {
+	return &pathSet{paths: make(map[string]bool)}
+}
+
+// Has reports whether path is in the set.
+func (s *pathSet) Has(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paths[path]
+}
+
+func (s *pathSet) add(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[path] = true
+}
+
+func (s *pathSet) remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.paths, path)
+}
+
+// runBatches is RunSources with WithBatchSize: the discovered files go through the pipeline, and with
+// WithExecute are copied, one batch at a time. The result of each batch is passed to Events.OnBatch and
+// counted in the Totals of the returned result, which keeps only the decisions and sizes of the failed
+// files: the memory of the run does not grow with the number of files it organizes.
+func runBatches(ctx context.Context, roots []string, destination string, cfg config) (res Result, err error) {
+	res = Result{
+		Sizes:       make(map[string]int64),
+		Sources:     roots,
+		Destination: destination,
+		InPlace:     cfg.inPlace,
+		Moved:       cfg.move,
+		Linked:      cfg.link,
+		totals:      &Totals{Actions: make(map[reconcile.Action]int)},
+	}
+	if err := checkInPlace(roots, destination, cfg); err != nil {
+		return res, err
+	}
+	res.Warnings = destinationWarnings(roots, destination, cfg)
+
+	kept, err := newSpillIndex()
+	if err != nil {
+		return res, err
+	}
+	defer kept.Close()
+	cfg.batch = &batchState{kept: kept, hashed: make(map[int64]int)}
+	if !cfg.execute {
+		planned, err := newSpillIndex()
+		if err != nil {
+			return res, err
+		}
+		defer planned.Close()
+		cfg.batch.planned = &plannedPaths{index: planned}
+	}
+	overlap := cfg.execute && cfg.overlap
+	if overlap {
+		// Set before the stages copy cfg.
+		cfg.events = cfg.events.serialized()
+		cfg.batch.copying, cfg.batch.failed = newPathSet(), newPathSet()
+	}
+	if cfg.execute && cfg.catalog != nil {
+		run, err := cfg.catalog.BeginRun(ctx, roots, destination)
+		if err != nil {
+			return res, err
+		}
+		res.RunID = run.ID
+	}
+
+	// finish counts a planned, and with WithExecute copied, batch in res and passes it on.
+	var exceeding pathsExceeding
+	finish := func(batch Result) {
+		res.totals.add(batch)
+		exceeding.add([]string{destination}, batch.Decisions, cfg.plan.PathLimits)
+		for _, d := range batch.Decisions {
+			if d.Action == reconcile.ActionFailed {
+				res.Decisions = append(res.Decisions, d)
+				res.Sizes[d.SourcePath] = batch.Sizes[d.SourcePath]
+			}
+		}
+		for _, w := range batch.Warnings {
+			if !slices.Contains(res.Warnings, w) {
+				res.Warnings = append(res.Warnings, w)
+			}
+		}
+		res.HookErrors = append(res.HookErrors, batch.HookErrors...)
+		cfg.events.batch(batch)
+	}
+
+	// keep adds the sources batch keeps to the index later batches are deduplicated against.
+	keep := func(batch Result) error {
+		for _, d := range batch.Decisions {
+			if p, ok := keptContent(d, cfg); ok {
+				if err := kept.Add(batch.Sizes[d.SourcePath], p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// The discover stage is replaced by the batches.
+	stages := cfg.pipeline(roots, destination)[1:]
+	discover := discoverStage{roots: roots, destination: destination, cfg: cfg}
+	if overlap {
+		err = runOverlapped(ctx, discover, stages, cfg, res.RunID, keep, finish)
+	} else {
+		err = discover.batches(ctx, cfg.batchSize, func(items []Item) error {
+			items, err := processStages(ctx, cfg, stages, items)
+			if err != nil {
+				return err
+			}
+			batch := newResult(roots, destination, cfg)
+			batch.RunID = res.RunID
+			collect(&batch, items, cfg)
+
+			var copyErr error
+			if cfg.execute {
+				copyErr = copyAndRecord(ctx, &batch, cfg, res.RunID)
+			}
+			if err := keep(batch); err != nil {
+				return errors.Join(copyErr, err)
+			}
+			finish(batch)
+			return copyErr
+		})
+	}
+	if err == nil && res.RunID != "" {
+		err = cfg.catalog.FinishRun(context.WithoutCancel(ctx), res.RunID)
+	}
+	if w, ok := exceeding.warning(cfg.plan.PathLimits); ok {
+		res.Warnings = append(res.Warnings, w)
+	}
+	return res, err
+}
+
+// checkOverlap reports why cfg cannot copy batches in the background.
+func checkOverlap(cfg config) error {
+	switch {
+	case !cfg.overlap:
+		return nil
+	case cfg.inPlace:
+		return errors.New("overlapping batches cannot be combined with in-place organizing")
+	case cfg.move:
+		return errors.New("overlapping batches cannot be combined with moving files")
+	case cfg.archive != "":
+		return errors.New("overlapping batches cannot be combined with archives")
+	}
+	return nil
+}
+
+// runOverlapped plans and copies the batches of an executing run with WithOverlap as a pipeline: the
+// batches are discovered, attributed, reconciled and copied by a goroutine each, so every step works
+// on its own batch while the steps after it work on the ones before. keep records the kept sources of
+// a planned batch and finish a copied one.
+//
+// Sources are kept, and their destinations reserved, as soon as their batch is planned, so the batches
+// planned while it is copied are deduplicated against them and pass over their destinations. When a
+// copy fails, its source is no longer kept: the files a later batch skipped as its duplicates fail too,
+// and batches planned after the failure no longer skip them.
+func runOverlapped(ctx context.Context, discover discoverStage, stages []Stage, cfg config, runID string, keep func(Result) error, finish func(Result)) error {
+	attribution, reconciliation := splitAttribution(stages)
+
+	copier := startWorker(func(batch Result) error {
+		failDuplicatesOfFailed(&batch, cfg)
+		copyErr := copyAndRecord(ctx, &batch, cfg, runID)
+		for _, d := range batch.Decisions {
+			cfg.batch.copying.remove(d.FinalDestinationPath)
+			if d.Action == reconcile.ActionFailed {
+				cfg.batch.failed.add(d.SourcePath)
+			}
+		}
+		finish(batch)
+		return copyErr
+	})
+	reconciler := startWorker(func(items []Item) error {
+		items, err := processStages(ctx, cfg, reconciliation, items)
+		if err != nil {
+			return err
+		}
+		batch := newResult(discover.roots, discover.destination, cfg)
+		batch.RunID = runID
+		collect(&batch, items, cfg)
+		if err := keep(batch); err != nil {
+			return err
+		}
+		for _, d := range batch.Decisions {
+			if d.Action == reconcile.ActionCopy || d.Action == reconcile.ActionCopyRenamed {
+				cfg.batch.copying.add(d.FinalDestinationPath)
+			}
+		}
+		return copier.send(batch)
+	})
+	attributor := startWorker(func(items []Item) error {
+		items, err := processStages(ctx, cfg, attribution, items)
+		if err != nil {
+			return err
+		}
+		return reconciler.send(items)
+	})
+
+	// Each worker finishes the batches sent to it before the one after it is told there are no more.
+	err := discover.batches(ctx, cfg.batchSize, attributor.send)
+	errs := []error{err, attributor.wait(), reconciler.wait(), copier.wait()}
+	for i, err := range errs {
+		if errors.Is(err, errWorkerStopped) {
+			// The worker it stopped at returned the cause.
+			errs[i] = nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// splitAttribution splits stages after the attribute stage. The stages up to it read every file on its
+// own; the stages after it compare files, within the batch and with the batches before it.
+func splitAttribution(stages []Stage) (attribution, reconciliation []Stage) {
+	for i, stage := range stages {
+		if _, ok := stage.(attributeStage); ok {
+			return stages[:i+1], stages[i+1:]
+		}
+	}
+	return nil, stages
+}
+
+// failDuplicatesOfFailed fails the files of batch skipped as duplicates of a kept source whose copy
+// failed after batch was planned: they are neither copied nor kept.
+func failDuplicatesOfFailed(batch *Result, cfg config) {
+	for i, d := range batch.Decisions {
+		if d.Action != reconcile.ActionSkippedDuplicateSrc || !cfg.batch.copyFailed(d.DuplicateOf) {
+			continue
+		}
+		batch.Decisions[i].Action = reconcile.ActionFailed
+		batch.Decisions[i].Error = fmt.Errorf("skipped as a duplicate of %s, whose copy failed", d.DuplicateOf)
+		cfg.events.error(d.SourcePath, batch.Decisions[i].Error)
+		cfg.events.decision(batch.Decisions[i])
+	}
+}
+
+// processStages passes items through stages in order.
+func processStages(ctx context.Context, cfg config, stages []Stage, items []Item) ([]Item, error) {
+	for _, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var err error
+		if items, err = processStage(ctx, cfg, stage, items); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// errWorkerStopped is returned by worker.send once the worker stopped on an error.
+var errWorkerStopped = errors.New("a later step of the run failed")
+
+// worker runs a step of a run with WithOverlap in its own goroutine, on the batches sent to it in the
+// order they are sent.
+type worker[T any] struct {
+	batches chan T
+	done    chan struct{}
+	// err is the error the worker stopped on, set before done is closed.
+	err error
+}
+
+// startWorker starts a worker that passes every batch sent to it to step, until step fails.
+func startWorker[T any](step func(T) error) *worker[T] {
+	w := &worker[T]{batches: make(chan T), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		for batch := range w.batches {
+			if err := step(batch); err != nil {
+				w.err = err
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// send hands batch to the worker, waiting while it works on the batch before. It returns
+// errWorkerStopped when the worker stopped on an error; wait returns that error.
+func (w *worker[T]) send(batch T) error {
+	select {
+	case w.batches <- batch:
+		return nil
+	case <-w.done:
+		return errWorkerStopped
+	}
+}
+
+// wait waits until the worker finished the batches sent, and returns the error it stopped on.
+func (w *worker[T]) wait() error {
+	close(w.batches)
+	<-w.done
+	return w.err
+}
+
+// keptContent returns where the content of the source of d is after its batch, when the run keeps it:
+// at the source, or for a file moved by an in-place run or WithMove at its destination.
+func keptContent(d reconcile.Decision, cfg config) (string, bool) {
+	switch d.Action {
+	case reconcile.ActionCopied, reconcile.ActionCopiedRenamed:
+		if cfg.inPlace || cfg.move {
+			return d.FinalDestinationPath, true
+		}
+		return d.SourcePath, true
+	case reconcile.ActionCopy, reconcile.ActionCopyRenamed, reconcile.ActionSkippedIdentical:
+		return d.SourcePath, true
+	}
+	return "", false
+}
+
+// batches calls each with the media files of the roots, in batches of about size files. A directory is
+// never split over batches, so the files stages relate by directory (sidecars, edits, bursts) are
+// planned together; a batch holds more than size files only when a single directory does.
+//
+// A root is scanned while its batches are planned, so only the files of the next batch are held. The
+// roots of an in-place run, whose batches move files into directories not scanned yet, and Apple Photos
+// libraries are read whole first.
+func (s discoverStage) batches(ctx context.Context, size int, each func([]Item) error) error {
+	var done int
+	var totalBytes int64
+	// eachSplit passes items to each in batches of whole directories.
+	eachSplit := func(items []Item) error {
+		for _, batch := range splitByDirectory(len(items), func(i int) string { return filepath.Dir(items[i].Source) }, size) {
+			batchItems := make([]Item, 0, len(batch))
+			for _, i := range batch {
+				batchItems = append(batchItems, items[i])
+				// The batch holds the item; it is not needed here again.
+				items[i] = Item{}
+			}
+			if err := each(batchItems); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range s.roots {
+		if destfs.IsOS(s.cfg.sourceFS) && applephotos.IsLibrary(root) {
+			libraryItems, err := s.discoverPhotosLibrary(ctx, root)
+			if err != nil {
+				return err
+			}
+			for _, it := range libraryItems {
+				totalBytes += it.Record.FileSizeBytes
+			}
+			done += len(libraryItems)
+			progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: done, Total: done, TotalBytes: totalBytes})
+			if err := eachSplit(libraryItems); err != nil {
+				return err
+			}
+			continue
+		}
+
+		seen, seenBytes := done, totalBytes
+		found := func(n int, size int64) {
+			progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: seen + n, TotalBytes: seenBytes + size})
+		}
+		if s.cfg.inPlace {
+			records, err := s.records(ctx, root, found)
+			if err != nil {
+				return err
+			}
+			items := make([]Item, 0, len(records))
+			for _, r := range records {
+				items = append(items, s.newItem(root, r))
+				totalBytes += r.FileSizeBytes
+			}
+			done += len(records)
+			progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: done, Total: done, TotalBytes: totalBytes})
+			if err := eachSplit(items); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var batch []Item
+		err := scan.ScanDirs(ctx, destfs.DirFS(s.cfg.sourceFS, root), ".", s.scanOptions(root, found), func(records []scan.Record) error {
+			if len(batch) > 0 && len(batch)+len(records) > size {
+				if err := each(batch); err != nil {
+					return err
+				}
+				batch = nil
+			}
+			for _, r := range records {
+				batch = append(batch, s.newItem(root, r))
+				totalBytes += r.FileSizeBytes
+			}
+			done += len(records)
+			return nil
+		})
+		if err == nil && len(batch) > 0 {
+			err = each(batch)
+		}
+		if err != nil {
+			return err
+		}
+		progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: done, Total: done, TotalBytes: totalBytes})
+	}
+	return nil
+}
+
+// splitByDirectory splits the indexes of n files, whose directories dir returns, into batches of whole
+// directories of about size files, in the order the directories first appear.
+func splitByDirectory(n int, dir func(int) string, size int) [][]int {
+	var dirs []string
+	byDir := make(map[string][]int)
+	for i := range n {
+		d := dir(i)
+		if _, ok := byDir[d]; !ok {
+			dirs = append(dirs, d)
+		}
+		byDir[d] = append(byDir[d], i)
+	}
+
+	var batches [][]int
+	var batch []int
+	for _, d := range dirs {
+		if len(batch) > 0 && len(batch)+len(byDir[d]) > size {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		batch = append(batch, byDir[d]...)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// batchDedupeStage skips the pending items identical to a source kept by an earlier batch of the run
+// (WithBatchSize), as duplicates of it. Within a batch the dedupe stage keeps the oldest of identical
+// files; across batches the first one found is kept.
+//
+// A pending file is only read when a kept source has its size, and only compared with the kept sources
+// whose header hash matches its own. A bloom filter of the sizes and header hashes of the kept sources
+// rules out most files without reading the index.
+type batchDedupeStage struct {
+	cfg config
+}
+
+func (s batchDedupeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys, known := destfs.OrOS(s.cfg.sourceFS), s.cfg.hashed(s.cfg.sourceFS)
+	b := s.cfg.batch
+	for _, i := range pending(items) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		src, size := items[i].Source, items[i].Record.FileSizeBytes
+		if b.kept.Count(size) == 0 {
+			continue
+		}
+		if err := b.hashHeaders(fsys, size); err != nil {
+			return nil, err
+		}
+		h, err := reconcile.HeaderHash(fsys, src, size)
+		if err != nil {
+			return nil, err
+		}
+		if !b.mayHaveHeader(reconcile.ContentKey(size, h)) {
+			continue
+		}
+
+		entries, err := b.kept.Lookup(size)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []string
+		for _, e := range entries {
+			if e.Header == h && !b.copyFailed(e.Path) {
+				candidates = append(candidates, e.Path)
+			}
+		}
+		if len(candidates) == 0 {
+			// A false positive of the filter.
+			continue
+		}
+		_, decisions, err := reconcile.ResolveAgainstLibraryFS(ctx, known, known, []string{src}, map[string]int64{src: size}, map[int64][]string{size: candidates})
+		if err != nil {
+			return nil, err
+		}
+		if len(decisions) > 0 {
+			items[i].Decision = reconcile.Decision{SourcePath: src, Action: reconcile.ActionSkippedDuplicateSrc, DuplicateOf: decisions[0].DestinationPath}
+		}
+	}
+	return items, nil
+}
+
+// headerFilterCapacity is the number of keys the first filter of batchState.headers is sized for; every
+// next filter holds twice as many.
+const headerFilterCapacity = 1 << 16
+
+// hashHeaders hashes the headers of the kept sources of size that were not hashed yet, records them in
+// the index and adds their keys to the filters.
+func (b *batchState) hashHeaders(fsys destfs.FS, size int64) error {
+	if b.hashed[size] == b.kept.Count(size) {
+		return nil
+	}
+	entries, err := b.kept.Lookup(size)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries[b.hashed[size]:] {
+		h, err := reconcile.HeaderHash(fsys, e.Path, size)
+		if err != nil {
+			return err
+		}
+		if err := b.kept.SetHeader(e, h); err != nil {
+			return err
+		}
+		if n := len(b.headers); n == 0 || b.headers[n-1].Full() {
+			b.headers = append(b.headers, bloom.New(headerFilterCapacity<<n, 0.01))
+		}
+		b.headers[len(b.headers)-1].Add(reconcile.ContentKey(size, h))
+	}
+	b.hashed[size] = len(entries)
+	return nil
+}
+
+// mayHaveHeader reports whether a kept source may have the content key.
+func (b *batchState) mayHaveHeader(key []byte) bool {
+	for _, f := range b.headers {
+		if f.Has(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// plannedPaths is the set of destination paths planned by the earlier batches of a dry-run. Like the
+// kept sources, the paths are spilled to a temporary file, indexed by a hash of the path.
+type plannedPaths struct {
+	index *spillIndex
+	// err is the first error reading the index; Has reports every path as planned after it.
+	err error
+}
+
+// pathKey returns the key a path is indexed under.
+func pathKey(path string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return int64(h.Sum64())
+}
+
+// Has reports whether path was planned.
+func (p *plannedPaths) Has(path string) bool {
+	if p.err != nil {
+		return true
+	}
+	entries, err := p.index.Lookup(pathKey(path))
+	if err != nil {
+		p.err = err
+		return true
+	}
+	for _, e := range entries {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// add records the paths planned by a batch. It returns the error of a Has before, if any.
+func (p *plannedPaths) add(paths []string) error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, path := range paths {
+		if err := p.index.Add(pathKey(path), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillIndex maps file sizes, or other keys, to paths and their header hashes. The entries are kept in a
+// temporary file instead of memory; only their offsets are held, so indexing millions of files takes a
+// fraction of the memory of the paths.
+type spillIndex struct {
+	f       *os.File
+	end     int64
+	offsets map[int64][]int64
+}
+
+// spillEntry is an entry of a spillIndex. Header is zero until set with SetHeader.
+type spillEntry struct {
+	Path   string
+	Header [32]byte
+	offset int64
+}
+
+func newSpillIndex() (*spillIndex, error) {
+	f, err := os.CreateTemp("", "media-organizer-batch-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillIndex{f: f, offsets: make(map[int64][]int64)}, nil
+}
+
+// Add indexes path under size. An entry is the header hash, the length of the path as a uvarint, and
+// the path.
+func (x *spillIndex) Add(size int64, path string) error {
+	buf := make([]byte, sha256.Size, sha256.Size+binary.MaxVarintLen64+len(path))
+	buf = binary.AppendUvarint(buf, uint64(len(path)))
+	buf = append(buf, path...)
+	if _, err := x.f.WriteAt(buf, x.end); err != nil {
+		return err
+	}
+	x.offsets[size] = append(x.offsets[size], x.end)
+	x.end += int64(len(buf))
+	return nil
+}
+
+// Count returns the number of paths indexed under size.
+func (x *spillIndex) Count(size int64) int {
+	return len(x.offsets[size])
+}
+
+// Lookup returns the entries indexed under size, in the order they were added.
+func (x *spillIndex) Lookup(size int64) ([]spillEntry, error) {
+	var entries []spillEntry
+	for _, off := range x.offsets[size] {
+		var head [sha256.Size + binary.MaxVarintLen64]byte
+		n, err := x.f.ReadAt(head[:], off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if n < sha256.Size {
+			return nil, errors.New("corrupt batch index")
+		}
+		length, m := binary.Uvarint(head[sha256.Size:n])
+		if m <= 0 {
+			return nil, errors.New("corrupt batch index")
+		}
+		p := make([]byte, length)
+		if _, err := x.f.ReadAt(p, off+int64(sha256.Size+m)); err != nil {
+			return nil, err
+		}
+		e := spillEntry{Path: string(p), offset: off}
+		copy(e.Header[:], head[:sha256.Size])
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// SetHeader records the header hash of the entry e.
+func (x *spillIndex) SetHeader(e spillEntry, header [32]byte) error {
+	_, err := x.f.WriteAt(header[:], e.offset)
+	return err
+}
+
+// Close removes the temporary file of the index.
+func (x *spillIndex) Close() error {
+	return errors.Join(x.f.Close(), os.Remove(x.f.Name()))
+}
@@ -0,0 +1,137 @@
+package organizer
+
+import (
+	"sync"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// Events receives callbacks as a run moves through the pipeline, so frontends can
+// observe it without parsing output. Every field is optional.
+//
+// Callbacks are invoked synchronously from the goroutine running the pipeline;
+// a slow callback slows the run down. With WithOverlap the steps of the run work on
+// their batches in goroutines of their own, but callbacks are still invoked one at a time.
+type Events struct {
+	// OnScanned is called for every discovered media file, with its absolute source path.
+	OnScanned func(src string, r scan.Record)
+
+	// OnAttributed is called after the created_at candidates of a file were determined.
+	OnAttributed func(src string, d createdat.DetailedResult)
+
+	// OnDecision is called for every decision once planning is complete, and again for each
+	// copy decision when Execute records its outcome.
+	OnDecision func(d reconcile.Decision)
+
+	// OnCopyStart is called before a file is copied.
+	OnCopyStart func(op plan.Operation)
+
+	// OnCopyDone is called after a file was copied or failed to copy.
+	OnCopyDone func(r copy.Result)
+
+	// OnError is called for every per-file error that turns a file into a failed decision.
+	OnError func(src string, err error)
+
+	// OnHookError is called when an after-copy or after-run hook fails. Such failures do not
+	// change the outcome of the run.
+	OnHookError func(err error)
+
+	// OnBatch is called with the result of every batch of a run with WithBatchSize, once it was
+	// planned and, with WithExecute, copied.
+	OnBatch func(res Result)
+}
+
+// WithEvents registers callbacks observing the run.
+func WithEvents(e Events) Option {
+	return func(c *config) { c.events = e }
+}
+
+// serialized returns e with its callbacks invoked one at a time, for runs calling them from several
+// goroutines.
+func (e Events) serialized() Events {
+	mu := new(sync.Mutex)
+	return Events{
+		OnScanned:    locked2(mu, e.OnScanned),
+		OnAttributed: locked2(mu, e.OnAttributed),
+		OnDecision:   locked(mu, e.OnDecision),
+		OnCopyStart:  locked(mu, e.OnCopyStart),
+		OnCopyDone:   locked(mu, e.OnCopyDone),
+		OnError:      locked2(mu, e.OnError),
+		OnHookError:  locked(mu, e.OnHookError),
+		OnBatch:      locked(mu, e.OnBatch),
+	}
+}
+
+func locked[T any](mu *sync.Mutex, f func(T)) func(T) {
+	if f == nil {
+		return nil
+	}
+	return func(v T) {
+		mu.Lock()
+		defer mu.Unlock()
+		f(v)
+	}
+}
+
+func locked2[T, U any](mu *sync.Mutex, f func(T, U)) func(T, U) {
+	if f == nil {
+		return nil
+	}
+	return func(v T, w U) {
+		mu.Lock()
+		defer mu.Unlock()
+		f(v, w)
+	}
+}
+
+func (e Events) scanned(src string, r scan.Record) {
+	if e.OnScanned != nil {
+		e.OnScanned(src, r)
+	}
+}
+
+func (e Events) attributed(src string, d createdat.DetailedResult) {
+	if e.OnAttributed != nil {
+		e.OnAttributed(src, d)
+	}
+}
+
+func (e Events) decision(d reconcile.Decision) {
+	if e.OnDecision != nil {
+		e.OnDecision(d)
+	}
+}
+
+func (e Events) copyStart(op plan.Operation) {
+	if e.OnCopyStart != nil {
+		e.OnCopyStart(op)
+	}
+}
+
+func (e Events) copyDone(r copy.Result) {
+	if e.OnCopyDone != nil {
+		e.OnCopyDone(r)
+	}
+}
+
+func (e Events) error(src string, err error) {
+	if e.OnError != nil {
+		e.OnError(src, err)
+	}
+}
+
+func (e Events) hookError(err error) {
+	if e.OnHookError != nil {
+		e.OnHookError(err)
+	}
+}
+
+func (e Events) batch(res Result) {
+	if e.OnBatch != nil {
+		e.OnBatch(res)
+	}
+}
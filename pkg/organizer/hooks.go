@@ -0,0 +1,132 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/hook"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// WithHooks runs external executables at the points of the run they name (see package hook).
+//
+// A failing hook.AfterAttribute hook rejects the file: it becomes a failed decision with code
+// errcode.HookRejected. Failures of hook.AfterCopy and hook.AfterRun hooks do not change the outcome;
+// they are collected in Result.HookErrors and reported to Events.OnHookError.
+func WithHooks(hooks ...hook.Hook) Option {
+	return func(c *config) { c.hooks = append(c.hooks, hooks...) }
+}
+
+// hookStage runs the hook.AfterAttribute hooks for every pending item.
+type hookStage struct {
+	hooks []hook.Hook
+	cfg   config
+}
+
+func (s hookStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		doc := fileDoc(hook.AfterAttribute, it.Source, it.Record.FileSizeBytes, it.Record.ModTime, it.CreatedAt.Best, it.Fields)
+		for _, h := range s.hooks {
+			err := h.Exec(ctx, doc)
+			if err == nil {
+				continue
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			if s.cfg.failFast {
+				return nil, fmt.Errorf("%s rejected by %w", it.Source, err)
+			}
+			it.Decision = reconcile.Decision{
+				SourcePath: it.Source,
+				Action:     reconcile.ActionFailed,
+				Error:      errcode.Wrap(errcode.HookRejected, err),
+			}
+			s.cfg.events.error(it.Source, it.Decision.Error)
+			break
+		}
+	}
+	return items, nil
+}
+
+// fileDoc returns the hook input describing a file.
+func fileDoc(p hook.Point, src string, size int64, modTime time.Time, best createdat.Result, fields plan.Fields) hook.File {
+	doc := hook.File{
+		Event:         p,
+		SourcePath:    src,
+		FileSizeBytes: size,
+		ModTime:       modTime,
+		Fields:        fields,
+	}
+	if !best.CreatedAt.IsZero() {
+		createdAt := best.CreatedAt
+		doc.CreatedAt = &createdAt
+		doc.CreatedAtSource = string(best.Source)
+	}
+	return doc
+}
+
+// afterCopy runs the hook.AfterCopy hooks for the copy result r.
+func afterCopy(ctx context.Context, res *Result, cfg config, r copy.Result) {
+	hooks := hook.At(cfg.hooks, hook.AfterCopy)
+	if len(hooks) == 0 {
+		return
+	}
+	src := r.Operation.SourcePath
+	doc := fileDoc(hook.AfterCopy, src, res.Sizes[src], res.ModTimes[src], res.Details[src].Best, res.Fields[src])
+	doc.DestinationPath = r.Operation.DestinationPath
+	doc.Success = r.Success
+	doc.SHA256 = r.SHA256
+	if r.Error != nil {
+		doc.Error = r.Error.Error()
+		doc.ErrorCode = string(errcode.Of(r.Error))
+	}
+	runHooks(ctx, res, cfg, hooks, doc)
+}
+
+// afterRun runs the hook.AfterRun hooks for the finished run res. They also run when the run
+// was canceled or failed, which runErr reports.
+func afterRun(ctx context.Context, res *Result, cfg config, runErr error) {
+	hooks := hook.At(cfg.hooks, hook.AfterRun)
+	if len(hooks) == 0 {
+		return
+	}
+	doc := hook.Run{
+		Event:       hook.AfterRun,
+		Sources:     res.Sources,
+		Destination: res.Destination,
+		Execute:     cfg.execute,
+		RunID:       res.RunID,
+		Files:       len(res.Decisions),
+		Counts:      make(map[string]int),
+	}
+	for action, n := range res.Counts() {
+		doc.Counts[string(action)] = n
+	}
+	if runErr != nil {
+		doc.Error = runErr.Error()
+	}
+	runHooks(context.WithoutCancel(ctx), res, cfg, hooks, doc)
+}
+
+// runHooks runs hooks with doc, recording their failures without failing the run.
+func runHooks(ctx context.Context, res *Result, cfg config, hooks []hook.Hook, doc any) {
+	for _, h := range hooks {
+		if err := h.Exec(ctx, doc); err != nil {
+			res.HookErrors = append(res.HookErrors, err)
+			cfg.events.hookError(err)
+		}
+	}
+}
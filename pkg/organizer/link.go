@@ -0,0 +1,52 @@
+package organizer
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+)
+
+// checkLink reports why cfg cannot link the destination to its sources.
+func checkLink(cfg config) error {
+	switch {
+	case cfg.link == "":
+		return nil
+	case cfg.inPlace:
+		return errors.New("links cannot be combined with in-place organizing")
+	case cfg.move:
+		return errors.New("links cannot be combined with moving files")
+	case cfg.archive != "":
+		return errors.New("links cannot be combined with archives")
+	case !destfs.IsOS(cfg.sourceFS) || !destfs.IsOS(cfg.destFS):
+		return errors.New("links need a local source and destination")
+	}
+	return nil
+}
+
+// checkTrash reports why cfg cannot put the sources it removes into its trash; moves is whether the
+// run moves files.
+func checkTrash(cfg config, moves bool) error {
+	switch {
+	case cfg.trash == nil:
+		return nil
+	case !moves:
+		return errors.New("a trash needs a run that moves files")
+	case !destfs.IsOS(cfg.sourceFS):
+		return errors.New("a trash needs a local source")
+	}
+	return nil
+}
+
+// trashDirs returns the directories below root, slash-separated, that hold the trashes of runs: the
+// default trash.DirName, and that of the trash of cfg when it is a directory below root.
+func (c config) trashDirs(root string) []string {
+	dirs := []string{trash.DirName}
+	if d, ok := c.trash.(trash.Dir); ok {
+		if rel, ok := within(root, filepath.Dir(d.Path)); ok && rel != "." && rel != trash.DirName {
+			dirs = append(dirs, filepath.ToSlash(rel))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,624 @@
+package organizer
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/quidome/media-organizer-go/pkg/archive"
+	"github.com/quidome/media-organizer-go/pkg/burst"
+	"github.com/quidome/media-organizer-go/pkg/cache"
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/checkpoint"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/edits"
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/hook"
+	"github.com/quidome/media-organizer-go/pkg/journal"
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+	"github.com/quidome/media-organizer-go/pkg/motionphoto"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/profile"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
+	"github.com/quidome/media-organizer-go/pkg/track"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+	"github.com/quidome/media-organizer-go/pkg/volume"
+)
+
+// Option configures a run.
+type Option func(*config)
+
+// config holds the stage settings of a run.
+type config struct {
+	execute         bool
+	sidecars        sidecar.Policy
+	noDedupe        bool
+	payloadDedupe   bool
+	dedupeScope     reconcile.DedupeScope
+	plan            reconcile.PlanOptions
+	libraryDedupe   bool
+	hashes          hashlist.List
+	hashAlgorithm   reconcile.HashAlgorithm
+	cache           *cache.Cache
+	failFast        bool
+	lockWait        time.Duration
+	progress        progress.Reporter
+	lightroom       string
+	profile         profile.Profile
+	catalog         *catalog.Catalog
+	writeEXIF       bool
+	fileTimes       bool
+	manifest        manifest.Mode
+	geocoder        geocode.Geocoder
+	track           *track.Track
+	trackOffset     time.Duration
+	cameras         bool
+	ratings         bool
+	keywords        bool
+	screenshots     bool
+	videoInfo       bool
+	similarVideos   bool
+	nearDuplicates  bool
+	cameraFilter    []string
+	motionPhotos    motionphoto.Policy
+	motionDetection bool
+	heic            heic.Policy
+	edits           edits.Preference
+	bursts          burst.Policy
+	inPlace         bool
+	allowIncomplete bool
+	previousLayout  *plan.Layout
+	strictDates     bool
+	review          createdat.Confidence
+	dateCheck       createdat.Sanity
+	timezones       []timezone
+	assumedZone     *time.Location
+	gpsTimezone     bool
+	hooks           []hook.Hook
+	sourceFS        destfs.FS
+	destFS          destfs.FS
+	events          Events
+	tracerProvider  trace.TracerProvider
+	stages          []Stage
+	batchSize       int
+	overlap         bool
+	move            bool
+	link            copy.Link
+	trash           trash.Trash
+	batch           *batchState
+	volumes         []volume.Volume
+	volumeSplit     volume.Split
+	archive         archive.Format
+	archivePeriod   archive.Period
+	journal         *journal.Writer
+	resume          bool
+	resumed         map[string]checkpoint.Entry
+	checkpoint      *checkpoint.Writer
+	verify          bool
+	noPreserveTimes bool
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		sidecars:     sidecar.PolicyCopy,
+		dedupeScope:  reconcile.DedupeScopeRun,
+		plan:         reconcile.PlanOptions{UnknownDir: reconcile.DefaultUnknownDir, ReviewDir: reconcile.DefaultReviewDir, UnknownLayout: reconcile.UnknownLayoutFlat},
+		motionPhotos: motionphoto.PolicyKeep,
+		heic:         heic.PolicyOff,
+		edits:        edits.PreferBoth,
+		bursts:       burst.PolicyOff,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.overlap && cfg.batchSize <= 0 {
+		cfg.batchSize = DefaultOverlapBatchSize
+	}
+	return cfg
+}
+
+// WithExecute makes Run copy files instead of only planning them (dry-run, the default).
+func WithExecute(execute bool) Option {
+	return func(c *config) { c.execute = execute }
+}
+
+// WithSidecarPolicy sets how sidecars are handled (default: sidecar.PolicyCopy).
+func WithSidecarPolicy(p sidecar.Policy) Option {
+	return func(c *config) { c.sidecars = p }
+}
+
+// WithoutDedupe keeps every source, even if it is identical to another source.
+func WithoutDedupe() Option {
+	return func(c *config) { c.noDedupe = true }
+}
+
+// WithPayloadDedupe also treats JPEGs as duplicates when only their metadata differs: their image data
+// (package imagehash) is identical, as for a copy exported with its EXIF stripped. Of each group the
+// largest file, which carries the most metadata, is kept. It reads every JPEG in full.
+func WithPayloadDedupe() Option {
+	return func(c *config) { c.payloadDedupe = true }
+}
+
+// WithDedupeScope sets the scope of source deduplication (default: reconcile.DedupeScopeRun).
+func WithDedupeScope(s reconcile.DedupeScope) Option {
+	return func(c *config) { c.dedupeScope = s }
+}
+
+// WithUnknownDir sets the destination-relative directory for files without a known date.
+func WithUnknownDir(dir string) Option {
+	return func(c *config) { c.plan.UnknownDir = dir }
+}
+
+// WithUnknownLayout sets the layout inside the unknown directory.
+func WithUnknownLayout(l reconcile.UnknownLayout) Option {
+	return func(c *config) { c.plan.UnknownLayout = l }
+}
+
+// WithReview plans the dated files whose created_at is less trustworthy than threshold (createdat.Confidence)
+// into the review directory instead of the directory of their date, below the directory that date would
+// file them under. Each gets a review.Note sidecar listing its candidates. Like generated XMP sidecars, the
+// notes follow the sidecar policy. Files without a date still go to the unknown directory.
+func WithReview(threshold createdat.Confidence) Option {
+	return func(c *config) { c.review = threshold }
+}
+
+// WithDateCheck plans the dated files whose date s finds implausible (createdat.Sanity.Check), such as
+// a camera clock reset to 1980 or a date in the future, into the review directory like WithReview,
+// instead of filing them under a probably wrong date. Their review.Note gives the reason.
+func WithDateCheck(s createdat.Sanity) Option {
+	return func(c *config) { c.dateCheck = s }
+}
+
+// WithReviewDir sets the destination-relative directory of WithReview (default: reconcile.DefaultReviewDir).
+func WithReviewDir(dir string) Option {
+	return func(c *config) { c.plan.ReviewDir = dir }
+}
+
+// WithLayout sets the directory layout of dated files (default: plan.DefaultLayout).
+// Layouts using {album} read Google Takeout album metadata from the sources.
+func WithLayout(l plan.Layout) Option {
+	return func(c *config) { c.plan.Layout = l }
+}
+
+// WithRoutes sends the dated files matching a route to its layout instead of the default one. The
+// first matching route wins; files matching none use the layout as usual.
+func WithRoutes(routes ...plan.Route) Option {
+	return func(c *config) { c.plan.Routes = append(c.plan.Routes, routes...) }
+}
+
+// WithBatchSize makes Run and RunSources plan, and with WithExecute copy, the files of the sources in
+// batches of about n files, for sources too large to hold in memory at once. Every batch is passed to
+// Events.OnBatch when it is done; the returned result holds the decisions, sizes and dates written of the
+// whole run. A directory is never split over batches.
+//
+// A file identical to one kept by an earlier batch is skipped as its duplicate, even if it is older;
+// payload dedupe, similar videos, bursts and edits only compare the files of the same batch. Plan
+// ignores the option.
+func WithBatchSize(n int) Option {
+	return func(c *config) { c.batchSize = n }
+}
+
+// DefaultOverlapBatchSize is the batch size of a run with WithOverlap but without WithBatchSize.
+const DefaultOverlapBatchSize = 1000
+
+// WithOverlap makes an executing run a pipeline of batches (WithBatchSize, by default batches of
+// DefaultOverlapBatchSize files): one goroutine each discovers, attributes, reconciles and copies
+// them, so scanning, reading metadata and copying overlap instead of taking turns. Every step holds
+// one batch and waits for the step after it to take it.
+//
+// The destinations of batches not copied yet are reserved: a later batch planning a file there gets
+// the next free suffix, as it would for a file already in the destination. Sources kept by a batch
+// are known to later batches as soon as it is planned; when the copy of one fails, the later files
+// skipped as its duplicates fail too. Events callbacks are then invoked from every step, one at a
+// time.
+//
+// It cannot be combined with WithInPlace, WithMove or WithArchive. A dry-run plans the batches one
+// after the other as usual.
+func WithOverlap() Option {
+	return func(c *config) { c.overlap = true }
+}
+
+// WithVolumes spreads the library over volumes, such as external disks, instead of the destination of
+// Run: the files are planned relative to the destination as usual, and then every folder that split
+// keeps whole is assigned to a volume, and its files planned below the volume root instead (package
+// volume). Folders already on a volume stay there; the others fill the volumes in order, up to their
+// capacity. Files of a folder no volume has room for fail with volume.ErrFull. Result.Volumes reports
+// the folders and bytes of each volume.
+//
+// An executing run locks every volume, and the library of every volume is searched by WithLibraryDedupe.
+// It cannot be combined with WithBatchSize or WithInPlace.
+func WithVolumes(split volume.Split, volumes ...volume.Volume) Option {
+	return func(c *config) {
+		c.volumeSplit = split
+		c.volumes = append(c.volumes, volumes...)
+	}
+}
+
+// WithArchive writes the files of an executing run into one tar or zip archive per period (year or
+// month) of their created_at in the destination root, such as 2024.tar, instead of loose files. Each
+// file is planned at its layout path inside its archive: <destination>/2024.tar/2024/07/14/IMG_1234.jpg.
+// An archive that exists already is never appended to; the run writes a new one, such as 2024_1.tar.
+// Archives cannot be combined with WithInPlace, WithVolumes, WithManifest or WithVerify.
+func WithArchive(format archive.Format, period archive.Period) Option {
+	return func(c *config) {
+		c.archive = format
+		c.archivePeriod = period
+	}
+}
+
+// WithPathLimits bounds the destination-relative paths of the library, for the Windows, exFAT and sync
+// tool consumers of a library copied elsewhere (plan.PathLimits). Files whose planned path exceeds the
+// limits are reported in Result.Warnings; with l.Shorten their directories and names are shortened instead.
+func WithPathLimits(l plan.PathLimits) Option {
+	return func(c *config) { c.plan.PathLimits = l }
+}
+
+// WithRatings reads the star rating of each file from its XMP sidecar or its embedded XMP or EXIF
+// metadata (package rating), filling the {rating} layout token and Result.Fields. A rating from the
+// Lightroom catalog takes priority. Layouts and routes using {rating} read ratings without WithRatings.
+func WithRatings() Option {
+	return func(c *config) { c.ratings = true }
+}
+
+// WithKeywords reads the keywords of each file from its XMP sidecar or its embedded XMP or IPTC
+// metadata (package keyword), filling the {keyword} layout token and Result.Fields. Layouts and routes
+// using {keyword} read keywords without WithKeywords.
+func WithKeywords() Option {
+	return func(c *config) { c.keywords = true }
+}
+
+// WithScreenshots recognizes screenshots by their name or metadata (package screenshot), filling the
+// {screenshot} layout token and Result.Fields. Layouts and routes using {screenshot} recognize
+// screenshots without WithScreenshots.
+func WithScreenshots() Option {
+	return func(c *config) { c.screenshots = true }
+}
+
+// WithVideoInfo reads the resolution, duration and codec of each MP4 and QuickTime video (package video),
+// filling the {resolution}, {duration} and {codec} layout tokens and Result.Fields. Layouts and routes
+// using them read videos without WithVideoInfo.
+func WithVideoInfo() Option {
+	return func(c *config) { c.videoInfo = true }
+}
+
+// WithLightroomCatalog reads capture dates, ratings and collections from the Lightroom catalog (.lrcat)
+// at path. A capture date takes priority over the file's own metadata; the first collection by name
+// fills {album} and the rating fills {rating}. Files missing from the catalog are organized as usual.
+func WithLightroomCatalog(path string) Option {
+	return func(c *config) { c.lightroom = path }
+}
+
+// WithProfile organizes for bulk import by a photo server: the layout of the profile is used unless
+// WithLayout is given, XMP sidecars are named the way the server expects, and files without one get
+// a generated XMP sidecar with their created_at, rating and album. Generated sidecars follow the
+// sidecar policy; with sidecar.PolicySkip none are written.
+func WithProfile(p profile.Profile) Option {
+	return func(c *config) { c.profile = p }
+}
+
+// WithCatalog records every file an executing run copies in c, together with its content hash,
+// created_at and source, under a new run ID (Result.RunID). Dry-runs record nothing.
+func WithCatalog(c *catalog.Catalog) Option {
+	return func(cfg *config) { cfg.catalog = c }
+}
+
+// WithManifest adds the SHA-256 of every file an executing run copies to the checksum manifests of
+// the destination: one per directory with manifest.ModeDirectory, one in the destination root with
+// manifest.ModeLibrary. Existing manifests are updated, not replaced. Dry-runs write nothing.
+func WithManifest(mode manifest.Mode) Option {
+	return func(c *config) { c.manifest = mode }
+}
+
+// WithWriteEXIF writes the created_at of each copied JPEG into the EXIF DateTimeOriginal of its copy
+// when the file has none, so the date survives outside this tool (Result.DatesWritten). Sources are
+// never modified, and dates taken from the file's modification time are not written.
+func WithWriteEXIF() Option {
+	return func(c *config) { c.writeEXIF = true }
+}
+
+// WithFileTimes sets the modification time of each file copied to a local destination to its
+// created_at, and its creation time on Windows and macOS, where Explorer, Finder and some NAS indexers
+// sort by it. Files with an unknown date keep the times of their source, unless WithoutPreservedTimes.
+func WithFileTimes() Option {
+	return func(c *config) { c.fileTimes = true }
+}
+
+// WithoutPreservedTimes leaves every copy with the time it was written. By default copies on a local
+// destination, and their sidecars, keep the access and modification time of their source, unless
+// WithFileTimes sets them to the created_at.
+func WithoutPreservedTimes() Option {
+	return func(c *config) { c.noPreserveTimes = true }
+}
+
+// WithGeocoder resolves the GPS position of each file to a place with g, filling the {place}, {country}
+// and {city} layout tokens and Result.Fields. Layouts using them without WithGeocoder use geocode.Bundled.
+func WithGeocoder(g geocode.Geocoder) Option {
+	return func(c *config) { c.geocoder = g }
+}
+
+// WithTrack correlates the files with the GPS track t. A file without a GPS position of its own is
+// placed at the position of t at its date, which fills the {place}, {country} and {city} layout tokens and Result.Positions.
+// A file with one is verified: t agreeing with it or not raises or lowers the confidence of its date
+// one level (createdat.DetailedResult.WithTrack).
+func WithTrack(t *track.Track) Option {
+	return func(c *config) { c.track = t }
+}
+
+// WithTrackOffset sets how far the clock of the cameras that recorded the files without a GPS position
+// was ahead of the track (WithTrack), such as an hour for a clock left on winter time. The metadata and
+// filename dates of those files are corrected for it before they are placed on the track.
+func WithTrackOffset(d time.Duration) Option {
+	return func(c *config) { c.trackOffset = d }
+}
+
+// WithCameras reads the camera of each file from its EXIF Make and Model, filling the {camera} layout
+// token and Result.Fields, and identifies its device (package device), filling the {device} token.
+// With names, only files taken with one of those cameras are organized; the others, including files
+// that name no camera, are left out of the run. A name matches the camera's display name
+// ("Canon EOS R5") or its model, ignoring case. Layouts using {camera} or {device} read cameras
+// without WithCameras.
+func WithCameras(names ...string) Option {
+	return func(c *config) {
+		c.cameras = true
+		c.cameraFilter = append(c.cameraFilter, names...)
+	}
+}
+
+// WithMotionPhotos sets what happens to motion photos (Result.MotionPhotos). They are always copied
+// intact; with motionphoto.PolicyExtract their video is also written next to the copy as a companion
+// .mp4, which follows the sidecar policy like a sidecar.
+func WithMotionPhotos(p motionphoto.Policy) Option {
+	return func(c *config) { c.motionPhotos = p }
+}
+
+// WithMotionPhotoDetection recognizes motion photos (Result.MotionPhotos) without extracting their
+// video. Runs with motionphoto.PolicyExtract recognize them without WithMotionPhotoDetection.
+func WithMotionPhotoDetection() Option {
+	return func(c *config) { c.motionDetection = true }
+}
+
+// WithSimilarVideos flags the videos that look like a re-encoded copy of a larger video of the run
+// (Result.SimilarTo), such as the copies WhatsApp and cloud services make at a lower bitrate: their
+// duration and aspect ratio match and, when ffmpeg is in PATH and the sources are local, so do
+// perceptual hashes of frames sampled from both (package videohash). Flagged videos are still organized.
+func WithSimilarVideos() Option {
+	return func(c *config) { c.similarVideos = true }
+}
+
+// WithNearDuplicates flags the photos that look like a copy of a larger photo of the run at another
+// resolution or compression (Result.NearDuplicateOf): their perceptual hashes (package similar) and
+// aspect ratios match. Only JPEG, PNG and GIF photos are compared. Flagged photos are still organized.
+func WithNearDuplicates() Option {
+	return func(c *config) { c.nearDuplicates = true }
+}
+
+// WithHEICConversion sets what happens to HEIC photos (Result.Converted). With heic.PolicyReplace a
+// JPEG converted from each HEIC photo is written instead of it, under the name with a .jpg extension;
+// with heic.PolicyKeep the photo is copied intact and the JPEG is written next to the copy as a
+// companion, which follows the sidecar policy like a sidecar. Conversion needs a converter in PATH
+// (package heic); without one the run fails before anything is planned.
+func WithHEICConversion(p heic.Policy) Option {
+	return func(c *config) { c.heic = p }
+}
+
+// WithEdits sets which versions of a photo with edited copies (such as IMG_1234~2.jpg or
+// IMG_1234-edited.jpg next to IMG_1234.jpg) are organized. Edits are always planned into the directory
+// of their original (Result.EditOf); with edits.PreferOriginal or edits.PreferEdit the other version is
+// skipped as reconcile.ActionSkippedVersion.
+func WithEdits(p edits.Preference) Option {
+	return func(c *config) { c.edits = p }
+}
+
+// WithBursts sets what happens to burst sequences (package burst). With burst.PolicyGroup and
+// burst.PolicyBest the shots of a burst are dated like its first shot, so they are planned into one
+// directory, and fill the {burst} layout token; burst.PolicyBest also skips all but the best shot as
+// reconcile.ActionSkippedBurst. Layouts and routes using {burst} group bursts without WithBursts.
+func WithBursts(p burst.Policy) Option {
+	return func(c *config) { c.bursts = p }
+}
+
+// WithInPlace organizes a directory into itself: the destination must be the only source, and both
+// must be on the local filesystem. Files are moved into place instead of copied, renamed where possible;
+// files that are already where they belong are left alone as reconcile.ActionSkippedIdentical, so
+// running it again moves nothing. WithLibraryDedupe does not apply; the sources are the library.
+func WithInPlace() Option {
+	return func(c *config) { c.inPlace = true }
+}
+
+// WithMove makes an executing run move the files it would copy, and their sidecars, from the sources into
+// the destination, freeing the space of the sources as it goes (Result.Moved). Files on the same local
+// filesystem are renamed; others are copied, read back and checked against the content written, and
+// only then removed from the source. Files the run does not copy, such as duplicates and files already in
+// the destination, stay in the sources.
+//
+// It cannot be combined with WithArchive or WithOverlap.
+func WithMove() Option {
+	return func(c *config) { c.move = true }
+}
+
+// WithLink makes an executing run link the files it would copy, and their sidecars, into the
+// destination instead of copying them (Result.Linked): copy.LinkHard with hard links, which take no
+// extra space but need the sources on the filesystem of the destination, copy.LinkSym with symbolic
+// links to the sources. Files whose content is rewritten, such as by WithWriteEXIF or
+// WithHEICConversion, are copied. An existing link to the source at a destination is skipped as identical.
+//
+// It needs a local source and destination, and cannot be combined with WithInPlace, WithMove or WithArchive.
+func WithLink(l copy.Link) Option {
+	return func(c *config) { c.link = l }
+}
+
+// WithTrash makes an executing run that moves files, with WithMove or WithInPlace, put the sources it
+// removes after copying them into t instead of deleting them. Renamed files are not removed and do not
+// reach it. It needs a local source.
+func WithTrash(t trash.Trash) Option {
+	return func(c *config) { c.trash = t }
+}
+
+// WithPreviousLayout tells the run that the destination was organized with l, as when migrating a library
+// to another layout in place. A file inside the destination whose created_at comes only from its
+// modification time, or that has none, is dated by the directory l placed it in (createdat.SourceDirectory):
+// copies commonly reset the modification time, which the directory predates. A modification time within
+// the period of the directory is kept, being more precise.
+func WithPreviousLayout(l plan.Layout) Option {
+	return func(c *config) { c.previousLayout = &l }
+}
+
+// WithStrictDates never dates a file by its modification time, which bulk copies and downloads commonly
+// reset: files without a metadata or filename date go to the unknown directory for review instead of
+// being filed under the date they were copied. Dates of WithPreviousLayout and WithCatalog still apply.
+func WithStrictDates() Option {
+	return func(c *config) { c.strictDates = true }
+}
+
+// WithTimezone reads the timestamps without a timezone (EXIF dates and dates in filenames) of the files
+// below dir in loc instead of the local timezone, as for an archive of a camera set to another
+// timezone. dir is slash-separated and relative to each source root; "." names the whole source.
+// With several directories containing a file, the deepest one applies.
+func WithTimezone(dir string, loc *time.Location) Option {
+	return func(c *config) {
+		c.timezones = append(c.timezones, timezone{dir: path.Clean(strings.Trim(dir, "/")), loc: loc})
+	}
+}
+
+// WithAssumedTimezone reads the timestamps without a timezone of the files below no WithTimezone
+// directory in loc instead of the local timezone. EXIF dates recorded with their UTC offset, or with a
+// GPS time the offset follows from, are read in that offset regardless.
+func WithAssumedTimezone(loc *time.Location) Option {
+	return func(c *config) { c.assumedZone = loc }
+}
+
+// WithGPSTimezone reads the dates of files with an EXIF GPS position in the timezone of that position,
+// resolved with the geocoder of WithGeocoder, or geocode.Bundled: the local time where they were taken,
+// whatever the timezone of the machine, WithTimezone or WithAssumedTimezone. Dates recorded without a
+// timezone keep their wall clock; dates recorded with an offset are converted to the local time.
+// Files without a position, or one no place with a timezone is near, are dated as before.
+//
+// The timezone is that of the nearest place of the geocoder, not a lookup in timezone boundaries: near
+// a border between zones it can be the zone across the border.
+func WithGPSTimezone() Option {
+	return func(c *config) { c.gpsTimezone = true }
+}
+
+// timezone is a directory given to WithTimezone.
+type timezone struct {
+	dir string
+	loc *time.Location
+}
+
+// location returns the timezone of the file at the slash-separated path relative to its source root.
+func (c config) location(rel string) *time.Location {
+	loc, depth := c.defaultLocation(), -2
+	for _, tz := range c.timezones {
+		d := -1
+		if tz.dir != "." {
+			if rel != tz.dir && !strings.HasPrefix(rel, tz.dir+"/") {
+				continue
+			}
+			d = strings.Count(tz.dir, "/")
+		}
+		if d >= depth {
+			loc, depth = tz.loc, d
+		}
+	}
+	return loc
+}
+
+// defaultLocation returns the timezone of the timestamps without one outside WithTimezone directories.
+func (c config) defaultLocation() *time.Location {
+	if c.assumedZone != nil {
+		return c.assumedZone
+	}
+	return time.Local
+}
+
+// WithLibraryDedupe skips sources whose content already exists anywhere in the destination.
+func WithLibraryDedupe() Option {
+	return func(c *config) { c.libraryDedupe = true }
+}
+
+// WithHashes trusts the hashes other tools recorded of source and destination files, such as an
+// audited archive, when comparing files for duplicates (reconcile.WithHashes): a listed file is not
+// read again unless it changed since its list was written.
+func WithHashes(list hashlist.List) Option {
+	return func(c *config) { c.hashes = list }
+}
+
+// WithHashAlgorithm compares files for duplicates by their digest of a (reconcile.WithHashAlgorithm)
+// instead of byte for byte, reading every file once. reconcile.HashXXH128 is the fastest;
+// reconcile.HashSHA256 shares its digests with WithHashes lists of sha256 hashes.
+func WithHashAlgorithm(a reconcile.HashAlgorithm) Option {
+	return func(c *config) { c.hashAlgorithm = a }
+}
+
+// WithCache keeps the content hashes and metadata dates of local source and destination files in c,
+// so later runs over the same files do not read them again; a file whose size or modification time
+// changed is read again. Without WithHashAlgorithm files are then compared by their SHA-256, which is
+// what the cache keeps, instead of byte for byte.
+func WithCache(c *cache.Cache) Option {
+	return func(cfg *config) { cfg.cache = c }
+}
+
+// WithJournal records every file an executing run copies or moves, with its sidecars, in w, so
+// journal.Undo can revert the run. Copies are then checksummed. Runs writing archives are not recorded.
+func WithJournal(w *journal.Writer) Option {
+	return func(c *config) { c.journal = w }
+}
+
+// WithResume resumes an executing run that was interrupted: the files the checkpoint in the
+// destination (checkpoint.FileName) records as copied are skipped as identical without reading them,
+// as long as neither the source nor the copy changed size or modification time since. Every executing
+// run keeps such a checkpoint while it copies, and removes it when it finishes. Without a checkpoint
+// every file is organized.
+func WithResume() Option {
+	return func(c *config) { c.resume = true }
+}
+
+// WithVerify reads every file an executing run copies back from the destination and compares its
+// SHA-256 with that of its source, for destinations such as network shares that may store something
+// else than was written. A copy that differs is removed and decided failed with errcode.VerifyFailed.
+// It cannot be combined with WithArchive.
+func WithVerify() Option {
+	return func(c *config) { c.verify = true }
+}
+
+// WithAllowIncomplete organizes empty files and truncated JPEGs like any other file. By default they
+// fail with errcode.EmptyFile or errcode.Truncated before anything else reads them.
+func WithAllowIncomplete() Option {
+	return func(c *config) { c.allowIncomplete = true }
+}
+
+// WithFailFast aborts the run on the first file that cannot be read,
+// instead of recording it as a failed decision.
+func WithFailFast() Option {
+	return func(c *config) { c.failFast = true }
+}
+
+// WithLockWait sets how long an executing run waits for another run holding the destination lock.
+func WithLockWait(d time.Duration) Option {
+	return func(c *config) { c.lockWait = d }
+}
+
+// WithProgress sends stage progress events to r.
+func WithProgress(r progress.Reporter) Option {
+	return func(c *config) { c.progress = r }
+}
+
+// WithSourceFS reads the sources from fsys instead of the local filesystem.
+// Source roots are paths within fsys.
+func WithSourceFS(fsys destfs.FS) Option {
+	return func(c *config) { c.sourceFS = fsys }
+}
+
+// WithDestinationFS organizes into fsys instead of the local filesystem.
+// The destination is a path within fsys. Non-local destinations are not locked.
+func WithDestinationFS(fsys destfs.FS) Option {
+	return func(c *config) { c.destFS = fsys }
+}
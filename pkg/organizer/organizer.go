@@ -0,0 +1,913 @@
+// Package organizer wires the pipeline stages (scan → createdat → dedupe → plan → reconcile → copy)
+// into a single call, so the organizer can be embedded in other Go programs.
+//
+//	res, err := organizer.Run(ctx, "/media/card", "/library",
+//		organizer.WithExecute(true),
+//		organizer.WithSidecarPolicy(sidecar.PolicyRequire),
+//	)
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/quidome/media-organizer-go/pkg/archive"
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/exifwrite"
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/journal"
+	"github.com/quidome/media-organizer-go/pkg/lock"
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// Result holds the decisions of a run and the per-source data used to report them.
+type Result struct {
+	// Decisions holds one decision per discovered media file, in discovery order. A run with
+	// WithBatchSize passes the result of every batch to Events.OnBatch and then drops it: Decisions and
+	// Sizes only hold its failed files, and Totals counts all of them.
+	Decisions []reconcile.Decision
+
+	// Details holds the created_at candidates of every file that could be read.
+	Details map[string]createdat.DetailedResult
+
+	// Sizes and ModTimes hold the file size and modification time of every source.
+	Sizes    map[string]int64
+	ModTimes map[string]time.Time
+
+	// SourceHashes holds, by source, the hex-encoded SHA-256 a plan file recorded of it (PlanResult). A
+	// source whose content differs is not copied.
+	SourceHashes map[string]string
+
+	// Fields holds the layout field values (album, rating, place, ...) of the sources that have any.
+	Fields map[string]plan.Fields
+
+	// MotionPhotos holds the sources that are motion photos, JPEGs with an embedded video. It is only
+	// filled with WithMotionPhotoDetection or motionphoto.PolicyExtract.
+	MotionPhotos map[string]bool
+
+	// SimilarTo holds, by source, the larger video each video that looks like a re-encoded copy of it
+	// was flagged against (WithSimilarVideos).
+	SimilarTo map[string]string
+
+	// NearDuplicateOf holds, by source, the larger photo each photo that looks like a copy of it at
+	// another resolution or compression was flagged against (WithNearDuplicates).
+	NearDuplicateOf map[string]string
+
+	// SuspiciousDates holds, by source, why WithDateCheck found the date of each file it planned into
+	// the review directory implausible.
+	SuspiciousDates map[string]string
+
+	// Converted holds the HEIC sources converted to JPEG (WithHEICConversion).
+	Converted map[string]bool
+
+	// EditOf holds, by source, the original of each edited copy (WithEdits).
+	EditOf map[string]string
+
+	// PairedWith holds, by source, the other file of each RAW+JPEG pair.
+	PairedWith map[string]string
+
+	// Positions holds, by source, the position the GPS track placed each file without a GPS position
+	// of its own at (WithTrack).
+	Positions map[string]geocode.Point
+
+	// Sources and Destination are the roots of the run.
+	Sources     []string
+	Destination string
+
+	// InPlace reports a run that organizes its destination in place (WithInPlace): files are moved.
+	InPlace bool
+
+	// Moved reports a run that moves its sources into the destination instead of copying them (WithMove).
+	Moved bool
+
+	// Linked is how a run links the destination to its sources instead of copying them (WithLink);
+	// empty for runs that copy.
+	Linked copy.Link
+
+	// RunID identifies the run in the catalog (WithCatalog); empty when nothing was recorded.
+	RunID string
+
+	// DatesWritten holds, by source, the created_at written into the EXIF DateTimeOriginal
+	// of its copy (WithWriteEXIF).
+	DatesWritten map[string]time.Time
+
+	// Warnings holds the findings about the destination that did not stop the run, such as a
+	// destination inside a source or organized in another layout, or paths exceeding WithPathLimits,
+	// and the sidecars and file times that failed after their file was moved.
+	Warnings []string
+
+	// HookErrors holds the failures of after-copy and after-run hooks (WithHooks).
+	HookErrors []error
+
+	// Volumes holds the part of the run on each volume, in the order of WithVolumes.
+	Volumes []VolumePlan
+
+	// totals holds the counts of the batches of a run with WithBatchSize, which keeps only its failed
+	// decisions; nil for other runs.
+	totals *Totals
+}
+
+// Counts returns the number of decisions per action.
+func (r Result) Counts() map[reconcile.Action]int {
+	if r.totals != nil {
+		return maps.Clone(r.totals.Actions)
+	}
+	counts := make(map[reconcile.Action]int)
+	for _, d := range r.Decisions {
+		counts[d.Action]++
+	}
+	return counts
+}
+
+// Totals are the aggregate counts of the decisions of a run.
+type Totals struct {
+	// Files is the number of decisions, one per discovered media file.
+	Files int
+
+	// Actions is the number of decisions per action.
+	Actions map[reconcile.Action]int
+
+	// BytesCopied is the total size of the sources copied (reconcile.ActionCopied, ActionCopiedRenamed).
+	BytesCopied int64
+
+	// DuplicatesSkipped and SavedBytes are the number and total size of the sources skipped because
+	// their content is kept elsewhere (see Duplicates).
+	DuplicatesSkipped int
+	SavedBytes        int64
+}
+
+// Totals returns the aggregate counts of the run. A run with WithBatchSize counts its batches as they
+// finish; for other runs they are counted from Decisions.
+func (r Result) Totals() Totals {
+	if r.totals != nil {
+		t := *r.totals
+		t.Actions = maps.Clone(t.Actions)
+		return t
+	}
+	t := Totals{Actions: make(map[reconcile.Action]int)}
+	t.add(r)
+	return t
+}
+
+// add counts the decisions of r.
+func (t *Totals) add(r Result) {
+	t.Files += len(r.Decisions)
+	for _, d := range r.Decisions {
+		t.Actions[d.Action]++
+		if d.Action == reconcile.ActionCopied || d.Action == reconcile.ActionCopiedRenamed {
+			t.BytesCopied += r.Sizes[d.SourcePath]
+		}
+	}
+	groups, saved := r.Duplicates()
+	for _, g := range groups {
+		t.DuplicatesSkipped += len(g.Duplicates)
+	}
+	t.SavedBytes += saved
+}
+
+// DuplicateGroup is a file kept by a run and the identical files skipped in its favor.
+type DuplicateGroup struct {
+	// Kept is the kept source, or the library file for sources already in the destination.
+	Kept string
+
+	// Duplicates are the skipped sources, in decision order.
+	Duplicates []string
+
+	// SavedBytes is the total size of Duplicates.
+	SavedBytes int64
+}
+
+// Duplicates groups the sources skipped because their content is kept elsewhere (skipped_duplicate_source,
+// skipped_identical and skipped_imported) by the file kept, most bytes saved first, and returns the total
+// bytes saved.
+func (r Result) Duplicates() (groups []DuplicateGroup, savedBytes int64) {
+	byKept := make(map[string]int)
+	for _, d := range r.Decisions {
+		kept := d.DuplicateOf
+		switch d.Action {
+		case reconcile.ActionSkippedDuplicateSrc:
+		case reconcile.ActionSkippedIdentical, reconcile.ActionSkippedImported:
+			kept = d.FinalDestinationPath
+		default:
+			continue
+		}
+		i, ok := byKept[kept]
+		if !ok {
+			i = len(groups)
+			byKept[kept] = i
+			groups = append(groups, DuplicateGroup{Kept: kept})
+		}
+		size := r.Sizes[d.SourcePath]
+		groups[i].Duplicates = append(groups[i].Duplicates, d.SourcePath)
+		groups[i].SavedBytes += size
+		savedBytes += size
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].SavedBytes > groups[j].SavedBytes })
+	return groups, savedBytes
+}
+
+// CameraStats is the number and total size of the files of a run taken with one camera.
+type CameraStats struct {
+	// Camera is the display name of the camera, such as "Canon EOS R5"; empty for files that name none.
+	Camera string
+
+	Files int
+	Bytes int64
+}
+
+// Cameras counts the files of the run per camera (see WithCameras), most files first.
+// Files that name no camera are counted together, last.
+func (r Result) Cameras() []CameraStats {
+	var stats []CameraStats
+	for _, c := range r.countBy(plan.TokenCamera) {
+		stats = append(stats, CameraStats{Camera: c.value, Files: c.files, Bytes: c.bytes})
+	}
+	return stats
+}
+
+// DeviceStats is the number and total size of the files of a run taken with one device.
+type DeviceStats struct {
+	// Device is the name of the device, such as "Canon EOS R5 #012345678901" or "Google Pixel"
+	// (see plan.TokenDevice); empty for files that identify none.
+	Device string
+
+	Files int
+	Bytes int64
+}
+
+// Devices counts the files of the run per device (see WithCameras), most files first.
+// Files that identify no device are counted together, last.
+func (r Result) Devices() []DeviceStats {
+	var stats []DeviceStats
+	for _, c := range r.countBy(plan.TokenDevice) {
+		stats = append(stats, DeviceStats{Device: c.value, Files: c.files, Bytes: c.bytes})
+	}
+	return stats
+}
+
+// fieldCount is the number and total size of the files of a run with one value of a field.
+type fieldCount struct {
+	value string
+	files int
+	bytes int64
+}
+
+// countBy counts the files of the run per value of the field token, most files first.
+// Files without a value are counted together, last.
+func (r Result) countBy(token string) []fieldCount {
+	byValue := make(map[string]int)
+	var counts []fieldCount
+	for _, d := range r.Decisions {
+		value := r.Fields[d.SourcePath][token]
+		i, ok := byValue[value]
+		if !ok {
+			i = len(counts)
+			byValue[value] = i
+			counts = append(counts, fieldCount{value: value})
+		}
+		counts[i].files++
+		counts[i].bytes += r.Sizes[d.SourcePath]
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if (counts[i].value == "") != (counts[j].value == "") {
+			return counts[j].value == ""
+		}
+		if counts[i].files != counts[j].files {
+			return counts[i].files > counts[j].files
+		}
+		return counts[i].value < counts[j].value
+	})
+	return counts
+}
+
+// Run organizes the media files under src into dst.
+//
+// Without WithExecute(true) the run is a dry-run: decisions are planned but nothing is written.
+func Run(ctx context.Context, src, dst string, opts ...Option) (Result, error) {
+	return RunSources(ctx, []string{src}, dst, opts...)
+}
+
+// RunSources organizes the media files of several source roots into dst as one run,
+// so duplicates are detected across all of them.
+func RunSources(ctx context.Context, sources []string, dst string, opts ...Option) (res Result, err error) {
+	cfg := newConfig(opts)
+	ctx, span := cfg.tracer().Start(ctx, "organize", trace.WithAttributes(
+		attribute.StringSlice("sources", sources),
+		attribute.String("destination", dst),
+		attribute.Bool("execute", cfg.execute),
+	))
+	defer func() {
+		endSpan(span, err)
+		span.End()
+	}()
+
+	if err := checkOptions(cfg); err != nil {
+		return res, err
+	}
+	// Overlapping runs against the same destination would race on suffix resolution.
+	if cfg.execute {
+		for _, root := range cfg.roots(dst) {
+			release, err := AcquireLock(root, opts...)
+			if err != nil {
+				return res, err
+			}
+			defer func() {
+				if releaseErr := release(); releaseErr != nil && err == nil {
+					err = releaseErr
+				}
+			}()
+		}
+	}
+
+	if err := loadCheckpoint(dst, &cfg); err != nil {
+		return res, err
+	}
+	if cfg.execute && cfg.archive == "" {
+		finishCheckpoint, checkpointErr := startCheckpoint(dst, &cfg)
+		if checkpointErr != nil {
+			return res, checkpointErr
+		}
+		defer func() {
+			if checkpointErr := finishCheckpoint(err == nil); checkpointErr != nil && err == nil {
+				err = checkpointErr
+			}
+		}()
+	}
+
+	if cfg.batchSize > 0 {
+		res, err = runBatches(ctx, sources, dst, cfg)
+	} else {
+		res, err = planRun(ctx, sources, dst, cfg)
+		if err == nil && cfg.execute {
+			err = execute(ctx, &res, cfg)
+		}
+	}
+	afterRun(ctx, &res, cfg, err)
+	return res, err
+}
+
+// checkOptions reports why the options of cfg cannot be combined.
+func checkOptions(cfg config) error {
+	if err := checkVolumes(cfg); err != nil {
+		return err
+	}
+	if err := checkArchive(cfg); err != nil {
+		return err
+	}
+	if err := checkOverlap(cfg); err != nil {
+		return err
+	}
+	if err := checkLink(cfg); err != nil {
+		return err
+	}
+	return checkTrash(cfg, cfg.move || cfg.inPlace)
+}
+
+// AcquireLock takes the destination lock, honoring WithLockWait, and returns its release function.
+// Use it to hold the lock across a separate Plan and Execute. It first checks that the destination
+// can be written to, so a read-only destination fails before anything is planned or copied.
+//
+// Destinations outside the local filesystem (WithDestinationFS) are not locked.
+func AcquireLock(dst string, opts ...Option) (func() error, error) {
+	cfg := newConfig(opts)
+	if !destfs.IsOS(cfg.destFS) {
+		return func() error { return nil }, nil
+	}
+	if err := checkWritable(dst); err != nil {
+		return nil, err
+	}
+	lockOpts := lock.DefaultOptions()
+	lockOpts.Wait = cfg.lockWait
+	l, err := lock.Acquire(dst, lockOpts)
+	if err != nil {
+		return nil, err
+	}
+	return l.Release, nil
+}
+
+// Plan runs every stage up to and including reconcile against destination, without writing anything.
+// WithExecute is ignored.
+func Plan(ctx context.Context, sources []string, destination string, opts ...Option) (Result, error) {
+	cfg := newConfig(opts)
+	ctx, span := cfg.tracer().Start(ctx, "plan", trace.WithAttributes(
+		attribute.StringSlice("sources", sources),
+		attribute.String("destination", destination),
+	))
+	defer span.End()
+	if err := checkOptions(cfg); err != nil {
+		endSpan(span, err)
+		return Result{}, err
+	}
+	if err := loadCheckpoint(destination, &cfg); err != nil {
+		endSpan(span, err)
+		return Result{}, err
+	}
+	res, err := planRun(ctx, sources, destination, cfg)
+	endSpan(span, err)
+	return res, err
+}
+
+func planRun(ctx context.Context, roots []string, destination string, cfg config) (Result, error) {
+	res := newResult(roots, destination, cfg)
+	if err := checkInPlace(roots, destination, cfg); err != nil {
+		return res, err
+	}
+	res.Warnings = destinationWarnings(roots, destination, cfg)
+
+	var items []Item
+	for _, stage := range cfg.pipeline(roots, destination) {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		var err error
+		items, err = processStage(ctx, cfg, stage, items)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	collect(&res, items, cfg)
+	if len(cfg.volumes) > 0 {
+		res.Volumes = volumePlans(res, cfg)
+	}
+	if w, ok := pathLimitWarning(cfg.roots(destination), res.Decisions, cfg.plan.PathLimits); ok {
+		res.Warnings = append(res.Warnings, w)
+	}
+	return res, nil
+}
+
+// newResult returns the empty result of a run of roots into destination.
+func newResult(roots []string, destination string, cfg config) Result {
+	return Result{
+		Details:      make(map[string]createdat.DetailedResult),
+		Sizes:        make(map[string]int64),
+		ModTimes:     make(map[string]time.Time),
+		Fields:       make(map[string]plan.Fields),
+		Sources:      roots,
+		Destination:  destination,
+		InPlace:      cfg.inPlace,
+		Moved:        cfg.move,
+		Linked:       cfg.link,
+		DatesWritten: make(map[string]time.Time),
+	}
+}
+
+// collect adds the decisions and per-source data of the planned items to res.
+func collect(res *Result, items []Item, cfg config) {
+	if res.Decisions == nil {
+		res.Decisions = make([]reconcile.Decision, 0, len(items))
+	}
+	for _, it := range items {
+		res.Sizes[it.Source] = it.Record.FileSizeBytes
+		res.ModTimes[it.Source] = it.Record.ModTime
+		res.Details[it.Source] = it.CreatedAt
+		if len(it.Fields) > 0 {
+			res.Fields[it.Source] = it.Fields
+		}
+		if it.EditOf != "" {
+			if res.EditOf == nil {
+				res.EditOf = make(map[string]string)
+			}
+			res.EditOf[it.Source] = it.EditOf
+		}
+		if it.PairedWith != "" {
+			if res.PairedWith == nil {
+				res.PairedWith = make(map[string]string)
+			}
+			res.PairedWith[it.Source] = it.PairedWith
+		}
+		if it.MotionPhoto {
+			if res.MotionPhotos == nil {
+				res.MotionPhotos = make(map[string]bool)
+			}
+			res.MotionPhotos[it.Source] = true
+		}
+		if it.SimilarTo != "" {
+			if res.SimilarTo == nil {
+				res.SimilarTo = make(map[string]string)
+			}
+			res.SimilarTo[it.Source] = it.SimilarTo
+		}
+		if it.NearDuplicateOf != "" {
+			if res.NearDuplicateOf == nil {
+				res.NearDuplicateOf = make(map[string]string)
+			}
+			res.NearDuplicateOf[it.Source] = it.NearDuplicateOf
+		}
+		if it.Suspicious != "" {
+			if res.SuspiciousDates == nil {
+				res.SuspiciousDates = make(map[string]string)
+			}
+			res.SuspiciousDates[it.Source] = it.Suspicious
+		}
+		if it.Position != nil {
+			if res.Positions == nil {
+				res.Positions = make(map[string]geocode.Point)
+			}
+			res.Positions[it.Source] = *it.Position
+		}
+		if it.Converted {
+			if res.Converted == nil {
+				res.Converted = make(map[string]bool)
+			}
+			res.Converted[it.Source] = true
+		}
+		res.Decisions = append(res.Decisions, it.Decision)
+		cfg.events.decision(it.Decision)
+	}
+}
+
+// checkInPlace reports why roots cannot be organized in place into destination with WithInPlace, and
+// refuses a local root that is the destination without it: copying a directory into itself would
+// organize a second copy of every file.
+func checkInPlace(roots []string, destination string, cfg config) error {
+	local := destfs.IsOS(cfg.sourceFS) && destfs.IsOS(cfg.destFS)
+	if !cfg.inPlace {
+		for _, root := range roots {
+			if same, err := samePath(root, destination); local && err == nil && same {
+				return fmt.Errorf("source %s is the destination; organize it in place instead", root)
+			}
+		}
+		return nil
+	}
+	if !local {
+		return fmt.Errorf("in-place organizing needs a local directory")
+	}
+	if len(roots) != 1 {
+		return fmt.Errorf("in-place organizing needs the destination as the only source, got %d sources", len(roots))
+	}
+	same, err := samePath(roots[0], destination)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("in-place organizing needs the destination as the source, got %s and %s", roots[0], destination)
+	}
+	return nil
+}
+
+// samePath reports whether the local paths a and b name the same directory.
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
+// Execute copies the sources of the copy decisions of a planned result, or moves them for in-place and
+// move results, and updates res.Decisions in place. Planning options are ignored, the caller holds the
+// destination lock, and hook failures are only reported to Events.OnHookError.
+func Execute(ctx context.Context, res Result, opts ...Option) error {
+	cfg := newConfig(opts)
+	ctx, span := cfg.tracer().Start(ctx, "execute", trace.WithAttributes(attribute.String("destination", res.Destination)))
+	defer span.End()
+	err := execute(ctx, &res, cfg)
+	afterRun(ctx, &res, cfg, err)
+	endSpan(span, err)
+	return err
+}
+
+// execute copies the planned files of res and adds the copied files to the manifests and, with a
+// catalog, records them as a run.
+func execute(ctx context.Context, res *Result, cfg config) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cfg.catalog == nil {
+		return copyAndRecord(ctx, res, cfg, "")
+	}
+
+	run, err := cfg.catalog.BeginRun(ctx, res.Sources, res.Destination)
+	if err != nil {
+		return err
+	}
+	res.RunID = run.ID
+	if err := copyAndRecord(ctx, res, cfg, run.ID); err != nil {
+		return err
+	}
+	return cfg.catalog.FinishRun(context.WithoutCancel(ctx), run.ID)
+}
+
+// copyAndRecord copies the planned files of res, adds the copied files to the manifests and, with a
+// catalog, records them in the catalog run runID.
+func copyAndRecord(ctx context.Context, res *Result, cfg config, runID string) error {
+	results, copyErr := executeDecisions(ctx, res, cfg)
+	copyErr = errors.Join(copyErr, updateManifests(ctx, res, cfg, results))
+	if cfg.catalog == nil {
+		return copyErr
+	}
+
+	// Files copied before a cancellation are recorded too; they are in the library.
+	recordCtx := context.WithoutCancel(ctx)
+	dst := destfs.OrOS(cfg.destFS)
+	entries := make([]catalog.Entry, 0, len(results))
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		best := res.Details[r.Operation.SourcePath].Best
+		entry := catalog.Entry{
+			SHA256:          r.SHA256,
+			Size:            res.Sizes[r.Operation.SourcePath],
+			CreatedAt:       best.CreatedAt,
+			CreatedAtSource: best.Source,
+			SourcePath:      r.Operation.SourcePath,
+			SourceModTime:   res.ModTimes[r.Operation.SourcePath],
+			DestinationPath: r.Operation.DestinationPath,
+		}
+		// The stat of the copy lets a later run confirm it is still there without reading it.
+		if info, err := dst.Stat(r.Operation.DestinationPath); err == nil {
+			entry.DestinationSize, entry.DestinationModTime = info.Size(), info.ModTime()
+		}
+		entries = append(entries, entry)
+	}
+	spanCtx, span := cfg.tracer().Start(recordCtx, "catalog record", trace.WithAttributes(attribute.Int("entries", len(entries))))
+	err := cfg.catalog.Record(spanCtx, runID, entries)
+	endSpan(span, err)
+	span.End()
+	return errors.Join(copyErr, err)
+}
+
+// updateManifests adds the files copied by results to the manifests of the destination.
+func updateManifests(ctx context.Context, res *Result, cfg config, results []copy.Result) error {
+	if cfg.manifest == manifest.ModeNone {
+		return nil
+	}
+	files := make(map[string]string, len(results))
+	for _, r := range results {
+		if r.Success {
+			files[r.Operation.DestinationPath] = r.DestinationSHA256
+		}
+	}
+	// Files copied before a cancellation are listed too; they are in the library.
+	_, span := cfg.tracer().Start(context.WithoutCancel(ctx), "manifest update", trace.WithAttributes(attribute.Int("files", len(files))))
+	defer span.End()
+	var errs []error
+	for _, root := range cfg.roots(res.Destination) {
+		errs = append(errs, manifest.Update(cfg.destFS, root, cfg.manifest, files))
+	}
+	err := errors.Join(errs...)
+	endSpan(span, err)
+	return err
+}
+
+func executeDecisions(ctx context.Context, res *Result, cfg config) (_ []copy.Result, err error) {
+	decisions, sizes := res.Decisions, res.Sizes
+	ctx, span := cfg.tracer().Start(ctx, "stage copy")
+	defer func() {
+		endSpan(span, err)
+		span.End()
+	}()
+
+	// Copy only actions that require copying.
+	opsToCopy := make([]plan.Operation, 0)
+	written := make(map[string]time.Time)
+	for _, d := range decisions {
+		if d.Action == reconcile.ActionCopy || d.Action == reconcile.ActionCopyRenamed {
+			final := d.FinalDestinationPath
+			if final == "" {
+				final = d.DestinationPath
+			}
+			op := plan.Operation{SourcePath: d.SourcePath, DestinationPath: final, Sidecars: d.Sidecars}
+			if mtime, ok := res.ModTimes[d.SourcePath]; ok {
+				op.SourceSize, op.SourceModTime = sizes[d.SourcePath], mtime
+			}
+			op.SourceSHA256 = res.SourceHashes[d.SourcePath]
+			if cfg.writeEXIF {
+				op.Transform = exifTransform(d.SourcePath, res.Details[d.SourcePath].Best, written)
+			}
+			if res.Converted[d.SourcePath] && cfg.heic == heic.PolicyReplace {
+				op.Transform = heic.ToJPEG
+			}
+			if best := res.Details[d.SourcePath].Best; cfg.fileTimes && best.Source != createdat.SourceUnknown {
+				op.CreatedAt = best.CreatedAt
+			}
+			opsToCopy = append(opsToCopy, op)
+		}
+	}
+
+	var totalBytes, copiedBytes int64
+	for _, op := range opsToCopy {
+		totalBytes += sizes[op.SourcePath]
+	}
+	span.SetAttributes(attribute.Int("files", len(opsToCopy)), attribute.Int64("bytes", totalBytes))
+	files := newFileSpans(ctx, cfg, sizes)
+	progress.Report(cfg.progress, progress.Event{Stage: progress.StageCopy, Total: len(opsToCopy), TotalBytes: totalBytes})
+	finished := 0
+	var recordErr error
+	copyOpts := copy.Options{
+		Overwrite:     false,
+		Move:          res.InPlace || res.Moved,
+		Link:          res.Linked,
+		Trash:         cfg.trash,
+		Checksum:      cfg.catalog != nil || cfg.manifest != manifest.ModeNone || cfg.journal != nil,
+		Verify:        cfg.verify,
+		PreserveTimes: !cfg.noPreserveTimes,
+		Source:        cfg.sourceFS,
+		Destination:   cfg.destFS,
+		OnStart: func(op plan.Operation) {
+			files.start(op)
+			cfg.events.copyStart(op)
+		},
+		OnProgress: func(op plan.Operation, read int64) {
+			progress.Report(cfg.progress, progress.Event{
+				Stage: progress.StageCopy, Done: finished, Total: len(opsToCopy),
+				Bytes: copiedBytes + min(read, sizes[op.SourcePath]), TotalBytes: totalBytes, Current: op.SourcePath,
+			})
+		},
+		OnResult: func(done int, r copy.Result) {
+			finished = done
+			files.done(r)
+			cfg.events.copyDone(r)
+			afterCopy(ctx, res, cfg, r)
+			if err := errors.Join(recordJournal(cfg, r, res.InPlace || res.Moved), recordCheckpoint(cfg, res, r)); err != nil && recordErr == nil {
+				recordErr = err
+			}
+			if r.Success {
+				copiedBytes += sizes[r.Operation.SourcePath]
+			}
+			progress.Report(cfg.progress, progress.Event{
+				Stage: progress.StageCopy, Done: done, Total: len(opsToCopy),
+				Bytes: copiedBytes, TotalBytes: totalBytes, Current: r.Operation.SourcePath,
+			})
+		},
+	}
+
+	// On cancellation the finished results are still recorded; unfinished decisions keep their planned action.
+	var results []copy.Result
+	var copyErr error
+	if cfg.archive != "" {
+		results, copyErr = archive.Execute(ctx, opsToCopy, archive.Options{
+			Format:      cfg.archive,
+			Root:        res.Destination,
+			Checksum:    copyOpts.Checksum,
+			Source:      cfg.sourceFS,
+			Destination: cfg.destFS,
+			CreatedAt: func(source string) time.Time {
+				if best := res.Details[source].Best; best.Source != createdat.SourceUnknown {
+					return best.CreatedAt
+				}
+				return time.Time{}
+			},
+			OnStart:  copyOpts.OnStart,
+			OnResult: copyOpts.OnResult,
+		})
+	} else {
+		results, copyErr = copy.Execute(ctx, opsToCopy, copyOpts)
+	}
+	files.end(copyErr)
+	copyErr = errors.Join(copyErr, recordErr)
+	resultBySource := make(map[string]copy.Result, len(results))
+	for _, r := range results {
+		resultBySource[r.Operation.SourcePath] = r
+	}
+
+	for i := range decisions {
+		d := decisions[i]
+		if d.Action != reconcile.ActionCopy && d.Action != reconcile.ActionCopyRenamed {
+			continue
+		}
+		r, ok := resultBySource[d.SourcePath]
+		if !ok && copyErr != nil {
+			continue
+		}
+		if !ok {
+			decisions[i].Action = reconcile.ActionFailed
+			decisions[i].Error = fmt.Errorf("missing copy result")
+			cfg.events.error(d.SourcePath, decisions[i].Error)
+			cfg.events.decision(decisions[i])
+			continue
+		}
+		if r.Success {
+			if t, ok := written[d.SourcePath]; ok {
+				if res.DatesWritten == nil {
+					res.DatesWritten = make(map[string]time.Time)
+				}
+				res.DatesWritten[d.SourcePath] = t
+			}
+			if d.Action == reconcile.ActionCopyRenamed {
+				decisions[i].Action = reconcile.ActionCopiedRenamed
+			} else {
+				decisions[i].Action = reconcile.ActionCopied
+			}
+			if r.PartialError != nil {
+				// The file is moved; what followed it failed.
+				decisions[i].Error = r.PartialError
+				res.Warnings = append(res.Warnings, fmt.Sprintf("%s was moved, but: %v", d.SourcePath, r.PartialError))
+				cfg.events.error(d.SourcePath, r.PartialError)
+			}
+		} else {
+			decisions[i].Action = reconcile.ActionFailed
+			decisions[i].Error = r.Error
+			cfg.events.error(d.SourcePath, r.Error)
+		}
+		cfg.events.decision(decisions[i])
+	}
+	return results, copyErr
+}
+
+// recordJournal adds the files of the successful copy r, the media file and its sidecars, to the
+// journal of the run; moved reports that the copy removed its source.
+func recordJournal(cfg config, r copy.Result, moved bool) error {
+	if cfg.journal == nil || cfg.archive != "" || !r.Success {
+		return nil
+	}
+	remote := !destfs.IsOS(cfg.sourceFS)
+	dst := destfs.OrOS(cfg.destFS)
+	entry := journal.Entry{
+		Source:       r.Operation.SourcePath,
+		Destination:  r.Operation.DestinationPath,
+		SHA256:       r.DestinationSHA256,
+		Moved:        moved,
+		RemoteSource: remote,
+	}
+	info, err := dst.Stat(entry.Destination)
+	if err != nil {
+		return fmt.Errorf("journal %s: %w", entry.Destination, err)
+	}
+	entry.Size = info.Size()
+	entries := []journal.Entry{entry}
+	for _, sc := range r.Operation.Sidecars {
+		size, sum, err := journal.HashFile(dst, sc.DestinationPath)
+		if err != nil {
+			return fmt.Errorf("journal %s: %w", sc.DestinationPath, err)
+		}
+		// A generated sidecar, or one extracted from the media file, has no source of its own to move
+		// back to: undo removes it.
+		derived := sc.Content != nil || sc.Transform != nil || sc.SourcePath == ""
+		entries = append(entries, journal.Entry{
+			Source: sc.SourcePath, Destination: sc.DestinationPath, Size: size, SHA256: sum,
+			Moved: moved && !derived, RemoteSource: remote,
+		})
+	}
+	return cfg.journal.Append(entries...)
+}
+
+// exifTransform returns the copy transform that writes best into the DateTimeOriginal of the copy
+// of source and records it in written. It returns nil when there is nothing to write: the date comes
+// from the modification time, which every copy keeps anyway, or from the directory of an earlier layout,
+// which holds only the day, or the format is not supported.
+func exifTransform(source string, best createdat.Result, written map[string]time.Time) func([]byte) ([]byte, error) {
+	switch best.Source {
+	case createdat.SourceMtime, createdat.SourceDirectory, createdat.SourceUnknown:
+		return nil
+	}
+	if !exifwrite.Supported(source) {
+		return nil
+	}
+	return func(data []byte) ([]byte, error) {
+		out, err := exifwrite.SetDateTimeOriginal(data, best.CreatedAt)
+		switch {
+		case errors.Is(err, exifwrite.ErrPresent), errors.Is(err, exifwrite.ErrUnsupported):
+			return data, nil
+		case err != nil:
+			return nil, &errcode.FileError{Op: "write exif", Path: source, Kind: errcode.ErrMetadataCorrupt, Err: err}
+		}
+		written[source] = best.CreatedAt
+		return out, nil
+	}
+}
+
+// indexLibrary groups the media files already in a library by size.
+// A library that does not exist yet is empty.
+func indexLibrary(ctx context.Context, fsys destfs.FS, root string, trashDirs []string) (map[int64][]string, error) {
+	index := make(map[int64][]string)
+	if _, err := fsys.Stat(root); errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+
+	scanOpts := scan.DefaultOptions()
+	scanOpts.IgnoreFile = scan.IgnoreFile
+	scanOpts.ExcludeDirs = trashDirs
+	records, err := scan.ScanRecords(ctx, destfs.DirFS(fsys, root), ".", scanOpts)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		index[r.FileSizeBytes] = append(index[r.FileSizeBytes], filepath.Join(root, filepath.FromSlash(r.Path)))
+	}
+	return index, nil
+}
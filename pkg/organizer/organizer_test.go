@@ -0,0 +1,2802 @@
+package organizer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+	"github.com/quidome/media-organizer-go/pkg/archive"
+	"github.com/quidome/media-organizer-go/pkg/burst"
+	"github.com/quidome/media-organizer-go/pkg/cache"
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/checkpoint"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/edits"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/exifwrite"
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/hook"
+	"github.com/quidome/media-organizer-go/pkg/journal"
+	"github.com/quidome/media-organizer-go/pkg/manifest"
+	"github.com/quidome/media-organizer-go/pkg/motionphoto"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/profile"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/review"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+	"github.com/quidome/media-organizer-go/pkg/track"
+	"github.com/quidome/media-organizer-go/pkg/trash"
+	"github.com/quidome/media-organizer-go/pkg/volume"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return p
+}
+
+func TestRun_DryRunPlansWithoutWriting(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240102_030406.jpg", "a")
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	counts := res.Counts()
+	if counts[reconcile.ActionCopy] != 1 || counts[reconcile.ActionSkippedDuplicateSrc] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Fatalf("dry-run wrote %d entries to destination", len(entries))
+	}
+}
+
+func TestRun_ExecuteCopies(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	res, err := Run(context.Background(), src, dst, WithExecute(true), WithoutDedupe())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionCopied {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	if _, err := os.Stat(res.Decisions[0].FinalDestinationPath); err != nil {
+		t.Fatalf("file was not copied: %v", err)
+	}
+	if res.Sizes[res.Decisions[0].SourcePath] != 1 {
+		t.Fatalf("size not recorded: %v", res.Sizes)
+	}
+}
+
+func TestRun_CanceledContext(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Run(ctx, src, dst, WithExecute(true)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Fatalf("canceled run wrote to destination: %v", entries)
+	}
+}
+
+func TestRunSources_LibraryDedupe(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "same")
+	writeFile(t, dst, "existing.jpg", "same")
+
+	res, err := RunSources(context.Background(), []string{src}, dst, WithLibraryDedupe())
+	if err != nil {
+		t.Fatalf("RunSources: %v", err)
+	}
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionSkippedIdentical {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+}
+
+func TestRun_InPlace(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, dir, "IMG_20240102_030405.xmp", "x")
+	placed := filepath.Join(dir, "2024", "01", "03")
+	if err := os.MkdirAll(placed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, placed, "IMG_20240103_030405.jpg", "b")
+
+	if _, err := Run(context.Background(), dir, dir); err == nil {
+		t.Fatalf("expected an error organizing a directory into itself without WithInPlace")
+	}
+
+	res, err := Run(context.Background(), dir, dir, WithInPlace(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	counts := res.Counts()
+	if counts[reconcile.ActionCopied] != 1 || counts[reconcile.ActionSkippedIdentical] != 1 || !res.InPlace {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	moved := filepath.Join(dir, "2024", "01", "02")
+	for _, name := range []string{"IMG_20240102_030405.jpg", "IMG_20240102_030405.xmp"} {
+		if _, err := os.Stat(filepath.Join(moved, name)); err != nil {
+			t.Errorf("%s was not moved: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s is still in the root: %v", name, err)
+		}
+	}
+
+	// A second run finds everything in place, and leaves the trash of the library alone.
+	trashed := filepath.Join(dir, trash.DirName, "20240101T000000")
+	if err := os.MkdirAll(trashed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, trashed, "IMG_20240104_030405.jpg", "c")
+	res, err = Run(context.Background(), dir, dir, WithInPlace(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionSkippedIdentical] != 2 || len(res.Decisions) != 2 {
+		t.Fatalf("unexpected decisions of the second run: %+v", res.Decisions)
+	}
+
+	// A trash in another directory of the library is left alone too.
+	removed := filepath.Join(dir, "Removed", "20240101T000000")
+	if err := os.MkdirAll(removed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, removed, "IMG_20240105_030405.jpg", "d")
+	bin := trash.Dir{Path: filepath.Join(dir, "Removed", "20240201T000000"), Root: dir}
+	res, err = Run(context.Background(), dir, dir, WithInPlace(), WithTrash(bin), WithExecute(true))
+	if err != nil {
+		t.Fatalf("third Run: %v", err)
+	}
+	if len(res.Decisions) != 2 {
+		t.Fatalf("expected the trash in Removed left alone, got %+v", res.Decisions)
+	}
+}
+
+func TestRun_Move(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	media := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	xmp := writeFile(t, src, "IMG_20240102_030405.xmp", "x")
+	duplicate := writeFile(t, src, "IMG_20240102_030405_1.jpg", "a")
+
+	res, err := Run(context.Background(), src, dst, WithMove(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionCopied] != 1 || counts[reconcile.ActionSkippedDuplicateSrc] != 1 || !res.Moved {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	placed := filepath.Join(dst, "2024", "01", "02")
+	for _, p := range []string{media, xmp} {
+		if _, err := os.Stat(filepath.Join(placed, filepath.Base(p))); err != nil {
+			t.Errorf("%s was not moved: %v", filepath.Base(p), err)
+		}
+		if _, err := os.Stat(p); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s is still in the source: %v", filepath.Base(p), err)
+		}
+	}
+	if _, err := os.Stat(duplicate); err != nil {
+		t.Errorf("expected the duplicate to stay in the source: %v", err)
+	}
+
+	// Across filesystems the file is copied and verified before its source is removed.
+	other := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+	mem := destfs.NewMem()
+	if err := mem.MkdirAll("/library", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(context.Background(), src, "/library", WithMove(), WithExecute(true), WithDestinationFS(mem)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got, err := mem.ReadFile(filepath.Join("/library", "2024", "01", "03", "IMG_20240103_030405.jpg")); err != nil || string(got) != "b" {
+		t.Errorf("expected the copy on the destination, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(other); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to be removed: %v", err)
+	}
+
+	if _, err := Run(context.Background(), src, dst, WithMove(), WithArchive(archive.FormatTar, archive.PeriodYear), WithExecute(true)); err == nil {
+		t.Error("expected moving into archives to be refused")
+	}
+}
+
+func TestRun_MoveToTrash(t *testing.T) {
+	src := t.TempDir()
+	media := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	bin := trash.Dir{Path: filepath.Join(t.TempDir(), "trash")}
+	mem := destfs.NewMem()
+	if err := mem.MkdirAll("/library", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Run(context.Background(), src, "/library", WithMove(), WithTrash(bin), WithExecute(true), WithDestinationFS(mem)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := os.Stat(media); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the source to leave the source directory: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(bin.Path, filepath.Base(media))); err != nil || string(got) != "a" {
+		t.Errorf("expected the source in the trash, got %q, %v", got, err)
+	}
+
+	if _, err := Run(context.Background(), src, t.TempDir(), WithTrash(bin), WithExecute(true)); err == nil {
+		t.Error("expected a trash without moving to be refused")
+	}
+}
+
+func TestRun_Link(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	media := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	xmp := writeFile(t, src, "IMG_20240102_030405.xmp", "x")
+
+	res, err := Run(context.Background(), src, dst, WithLink(copy.LinkHard), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionCopied] != 1 || res.Linked != copy.LinkHard {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	placed := filepath.Join(dst, "2024", "01", "02")
+	for _, p := range []string{media, xmp} {
+		srcInfo, err1 := os.Stat(p)
+		dstInfo, err2 := os.Stat(filepath.Join(placed, filepath.Base(p)))
+		if err1 != nil || err2 != nil || !os.SameFile(srcInfo, dstInfo) {
+			t.Errorf("expected %s to be hard linked: %v, %v", filepath.Base(p), err1, err2)
+		}
+	}
+
+	// A second run finds the links it made.
+	res, err = Run(context.Background(), src, dst, WithLink(copy.LinkHard), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionSkippedIdentical] != 1 {
+		t.Fatalf("expected the link to be skipped as identical, got %+v", res.Decisions)
+	}
+
+	if _, err := Run(context.Background(), src, dst, WithLink(copy.LinkSym), WithMove()); err == nil {
+		t.Error("expected linking and moving to be refused")
+	}
+	if _, err := Run(context.Background(), src, "/library", WithLink(copy.LinkSym), WithDestinationFS(destfs.NewMem())); err == nil {
+		t.Error("expected linking into a remote destination to be refused")
+	}
+}
+
+// flakyFS stores every write to the files it creates with its first byte flipped, like a destination
+// that corrupts data in transit.
+type flakyFS struct {
+	*destfs.Mem
+}
+
+func (f flakyFS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	file, err := f.Mem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return flakyFile{file}, nil
+}
+
+type flakyFile struct {
+	destfs.File
+}
+
+func (f flakyFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	q := append([]byte{p[0] ^ 0xff}, p[1:]...)
+	return f.File.Write(q)
+}
+
+func TestRun_Verify(t *testing.T) {
+	src := t.TempDir()
+	path := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	dst := flakyFS{destfs.NewMem()}
+	if err := dst.MkdirAll("/library", 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), src, "/library", WithExecute(true), WithVerify(), WithDestinationFS(dst))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionFailed || errcode.Of(res.Decisions[0].Error) != errcode.VerifyFailed {
+		t.Fatalf("expected the corrupted copy to fail with E_VERIFY_FAILED, got %+v", res.Decisions)
+	}
+	if _, err := dst.Stat(res.Decisions[0].FinalDestinationPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the corrupted copy to be removed, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the source to stay: %v", err)
+	}
+
+	if _, err := Run(context.Background(), src, t.TempDir(), WithVerify(), WithArchive(archive.FormatTar, archive.PeriodYear), WithExecute(true)); err == nil {
+		t.Error("expected verifying archives to be refused")
+	}
+}
+
+func TestRun_Journal(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	media := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	xmp := writeFile(t, src, "IMG_20240102_030405.xmp", "x")
+	w, err := journal.Create(nil, filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(context.Background(), src, dst, WithMove(), WithJournal(w), WithExecute(true)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	w.Close()
+
+	entries, err := journal.Read(nil, w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	placed := filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if len(entries) != 2 || entries[0].Source != media || entries[0].Destination != placed || !entries[0].Moved ||
+		entries[0].Size != 1 || entries[1].Source != xmp {
+		t.Fatalf("unexpected journal: %+v", entries)
+	}
+
+	// Undoing the run moves the files back.
+	if _, err := journal.Undo(context.Background(), nil, dst, entries, nil); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	for _, p := range []string{media, xmp} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s was not moved back: %v", filepath.Base(p), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the emptied directories to be removed: %v", err)
+	}
+}
+
+func TestRun_JournalDerivedSidecars(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	video := "\x00\x00\x00\x10ftypmp42\x00\x00\x00\x00moov"
+	xmp := "http://ns.adobe.com/xap/1.0/\x00" + fmt.Sprintf(`<rdf:Description GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d"/>`, len(video))
+	photo := "\xFF\xD8\xFF\xE1" + string(binary.BigEndian.AppendUint16(nil, uint16(len(xmp)+2))) + xmp + "\xFF\xD9" + video
+	motion := writeFile(t, src, "PXL_20240102_030405123.MP.jpg", photo)
+	bare := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+	w, err := journal.Create(nil, filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Run(context.Background(), src, dst, WithMove(), WithMotionPhotos(motionphoto.PolicyExtract),
+		WithProfile(profile.Immich), WithJournal(w), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	w.Close()
+	entries, err := journal.Read(nil, w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The photos are moved back; the extracted video and the generated XMP sidecars are removed.
+	results, err := journal.Undo(context.Background(), nil, dst, entries, nil)
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("undo %s: %v", r.Entry.Destination, r.Err)
+		}
+	}
+	for p, want := range map[string]string{motion: photo, bare: "b"} {
+		if got, err := os.ReadFile(p); err != nil || string(got) != want {
+			t.Errorf("%s was not moved back: %q, %v", filepath.Base(p), got, err)
+		}
+	}
+	if names, _ := os.ReadDir(src); len(names) != 2 {
+		t.Errorf("expected only the two photos back in the source, got %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the library emptied: %v", err)
+	}
+}
+
+func TestApply_MoveWithFailedSidecar(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	media := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	xmp := writeFile(t, src, "IMG_20240102_030405.xmp", "x")
+	planned, err := Plan(context.Background(), []string{src}, dst, WithMove())
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	// Another run writes the sidecar destination in the meantime.
+	placed := filepath.Join(dst, "2024", "01", "02")
+	if err := os.MkdirAll(placed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, placed, "IMG_20240102_030405.xmp", "other")
+	w, err := journal.Create(nil, filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Apply(context.Background(), planned, WithJournal(w), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	w.Close()
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionCopied || res.Decisions[0].Error == nil || len(res.Warnings) != 1 {
+		t.Fatalf("expected the file moved with its sidecar failure reported, got %+v, warnings %v", res.Decisions, res.Warnings)
+	}
+	if _, err := os.Stat(media); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the media file moved: %v", err)
+	}
+	if _, err := os.Stat(xmp); err != nil {
+		t.Errorf("expected the sidecar kept in the source: %v", err)
+	}
+	entries, err := journal.Read(nil, w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Source != media || !entries[0].Moved {
+		t.Errorf("expected the moved media file journaled, got %+v", entries)
+	}
+}
+
+func TestRun_Resume(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, name := range []string{"IMG_20240102_030405.jpg", "IMG_20240103_030405.jpg", "IMG_20240104_030405.jpg"} {
+		writeFile(t, src, name, name)
+	}
+
+	// The run is interrupted after its first copy.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var first copy.Result
+	events := Events{OnCopyDone: func(r copy.Result) {
+		first = r
+		cancel()
+	}}
+	if _, err := Run(ctx, src, dst, WithEvents(events), WithExecute(true)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want %v", err, context.Canceled)
+	}
+	entries, err := checkpoint.Read(nil, filepath.Join(dst, checkpoint.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Source != first.Operation.SourcePath || entries[0].Destination != first.Operation.DestinationPath {
+		t.Fatalf("unexpected checkpoint: %+v", entries)
+	}
+
+	// The copy is trusted by its size and time, without reading it.
+	info, err := os.Stat(first.Operation.DestinationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(first.Operation.DestinationPath, bytes.Repeat([]byte("x"), int(info.Size())), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(first.Operation.DestinationPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), src, dst, WithResume(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("resumed Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		want := reconcile.ActionCopied
+		if d.SourcePath == first.Operation.SourcePath {
+			want = reconcile.ActionSkippedIdentical
+		}
+		if d.Action != want {
+			t.Errorf("%s: got %s, want %s", filepath.Base(d.SourcePath), d.Action, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, checkpoint.FileName)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the checkpoint of the finished run to be removed: %v", err)
+	}
+
+	// Without a checkpoint every file is organized again.
+	res, err = Run(context.Background(), src, dst, WithResume())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "no checkpoint") {
+		t.Errorf("expected a warning about the missing checkpoint, got %q", res.Warnings)
+	}
+}
+
+// movieCreatedAt returns a minimal MP4 whose movie header records created.
+func movieCreatedAt(created time.Time) []byte {
+	mvhd := make([]byte, 20)
+	epoch := time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	binary.BigEndian.PutUint32(mvhd[4:], uint32(created.Sub(epoch)/time.Second))
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(mvhd)+16))
+	data = append(data, "moov"...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(mvhd)+8))
+	data = append(data, "mvhd"...)
+	return append(data, mvhd...)
+}
+
+func TestRun_Cache(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	c, err := cache.Open(context.Background(), filepath.Join(t.TempDir(), cache.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	clip := writeFile(t, src, "clip.mp4", string(movieCreatedAt(time.Date(2023, 7, 14, 12, 0, 0, 0, time.UTC))))
+	info, err := os.Stat(clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirOf := func(res Result) string {
+		t.Helper()
+		if len(res.Decisions) != 1 {
+			t.Fatalf("unexpected decisions: %+v", res.Decisions)
+		}
+		rel, _ := filepath.Rel(dst, filepath.Dir(res.Decisions[0].DestinationPath))
+		return filepath.ToSlash(rel)
+	}
+
+	res, err := Run(context.Background(), src, dst, WithCache(c))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := dirOf(res); got != "2023/07/14" {
+		t.Fatalf("got %s", got)
+	}
+
+	// A file rewritten with the same size and modification time is taken to be unchanged.
+	writeFile(t, src, "clip.mp4", string(movieCreatedAt(time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC))))
+	if err := os.Chtimes(clip, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Run(context.Background(), src, dst, WithCache(c))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := dirOf(res); got != "2023/07/14" {
+		t.Errorf("expected the cached date, got %s", got)
+	}
+
+	// Once its modification time changes it is read again.
+	if err := os.Chtimes(clip, info.ModTime(), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	res, err = Run(context.Background(), src, dst, WithCache(c))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := dirOf(res); got != "2021/03/04" {
+		t.Errorf("expected the date of the changed file, got %s", got)
+	}
+}
+
+func TestRun_RawDatedBySidecar(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "card"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, src, "card/DSC_0001.NEF", "raw")
+	writeFile(t, src, "card/DSC_0001.xmp", `<rdf:Description xmp:CreateDate="2019-06-07T08:09:10"/>`)
+
+	res, err := Run(context.Background(), src, dst, WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionCopied] != 1 {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	for _, name := range []string{"DSC_0001.NEF", "DSC_0001.xmp"} {
+		if _, err := os.Stat(filepath.Join(dst, "2019", "06", "07", name)); err != nil {
+			t.Errorf("expected %s in the directory of the sidecar date: %v", name, err)
+		}
+	}
+}
+
+func TestRun_IgnoreFile(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, src, "IMG_20230102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240102_030405.jpg", "b")
+	dest := t.TempDir()
+	// A curated year of the library, holding a copy of a source.
+	curated := filepath.Join(dest, "2024")
+	if err := os.MkdirAll(curated, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, curated, scan.IgnoreFile, "")
+	writeFile(t, curated, "favorite.jpg", "a")
+
+	res, err := Run(context.Background(), src, dest, WithLibraryDedupe())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch filepath.Base(d.SourcePath) {
+		case "IMG_20230102_030405.jpg":
+			if d.Action != reconcile.ActionCopy {
+				t.Errorf("expected the copy in the ignored directory not to count, got %+v", d)
+			}
+		case "IMG_20240102_030405.jpg":
+			if d.Action != reconcile.ActionFailed || errcode.Of(d.Error) != errcode.DestIgnored {
+				t.Errorf("expected a file planned into the ignored directory to fail, got %+v", d)
+			}
+		}
+	}
+
+	// An in-place run leaves the ignored directory alone.
+	res, err = Run(context.Background(), dest, dest, WithInPlace())
+	if err != nil {
+		t.Fatalf("in-place Run: %v", err)
+	}
+	if len(res.Decisions) != 0 {
+		t.Errorf("expected the ignored directory not to be organized, got %+v", res.Decisions)
+	}
+}
+
+func TestRun_PreviousLayout(t *testing.T) {
+	lib := t.TempDir()
+	for _, dir := range []string{filepath.Join("2023", "05", "06"), filepath.Join("2022", "01", "01")} {
+		if err := os.MkdirAll(filepath.Join(lib, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept := writeFile(t, lib, filepath.Join("2023", "05", "06", "a.jpg"), "a")
+	mtime := time.Date(2023, 5, 6, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(kept, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	reset := writeFile(t, lib, filepath.Join("2022", "01", "01", "b.jpg"), "b")
+
+	monthly, err := plan.ParseNamedLayout("monthly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), lib, lib, WithInPlace(), WithPreviousLayout(plan.Layout{}), WithLayout(monthly))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if best := res.Details[kept].Best; best.Source != createdat.SourceMtime || !best.CreatedAt.Equal(mtime) {
+		t.Errorf("expected the modification time within the directory's day to be kept, got %+v", best)
+	}
+	want := time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)
+	if best := res.Details[reset].Best; best.Source != createdat.SourceDirectory || !best.CreatedAt.Equal(want) {
+		t.Errorf("expected the directory date, got %+v", best)
+	}
+}
+
+func TestRun_Timezones(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"phone", filepath.Join("camera", "travel")} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	phone := writeFile(t, src, filepath.Join("phone", "IMG_20240102_003000.jpg"), "a")
+	camera := writeFile(t, src, filepath.Join("camera", "IMG_20240102_003000.jpg"), "b")
+	travel := writeFile(t, src, filepath.Join("camera", "travel", "IMG_20240102_003000.jpg"), "c")
+
+	tokyo, utc := time.FixedZone("JST", 9*3600), time.FixedZone("UTC", 0)
+	res, err := Run(context.Background(), src, dst, WithTimezone("camera/travel/", utc), WithTimezone("camera", tokyo))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for path, loc := range map[string]*time.Location{phone: time.Local, camera: tokyo, travel: utc} {
+		want := time.Date(2024, 1, 2, 0, 30, 0, 0, loc)
+		if got := res.Details[path].Best.CreatedAt; !got.Equal(want) || got.Location() != loc {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRun_StrictDates(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	named := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	copied := writeFile(t, src, "holiday.jpg", "b")
+
+	res, err := Run(context.Background(), src, dst, WithStrictDates())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if best := res.Details[named].Best; best.Source != createdat.SourceFilename {
+		t.Errorf("expected the filename date, got %+v", best)
+	}
+	if d := res.Details[copied]; d.Best.Source != createdat.SourceUnknown || d.Filestat.IsZero() {
+		t.Errorf("expected no date but the modification time as a candidate, got %+v", d)
+	}
+	for _, d := range res.Decisions {
+		if d.SourcePath == copied && d.DestinationPath != filepath.Join(dst, reconcile.DefaultUnknownDir, "holiday.jpg") {
+			t.Errorf("expected the file in the unknown directory, got %s", d.DestinationPath)
+		}
+	}
+}
+
+func TestRun_Review(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	named := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	copied := writeFile(t, src, "holiday.jpg", "b")
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.Local)
+	if err := os.Chtimes(copied, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), src, dst, WithReview(createdat.ConfidenceMedium), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		named:  filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg"),
+		copied: filepath.Join(dst, reconcile.DefaultReviewDir, "2021", "06", "07", "holiday.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+
+	data, err := os.ReadFile(review.NotePath(want[copied]))
+	if err != nil {
+		t.Fatalf("expected a review note: %v", err)
+	}
+	var note review.Note
+	if err := json.Unmarshal(data, &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.SourcePath != copied || note.BestSource != "mtime" || note.Confidence != "low" {
+		t.Errorf("unexpected note %+v", note)
+	}
+	if _, err := os.Stat(review.NotePath(want[named])); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no note for a trusted date, got %v", err)
+	}
+}
+
+func TestRun_DateCheck(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	named := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	reset := writeFile(t, src, "IMG_19800101_000000.jpg", "b")
+	future := writeFile(t, src, "clip.mp4", "c")
+	later := time.Now().AddDate(1, 0, 0)
+	if err := os.Chtimes(future, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(context.Background(), src, dst, WithDateCheck(createdat.DefaultSanity(time.Now())), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		named:  filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg"),
+		reset:  filepath.Join(dst, reconcile.DefaultReviewDir, "1980", "01", "01", "IMG_19800101_000000.jpg"),
+		future: filepath.Join(dst, reconcile.DefaultReviewDir, later.Format("2006"), later.Format("01"), later.Format("02"), "clip.mp4"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if len(res.SuspiciousDates) != 2 || res.SuspiciousDates[reset] != "dated 1980-01-01, before 1990-01-01" {
+		t.Errorf("unexpected suspicious dates %v", res.SuspiciousDates)
+	}
+
+	note, err := review.ReadNote(review.NotePath(want[reset]))
+	if err != nil {
+		t.Fatalf("expected a review note: %v", err)
+	}
+	if note.SourcePath != reset || note.Reason != res.SuspiciousDates[reset] {
+		t.Errorf("unexpected note %+v", note)
+	}
+}
+func TestRun_Incomplete(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	empty := writeFile(t, src, "IMG_20240102_030405.jpg", "")
+	emptyVideo := writeFile(t, src, "VID_20240102_030405.mp4", "")
+	truncated := writeFile(t, src, "IMG_20240102_030406.jpg", "\xFF\xD8\xFF\xDA\x00\x02\x01\x02")
+	complete := writeFile(t, src, "IMG_20240102_030407.jpg", "\xFF\xD8\xFF\xDA\x00\x02\x01\x02\xFF\xD9")
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]errcode.Code{empty: errcode.EmptyFile, emptyVideo: errcode.EmptyFile, truncated: errcode.Truncated, complete: ""}
+	for _, d := range res.Decisions {
+		if code := errcode.Of(d.Error); code != want[d.SourcePath] {
+			t.Errorf("%s: %s (%v), want %q", filepath.Base(d.SourcePath), d.Action, d.Error, want[d.SourcePath])
+		}
+	}
+
+	res, err = Run(context.Background(), src, dst, WithAllowIncomplete())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		if d.Action == reconcile.ActionFailed {
+			t.Errorf("%s failed with WithAllowIncomplete: %v", d.SourcePath, d.Error)
+		}
+	}
+}
+
+func TestRun_SkipsNestedDestination(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(src, "library")
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	for run := 0; run < 2; run++ {
+		res, err := Run(context.Background(), src, dst, WithExecute(true))
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if len(res.Decisions) != 1 {
+			t.Fatalf("run %d: expected only the source outside the destination, got %+v", run, res.Decisions)
+		}
+		if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "is inside source") {
+			t.Errorf("run %d: expected a warning about the nested destination, got %q", run, res.Warnings)
+		}
+	}
+}
+
+func TestRun_DestinationPreflight(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	file := writeFile(t, t.TempDir(), "library", "not a directory")
+	if _, err := Run(context.Background(), src, filepath.Join(file, "photos"), WithExecute(true)); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("expected an error for a destination below a file, got %v", err)
+	}
+
+	// A library organized by month, and a run by day.
+	dst := t.TempDir()
+	for _, name := range []string{"2023/05/IMG_1.jpg", "2023/06/IMG_2.jpg", "2024/01/VID_3.mp4", ".thumbnails/x.jpg"} {
+		if err := os.MkdirAll(filepath.Join(dst, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, dst, name, name)
+	}
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "looks organized as {year}/{month}, not {year}/{month}/{day}") {
+		t.Errorf("expected a warning about the layout, got %q", res.Warnings)
+	}
+	monthly, err := plan.ParseNamedLayout("monthly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := Run(context.Background(), src, dst, WithLayout(monthly)); err != nil || len(res.Warnings) != 0 {
+		t.Errorf("expected no warnings for the layout of the library, got %q, %v", res.Warnings, err)
+	}
+}
+
+func TestRun_PathLimits(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	res, err := Run(context.Background(), src, dst, WithPathLimits(plan.PathLimits{MaxDepth: 2}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg"); res.Decisions[0].DestinationPath != want {
+		t.Errorf("expected the path as planned, got %s", res.Decisions[0].DestinationPath)
+	}
+	if len(res.Warnings) != 1 || !strings.HasSuffix(res.Warnings[0], "exceeds at most 2 directories; shorten paths to fit them") {
+		t.Errorf("expected a warning about the path, got %q", res.Warnings)
+	}
+
+	limits := plan.PathLimits{MaxLength: 25, MaxDepth: 2, Shorten: true}
+	for run := 1; run <= 2; run++ {
+		res, err := Run(context.Background(), src, dst, WithPathLimits(limits), WithExecute(true))
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if len(res.Warnings) != 0 {
+			t.Errorf("run %d: unexpected warnings %q", run, res.Warnings)
+		}
+		want := reconcile.ActionCopied
+		if run == 2 {
+			want = reconcile.ActionSkippedIdentical
+		}
+		if d := res.Decisions[0]; d.Action != want || d.DestinationPath != filepath.Join(dst, "2024", "01-02", "IMG_202401.jpg") {
+			t.Errorf("run %d: got %s %s", run, d.Action, d.DestinationPath)
+		}
+	}
+
+	limits.MaxLength = 20
+	res, err = Run(context.Background(), src, dst, WithPathLimits(limits))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "even shortened") {
+		t.Errorf("expected a warning about a path too long to shorten, got %q", res.Warnings)
+	}
+}
+
+func TestRun_BatchSize(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(src, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, src, filepath.Join("a", "IMG_20240102_030405.jpg"), "first")
+	writeFile(t, src, filepath.Join("a", "IMG_20240102_030406.jpg"), "second")
+	// The same name and date as a file of an earlier batch, another content.
+	writeFile(t, src, filepath.Join("b", "IMG_20240102_030405.jpg"), "other")
+	// A copy of a file of an earlier batch.
+	writeFile(t, src, filepath.Join("c", "IMG_20250101_000000.jpg"), "first")
+
+	for _, execute := range []bool{false, true} {
+		var batches []int
+		var decisions []reconcile.Decision
+		events := Events{OnBatch: func(res Result) {
+			batches = append(batches, len(res.Decisions))
+			decisions = append(decisions, res.Decisions...)
+		}}
+		res, err := Run(context.Background(), src, dst, WithBatchSize(1), WithEvents(events), WithExecute(execute))
+		if err != nil {
+			t.Fatalf("execute %v: %v", execute, err)
+		}
+		if fmt.Sprint(batches) != "[2 1 1]" {
+			t.Errorf("execute %v: expected batches of whole directories, got %v", execute, batches)
+		}
+		if len(res.Decisions) != 0 || len(res.Sizes) != 0 || res.Totals().Files != 4 {
+			t.Fatalf("execute %v: expected only the totals of the batches, got %+v and %+v", execute, res.Decisions, res.Totals())
+		}
+
+		destinations := make(map[string]bool)
+		for _, d := range decisions {
+			if execute {
+				// The copy of a later batch is renamed on collision.
+				d.DestinationPath = d.FinalDestinationPath
+			}
+			switch {
+			case strings.HasPrefix(d.SourcePath, filepath.Join(src, "c")):
+				if d.Action != reconcile.ActionSkippedDuplicateSrc || d.DuplicateOf != filepath.Join(src, "a", "IMG_20240102_030405.jpg") {
+					t.Errorf("execute %v: expected a duplicate of the first batch, got %+v", execute, d)
+				}
+			case destinations[d.DestinationPath]:
+				t.Errorf("execute %v: %s planned twice", execute, d.DestinationPath)
+			default:
+				destinations[d.DestinationPath] = true
+			}
+		}
+		if execute {
+			if counts := res.Counts(); counts[reconcile.ActionCopied]+counts[reconcile.ActionCopiedRenamed] != 3 {
+				t.Errorf("expected 3 copies, got %v", counts)
+			}
+		}
+	}
+}
+
+func TestRun_BatchSizeBoundsRetainedState(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	const dirs = 5
+	for i := range dirs {
+		dir := filepath.Join(src, fmt.Sprintf("d%d", i))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, dir, fmt.Sprintf("IMG_2024010%d_030405.jpg", i+1), fmt.Sprint(i))
+	}
+	writeFile(t, filepath.Join(src, "d0"), "empty.jpg", "")
+
+	scanned, batches := 0, 0
+	events := Events{
+		OnScanned: func(string, scan.Record) { scanned++ },
+		OnBatch: func(res Result) {
+			batches++
+			// Files are discovered as their batch is planned, not all up front; d0 holds two.
+			if scanned > batches+1 {
+				t.Errorf("batch %d: %d files discovered", batches, scanned)
+			}
+		},
+	}
+	res, err := Run(context.Background(), src, dst, WithBatchSize(1), WithEvents(events), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if batches != dirs {
+		t.Fatalf("expected %d batches, got %d", dirs, batches)
+	}
+
+	// Only the failed file is kept; every other file is counted.
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionFailed || len(res.Sizes) != 1 {
+		t.Fatalf("expected only the failed decision to be kept, got %+v", res.Decisions)
+	}
+	totals := res.Totals()
+	if totals.Files != dirs+1 || totals.Actions[reconcile.ActionCopied] != dirs || totals.BytesCopied != dirs {
+		t.Errorf("unexpected totals %+v", totals)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionCopied] != dirs || counts[reconcile.ActionFailed] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestRun_Overlap(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(src, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, src, filepath.Join("a", "IMG_20240102_030405.jpg"), "first")
+	writeFile(t, src, filepath.Join("a", "IMG_20240102_030406.jpg"), "second")
+	// Planned while the first batch may still be copied to the same name.
+	writeFile(t, src, filepath.Join("b", "IMG_20240102_030405.jpg"), "other")
+	writeFile(t, src, filepath.Join("c", "IMG_20250101_000000.jpg"), "first")
+
+	var batches []int
+	var copied int
+	events := Events{
+		OnBatch:    func(res Result) { batches = append(batches, len(res.Decisions)) },
+		OnCopyDone: func(copy.Result) { copied++ },
+	}
+	res, err := Run(context.Background(), src, dst, WithBatchSize(1), WithOverlap(), WithEvents(events), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if fmt.Sprint(batches) != "[2 1 1]" || copied != 3 {
+		t.Errorf("expected every batch in order and 3 copies, got %v and %d", batches, copied)
+	}
+	if counts := res.Counts(); counts[reconcile.ActionCopied]+counts[reconcile.ActionCopiedRenamed] != 3 || counts[reconcile.ActionSkippedDuplicateSrc] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	for name, want := range map[string]string{"IMG_20240102_030405.jpg": "first", "IMG_20240102_030405_1.jpg": "other", "IMG_20240102_030406.jpg": "second"} {
+		if got, err := os.ReadFile(filepath.Join(dst, "2024", "01", "02", name)); err != nil || string(got) != want {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	if _, err := Run(context.Background(), src, src, WithOverlap(), WithInPlace(), WithExecute(true)); err == nil {
+		t.Error("expected overlapping batches of an in-place run to be refused")
+	}
+}
+
+// gatedFS calls open before opening, and create before creating, the files named name; they return the
+// error to fail with, if any.
+type gatedFS struct {
+	*destfs.Mem
+	name         string
+	open, create func() error
+}
+
+func (f gatedFS) Open(name string) (destfs.File, error) {
+	if path.Base(name) == f.name && f.open != nil {
+		if err := f.open(); err != nil {
+			return nil, err
+		}
+	}
+	return f.Mem.Open(name)
+}
+
+func (f gatedFS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	if path.Base(name) == f.name && flag&os.O_CREATE != 0 && f.create != nil {
+		if err := f.create(); err != nil {
+			return nil, err
+		}
+	}
+	return f.Mem.OpenFile(name, flag, perm)
+}
+
+func TestRun_OverlapFailedCopy(t *testing.T) {
+	// The second batch holds a duplicate of the file whose copy fails in the first batch, and is planned
+	// before or after that copy fails.
+	const duplicate = "/card/b/IMG_20250101_000000.jpg"
+	for _, plannedFirst := range []bool{true, false} {
+		src, dst := destfs.NewMem(), destfs.NewMem()
+		src.WriteFile("/card/a/IMG_20240102_030405.jpg", []byte("same"))
+		src.WriteFile(duplicate, []byte("same"))
+
+		wait := func(ch chan struct{}) {
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+			}
+		}
+		planned, failed := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		events := Events{OnDecision: func(d reconcile.Decision) {
+			if d.SourcePath == duplicate {
+				once.Do(func() { close(planned) })
+			}
+		}}
+		source := gatedFS{Mem: src, name: path.Base(duplicate), open: func() error {
+			if !plannedFirst {
+				wait(failed)
+			}
+			return nil
+		}}
+		destination := gatedFS{Mem: dst, name: "IMG_20240102_030405.jpg", create: func() error {
+			if plannedFirst {
+				wait(planned)
+			}
+			close(failed)
+			return errors.New("disk full")
+		}}
+
+		res, err := Run(context.Background(), "/card", "/library", WithBatchSize(1), WithOverlap(), WithEvents(events),
+			WithSourceFS(source), WithDestinationFS(destination), WithExecute(true))
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		// The duplicate is never counted as kept by a copy that failed.
+		if counts := res.Counts(); counts[reconcile.ActionSkippedDuplicateSrc] != 0 {
+			t.Errorf("planned first %v: expected no duplicate of the failed copy to be skipped, got %v", plannedFirst, counts)
+		}
+		failedSources := make(map[string]reconcile.Decision)
+		for _, d := range res.Decisions {
+			failedSources[d.SourcePath] = d
+		}
+		if _, ok := failedSources["/card/a/IMG_20240102_030405.jpg"]; !ok {
+			t.Errorf("planned first %v: expected the copy to fail, got %+v", plannedFirst, res.Decisions)
+		}
+		d, ok := failedSources[duplicate]
+		if plannedFirst && (!ok || !strings.Contains(fmt.Sprint(d.Error), "whose copy failed")) {
+			t.Errorf("expected the duplicate planned before the copy failed to fail, got %+v", res.Decisions)
+		}
+		if !plannedFirst {
+			if got, err := dst.ReadFile("/library/2025/01/01/IMG_20250101_000000.jpg"); err != nil || string(got) != "same" {
+				t.Errorf("expected the duplicate planned after the copy failed to be copied, got %q, %v (files: %v)", got, err, dst.Files())
+			}
+		}
+	}
+}
+
+func TestExecute_SourceChangedSincePlan(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	kept := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	syncing := writeFile(t, src, "IMG_20240102_030406.jpg", "partial")
+
+	res, err := Plan(context.Background(), []string{src}, dst)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if err := os.WriteFile(syncing, []byte("partial, now complete"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Execute(context.Background(), res); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch d.SourcePath {
+		case kept:
+			if d.Action != reconcile.ActionCopied {
+				t.Errorf("expected the unchanged file to be copied, got %+v", d)
+			}
+		case syncing:
+			if d.Action != reconcile.ActionFailed || errcode.Of(d.Error) != errcode.SourceChanged {
+				t.Errorf("expected the changed file to fail with E_SOURCE_CHANGED, got %+v", d)
+			}
+		}
+	}
+}
+
+func TestSpillIndex(t *testing.T) {
+	x, err := newSpillIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	long := strings.Repeat("x", 300)
+	for _, p := range []string{"/a.jpg", long, "/b.jpg"} {
+		if err := x.Add(int64(len(p)%2), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := x.Lookup(0)
+	if err != nil || len(entries) != 3 || entries[0].Path != "/a.jpg" || entries[1].Path != long || entries[2].Path != "/b.jpg" {
+		t.Fatalf("Lookup(0) = %+v, %v", entries, err)
+	}
+	if x.Count(0) != 3 || x.Count(1) != 0 {
+		t.Errorf("unexpected counts %d and %d", x.Count(0), x.Count(1))
+	}
+
+	header := [32]byte{1, 2, 3}
+	if err := x.SetHeader(entries[1], header); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = x.Lookup(0)
+	if err != nil || entries[1].Header != header || entries[1].Path != long || entries[2].Header != [32]byte{} {
+		t.Errorf("expected the header of the second entry, got %+v, %v", entries, err)
+	}
+}
+
+func TestPlannedPaths(t *testing.T) {
+	x, err := newSpillIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	p := &plannedPaths{index: x}
+	if err := p.add([]string{"/library/2024/a.jpg", "/library/2024/b.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{"/library/2024/a.jpg": true, "/library/2024/b.jpg": true, "/library/2024/c.jpg": false, "/library/2024": false} {
+		if got := p.Has(path); got != want {
+			t.Errorf("Has(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// Once the index cannot be read, every path is taken and adding fails.
+	x.f.Close()
+	if !p.Has("/library/2024/a.jpg") || !p.Has("/library/2024/c.jpg") {
+		t.Error("expected every path to be planned after a read error")
+	}
+	if err := p.add([]string{"/library/2024/d.jpg"}); err == nil {
+		t.Error("expected the read error from add")
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	a := writeFile(t, src, "a.jpg", "a")
+	b := writeFile(t, src, "b.jpg", "b")
+	c := writeFile(t, src, "c.jpg", "c")
+	d := writeFile(t, src, "d.jpg", "d")
+	if err := os.MkdirAll(filepath.Join(dst, "2024"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, filepath.Join("2024", "b.jpg"), "b")
+	writeFile(t, dst, filepath.Join("2024", "c.jpg"), "other")
+
+	previous := Result{
+		Decisions: []reconcile.Decision{
+			{SourcePath: a, DestinationPath: filepath.Join(dst, "2024", "a.jpg"), FinalDestinationPath: filepath.Join(dst, "2024", "a_1.jpg"), Action: reconcile.ActionFailed},
+			{SourcePath: b, DestinationPath: filepath.Join(dst, "2024", "b.jpg"), Action: reconcile.ActionFailed},
+			{SourcePath: c, DestinationPath: filepath.Join(dst, "2024", "c.jpg"), Action: reconcile.ActionFailed},
+			// Failed before a destination was planned.
+			{SourcePath: d, Action: reconcile.ActionFailed},
+			{SourcePath: d, DestinationPath: filepath.Join(dst, "2024", "d.jpg"), Action: reconcile.ActionCopied},
+		},
+		Sources:     []string{src},
+		Destination: dst,
+	}
+
+	res, err := RetryFailed(context.Background(), previous)
+	if err != nil {
+		t.Fatalf("RetryFailed: %v", err)
+	}
+	if len(res.Decisions) != 3 || res.Decisions[0].Action != reconcile.ActionCopyRenamed || res.Decisions[1].Action != reconcile.ActionSkippedIdentical {
+		t.Fatalf("unexpected dry-run decisions: %+v", res.Decisions)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024", "a_1.jpg")); err == nil {
+		t.Fatal("dry-run copied a file")
+	}
+
+	res, err = RetryFailed(context.Background(), previous, WithExecute(true))
+	if err != nil {
+		t.Fatalf("RetryFailed: %v", err)
+	}
+	want := []reconcile.Action{reconcile.ActionCopiedRenamed, reconcile.ActionSkippedIdentical, reconcile.ActionFailed}
+	for i, d := range res.Decisions {
+		if d.Action != want[i] {
+			t.Errorf("%s: expected %s, got %s (%v)", d.SourcePath, want[i], d.Action, d.Error)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "2024", "a_1.jpg")); err != nil || string(data) != "a" {
+		t.Errorf("expected a.jpg copied to its resolved destination, got %q, %v", data, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "2024", "c.jpg")); string(data) != "other" {
+		t.Errorf("expected the other content kept, got %q", data)
+	}
+}
+
+func TestApply(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	kept := writeFile(t, src, "IMG_20240102_030405.jpg", "kept")
+	writeFile(t, src, "IMG_20240102_030405.jpg.xmp", "<xmp/>")
+	changed := writeFile(t, src, "IMG_20240103_030405.jpg", "partial")
+	swapped := writeFile(t, src, "IMG_20240104_030405.jpg", "planned")
+
+	planned, err := Plan(context.Background(), []string{src}, dst)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	f, err := planned.PlanFile(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("PlanFile: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = plan.Decode(&buf); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i, e := range f.Entries {
+		if e.Source == "IMG_20240102_030405.jpg" {
+			// Reviewed and moved to another directory.
+			f.Entries[i].Destination = "Holiday/IMG_20240102_030405.jpg"
+		}
+	}
+	if err := os.WriteFile(changed, []byte("partial, now complete"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Rewritten with other content of the same size, and its modification time put back.
+	info, err := os.Stat(swapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(swapped, []byte("swapped"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(swapped, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Apply(context.Background(), PlanResult(f, src, dst), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch d.SourcePath {
+		case kept:
+			if d.Action != reconcile.ActionCopied {
+				t.Errorf("expected the unchanged file to be copied, got %+v", d)
+			}
+		case changed:
+			if d.Action != reconcile.ActionFailed || errcode.Of(d.Error) != errcode.SourceChanged {
+				t.Errorf("expected the changed file to fail with E_SOURCE_CHANGED, got %+v", d)
+			}
+		case swapped:
+			if d.Action != reconcile.ActionFailed || errcode.Of(d.Error) != errcode.SourceMismatch {
+				t.Errorf("expected the file with other content of the same size and time to fail with E_SOURCE_MISMATCH, got %+v", d)
+			}
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "Holiday", "IMG_20240102_030405.jpg")); err != nil || string(data) != "kept" {
+		t.Errorf("expected the file copied to its edited destination, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "Holiday", "IMG_20240102_030405.jpg.xmp")); err != nil {
+		t.Errorf("expected the sidecar copied with its planned destination: %v", err)
+	}
+
+	twice := PlanResult(f, src, dst)
+	for i := range twice.Decisions {
+		twice.Decisions[i].Action = reconcile.ActionCopy
+		twice.Decisions[i].FinalDestinationPath = filepath.Join(dst, "same.jpg")
+	}
+	if _, err := Apply(context.Background(), twice); err == nil || !strings.Contains(err.Error(), "both planned to") {
+		t.Errorf("expected a plan with a destination planned twice refused, got %v", err)
+	}
+}
+
+func TestRun_Archive(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	a := writeFile(t, src, "IMG_20230102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20230102_030405.jpg.xmp", "<xmp/>")
+	b := writeFile(t, src, "IMG_20240714_100000.jpg", "b")
+
+	res, err := Run(context.Background(), src, dst, WithArchive(archive.FormatTar, archive.PeriodYear))
+	if err != nil {
+		t.Fatalf("dry-run: %v", err)
+	}
+	want := map[string]string{
+		a: filepath.Join(dst, "2023.tar", "2023", "01", "02", "IMG_20230102_030405.jpg"),
+		b: filepath.Join(dst, "2024.tar", "2024", "07", "14", "IMG_20240714_100000.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s planned at %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Fatalf("dry-run wrote %v", entries)
+	}
+
+	res, err = Run(context.Background(), src, dst, WithArchive(archive.FormatTar, archive.PeriodYear), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := res.Counts()[reconcile.ActionCopied]; n != 2 {
+		t.Fatalf("got %d copied, want 2: %+v", n, res.Decisions)
+	}
+	index, err := archive.ReadIndex(nil, filepath.Join(dst, "2023.tar"))
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	if len(index) != 2 || index[0].SourcePath != a || index[1].Name != "2023/01/02/IMG_20230102_030405.jpg.xmp" {
+		t.Errorf("unexpected index: %+v", index)
+	}
+
+	// A later run writes a new archive next to the existing one.
+	res, err = Run(context.Background(), src, dst, WithArchive(archive.FormatTar, archive.PeriodYear), WithExecute(true))
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024_1.tar")); err != nil {
+		t.Errorf("expected a second archive of 2024: %v", err)
+	}
+
+	if _, err := Run(context.Background(), src, dst, WithArchive(archive.FormatZip, archive.PeriodMonth), WithManifest(manifest.ModeLibrary)); err == nil {
+		t.Errorf("expected archives with manifests to be refused")
+	}
+}
+
+func TestRun_Volumes(t *testing.T) {
+	src, a, b := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20210102_030405.jpg", "2021.")
+	writeFile(t, src, "IMG_20220102_030405.jpg", "2022......")
+	writeFile(t, src, "IMG_20230102_030405.jpg", "2023......")
+	writeFile(t, src, "IMG_20240102_030405.jpg", strings.Repeat("2024", 8))
+	writeFile(t, src, "IMG_20250102_030405.jpg", "2025......")
+	// 2021 is already on the second volume.
+	if err := os.Mkdir(filepath.Join(b, "2021"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := []volume.Volume{{Path: a, Capacity: 25}, {Path: b, Capacity: 40}}
+	res, err := Run(context.Background(), src, a, WithVolumes(volume.SplitYear, volumes...), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		"IMG_20210102_030405.jpg": filepath.Join(b, "2021", "01", "02", "IMG_20210102_030405.jpg"),
+		"IMG_20220102_030405.jpg": filepath.Join(a, "2022", "01", "02", "IMG_20220102_030405.jpg"),
+		"IMG_20230102_030405.jpg": filepath.Join(a, "2023", "01", "02", "IMG_20230102_030405.jpg"),
+		"IMG_20240102_030405.jpg": filepath.Join(b, "2024", "01", "02", "IMG_20240102_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		name := filepath.Base(d.SourcePath)
+		if name == "IMG_20250102_030405.jpg" {
+			// No room left after the second volume received 2024.
+			if d.Action != reconcile.ActionFailed || !errors.Is(d.Error, volume.ErrFull) || errcode.Of(d.Error) != errcode.VolumeFull {
+				t.Errorf("expected 2025 to fail for lack of room, got %+v", d)
+			}
+			continue
+		}
+		if d.Action != reconcile.ActionCopied || d.FinalDestinationPath != want[name] {
+			t.Errorf("%s: expected a copy to %s, got %+v", name, want[name], d)
+		}
+		if _, err := os.Stat(want[name]); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if len(res.Volumes) != 2 {
+		t.Fatalf("expected a plan per volume, got %+v", res.Volumes)
+	}
+	if got := res.Volumes[0]; fmt.Sprint(got.Folders) != "[2022 2023]" || got.Bytes != 20 {
+		t.Errorf("unexpected first volume %+v", got)
+	}
+	if got := res.Volumes[1]; fmt.Sprint(got.Folders) != "[2021 2024]" || got.Bytes != 37 {
+		t.Errorf("unexpected second volume %+v", got)
+	}
+
+	if _, err := Run(context.Background(), src, a, WithVolumes(volume.SplitYear, volumes...), WithBatchSize(2)); err == nil {
+		t.Error("expected volumes with batches to be refused")
+	}
+}
+
+func TestRun_PayloadDedupe(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	image := "\xFF\xDA\x00\x02\x01\x02\xFF\xD9"
+	original := writeFile(t, src, "IMG_20240102_030405.jpg", "\xFF\xD8\xFF\xE1\x00\x06Exif"+image)
+	stripped := writeFile(t, src, "export.jpg", "\xFF\xD8"+image)
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		if d.Action != reconcile.ActionCopy {
+			t.Errorf("expected %s to be copied without WithPayloadDedupe, got %s", d.SourcePath, d.Action)
+		}
+	}
+
+	res, err = Run(context.Background(), src, dst, WithPayloadDedupe())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch d.SourcePath {
+		case original:
+			if d.Action != reconcile.ActionCopy {
+				t.Errorf("expected the original to be copied, got %s", d.Action)
+			}
+		case stripped:
+			if d.Action != reconcile.ActionSkippedDuplicateSrc || d.DuplicateOf != original {
+				t.Errorf("expected the stripped copy to be skipped as a duplicate of the original, got %s of %q", d.Action, d.DuplicateOf)
+			}
+		}
+	}
+}
+
+func TestResult_Duplicates(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	// The oldest file of a group is kept.
+	a := writeFile(t, src, "IMG_20240102_030405.jpg", "aaaa")
+	writeFile(t, src, "IMG_20240102_030406.jpg", "aaaa")
+	writeFile(t, src, "IMG_20240102_030407.jpg", "aaaa")
+	b := writeFile(t, src, "IMG_20240103_030405.jpg", "bbbbbbbbbb")
+	writeFile(t, src, "IMG_20240103_030406.jpg", "bbbbbbbbbb")
+	writeFile(t, src, "IMG_20240104_030405.jpg", "unique")
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	groups, saved := res.Duplicates()
+	if saved != 18 || len(groups) != 2 {
+		t.Fatalf("got %d bytes saved in %+v", saved, groups)
+	}
+	// The group saving the most comes first.
+	if groups[0].Kept != b || len(groups[0].Duplicates) != 1 || groups[0].SavedBytes != 10 {
+		t.Errorf("unexpected first group %+v", groups[0])
+	}
+	if groups[1].Kept != a || len(groups[1].Duplicates) != 2 || groups[1].SavedBytes != 8 {
+		t.Errorf("unexpected second group %+v", groups[1])
+	}
+}
+
+func TestRun_Events(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+	if err := os.Symlink(filepath.Join(src, "missing.jpg"), filepath.Join(src, "IMG_20240104_030405.jpg")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	var scanned, attributed, started, done int
+	var decisions []reconcile.Decision
+	var failed []string
+	events := Events{
+		OnScanned:    func(string, scan.Record) { scanned++ },
+		OnAttributed: func(string, createdat.DetailedResult) { attributed++ },
+		OnDecision:   func(d reconcile.Decision) { decisions = append(decisions, d) },
+		OnCopyStart:  func(plan.Operation) { started++ },
+		OnCopyDone:   func(copy.Result) { done++ },
+		OnError:      func(src string, err error) { failed = append(failed, filepath.Base(src)) },
+	}
+
+	if _, err := Run(context.Background(), src, dst, WithExecute(true), WithEvents(events)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if scanned != 3 || attributed != 2 || started != 2 || done != 2 {
+		t.Fatalf("scanned=%d attributed=%d started=%d done=%d", scanned, attributed, started, done)
+	}
+	if len(failed) != 1 || failed[0] != "IMG_20240104_030405.jpg" {
+		t.Fatalf("unexpected errors: %v", failed)
+	}
+	// Three planned decisions, then the two copy outcomes.
+	if len(decisions) != 5 || decisions[4].Action != reconcile.ActionCopied {
+		t.Fatalf("unexpected decisions: %+v", decisions)
+	}
+}
+
+func TestRun_CustomStage(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240103_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240104_030405.png", "b")
+	writeFile(t, src, "IMG_20240105_030405.jpg", "c")
+
+	var seen []string
+	filter := StageFunc(func(ctx context.Context, items []Item) ([]Item, error) {
+		out := items[:0]
+		for _, it := range items {
+			seen = append(seen, filepath.Base(it.Source))
+			switch {
+			case filepath.Ext(it.Source) == ".png":
+				// Dropped items are left out of the result.
+				continue
+			case it.Pending() && filepath.Base(it.Source) == "IMG_20240105_030405.jpg":
+				it.Decision = reconcile.Decision{SourcePath: it.Source, Action: reconcile.ActionFailed, Error: errors.New("rejected")}
+			}
+			out = append(out, it)
+		}
+		return out, nil
+	})
+
+	res, err := Run(context.Background(), src, dst, WithStage(filter))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The custom stage runs after dedupe and sees the duplicate already decided.
+	if len(seen) != 4 {
+		t.Fatalf("stage saw %v", seen)
+	}
+	want := []reconcile.Action{reconcile.ActionCopy, reconcile.ActionSkippedDuplicateSrc, reconcile.ActionFailed}
+	if len(res.Decisions) != len(want) {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	for i, d := range res.Decisions {
+		if d.Action != want[i] {
+			t.Fatalf("decision %d: got %s, want %s (%+v)", i, d.Action, want[i], d)
+		}
+	}
+}
+
+func TestRun_RemoteSourceAndDestination(t *testing.T) {
+	src, dst := destfs.NewMem(), destfs.NewMem()
+	src.WriteFile("/card/DCIM/IMG_20240102_030405.jpg", []byte("a"))
+	src.WriteFile("/card/DCIM/copy/IMG_20240102_030405.jpg", []byte("a"))
+
+	res, err := Run(context.Background(), "/card", "/library", WithExecute(true), WithSourceFS(src), WithDestinationFS(dst))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	counts := res.Counts()
+	if counts[reconcile.ActionCopied] != 1 || counts[reconcile.ActionSkippedDuplicateSrc] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	want := filepath.Join("/library", "2024", "01", "02", "IMG_20240102_030405.jpg")
+	if got, err := dst.ReadFile(want); err != nil || string(got) != "a" {
+		t.Fatalf("destination %s = %q, %v (files: %v)", want, got, err, dst.Files())
+	}
+}
+
+func TestRun_TakeoutAlbumLayout(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	album := filepath.Join(src, "Google Photos", "Trip to Rome")
+	if err := os.MkdirAll(album, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, album, "metadata.json", `{"title": "Trip to Rome"}`)
+	inAlbum := writeFile(t, album, "IMG_20240102_030405.jpg", "a")
+	loose := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	layout, err := plan.ParseLayout("{album}/{year}/{month}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		inAlbum: filepath.Join(dst, "Trip to Rome", "2024", "01", "IMG_20240102_030405.jpg"),
+		loose:   filepath.Join(dst, "2024", "01", "IMG_20240103_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+}
+
+func TestRun_ApplePhotosLibrary(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "Photos Library.photoslibrary")
+	for _, dir := range []string{"database", "originals/A"} {
+		if err := os.MkdirAll(filepath.Join(bundle, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sql.Open("sqlite", filepath.Join(bundle, "database", "Photos.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE ZASSET (Z_PK INTEGER PRIMARY KEY, ZDIRECTORY VARCHAR, ZFILENAME VARCHAR,
+			ZDATECREATED TIMESTAMP, ZFAVORITE INTEGER, ZTRASHEDSTATE INTEGER);
+		CREATE TABLE ZADDITIONALASSETATTRIBUTES (Z_PK INTEGER PRIMARY KEY, ZASSET INTEGER, ZORIGINALFILENAME VARCHAR);
+		CREATE TABLE ZGENERICALBUM (Z_PK INTEGER PRIMARY KEY, ZKIND INTEGER, ZTITLE VARCHAR, ZTRASHEDSTATE INTEGER);
+		CREATE TABLE Z_28ASSETS (Z_28ALBUMS INTEGER, Z_3ASSETS INTEGER);
+		INSERT INTO ZASSET VALUES (1, 'A', 'A1B2.jpg', 700000000, 1, 0), (2, 'A', 'A3C4.jpg', 700000000, 0, 0);
+		INSERT INTO ZADDITIONALASSETATTRIBUTES VALUES (10, 1, 'IMG_0001.JPG'), (11, 2, 'IMG_0002.JPG');
+		INSERT INTO ZGENERICALBUM VALUES (20, 2, 'Vacation', 0);
+		INSERT INTO Z_28ASSETS VALUES (20, 1);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second original is only stored in iCloud.
+	local := writeFile(t, filepath.Join(bundle, "originals", "A"), "A1B2.jpg", "a")
+	dst := t.TempDir()
+
+	layout, err := plan.ParseLayout("{favorite}/{album}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), bundle, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 2 {
+		t.Fatalf("got %d decisions, want 2", len(res.Decisions))
+	}
+
+	// The catalog date (2023-03-08 UTC) wins over the mtime of the original.
+	for _, d := range res.Decisions {
+		if d.SourcePath == local {
+			if want := filepath.Join(dst, plan.FavoriteValue, "Vacation", "2023", "IMG_0001.JPG"); d.FinalDestinationPath != want {
+				t.Errorf("got %s, want %s", d.FinalDestinationPath, want)
+			}
+			continue
+		}
+		if d.Action != reconcile.ActionFailed || !errors.Is(d.Error, errcode.ErrUnreadableSource) {
+			t.Errorf("%s: got %s (%v), want a failed unreadable source", d.SourcePath, d.Action, d.Error)
+		}
+	}
+}
+
+func TestRun_LightroomCatalog(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	rated := writeFile(t, src, "DSC_0001.jpg", "a")
+	other := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	catalog := filepath.Join(t.TempDir(), "Catalog.lrcat")
+	db, err := sql.Open("sqlite", catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER PRIMARY KEY, absolutePath);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER PRIMARY KEY, pathFromRoot, rootFolder INTEGER);
+		CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, baseName, extension, folder INTEGER);
+		CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, captureTime, masterImage INTEGER, rating, rootFile INTEGER);
+		CREATE TABLE AgLibraryCollection (id_local INTEGER PRIMARY KEY, creationId, name);
+		CREATE TABLE AgLibraryCollectionImage (id_local INTEGER PRIMARY KEY, collection INTEGER, image INTEGER);
+		INSERT INTO AgLibraryRootFolder VALUES (1, ?);
+		INSERT INTO AgLibraryFolder VALUES (2, '', 1);
+		INSERT INTO AgLibraryFile VALUES (3, 'DSC_0001', 'jpg', 2);
+		INSERT INTO Adobe_images VALUES (4, '2019-05-04T12:34:56', NULL, 5, 3);
+		INSERT INTO AgLibraryCollection VALUES (5, 'com.adobe.ag.library.collection', 'Portfolio');
+		INSERT INTO AgLibraryCollectionImage VALUES (6, 5, 4);
+	`, filepath.ToSlash(src)+"/")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := plan.ParseLayout("{album}/{rating}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout), WithLightroomCatalog(catalog))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 2 {
+		t.Fatalf("got %d decisions, want 2", len(res.Decisions))
+	}
+
+	want := map[string]string{
+		rated: filepath.Join(dst, "Portfolio", "5", "2019", "DSC_0001.jpg"),
+		other: filepath.Join(dst, "2024", "IMG_20240103_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if got := res.Details[rated].Best.Source; got != createdat.SourceCatalog {
+		t.Errorf("created_at source: got %s, want %s", got, createdat.SourceCatalog)
+	}
+}
+
+func TestRun_ImmichProfile(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	withXMP := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240102_030405.xmp", "xmp")
+	bare := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	res, err := Run(context.Background(), src, dst, WithProfile(profile.Immich), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := res.Counts()[reconcile.ActionCopied]; n != 2 {
+		t.Fatalf("got %d copied, want 2: %+v", n, res.Decisions)
+	}
+
+	day := filepath.Join(dst, "2024", "2024-01-02")
+	if got, err := os.ReadFile(filepath.Join(day, "IMG_20240102_030405.jpg.xmp")); err != nil || string(got) != "xmp" {
+		t.Errorf("existing sidecar not renamed for Immich: %q, %v", got, err)
+	}
+
+	generated, err := os.ReadFile(filepath.Join(dst, "2024", "2024-01-03", "IMG_20240103_030405.jpg.xmp"))
+	if err != nil {
+		t.Fatalf("generated sidecar: %v", err)
+	}
+	if !bytes.Contains(generated, []byte(`exif:DateTimeOriginal="2024-01-03T03:04:05`)) {
+		t.Errorf("generated sidecar lacks the created_at of %s:\n%s", bare, generated)
+	}
+	for _, d := range res.Decisions {
+		if d.SourcePath == withXMP && len(d.Sidecars) != 1 {
+			t.Errorf("expected only the existing sidecar for %s, got %+v", withXMP, d.Sidecars)
+		}
+	}
+}
+
+func TestRun_WriteEXIF(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	dated := writeFile(t, src, "IMG_20240102_030405.jpg", img.String())
+	notJPEG := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	res, err := Run(context.Background(), src, dst, WithWriteEXIF(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := res.Counts()[reconcile.ActionCopied]; n != 2 {
+		t.Fatalf("got %d copied, want 2: %+v", n, res.Decisions)
+	}
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	if len(res.DatesWritten) != 1 || !res.DatesWritten[dated].Equal(want) {
+		t.Fatalf("unexpected dates written: %v", res.DatesWritten)
+	}
+
+	for _, d := range res.Decisions {
+		got, err := os.ReadFile(d.FinalDestinationPath)
+		if err != nil {
+			t.Fatalf("read copy: %v", err)
+		}
+		switch d.SourcePath {
+		case dated:
+			if _, err := exifwrite.SetDateTimeOriginal(got, want); !errors.Is(err, exifwrite.ErrPresent) {
+				t.Errorf("copy of %s has no DateTimeOriginal: %v", dated, err)
+			}
+		case notJPEG:
+			if string(got) != "b" {
+				t.Errorf("copy of %s was modified: %q", notJPEG, got)
+			}
+		}
+	}
+	if got, _ := os.ReadFile(dated); !bytes.Equal(got, img.Bytes()) {
+		t.Errorf("source was modified")
+	}
+}
+
+func TestRun_FileTimes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+
+	res, err := Run(context.Background(), src, dst, WithFileTimes(), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 1 || res.Decisions[0].Action != reconcile.ActionCopied {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	info, err := os.Stat(res.Decisions[0].FinalDestinationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local); !info.ModTime().Equal(want) {
+		t.Errorf("expected the copy to have mtime %v, got %v", want, info.ModTime())
+	}
+}
+
+func TestRun_PlaceLayout(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	// Rome: 41°53'31.2"N 12°29'31.2"E.
+	located := writeFile(t, src, "IMG_20240102_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{41, 53, 312}, 'E', [3]uint32{12, 29, 312})))
+	writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	layout, err := plan.ParseLayout("{place}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		want := filepath.Join(dst, "2024", "IMG_20240103_030405.jpg")
+		if d.SourcePath == located {
+			want = filepath.Join(dst, "Rome, Italy", "2024", "IMG_20240102_030405.jpg")
+		}
+		if d.DestinationPath != want {
+			t.Errorf("destination %s, want %s", d.DestinationPath, want)
+		}
+	}
+	if got := res.Fields[located][plan.TokenPlace]; got != "Rome, Italy" {
+		t.Errorf("place field %q", got)
+	}
+}
+
+func TestRun_CountryCityLayout(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	inCity := writeFile(t, src, "IMG_20230102_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{41, 53, 312}, 'E', [3]uint32{12, 29, 312})))
+	// Belarusian countryside, far from any bundled city: 52°12'N 26°0'E.
+	inCountry := writeFile(t, src, "IMG_20230103_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{52, 12, 0}, 'E', [3]uint32{26, 0, 0})))
+
+	layout, err := plan.ParseLayout("{year}/{country}/{city}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := map[string]string{
+		inCity:    filepath.Join(dst, "2023", "Italy", "Rome", "IMG_20230102_030405.jpg"),
+		inCountry: filepath.Join(dst, "2023", "Belarus", "IMG_20230103_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.DestinationPath != want[d.SourcePath] {
+			t.Errorf("destination %s, want %s", d.DestinationPath, want[d.SourcePath])
+		}
+	}
+	if got := res.Fields[inCity]; got[plan.TokenCountry] != "Italy" || got[plan.TokenCity] != "Rome" || got[plan.TokenPlace] != "Rome, Italy" {
+		t.Errorf("fields %v", got)
+	}
+}
+
+func TestRun_Track(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	// Rome: 41°53'31.2"N 12°29'31.2"E.
+	rome := geocode.Point{Lat: 41.892, Lon: 12.492}
+	paris := geocode.Point{Lat: 48.857, Lon: 2.352}
+	agrees := writeFile(t, src, "IMG_20240102_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{41, 53, 312}, 'E', [3]uint32{12, 29, 312})))
+	disagrees := writeFile(t, src, "IMG_20240104_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{41, 53, 312}, 'E', [3]uint32{12, 29, 312})))
+	// Taken by a camera whose clock ran an hour ahead.
+	located := writeFile(t, src, "IMG_20240103_040405.jpg", "b")
+
+	tr := track.New([]track.Fix{
+		{Time: time.Date(2024, 1, 2, 3, 0, 0, 0, time.Local), Point: rome},
+		{Time: time.Date(2024, 1, 3, 3, 0, 0, 0, time.Local), Point: paris},
+		{Time: time.Date(2024, 1, 4, 3, 0, 0, 0, time.Local), Point: paris},
+	})
+	layout, err := plan.ParseLayout("{place}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout), WithTrack(tr), WithTrackOffset(time.Hour))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if got := res.Details[agrees].Confidence(); got != createdat.ConfidenceHigh {
+		t.Errorf("expected the track to confirm the filename date, got %s", got)
+	}
+	if got := res.Details[disagrees].Confidence(); got != createdat.ConfidenceLow {
+		t.Errorf("expected the track to contradict the filename date, got %s", got)
+	}
+	if got := res.Details[located]; !got.Best.CreatedAt.Equal(time.Date(2024, 1, 3, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("expected the date to be corrected for the clock offset, got %+v", got.Best)
+	}
+	if got, ok := res.Positions[located]; !ok || got != paris {
+		t.Errorf("expected the file to be placed on the track, got %+v, %v", got, ok)
+	}
+	if _, ok := res.Positions[agrees]; ok {
+		t.Errorf("expected a file with a GPS position to keep its own")
+	}
+	if got := res.Fields[located][plan.TokenPlace]; got != "Paris, France" {
+		t.Errorf("place field %q", got)
+	}
+}
+
+func TestRun_GPSTimezone(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	// Tokyo: 35°41'22.2"N 139°41'30.6"E.
+	located := writeFile(t, src, "IMG_20240102_030405.jpg", string(testjpeg.WithGPS('N', [3]uint32{35, 41, 222}, 'E', [3]uint32{139, 41, 306})))
+	unlocated := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+
+	res, err := Run(context.Background(), src, dst, WithGPSTimezone())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Details[located].Best.CreatedAt; !got.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, tokyo)) || got.Location().String() != "Asia/Tokyo" {
+		t.Errorf("expected the date to be read in the timezone of Tokyo, got %v", got)
+	}
+	if got := res.Details[unlocated].Best.CreatedAt; !got.Equal(time.Date(2024, 1, 3, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("expected a file without a position to be read in the local timezone, got %v", got)
+	}
+}
+
+func TestRun_Cameras(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	canon := writeFile(t, src, "IMG_20240102_030405.jpg", string(testjpeg.WithCamera("Canon", "Canon EOS R5")))
+	iphone := writeFile(t, src, "IMG_20240103_030405.jpg", string(testjpeg.WithCamera("Apple", "iPhone 13")))
+	writeFile(t, src, "VID_20240104_030405.mp4", "no exif")
+
+	layout, err := plan.ParseLayout("{camera}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 3 {
+		t.Fatalf("expected 3 decisions, got %d", len(res.Decisions))
+	}
+	if got := res.Fields[iphone][plan.TokenCamera]; got != "Apple iPhone 13" {
+		t.Errorf("camera field %q", got)
+	}
+	for _, d := range res.Decisions {
+		if d.SourcePath == canon && d.DestinationPath != filepath.Join(dst, "Canon EOS R5", "2024", "IMG_20240102_030405.jpg") {
+			t.Errorf("destination %s", d.DestinationPath)
+		}
+	}
+	stats := res.Cameras()
+	if len(stats) != 3 || stats[0].Camera != "Apple iPhone 13" || stats[2].Camera != "" || stats[2].Files != 1 || stats[2].Bytes != int64(len("no exif")) {
+		t.Errorf("unexpected camera stats %+v", stats)
+	}
+
+	res, err = Run(context.Background(), src, dst, WithCameras("canon eos r5"))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.Decisions) != 1 || res.Decisions[0].SourcePath != canon {
+		t.Fatalf("expected only the Canon file, got %+v", res.Decisions)
+	}
+	if got := res.Fields[canon][plan.TokenCamera]; got != "Canon EOS R5" {
+		t.Errorf("camera field %q", got)
+	}
+}
+
+func TestRun_Devices(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	iphone := writeFile(t, src, "IMG_20240103_030405.jpg", string(testjpeg.WithCamera("Apple", "iPhone 13")))
+	pixel := writeFile(t, src, "PXL_20240104_030405123.mp4", "no exif")
+	writeFile(t, src, "holiday.mov", "nothing")
+
+	layout, err := plan.ParseLayout("{device}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		if d.SourcePath == pixel && d.DestinationPath != filepath.Join(dst, "Google Pixel", "2024", "PXL_20240104_030405123.mp4") {
+			t.Errorf("destination %s", d.DestinationPath)
+		}
+	}
+	if got := res.Fields[iphone][plan.TokenDevice]; got != "Apple iPhone 13" {
+		t.Errorf("device field %q", got)
+	}
+	stats := res.Devices()
+	if len(stats) != 3 || stats[0].Device != "Apple iPhone 13" || stats[1].Device != "Google Pixel" || stats[2].Device != "" || stats[2].Bytes != int64(len("nothing")) {
+		t.Errorf("unexpected device stats %+v", stats)
+	}
+}
+
+// jpegWithXMP returns a JPEG whose XMP packet holds the attribute xmp:Rating="rating".
+func jpegWithXMP(rating string) []byte {
+	payload := "http://ns.adobe.com/xap/1.0/\x00<rdf:Description xmp:Rating=\"" + rating + "\"/>"
+	return testjpeg.JPEG(testjpeg.Segment(0xE1, []byte(payload)))
+}
+
+func TestRun_RatingRoutes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	sidecarRated := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240102_030405.xmp", `<x:xmpmeta><rdf:Description><xmp:Rating>5</xmp:Rating></rdf:Description></x:xmpmeta>`)
+	embeddedRated := writeFile(t, src, "IMG_20240103_030405.jpg", string(jpegWithXMP("4")))
+	lowRated := writeFile(t, src, "IMG_20240104_030405.jpg", string(jpegWithXMP("2")))
+	unrated := writeFile(t, src, "IMG_20240105_030405.jpg", "d")
+
+	best, err := plan.ParseRoute("rating>=4:Best/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithRoutes(best))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		sidecarRated:  filepath.Join(dst, "Best", "2024", "IMG_20240102_030405.jpg"),
+		embeddedRated: filepath.Join(dst, "Best", "2024", "IMG_20240103_030405.jpg"),
+		lowRated:      filepath.Join(dst, "2024", "01", "04", "IMG_20240104_030405.jpg"),
+		unrated:       filepath.Join(dst, "2024", "01", "05", "IMG_20240105_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if got := res.Fields[sidecarRated][plan.TokenRating]; got != "5" {
+		t.Errorf("sidecar rating = %q, want 5", got)
+	}
+	if got := res.Fields[lowRated][plan.TokenRating]; got != "2" {
+		t.Errorf("embedded rating = %q, want 2", got)
+	}
+	if _, ok := res.Fields[unrated]; ok {
+		t.Errorf("expected no fields for the unrated file, got %v", res.Fields[unrated])
+	}
+}
+
+func TestRun_KeywordRoutes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	scanned := writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	writeFile(t, src, "IMG_20240102_030405.xmp", `<dc:subject><rdf:Bag><rdf:li>family</rdf:li><rdf:li>Scan</rdf:li></rdf:Bag></dc:subject>`)
+	tagged := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+	writeFile(t, src, "IMG_20240103_030405.xmp", `<dc:subject><rdf:Bag><rdf:li>holiday</rdf:li></rdf:Bag></dc:subject>`)
+	untagged := writeFile(t, src, "IMG_20240104_030405.jpg", "c")
+
+	scans, err := plan.ParseRoute("keyword=scan:Scans/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := plan.ParseLayout("{keyword}/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithLayout(layout), WithRoutes(scans))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		scanned:  filepath.Join(dst, "Scans", "2024", "IMG_20240102_030405.jpg"),
+		tagged:   filepath.Join(dst, "holiday", "2024", "IMG_20240103_030405.jpg"),
+		untagged: filepath.Join(dst, "2024", "IMG_20240104_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if got := res.Fields[scanned].Values(plan.TokenKeyword); len(got) != 2 || got[0] != "family" || got[1] != "Scan" {
+		t.Errorf("keywords = %q, want [family Scan]", got)
+	}
+}
+
+// pngOfSize returns the header of a PNG of width x height, without image data.
+func pngOfSize(width, height uint32) []byte {
+	ihdr := []byte("\x00\x00\x00\x0DIHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, crc32.ChecksumIEEE(ihdr[4:]))
+	return append([]byte("\x89PNG\r\n\x1a\n"), ihdr...)
+}
+
+func TestRun_ScreenshotRoutes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	named := writeFile(t, src, "Screenshot_2024-01-02-03-04-05.png", "a")
+	renamed := writeFile(t, src, "IMG_20240103_030405.png", string(pngOfSize(1170, 2532)))
+	photo := writeFile(t, src, "IMG_20240104_030405.png", string(pngOfSize(4032, 3024)))
+
+	screenshots, err := plan.ParseRoute("screenshot:Screenshots/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithRoutes(screenshots))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		named:   filepath.Join(dst, "Screenshots", "2024", "Screenshot_2024-01-02-03-04-05.png"),
+		renamed: filepath.Join(dst, "Screenshots", "2024", "IMG_20240103_030405.png"),
+		photo:   filepath.Join(dst, "2024", "01", "04", "IMG_20240104_030405.png"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+}
+
+// mp4WithDuration returns an MP4 whose movie header records a duration of milliseconds.
+func mp4WithDuration(milliseconds uint32) []byte {
+	mvhd := append(binary.BigEndian.AppendUint32(nil, 28), "mvhd"...)
+	mvhd = append(mvhd, make([]byte, 12)...)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, 1000)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, milliseconds)
+	moov := binary.BigEndian.AppendUint32(nil, uint32(len(mvhd)+8))
+	moov = append(moov, "moov"...)
+	moov = append(moov, mvhd...)
+	return append([]byte("\x00\x00\x00\x0Cftypisom"), moov...)
+}
+
+func TestRun_VideoRoutes(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	clip := writeFile(t, src, "VID_20240102_030405.mp4", string(mp4WithDuration(2500)))
+	long := writeFile(t, src, "VID_20240103_030405.mp4", string(mp4WithDuration(65000)))
+
+	clips, err := plan.ParseRoute("duration<3s:Clips/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Run(context.Background(), src, dst, WithRoutes(clips))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		clip: filepath.Join(dst, "Clips", "2024", "VID_20240102_030405.mp4"),
+		long: filepath.Join(dst, "2024", "01", "03", "VID_20240103_030405.mp4"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+	if got := res.Fields[clip][plan.TokenDuration]; got != "2.5" {
+		t.Errorf("duration = %q, want 2.5", got)
+	}
+}
+
+func TestRun_SimilarVideos(t *testing.T) {
+	// A stand-in ffmpeg that writes a falling frame for every video but other.mp4, which gets a rising one.
+	bin := t.TempDir()
+	writeFile(t, bin, "ffmpeg", "#!/bin/sh\n"+
+		"while [ \"$1\" != -i ]; do shift; done\n"+
+		"case \"$2\" in *other*) row='\\012\\024\\036(2<FPZ' ;; *) row='ZPF<2(\\036\\024\\012' ;; esac\n"+
+		"for i in 1 2 3 4 5 6 7 8; do printf \"$row\"; done\n")
+	if err := os.Chmod(filepath.Join(bin, "ffmpeg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	original := writeFile(t, src, "VID_20240102_030405.mp4", string(mp4WithDuration(10000))+strings.Repeat("m", 1000))
+	copied := writeFile(t, src, "VID-20240102-WA0001.mp4", string(mp4WithDuration(10050))+strings.Repeat("m", 100))
+	other := writeFile(t, src, "other.mp4", string(mp4WithDuration(10000)))
+	writeFile(t, src, "short.mp4", string(mp4WithDuration(3000)))
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	res, err := Run(context.Background(), src, t.TempDir(), WithSimilarVideos())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := map[string]string{copied: original}; !maps.Equal(res.SimilarTo, want) {
+		t.Errorf("SimilarTo = %v, want %v", res.SimilarTo, want)
+	}
+	for _, d := range res.Decisions {
+		if d.Action != reconcile.ActionCopy {
+			t.Errorf("expected every video to be organized, got %+v", d)
+		}
+	}
+
+	// Without ffmpeg only the durations are compared.
+	t.Setenv("PATH", t.TempDir())
+	res, err = Run(context.Background(), src, t.TempDir(), WithSimilarVideos())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := map[string]string{copied: original, other: original}; !maps.Equal(res.SimilarTo, want) {
+		t.Errorf("SimilarTo = %v, want %v", res.SimilarTo, want)
+	}
+}
+
+func TestRun_NearDuplicates(t *testing.T) {
+	// photo encodes a width x height JPEG of a gradient, running left to right or, when flip is set, back.
+	photo := func(width, height, quality int, flip bool) string {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for y := range height {
+			for x := range width {
+				v := (x*x + y*7) * 255 / (width*width + height*7)
+				if flip {
+					v = 255 - v
+				}
+				img.Pix[img.PixOffset(x, y)] = uint8(v)
+			}
+		}
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	src := t.TempDir()
+	small := writeFile(t, src, "IMG-20240102-WA0001.jpg", photo(160, 120, 50, false))
+	original := writeFile(t, src, "IMG_20240102_030405.jpg", photo(640, 480, 95, false))
+	writeFile(t, src, "IMG_20240102_030406.jpg", photo(640, 480, 95, true))
+	writeFile(t, src, "broken.jpg", "not a photo")
+
+	res, err := Run(context.Background(), src, t.TempDir(), WithNearDuplicates())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := map[string]string{small: original}; !maps.Equal(res.NearDuplicateOf, want) {
+		t.Errorf("NearDuplicateOf = %v, want %v", res.NearDuplicateOf, want)
+	}
+	for _, d := range res.Decisions {
+		if d.Action != reconcile.ActionCopy {
+			t.Errorf("expected every photo to be organized, got %+v", d)
+		}
+	}
+}
+
+func TestRun_Bursts(t *testing.T) {
+	src := t.TempDir()
+	first := writeFile(t, src, "IMG_20240102_235959_BURST001.jpg", "aaa")
+	cover := writeFile(t, src, "IMG_20240102_235959_BURST002_COVER.jpg", "b")
+	other := writeFile(t, src, "IMG_20240103_030405.jpg", "c")
+
+	layout, err := plan.ParseLayout("{year}/{month}/{day}/{burst}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	res, err := Run(context.Background(), src, dst, WithLayout(layout), WithBursts(burst.PolicyGroup))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	dir := filepath.Join(dst, "2024", "01", "02", "Burst 2024-01-02 23.59.59")
+	want := map[string]string{
+		first: filepath.Join(dir, "IMG_20240102_235959_BURST001.jpg"),
+		cover: filepath.Join(dir, "IMG_20240102_235959_BURST002_COVER.jpg"),
+		other: filepath.Join(dst, "2024", "01", "03", "IMG_20240103_030405.jpg"),
+	}
+	for _, d := range res.Decisions {
+		if d.FinalDestinationPath != want[d.SourcePath] {
+			t.Errorf("%s: got %s, want %s", d.SourcePath, d.FinalDestinationPath, want[d.SourcePath])
+		}
+	}
+
+	res, err = Run(context.Background(), src, t.TempDir(), WithBursts(burst.PolicyBest))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		skipped := d.Action == reconcile.ActionSkippedBurst
+		if skipped != (d.SourcePath == first) || skipped && d.DuplicateOf != cover {
+			t.Errorf("%s: unexpected decision %s (duplicate of %q)", d.SourcePath, d.Action, d.DuplicateOf)
+		}
+	}
+}
+
+func TestRun_MotionPhotos(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	video := "\x00\x00\x00\x10ftypmp42\x00\x00\x00\x00moov"
+	xmp := "http://ns.adobe.com/xap/1.0/\x00" + fmt.Sprintf(`<rdf:Description GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d"/>`, len(video))
+	photo := "\xFF\xD8\xFF\xE1" + string(binary.BigEndian.AppendUint16(nil, uint16(len(xmp)+2))) + xmp + "\xFF\xD9" + video
+	motion := writeFile(t, src, "PXL_20240102_030405123.MP.jpg", photo)
+	writeFile(t, src, "IMG_20240102_030406.jpg", "still")
+
+	res, err := Run(context.Background(), src, dst, WithExecute(true), WithMotionPhotos(motionphoto.PolicyExtract))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.MotionPhotos) != 1 || !res.MotionPhotos[motion] {
+		t.Errorf("unexpected motion photos %v", res.MotionPhotos)
+	}
+	dir := filepath.Join(dst, "2024", "01", "02")
+	if got, err := os.ReadFile(filepath.Join(dir, "PXL_20240102_030405123.MP.jpg")); err != nil || string(got) != photo {
+		t.Errorf("expected the motion photo to be copied intact, got %q, %v", got, err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "PXL_20240102_030405123.MP.mp4")); err != nil || string(got) != video {
+		t.Errorf("expected the extracted video, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "IMG_20240102_030406.mp4")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no video for a still photo, got %v", err)
+	}
+}
+
+func TestRun_MotionPhotoDetection(t *testing.T) {
+	src := t.TempDir()
+	video := "\x00\x00\x00\x10ftypmp42\x00\x00\x00\x00moov"
+	xmp := "http://ns.adobe.com/xap/1.0/\x00" + fmt.Sprintf(`<rdf:Description GCamera:MicroVideoOffset="%d"/>`, len(video))
+	photo := "\xFF\xD8\xFF\xE1" + string(binary.BigEndian.AppendUint16(nil, uint16(len(xmp)+2))) + xmp + "\xFF\xD9" + video
+	motion := writeFile(t, src, "PXL_20240102_030405123.MP.jpg", photo)
+
+	// Without extraction or detection the photos are not read for their video.
+	res, err := Run(context.Background(), src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.MotionPhotos) != 0 {
+		t.Errorf("motion photos detected without being asked for: %v", res.MotionPhotos)
+	}
+
+	res, err = Run(context.Background(), src, t.TempDir(), WithMotionPhotoDetection())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(res.MotionPhotos) != 1 || !res.MotionPhotos[motion] {
+		t.Errorf("unexpected motion photos %v", res.MotionPhotos)
+	}
+	for _, d := range res.Decisions {
+		if len(d.Sidecars) != 0 {
+			t.Errorf("detection extracted a video: %+v", d.Sidecars)
+		}
+	}
+}
+
+func TestRun_HEICConversion(t *testing.T) {
+	// A stand-in heif-convert, called as heif-convert -q QUALITY IN OUT.
+	bin := t.TempDir()
+	writeFile(t, bin, "heif-convert", "#!/bin/sh\nprintf 'JPEG:' > \"$4\"\ncat \"$3\" >> \"$4\"\n")
+	if err := os.Chmod(filepath.Join(bin, "heif-convert"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, policy := range []heic.Policy{heic.PolicyReplace, heic.PolicyKeep} {
+		t.Run(string(policy), func(t *testing.T) {
+			src, dst := t.TempDir(), t.TempDir()
+			photo := writeFile(t, src, "IMG_20240102_030405.heic", "heic")
+			writeFile(t, src, "IMG_20240102_030406.jpg", "still")
+
+			res, err := Run(context.Background(), src, dst, WithExecute(true), WithHEICConversion(policy))
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if len(res.Converted) != 1 || !res.Converted[photo] {
+				t.Errorf("unexpected conversions %v", res.Converted)
+			}
+			dir := filepath.Join(dst, "2024", "01", "02")
+			if got, err := os.ReadFile(filepath.Join(dir, "IMG_20240102_030405.jpg")); err != nil || string(got) != "JPEG:heic" {
+				t.Errorf("expected the converted JPEG, got %q, %v", got, err)
+			}
+			_, err = os.Stat(filepath.Join(dir, "IMG_20240102_030405.heic"))
+			if kept := err == nil; kept != (policy == heic.PolicyKeep) {
+				t.Errorf("original kept = %v, %v", kept, err)
+			}
+			if got, err := os.ReadFile(filepath.Join(dir, "IMG_20240102_030406.jpg")); err != nil || string(got) != "still" {
+				t.Errorf("expected the JPEG to be copied as is, got %q, %v", got, err)
+			}
+		})
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	src := t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.heic", "heic")
+	if _, err := Run(context.Background(), src, t.TempDir(), WithHEICConversion(heic.PolicyReplace)); !errors.Is(err, heic.ErrNoConverter) {
+		t.Errorf("expected ErrNoConverter, got %v", err)
+	}
+}
+
+func TestRun_Edits(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	original := writeFile(t, src, "IMG_1234.jpg", "original")
+	taken := time.Date(2020, 8, 15, 10, 0, 0, 0, time.Local)
+	if err := os.Chtimes(original, taken, taken); err != nil {
+		t.Fatal(err)
+	}
+	edit := writeFile(t, src, "IMG_1234-edited.jpg", "edited")
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.EditOf[edit] != original || len(res.EditOf) != 1 {
+		t.Errorf("unexpected links %v", res.EditOf)
+	}
+	for _, d := range res.Decisions {
+		if want := filepath.Join(dst, "2020", "08", "15", filepath.Base(d.SourcePath)); d.DestinationPath != want {
+			t.Errorf("destination %s, want %s", d.DestinationPath, want)
+		}
+	}
+
+	for pref, skipped := range map[edits.Preference]string{edits.PreferOriginal: edit, edits.PreferEdit: original} {
+		res, err := Run(context.Background(), src, dst, WithEdits(pref))
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		for _, d := range res.Decisions {
+			if (d.Action == reconcile.ActionSkippedVersion) != (d.SourcePath == skipped) {
+				t.Errorf("%s: unexpected decision %+v", pref, d)
+			}
+		}
+	}
+}
+
+func TestRun_RawPairs(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	jpeg := writeFile(t, src, "IMG_1234.JPG", "jpeg")
+	raw := writeFile(t, src, "IMG_1234.CR2", "raw")
+	taken := time.Date(2020, 8, 15, 10, 0, 0, 0, time.Local)
+	if err := os.Chtimes(jpeg, taken, taken); err != nil {
+		t.Fatal(err)
+	}
+	// Another shot of the same name is in the library already, as a JPEG only.
+	if err := os.MkdirAll(filepath.Join(dst, "2020", "08", "15"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dst, "2020", "08", "15"), "IMG_1234.JPG", "another jpeg")
+
+	res, err := Run(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.PairedWith[raw] != jpeg || res.PairedWith[jpeg] != raw {
+		t.Errorf("unexpected pairs %v", res.PairedWith)
+	}
+	for _, d := range res.Decisions {
+		name := strings.TrimSuffix(filepath.Base(d.SourcePath), filepath.Ext(d.SourcePath)) + "_1" + filepath.Ext(d.SourcePath)
+		if want := filepath.Join(dst, "2020", "08", "15", name); d.FinalDestinationPath != want {
+			t.Errorf("destination %s, want %s", d.FinalDestinationPath, want)
+		}
+	}
+}
+
+func TestRun_RecordsCatalog(t *testing.T) {
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	a := writeFile(t, src, "IMG_20240102_030405.jpg", "abc")
+	writeFile(t, src, "copy.jpg", "abc")
+
+	c, err := catalog.Open(ctx, filepath.Join(dst, catalog.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Dry-runs record nothing.
+	if _, err := Run(ctx, src, dst, WithCatalog(c)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if runs, err := c.Runs(ctx); err != nil || len(runs) != 0 {
+		t.Fatalf("dry-run recorded runs: %+v, %v", runs, err)
+	}
+
+	res, err := Run(ctx, src, dst, WithCatalog(c), WithExecute(true))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.RunID == "" {
+		t.Fatalf("no run ID")
+	}
+	entries, err := c.RunEntries(ctx, res.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The duplicate source is skipped, so only one file was imported.
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1: %+v", len(entries), entries)
+	}
+	e := entries[0]
+	if e.SourcePath != a || e.SHA256 != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" ||
+		e.DestinationPath != filepath.Join(dst, "2024", "01", "02", "IMG_20240102_030405.jpg") ||
+		e.CreatedAtSource != createdat.SourceFilename || e.Size != 3 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	runs, err := c.Runs(ctx)
+	if err != nil || len(runs) != 1 || runs[0].FinishedAt.IsZero() || runs[0].Destination != dst {
+		t.Errorf("unexpected runs: %+v, %v", runs, err)
+	}
+}
+
+func TestRun_CatalogSkipsImportedContent(t *testing.T) {
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	a := writeFile(t, src, "IMG_20240102_030405.jpg", "abc")
+
+	c, err := catalog.Open(ctx, filepath.Join(t.TempDir(), catalog.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	first, err := Run(ctx, src, dst, WithCatalog(c), WithExecute(true))
+	if err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	imported := first.Decisions[0].FinalDestinationPath
+
+	// Renaming the file in the library does not make it new, and neither does renaming the source.
+	if err := os.Rename(imported, filepath.Join(filepath.Dir(imported), "renamed.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(src, "IMG_20240102_030405_copy.jpg")
+	if err := os.Rename(a, renamed); err != nil {
+		t.Fatal(err)
+	}
+	fresh := writeFile(t, src, "IMG_20240103_030405.jpg", "abd")
+
+	res, err := Run(ctx, src, dst, WithCatalog(c), WithExecute(true))
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch d.SourcePath {
+		case renamed:
+			if d.Action != reconcile.ActionSkippedImported || d.FinalDestinationPath != imported {
+				t.Errorf("renamed source: got %s -> %s, want skipped as %s", d.Action, d.FinalDestinationPath, imported)
+			}
+		case fresh:
+			if d.Action != reconcile.ActionCopied {
+				t.Errorf("new source: got %s (%v), want copied", d.Action, d.Error)
+			}
+		default:
+			t.Errorf("unexpected decision %+v", d)
+		}
+	}
+}
+
+func TestRun_CatalogConfirmsCopies(t *testing.T) {
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "abc")
+	writeFile(t, src, "IMG_20240103_030405.jpg", "abd")
+
+	c, err := catalog.Open(ctx, filepath.Join(t.TempDir(), catalog.DefaultFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	first, err := Run(ctx, src, dst, WithCatalog(c), WithExecute(true))
+	if err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+	copies := make(map[string]string)
+	for _, d := range first.Decisions {
+		copies[d.SourcePath] = d.FinalDestinationPath
+	}
+
+	// The content of one copy changes without changing its size or time, which is trusted; the time
+	// of the other changes, which is not.
+	trusted := copies[filepath.Join(src, "IMG_20240102_030405.jpg")]
+	info, err := os.Stat(trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(trusted, []byte("xyz"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(trusted, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	touched := copies[filepath.Join(src, "IMG_20240103_030405.jpg")]
+	if err := os.Chtimes(touched, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Run(ctx, src, dst, WithCatalog(c), WithExecute(true))
+	if err != nil {
+		t.Fatalf("second Run: %v", err)
+	}
+	for _, d := range res.Decisions {
+		switch d.FinalDestinationPath {
+		case trusted:
+			if d.Action != reconcile.ActionSkippedIdentical {
+				t.Errorf("expected the unchanged copy to be confirmed without reading it, got %+v", d)
+			}
+		case touched:
+			if d.Action != reconcile.ActionSkippedImported {
+				t.Errorf("expected the changed copy to be skipped as imported only, got %+v", d)
+			}
+		default:
+			t.Errorf("unexpected decision %+v", d)
+		}
+	}
+}
+
+func TestRun_Manifest(t *testing.T) {
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	writeFile(t, src, "IMG_20240102_030405.jpg", img.String())
+	writeFile(t, src, "IMG_20240102_040506.jpg", "b")
+
+	// The copy rewritten with its DateTimeOriginal is listed with the checksum of the copy.
+	if _, err := Run(ctx, src, dst, WithManifest(manifest.ModeDirectory), WithWriteEXIF(), WithExecute(true)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "2024", "01", "02", manifest.FileName))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	entries, err := manifest.Parse(bytes.NewReader(b))
+	if err != nil || len(entries) != 2 || entries[0].Path != "IMG_20240102_030405.jpg" {
+		t.Fatalf("unexpected manifest %q: %v", b, err)
+	}
+	report, err := manifest.Verify(ctx, nil, dst)
+	if err != nil || report.Checked != 2 || len(report.Problems) != 0 {
+		t.Fatalf("Verify = %+v, %v", report, err)
+	}
+
+	// Dry-runs write nothing.
+	writeFile(t, src, "IMG_20240103_030405.jpg", "c")
+	if _, err := Run(ctx, src, dst, WithManifest(manifest.ModeDirectory)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "2024", "01", "03")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("dry-run wrote to the destination: %v", err)
+	}
+}
+
+func TestRun_Hooks(t *testing.T) {
+	src, dst, bin := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	rejected := writeFile(t, src, "IMG_20240103_030405.jpg", "b")
+	log := filepath.Join(bin, "log")
+	script := func(name, body string) hook.Hook {
+		path := filepath.Join(bin, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return hook.Hook{Command: path}
+	}
+	validate := script("validate", `grep -q 20240103 && { echo rejected >&2; exit 1; }; exit 0`)
+	validate.Point = hook.AfterAttribute
+	record := script("record", `{ cat; echo; } >> "`+log+`"`)
+	record.Point = hook.AfterCopy
+	failing := script("failing", "exit 2")
+	failing.Point = hook.AfterRun
+
+	res, err := Run(context.Background(), src, dst, WithExecute(true), WithHooks(validate, record, failing))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	counts := res.Counts()
+	if counts[reconcile.ActionCopied] != 1 || counts[reconcile.ActionFailed] != 1 {
+		t.Fatalf("unexpected decisions: %+v", res.Decisions)
+	}
+	for _, d := range res.Decisions {
+		if d.SourcePath == rejected && errcode.Of(d.Error) != errcode.HookRejected {
+			t.Errorf("got %v (%s), want %s", d.Error, errcode.Of(d.Error), errcode.HookRejected)
+		}
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("read hook log: %v", err)
+	}
+	var doc hook.File
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("decode %q: %v", data, err)
+	}
+	if doc.Event != hook.AfterCopy || !doc.Success || doc.CreatedAt == nil || !strings.HasPrefix(doc.DestinationPath, dst) {
+		t.Errorf("unexpected after-copy input: %+v", doc)
+	}
+
+	if len(res.HookErrors) != 1 || !strings.Contains(res.HookErrors[0].Error(), "exit status 2") {
+		t.Errorf("unexpected hook errors: %v", res.HookErrors)
+	}
+}
+
+func TestRun_TracesStages(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, src, "IMG_20240102_030405.jpg", "a")
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	if _, err := Run(context.Background(), src, dst, WithExecute(true), WithTracerProvider(tp)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["organize"]
+	if !ok {
+		t.Fatalf("no organize span in %v", spans)
+	}
+	for _, name := range []string{"stage discover", "stage attribute", "stage dedupe", "stage plan", "stage reconcile", "stage copy"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("no %q span", name)
+			continue
+		}
+		if s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%q is not a child of the run", name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/motionphoto"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// PlanFile returns the planned result r of a run of one source as a plan file for Apply, with the
+// paths of its files relative to the source and destination of r. The sources of the entries to copy
+// are read from fsys, or the local filesystem when it is nil, for their SHA-256.
+func (r Result) PlanFile(ctx context.Context, fsys destfs.FS) (plan.File, error) {
+	if len(r.Sources) != 1 {
+		return plan.File{}, fmt.Errorf("plan file: a plan holds the files of one source, not %d", len(r.Sources))
+	}
+	source := r.Sources[0]
+	rel := func(root, p string) (string, error) {
+		rel, ok := within(root, p)
+		if !ok {
+			return "", fmt.Errorf("plan file: %s is outside %s", p, root)
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	f := plan.File{
+		Version:     plan.SchemaVersion,
+		Created:     time.Now(),
+		Source:      source,
+		Destination: r.Destination,
+		Move:        r.Moved,
+		InPlace:     r.InPlace,
+	}
+	for _, d := range r.Decisions {
+		best := r.Details[d.SourcePath].Best
+		e := plan.Entry{
+			Size:            r.Sizes[d.SourcePath],
+			ModTime:         r.ModTimes[d.SourcePath],
+			CreatedAt:       best.CreatedAt,
+			CreatedAtSource: string(best.Source),
+			Action:          string(d.Action),
+			DuplicateOf:     d.DuplicateOf,
+		}
+		if d.Error != nil {
+			e.Error = d.Error.Error()
+		}
+		if d.Action == reconcile.ActionCopy || d.Action == reconcile.ActionCopyRenamed {
+			sum, ok := r.SourceHashes[d.SourcePath]
+			if !ok {
+				var err error
+				if sum, err = fileSHA256(ctx, destfs.OrOS(fsys), d.SourcePath); err != nil {
+					return plan.File{}, fmt.Errorf("plan file: %w", err)
+				}
+			}
+			e.SourceSHA256 = sum
+		}
+		var err error
+		if e.Source, err = rel(source, d.SourcePath); err != nil {
+			return plan.File{}, err
+		}
+		final := d.FinalDestinationPath
+		if final == "" {
+			final = d.DestinationPath
+		}
+		if final != "" {
+			if e.Destination, err = rel(r.Destination, final); err != nil {
+				return plan.File{}, err
+			}
+		}
+		keptJPEG := false
+		for _, sc := range d.Sidecars {
+			entry := plan.SidecarEntry{Name: filepath.Base(sc.DestinationPath)}
+			switch {
+			case filepath.Dir(sc.DestinationPath) != filepath.Dir(final):
+				return plan.File{}, fmt.Errorf("plan file: sidecar %s of %s is not next to %s", sc.DestinationPath, d.SourcePath, final)
+			case sc.Transform != nil && sc.DestinationPath == motionphoto.CompanionPath(final):
+				entry.Extract = plan.ExtractMotionVideo
+			case sc.Transform != nil && sc.DestinationPath == heic.JPEGPath(final):
+				entry.Extract = plan.ExtractJPEG
+				keptJPEG = true
+			case sc.Transform != nil:
+				return plan.File{}, fmt.Errorf("plan file: sidecar %s of %s cannot be planned", sc.DestinationPath, d.SourcePath)
+			case sc.Content != nil:
+				entry.Content = sc.Content
+			default:
+				if entry.Source, err = rel(source, sc.SourcePath); err != nil {
+					return plan.File{}, err
+				}
+			}
+			e.Sidecars = append(e.Sidecars, entry)
+		}
+		// A converted HEIC photo that keeps the photo has its JPEG as a sidecar; otherwise the JPEG replaces it.
+		e.ConvertToJPEG = r.Converted[d.SourcePath] && !keptJPEG
+		f.Entries = append(f.Entries, e)
+	}
+	return f, nil
+}
+
+// PlanResult returns the plan file f as the planned result of a run from source to destination, the
+// roots f was made for, to execute with Apply.
+func PlanResult(f plan.File, source, destination string) Result {
+	res := Result{
+		Details:      make(map[string]createdat.DetailedResult),
+		Sizes:        make(map[string]int64),
+		ModTimes:     make(map[string]time.Time),
+		SourceHashes: make(map[string]string),
+		Fields:       make(map[string]plan.Fields),
+		Converted:    make(map[string]bool),
+		Sources:      []string{source},
+		Destination:  destination,
+		InPlace:      f.InPlace,
+		Moved:        f.Move,
+	}
+	join := func(root, p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+	for _, e := range f.Entries {
+		src := join(source, e.Source)
+		d := reconcile.Decision{
+			SourcePath:  src,
+			Action:      reconcile.Action(e.Action),
+			DuplicateOf: e.DuplicateOf,
+		}
+		if e.Destination != "" {
+			d.DestinationPath = join(destination, e.Destination)
+			d.FinalDestinationPath = d.DestinationPath
+		}
+		if e.Error != "" {
+			d.Error = errors.New(e.Error)
+		}
+		for _, sc := range e.Sidecars {
+			op := plan.Operation{DestinationPath: filepath.Join(filepath.Dir(d.FinalDestinationPath), sc.Name), Content: sc.Content}
+			switch {
+			case sc.Extract == plan.ExtractMotionVideo:
+				op.SourcePath, op.Transform = src, motionphoto.Video
+			case sc.Extract == plan.ExtractJPEG:
+				op.SourcePath, op.Transform = src, heic.ToJPEG
+			case sc.Source != "":
+				op.SourcePath = join(source, sc.Source)
+			}
+			d.Sidecars = append(d.Sidecars, op)
+		}
+		res.Decisions = append(res.Decisions, d)
+		res.Sizes[src] = e.Size
+		res.ModTimes[src] = e.ModTime
+		if e.SourceSHA256 != "" {
+			res.SourceHashes[src] = e.SourceSHA256
+		}
+		res.Details[src] = createdat.DetailedResult{Best: createdat.Result{CreatedAt: e.CreatedAt, Source: createdat.Source(e.CreatedAtSource)}}
+		res.Converted[src] = e.ConvertToJPEG
+	}
+	return res
+}
+
+// Apply executes the copy decisions of planned, such as a plan file read back with PlanResult, as
+// planned: nothing is scanned, planned or renamed again. A source whose size or modification time
+// changed since it was planned fails with E_SOURCE_CHANGED, one whose content differs from its
+// planned SHA-256 with E_SOURCE_MISMATCH, and a destination that meanwhile holds the
+// content of its source is skipped as identical. Apply refuses a plan with a destination outside the
+// destination of planned or a destination planned for two files.
+//
+// The decisions are dry-run unless WithExecute is given, which also takes the destination lock. The
+// sources planned with ConvertToJPEG are converted as by WithHEICConversion(heic.PolicyReplace).
+func Apply(ctx context.Context, planned Result, opts ...Option) (res Result, err error) {
+	cfg := newConfig(opts)
+	cfg.heic = heic.PolicyReplace
+	ctx, span := cfg.tracer().Start(ctx, "apply", trace.WithAttributes(
+		attribute.String("destination", planned.Destination),
+		attribute.Bool("execute", cfg.execute),
+	))
+	defer func() {
+		endSpan(span, err)
+		span.End()
+	}()
+
+	res = plannedResult(planned, cfg)
+	if err := checkTrash(cfg, res.Moved || res.InPlace); err != nil {
+		return res, err
+	}
+	planners := make(map[string]string)
+	claim := func(source, destination string) error {
+		if _, ok := within(res.Destination, destination); !ok {
+			return fmt.Errorf("apply: destination %s of %s is outside %s", destination, source, res.Destination)
+		}
+		if other, ok := planners[destination]; ok {
+			return fmt.Errorf("apply: %s and %s are both planned to %s", other, source, destination)
+		}
+		planners[destination] = source
+		return nil
+	}
+	for _, d := range planned.Decisions {
+		if d.Action != reconcile.ActionCopy && d.Action != reconcile.ActionCopyRenamed {
+			continue
+		}
+		if d.FinalDestinationPath == "" {
+			d.FinalDestinationPath = d.DestinationPath
+		}
+		if err := claim(d.SourcePath, d.FinalDestinationPath); err != nil {
+			return res, err
+		}
+		for _, sc := range d.Sidecars {
+			if err := claim(d.SourcePath, sc.DestinationPath); err != nil {
+				return res, err
+			}
+		}
+		res.Decisions = append(res.Decisions, d)
+		carryFile(&res, planned, d.SourcePath)
+	}
+	err = runPlanned(ctx, &res, cfg, opts)
+	return res, err
+}
@@ -0,0 +1,215 @@
+package organizer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/profile"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// checkWritable reports why the local destination cannot be written to: it is below a file, or its
+// nearest existing directory is read-only or on a read-only mount. A destination that does not exist
+// yet is created by the run.
+func checkWritable(destination string) error {
+	dir, err := filepath.Abs(destination)
+	if err != nil {
+		return err
+	}
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("destination %s: %s is not a directory", destination, dir)
+			}
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, fs.ErrNotExist) || parent == dir {
+			return fmt.Errorf("destination %s: %w", destination, err)
+		}
+		dir = parent
+	}
+	probe, err := os.CreateTemp(dir, ".media-organizer-preflight-")
+	if err != nil {
+		return fmt.Errorf("destination %s is not writable: %w", destination, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// destinationWarnings returns the findings about the destination that do not stop a run: a local
+// destination inside a source root, and a destination that appears to be a library organized in
+// another layout than the one of the run.
+func destinationWarnings(roots []string, destination string, cfg config) []string {
+	var warnings []string
+	if cfg.resume && cfg.resumed == nil {
+		warnings = append(warnings, fmt.Sprintf("no checkpoint of an interrupted run in %s to resume; every file is organized", destination))
+	}
+	if cfg.inPlace {
+		// The sources are the destination, and a migration changes its layout on purpose.
+		return warnings
+	}
+	discover := discoverStage{destination: destination, cfg: cfg}
+	for _, root := range roots {
+		if rel, ok := discover.nestedDestination(root); ok {
+			warnings = append(warnings, fmt.Sprintf("destination %s is inside source %s; %s is not searched for sources", destination, root, rel))
+		}
+	}
+	if layout, ok := libraryLayout(destination, cfg); ok {
+		warnings = append(warnings, fmt.Sprintf("destination %s looks organized as %s, not %s; media-organizer migrate changes the layout of a library",
+			destination, layout, cfg.layout()))
+	}
+	return warnings
+}
+
+// pathLimitWarning returns a finding about the planned or executed copies whose path relative to the
+// root of roots it is in exceeds limits, naming the first of them.
+func pathLimitWarning(roots []string, decisions []reconcile.Decision, limits plan.PathLimits) (string, bool) {
+	var exceeding pathsExceeding
+	exceeding.add(roots, decisions, limits)
+	return exceeding.warning(limits)
+}
+
+// pathsExceeding counts the copies whose path exceeds the path limits, across the batches of a run.
+type pathsExceeding struct {
+	n     int
+	first string
+}
+
+// add counts the planned or executed copies of decisions whose path relative to the root of roots it
+// is in exceeds limits.
+func (p *pathsExceeding) add(roots []string, decisions []reconcile.Decision, limits plan.PathLimits) {
+	if limits.IsZero() {
+		return
+	}
+	for _, d := range decisions {
+		switch d.Action {
+		case reconcile.ActionCopy, reconcile.ActionCopyRenamed, reconcile.ActionCopied, reconcile.ActionCopiedRenamed:
+		default:
+			continue
+		}
+		var rel string
+		for _, root := range roots {
+			if r, ok := within(root, d.DestinationPath); ok {
+				rel = r
+				break
+			}
+		}
+		if rel == "" || !limits.Exceeds(rel) {
+			continue
+		}
+		if p.n == 0 {
+			p.first = rel
+		}
+		p.n++
+	}
+}
+
+// warning returns the finding about the paths counted, if any.
+func (p *pathsExceeding) warning(limits plan.PathLimits) (string, bool) {
+	if p.n == 0 {
+		return "", false
+	}
+	hint := "; shorten paths to fit them"
+	if limits.Shorten {
+		hint = ", even shortened"
+	}
+	if p.n == 1 {
+		return fmt.Sprintf("destination path %s exceeds %s%s", p.first, limits, hint), true
+	}
+	return fmt.Sprintf("%d destination paths exceed %s, such as %s%s", p.n, limits, p.first, hint), true
+}
+
+// within returns the path of p relative to root, when p is inside root.
+func within(root, p string) (string, bool) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// layoutSamples is the number of media files of the destination whose directories are compared with
+// the layout of a run.
+const layoutSamples = 200
+
+// libraryLayout returns the preset layout the destination appears to be organized in, when most of the
+// media files sampled from it are in directories of that layout but not of the layout or routes of the run.
+func libraryLayout(destination string, cfg config) (plan.Layout, bool) {
+	var dirs []string
+	exts := make(map[string]bool)
+	opts := scan.DefaultOptions()
+	for _, ext := range append(opts.PhotoExtensions, opts.VideoExtensions...) {
+		exts[ext] = true
+	}
+	unknown := path.Clean(filepath.ToSlash(cfg.plan.UnknownDir))
+	review := path.Clean(filepath.ToSlash(cfg.plan.ReviewDir))
+	err := fs.WalkDir(destfs.DirFS(cfg.destFS, destination), ".", func(p string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return fs.SkipDir
+		case d.IsDir() && p != "." && (strings.HasPrefix(d.Name(), ".") || p == unknown || p == review):
+			return fs.SkipDir
+		case !d.IsDir() && exts[strings.ToLower(path.Ext(p))]:
+			dirs = append(dirs, path.Dir(p))
+			if len(dirs) == layoutSamples {
+				return fs.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil || len(dirs) == 0 {
+		return plan.Layout{}, false
+	}
+
+	layouts := []plan.Layout{cfg.layout()}
+	for _, r := range cfg.plan.Routes {
+		layouts = append(layouts, r.Layout)
+	}
+	if matching(dirs, layouts...)*2 >= len(dirs) {
+		return plan.Layout{}, false
+	}
+	for _, name := range []string{"daily", "monthly", "yearly"} {
+		preset, _ := plan.ParseNamedLayout(name)
+		if preset.String() != cfg.layout().String() && matching(dirs, preset)*2 > len(dirs) {
+			return preset, true
+		}
+	}
+	return plan.Layout{}, false
+}
+
+// matching returns the number of dirs that one of layouts renders.
+func matching(dirs []string, layouts ...plan.Layout) int {
+	n := 0
+	for _, dir := range dirs {
+		for _, l := range layouts {
+			if _, _, ok := l.Period(dir, time.Local); ok {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// layout returns the layout of dated files: the layout of the run, or that of its export profile.
+func (c config) layout() plan.Layout {
+	if c.profile != profile.None && c.plan.Layout.IsZero() {
+		return c.profile.Layout()
+	}
+	if c.plan.Layout.IsZero() {
+		l, _ := plan.ParseLayout(plan.DefaultLayout)
+		return l
+	}
+	return c.plan.Layout
+}
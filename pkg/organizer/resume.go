@@ -0,0 +1,119 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/checkpoint"
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// loadCheckpoint reads the checkpoint in destination of the run WithResume resumes into cfg, by source.
+// Without a checkpoint cfg.resumed stays nil.
+func loadCheckpoint(destination string, cfg *config) error {
+	if !cfg.resume {
+		return nil
+	}
+	entries, err := checkpoint.Read(cfg.destFS, filepath.Join(destination, checkpoint.FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cfg.resumed = make(map[string]checkpoint.Entry, len(entries))
+	for _, e := range entries {
+		cfg.resumed[e.Source] = e
+	}
+	return nil
+}
+
+// startCheckpoint creates the checkpoint of an executing run in destination, starting with the entries
+// of the run it resumes, and adds it to cfg. The returned function closes the checkpoint and removes it
+// when the run finished or nothing was recorded; an interrupted or failed run keeps it, to be resumed.
+func startCheckpoint(destination string, cfg *config) (func(finished bool) error, error) {
+	if err := destfs.OrOS(cfg.destFS).MkdirAll(destination, 0o755); err != nil {
+		return nil, fmt.Errorf("create checkpoint: %w", err)
+	}
+	path := filepath.Join(destination, checkpoint.FileName)
+	carried := make([]checkpoint.Entry, 0, len(cfg.resumed))
+	for _, e := range cfg.resumed {
+		carried = append(carried, e)
+	}
+	slices.SortFunc(carried, func(a, b checkpoint.Entry) int { return strings.Compare(a.Source, b.Source) })
+	w, err := checkpoint.Create(cfg.destFS, path, carried...)
+	if err != nil {
+		return nil, err
+	}
+	cfg.checkpoint = w
+	return func(finished bool) error {
+		err := w.Close()
+		if finished || w.Len() == 0 {
+			if removeErr := destfs.OrOS(cfg.destFS).Remove(path); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+				err = errors.Join(err, removeErr)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// recordCheckpoint adds the successful copy r of a file of res to the checkpoint of the run.
+func recordCheckpoint(cfg config, res *Result, r copy.Result) error {
+	if cfg.checkpoint == nil || !r.Success {
+		return nil
+	}
+	info, err := destfs.OrOS(cfg.destFS).Stat(r.Operation.DestinationPath)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", r.Operation.DestinationPath, err)
+	}
+	return cfg.checkpoint.Append(checkpoint.Entry{
+		Source:             r.Operation.SourcePath,
+		SourceSize:         res.Sizes[r.Operation.SourcePath],
+		SourceModTime:      res.ModTimes[r.Operation.SourcePath],
+		Destination:        r.Operation.DestinationPath,
+		DestinationSize:    info.Size(),
+		DestinationModTime: info.ModTime(),
+	})
+}
+
+// resumeStage skips the pending items the run WithResume resumes copied already, before anything reads
+// them: the source and the copy must still have the size and modification time the checkpoint records.
+type resumeStage struct {
+	cfg config
+}
+
+func (s resumeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	dst := destfs.OrOS(s.cfg.destFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		e, ok := s.cfg.resumed[it.Source]
+		if !it.Pending() || !ok || e.SourceModTime.IsZero() ||
+			e.SourceSize != it.Record.FileSizeBytes || !e.SourceModTime.Equal(it.Record.ModTime) {
+			continue
+		}
+		info, err := dst.Stat(e.Destination)
+		if err != nil || !info.Mode().IsRegular() || info.Size() != e.DestinationSize || !info.ModTime().Equal(e.DestinationModTime) {
+			continue
+		}
+		it.Decision = reconcile.Decision{
+			SourcePath:           it.Source,
+			DestinationPath:      e.Destination,
+			FinalDestinationPath: e.Destination,
+			Action:               reconcile.ActionSkippedIdentical,
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,152 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// RetryFailed copies again the sources whose copy failed in an earlier run, such as a result read back
+// from its --json report, to the final destinations that run resolved for them; nothing is planned or
+// renamed again. Only the failed decisions with a planned destination are retried: a file that failed
+// before one was planned, because it could not be read or attributed, needs a new run of its source.
+//
+// A destination that meanwhile holds the content of its source is skipped as identical; one holding
+// other content fails the file again. The retried decisions are dry-run unless WithExecute is given,
+// as for RunSources, which also takes the destination lock. Sizes, Details and Converted of previous
+// are used as by Execute, so WithWriteEXIF and WithHEICConversion apply as in the earlier run.
+func RetryFailed(ctx context.Context, previous Result, opts ...Option) (res Result, err error) {
+	cfg := newConfig(opts)
+	ctx, span := cfg.tracer().Start(ctx, "retry failed", trace.WithAttributes(
+		attribute.String("destination", previous.Destination),
+		attribute.Bool("execute", cfg.execute),
+	))
+	defer func() {
+		endSpan(span, err)
+		span.End()
+	}()
+
+	res = plannedResult(previous, cfg)
+	for _, d := range previous.Decisions {
+		if d.Action != reconcile.ActionFailed || d.DestinationPath == "" {
+			continue
+		}
+		retry := reconcile.Decision{
+			SourcePath:           d.SourcePath,
+			DestinationPath:      d.DestinationPath,
+			FinalDestinationPath: d.FinalDestinationPath,
+			Action:               reconcile.ActionCopy,
+			Sidecars:             d.Sidecars,
+		}
+		if retry.FinalDestinationPath == "" {
+			retry.FinalDestinationPath = d.DestinationPath
+		}
+		if retry.FinalDestinationPath != d.DestinationPath {
+			retry.Action = reconcile.ActionCopyRenamed
+		}
+		res.Decisions = append(res.Decisions, retry)
+		carryFile(&res, previous, d.SourcePath)
+	}
+	err = runPlanned(ctx, &res, cfg, opts)
+	return res, err
+}
+
+// plannedResult returns an empty result for the decisions of planned that RetryFailed and Apply
+// execute again.
+func plannedResult(planned Result, cfg config) Result {
+	return Result{
+		Details:      make(map[string]createdat.DetailedResult),
+		Sizes:        make(map[string]int64),
+		ModTimes:     make(map[string]time.Time),
+		SourceHashes: make(map[string]string),
+		Fields:       make(map[string]plan.Fields),
+		Converted:    make(map[string]bool),
+		Sources:      planned.Sources,
+		Destination:  planned.Destination,
+		InPlace:      planned.InPlace || cfg.inPlace,
+		Moved:        planned.Moved || cfg.move,
+		Linked:       cfg.link,
+		DatesWritten: make(map[string]time.Time),
+	}
+}
+
+// carryFile copies what planned holds about source into res.
+func carryFile(res *Result, planned Result, source string) {
+	res.Sizes[source] = planned.Sizes[source]
+	res.ModTimes[source] = planned.ModTimes[source]
+	if sum, ok := planned.SourceHashes[source]; ok {
+		res.SourceHashes[source] = sum
+	}
+	if details, ok := planned.Details[source]; ok {
+		res.Details[source] = details
+	}
+	if fields, ok := planned.Fields[source]; ok {
+		res.Fields[source] = fields
+	}
+	res.Converted[source] = planned.Converted[source]
+}
+
+// runPlanned executes the decisions of res, holding the destination lock when executing, after
+// skipping those whose destination already holds their source.
+func runPlanned(ctx context.Context, res *Result, cfg config, opts []Option) (err error) {
+	if cfg.execute {
+		release, err := AcquireLock(res.Destination, opts...)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if releaseErr := release(); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}()
+	}
+	if err := skipCopied(ctx, res, cfg); err != nil {
+		return err
+	}
+	for _, d := range res.Decisions {
+		cfg.events.decision(d)
+	}
+	if cfg.execute {
+		err = execute(ctx, res, cfg)
+	}
+	afterRun(ctx, res, cfg, err)
+	return err
+}
+
+// skipCopied decides the retried copies of res whose destination already holds the content of their
+// source as skipped_identical. A destination holding other content is left for the copy to refuse.
+func skipCopied(ctx context.Context, res *Result, cfg config) error {
+	src, dst := destfs.OrOS(cfg.sourceFS), destfs.OrOS(cfg.destFS)
+	for i, d := range res.Decisions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := dst.Stat(d.FinalDestinationPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		_, identical, err := reconcile.ResolveAgainstLibraryFS(ctx, src, dst, []string{d.SourcePath},
+			map[string]int64{d.SourcePath: size}, map[int64][]string{size: {d.FinalDestinationPath}})
+		if err != nil {
+			// The copy reports why the source cannot be read.
+			continue
+		}
+		if len(identical) > 0 {
+			res.Decisions[i].Action = reconcile.ActionSkippedIdentical
+		}
+	}
+	return nil
+}
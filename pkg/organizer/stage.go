@@ -0,0 +1,1940 @@
+package organizer
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/applephotos"
+	"github.com/quidome/media-organizer-go/pkg/burst"
+	"github.com/quidome/media-organizer-go/pkg/camera"
+	"github.com/quidome/media-organizer-go/pkg/catalog"
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/device"
+	"github.com/quidome/media-organizer-go/pkg/edits"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+	"github.com/quidome/media-organizer-go/pkg/heic"
+	"github.com/quidome/media-organizer-go/pkg/hook"
+	"github.com/quidome/media-organizer-go/pkg/imagehash"
+	"github.com/quidome/media-organizer-go/pkg/integrity"
+	"github.com/quidome/media-organizer-go/pkg/keyword"
+	"github.com/quidome/media-organizer-go/pkg/lightroom"
+	"github.com/quidome/media-organizer-go/pkg/motionphoto"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+	"github.com/quidome/media-organizer-go/pkg/profile"
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/rating"
+	"github.com/quidome/media-organizer-go/pkg/rawpair"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/review"
+	"github.com/quidome/media-organizer-go/pkg/scan"
+	"github.com/quidome/media-organizer-go/pkg/screenshot"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
+	"github.com/quidome/media-organizer-go/pkg/similar"
+	"github.com/quidome/media-organizer-go/pkg/takeout"
+	"github.com/quidome/media-organizer-go/pkg/video"
+	"github.com/quidome/media-organizer-go/pkg/videohash"
+	"github.com/quidome/media-organizer-go/pkg/xmpdate"
+)
+
+// Item is a media file flowing through the pipeline.
+type Item struct {
+	// Root is the source root the file was discovered under.
+	Root string
+
+	// Source is the absolute source path.
+	Source string
+
+	// Record is the inventory record of the file; Record.Path is relative to Root.
+	Record scan.Record
+
+	// Name is the destination filename. Empty keeps the name of the source.
+	Name string
+
+	// Sidecars holds the absolute paths of the file's companion files.
+	Sidecars []string
+
+	// CreatedAt holds the created_at candidates, set by the attribute stage.
+	CreatedAt createdat.DetailedResult
+
+	// Position is the position the GPS track placed a file without one of its own at, set by the track stage (WithTrack).
+	Position *geocode.Point
+
+	// Fields holds the layout field values of the file (e.g. its album).
+	Fields plan.Fields
+
+	// MotionPhoto is set by the motion stage for JPEGs with an embedded video.
+	MotionPhoto bool
+
+	// SimilarTo is set by the similar-video stage for a video that looks like a re-encoded copy of
+	// the larger video SimilarTo (WithSimilarVideos).
+	SimilarTo string
+
+	// NearDuplicateOf is set by the near-duplicate stage for a photo that looks like a copy of the larger
+	// photo NearDuplicateOf at another resolution or compression (WithNearDuplicates).
+	NearDuplicateOf string
+
+	// Converted is set by the HEIC stage for HEIC photos converted to JPEG (WithHEICConversion).
+	Converted bool
+
+	// EditOf is the source of the original of an edited copy, set by the edit stage.
+	EditOf string
+
+	// PairedWith is the source of the other file of a RAW+JPEG pair, set by the pair stage.
+	PairedWith string
+
+	// Suspicious is why the date of the file is implausible, set by the date check stage (WithDateCheck).
+	Suspicious string
+
+	// Review is set by the plan stage for a dated file planned into the review directory (WithReview,
+	// WithDateCheck).
+	Review bool
+
+	// Decision is the outcome for the file. Its Action is empty while the file is still pending;
+	// once set, later stages pass the item through unchanged.
+	Decision reconcile.Decision
+}
+
+// Pending reports whether no stage has decided the outcome of the item yet.
+func (it Item) Pending() bool { return it.Decision.Action == "" }
+
+// filename returns the name the file is organized under: Name, or the name of the source.
+func (it Item) filename() string {
+	if it.Name != "" {
+		return it.Name
+	}
+	return filepath.Base(it.Source)
+}
+
+// Stage is one step of the pipeline.
+//
+// Process receives the items in discovery order and returns the items for the next stage, in the same order.
+// A stage may update items, decide them (for example mark them reconcile.ActionFailed) or drop them;
+// dropped items are left out of the result entirely.
+type Stage interface {
+	Process(ctx context.Context, items []Item) ([]Item, error)
+}
+
+// StageFunc adapts a function to the Stage interface.
+type StageFunc func(ctx context.Context, items []Item) ([]Item, error)
+
+// Process calls f.
+func (f StageFunc) Process(ctx context.Context, items []Item) ([]Item, error) { return f(ctx, items) }
+
+// WithStage inserts a custom stage after deduplication and before destinations are planned.
+// Stages run in the order they are given.
+func WithStage(s Stage) Option {
+	return func(c *config) { c.stages = append(c.stages, s) }
+}
+
+// pipeline returns the full list of stages for a run of roots into destination.
+func (c config) pipeline(roots []string, destination string) []Stage {
+	if c.profile != profile.None && c.plan.Layout.IsZero() {
+		c.plan.Layout = c.profile.Layout()
+	}
+	stages := []Stage{
+		discoverStage{roots: roots, destination: destination, cfg: c},
+	}
+	if len(c.resumed) > 0 {
+		// Before anything reads the files a resumed run copied already.
+		stages = append(stages, resumeStage{cfg: c})
+	}
+	if !c.allowIncomplete {
+		stages = append(stages, integrityStage{cfg: c})
+	}
+	if c.cameras || c.uses(plan.TokenCamera) || c.uses(plan.TokenDevice) {
+		// Before anything reads or hashes files a camera filter would drop.
+		stages = append(stages, cameraStage{cfg: c})
+	}
+	if c.lightroom != "" {
+		stages = append(stages, lightroomStage{cfg: c})
+	}
+	if c.catalog != nil {
+		stages = append(stages, importedStage{cfg: c})
+	}
+	stages = append(stages, attributeStage{destination: destination, cfg: c})
+	if c.track != nil {
+		stages = append(stages, trackStage{cfg: c})
+	}
+	if c.ratings || c.uses(plan.TokenRating) {
+		stages = append(stages, ratingStage{cfg: c})
+	}
+	if c.keywords || c.uses(plan.TokenKeyword) {
+		stages = append(stages, keywordStage{cfg: c})
+	}
+	if c.screenshots || c.uses(plan.TokenScreenshot) {
+		stages = append(stages, screenshotStage{cfg: c})
+	}
+	if c.videoInfo || c.similarVideos || c.uses(plan.TokenDuration) || c.uses(plan.TokenResolution) || c.uses(plan.TokenCodec) {
+		stages = append(stages, videoStage{cfg: c})
+	}
+	if c.uses(plan.TokenAlbum) {
+		stages = append(stages, albumStage{cfg: c})
+	}
+	if !c.noDedupe {
+		stages = append(stages, dedupeStage{cfg: c})
+		if c.batch != nil && c.dedupeScope != reconcile.DedupeScopeDirectory {
+			// A directory is never split over batches.
+			stages = append(stages, batchDedupeStage{cfg: c})
+		}
+	}
+	if c.libraryDedupe && !c.inPlace {
+		stages = append(stages, libraryStage{destination: destination, cfg: c})
+	}
+	if c.similarVideos {
+		stages = append(stages, similarVideoStage{cfg: c})
+	}
+	if c.nearDuplicates {
+		stages = append(stages, nearDuplicateStage{cfg: c})
+	}
+	if c.geocoder != nil || c.uses(plan.TokenPlace) || c.uses(plan.TokenCountry) || c.uses(plan.TokenCity) {
+		stages = append(stages, placeStage{cfg: c})
+	}
+	if c.bursts != burst.PolicyOff || c.uses(plan.TokenBurst) {
+		stages = append(stages, burstStage{cfg: c})
+	}
+	stages = append(stages, pairStage{}, editStage{cfg: c})
+	if c.motionPhotos == motionphoto.PolicyExtract || c.motionDetection {
+		stages = append(stages, motionStage{cfg: c})
+	}
+	if c.heic != heic.PolicyOff {
+		stages = append(stages, heicStage{cfg: c})
+	}
+	if hooks := hook.At(c.hooks, hook.AfterAttribute); len(hooks) > 0 {
+		stages = append(stages, hookStage{hooks: hooks, cfg: c})
+	}
+	stages = append(stages, c.stages...)
+	if !c.dateCheck.IsZero() {
+		// After every stage that may change a date.
+		stages = append(stages, dateCheckStage{cfg: c})
+	}
+	stages = append(stages, planStage{destination: destination, cfg: c})
+	if len(c.volumes) > 0 {
+		stages = append(stages, volumeStage{destination: destination, cfg: c})
+	}
+	stages = append(stages, reconcileStage{destination: destination, cfg: c})
+	if c.sidecars != sidecar.PolicySkip {
+		stages = append(stages, sidecarStage{cfg: c})
+	}
+	if c.archive != "" {
+		stages = append(stages, archiveStage{destination: destination, cfg: c})
+	}
+	return stages
+}
+
+// uses reports whether the layout or one of the routes references token.
+func (c config) uses(token string) bool {
+	if c.plan.Layout.Uses(token) {
+		return true
+	}
+	for _, r := range c.plan.Routes {
+		if r.Uses(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// pending returns the indexes of the pending items.
+func pending(items []Item) []int {
+	idx := make([]int, 0, len(items))
+	for i, it := range items {
+		if it.Pending() {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// discoverStage finds the media files of every root; its input is ignored.
+// A destination inside a root is not searched, so files organized into it are not found again.
+type discoverStage struct {
+	roots       []string
+	destination string
+	cfg         config
+}
+
+func (s discoverStage) Process(ctx context.Context, _ []Item) ([]Item, error) {
+	var items []Item
+	var totalBytes int64
+	for _, root := range s.roots {
+		if destfs.IsOS(s.cfg.sourceFS) && applephotos.IsLibrary(root) {
+			libraryItems, err := s.discoverPhotosLibrary(ctx, root)
+			if err != nil {
+				return nil, err
+			}
+			for _, it := range libraryItems {
+				totalBytes += it.Record.FileSizeBytes
+			}
+			items = append(items, libraryItems...)
+			continue
+		}
+
+		seen, seenBytes := len(items), totalBytes
+		records, err := s.records(ctx, root, func(n int, size int64) {
+			progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: seen + n, TotalBytes: seenBytes + size})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			items = append(items, s.newItem(root, record))
+			totalBytes += record.FileSizeBytes
+		}
+	}
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageScan, Done: len(items), Total: len(items), TotalBytes: totalBytes})
+	return items, nil
+}
+
+// records returns the inventory of the media files under root, calling found after each media file
+// like scan.Options.OnFound.
+func (s discoverStage) records(ctx context.Context, root string, found func(files int, bytes int64)) ([]scan.Record, error) {
+	return scan.ScanRecords(ctx, destfs.DirFS(s.cfg.sourceFS, root), ".", s.scanOptions(root, found))
+}
+
+// scanOptions returns the options scanning root for media files, calling found after each one.
+func (s discoverStage) scanOptions(root string, found func(files int, bytes int64)) scan.Options {
+	scanOpts := scan.DefaultOptions()
+	scanOpts.OnFound = found
+	if rel, ok := s.nestedDestination(root); ok {
+		scanOpts.ExcludeDirs = []string{rel}
+	}
+	if s.cfg.inPlace {
+		// The source is the library: its ignored directories and trash are left where they are.
+		scanOpts.IgnoreFile = scan.IgnoreFile
+		scanOpts.ExcludeDirs = append(scanOpts.ExcludeDirs, s.cfg.trashDirs(root)...)
+	}
+	return scanOpts
+}
+
+// newItem returns the item of the media file of record, found under root.
+func (s discoverStage) newItem(root string, record scan.Record) Item {
+	it := Item{Root: root, Source: filepath.Join(root, filepath.FromSlash(record.Path)), Record: record}
+	for _, sc := range record.Sidecars {
+		it.Sidecars = append(it.Sidecars, filepath.Join(root, filepath.FromSlash(sc)))
+	}
+	s.cfg.events.scanned(it.Source, record)
+	return it
+}
+
+// nestedDestination returns the slash-separated path of the destination relative to root, when it lies
+// inside root on the local filesystem.
+func (s discoverStage) nestedDestination(root string) (string, bool) {
+	if !destfs.IsOS(s.cfg.sourceFS) || !destfs.IsOS(s.cfg.destFS) {
+		return "", false
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	absDest, err := filepath.Abs(s.destination)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absDest)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// discoverPhotosLibrary lists the originals of an Apple Photos library with the date, albums and
+// favorite flag recorded in its database. Originals that are not stored locally fail on their own.
+func (s discoverStage) discoverPhotosLibrary(ctx context.Context, root string) ([]Item, error) {
+	assets, err := applephotos.ReadAssets(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("read Photos library %s: %w", root, err)
+	}
+	items := make([]Item, 0, len(assets))
+	for _, a := range assets {
+		src := filepath.Join(root, filepath.FromSlash(a.Path))
+		it := Item{Root: root, Source: src, Record: scan.Record{Path: a.Path}, Name: a.OriginalFilename}
+		it.CreatedAt.Catalog = a.CreatedAt
+		if len(a.Albums) > 0 || a.Favorite {
+			it.Fields = make(plan.Fields)
+		}
+		if len(a.Albums) > 0 {
+			// A file is organized once; the first album by title is used for its directory.
+			it.Fields[plan.TokenAlbum] = a.Albums[0]
+		}
+		if a.Favorite {
+			it.Fields[plan.TokenFavorite] = plan.FavoriteValue
+		}
+
+		info, err := os.Stat(src)
+		if err != nil {
+			// Typically an original kept only in iCloud ("Optimize Mac Storage").
+			it.Decision = reconcile.Decision{
+				SourcePath: src,
+				Action:     reconcile.ActionFailed,
+				Error:      &errcode.FileError{Op: "stat", Path: src, Kind: errcode.ErrUnreadableSource, Err: err},
+			}
+			s.cfg.events.error(src, it.Decision.Error)
+			items = append(items, it)
+			continue
+		}
+		it.Record.FileSizeBytes = info.Size()
+		it.Record.ModTime = info.ModTime()
+		items = append(items, it)
+		s.cfg.events.scanned(src, it.Record)
+	}
+	return items, nil
+}
+
+// integrityStage fails the pending items that cannot be complete: empty files and truncated JPEGs
+// (package integrity). They take no part in later stages, so they are neither copied nor kept as the
+// copy of a duplicate.
+type integrityStage struct {
+	cfg config
+}
+
+func (s integrityStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		err := checkIntegrity(fsys, it.Source, it.Record.FileSizeBytes)
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, errcode.ErrUnreadableSource) && s.cfg.failFast:
+			return nil, fmt.Errorf("check %s: %w", it.Source, err)
+		}
+		it.Decision = reconcile.Decision{SourcePath: it.Source, Action: reconcile.ActionFailed, Error: err}
+		s.cfg.events.error(it.Source, err)
+	}
+	return items, nil
+}
+
+// checkIntegrity runs integrity.Check on the file at path of size bytes.
+func checkIntegrity(fsys destfs.FS, path string, size int64) error {
+	if size == 0 || !integrity.Reads(path) {
+		return integrity.Check(path, size, nil)
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	return integrity.Check(path, size, f)
+}
+
+// lightroomStage sets the catalog date and the layout fields of pending items found in a Lightroom catalog.
+type lightroomStage struct {
+	cfg config
+}
+
+func (s lightroomStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	catalog, err := lightroom.Open(ctx, s.cfg.lightroom, s.cfg.defaultLocation())
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		photo, ok := catalog.Lookup(it.Source)
+		if !ok {
+			continue
+		}
+		if !photo.CaptureTime.IsZero() {
+			it.CreatedAt.Catalog = photo.CaptureTime
+		}
+		if len(photo.Collections) == 0 && photo.Rating <= 0 {
+			continue
+		}
+		if it.Fields == nil {
+			it.Fields = make(plan.Fields)
+		}
+		if len(photo.Collections) > 0 && it.Fields[plan.TokenAlbum] == "" {
+			it.Fields[plan.TokenAlbum] = photo.Collections[0]
+		}
+		if photo.Rating > 0 {
+			it.Fields[plan.TokenRating] = strconv.Itoa(photo.Rating)
+		}
+	}
+	return items, nil
+}
+
+// importedStage skips pending items whose content the catalog records as imported before.
+//
+// A source imported from the same path with the same size and modification time is skipped without
+// reading it; other sources are hashed only when a file of their size was imported before. When the
+// copy the catalog records still has the size and modification time it had when it was made, the item
+// is skipped as identical to it, without comparing their content.
+type importedStage struct {
+	cfg config
+}
+
+func (s importedStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	sizes, err := s.cfg.catalog.Sizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	src := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() || !sizes[it.Record.FileSizeBytes] {
+			continue
+		}
+
+		entry, found, err := s.imported(ctx, src, *it)
+		switch {
+		case err != nil && s.cfg.failFast:
+			return nil, fmt.Errorf("check catalog for %s: %w", it.Source, err)
+		case err != nil:
+			it.Decision = reconcile.Decision{SourcePath: it.Source, Action: reconcile.ActionFailed, Error: err}
+			s.cfg.events.error(it.Source, err)
+		case found && s.unchanged(entry):
+			it.Decision = reconcile.Decision{
+				SourcePath:           it.Source,
+				DestinationPath:      entry.DestinationPath,
+				FinalDestinationPath: entry.DestinationPath,
+				Action:               reconcile.ActionSkippedIdentical,
+			}
+		case found:
+			it.Decision = reconcile.Decision{
+				SourcePath:           it.Source,
+				Action:               reconcile.ActionSkippedImported,
+				FinalDestinationPath: entry.DestinationPath,
+			}
+		}
+	}
+	return items, nil
+}
+
+// imported returns the catalog entry of an earlier import of the content of it.
+func (s importedStage) imported(ctx context.Context, src destfs.FS, it Item) (catalog.Entry, bool, error) {
+	bySource, err := s.cfg.catalog.BySource(ctx, it.Source)
+	if err != nil {
+		return catalog.Entry{}, false, err
+	}
+	for _, e := range bySource {
+		if e.Size == it.Record.FileSizeBytes && !e.SourceModTime.IsZero() && e.SourceModTime.Equal(it.Record.ModTime) {
+			return e, true, nil
+		}
+	}
+
+	sum, err := s.cfg.fileSHA256(ctx, src, it)
+	if err != nil {
+		return catalog.Entry{}, false, err
+	}
+	bySum, err := s.cfg.catalog.BySHA256(ctx, sum)
+	if err != nil || len(bySum) == 0 {
+		return catalog.Entry{}, false, err
+	}
+	return bySum[0], true, nil
+}
+
+// unchanged reports whether the copy e records is still in the destination as it was made.
+func (s importedStage) unchanged(e catalog.Entry) bool {
+	if e.DestinationModTime.IsZero() {
+		return false
+	}
+	info, err := destfs.OrOS(s.cfg.destFS).Stat(e.DestinationPath)
+	return err == nil && info.Mode().IsRegular() && info.Size() == e.DestinationSize && info.ModTime().Equal(e.DestinationModTime)
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the source of it, kept in the cache of WithCache.
+func (c config) fileSHA256(ctx context.Context, fsys destfs.FS, it Item) (string, error) {
+	if c.cache == nil || !destfs.IsOS(fsys) {
+		return fileSHA256(ctx, fsys, it.Source)
+	}
+	size, modTime := it.Record.FileSizeBytes, it.Record.ModTime
+	for _, h := range c.cache.Hashes(it.Source, size, modTime) {
+		if h.Algorithm == string(reconcile.HashSHA256) {
+			return h.Sum, nil
+		}
+	}
+	sum, err := fileSHA256(ctx, fsys, it.Source)
+	if err == nil {
+		c.cache.AddHash(it.Source, size, modTime, hashlist.Hash{Algorithm: string(reconcile.HashSHA256), Sum: sum})
+	}
+	return sum, err
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func fileSHA256(ctx context.Context, fsys destfs.FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", &errcode.FileError{Op: "read", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// attributeStage determines the created_at candidates of every pending item.
+type attributeStage struct {
+	destination string
+	cfg         config
+}
+
+func (s attributeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	var totalBytes, attributedBytes int64
+	for _, it := range items {
+		totalBytes += it.Record.FileSizeBytes
+	}
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageAttribute, Total: len(items), TotalBytes: totalBytes})
+
+	fsysByRoot := make(map[string]fs.FS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+
+		fsys, ok := fsysByRoot[it.Root]
+		if !ok {
+			fsys = destfs.DirFS(s.cfg.sourceFS, it.Root)
+			fsysByRoot[it.Root] = fsys
+		}
+		recorded, err := s.recorded(ctx, *it)
+		var detailed createdat.DetailedResult
+		if err == nil {
+			opts := createdat.Options{
+				Location:    s.cfg.location(it.Record.Path),
+				IgnoreMtime: s.cfg.strictDates,
+				Sidecars:    it.Record.Sidecars,
+			}
+			if s.cfg.cache != nil && destfs.IsOS(s.cfg.sourceFS) {
+				opts.Metadata = s.cfg.cache.Metadata(it.Source, it.Record.FileSizeBytes, it.Record.ModTime, opts.Location)
+			}
+			detailed, err = createdat.DetermineDetailed(ctx, fsys, it.Record.Path, opts)
+		}
+		switch {
+		case err != nil && s.cfg.failFast:
+			return nil, fmt.Errorf("determine created_at for %s: %w", it.Source, err)
+		case err != nil:
+			// A file that cannot be attributed fails on its own and takes no part in later stages.
+			it.Decision = reconcile.Decision{
+				SourcePath: it.Source,
+				Action:     reconcile.ActionFailed,
+				Error:      fmt.Errorf("determine created_at: %w", err),
+			}
+			s.cfg.events.error(it.Source, it.Decision.Error)
+		default:
+			if s.cfg.gpsTimezone {
+				detailed = s.withTimezone(ctx, *it, detailed)
+			}
+			it.CreatedAt = detailed.WithCatalog(recorded)
+			if s.cfg.previousLayout != nil {
+				it.CreatedAt = s.withDirectory(it.Source, it.CreatedAt)
+			}
+			s.cfg.events.attributed(it.Source, it.CreatedAt)
+		}
+
+		attributedBytes += it.Record.FileSizeBytes
+		progress.Report(s.cfg.progress, progress.Event{
+			Stage: progress.StageAttribute, Done: i + 1, Total: len(items),
+			Bytes: attributedBytes, TotalBytes: totalBytes, Current: it.Source,
+		})
+	}
+	return items, nil
+}
+
+// recorded returns the date recorded for it outside the file itself, zero when there is none: a date set
+// in the catalog of the run (catalog.Catalog.SetDate), else the date of the photo catalog it came from,
+// else the photoshop:DateCreated of its XMP sidecar. media-organizer set-date writes the first and the last.
+func (s attributeStage) recorded(ctx context.Context, it Item) (time.Time, error) {
+	if s.cfg.catalog != nil {
+		t, ok, err := s.cfg.catalog.Date(ctx, it.Source)
+		if err != nil || ok {
+			return t, err
+		}
+	}
+	if !it.CreatedAt.Catalog.IsZero() {
+		return it.CreatedAt.Catalog, nil
+	}
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for _, sc := range it.Sidecars {
+		if !strings.EqualFold(filepath.Ext(sc), ".xmp") {
+			continue
+		}
+		data, err := readAll(fsys, sc)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t, ok := xmpdate.Read(data, s.cfg.location(it.Record.Path)); ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// withTimezone reads the metadata and filename dates of d in the timezone of the GPS position of it
+// (WithGPSTimezone). A position that cannot be read or placed leaves d unchanged.
+func (s attributeStage) withTimezone(ctx context.Context, it Item, d createdat.DetailedResult) createdat.DetailedResult {
+	switch d.Best.Source {
+	case createdat.SourceMetadata, createdat.SourceFilename:
+	default:
+		return d
+	}
+	p, ok, err := readPoint(destfs.OrOS(s.cfg.sourceFS), it.Source)
+	if err != nil || !ok {
+		return d
+	}
+	geocoder := s.cfg.geocoder
+	if geocoder == nil {
+		geocoder = geocode.Bundled()
+	}
+	place, ok, err := geocoder.Reverse(ctx, p)
+	if err != nil || !ok {
+		return d
+	}
+	zone, ok := place.Location()
+	if !ok {
+		return d
+	}
+	return d.WithTimezone(zone, s.cfg.location(it.Record.Path))
+}
+
+// withDirectory adds the date of the directory of source in the previous layout to d (WithPreviousLayout).
+func (s attributeStage) withDirectory(source string, d createdat.DetailedResult) createdat.DetailedResult {
+	rel, err := filepath.Rel(s.destination, filepath.Dir(source))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return d
+	}
+	start, end, ok := s.cfg.previousLayout.Period(filepath.ToSlash(rel), s.cfg.defaultLocation())
+	if !ok {
+		return d
+	}
+	if best := d.Best; best.Source == createdat.SourceMtime && !best.CreatedAt.Before(start) && best.CreatedAt.Before(end) {
+		return d
+	}
+	return d.WithDirectory(start)
+}
+
+// albumStage sets the album field of pending items from Google Takeout album metadata.
+// Items that already have an album, such as those of an Apple Photos library, are left as they are.
+type albumStage struct {
+	cfg config
+}
+
+func (s albumStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	albumsByRoot := make(map[string]*takeout.Albums)
+	for i := range items {
+		it := &items[i]
+		if !it.Pending() || it.Fields[plan.TokenAlbum] != "" {
+			continue
+		}
+		albums, ok := albumsByRoot[it.Root]
+		if !ok {
+			albums = takeout.NewAlbums(destfs.DirFS(s.cfg.sourceFS, it.Root))
+			albumsByRoot[it.Root] = albums
+		}
+		album, err := albums.Of(it.Record.Path)
+		if err != nil {
+			if s.cfg.failFast {
+				return nil, fmt.Errorf("album of %s: %w", it.Source, err)
+			}
+			// Unreadable album metadata only loses the grouping; the file is still organized.
+			continue
+		}
+		if album != "" {
+			if it.Fields == nil {
+				it.Fields = make(plan.Fields)
+			}
+			it.Fields[plan.TokenAlbum] = album
+		}
+	}
+	return items, nil
+}
+
+// placeStage sets the place, country and city fields of pending items from the GPS position in their EXIF data, or the
+// position the track stage placed them at.
+type placeStage struct {
+	cfg config
+}
+
+func (s placeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	geocoder := s.cfg.geocoder
+	if geocoder == nil {
+		geocoder = geocode.Bundled()
+	}
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		place, err := readPlace(ctx, fsys, *it, geocoder)
+		if err != nil {
+			if s.cfg.failFast {
+				return nil, fmt.Errorf("place of %s: %w", it.Source, err)
+			}
+			// A position that cannot be read only loses the place; the file is still organized.
+			continue
+		}
+		for token, value := range map[string]string{plan.TokenPlace: place.String(), plan.TokenCountry: place.Country, plan.TokenCity: place.City} {
+			if value == "" {
+				continue
+			}
+			if it.Fields == nil {
+				it.Fields = make(plan.Fields)
+			}
+			it.Fields[token] = value
+		}
+	}
+	return items, nil
+}
+
+// readPlace returns the place of the GPS position of it, or of the position the track placed it at, or the
+// zero Place when it has none.
+func readPlace(ctx context.Context, fsys destfs.FS, it Item, geocoder geocode.Geocoder) (geocode.Place, error) {
+	p, ok := geocode.Point{}, false
+	if it.Position != nil {
+		p, ok = *it.Position, true
+	} else {
+		var err error
+		if p, ok, err = readPoint(fsys, it.Source); err != nil || !ok {
+			return geocode.Place{}, err
+		}
+	}
+	place, ok, err := geocoder.Reverse(ctx, p)
+	if err != nil || !ok {
+		return geocode.Place{}, err
+	}
+	return place, nil
+}
+
+// readPoint returns the GPS position in the EXIF data of path.
+func readPoint(fsys destfs.FS, path string) (geocode.Point, bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return geocode.Point{}, false, err
+	}
+	defer f.Close()
+	return geocode.ReadPoint(f)
+}
+
+// trackStage correlates pending items with the GPS track of the run (WithTrack): items with a GPS
+// position verify their date against it, the others are placed at its position at their date.
+type trackStage struct {
+	cfg config
+}
+
+func (s trackStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		switch it.CreatedAt.Best.Source {
+		case createdat.SourceMetadata, createdat.SourceFilename, createdat.SourceCatalog:
+		default:
+			// Modification times are too unreliable to place a file on a track.
+			continue
+		}
+		p, ok, err := readPoint(fsys, it.Source)
+		if err != nil {
+			if s.cfg.failFast {
+				return nil, fmt.Errorf("position of %s: %w", it.Source, err)
+			}
+			// A position that cannot be read is treated as none: the file is placed on the track.
+			ok = false
+		}
+		if ok {
+			agrees, ok := s.cfg.track.Verify(p, it.CreatedAt.Best.CreatedAt)
+			switch {
+			case ok && agrees:
+				it.CreatedAt = it.CreatedAt.WithTrack(createdat.TrackAgrees)
+			case ok:
+				it.CreatedAt = it.CreatedAt.WithTrack(createdat.TrackDisagrees)
+			}
+			continue
+		}
+		if s.cfg.trackOffset != 0 {
+			it.CreatedAt = it.CreatedAt.WithClockOffset(s.cfg.trackOffset)
+		}
+		if p, ok := s.cfg.track.At(it.CreatedAt.Best.CreatedAt); ok {
+			it.Position = &p
+		}
+	}
+	return items, nil
+}
+
+// cameraStage sets the camera and device fields of pending items from the Make, Model and body serial
+// number in their EXIF data, or their filename, and drops the items taken with cameras the filter does
+// not name.
+type cameraStage struct {
+	cfg config
+}
+
+func (s cameraStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	kept := items[:0]
+	for _, it := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !it.Pending() {
+			kept = append(kept, it)
+			continue
+		}
+		c, err := readCamera(fsys, it.Source)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("camera of %s: %w", it.Source, err)
+		}
+		// A camera that cannot be read is treated as none: the file is still organized unless filtered.
+		if len(s.cfg.cameraFilter) > 0 && !matchesAny(c, s.cfg.cameraFilter) {
+			continue
+		}
+		if !c.IsZero() {
+			if it.Fields == nil {
+				it.Fields = make(plan.Fields)
+			}
+			it.Fields[plan.TokenCamera] = c.String()
+		}
+		if name := device.Identify(c, it.filename()); name != "" {
+			if it.Fields == nil {
+				it.Fields = make(plan.Fields)
+			}
+			it.Fields[plan.TokenDevice] = name
+		}
+		kept = append(kept, it)
+	}
+	return kept, nil
+}
+
+// readCamera returns the camera named in the EXIF data of path, or the zero Camera when it names none.
+func readCamera(fsys destfs.FS, path string) (camera.Camera, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return camera.Camera{}, err
+	}
+	defer f.Close()
+	c, _, err := camera.Read(f)
+	return c, err
+}
+
+// ratingStage fills the rating of pending items that have none yet, such as from the Lightroom catalog.
+type ratingStage struct {
+	cfg config
+}
+
+func (s ratingStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() || it.Fields[plan.TokenRating] != "" {
+			continue
+		}
+		n, ok, err := readRating(fsys, *it)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("rating of %s: %w", it.Source, err)
+		}
+		// A rating that cannot be read is treated as none.
+		if !ok {
+			continue
+		}
+		if it.Fields == nil {
+			it.Fields = make(plan.Fields)
+		}
+		it.Fields[plan.TokenRating] = strconv.Itoa(n)
+	}
+	return items, nil
+}
+
+// readRating returns the rating of an item: from its XMP sidecar when it has one, else from the
+// metadata embedded in a JPEG.
+func readRating(fsys destfs.FS, it Item) (int, bool, error) {
+	for _, sc := range it.Sidecars {
+		if !strings.EqualFold(filepath.Ext(sc), ".xmp") {
+			continue
+		}
+		data, err := readAll(fsys, sc)
+		if err != nil {
+			return 0, false, err
+		}
+		if n, ok := rating.FromXMP(data); ok {
+			return n, true, nil
+		}
+	}
+	if !rating.IsCandidate(it.Source) {
+		return 0, false, nil
+	}
+	f, err := fsys.Open(it.Source)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	return rating.FromJPEG(f)
+}
+
+// keywordStage fills the keywords of pending items.
+type keywordStage struct {
+	cfg config
+}
+
+func (s keywordStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		keywords, err := readKeywords(fsys, *it)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("keywords of %s: %w", it.Source, err)
+		}
+		// Keywords that cannot be read are treated as none.
+		if len(keywords) == 0 {
+			continue
+		}
+		if it.Fields == nil {
+			it.Fields = make(plan.Fields)
+		}
+		it.Fields[plan.TokenKeyword] = strings.Join(keywords, plan.KeywordSeparator)
+	}
+	return items, nil
+}
+
+// readKeywords returns the keywords of an item: from its XMP sidecar when it lists any, else from the
+// metadata embedded in a JPEG.
+func readKeywords(fsys destfs.FS, it Item) ([]string, error) {
+	for _, sc := range it.Sidecars {
+		if !strings.EqualFold(filepath.Ext(sc), ".xmp") {
+			continue
+		}
+		data, err := readAll(fsys, sc)
+		if err != nil {
+			return nil, err
+		}
+		if keywords := keyword.FromXMP(data); len(keywords) > 0 {
+			return keywords, nil
+		}
+	}
+	if !keyword.IsCandidate(it.Source) {
+		return nil, nil
+	}
+	f, err := fsys.Open(it.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return keyword.FromJPEG(f)
+}
+
+// screenshotStage marks the pending items that are screenshots.
+type screenshotStage struct {
+	cfg config
+}
+
+func (s screenshotStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() {
+			continue
+		}
+		ok, err := isScreenshot(fsys, *it)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("screenshot detection of %s: %w", it.Source, err)
+		}
+		if !ok {
+			continue
+		}
+		if it.Fields == nil {
+			it.Fields = make(plan.Fields)
+		}
+		it.Fields[plan.TokenScreenshot] = plan.ScreenshotValue
+	}
+	return items, nil
+}
+
+// isScreenshot reports whether an item is a screenshot: by its name, or else by its metadata.
+func isScreenshot(fsys destfs.FS, it Item) (bool, error) {
+	name := it.filename()
+	if screenshot.FromName(name) {
+		return true, nil
+	}
+	if !screenshot.IsCandidate(name) {
+		return false, nil
+	}
+	f, err := fsys.Open(it.Source)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return screenshot.Read(f, name)
+}
+
+// videoStage fills the resolution, duration and codec of pending videos.
+type videoStage struct {
+	cfg config
+}
+
+func (s videoStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() || !video.IsCandidate(it.Source) {
+			continue
+		}
+		info, ok, err := readVideo(fsys, it.Source)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("video metadata of %s: %w", it.Source, err)
+		}
+		if !ok {
+			continue
+		}
+		if it.Fields == nil {
+			it.Fields = make(plan.Fields)
+		}
+		if info.Duration > 0 {
+			// In seconds, to the millisecond.
+			it.Fields[plan.TokenDuration] = strconv.FormatFloat(info.Duration.Round(time.Millisecond).Seconds(), 'f', -1, 64)
+		}
+		if res := info.Resolution(); res != "" {
+			it.Fields[plan.TokenResolution] = res
+		}
+		if info.Codec != "" {
+			it.Fields[plan.TokenCodec] = info.Codec
+		}
+	}
+	return items, nil
+}
+
+// readVideo returns the metadata of the video at path.
+func readVideo(fsys destfs.FS, path string) (video.Info, bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return video.Info{}, false, err
+	}
+	defer f.Close()
+	return video.Read(f)
+}
+
+// similarVideoStage flags the pending videos that look like a re-encoded copy of a larger pending video.
+// It compares the durations read by the video stage, and frame hashes where ffmpeg can read the sources.
+type similarVideoStage struct {
+	cfg config
+}
+
+func (s similarVideoStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	type clip struct {
+		i        int
+		duration time.Duration
+	}
+	var clips []clip
+	for _, i := range pending(items) {
+		seconds, err := strconv.ParseFloat(items[i].Fields[plan.TokenDuration], 64)
+		if err == nil && seconds > 0 {
+			clips = append(clips, clip{i: i, duration: time.Duration(seconds * float64(time.Second))})
+		}
+	}
+	// Largest first: of a video and its copies, the original has the highest bitrate.
+	slices.SortStableFunc(clips, func(a, b clip) int {
+		return cmp.Compare(items[b.i].Record.FileSizeBytes, items[a.i].Record.FileSizeBytes)
+	})
+
+	frames := destfs.IsOS(s.cfg.sourceFS) && videohash.Available()
+	hashes := make(map[int]videohash.Hash)
+	hash := func(c clip) (videohash.Hash, error) {
+		if h, ok := hashes[c.i]; ok {
+			return h, nil
+		}
+		h, err := videohash.Frames(ctx, items[c.i].Source, c.duration)
+		if err != nil && ctx.Err() == nil && s.cfg.failFast {
+			return nil, fmt.Errorf("frames of %s: %w", items[c.i].Source, err)
+		}
+		// A video that cannot be hashed is like no other.
+		hashes[c.i] = h
+		return h, ctx.Err()
+	}
+
+	var originals []clip
+	for _, c := range clips {
+		original := -1
+		for _, o := range originals {
+			if !videohash.SimilarDuration(o.duration, c.duration) || !sameAspect(items[o.i], items[c.i]) {
+				continue
+			}
+			if frames {
+				ho, err := hash(o)
+				if err != nil {
+					return nil, err
+				}
+				hc, err := hash(c)
+				if err != nil {
+					return nil, err
+				}
+				if !ho.Similar(hc) {
+					continue
+				}
+			}
+			original = o.i
+			break
+		}
+		if original < 0 {
+			originals = append(originals, c)
+			continue
+		}
+		items[c.i].SimilarTo = items[original].Source
+	}
+	return items, nil
+}
+
+// nearDuplicateStage flags the pending photos that look like a copy of a larger pending photo: the first,
+// by number of pixels and then file size, of the photos whose perceptual hashes are similar.
+type nearDuplicateStage struct {
+	cfg config
+}
+
+func (s nearDuplicateStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	type photo struct {
+		i    int
+		hash similar.Hash
+	}
+	var photos []photo
+	for _, i := range pending(items) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !similar.IsCandidate(items[i].Source) {
+			continue
+		}
+		h, ok, err := hashPhoto(fsys, items[i].Source)
+		if err != nil && s.cfg.failFast {
+			return nil, err
+		}
+		// A photo that cannot be read or decoded is like no other.
+		if ok {
+			photos = append(photos, photo{i: i, hash: h})
+		}
+	}
+	// Largest first: of a photo and its copies, the original has the most pixels.
+	slices.SortStableFunc(photos, func(a, b photo) int {
+		if c := cmp.Compare(b.hash.Pixels(), a.hash.Pixels()); c != 0 {
+			return c
+		}
+		return cmp.Compare(items[b.i].Record.FileSizeBytes, items[a.i].Record.FileSizeBytes)
+	})
+
+	var originals similar.Index
+	var sources []string
+	for _, p := range photos {
+		if n, ok := originals.Find(p.hash); ok {
+			items[p.i].NearDuplicateOf = sources[n]
+			continue
+		}
+		originals.Add(p.hash)
+		sources = append(sources, items[p.i].Source)
+	}
+	return items, nil
+}
+
+// hashPhoto returns similar.Image of the photo at path. ok is false when the photo cannot be decoded.
+func hashPhoto(fsys destfs.FS, path string) (h similar.Hash, ok bool, err error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return similar.Hash{}, false, &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	h, err = similar.Image(bufio.NewReader(f))
+	return h, err == nil, nil
+}
+
+// sameAspect reports whether the videos a and b have the same aspect ratio, within the rounding of a
+// scaled copy, or do not both have a known resolution.
+func sameAspect(a, b Item) bool {
+	ra, okA := aspect(a)
+	rb, okB := aspect(b)
+	if !okA || !okB {
+		return true
+	}
+	return ra/rb > 0.98 && ra/rb < 1.02
+}
+
+// aspect returns the aspect ratio of the resolution of the video it, and whether it has one.
+func aspect(it Item) (float64, bool) {
+	w, h, ok := strings.Cut(it.Fields[plan.TokenResolution], "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, false
+	}
+	return float64(width) / float64(height), true
+}
+
+// readAll returns the content of the file at path.
+func readAll(fsys destfs.FS, path string) ([]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func matchesAny(c camera.Camera, names []string) bool {
+	for _, name := range names {
+		if c.Matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// burstStage groups the pending photos taken in a burst: every shot is dated like the first and gets
+// its fields and the burst name, so the burst is planned into one directory. With burst.PolicyBest all
+// but the best shot are skipped.
+type burstStage struct {
+	cfg config
+}
+
+func (s burstStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	videoExts := scan.DefaultOptions().VideoExtensions
+	var idx []int
+	var shots []burst.Shot
+	for _, i := range pending(items) {
+		it := items[i]
+		if slices.Contains(videoExts, strings.ToLower(filepath.Ext(it.Source))) {
+			continue
+		}
+		created := it.CreatedAt.Best
+		idx = append(idx, i)
+		shots = append(shots, burst.Shot{
+			Path:   it.Source,
+			Time:   created.CreatedAt,
+			Timed:  created.Source == createdat.SourceMetadata || created.Source == createdat.SourceCatalog,
+			Camera: it.Fields[plan.TokenCamera],
+			Size:   it.Record.FileSizeBytes,
+		})
+	}
+	for _, b := range burst.Find(shots) {
+		first, best := &items[idx[b.Shots[0]]], &items[idx[b.Best]]
+		fields := maps.Clone(first.Fields)
+		if fields == nil {
+			fields = make(plan.Fields)
+		}
+		fields[plan.TokenBurst] = b.Name
+		for _, shot := range b.Shots {
+			it := &items[idx[shot]]
+			it.CreatedAt.Best = first.CreatedAt.Best
+			it.Fields = maps.Clone(fields)
+			if s.cfg.bursts == burst.PolicyBest && it != best {
+				it.Decision = reconcile.Decision{SourcePath: it.Source, Action: reconcile.ActionSkippedBurst, DuplicateOf: best.Source}
+			}
+		}
+	}
+	return items, nil
+}
+
+// pairStage pairs the pending RAW files with the pending JPEG of the same shot (pkg/rawpair). Both are
+// dated by the file whose date is the more confident, the JPEG on a tie, and get its fields, so the pair
+// is planned into one directory under the same collision suffix.
+type pairStage struct{}
+
+func (pairStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	sources := make([]string, 0, len(idx))
+	bySource := make(map[string]int, len(idx))
+	for _, i := range idx {
+		sources = append(sources, items[i].Source)
+		bySource[items[i].Source] = i
+	}
+	for _, p := range rawpair.Find(sources) {
+		raw, jpeg := &items[bySource[p.RAW]], &items[bySource[p.JPEG]]
+		from, to := jpeg, raw
+		if jpeg.CreatedAt.Confidence().Below(raw.CreatedAt.Confidence()) {
+			from, to = raw, jpeg
+		}
+		to.CreatedAt.Best = from.CreatedAt.Best
+		to.Fields = maps.Clone(from.Fields)
+		raw.PairedWith, jpeg.PairedWith = p.JPEG, p.RAW
+	}
+	return items, nil
+}
+
+// editStage links pending edited copies to their pending original. An edit is dated like its original
+// and gets its fields, so both are planned into the same directory; the edit preference may skip one of them.
+type editStage struct {
+	cfg config
+}
+
+func (s editStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	sources := make([]string, 0, len(idx))
+	bySource := make(map[string]int, len(idx))
+	for _, i := range idx {
+		sources = append(sources, items[i].Source)
+		bySource[items[i].Source] = i
+	}
+	links := edits.Link(sources)
+	for _, i := range idx {
+		original, ok := links[items[i].Source]
+		if !ok {
+			continue
+		}
+		it, orig := &items[i], &items[bySource[original]]
+		it.EditOf = original
+		it.CreatedAt.Best = orig.CreatedAt.Best
+		it.Fields = maps.Clone(orig.Fields)
+
+		switch s.cfg.edits {
+		case edits.PreferOriginal:
+			it.Decision = reconcile.Decision{SourcePath: it.Source, Action: reconcile.ActionSkippedVersion, DuplicateOf: original}
+		case edits.PreferEdit:
+			if orig.Pending() {
+				// With several edits the original is skipped in favor of the first.
+				orig.Decision = reconcile.Decision{SourcePath: original, Action: reconcile.ActionSkippedVersion, DuplicateOf: it.Source}
+			}
+		}
+	}
+	return items, nil
+}
+
+// motionStage marks the pending JPEGs that are motion photos.
+type motionStage struct {
+	cfg config
+}
+
+func (s motionStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	for i := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		it := &items[i]
+		if !it.Pending() || !motionphoto.IsCandidate(it.Source) {
+			continue
+		}
+		ok, err := detectMotionPhoto(fsys, it.Source)
+		if err != nil && s.cfg.failFast {
+			return nil, fmt.Errorf("motion photo %s: %w", it.Source, err)
+		}
+		// A file that cannot be read here fails when it is copied.
+		it.MotionPhoto = ok
+	}
+	return items, nil
+}
+
+func detectMotionPhoto(fsys destfs.FS, path string) (bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return motionphoto.Detect(f)
+}
+
+// heicStage marks the pending HEIC photos that are converted to JPEG and, with heic.PolicyReplace,
+// names them after the JPEG, so the JPEG is planned instead of the photo.
+type heicStage struct {
+	cfg config
+}
+
+func (s heicStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	var idx []int
+	for _, i := range pending(items) {
+		if heic.IsCandidate(items[i].filename()) {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 {
+		return items, nil
+	}
+	if _, err := heic.Converter(); err != nil {
+		return nil, fmt.Errorf("convert heic: %w", err)
+	}
+	for _, i := range idx {
+		it := &items[i]
+		it.Converted = true
+		if s.cfg.heic == heic.PolicyReplace {
+			it.Name = heic.JPEGPath(it.filename())
+		}
+	}
+	return items, nil
+}
+
+// dedupeStage skips pending items whose content is identical to another pending item, and with
+// WithPayloadDedupe the JPEGs whose image data is.
+// hashed returns fsys, or the local filesystem when it is nil, with the hashes of WithHashes and
+// WithCache and the algorithm of WithHashAlgorithm, for the comparisons of reconcile.
+func (c config) hashed(fsys destfs.FS) destfs.FS {
+	local := destfs.IsOS(fsys)
+	fsys = destfs.OrOS(fsys)
+	if c.hashes != nil {
+		fsys = reconcile.WithHashes(fsys, c.hashes)
+	}
+	algorithm := c.hashAlgorithm
+	if c.cache != nil && local {
+		fsys = reconcile.WithHashCache(fsys, c.cache)
+		if algorithm == "" {
+			algorithm = reconcile.HashSHA256
+		}
+	}
+	if algorithm != "" {
+		fsys = reconcile.WithHashAlgorithm(fsys, algorithm)
+	}
+	return fsys
+}
+
+type dedupeStage struct {
+	cfg config
+}
+
+func (s dedupeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	sources := make([]string, 0, len(idx))
+	details := make(map[string]createdat.DetailedResult, len(idx))
+	sizes := make(map[string]int64, len(idx))
+	for _, i := range idx {
+		sources = append(sources, items[i].Source)
+		details[items[i].Source] = items[i].CreatedAt
+		sizes[items[i].Source] = items[i].Record.FileSizeBytes
+	}
+
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageDedupe, Done: 0, Total: len(sources)})
+	_, decisions, err := reconcile.DedupeSourcesScopedFS(ctx, s.cfg.hashed(s.cfg.sourceFS), sources, details, sizes, s.cfg.dedupeScope)
+	if err != nil {
+		return nil, err
+	}
+	// Decisions come back in the order of sources; kept sources stay pending.
+	for n, d := range decisions {
+		if d.Action == reconcile.ActionSkippedDuplicateSrc {
+			items[idx[n]].Decision = d
+		}
+	}
+	if s.cfg.payloadDedupe {
+		if err := s.dedupePayloads(ctx, items); err != nil {
+			return nil, err
+		}
+	}
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageDedupe, Done: len(sources), Total: len(sources)})
+	return items, nil
+}
+
+// dedupePayloads skips the pending JPEGs whose image data (imagehash.JPEG) is that of another pending
+// JPEG, such as a copy exported without its EXIF data. The largest file of each group is kept, as it
+// carries the most metadata; ties keep the oldest.
+func (s dedupeStage) dedupePayloads(ctx context.Context, items []Item) error {
+	fsys := destfs.OrOS(s.cfg.sourceFS)
+	groups := make(map[string][]int)
+	var keys []string
+	for _, i := range pending(items) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		it := items[i]
+		if !imagehash.IsCandidate(it.Source) {
+			continue
+		}
+		sum, ok, err := hashPayload(fsys, it.Source)
+		if err != nil {
+			if s.cfg.failFast {
+				return fmt.Errorf("hash image data of %s: %w", it.Source, err)
+			}
+			// A file that cannot be read here is still organized; copying it will report the error.
+			continue
+		}
+		if !ok {
+			continue
+		}
+		key := hex.EncodeToString(sum[:])
+		if s.cfg.dedupeScope == reconcile.DedupeScopeDirectory {
+			key = filepath.Dir(it.Source) + string(filepath.Separator) + key
+		}
+		if _, seen := groups[key]; !seen {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		var largest []string
+		var size int64 = -1
+		details := make(map[string]createdat.DetailedResult, len(group))
+		for _, i := range group {
+			it := items[i]
+			details[it.Source] = it.CreatedAt
+			switch {
+			case it.Record.FileSizeBytes > size:
+				largest, size = []string{it.Source}, it.Record.FileSizeBytes
+			case it.Record.FileSizeBytes == size:
+				largest = append(largest, it.Source)
+			}
+		}
+		kept := reconcile.PickOldest(largest, details)
+		for _, i := range group {
+			if items[i].Source != kept {
+				items[i].Decision = reconcile.Decision{SourcePath: items[i].Source, Action: reconcile.ActionSkippedDuplicateSrc, DuplicateOf: kept}
+			}
+		}
+	}
+	return nil
+}
+
+// hashPayload returns imagehash.JPEG of the file at path.
+func hashPayload(fsys destfs.FS, path string) ([32]byte, bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return [32]byte{}, false, &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	return imagehash.JPEG(f)
+}
+
+// libraryStage skips pending items whose content already exists anywhere in the destination.
+type libraryStage struct {
+	destination string
+	cfg         config
+}
+
+func (s libraryStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	library := make(map[int64][]string)
+	for _, root := range s.cfg.roots(s.destination) {
+		index, err := indexLibrary(ctx, destfs.OrOS(s.cfg.destFS), root, s.cfg.trashDirs(root))
+		if err != nil {
+			return nil, err
+		}
+		for size, paths := range index {
+			library[size] = append(library[size], paths...)
+		}
+	}
+
+	idx := pending(items)
+	sources := make([]string, 0, len(idx))
+	sizes := make(map[string]int64, len(idx))
+	for _, i := range idx {
+		sources = append(sources, items[i].Source)
+		sizes[items[i].Source] = items[i].Record.FileSizeBytes
+	}
+	_, decisions, err := reconcile.ResolveAgainstLibraryFS(ctx, s.cfg.hashed(s.cfg.sourceFS), s.cfg.hashed(s.cfg.destFS), sources, sizes, library)
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string]reconcile.Decision, len(decisions))
+	for _, d := range decisions {
+		bySource[d.SourcePath] = d
+	}
+	for _, i := range idx {
+		if d, ok := bySource[items[i].Source]; ok {
+			items[i].Decision = d
+		}
+	}
+	return items, nil
+}
+
+// dateCheckStage flags the pending items whose date is implausible (WithDateCheck), for the plan stage
+// to place them into the review directory.
+type dateCheckStage struct {
+	cfg config
+}
+
+func (s dateCheckStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	for _, i := range pending(items) {
+		if reason, ok := s.cfg.dateCheck.Check(items[i].CreatedAt); ok {
+			items[i].Suspicious = reason
+		}
+	}
+	return items, nil
+}
+
+// planStage sets the planned destination of every pending item.
+type planStage struct {
+	destination string
+	cfg         config
+}
+
+func (s planStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	sources := make([]string, 0, len(idx))
+	bestCreatedAt := make(map[string]time.Time, len(idx))
+	modTimes := make(map[string]time.Time, len(idx))
+	fields := make(map[string]plan.Fields, len(idx))
+	names := make(map[string]string)
+	uncertain := make(map[string]bool)
+	pairs := make(map[string]string)
+	for _, i := range idx {
+		it := items[i]
+		sources = append(sources, it.Source)
+		fields[it.Source] = it.Fields
+		if it.PairedWith != "" {
+			pairs[it.Source] = it.PairedWith
+		}
+		if it.Name != "" {
+			names[it.Source] = it.Name
+		}
+		if !it.CreatedAt.Best.CreatedAt.IsZero() {
+			bestCreatedAt[it.Source] = it.CreatedAt.Best.CreatedAt
+			if it.Suspicious != "" || s.cfg.review != "" && it.CreatedAt.Confidence().Below(s.cfg.review) {
+				uncertain[it.Source] = true
+			}
+		}
+		modTimes[it.Source] = it.Record.ModTime
+	}
+
+	planOpts := s.cfg.plan
+	planOpts.ModTimes = modTimes
+	planOpts.Fields = fields
+	planOpts.Filenames = names
+	planOpts.Review = uncertain
+	planOpts.Pairs = pairs
+	planned := s.cfg.batch != nil && s.cfg.batch.planned != nil
+	if planned {
+		planOpts.Planned = s.cfg.batch.planned.Has
+	}
+	ops, err := reconcile.PlanDestinations(s.destination, sources, bestCreatedAt, planOpts)
+	if err != nil {
+		return nil, err
+	}
+	if planned {
+		paths := make([]string, len(ops))
+		for n, op := range ops {
+			paths[n] = op.DestinationPath
+		}
+		if err := s.cfg.batch.planned.add(paths); err != nil {
+			return nil, err
+		}
+	}
+	// PlanDestinations returns one operation per source, in order.
+	for n, op := range ops {
+		items[idx[n]].Decision.SourcePath = op.SourcePath
+		items[idx[n]].Decision.DestinationPath = op.DestinationPath
+		// A name shortened to fit the path limits is the name reconcile places the file under.
+		items[idx[n]].Name = op.Filename
+		items[idx[n]].Review = uncertain[op.SourcePath]
+	}
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StagePlan, Done: len(ops), Total: len(ops)})
+	return items, nil
+}
+
+// reconcileStage decides every pending item against the files already in the destination.
+type reconcileStage struct {
+	destination string
+	cfg         config
+}
+
+func (s reconcileStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	if s.cfg.inPlace {
+		idx = s.skipInPlace(items, idx)
+	}
+	idx, err := s.failIgnored(items, idx)
+	if err != nil {
+		return nil, err
+	}
+	ops := make([]plan.Operation, 0, len(idx))
+	for _, i := range idx {
+		ops = append(ops, plan.Operation{
+			SourcePath: items[i].Source, DestinationPath: items[i].Decision.DestinationPath, Filename: items[i].Name,
+			PairedWith: items[i].PairedWith,
+		})
+	}
+
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageReconcile, Done: 0, Total: len(ops)})
+	var reserved func(string) bool
+	if s.cfg.batch != nil && s.cfg.batch.copying != nil {
+		reserved = s.cfg.batch.copying.Has
+	}
+	decisions, err := reconcile.ResolveAgainstDestinationReserved(ctx, s.cfg.hashed(s.cfg.sourceFS), s.cfg.hashed(s.cfg.destFS), ops, reserved)
+	if err != nil {
+		return nil, err
+	}
+	for n, d := range decisions {
+		items[idx[n]].Decision = d
+	}
+	progress.Report(s.cfg.progress, progress.Event{Stage: progress.StageReconcile, Done: len(ops), Total: len(ops)})
+	return items, nil
+}
+
+// skipInPlace decides the items of an in-place run that are already where they belong, without
+// comparing them with themselves, and returns the indexes of the others.
+func (s reconcileStage) skipInPlace(items []Item, idx []int) []int {
+	rest := idx[:0]
+	for _, i := range idx {
+		it := &items[i]
+		// Reconcile places a file under its own name in the planned directory, or a free suffix.
+		if filepath.Join(filepath.Dir(it.Decision.DestinationPath), it.filename()) != it.Source {
+			rest = append(rest, i)
+			continue
+		}
+		it.Decision.FinalDestinationPath = it.Source
+		it.Decision.Action = reconcile.ActionSkippedIdentical
+	}
+	return rest
+}
+
+// failIgnored fails the items planned into a directory of the destination that holds a scan.IgnoreFile,
+// or lies below one, and returns the indexes of the others. Each directory is looked up once.
+func (s reconcileStage) failIgnored(items []Item, idx []int) ([]int, error) {
+	fsys := destfs.OrOS(s.cfg.destFS)
+	roots := s.cfg.roots(s.destination)
+	marked := make(map[string]bool)
+	var isMarked func(dir string) (bool, error)
+	isMarked = func(dir string) (bool, error) {
+		if m, ok := marked[dir]; ok {
+			return m, nil
+		}
+		m := false
+		_, err := fsys.Stat(filepath.Join(dir, scan.IgnoreFile))
+		switch {
+		case err == nil:
+			m = true
+		case !errors.Is(err, fs.ErrNotExist):
+			return false, fmt.Errorf("stat %s: %w", filepath.Join(dir, scan.IgnoreFile), err)
+		}
+		// Directories below a root inherit the marker of their parent.
+		for _, root := range roots {
+			if rel, ok := within(root, dir); !m && ok && rel != "." {
+				if m, err = isMarked(filepath.Dir(dir)); err != nil {
+					return false, err
+				}
+				break
+			}
+		}
+		marked[dir] = m
+		return m, nil
+	}
+
+	rest := idx[:0]
+	for _, i := range idx {
+		it := &items[i]
+		m, err := isMarked(filepath.Dir(it.Decision.DestinationPath))
+		if err != nil {
+			return nil, err
+		}
+		if !m {
+			rest = append(rest, i)
+			continue
+		}
+		it.Decision.Action = reconcile.ActionFailed
+		it.Decision.Error = fmt.Errorf("%s: %w", filepath.Dir(it.Decision.DestinationPath), errcode.ErrDestinationIgnored)
+	}
+	return rest, nil
+}
+
+// sidecarStage plans the sidecars of items that are going to be copied.
+type sidecarStage struct {
+	cfg config
+}
+
+func (s sidecarStage) Process(_ context.Context, items []Item) ([]Item, error) {
+	for i := range items {
+		d := &items[i].Decision
+		if d.Action != reconcile.ActionCopy && d.Action != reconcile.ActionCopyRenamed {
+			continue
+		}
+		if len(items[i].Sidecars) == 0 && s.cfg.sidecars == sidecar.PolicyRequire {
+			d.Action = reconcile.ActionFailed
+			d.Error = sidecar.ErrMissing
+			s.cfg.events.error(d.SourcePath, sidecar.ErrMissing)
+			continue
+		}
+		d.Sidecars = sidecar.Plan(d.SourcePath, d.FinalDestinationPath, items[i].Sidecars)
+		if items[i].MotionPhoto && s.cfg.motionPhotos == motionphoto.PolicyExtract {
+			d.Sidecars = append(d.Sidecars, plan.Operation{
+				SourcePath:      d.SourcePath,
+				DestinationPath: motionphoto.CompanionPath(d.FinalDestinationPath),
+				Transform:       motionphoto.Video,
+			})
+		}
+		if items[i].Converted && s.cfg.heic == heic.PolicyKeep {
+			d.Sidecars = append(d.Sidecars, plan.Operation{
+				SourcePath:      d.SourcePath,
+				DestinationPath: heic.JPEGPath(d.FinalDestinationPath),
+				Transform:       heic.ToJPEG,
+			})
+		}
+		if s.cfg.profile != profile.None {
+			d.Sidecars = s.profileSidecars(items[i], d.Sidecars)
+		}
+		if items[i].Review {
+			note := review.New(d.SourcePath, items[i].CreatedAt)
+			if items[i].Suspicious != "" {
+				note.Reason = items[i].Suspicious
+			}
+			data, err := note.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			d.Sidecars = append(d.Sidecars, plan.Operation{DestinationPath: review.NotePath(d.FinalDestinationPath), Content: data})
+		}
+	}
+	return items, nil
+}
+
+// profileSidecars names the XMP sidecar of an item the way the export profile expects,
+// or generates one when the item has none.
+func (s sidecarStage) profileSidecars(it Item, sidecars []plan.Operation) []plan.Operation {
+	xmpPath := s.cfg.profile.SidecarPath(it.Decision.FinalDestinationPath)
+	for i, sc := range sidecars {
+		if profile.IsXMP(sc.SourcePath) {
+			// Further XMP sidecars keep their own name.
+			sidecars[i].DestinationPath = xmpPath
+			return sidecars
+		}
+	}
+
+	createdAt := it.CreatedAt.Best.CreatedAt
+	if it.CreatedAt.Best.Source == createdat.SourceMtime {
+		// The server reads the file time itself; it is no capture date worth recording.
+		createdAt = time.Time{}
+	}
+	if content := profile.XMP(createdAt, it.Fields); content != nil {
+		sidecars = append(sidecars, plan.Operation{DestinationPath: xmpPath, Content: content})
+	}
+	return sidecars
+}
@@ -0,0 +1,108 @@
+package organizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/quidome/media-organizer-go/pkg/copy"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+// tracerName is the instrumentation scope of the spans of a run.
+const tracerName = "github.com/quidome/media-organizer-go/pkg/organizer"
+
+// LargeFileBytes is the size from which a copied file gets a span of its own.
+const LargeFileBytes = 64 << 20
+
+// WithTracerProvider records OpenTelemetry spans with tp: one for the run, one per stage and one for
+// every copied file of at least LargeFileBytes. Without it the global provider (otel.GetTracerProvider)
+// is used, which records nothing unless the program installed one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tracerProvider = tp }
+}
+
+func (c config) tracer() trace.Tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// stageName returns the span name of s: "discover" for discoverStage, the type name for custom stages.
+func stageName(s Stage) string {
+	name := fmt.Sprintf("%T", s)
+	if pkg, typ, ok := strings.Cut(name, "."); ok && pkg == "organizer" && strings.HasSuffix(typ, "Stage") {
+		return strings.TrimSuffix(typ, "Stage")
+	}
+	return name
+}
+
+// processStage runs stage within a span of its own.
+func processStage(ctx context.Context, cfg config, stage Stage, items []Item) ([]Item, error) {
+	ctx, span := cfg.tracer().Start(ctx, "stage "+stageName(stage), trace.WithAttributes(attribute.Int("items.in", len(items))))
+	defer span.End()
+
+	out, err := stage.Process(ctx, items)
+	endSpan(span, err)
+	span.SetAttributes(attribute.Int("items.out", len(out)))
+	return out, err
+}
+
+// endSpan records err, if any, as the outcome of span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// fileSpans traces the copies of large files. The copy stage calls its methods from one goroutine.
+type fileSpans struct {
+	ctx    context.Context
+	tracer trace.Tracer
+	sizes  map[string]int64
+	open   map[string]trace.Span
+}
+
+func newFileSpans(ctx context.Context, cfg config, sizes map[string]int64) *fileSpans {
+	return &fileSpans{ctx: ctx, tracer: cfg.tracer(), sizes: sizes, open: make(map[string]trace.Span)}
+}
+
+func (f *fileSpans) start(op plan.Operation) {
+	size := f.sizes[op.SourcePath]
+	if size < LargeFileBytes {
+		return
+	}
+	_, span := f.tracer.Start(f.ctx, "copy file", trace.WithAttributes(
+		attribute.String("file.source", op.SourcePath),
+		attribute.String("file.destination", op.DestinationPath),
+		attribute.Int64("file.size", size),
+	))
+	f.open[op.SourcePath] = span
+}
+
+func (f *fileSpans) done(r copy.Result) {
+	span, ok := f.open[r.Operation.SourcePath]
+	if !ok {
+		return
+	}
+	delete(f.open, r.Operation.SourcePath)
+	endSpan(span, r.Error)
+	span.End()
+}
+
+// end ends the spans of copies that never reported a result, such as the copy a cancellation interrupted.
+func (f *fileSpans) end(err error) {
+	for src, span := range f.open {
+		endSpan(span, err)
+		span.End()
+		delete(f.open, src)
+	}
+}
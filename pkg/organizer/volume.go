@@ -0,0 +1,165 @@
+package organizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+	"github.com/quidome/media-organizer-go/pkg/volume"
+)
+
+// VolumePlan is the part of a run assigned to one volume (WithVolumes).
+type VolumePlan struct {
+	volume.Volume
+
+	// Folders are the folders of the run on the volume, relative to its root, in order.
+	Folders []string
+
+	// Bytes is the size of the files copied to the volume.
+	Bytes int64
+}
+
+// checkVolumes reports why cfg cannot spread a run over volumes.
+func checkVolumes(cfg config) error {
+	switch {
+	case len(cfg.volumes) == 0:
+		return nil
+	case cfg.batchSize > 0:
+		return errors.New("volumes cannot be combined with batches")
+	case cfg.inPlace:
+		return errors.New("volumes cannot be combined with in-place organizing")
+	}
+	return nil
+}
+
+// roots returns the roots files are organized into: the volumes of WithVolumes, or destination.
+func (c config) roots(destination string) []string {
+	if len(c.volumes) == 0 {
+		return []string{destination}
+	}
+	roots := make([]string, len(c.volumes))
+	for i, v := range c.volumes {
+		roots[i] = v.Path
+	}
+	return roots
+}
+
+// volumeStage moves the planned destination of every pending item below the root of the volume its
+// folder is assigned to (WithVolumes).
+type volumeStage struct {
+	destination string
+	cfg         config
+}
+
+func (s volumeStage) Process(ctx context.Context, items []Item) ([]Item, error) {
+	idx := pending(items)
+	rels := make([]string, len(idx))
+	folderOf := make([]int, len(idx))
+	byPath := make(map[string]int)
+	var folders []volume.Folder
+	for n, i := range idx {
+		rel, err := filepath.Rel(s.destination, items[i].Decision.DestinationPath)
+		if err != nil {
+			return nil, err
+		}
+		path := s.cfg.volumeSplit.Folder(filepath.ToSlash(rel))
+		f, ok := byPath[path]
+		if !ok {
+			f = len(folders)
+			byPath[path] = f
+			folders = append(folders, volume.Folder{Path: path})
+		}
+		folders[f].Bytes += items[i].Record.FileSizeBytes
+		rels[n], folderOf[n] = rel, f
+	}
+
+	existing, err := s.existing(ctx, folders)
+	if err != nil {
+		return nil, err
+	}
+	assigned := volume.Assign(folders, s.cfg.volumes, existing)
+	for n, i := range idx {
+		v := assigned[folderOf[n]]
+		if v < 0 {
+			items[i].Decision = reconcile.Decision{
+				SourcePath: items[i].Source,
+				Action:     reconcile.ActionFailed,
+				Error:      fmt.Errorf("%s: %w", folders[folderOf[n]].Path, volume.ErrFull),
+			}
+			s.cfg.events.error(items[i].Source, items[i].Decision.Error)
+			continue
+		}
+		items[i].Decision.DestinationPath = filepath.Join(s.cfg.volumes[v].Path, rels[n])
+	}
+	return items, nil
+}
+
+// existing returns the folders that are already on a volume, with the index of the first volume
+// holding them.
+func (s volumeStage) existing(ctx context.Context, folders []volume.Folder) (map[string]int, error) {
+	dst := destfs.OrOS(s.cfg.destFS)
+	existing := make(map[string]int)
+	for _, f := range folders {
+		if f.Path == "." {
+			// Files in the root of the layout are on every volume.
+			continue
+		}
+		for v, vol := range s.cfg.volumes {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			info, err := dst.Stat(filepath.Join(vol.Path, filepath.FromSlash(f.Path)))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				existing[f.Path] = v
+				break
+			}
+		}
+	}
+	return existing, nil
+}
+
+// volumePlans returns the folders and bytes of res on each volume of cfg.
+func volumePlans(res Result, cfg config) []VolumePlan {
+	plans := make([]VolumePlan, len(cfg.volumes))
+	folders := make([]map[string]bool, len(cfg.volumes))
+	for v, vol := range cfg.volumes {
+		plans[v].Volume = vol
+		folders[v] = make(map[string]bool)
+	}
+	for _, d := range res.Decisions {
+		switch d.Action {
+		case reconcile.ActionCopy, reconcile.ActionCopyRenamed, reconcile.ActionCopied, reconcile.ActionCopiedRenamed, reconcile.ActionSkippedIdentical:
+		default:
+			continue
+		}
+		for v, vol := range cfg.volumes {
+			rel, ok := within(vol.Path, d.DestinationPath)
+			if !ok {
+				continue
+			}
+			folders[v][cfg.volumeSplit.Folder(filepath.ToSlash(rel))] = true
+			if d.Action != reconcile.ActionSkippedIdentical {
+				plans[v].Bytes += res.Sizes[d.SourcePath]
+			}
+			break
+		}
+	}
+	for v := range plans {
+		for folder := range folders[v] {
+			plans[v].Folders = append(plans[v].Folders, folder)
+		}
+		sort.Strings(plans[v].Folders)
+	}
+	return plans
+}
@@ -0,0 +1,160 @@
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// SchemaVersion is the version of the plan file schema that File.Encode writes. Decode refuses other
+// versions.
+const SchemaVersion = 2
+
+// ErrModified is returned by Decode for a plan file whose content no longer matches its checksum,
+// such as one edited by hand.
+var ErrModified = errors.New("plan changed since it was written")
+
+// The extractions of a SidecarEntry: the video of a motion photo, and the JPEG of a HEIC photo.
+const (
+	ExtractMotionVideo = "motion-video"
+	ExtractJPEG        = "jpeg"
+)
+
+// File is the complete plan of a run, written to be reviewed, edited and executed later without
+// scanning the source again. The paths of its entries are slash-separated and relative to Source and
+// Destination, the roots the plan was made for.
+type File struct {
+	Version int `json:"version"`
+
+	// Checksum is the hex-encoded SHA-256 of the plan with an empty Checksum, set by Encode.
+	Checksum string `json:"checksum"`
+
+	Created     time.Time `json:"created"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+
+	// Move and InPlace report a plan whose files are moved instead of copied.
+	Move    bool `json:"move,omitempty"`
+	InPlace bool `json:"in_place,omitempty"`
+
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is the planned decision of one source file. Size, ModTime and SourceSHA256 are the stat and
+// content the source was planned with; a source that changed since is not copied.
+type Entry struct {
+	Source          string    `json:"source"`
+	Size            int64     `json:"size"`
+	ModTime         time.Time `json:"mod_time"`
+	SourceSHA256    string    `json:"source_sha256,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	CreatedAtSource string    `json:"created_at_source"`
+
+	// Action is the reconcile action of the file; only copy and copy_renamed entries are executed.
+	Action string `json:"action"`
+
+	// Destination is the final destination of the file, empty when none was planned.
+	Destination string `json:"destination,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	// ConvertToJPEG reports a HEIC source written as the JPEG it converts to.
+	ConvertToJPEG bool `json:"convert_to_jpeg,omitempty"`
+
+	Sidecars []SidecarEntry `json:"sidecars,omitempty"`
+}
+
+// SidecarEntry is a companion file planned to travel with the file of its entry: a copy of Source,
+// the Content of a generated sidecar, or what Extract names extracted from the source of the entry.
+// It is written as Name into the directory of the destination of its entry, and follows an edited
+// destination there.
+type SidecarEntry struct {
+	Source  string `json:"source,omitempty"`
+	Name    string `json:"name"`
+	Content []byte `json:"content,omitempty"`
+	Extract string `json:"extract,omitempty"`
+}
+
+// Encode writes f to w as indented JSON, with the current SchemaVersion and its Checksum.
+func (f File) Encode(w io.Writer) error {
+	f.Version = SchemaVersion
+	sum, err := f.checksum()
+	if err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	f.Checksum = sum
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
+
+// Decode reads a plan file from r. It refuses other schema versions, entry paths that are not
+// relative to their root or leave it, and, with ErrModified, a plan that does not match its checksum.
+func Decode(r io.Reader) (File, error) {
+	f, err := DecodeEdited(r)
+	if err != nil {
+		return File{}, err
+	}
+	sum, err := f.checksum()
+	if err != nil {
+		return File{}, fmt.Errorf("read plan: %w", err)
+	}
+	if f.Checksum != sum {
+		return File{}, fmt.Errorf("read plan: %w: checksum %q, content hashes to %q", ErrModified, f.Checksum, sum)
+	}
+	return f, nil
+}
+
+// DecodeEdited reads a plan file from r like Decode, but accepts a plan that was changed after it was
+// written, such as one edited by hand.
+func DecodeEdited(r io.Reader) (File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return File{}, fmt.Errorf("read plan: %w", err)
+	}
+	if f.Version != SchemaVersion {
+		return File{}, fmt.Errorf("read plan: schema version %d, want %d", f.Version, SchemaVersion)
+	}
+	for i, e := range f.Entries {
+		if !local(e.Source) {
+			return File{}, fmt.Errorf("read plan: entry %d: source %q is not inside the source", i, e.Source)
+		}
+		if e.Destination != "" && !local(e.Destination) {
+			return File{}, fmt.Errorf("read plan: entry %d: destination %q is not inside the destination", i, e.Destination)
+		}
+		for _, sc := range e.Sidecars {
+			if sc.Source != "" && !local(sc.Source) {
+				return File{}, fmt.Errorf("read plan: entry %d: sidecar source %q is not inside the source", i, sc.Source)
+			}
+			if !local(sc.Name) || path.Base(sc.Name) != sc.Name {
+				return File{}, fmt.Errorf("read plan: entry %d: sidecar name %q is not a file name", i, sc.Name)
+			}
+		}
+	}
+	return f, nil
+}
+
+// checksum returns the hex-encoded SHA-256 of the JSON encoding of f with an empty Checksum.
+func (f File) checksum() (string, error) {
+	f.Checksum = ""
+	data, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// local reports whether the slash-separated path p stays inside the directory it is relative to.
+func local(p string) bool {
+	return filepath.IsLocal(filepath.FromSlash(p))
+}
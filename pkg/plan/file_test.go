@@ -0,0 +1,87 @@
+package plan
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFile_EncodeDecode(t *testing.T) {
+	f := File{
+		Created:     time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Source:      "/photos",
+		Destination: "sftp://nas/library",
+		Entries: []Entry{{
+			Source:          "2024/IMG_1.jpg",
+			Size:            42,
+			SourceSHA256:    "0123abcd",
+			ModTime:         time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+			CreatedAt:       time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+			CreatedAtSource: "metadata",
+			Action:          "copy",
+			Destination:     "2024/04/30/IMG_1.jpg",
+			Sidecars: []SidecarEntry{
+				{Source: "2024/IMG_1.xmp", Name: "IMG_1.xmp"},
+				{Name: "IMG_1.mp4", Extract: ExtractMotionVideo},
+			},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != SchemaVersion || got.Checksum == "" || got.Destination != f.Destination || len(got.Entries) != 1 {
+		t.Fatalf("Decode = %+v", got)
+	}
+	e := got.Entries[0]
+	if e.Destination != "2024/04/30/IMG_1.jpg" || !e.ModTime.Equal(f.Entries[0].ModTime) || e.SourceSHA256 != "0123abcd" || len(e.Sidecars) != 2 || e.Sidecars[1].Extract != ExtractMotionVideo {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestDecode_Refuses(t *testing.T) {
+	for name, tc := range map[string]struct {
+		json string
+		want string
+	}{
+		"version":      {`{"version": 1}`, "schema version 1"},
+		"checksum":     {`{"version": 2, "entries": []}`, "plan changed since it was written"},
+		"escaping":     {`{"version": 2, "entries": [{"source": "a.jpg", "destination": "../a.jpg"}]}`, `destination "../a.jpg"`},
+		"absolute":     {`{"version": 2, "entries": [{"source": "/etc/passwd"}]}`, `source "/etc/passwd"`},
+		"sidecar path": {`{"version": 2, "entries": [{"source": "a.jpg", "sidecars": [{"name": "../a.xmp"}]}]}`, `sidecar name "../a.xmp"`},
+	} {
+		if _, err := Decode(strings.NewReader(tc.json)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: Decode error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestDecode_Tampered(t *testing.T) {
+	f := File{
+		Source:      "/photos",
+		Destination: "/library",
+		Entries:     []Entry{{Source: "IMG_1.jpg", Size: 42, SourceSHA256: "0123abcd", Action: "copy", Destination: "2024/IMG_1.jpg"}},
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(buf.String(), "2024/IMG_1.jpg", "2023/IMG_1.jpg", 1)
+
+	if _, err := Decode(strings.NewReader(tampered)); !errors.Is(err, ErrModified) {
+		t.Errorf("Decode of a tampered plan = %v, want ErrModified", err)
+	}
+	got, err := DecodeEdited(strings.NewReader(tampered))
+	if err != nil {
+		t.Fatalf("DecodeEdited: %v", err)
+	}
+	if got.Entries[0].Destination != "2023/IMG_1.jpg" {
+		t.Errorf("DecodeEdited destination = %q, want the edited one", got.Entries[0].Destination)
+	}
+}
@@ -0,0 +1,325 @@
+package plan
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLayout is the layout of an organized library: one directory per day.
+const DefaultLayout = "{year}/{month}/{day}"
+
+// presets names the common date layouts.
+var presets = map[string]string{
+	"daily":   DefaultLayout,
+	"monthly": "{year}/{month}",
+	"yearly":  "{year}",
+}
+
+// ParseNamedLayout parses a preset name (daily, monthly or yearly) or, failing that, a layout template.
+func ParseNamedLayout(s string) (Layout, error) {
+	if template, ok := presets[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return ParseLayout(template)
+	}
+	return ParseLayout(s)
+}
+
+// Date tokens are filled from the created_at of a file.
+const (
+	TokenYear  = "year"
+	TokenMonth = "month"
+	TokenDay   = "day"
+)
+
+// Field tokens are filled from per-file metadata passed as Fields.
+const (
+	// TokenAlbum is the album a file belongs to (e.g. from a Google Takeout album).
+	TokenAlbum = "album"
+
+	// TokenFavorite is FavoriteValue for files marked as favorite (e.g. in Apple Photos) and empty otherwise.
+	TokenFavorite = "favorite"
+
+	// TokenRating is the star rating of a file, 1 to 5 (e.g. from a Lightroom catalog), and empty when unrated.
+	TokenRating = "rating"
+
+	// TokenPlace is where a file was taken, "City, Country", from its GPS position; empty without one.
+	TokenPlace = "place"
+
+	// TokenCountry is the country a file was taken in, such as "Italy", from its GPS position; empty without one.
+	TokenCountry = "country"
+
+	// TokenCity is the city a file was taken in, such as "Rome", from its GPS position; empty without one,
+	// or when no city is close enough to it.
+	TokenCity = "city"
+
+	// TokenCamera is the camera a file was taken with, such as "Canon EOS R5", from its EXIF Make and Model.
+	TokenCamera = "camera"
+
+	// TokenKeyword holds the keywords of a file (IPTC Keywords or XMP dc:subject), separated by
+	// KeywordSeparator. A layout renders the first one; a route matches any of them.
+	TokenKeyword = "keyword"
+
+	// TokenScreenshot is ScreenshotValue for screenshots and empty otherwise.
+	TokenScreenshot = "screenshot"
+
+	// TokenDuration is the duration of a video in seconds, such as "2.5"; empty for photos.
+	TokenDuration = "duration"
+
+	// TokenResolution is the display size of a video, such as "1920x1080" or "1080x1920" for a portrait video.
+	TokenResolution = "resolution"
+
+	// TokenCodec is the video codec of a video, such as "h264" or "hevc".
+	TokenCodec = "codec"
+
+	// TokenBurst names the burst sequence a photo was taken in, such as "Burst 2024-01-02 03.04.05";
+	// empty for other files.
+	TokenBurst = "burst"
+
+	// TokenDevice is the device a file was taken with: its camera and body serial number, such as
+	// "Canon EOS R5 #012345678901", or the device family its filename is typical of (see package device).
+	TokenDevice = "device"
+)
+
+// FavoriteValue is the value of TokenFavorite for a favorite file.
+const FavoriteValue = "Favorites"
+
+// ScreenshotValue is the value of TokenScreenshot for a screenshot.
+const ScreenshotValue = "Screenshots"
+
+// KeywordSeparator separates the keywords in the value of TokenKeyword.
+const KeywordSeparator = "\n"
+
+// fieldTokens lists the field tokens a layout may use.
+var fieldTokens = map[string]bool{
+	TokenAlbum: true, TokenFavorite: true, TokenRating: true, TokenPlace: true, TokenCountry: true, TokenCity: true,
+	TokenCamera: true, TokenKeyword: true, TokenScreenshot: true, TokenDuration: true, TokenResolution: true,
+	TokenCodec: true, TokenBurst: true, TokenDevice: true,
+}
+
+// Fields holds the field token values of a file. Missing and empty values are allowed.
+type Fields map[string]string
+
+// Values returns the values of token: the keywords for TokenKeyword, and the value for other tokens.
+// It returns nil when token is not set.
+func (f Fields) Values(token string) []string {
+	v := f[token]
+	switch {
+	case v == "":
+		return nil
+	case token == TokenKeyword:
+		return strings.Split(v, KeywordSeparator)
+	default:
+		return []string{v}
+	}
+}
+
+// Layout is a parsed destination directory template such as "{year}/{month}/{day}" or "{album}/{year}".
+//
+// A path segment that renders empty, for example {album} for a file outside any album, is dropped.
+// The zero Layout is DefaultLayout.
+type Layout struct {
+	template string
+	segments [][]part
+}
+
+// part is literal text or a token of a segment.
+type part struct {
+	text  string
+	token string
+}
+
+// ParseLayout parses a layout template. Templates are slash-separated, relative,
+// and may only use the date tokens and the known field tokens.
+func ParseLayout(template string) (Layout, error) {
+	if strings.TrimSpace(template) == "" {
+		return Layout{}, fmt.Errorf("empty layout")
+	}
+	if strings.HasPrefix(template, "/") {
+		return Layout{}, fmt.Errorf("layout %q must be relative to the destination", template)
+	}
+
+	l := Layout{template: template}
+	for _, seg := range strings.Split(template, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return Layout{}, fmt.Errorf("layout %q has an invalid path segment %q", template, seg)
+		}
+		var parts []part
+		for seg != "" {
+			open := strings.IndexByte(seg, '{')
+			if open < 0 {
+				parts = append(parts, part{text: seg})
+				break
+			}
+			if open > 0 {
+				parts = append(parts, part{text: seg[:open]})
+			}
+			end := strings.IndexByte(seg[open:], '}')
+			if end < 0 {
+				return Layout{}, fmt.Errorf("layout %q has an unterminated token", template)
+			}
+			token := seg[open+1 : open+end]
+			if !knownToken(token) {
+				return Layout{}, fmt.Errorf("layout %q uses unknown token {%s}", template, token)
+			}
+			parts = append(parts, part{token: token})
+			seg = seg[open+end+1:]
+		}
+		l.segments = append(l.segments, parts)
+	}
+	return l, nil
+}
+
+func knownToken(token string) bool {
+	switch token {
+	case TokenYear, TokenMonth, TokenDay:
+		return true
+	}
+	return fieldTokens[token]
+}
+
+// String returns the template of the layout.
+func (l Layout) String() string {
+	if l.segments == nil {
+		return DefaultLayout
+	}
+	return l.template
+}
+
+// IsZero reports whether l is the zero Layout, which renders as DefaultLayout.
+func (l Layout) IsZero() bool { return l.segments == nil }
+
+// Uses reports whether the layout references token.
+func (l Layout) Uses(token string) bool {
+	for _, seg := range l.orDefault().segments {
+		for _, p := range seg {
+			if p.token == token {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Dir renders the destination-relative directory of a file created at createdAt.
+func (l Layout) Dir(createdAt time.Time, fields Fields) string {
+	var segs []string
+	for _, seg := range l.orDefault().segments {
+		var b strings.Builder
+		for _, p := range seg {
+			switch p.token {
+			case "":
+				b.WriteString(p.text)
+			case TokenYear:
+				fmt.Fprintf(&b, "%04d", createdAt.Year())
+			case TokenMonth:
+				fmt.Fprintf(&b, "%02d", createdAt.Month())
+			case TokenDay:
+				fmt.Fprintf(&b, "%02d", createdAt.Day())
+			default:
+				if values := fields.Values(p.token); len(values) > 0 {
+					b.WriteString(sanitizeSegment(values[0]))
+				}
+			}
+		}
+		if s := strings.TrimSpace(b.String()); s != "" {
+			segs = append(segs, s)
+		}
+	}
+	return filepath.Join(segs...)
+}
+
+// Period returns the period of the dates l renders as the destination-relative, slash-separated
+// directory dir: the day, month or year, depending on the date tokens of l, in loc. It reports false
+// when dir is not a directory l renders, which includes layouts without {year} and directories of a
+// file whose field tokens rendered empty.
+func (l Layout) Period(dir string, loc *time.Location) (start, end time.Time, ok bool) {
+	segments := l.orDefault().segments
+	dirSegs := strings.Split(dir, "/")
+	if len(dirSegs) != len(segments) {
+		return time.Time{}, time.Time{}, false
+	}
+	values := make(map[string]int)
+	for i, seg := range segments {
+		var pattern strings.Builder
+		var tokens []string
+		for _, p := range seg {
+			switch p.token {
+			case "":
+				pattern.WriteString(regexp.QuoteMeta(p.text))
+				continue
+			case TokenYear:
+				pattern.WriteString(`(\d{4})`)
+			case TokenMonth, TokenDay:
+				pattern.WriteString(`(\d{2})`)
+			default:
+				pattern.WriteString(`(.+?)`)
+			}
+			tokens = append(tokens, p.token)
+		}
+		m := regexp.MustCompile("^" + pattern.String() + "$").FindStringSubmatch(dirSegs[i])
+		if m == nil {
+			return time.Time{}, time.Time{}, false
+		}
+		for n, token := range tokens {
+			if !fieldTokens[token] {
+				values[token], _ = strconv.Atoi(m[n+1])
+			}
+		}
+	}
+
+	year, hasYear := values[TokenYear]
+	month, hasMonth := values[TokenMonth]
+	day, hasDay := values[TokenDay]
+	switch {
+	case !hasYear, hasDay && !hasMonth:
+		return time.Time{}, time.Time{}, false
+	case !hasMonth:
+		start = time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		end = start.AddDate(1, 0, 0)
+	case !hasDay:
+		start = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+		end = start.AddDate(0, 0, 1)
+	}
+	if hasMonth && (month < 1 || month > 12 || int(start.Month()) != month) || hasDay && start.Day() != day {
+		// Out of range values, such as month 13 or 31 February, normalize to another date.
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+func (l Layout) orDefault() Layout {
+	if l.segments != nil {
+		return l
+	}
+	def, err := ParseLayout(DefaultLayout)
+	if err != nil {
+		panic(err)
+	}
+	return def
+}
+
+// sanitizeSegment keeps a metadata value inside a single path segment.
+func sanitizeSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', 0:
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// DestinationLayout is Destination for a layout and the field values of the file.
+func DestinationLayout(destRoot, filename string, createdAt time.Time, layout Layout, fields Fields, existingFiles map[string]bool) string {
+	return resolveCollision(filepath.Join(destRoot, layout.Dir(createdAt, fields)), filename, existingFiles)
+}
@@ -0,0 +1,106 @@
+package plan
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLayout_RejectsInvalidTemplates(t *testing.T) {
+	for _, template := range []string{"", "/abs/{year}", "{year}/../x", "{year}//{month}", "{yeer}", "{year"} {
+		if _, err := ParseLayout(template); err == nil {
+			t.Errorf("ParseLayout(%q): expected an error", template)
+		}
+	}
+}
+
+func TestLayout_Dir(t *testing.T) {
+	createdAt := time.Date(2023, 11, 5, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		template string
+		fields   Fields
+		want     string
+	}{
+		{DefaultLayout, nil, filepath.Join("2023", "11", "05")},
+		{"{year}/{year}-{month}", nil, filepath.Join("2023", "2023-11")},
+		{"Albums/{album}/{year}", Fields{TokenAlbum: "Trip to Rome"}, filepath.Join("Albums", "Trip to Rome", "2023")},
+		{"{album}/{year}", nil, "2023"},
+		{"{album}/{year}", Fields{TokenAlbum: "a/../b"}, filepath.Join("a_.._b", "2023")},
+		{"{album}", Fields{TokenAlbum: ".."}, "_"},
+		{"{place}/{year}", Fields{TokenPlace: "Rome, Italy"}, filepath.Join("Rome, Italy", "2023")},
+		{"{year}/{country}/{city}", Fields{TokenCountry: "Italy", TokenCity: "Rome"}, filepath.Join("2023", "Italy", "Rome")},
+		{"{year}/{country}/{city}", Fields{TokenCountry: "Belarus"}, filepath.Join("2023", "Belarus")},
+		{"{camera}/{year}", Fields{TokenCamera: "Canon EOS R5"}, filepath.Join("Canon EOS R5", "2023")},
+		{"{device}/{year}", Fields{TokenDevice: "Canon EOS R5 #0123"}, filepath.Join("Canon EOS R5 #0123", "2023")},
+		{"{keyword}/{year}", Fields{TokenKeyword: "scan" + KeywordSeparator + "family"}, filepath.Join("scan", "2023")},
+	}
+	for _, tt := range tests {
+		l, err := ParseLayout(tt.template)
+		if err != nil {
+			t.Fatalf("ParseLayout(%q): %v", tt.template, err)
+		}
+		if got := l.Dir(createdAt, tt.fields); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	var zero Layout
+	if got := zero.Dir(createdAt, nil); got != filepath.Join("2023", "11", "05") {
+		t.Errorf("zero layout: got %q", got)
+	}
+	if !zero.Uses(TokenDay) || zero.Uses(TokenAlbum) || zero.String() != DefaultLayout {
+		t.Errorf("zero layout should behave as %s", DefaultLayout)
+	}
+}
+
+func TestParseNamedLayout(t *testing.T) {
+	for name, want := range map[string]string{"daily": DefaultLayout, "Monthly": "{year}/{month}", "yearly": "{year}", "{album}/{year}": "{album}/{year}"} {
+		l, err := ParseNamedLayout(name)
+		if err != nil || l.String() != want {
+			t.Errorf("ParseNamedLayout(%q) = %q, %v; want %q", name, l, err, want)
+		}
+	}
+}
+
+func TestLayout_Period(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		template, dir string
+		start, end    time.Time
+	}{
+		{DefaultLayout, "2023/11/05", day(2023, 11, 5), day(2023, 11, 6)},
+		{"{year}/{month}", "2023/12", day(2023, 12, 1), day(2024, 1, 1)},
+		{"{year}", "2023", day(2023, 1, 1), day(2024, 1, 1)},
+		{"{year}/{year}-{month}", "2023/2023-02", day(2023, 2, 1), day(2023, 3, 1)},
+		{"Albums/{album}/{year}", "Albums/Trip to Rome/2023", day(2023, 1, 1), day(2024, 1, 1)},
+	}
+	for _, tt := range tests {
+		l, err := ParseLayout(tt.template)
+		if err != nil {
+			t.Fatalf("ParseLayout(%q): %v", tt.template, err)
+		}
+		start, end, ok := l.Period(tt.dir, time.UTC)
+		if !ok || !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("%s: Period(%s) = %v, %v, %v; want %v, %v", tt.template, tt.dir, start, end, ok, tt.start, tt.end)
+		}
+	}
+
+	for template, dir := range map[string]string{
+		DefaultLayout:           "2023/11",
+		"{year}/{month}":        "2023/13",
+		"{year}-{month}-{day}":  "2023-02-30",
+		"{album}/{year}":        "2023",
+		"{album}":               "Trip",
+		"{year}/{month}/extra":  "2023/11/other",
+		"{year}/{month}/{day}x": "unknown/a/b",
+	} {
+		l, err := ParseLayout(template)
+		if err != nil {
+			t.Fatalf("ParseLayout(%q): %v", template, err)
+		}
+		if start, _, ok := l.Period(dir, time.UTC); ok {
+			t.Errorf("%s: Period(%s) = %v, want no match", template, dir, start)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package plan
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// PathLimits bounds the destination-relative paths of a library, for the file systems and tools it is
+// copied to: Windows and exFAT limit the length of a path, and some sync tools and devices the number of
+// nested directories.
+type PathLimits struct {
+	// MaxLength is the largest number of characters of a path, 0 for no limit.
+	MaxLength int
+	// MaxDepth is the largest number of directories above a file, 0 for no limit.
+	MaxDepth int
+	// Shorten plans a shorter path for a file whose path exceeds the limits, instead of only reporting it.
+	Shorten bool
+}
+
+// minSegment is the number of characters Fit keeps of a directory or file name, so a shortened name
+// stays recognizable; dated directories such as 2024 or 06 are never shortened.
+const minSegment = 8
+
+// IsZero reports whether l limits nothing.
+func (l PathLimits) IsZero() bool {
+	return l.MaxLength <= 0 && l.MaxDepth <= 0
+}
+
+// String describes the limits, such as "at most 200 characters and 4 directories".
+func (l PathLimits) String() string {
+	var parts []string
+	if l.MaxLength > 0 {
+		parts = append(parts, fmt.Sprintf("%d characters", l.MaxLength))
+	}
+	if l.MaxDepth > 0 {
+		parts = append(parts, fmt.Sprintf("%d directories", l.MaxDepth))
+	}
+	if len(parts) == 0 {
+		return "no limits"
+	}
+	return "at most " + strings.Join(parts, " and ")
+}
+
+// Exceeds reports whether the destination-relative path rel is longer or deeper than the limits.
+func (l PathLimits) Exceeds(rel string) bool {
+	rel = filepath.Clean(rel)
+	if l.MaxLength > 0 && utf8.RuneCountInString(rel) > l.MaxLength {
+		return true
+	}
+	return l.MaxDepth > 0 && strings.Count(rel, string(filepath.Separator)) > l.MaxDepth
+}
+
+// Fit returns the destination-relative directory dir and the file name shortened to fit the limits.
+// The directories below MaxDepth are joined into one with "-", and then the longest directory or file
+// name is cut, one character at a time, until the path fits; the extension of the file is kept. A path
+// whose names cannot be cut further is returned as short as it gets, and may still exceed the limits.
+func (l PathLimits) Fit(dir, filename string) (string, string) {
+	var segs []string
+	for _, s := range strings.Split(filepath.Clean(dir), string(filepath.Separator)) {
+		if s != "" && s != "." {
+			segs = append(segs, s)
+		}
+	}
+	if l.MaxDepth > 0 && len(segs) > l.MaxDepth {
+		segs = append(segs[:l.MaxDepth-1], strings.Join(segs[l.MaxDepth-1:], "-"))
+	}
+
+	ext := filepath.Ext(filename)
+	names := make([][]rune, 0, len(segs)+1)
+	for _, s := range segs {
+		names = append(names, []rune(s))
+	}
+	names = append(names, []rune(strings.TrimSuffix(filename, ext)))
+	cut := make([]bool, len(names))
+
+	if l.MaxLength > 0 {
+		// The separators, one per directory, and the extension are not cut.
+		length := len(segs) + utf8.RuneCountInString(ext)
+		for _, n := range names {
+			length += len(n)
+		}
+		for length > l.MaxLength {
+			longest := -1
+			for i, n := range names {
+				if len(n) > minSegment && (longest < 0 || len(n) > len(names[longest])) {
+					longest = i
+				}
+			}
+			if longest < 0 {
+				break
+			}
+			names[longest] = names[longest][:len(names[longest])-1]
+			cut[longest] = true
+			length--
+		}
+	}
+
+	for i, n := range names {
+		if cut[i] {
+			// Windows does not allow a name ending in a space or a dot.
+			n = []rune(strings.TrimRight(string(n), " ."))
+		}
+		if i < len(segs) {
+			segs[i] = string(n)
+		} else {
+			filename = string(n) + ext
+		}
+	}
+	return filepath.Join(segs...), filename
+}
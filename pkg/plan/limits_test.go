@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathLimits_Exceeds(t *testing.T) {
+	l := PathLimits{MaxLength: 20, MaxDepth: 2}
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{filepath.Join("2024", "06", "IMG_1.jpg"), false},
+		{filepath.Join("2024", "06", "15", "IMG_1.jpg"), true},
+		{filepath.Join("2024", "IMG_20240615_123456.jpg"), true},
+		{filepath.Join("2024", "06", "Ünïcödé.jpg"), false},
+	}
+	for _, tt := range tests {
+		if got := l.Exceeds(tt.rel); got != tt.want {
+			t.Errorf("Exceeds(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+	if (PathLimits{}).Exceeds(filepath.Join("a", "b", "c", "d.jpg")) {
+		t.Error("expected the zero PathLimits to limit nothing")
+	}
+}
+
+func TestPathLimits_Fit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   PathLimits
+		dir      string
+		filename string
+		wantDir  string
+		wantName string
+	}{
+		{
+			name:     "deep directories are joined",
+			limits:   PathLimits{MaxDepth: 3},
+			dir:      filepath.Join("Albums", "Summer", "Beach", "2024", "06"),
+			filename: "IMG_1.jpg",
+			wantDir:  filepath.Join("Albums", "Summer", "Beach-2024-06"),
+			wantName: "IMG_1.jpg",
+		},
+		{
+			name:     "the longest names are cut",
+			limits:   PathLimits{MaxLength: 40},
+			dir:      filepath.Join("2024", "A very long album name"),
+			filename: "IMG_20240615_123456_holiday.jpg",
+			wantDir:  filepath.Join("2024", "A very long alb"),
+			wantName: "IMG_20240615_12.jpg",
+		},
+		{
+			name:     "cut names do not end in a space",
+			limits:   PathLimits{MaxLength: 14},
+			dir:      "Holiday in Rome",
+			filename: "a.jpg",
+			wantDir:  "Holiday",
+			wantName: "a.jpg",
+		},
+		{
+			name:     "dated directories are kept",
+			limits:   PathLimits{MaxLength: 10},
+			dir:      filepath.Join("2024", "06", "15"),
+			filename: "IMG_1.jpg",
+			wantDir:  filepath.Join("2024", "06", "15"),
+			wantName: "IMG_1.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, name := tt.limits.Fit(tt.dir, tt.filename)
+			if dir != tt.wantDir || name != tt.wantName {
+				t.Errorf("Fit = %q, %q, want %q, %q", dir, name, tt.wantDir, tt.wantName)
+			}
+		})
+	}
+}
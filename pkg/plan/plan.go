@@ -11,6 +11,36 @@ import (
 type Operation struct {
 	SourcePath      string
 	DestinationPath string
+
+	// Filename is the name of the file at the destination. Empty means the base name of SourcePath.
+	Filename string
+
+	// Content, when non-nil, is written to DestinationPath instead of copying SourcePath.
+	// It is used for generated sidecars, which have no SourcePath.
+	Content []byte
+
+	// Transform, when set, rewrites the content of SourcePath before it is written to DestinationPath.
+	Transform func([]byte) ([]byte, error)
+
+	// Sidecars are companion files that travel with the source.
+	Sidecars []Operation
+
+	// CreatedAt, when set, becomes the modification and creation time of the file written to a local
+	// DestinationPath.
+	CreatedAt time.Time
+
+	// SourceSize and SourceModTime are the size and modification time SourcePath was planned with.
+	// When SourceModTime is set, the source is not copied if either changed since.
+	SourceSize    int64
+	SourceModTime time.Time
+
+	// SourceSHA256, when set, is the hex-encoded SHA-256 SourcePath was planned with, such as in a plan
+	// file. The source is read before it is copied, and not copied if its content differs.
+	SourceSHA256 string
+
+	// PairedWith is the source of the other file of a RAW+JPEG pair (pkg/rawpair). Reconcile gives
+	// both files the same collision suffix.
+	PairedWith string
 }
 
 // Destination computes the destination path for a file based on its creation date.
@@ -19,13 +49,7 @@ type Operation struct {
 // If a file with that name already exists in the existingFiles map,
 // a suffix _N is appended before the extension, where N starts at 1.
 func Destination(destRoot string, filename string, createdAt time.Time, existingFiles map[string]bool) string {
-	year := fmt.Sprintf("%04d", createdAt.Year())
-	month := fmt.Sprintf("%02d", createdAt.Month())
-	day := fmt.Sprintf("%02d", createdAt.Day())
-
-	dir := filepath.Join(destRoot, year, month, day)
-
-	return resolveCollision(dir, filename, existingFiles)
+	return DestinationLayout(destRoot, filename, createdAt, Layout{}, nil, existingFiles)
 }
 
 // resolveCollision returns a unique destination path by appending _N before the extension if needed.
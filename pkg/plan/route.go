@@ -0,0 +1,129 @@
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route sends the dated files whose field matches a condition to a layout of their own, such as the
+// photos rated 4 stars or more to Best/{year}.
+type Route struct {
+	// Field is the field token the condition tests, such as TokenRating.
+	Field string
+	// Op is one of =, !=, <, <=, > and >=, or empty to test that the field is set.
+	Op string
+	// Value is compared with the field: as numbers for <, <=, > and >=, and ignoring case otherwise.
+	// A number may be a duration such as 3s or 1m30s, compared in seconds.
+	Value string
+
+	Layout Layout
+}
+
+// routeOps lists the operators of a route condition, longest first so "<=" is not read as "<".
+var routeOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// ParseRoute parses a route, CONDITION:LAYOUT. The condition is a field token, optionally followed by
+// an operator and a value: "rating>=4:Best/{year}", "favorite:Favorites/{year}",
+// "keyword=scan:Scans/{year}" or "duration<3s:Clips/{year}".
+func ParseRoute(s string) (Route, error) {
+	condition, template, ok := strings.Cut(s, ":")
+	if !ok {
+		return Route{}, fmt.Errorf("invalid route %q (want CONDITION:LAYOUT, e.g. rating>=4:Best/{year})", s)
+	}
+	var r Route
+	r.Field = strings.TrimSpace(condition)
+	for _, op := range routeOps {
+		if field, value, found := strings.Cut(condition, op); found {
+			r.Field, r.Op, r.Value = strings.TrimSpace(field), op, strings.TrimSpace(value)
+			break
+		}
+	}
+	if !fieldTokens[r.Field] {
+		return Route{}, fmt.Errorf("route %q tests unknown field %q", s, r.Field)
+	}
+	switch r.Op {
+	case "<", "<=", ">", ">=":
+		if _, ok := routeNumber(r.Value); !ok {
+			return Route{}, fmt.Errorf("route %q compares %s with %q, which is not a number", s, r.Field, r.Value)
+		}
+	}
+	layout, err := ParseLayout(strings.TrimSpace(template))
+	if err != nil {
+		return Route{}, fmt.Errorf("route %q: %w", s, err)
+	}
+	r.Layout = layout
+	return r, nil
+}
+
+// Matches reports whether the fields of a file meet the condition of the route. A field that is not
+// set meets only the != condition. = and != test every keyword of TokenKeyword: "keyword=scan" matches
+// a file with the keyword scan among others, "keyword!=scan" a file without it.
+func (r Route) Matches(fields Fields) bool {
+	v := fields[r.Field]
+	switch r.Op {
+	case "":
+		return v != ""
+	case "=":
+		return r.hasValue(fields)
+	case "!=":
+		return !r.hasValue(fields)
+	}
+	n, ok := routeNumber(v)
+	if !ok {
+		return false
+	}
+	want, _ := routeNumber(r.Value)
+	switch r.Op {
+	case "<":
+		return n < want
+	case "<=":
+		return n <= want
+	case ">":
+		return n > want
+	default:
+		return n >= want
+	}
+}
+
+// routeNumber parses a number of a condition or a field: a decimal number, or a duration such as 3s in seconds.
+func routeNumber(s string) (float64, bool) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), true
+	}
+	return 0, false
+}
+
+// hasValue reports whether one of the values of the field is the value of the condition.
+func (r Route) hasValue(fields Fields) bool {
+	for _, v := range fields.Values(r.Field) {
+		if strings.EqualFold(v, r.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the route in the form ParseRoute reads.
+func (r Route) String() string {
+	return r.Field + r.Op + r.Value + ":" + r.Layout.String()
+}
+
+// Uses reports whether the route tests token or its layout references it.
+func (r Route) Uses(token string) bool {
+	return r.Field == token || r.Layout.Uses(token)
+}
+
+// RouteLayout returns the layout of the first of routes the fields match, or layout when none does.
+func RouteLayout(routes []Route, layout Layout, fields Fields) Layout {
+	for _, r := range routes {
+		if r.Matches(fields) {
+			return r.Layout
+		}
+	}
+	return layout
+}
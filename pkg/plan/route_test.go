@@ -0,0 +1,78 @@
+package plan
+
+import (
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	r, err := ParseRoute("rating >= 4:Best/{year}")
+	if err != nil {
+		t.Fatalf("ParseRoute: %v", err)
+	}
+	if r.Field != TokenRating || r.Op != ">=" || r.Value != "4" || r.Layout.String() != "Best/{year}" {
+		t.Errorf("got %+v", r)
+	}
+	if got := r.String(); got != "rating>=4:Best/{year}" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, s := range []string{"rating>=4", "year>=2020:Old/{year}", "rating>=many:Best", "duration<3 weeks:Clips", "favorite:{yeer}", ":Best"} {
+		if _, err := ParseRoute(s); err == nil {
+			t.Errorf("ParseRoute(%q): expected an error", s)
+		}
+	}
+}
+
+func TestRoute_Matches(t *testing.T) {
+	tests := []struct {
+		route  string
+		fields Fields
+		want   bool
+	}{
+		{"rating>=4:Best", Fields{TokenRating: "5"}, true},
+		{"rating>=4:Best", Fields{TokenRating: "3"}, false},
+		{"rating>=4:Best", nil, false},
+		{"rating<2:Rejects", Fields{TokenRating: "1"}, true},
+		{"favorite:Favorites", Fields{TokenFavorite: FavoriteValue}, true},
+		{"favorite:Favorites", nil, false},
+		{"camera=canon eos r5:Canon", Fields{TokenCamera: "Canon EOS R5"}, true},
+		{"camera!=Canon EOS R5:Other", nil, true},
+		{"camera!=Canon EOS R5:Other", Fields{TokenCamera: "Canon EOS R5"}, false},
+		{"keyword=Scan:Scans", Fields{TokenKeyword: "family" + KeywordSeparator + "scan"}, true},
+		{"keyword=scan:Scans", Fields{TokenKeyword: "scanned"}, false},
+		{"keyword!=scan:Other", Fields{TokenKeyword: "family" + KeywordSeparator + "scan"}, false},
+		{"keyword!=scan:Other", Fields{TokenKeyword: "family"}, true},
+		{"duration<3s:Clips", Fields{TokenDuration: "2.5"}, true},
+		{"duration<3:Clips", Fields{TokenDuration: "3.2"}, false},
+		{"duration>=1m:Long", Fields{TokenDuration: "75"}, true},
+		{"duration<3s:Clips", nil, false},
+	}
+	for _, tc := range tests {
+		r, err := ParseRoute(tc.route)
+		if err != nil {
+			t.Fatalf("ParseRoute(%q): %v", tc.route, err)
+		}
+		if got := r.Matches(tc.fields); got != tc.want {
+			t.Errorf("%s matches %v = %v, want %v", tc.route, tc.fields, got, tc.want)
+		}
+	}
+}
+
+func TestRouteLayout(t *testing.T) {
+	best, err := ParseRoute("rating>=4:Best/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	favorites, err := ParseRoute("favorite:Favorites/{year}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := []Route{best, favorites}
+	def := Layout{}
+	if got := RouteLayout(routes, def, Fields{TokenRating: "5", TokenFavorite: FavoriteValue}); got.String() != "Best/{year}" {
+		t.Errorf("expected the first matching route, got %q", got)
+	}
+	if got := RouteLayout(routes, def, Fields{TokenRating: "2"}); !got.IsZero() {
+		t.Errorf("expected the default layout, got %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Package profile describes export profiles: the directory layout and sidecar conventions a photo
+// server expects from a tree it bulk-imports, so an organized library can be ingested directly.
+//
+// Both Immich and PhotoPrism read XMP sidecars next to the media file. A profile renames existing
+// XMP sidecars to the server's naming and generates one for files that have none, carrying what the
+// server cannot read from the file itself: the created_at of the run, the rating and the album.
+package profile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+// Profile names an export profile.
+type Profile string
+
+const (
+	// None keeps the regular layout and sidecars.
+	None Profile = ""
+	// Immich follows the default Immich storage template and names sidecars IMG_1234.jpg.xmp.
+	Immich Profile = "immich"
+	// PhotoPrism follows the PhotoPrism originals layout and names sidecars IMG_1234.xmp.
+	PhotoPrism Profile = "photoprism"
+)
+
+// Parse converts a CLI value into a Profile. "none" and the empty string are None.
+func Parse(s string) (Profile, error) {
+	switch p := Profile(strings.ToLower(strings.TrimSpace(s))); p {
+	case None, "none":
+		return None, nil
+	case Immich, PhotoPrism:
+		return p, nil
+	default:
+		return None, fmt.Errorf("invalid profile %q (want none, immich or photoprism)", s)
+	}
+}
+
+// Layout returns the directory layout of the profile. None has the zero Layout.
+func (p Profile) Layout() plan.Layout {
+	var template string
+	switch p {
+	case Immich:
+		// Immich's default storage template: {{y}}/{{y}}-{{MM}}-{{dd}}.
+		template = "{year}/{year}-{month}-{day}"
+	case PhotoPrism:
+		// PhotoPrism's originals folder layout: 2006/01.
+		template = "{year}/{month}"
+	default:
+		return plan.Layout{}
+	}
+	l, err := plan.ParseLayout(template)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// SidecarPath returns where the XMP sidecar of a media file placed at mediaDst goes.
+func (p Profile) SidecarPath(mediaDst string) string {
+	if p == PhotoPrism {
+		return strings.TrimSuffix(mediaDst, filepath.Ext(mediaDst)) + ".xmp"
+	}
+	return mediaDst + ".xmp"
+}
+
+// IsXMP reports whether path is an XMP sidecar.
+func IsXMP(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xmp")
+}
+
+// XMP returns an XMP sidecar recording createdAt (skipped when zero) and the rating and album of fields.
+// It returns nil when there is nothing to record.
+func XMP(createdAt time.Time, fields plan.Fields) []byte {
+	rating := fields[plan.TokenRating]
+	album := fields[plan.TokenAlbum]
+	if createdAt.IsZero() && rating == "" && album == "" {
+		return nil
+	}
+
+	var attrs, elems bytes.Buffer
+	attr := func(name, value string) {
+		fmt.Fprintf(&attrs, "\n    %s=\"", name)
+		_ = xml.EscapeText(&attrs, []byte(value))
+		attrs.WriteString(`"`)
+	}
+	if !createdAt.IsZero() {
+		ts := createdAt.Format("2006-01-02T15:04:05-07:00")
+		attr("exif:DateTimeOriginal", ts)
+		attr("photoshop:DateCreated", ts)
+		attr("xmp:CreateDate", ts)
+	}
+	if rating != "" {
+		attr("xmp:Rating", rating)
+	}
+	if album != "" {
+		// Both servers turn dc:subject keywords into tags, which is how an album survives the import.
+		elems.WriteString("\n   <dc:subject>\n    <rdf:Bag>\n     <rdf:li>")
+		_ = xml.EscapeText(&elems, []byte(album))
+		elems.WriteString("</rdf:li>\n    </rdf:Bag>\n   </dc:subject>\n  ")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"`)
+	b.Write(attrs.Bytes())
+	if elems.Len() == 0 {
+		b.WriteString("/>\n")
+	} else {
+		b.WriteString(">")
+		b.Write(elems.Bytes())
+		b.WriteString("</rdf:Description>\n")
+	}
+	b.WriteString(" </rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>` + "\n")
+	return b.Bytes()
+}
@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]Profile{"": None, "none": None, "Immich": Immich, " photoprism ": PhotoPrism} {
+		got, err := Parse(in)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := Parse("flickr"); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+}
+
+func TestLayoutAndSidecarPath(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	media := filepath.Join("lib", "IMG_1.jpg")
+
+	for _, tt := range []struct {
+		p       Profile
+		dir     string
+		sidecar string
+	}{
+		{Immich, filepath.Join("2024", "2024-01-02"), filepath.Join("lib", "IMG_1.jpg.xmp")},
+		{PhotoPrism, filepath.Join("2024", "01"), filepath.Join("lib", "IMG_1.xmp")},
+		{None, filepath.Join("2024", "01", "02"), filepath.Join("lib", "IMG_1.jpg.xmp")},
+	} {
+		if got := tt.p.Layout().Dir(createdAt, nil); got != tt.dir {
+			t.Errorf("%q: layout dir %s, want %s", tt.p, got, tt.dir)
+		}
+		if got := tt.p.SidecarPath(media); got != tt.sidecar {
+			t.Errorf("%q: sidecar %s, want %s", tt.p, got, tt.sidecar)
+		}
+	}
+}
+
+func TestXMP(t *testing.T) {
+	if got := XMP(time.Time{}, nil); got != nil {
+		t.Errorf("expected no sidecar without data, got %s", got)
+	}
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))
+	data := XMP(createdAt, plan.Fields{plan.TokenRating: "4", plan.TokenAlbum: "Rome & Back"})
+
+	var doc struct {
+		Description struct {
+			DateTimeOriginal string   `xml:"DateTimeOriginal,attr"`
+			Rating           string   `xml:"Rating,attr"`
+			Subject          []string `xml:"subject>Bag>li"`
+		} `xml:"RDF>Description"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid XMP: %v\n%s", err, data)
+	}
+	d := doc.Description
+	if d.DateTimeOriginal != "2024-01-02T03:04:05+01:00" || d.Rating != "4" || len(d.Subject) != 1 || d.Subject[0] != "Rome & Back" {
+		t.Errorf("unexpected XMP content: %+v", d)
+	}
+	if !strings.HasPrefix(string(data), "<?xpacket begin=") {
+		t.Errorf("missing xpacket header")
+	}
+}
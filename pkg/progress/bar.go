@@ -0,0 +1,179 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BarReporter draws the progress of the running stage on a terminal as one line, redrawn in place: a
+// bar, the files done, the bytes copied, the estimated time left, the rate and the current file. Lines
+// are cut to Width, losing the rate before the estimate. A finished stage keeps its line, with the
+// time it took.
+//
+// Like JSONReporter, it redraws a stage at most once per Interval; the first and the final event of a
+// stage are always drawn.
+type BarReporter struct {
+	Interval time.Duration
+
+	// Width is the most characters a line takes, so it never wraps on a terminal that wide.
+	Width int
+
+	mu      sync.Mutex
+	w       io.Writer
+	stage   string
+	started time.Time
+	last    time.Time
+	// open reports a line of the stage on the terminal without its newline.
+	open bool
+}
+
+// DefaultBarWidth is the width of a BarReporter line unless set otherwise, such as to the width of
+// the terminal.
+const DefaultBarWidth = 80
+
+// barLength is the number of characters of the bar itself.
+const barLength = 12
+
+// NewBarReporter returns a BarReporter drawing on w.
+func NewBarReporter(w io.Writer, interval time.Duration) *BarReporter {
+	return &BarReporter{Interval: interval, Width: DefaultBarWidth, w: w}
+}
+
+// Report implements Reporter.
+func (r *BarReporter) Report(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.Stage != r.stage {
+		r.end()
+		r.stage, r.started, r.last = e.Stage, e.Time, time.Time{}
+	}
+	finished := e.Finished()
+	if r.open && !finished && e.Time.Sub(r.last) < r.Interval {
+		return
+	}
+	r.last = e.Time
+	fmt.Fprintf(r.w, "\r%s\x1b[K", r.line(e, finished))
+	r.open = true
+	if finished {
+		r.end()
+		r.stage = ""
+	}
+}
+
+// Finish ends the line of a stage that did not finish, such as when the run was canceled, so the
+// output that follows starts on a line of its own.
+func (r *BarReporter) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.end()
+	r.stage = ""
+}
+
+func (r *BarReporter) end() {
+	if r.open {
+		fmt.Fprintln(r.w)
+		r.open = false
+	}
+}
+
+// line returns the line of e, which is the last event of its stage when finished.
+func (r *BarReporter) line(e Event, finished bool) string {
+	elapsed := e.Time.Sub(r.started)
+	parts := []string{fmt.Sprintf("%-9s", e.Stage)}
+	if e.Total == 0 && !finished {
+		// Still finding the files: how many there are is not known yet.
+		parts = append(parts, fmt.Sprintf("%d files", e.Done))
+		if e.TotalBytes > 0 {
+			parts = append(parts, FormatBytes(e.TotalBytes))
+		}
+	} else {
+		parts = append(parts, bar(e.Done, e.Total), fmt.Sprintf("%d/%d files", e.Done, e.Total))
+		if e.Bytes > 0 && e.TotalBytes > 0 {
+			parts = append(parts, FormatBytes(e.Bytes)+"/"+FormatBytes(e.TotalBytes))
+		} else if e.TotalBytes > 0 && finished {
+			parts = append(parts, FormatBytes(e.TotalBytes))
+		}
+	}
+	switch {
+	case finished:
+		parts = append(parts, "in "+formatDuration(elapsed))
+	case e.Total > 0:
+		if eta, ok := estimate(e, elapsed); ok {
+			parts = append(parts, "ETA "+formatDuration(eta))
+		}
+	}
+	if secs := elapsed.Seconds(); secs > 0 && e.Done > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f files/s", float64(e.Done)/secs))
+		if e.Bytes > 0 {
+			parts = append(parts, FormatBytes(int64(float64(e.Bytes)/secs))+"/s")
+		}
+	}
+	if e.Current != "" && !finished && e.Total > 0 {
+		parts = append(parts, filepath.Base(e.Current))
+	}
+	return truncate(strings.Join(parts, "  "), r.Width)
+}
+
+// estimate returns the time the stage of e still needs at the rate of the elapsed time so far: by the
+// bytes done when the stage counts them, else by the files.
+func estimate(e Event, elapsed time.Duration) (time.Duration, bool) {
+	done, total := float64(e.Done), float64(e.Total)
+	if e.Bytes > 0 && e.TotalBytes > 0 {
+		done, total = float64(e.Bytes), float64(e.TotalBytes)
+	}
+	if done <= 0 || elapsed <= 0 || done > total {
+		return 0, false
+	}
+	return time.Duration(float64(elapsed) * (total - done) / done), true
+}
+
+// bar returns the bar and percentage of done out of total.
+func bar(done, total int) string {
+	fraction := 1.0
+	if total > 0 {
+		fraction = min(float64(done)/float64(total), 1)
+	}
+	filled := int(fraction * barLength)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat("-", barLength-filled), fraction*100)
+}
+
+// FormatBytes formats n with a binary unit, such as "1.5 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration formats d in whole seconds, such as "2m05s".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+// truncate shortens s to at most width runes; width 0 leaves it as it is.
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 1 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
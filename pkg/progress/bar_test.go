@@ -0,0 +1,83 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBarReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewBarReporter(&buf, time.Second)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Scanning: the total is not known yet.
+	r.Report(Event{Stage: StageScan, Done: 1, TotalBytes: 100, Time: at(0)})
+	r.Report(Event{Stage: StageScan, Done: 4, Total: 4, TotalBytes: 400, Time: at(2 * time.Second)})
+	// Copying: throttled to one line per second, always drawing the first and the final event.
+	r.Report(Event{Stage: StageCopy, Total: 4, TotalBytes: 400 << 20, Time: at(2 * time.Second)})
+	r.Report(Event{Stage: StageCopy, Done: 1, Total: 4, Bytes: 100 << 20, TotalBytes: 400 << 20, Current: "/card/DCIM/IMG_0001.MOV", Time: at(4 * time.Second)})
+	r.Report(Event{Stage: StageCopy, Done: 2, Total: 4, Bytes: 200 << 20, TotalBytes: 400 << 20, Time: at(4*time.Second + time.Millisecond)})
+	r.Report(Event{Stage: StageCopy, Done: 4, Total: 4, Bytes: 400 << 20, TotalBytes: 400 << 20, Time: at(10 * time.Second)})
+
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("expected a finished line per stage, got %q", buf.String())
+	}
+	scan := strings.Split(lines[0], "\r")
+	if !strings.Contains(scan[1], "1 files") || !strings.Contains(scan[2], "[############] 100%  4/4 files  400 B") ||
+		!strings.Contains(scan[2], "in 2s") {
+		t.Errorf("unexpected scan line %q", lines[0])
+	}
+	copied := strings.Split(lines[1], "\r")
+	if len(copied) != 4 {
+		t.Fatalf("expected 3 copy draws, got %q", lines[1])
+	}
+	// A quarter of the bytes in 2s leaves 6s; the line is cut to the width of the terminal.
+	line := strings.TrimSuffix(copied[2], "\x1b[K")
+	if !strings.HasPrefix(line, "copy       [###---------]  25%  1/4 files  100.0 MiB/400.0 MiB  ETA 6s  0.5 fil") ||
+		len([]rune(line)) != DefaultBarWidth {
+		t.Errorf("unexpected copy line %q", copied[2])
+	}
+	if !strings.Contains(copied[3], "4/4 files") || !strings.Contains(copied[3], "in 8s") {
+		t.Errorf("unexpected final copy line %q", copied[3])
+	}
+}
+
+func TestBarReporter_Rates(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewBarReporter(&buf, time.Second)
+	r.Width = 0
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.Report(Event{Stage: StageCopy, Total: 4, TotalBytes: 400 << 20, Time: start})
+	r.Report(Event{Stage: StageCopy, Done: 1, Total: 4, Bytes: 100 << 20, TotalBytes: 400 << 20, Current: "/card/DCIM/IMG_0001.MOV", Time: start.Add(4 * time.Second)})
+	if !strings.HasSuffix(buf.String(), "ETA 12s  0.2 files/s  25.0 MiB/s  IMG_0001.MOV\x1b[K") {
+		t.Errorf("unexpected copy line %q", buf.String())
+	}
+}
+
+func TestBarReporter_FinishEndsUnfinishedLine(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewBarReporter(&buf, time.Second)
+	r.Report(Event{Stage: StageCopy, Done: 1, Total: 4, Time: time.Now()})
+	r.Finish()
+	r.Finish()
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Errorf("expected one newline, got %q", buf.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:     "512 B",
+		2048:    "2.0 KiB",
+		5 << 30: "5.0 GiB",
+	}
+	for in, want := range tests {
+		if got := FormatBytes(in); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
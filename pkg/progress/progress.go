@@ -0,0 +1,121 @@
+// Package progress reports pipeline progress to frontends that render it themselves.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage names used in progress events.
+const (
+	StageScan      = "scan"
+	StageAttribute = "attribute"
+	StageDedupe    = "dedupe"
+	StagePlan      = "plan"
+	StageReconcile = "reconcile"
+	StageCopy      = "copy"
+)
+
+// Event is a snapshot of a stage's progress.
+type Event struct {
+	Stage string `json:"stage"`
+	Done  int    `json:"done"`
+
+	// Total is zero while it is not known yet, such as while the files of a source are still being
+	// found. A stage with nothing to do reports Done and Total both zero.
+	Total int `json:"total"`
+
+	// Bytes and TotalBytes track data volume for stages that read or write file content.
+	Bytes      int64 `json:"bytes,omitempty"`
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+
+	// Current is the file being processed, if any.
+	Current string `json:"current,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// Finished reports whether e is the last event of its stage.
+func (e Event) Finished() bool {
+	return e.Done >= e.Total && (e.Total > 0 || e.Done == 0)
+}
+
+// Reporter receives progress events. Implementations must be safe for concurrent use.
+type Reporter interface {
+	Report(Event)
+}
+
+// Mode selects how progress is rendered by the CLI.
+type Mode string
+
+const (
+	// ModeNone disables progress output.
+	ModeNone Mode = "none"
+	// ModeJSON writes NDJSON events.
+	ModeJSON Mode = "json"
+	// ModeBar draws a progress bar (BarReporter).
+	ModeBar Mode = "bar"
+	// ModeAuto draws a progress bar when the output is a terminal, and nothing otherwise.
+	ModeAuto Mode = "auto"
+)
+
+// ParseMode converts a CLI value into a Mode.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ModeNone, ModeJSON, ModeBar, ModeAuto:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid progress mode %q (want auto, bar, json or none)", s)
+	}
+}
+
+// Report sends e to r if r is not nil, filling in the event time.
+func Report(r Reporter, e Event) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.Report(e)
+}
+
+// JSONReporter writes events as newline-delimited JSON.
+//
+// To keep output periodic, events are throttled per stage to at most one per Interval;
+// the first and the final (Event.Finished) event of a stage are always written.
+type JSONReporter struct {
+	Interval time.Duration
+
+	mu   sync.Mutex
+	w    io.Writer
+	enc  *json.Encoder
+	last map[string]time.Time
+}
+
+// NewJSONReporter returns a JSONReporter writing to w.
+func NewJSONReporter(w io.Writer, interval time.Duration) *JSONReporter {
+	return &JSONReporter{
+		Interval: interval,
+		w:        w,
+		enc:      json.NewEncoder(w),
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Report implements Reporter.
+func (r *JSONReporter) Report(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, seen := r.last[e.Stage]
+	if seen && !e.Finished() && e.Time.Sub(last) < r.Interval {
+		return
+	}
+	r.last[e.Stage] = e.Time
+	_ = r.enc.Encode(e)
+}
@@ -0,0 +1,45 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONReporter_ThrottlesButKeepsFirstAndFinal(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONReporter(&buf, time.Hour)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 10; i++ {
+		r.Report(Event{Stage: StageCopy, Done: i, Total: 10, Time: start.Add(time.Duration(i) * time.Millisecond)})
+	}
+	r.Report(Event{Stage: StageScan, Done: 3, Total: 3, Time: start})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 events, got %d: %q", len(lines), buf.String())
+	}
+
+	var first, final Event
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &final); err != nil {
+		t.Fatal(err)
+	}
+	if first.Done != 1 || final.Done != 10 || final.Stage != StageCopy {
+		t.Fatalf("unexpected events: %+v %+v", first, final)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if m, err := ParseMode("JSON"); err != nil || m != ModeJSON {
+		t.Fatalf("ParseMode(JSON) = %q, %v", m, err)
+	}
+	if _, err := ParseMode("xml"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,109 @@
+// Package rating reads the star rating photo applications record in a file: the xmp:Rating of its XMP
+// metadata (Lightroom, Bridge, digiKam, darktable) or the EXIF Rating tag Windows writes.
+//
+// Ratings run from 1 to 5 stars. Unrated files, and files rejected with a rating of -1, have none.
+package rating
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	"github.com/quidome/media-organizer-go/pkg/jpegseg"
+)
+
+// xmpRating matches the rating of an XMP packet, as an attribute or as an element.
+var xmpRating = regexp.MustCompile(`xmp:Rating(?:="|>)\s*(-?\d+)`)
+
+// FromXMP returns the rating in the XMP data, such as an .xmp sidecar, and whether it has one.
+func FromXMP(data []byte) (int, bool) {
+	m := xmpRating.FindSubmatch(data)
+	if m == nil {
+		return 0, false
+	}
+	return valid(string(m[1]))
+}
+
+// IsCandidate reports whether the file name is a JPEG, the only format whose embedded rating is read.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// FromJPEG returns the rating embedded in the JPEG read from r, and whether it has one. The XMP
+// rating wins over the EXIF one. Only the metadata segments before the image data are read.
+func FromJPEG(r io.Reader) (int, bool, error) {
+	segs, err := jpegseg.NewReader(r)
+	if err != nil {
+		return 0, false, nil
+	}
+	var exifSegment []byte
+	for {
+		seg, err := segs.Next()
+		if err == io.EOF || errors.Is(err, jpegseg.ErrMalformed) {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		if seg.Marker != jpegseg.APP1 {
+			continue
+		}
+		segment, err := segs.Payload()
+		if err != nil {
+			return 0, false, err
+		}
+		if bytes.HasPrefix(segment, jpegseg.XMPNamespace) {
+			if n, ok := FromXMP(segment); ok {
+				return n, true, nil
+			}
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) && exifSegment == nil {
+			exifSegment = segment[6:]
+		}
+	}
+	if exifSegment == nil {
+		return 0, false, nil
+	}
+	n, ok := fromEXIF(exifSegment)
+	return n, ok, nil
+}
+
+// exifRating is the Rating tag Windows writes in IFD0, which goexif does not load.
+const exifRating exif.FieldName = "Rating"
+
+// fromEXIF returns the Rating tag of the TIFF data of an EXIF segment.
+func fromEXIF(tiff []byte) (int, bool) {
+	x, err := exif.Decode(bytes.NewReader(tiff))
+	if err != nil || len(x.Tiff.Dirs) == 0 {
+		return 0, false
+	}
+	x.LoadTags(x.Tiff.Dirs[0], map[uint16]exif.FieldName{0x4746: exifRating}, false)
+	tag, err := x.Get(exifRating)
+	if err != nil {
+		return 0, false
+	}
+	n, err := tag.Int(0)
+	if err != nil {
+		return 0, false
+	}
+	return valid(strconv.Itoa(n))
+}
+
+// valid returns the rating s when it is 1 to 5 stars.
+func valid(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 5 {
+		return 0, false
+	}
+	return n, true
+}
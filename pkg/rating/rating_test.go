@@ -0,0 +1,51 @@
+package rating
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+func TestFromXMP(t *testing.T) {
+	tests := []struct {
+		xmp    string
+		want   int
+		wantOK bool
+	}{
+		{`<rdf:Description xmp:Rating="4"/>`, 4, true},
+		{`<xmp:Rating>5</xmp:Rating>`, 5, true},
+		{`<rdf:Description xmp:Rating="-1"/>`, 0, false},
+		{`<rdf:Description xmp:Rating="0"/>`, 0, false},
+		{`<rdf:Description xmp:Label="Red"/>`, 0, false},
+	}
+	for _, tc := range tests {
+		got, ok := FromXMP([]byte(tc.xmp))
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("FromXMP(%s) = %d, %v; want %d, %v", tc.xmp, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestFromJPEG(t *testing.T) {
+	xmp := testjpeg.Segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<rdf:Description xmp:Rating=\"2\"/>"))
+	exif := testjpeg.EXIF([]testjpeg.Entry{testjpeg.Short(0x4746, 3)}, nil, nil)
+	tests := map[string]struct {
+		data   []byte
+		want   int
+		wantOK bool
+	}{
+		"xmp":          {testjpeg.JPEG(xmp), 2, true},
+		"exif":         {testjpeg.JPEG(exif), 3, true},
+		"xmp wins":     {testjpeg.JPEG(exif, xmp), 2, true},
+		"unrated":      {testjpeg.JPEG(testjpeg.Segment(0xE0, []byte("JFIF\x00"))), 0, false},
+		"exif unrated": {testjpeg.WithEXIF([]testjpeg.Entry{testjpeg.Short(0x4746, 0)}, nil, nil), 0, false},
+		"not a jpeg":   {[]byte("not a jpeg"), 0, false},
+	}
+	for name, tc := range tests {
+		got, ok, err := FromJPEG(bytes.NewReader(tc.data))
+		if err != nil || got != tc.want || ok != tc.wantOK {
+			t.Errorf("%s: got %d, %v, %v; want %d, %v", name, got, ok, err, tc.want, tc.wantOK)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package rawpair pairs the RAW file and the JPEG a camera writes of one shot, such as IMG_1234.CR2 and
+// IMG_1234.JPG, so they can be organized side by side under the same name.
+package rawpair
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/scan"
+)
+
+// Pair is the RAW file and the JPEG of one shot.
+type Pair struct {
+	RAW  string
+	JPEG string
+}
+
+// IsRAW reports whether path has the extension of a camera RAW format (scan.RawExtensions).
+func IsRAW(path string) bool {
+	return slices.Contains(scan.RawExtensions(), strings.ToLower(filepath.Ext(path)))
+}
+
+// IsJPEG reports whether path has the extension of a JPEG.
+func IsJPEG(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// Find pairs the RAW files among paths with the JPEG in the same directory whose stem (the name without
+// extension) is theirs. A stem with more than one RAW file or more than one JPEG, such as IMG_1234.CR2
+// and IMG_1234.DNG, is not paired. Pairs are returned in the order of their RAW file in paths. Paths
+// use the separator of the OS; stems are compared case-insensitively.
+func Find(paths []string) []Pair {
+	type shot struct {
+		raws, jpegs []string
+	}
+	shots := make(map[string]*shot)
+	var order []string
+	for _, p := range paths {
+		raw, jpeg := IsRAW(p), IsJPEG(p)
+		if !raw && !jpeg {
+			continue
+		}
+		name := filepath.Base(p)
+		key := filepath.Join(filepath.Dir(p), strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))))
+		s, ok := shots[key]
+		if !ok {
+			s = &shot{}
+			shots[key] = s
+		}
+		if raw {
+			s.raws = append(s.raws, p)
+			order = append(order, key)
+		} else {
+			s.jpegs = append(s.jpegs, p)
+		}
+	}
+
+	var pairs []Pair
+	for _, key := range order {
+		if s := shots[key]; len(s.raws) == 1 && len(s.jpegs) == 1 {
+			pairs = append(pairs, Pair{RAW: s.raws[0], JPEG: s.jpegs[0]})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,44 @@
+package rawpair
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	p := func(elem ...string) string {
+		return filepath.Join(append([]string{string(filepath.Separator), "card"}, elem...)...)
+	}
+	paths := []string{
+		p("IMG_0001.JPG"),
+		p("IMG_0001.CR2"),
+		p("IMG_0002.nef"),
+		p("img_0002.jpeg"),
+		// Another directory.
+		p("b", "IMG_0001.CR2"),
+		// A RAW without JPEG and a JPEG without RAW.
+		p("IMG_0003.ARW"),
+		p("IMG_0004.JPG"),
+		// Two RAW files of one stem are ambiguous.
+		p("IMG_0005.CR2"),
+		p("IMG_0005.DNG"),
+		p("IMG_0005.JPG"),
+		p("IMG_0006.mp4"),
+	}
+	want := []Pair{
+		{RAW: p("IMG_0001.CR2"), JPEG: p("IMG_0001.JPG")},
+		{RAW: p("IMG_0002.nef"), JPEG: p("img_0002.jpeg")},
+	}
+	if got := Find(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %+v, want %+v", got, want)
+	}
+}
+
+func TestIsRAW(t *testing.T) {
+	for path, want := range map[string]bool{"a.CR3": true, "a.dng": true, "a.jpg": false, "a.xmp": false} {
+		if got := IsRAW(path); got != want {
+			t.Errorf("IsRAW(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
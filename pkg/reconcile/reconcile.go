@@ -1,22 +1,36 @@
 package reconcile
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/quidome/media-organizer-go/internal/ctxio"
+	"github.com/quidome/media-organizer-go/pkg/bloom"
 	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
 	"github.com/quidome/media-organizer-go/pkg/plan"
 )
 
 const headerBytes = 64 * 1024
 
+// bloomFalsePositives is the false positive rate of the bloom filters ruling out unique files.
+const bloomFalsePositives = 0.01
+
 // Action describes what should happen for a source.
 type Action string
 
@@ -28,6 +42,17 @@ const (
 	ActionSkippedIdentical    Action = "skipped_identical"
 	ActionSkippedDuplicateSrc Action = "skipped_duplicate_source"
 	ActionFailed              Action = "failed"
+
+	// ActionSkippedImported marks a source whose content a catalog records as imported before.
+	// FinalDestinationPath is where it was imported to, which may since have been renamed.
+	ActionSkippedImported Action = "skipped_imported"
+
+	// ActionSkippedVersion marks an original skipped in favor of its edit, or an edit skipped in favor of
+	// its original. DuplicateOf is the version that is kept.
+	ActionSkippedVersion Action = "skipped_version"
+
+	// ActionSkippedBurst marks a shot of a burst skipped in favor of its best shot, which DuplicateOf names.
+	ActionSkippedBurst Action = "skipped_burst"
 )
 
 // Decision describes what should happen for a given source file.
@@ -40,6 +65,9 @@ type Decision struct {
 
 	DuplicateOf string
 	Error       error
+
+	// Sidecars are the companion files planned to travel with the source.
+	Sidecars []plan.Operation
 }
 
 // DedupeSources groups source files by exact content and chooses a single canonical file
@@ -47,30 +75,50 @@ type Decision struct {
 //
 // If multiple sources are identical, it keeps the oldest (earliest) Best.CreatedAt timestamp.
 // When timestamps tie (or are zero), it uses lexicographic SourcePath ordering.
-func DedupeSources(sources []string, details map[string]createdat.DetailedResult, sizes map[string]int64) (kept []string, decisions []Decision, err error) {
-	bySize := make(map[int64][]string)
+func DedupeSources(ctx context.Context, sources []string, details map[string]createdat.DetailedResult, sizes map[string]int64) (kept []string, decisions []Decision, err error) {
+	return dedupeSources(ctx, destfs.OS(), sources, details, sizes)
+}
+
+func dedupeSources(ctx context.Context, src destfs.FS, sources []string, details map[string]createdat.DetailedResult, sizes map[string]int64) (kept []string, decisions []Decision, err error) {
+	// Most files have a size no other file has. Bloom filters of the sizes seen once and seen again
+	// rule them out without holding them in the size groups; a false positive only puts a file in a
+	// group of its own.
+	seen := bloom.New(len(sources), bloomFalsePositives)
+	repeated := bloom.New(len(sources), bloomFalsePositives)
 	for _, p := range sources {
 		size, ok := sizes[p]
 		if !ok {
 			return nil, nil, fmt.Errorf("missing size for %s", p)
 		}
-		bySize[size] = append(bySize[size], p)
+		key := SizeKey(size)
+		if seen.Has(key) {
+			repeated.Add(key)
+		} else {
+			seen.Add(key)
+		}
+	}
+	bySize := make(map[int64][]string)
+	for _, p := range sources {
+		if size := sizes[p]; repeated.Has(SizeKey(size)) {
+			bySize[size] = append(bySize[size], p)
+		}
 	}
 
-	keptSet := make(map[string]bool)
 	skipSet := make(map[string]bool)
 	duplicateOf := make(map[string]string)
 
 	for size, paths := range bySize {
 		if len(paths) == 1 {
-			keptSet[paths[0]] = true
 			continue
 		}
 
 		// Group by header hash.
 		headerGroups := make(map[[32]byte][]string)
 		for _, p := range paths {
-			h, hashErr := headerHash(p, size)
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			h, hashErr := HeaderHash(src, p, size)
 			if hashErr != nil {
 				return nil, nil, hashErr
 			}
@@ -79,7 +127,6 @@ func DedupeSources(sources []string, details map[string]createdat.DetailedResult
 
 		for _, candidates := range headerGroups {
 			if len(candidates) == 1 {
-				keptSet[candidates[0]] = true
 				continue
 			}
 
@@ -89,7 +136,7 @@ func DedupeSources(sources []string, details map[string]createdat.DetailedResult
 			for _, p := range candidates {
 				assigned := false
 				for _, rep := range reps {
-					identical, cmpErr := filesAreIdentical(p, rep)
+					identical, cmpErr := identicalIn(ctx, src, p, src, rep)
 					if cmpErr != nil {
 						return nil, nil, cmpErr
 					}
@@ -108,8 +155,7 @@ func DedupeSources(sources []string, details map[string]createdat.DetailedResult
 			// For each cluster, choose the canonical one.
 			for _, rep := range reps {
 				members := clusters[rep]
-				canon := pickOldest(members, details)
-				keptSet[canon] = true
+				canon := PickOldest(members, details)
 				for _, m := range members {
 					if m == canon {
 						continue
@@ -128,133 +174,465 @@ func DedupeSources(sources []string, details map[string]createdat.DetailedResult
 			decisions = append(decisions, Decision{SourcePath: p, Action: ActionSkippedDuplicateSrc, DuplicateOf: duplicateOf[p]})
 			continue
 		}
-		if keptSet[p] {
-			kept = append(kept, p)
-			decisions = append(decisions, Decision{SourcePath: p, Action: ActionCopy})
-			continue
+		// Every file not skipped is unique or the canonical file of its group.
+		kept = append(kept, p)
+		decisions = append(decisions, Decision{SourcePath: p, Action: ActionCopy})
+	}
+
+	return kept, decisions, nil
+}
+
+// DedupeScope limits which sources are compared with each other during deduplication.
+type DedupeScope string
+
+const (
+	// DedupeScopeRun compares every source in the run with every other source.
+	DedupeScopeRun DedupeScope = "run"
+	// DedupeScopeDirectory only compares sources that live in the same directory.
+	DedupeScopeDirectory DedupeScope = "directory"
+)
+
+// ParseDedupeScope converts a CLI value into a DedupeScope.
+func ParseDedupeScope(s string) (DedupeScope, error) {
+	switch sc := DedupeScope(strings.ToLower(strings.TrimSpace(s))); sc {
+	case DedupeScopeRun, DedupeScopeDirectory:
+		return sc, nil
+	default:
+		return "", fmt.Errorf("invalid dedupe scope %q (want run or directory)", s)
+	}
+}
+
+// DedupeSourcesScoped is DedupeSources restricted to a scope.
+//
+// With DedupeScopeDirectory, identical files in different directories are all kept.
+// Decisions are returned in the order of sources.
+func DedupeSourcesScoped(ctx context.Context, sources []string, details map[string]createdat.DetailedResult, sizes map[string]int64, scope DedupeScope) (kept []string, decisions []Decision, err error) {
+	return DedupeSourcesScopedFS(ctx, destfs.OS(), sources, details, sizes, scope)
+}
+
+// DedupeSourcesScopedFS is DedupeSourcesScoped for sources stored in src.
+func DedupeSourcesScopedFS(ctx context.Context, src destfs.FS, sources []string, details map[string]createdat.DetailedResult, sizes map[string]int64, scope DedupeScope) (kept []string, decisions []Decision, err error) {
+	if scope != DedupeScopeDirectory {
+		return dedupeSources(ctx, src, sources, details, sizes)
+	}
+
+	byDir := make(map[string][]string)
+	dirs := make([]string, 0)
+	for _, p := range sources {
+		dir := filepath.Dir(p)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
 		}
+		byDir[dir] = append(byDir[dir], p)
+	}
 
-		// Should not happen, but fail safe.
-		decisions = append(decisions, Decision{SourcePath: p, Action: ActionFailed})
+	bySource := make(map[string]Decision, len(sources))
+	for _, dir := range dirs {
+		_, ds, err := dedupeSources(ctx, src, byDir[dir], details, sizes)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, d := range ds {
+			bySource[d.SourcePath] = d
+		}
 	}
 
+	kept = make([]string, 0, len(sources))
+	decisions = make([]Decision, 0, len(sources))
+	for _, p := range sources {
+		d := bySource[p]
+		if d.Action == ActionCopy {
+			kept = append(kept, p)
+		}
+		decisions = append(decisions, d)
+	}
 	return kept, decisions, nil
 }
 
+// DefaultUnknownDir is the bucket for files without a known created_at.
+const DefaultUnknownDir = "unknown"
+
+// DefaultReviewDir is the bucket for dated files whose date is too uncertain to file them under.
+const DefaultReviewDir = "_review"
+
+// UnknownLayout describes how files are arranged inside the unknown bucket.
+type UnknownLayout string
+
+const (
+	// UnknownLayoutFlat places all undatable files directly in the bucket.
+	UnknownLayoutFlat UnknownLayout = "flat"
+	// UnknownLayoutMtimeYear groups undatable files by the year of their mtime.
+	UnknownLayoutMtimeYear UnknownLayout = "mtime-year"
+	// UnknownLayoutMtimeMonth groups undatable files by the year and month of their mtime.
+	UnknownLayoutMtimeMonth UnknownLayout = "mtime-month"
+	// UnknownLayoutExtension groups undatable files by their lower-cased extension.
+	UnknownLayoutExtension UnknownLayout = "extension"
+)
+
+// ParseUnknownLayout converts a CLI value into an UnknownLayout.
+func ParseUnknownLayout(s string) (UnknownLayout, error) {
+	switch l := UnknownLayout(strings.ToLower(strings.TrimSpace(s))); l {
+	case UnknownLayoutFlat, UnknownLayoutMtimeYear, UnknownLayoutMtimeMonth, UnknownLayoutExtension:
+		return l, nil
+	default:
+		return "", fmt.Errorf("invalid unknown layout %q (want flat, mtime-year, mtime-month or extension)", s)
+	}
+}
+
+// PlanOptions configures PlanDestinations.
+type PlanOptions struct {
+	// UnknownDir is the destination-relative bucket for undatable files.
+	// If empty, DefaultUnknownDir is used.
+	UnknownDir string
+
+	// UnknownLayout arranges files inside UnknownDir. If empty, UnknownLayoutFlat is used.
+	UnknownLayout UnknownLayout
+
+	// ReviewDir is the destination-relative bucket for the dated sources in Review.
+	// If empty, DefaultReviewDir is used.
+	ReviewDir string
+
+	// Review holds the dated sources to place in ReviewDir, below the directory their date would
+	// file them under, instead of in that directory.
+	Review map[string]bool
+
+	// ModTimes holds source mtimes used by the mtime-based unknown layouts.
+	// Files without an mtime fall back to the flat layout.
+	ModTimes map[string]time.Time
+
+	// Layout arranges dated files below the destination. The zero Layout is plan.DefaultLayout.
+	Layout plan.Layout
+
+	// Routes arranges the dated files whose fields match one of them with its layout instead of Layout.
+	// The first matching route wins.
+	Routes []plan.Route
+
+	// Fields holds the layout field values (e.g. album) per source.
+	Fields map[string]plan.Fields
+
+	// Filenames holds the destination filename per source, for sources stored under a different name
+	// (e.g. the originals of an Apple Photos library). Other sources keep their own name.
+	Filenames map[string]string
+
+	// PathLimits bounds the destination-relative paths. With PathLimits.Shorten, the path of a file
+	// exceeding them is shortened, and a shortened name is returned as the Filename of its operation;
+	// otherwise paths are planned as they are, for the caller to report.
+	PathLimits plan.PathLimits
+
+	// Pairs holds, by source, the other file of its RAW+JPEG pair (pkg/rawpair). Both files of a pair
+	// are planned with the same collision suffix: the smallest that is free for both.
+	Pairs map[string]string
+
+	// Planned reports the destination paths planned before, such as by an earlier batch of a run: they
+	// are avoided like the paths of other sources. A nil Planned reports none.
+	Planned func(string) bool
+}
+
 // PlanDestinations plans deterministic destination paths for the kept sources.
 //
-// If a file has no known created_at, it is placed under:
+// Dated files are placed at <destRoot>/<opts.Layout>/<filename>, or at
+// <destRoot>/<opts.ReviewDir>/<opts.Layout>/<filename> when they are in opts.Review.
+// If a file has no known created_at, it is placed in the unknown bucket:
 //
-//	<destRoot>/unknown/<filename>
-func PlanDestinations(destRoot string, sources []string, bestCreatedAt map[string]time.Time) ([]plan.Operation, error) {
-	existing := make(map[string]bool)
-	ops := make([]plan.Operation, 0, len(sources))
-	for _, src := range sources {
-		filename := filepath.Base(src)
+//	<destRoot>/<opts.UnknownDir>/[layout/]<filename>
+func PlanDestinations(destRoot string, sources []string, bestCreatedAt map[string]time.Time, opts PlanOptions) ([]plan.Operation, error) {
+	unknownDir := opts.UnknownDir
+	if unknownDir == "" {
+		unknownDir = DefaultUnknownDir
+	}
+	unknownDir = filepath.Clean(unknownDir)
+	if !relative(unknownDir) {
+		return nil, fmt.Errorf("unknown dir %q must be relative to the destination", opts.UnknownDir)
+	}
+	reviewDir := opts.ReviewDir
+	if reviewDir == "" {
+		reviewDir = DefaultReviewDir
+	}
+	reviewDir = filepath.Clean(reviewDir)
+	if !relative(reviewDir) {
+		return nil, fmt.Errorf("review dir %q must be relative to the destination", opts.ReviewDir)
+	}
+
+	// place returns the directory of src, its name there and that name when it is not its own.
+	place := func(src string) (dir, filename, named string) {
+		filename = filepath.Base(src)
+		if name := opts.Filenames[src]; name != "" {
+			filename = name
+		}
 
 		createdAt, ok := bestCreatedAt[src]
-		var dst string
 		if ok && !createdAt.IsZero() {
-			dst = plan.Destination(destRoot, filename, createdAt, existing)
+			dir = plan.RouteLayout(opts.Routes, opts.Layout, opts.Fields[src]).Dir(createdAt, opts.Fields[src])
+			if opts.Review[src] {
+				dir = filepath.Join(reviewDir, dir)
+			}
 		} else {
-			dst = unknownDestination(destRoot, filename, existing)
+			dir = filepath.Join(unknownDir, unknownSubdir(src, opts))
+		}
+		named = opts.Filenames[src]
+		if opts.PathLimits.Shorten && opts.PathLimits.Exceeds(filepath.Join(dir, filename)) {
+			var short string
+			dir, short = opts.PathLimits.Fit(dir, filename)
+			if short != filename {
+				filename, named = short, short
+			}
 		}
+		return filepath.Join(destRoot, dir), filename, named
+	}
 
-		existing[dst] = true
-		ops = append(ops, plan.Operation{SourcePath: src, DestinationPath: dst})
+	existing := make(map[string]bool, len(sources))
+	taken := func(p string) bool {
+		return existing[p] || opts.Planned != nil && opts.Planned(p)
+	}
+	index := make(map[string]int, len(sources))
+	for i, src := range sources {
+		index[src] = i
+	}
+	// paired holds the operations of the second files of pairs, planned with the first.
+	paired := make(map[string]plan.Operation)
+	ops := make([]plan.Operation, 0, len(sources))
+	for i, src := range sources {
+		if op, ok := paired[src]; ok {
+			ops = append(ops, op)
+			continue
+		}
+		dir, filename, named := place(src)
+		other := opts.Pairs[src]
+		if j, ok := index[other]; !ok || j <= i {
+			dst := freeDestination(dir, filename, existing, taken)
+			ops = append(ops, plan.Operation{SourcePath: src, DestinationPath: dst, Filename: named})
+			continue
+		}
+		otherDir, otherFilename, otherNamed := place(other)
+		dsts := freeDestinations([]string{dir, otherDir}, []string{filename, otherFilename}, existing, taken)
+		ops = append(ops, plan.Operation{SourcePath: src, DestinationPath: dsts[0], Filename: named})
+		paired[other] = plan.Operation{SourcePath: other, DestinationPath: dsts[1], Filename: otherNamed}
 	}
 	return ops, nil
 }
 
-func unknownDestination(destRoot, filename string, existing map[string]bool) string {
-	dir := filepath.Join(destRoot, "unknown")
+// relative reports whether the cleaned dir stays inside the directory it is relative to.
+func relative(dir string) bool {
+	return !filepath.IsAbs(dir) && dir != ".." && !strings.HasPrefix(dir, ".."+string(filepath.Separator))
+}
 
-	basePath := filepath.Join(dir, filename)
-	if !existing[basePath] {
-		existing[basePath] = true
-		return basePath
+// unknownSubdir returns the layout-specific directory inside the unknown bucket.
+func unknownSubdir(src string, opts PlanOptions) string {
+	switch opts.UnknownLayout {
+	case UnknownLayoutMtimeYear, UnknownLayoutMtimeMonth:
+		mtime := opts.ModTimes[src]
+		if mtime.IsZero() {
+			return ""
+		}
+		if opts.UnknownLayout == UnknownLayoutMtimeYear {
+			return fmt.Sprintf("%04d", mtime.Year())
+		}
+		return filepath.Join(fmt.Sprintf("%04d", mtime.Year()), fmt.Sprintf("%02d", mtime.Month()))
+	case UnknownLayoutExtension:
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(src)), ".")
+		if ext == "" {
+			return "noext"
+		}
+		return ext
+	default:
+		return ""
 	}
+}
 
+// freeDestination returns the path of filename in dir, with a _N suffix before the extension when
+// another file is already planned there, and adds it to existing.
+func freeDestination(dir, filename string, existing map[string]bool, taken func(string) bool) string {
+	return freeDestinations([]string{dir}, []string{filename}, existing, taken)[0]
+}
+
+// freeDestinations returns the paths of the filenames in their dirs, all with the same _N suffix: the
+// smallest with which taken reports none of them, and adds them to existing.
+func freeDestinations(dirs, filenames []string, existing map[string]bool, taken func(string) bool) []string {
+	paths := make([]string, len(filenames))
+	for n := 0; ; n++ {
+		free := true
+		for i, filename := range filenames {
+			paths[i] = filepath.Join(dirs[i], suffixed(filename, n))
+			free = free && !taken(paths[i])
+		}
+		if free {
+			for _, p := range paths {
+				existing[p] = true
+			}
+			return paths
+		}
+	}
+}
+
+// suffixed returns filename with the collision suffix _n before its extension; 0 adds none.
+func suffixed(filename string, n int) string {
+	if n == 0 {
+		return filename
+	}
 	ext := filepath.Ext(filename)
-	nameWithoutExt := strings.TrimSuffix(filename, ext)
-	for i := 1; ; i++ {
-		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", nameWithoutExt, i, ext))
-		if !existing[candidate] {
-			existing[candidate] = true
-			return candidate
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(filename, ext), n, ext)
+}
+
+// ResolveAgainstLibrary skips sources whose exact content already exists anywhere in a library,
+// regardless of the path the library stores it under.
+//
+// library maps file sizes to the library files of that size. Sources with a match are returned as
+// ActionSkippedIdentical decisions pointing at the library file; the others are returned as kept.
+func ResolveAgainstLibrary(ctx context.Context, sources []string, sizes map[string]int64, library map[int64][]string) (kept []string, decisions []Decision, err error) {
+	return ResolveAgainstLibraryFS(ctx, destfs.OS(), destfs.OS(), sources, sizes, library)
+}
+
+// ResolveAgainstLibraryFS is ResolveAgainstLibrary for sources stored in src and a library stored in lib.
+func ResolveAgainstLibraryFS(ctx context.Context, src, lib destfs.FS, sources []string, sizes map[string]int64, library map[int64][]string) (kept []string, decisions []Decision, err error) {
+	kept = make([]string, 0, len(sources))
+	for _, source := range sources {
+		match := ""
+		for _, candidate := range library[sizes[source]] {
+			identical, cmpErr := identicalIn(ctx, src, source, lib, candidate)
+			if cmpErr != nil {
+				return nil, nil, cmpErr
+			}
+			if identical {
+				match = candidate
+				break
+			}
 		}
+		if match == "" {
+			kept = append(kept, source)
+			continue
+		}
+		decisions = append(decisions, Decision{
+			SourcePath:           source,
+			DestinationPath:      match,
+			FinalDestinationPath: match,
+			Action:               ActionSkippedIdentical,
+		})
 	}
+	return kept, decisions, nil
 }
 
 // ResolveAgainstDestination checks for existing destination files.
-// - If identical content exists at the planned destination, it marks skipped.
+// - If identical content, or a link to the source, exists at the planned destination, it marks skipped.
 // - If different content exists, it searches for the next suffix path.
-func ResolveAgainstDestination(ops []plan.Operation) ([]Decision, error) {
-	decisions := make([]Decision, 0, len(ops))
-	reserved := make(map[string]bool)
-
-	for _, op := range ops {
-		planned := op.DestinationPath
-		destDir := filepath.Dir(planned)
-
-		filename := filepath.Base(op.SourcePath)
-		ext := filepath.Ext(filename)
-		base := strings.TrimSuffix(filename, ext)
-
-		var final string
-		var action Action
-
-		for n := 0; ; n++ {
-			var candidate string
-			if n == 0 {
-				candidate = filepath.Join(destDir, filename)
-			} else {
-				candidate = filepath.Join(destDir, fmt.Sprintf("%s_%d%s", base, n, ext))
-			}
+func ResolveAgainstDestination(ctx context.Context, ops []plan.Operation) ([]Decision, error) {
+	return ResolveAgainstDestinationFS(ctx, destfs.OS(), destfs.OS(), ops)
+}
 
-			if reserved[candidate] {
+// ResolveAgainstDestinationFS is ResolveAgainstDestination for sources stored in src and a destination stored in dst.
+func ResolveAgainstDestinationFS(ctx context.Context, src, dst destfs.FS, ops []plan.Operation) ([]Decision, error) {
+	return ResolveAgainstDestinationReserved(ctx, src, dst, ops, nil)
+}
+
+// ResolveAgainstDestinationReserved is ResolveAgainstDestinationFS that passes over the paths reserved
+// reports, as if they held other content, without looking at them: such as the destinations of files
+// still being copied. A nil reserved reserves nothing.
+//
+// The two files of a RAW+JPEG pair (plan.Operation.PairedWith, both among ops) are resolved together:
+// they get the smallest suffix at which neither finds other content. A file of the pair identical to
+// the library file at a suffix is skipped there, whatever the suffix of the other.
+func ResolveAgainstDestinationReserved(ctx context.Context, src, dst destfs.FS, ops []plan.Operation, reserved func(string) bool) ([]Decision, error) {
+	index := make(map[string]int, len(ops))
+	for i, op := range ops {
+		index[op.SourcePath] = i
+	}
+	decisions := make([]Decision, len(ops))
+	taken := make(map[string]bool)
+
+	for i, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if decisions[i].SourcePath != "" {
+			// The second file of a pair, resolved with the first.
+			continue
+		}
+		group := []int{i}
+		if j, ok := index[op.PairedWith]; ok && j > i {
+			group = append(group, j)
+		}
+		if err := resolveGroup(ctx, src, dst, ops, group, decisions, taken, reserved); err != nil {
+			return nil, err
+		}
+	}
+
+	return decisions, nil
+}
+
+// resolveGroup decides the operations of ops at group, which take the same collision suffix, into
+// decisions.
+func resolveGroup(ctx context.Context, src, dst destfs.FS, ops []plan.Operation, group []int, decisions []Decision, taken map[string]bool, reserved func(string) bool) error {
+	// candidates holds the free path of each file of group at suffix n.
+	candidates := make([]string, len(group))
+	for n := 0; ; n++ {
+		free := true
+		for k, i := range group {
+			if decisions[i].SourcePath != "" {
 				continue
 			}
+			op := ops[i]
+			filename := op.Filename
+			if filename == "" {
+				filename = filepath.Base(op.SourcePath)
+			}
+			candidate := filepath.Join(filepath.Dir(op.DestinationPath), suffixed(filename, n))
+			candidates[k] = ""
 
-			st, err := os.Stat(candidate)
+			if taken[candidate] || (reserved != nil && reserved(candidate)) {
+				free = false
+				continue
+			}
+			_, err := dst.Stat(candidate)
 			if err != nil {
-				if os.IsNotExist(err) {
-					final = candidate
-					if n == 0 {
-						action = ActionCopy
-					} else {
-						action = ActionCopyRenamed
-					}
-					reserved[candidate] = true
-					break
+				if errors.Is(err, fs.ErrNotExist) {
+					candidates[k] = candidate
+					continue
 				}
-				return nil, fmt.Errorf("stat %s: %w", candidate, err)
+				return fmt.Errorf("stat %s: %w", candidate, err)
 			}
 
-			_ = st
-			identical, cmpErr := filesAreIdentical(op.SourcePath, candidate)
+			identical, cmpErr := identicalIn(ctx, src, op.SourcePath, dst, candidate)
 			if cmpErr != nil {
-				return nil, cmpErr
+				return cmpErr
 			}
 			if identical {
-				final = candidate
-				action = ActionSkippedIdentical
-				break
+				decisions[i] = Decision{
+					SourcePath:           op.SourcePath,
+					DestinationPath:      op.DestinationPath,
+					FinalDestinationPath: candidate,
+					Action:               ActionSkippedIdentical,
+				}
+				continue
 			}
+			free = false
+		}
+		if !free {
+			continue
 		}
 
-		decisions = append(decisions, Decision{
-			SourcePath:           op.SourcePath,
-			DestinationPath:      planned,
-			FinalDestinationPath: final,
-			Action:               action,
-		})
+		for k, i := range group {
+			if decisions[i].SourcePath != "" {
+				continue
+			}
+			action := ActionCopy
+			if n > 0 {
+				action = ActionCopyRenamed
+			}
+			taken[candidates[k]] = true
+			decisions[i] = Decision{
+				SourcePath:           ops[i].SourcePath,
+				DestinationPath:      ops[i].DestinationPath,
+				FinalDestinationPath: candidates[k],
+				Action:               action,
+			}
+		}
+		return nil
 	}
-
-	return decisions, nil
 }
 
-func pickOldest(paths []string, details map[string]createdat.DetailedResult) string {
+// PickOldest returns the path among paths with the earliest Best.CreatedAt in details, the canonical
+// file of a duplicate group. Unknown dates count as newest; ties and all-unknown groups keep the
+// lexicographically smallest path.
+func PickOldest(paths []string, details map[string]createdat.DetailedResult) string {
 	best := ""
 	bestTime := time.Time{}
 	for _, p := range paths {
@@ -282,21 +660,34 @@ func pickOldest(paths []string, details map[string]createdat.DetailedResult) str
 	return best
 }
 
-func headerHash(path string, size int64) ([32]byte, error) {
+// SizeKey returns the key of a file size in a bloom filter.
+func SizeKey(size int64) []byte {
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8+sha256.Size), uint64(size))
+}
+
+// ContentKey returns the key of a file in a bloom filter of the sizes and header hashes of files:
+// files with different keys cannot be identical.
+func ContentKey(size int64, header [32]byte) []byte {
+	return append(SizeKey(size), header[:]...)
+}
+
+// HeaderHash returns the SHA-256 of the first 64KiB of the file at path, of size bytes, the tier
+// between sizes and full comparisons of deduplication.
+func HeaderHash(fsys destfs.FS, path string, size int64) ([32]byte, error) {
 	limit := headerBytes
 	if size < int64(headerBytes) {
 		limit = int(size)
 	}
 
-	f, err := os.Open(path)
+	f, err := fsys.Open(path)
 	if err != nil {
-		return [32]byte{}, fmt.Errorf("open %s: %w", path, err)
+		return [32]byte{}, &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 	defer f.Close()
 
 	h := sha256.New()
 	if _, err := io.CopyN(h, f, int64(limit)); err != nil && err != io.EOF {
-		return [32]byte{}, fmt.Errorf("read header %s: %w", path, err)
+		return [32]byte{}, &errcode.FileError{Op: "read header", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 
 	var out [32]byte
@@ -304,18 +695,35 @@ func headerHash(path string, size int64) ([32]byte, error) {
 	return out, nil
 }
 
-func filesAreIdentical(path1, path2 string) (bool, error) {
-	info1, err := os.Stat(path1)
+// Identical reports whether two files have byte-for-byte identical content.
+func Identical(ctx context.Context, path1, path2 string) (bool, error) {
+	return filesAreIdentical(ctx, path1, path2)
+}
+
+func filesAreIdentical(ctx context.Context, path1, path2 string) (bool, error) {
+	return identicalIn(ctx, destfs.OS(), path1, destfs.OS(), path2)
+}
+
+// identicalIn compares path1 in fs1 with path2 in fs2.
+func identicalIn(ctx context.Context, fs1 destfs.FS, path1 string, fs2 destfs.FS, path2 string) (bool, error) {
+	info1, err := fs1.Stat(path1)
 	if err != nil {
-		return false, fmt.Errorf("stat %s: %w", path1, err)
+		return false, &errcode.FileError{Op: "stat", Path: path1, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
-	info2, err := os.Stat(path2)
+	info2, err := fs2.Stat(path2)
 	if err != nil {
-		return false, fmt.Errorf("stat %s: %w", path2, err)
+		return false, &errcode.FileError{Op: "stat", Path: path2, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	// Links to one local file, such as the hard links of copy.LinkHard, are identical without reading it.
+	if os.SameFile(info1, info2) {
+		return true, nil
 	}
 	if info1.Size() != info2.Size() {
 		return false, nil
 	}
+	if identical, ok, err := compareHashes(ctx, fs1, path1, info1, fs2, path2, info2); ok || err != nil {
+		return identical, err
+	}
 
 	// Header compare.
 	size := info1.Size()
@@ -325,24 +733,24 @@ func filesAreIdentical(path1, path2 string) (bool, error) {
 	}
 	buf1 := make([]byte, limit)
 	buf2 := make([]byte, limit)
-	f1, err := os.Open(path1)
+	f1, err := fs1.Open(path1)
 	if err != nil {
-		return false, fmt.Errorf("open %s: %w", path1, err)
+		return false, &errcode.FileError{Op: "open", Path: path1, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 	defer f1.Close()
-	f2, err := os.Open(path2)
+	f2, err := fs2.Open(path2)
 	if err != nil {
-		return false, fmt.Errorf("open %s: %w", path2, err)
+		return false, &errcode.FileError{Op: "open", Path: path2, Kind: errcode.ErrUnreadableSource, Err: err}
 	}
 	defer f2.Close()
 
 	n1, err1 := io.ReadFull(f1, buf1)
 	n2, err2 := io.ReadFull(f2, buf2)
 	if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
-		return false, fmt.Errorf("read %s: %w", path1, err1)
+		return false, &errcode.FileError{Op: "read", Path: path1, Kind: errcode.ErrUnreadableSource, Err: err1}
 	}
 	if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
-		return false, fmt.Errorf("read %s: %w", path2, err2)
+		return false, &errcode.FileError{Op: "read", Path: path2, Kind: errcode.ErrUnreadableSource, Err: err2}
 	}
 	if n1 != n2 {
 		return false, nil
@@ -360,8 +768,18 @@ func filesAreIdentical(path1, path2 string) (bool, error) {
 	buf1 = make([]byte, 32*1024)
 	buf2 = make([]byte, 32*1024)
 	for {
-		n1, err1 := f1.Read(buf1)
-		n2, err2 := f2.Read(buf2)
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		// Remote files may return short reads, so fill both buffers before comparing.
+		n1, err1 := io.ReadFull(f1, buf1)
+		n2, err2 := io.ReadFull(f2, buf2)
+		if err1 == io.ErrUnexpectedEOF {
+			err1 = io.EOF
+		}
+		if err2 == io.ErrUnexpectedEOF {
+			err2 = io.EOF
+		}
 		if n1 != n2 {
 			return false, nil
 		}
@@ -374,12 +792,197 @@ func filesAreIdentical(path1, path2 string) (bool, error) {
 			return true, nil
 		}
 		if err1 != nil {
-			return false, fmt.Errorf("read %s: %w", path1, err1)
+			return false, &errcode.FileError{Op: "read", Path: path1, Kind: errcode.ErrUnreadableSource, Err: err1}
 		}
 		if err2 != nil {
-			return false, fmt.Errorf("read %s: %w", path2, err2)
+			return false, &errcode.FileError{Op: "read", Path: path2, Kind: errcode.ErrUnreadableSource, Err: err2}
+		}
+	}
+}
+
+// HashAlgorithm is a content hash files can be compared by (WithHashAlgorithm).
+type HashAlgorithm string
+
+const (
+	// HashSHA256 is the digest of checksum manifests and the catalog, so its digests can be shared with them.
+	HashSHA256 HashAlgorithm = "sha256"
+	// HashBLAKE3 is a cryptographic hash several times faster than SHA-256.
+	HashBLAKE3 HashAlgorithm = "blake3"
+	// HashXXH128 is the 128-bit XXH3, a non-cryptographic hash that is faster still. Its digests only
+	// tell apart files that were not crafted to collide.
+	HashXXH128 HashAlgorithm = "xxhash128"
+)
+
+// ParseHashAlgorithm converts a CLI value into a HashAlgorithm.
+func ParseHashAlgorithm(s string) (HashAlgorithm, error) {
+	switch a := HashAlgorithm(strings.ToLower(strings.TrimSpace(s))); a {
+	case HashSHA256, HashBLAKE3, HashXXH128:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid hash algorithm %q (want sha256, blake3 or xxhash128)", s)
+	}
+}
+
+// WithHashes returns fsys with the hashes other tools recorded of its files (see pkg/hashlist). Files
+// are compared by a known hash instead of their content: two files with a hash of the same algorithm
+// without reading either, and a file with a known hash and one without by hashing only the latter.
+// A file that changed since its list was written (hashlist.List.Lookup) is read as usual.
+func WithHashes(fsys destfs.FS, list hashlist.List) destfs.FS {
+	h := newHashedFS(fsys)
+	h.list = list
+	return h
+}
+
+// WithHashAlgorithm returns fsys whose files are compared by their digest of algorithm instead of byte
+// for byte. Every file is read once, however many files of its size it is compared with, and the
+// digests are remembered for the rest of the run; a hash of algorithm known from WithHashes saves the read.
+func WithHashAlgorithm(fsys destfs.FS, algorithm HashAlgorithm) destfs.FS {
+	h := newHashedFS(fsys)
+	h.algorithm = algorithm
+	return h
+}
+
+// HashCache keeps the hashes of files across runs (WithHashCache), such as a cache.Cache. A hash is
+// only valid for the size and modification time the file had when it was computed.
+type HashCache interface {
+	// Hashes returns the hashes kept of path while it has size and modTime.
+	Hashes(path string, size int64, modTime time.Time) []hashlist.Hash
+	// AddHash keeps h as a hash of path while it has size and modTime.
+	AddHash(path string, size int64, modTime time.Time, h hashlist.Hash)
+}
+
+// WithHashCache returns fsys with the hashes cache kept of its files in earlier runs, and keeps the
+// hashes computed of them for later runs. Combine it with WithHashAlgorithm: files compared byte for
+// byte have no hash to keep.
+func WithHashCache(fsys destfs.FS, cache HashCache) destfs.FS {
+	h := newHashedFS(fsys)
+	h.cache = cache
+	return h
+}
+
+// hashedFS is a destfs.FS with known hashes.
+type hashedFS struct {
+	destfs.FS
+	list  hashlist.List
+	cache HashCache
+	// algorithm is the hash files are compared by, or "" to compare them byte for byte.
+	algorithm HashAlgorithm
+
+	mu sync.Mutex
+	// computed holds the hashes computed of files during the run, to hash every file once.
+	computed map[string][]hashlist.Hash
+}
+
+// newHashedFS returns fsys as a hashedFS, keeping the list and algorithm it already has.
+func newHashedFS(fsys destfs.FS) *hashedFS {
+	h := &hashedFS{FS: fsys, computed: make(map[string][]hashlist.Hash)}
+	if inner, ok := fsys.(*hashedFS); ok {
+		h.FS, h.list, h.cache, h.algorithm = inner.FS, inner.list, inner.cache, inner.algorithm
+	}
+	return h
+}
+
+func (h *hashedFS) hashes(path string, info fs.FileInfo) []hashlist.Hash {
+	h.mu.Lock()
+	known := append(h.list.Lookup(path, info), h.computed[path]...)
+	h.mu.Unlock()
+	if h.cache != nil && info != nil {
+		known = append(known, h.cache.Hashes(path, info.Size(), info.ModTime())...)
+	}
+	return known
+}
+
+// knownHashes returns the hashes of path in fsys known without reading it.
+func knownHashes(fsys destfs.FS, path string, info fs.FileInfo) []hashlist.Hash {
+	if h, ok := fsys.(*hashedFS); ok {
+		return h.hashes(path, info)
+	}
+	return nil
+}
+
+// hashAlgorithm returns the algorithm files of fsys are compared by, or "".
+func hashAlgorithm(fsys destfs.FS) HashAlgorithm {
+	if h, ok := fsys.(*hashedFS); ok {
+		return h.algorithm
+	}
+	return ""
+}
+
+// compareHashes compares path1 in fs1 with path2 in fs2 of the same size by their hashes, and reports
+// whether it could.
+func compareHashes(ctx context.Context, fs1 destfs.FS, path1 string, info1 fs.FileInfo, fs2 destfs.FS, path2 string, info2 fs.FileInfo) (identical, ok bool, err error) {
+	known1, known2 := knownHashes(fs1, path1, info1), knownHashes(fs2, path2, info2)
+	if identical, ok := hashlist.Match(known1, known2); ok {
+		return identical, true, nil
+	}
+	for _, algorithm := range []HashAlgorithm{hashAlgorithm(fs1), hashAlgorithm(fs2)} {
+		if algorithm == "" {
+			continue
+		}
+		sum1, err := knownOrComputed(ctx, fs1, path1, known1, algorithm)
+		if err != nil {
+			return false, true, err
+		}
+		sum2, err := knownOrComputed(ctx, fs2, path2, known2, algorithm)
+		return sum1 == sum2, true, err
+	}
+	// Hash the other file with an algorithm a known hash was computed with.
+	for _, h := range known1 {
+		if sum, ok, err := computeHash(ctx, fs2, path2, h.Algorithm); ok || err != nil {
+			return sum == h.Sum, true, err
+		}
+	}
+	for _, h := range known2 {
+		if sum, ok, err := computeHash(ctx, fs1, path1, h.Algorithm); ok || err != nil {
+			return sum == h.Sum, true, err
+		}
+	}
+	return false, false, nil
+}
+
+// knownOrComputed returns the digest of path in fsys by algorithm: the one among known, or else a computed one.
+func knownOrComputed(ctx context.Context, fsys destfs.FS, path string, known []hashlist.Hash, algorithm HashAlgorithm) (string, error) {
+	for _, h := range known {
+		if h.Algorithm == string(algorithm) {
+			return h.Sum, nil
+		}
+	}
+	sum, _, err := computeHash(ctx, fsys, path, string(algorithm))
+	return sum, err
+}
+
+// computeHash returns the hex-encoded digest of path in fsys by algorithm, and false when the
+// algorithm cannot be computed. The digest is remembered when fsys is a WithHashes, and kept in the
+// cache of WithHashCache.
+func computeHash(ctx context.Context, fsys destfs.FS, path, algorithm string) (string, bool, error) {
+	h, ok := hashlist.New(algorithm)
+	if !ok {
+		return "", false, nil
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", true, &errcode.FileError{Op: "open", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	defer f.Close()
+	// The file is stat'ed before it is read: one that changes while it is hashed is kept with its old
+	// modification time, which a later run does not find.
+	info, statErr := f.Stat()
+	if _, err := io.Copy(h, ctxio.NewReader(ctx, f)); err != nil {
+		if ctx.Err() != nil {
+			return "", true, ctx.Err()
+		}
+		return "", true, &errcode.FileError{Op: "read", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if hashed, ok := fsys.(*hashedFS); ok {
+		hashed.mu.Lock()
+		hashed.computed[path] = append(hashed.computed[path], hashlist.Hash{Algorithm: algorithm, Sum: sum})
+		hashed.mu.Unlock()
+		if hashed.cache != nil && statErr == nil {
+			hashed.cache.AddHash(path, info.Size(), info.ModTime(), hashlist.Hash{Algorithm: algorithm, Sum: sum})
 		}
 	}
+	return sum, true, nil
 }
 
 var reSuffix = regexp.MustCompile(`^(.*)_(\d+)$`)
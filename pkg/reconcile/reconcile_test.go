@@ -1,12 +1,19 @@
 package reconcile
 
 import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+	"github.com/quidome/media-organizer-go/pkg/hashlist"
+	"github.com/quidome/media-organizer-go/pkg/plan"
 )
 
 func TestDedupeSources_ChoosesOldest(t *testing.T) {
@@ -29,7 +36,7 @@ func TestDedupeSources_ChoosesOldest(t *testing.T) {
 
 	sizes := map[string]int64{p1: int64(len(content)), p2: int64(len(content))}
 
-	kept, decisions, err := DedupeSources([]string{p1, p2}, details, sizes)
+	kept, decisions, err := DedupeSources(context.Background(), []string{p1, p2}, details, sizes)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,3 +54,503 @@ func TestDedupeSources_ChoosesOldest(t *testing.T) {
 		t.Fatalf("expected %s to be skipped duplicate", p1)
 	}
 }
+
+func TestDedupeSources_UniqueSizes(t *testing.T) {
+	tmp := t.TempDir()
+	var sources []string
+	sizes := make(map[string]int64)
+	// Files of a size of their own are kept without being read: they do not exist.
+	for i := range 1000 {
+		p := filepath.Join(tmp, fmt.Sprintf("missing-%d.jpg", i))
+		sources = append(sources, p)
+		sizes[p] = int64(1000 + i)
+	}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		p := filepath.Join(tmp, name)
+		if err := os.WriteFile(p, []byte("same"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, p)
+		sizes[p] = 4
+	}
+
+	kept, decisions, err := DedupeSources(context.Background(), sources, nil, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1001 || len(decisions) != 1002 {
+		t.Fatalf("expected 1001 kept files, got %d of %d", len(kept), len(decisions))
+	}
+	if d := decisions[1001]; d.Action != ActionSkippedDuplicateSrc || d.DuplicateOf != filepath.Join(tmp, "a.jpg") {
+		t.Errorf("expected b.jpg skipped as a duplicate of a.jpg, got %+v", d)
+	}
+}
+
+func TestPlanDestinations_UnknownBucket(t *testing.T) {
+	dest := filepath.Join("/", "dest")
+	src1 := filepath.Join("/", "src", "a.jpg")
+	src2 := filepath.Join("/", "src", "b.mov")
+	mtime := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		opts PlanOptions
+		want []string
+	}{
+		{
+			name: "default flat bucket",
+			opts: PlanOptions{},
+			want: []string{filepath.Join(dest, "unknown", "a.jpg"), filepath.Join(dest, "unknown", "b.mov")},
+		},
+		{
+			name: "custom dir with mtime-year layout",
+			opts: PlanOptions{UnknownDir: "_review", UnknownLayout: UnknownLayoutMtimeYear, ModTimes: map[string]time.Time{src1: mtime}},
+			want: []string{filepath.Join(dest, "_review", "2019", "a.jpg"), filepath.Join(dest, "_review", "b.mov")},
+		},
+		{
+			name: "extension layout",
+			opts: PlanOptions{UnknownLayout: UnknownLayoutExtension},
+			want: []string{filepath.Join(dest, "unknown", "jpg", "a.jpg"), filepath.Join(dest, "unknown", "mov", "b.mov")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := PlanDestinations(dest, []string{src1, src2}, nil, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, op := range ops {
+				if op.DestinationPath != tt.want[i] {
+					t.Errorf("op %d: got %s, want %s", i, op.DestinationPath, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPlanDestinations_Review(t *testing.T) {
+	dest := filepath.Join("/", "dest")
+	sure := filepath.Join("/", "src", "a.jpg")
+	unsure := filepath.Join("/", "src", "b.jpg")
+	taken := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	ops, err := PlanDestinations(dest, []string{sure, unsure}, map[string]time.Time{sure: taken, unsure: taken}, PlanOptions{Review: map[string]bool{unsure: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dest, "2019", "03", "04", "a.jpg"); ops[0].DestinationPath != want {
+		t.Errorf("got %s, want %s", ops[0].DestinationPath, want)
+	}
+	if want := filepath.Join(dest, DefaultReviewDir, "2019", "03", "04", "b.jpg"); ops[1].DestinationPath != want {
+		t.Errorf("got %s, want %s", ops[1].DestinationPath, want)
+	}
+
+	if _, err := PlanDestinations(dest, nil, nil, PlanOptions{ReviewDir: "../outside"}); err == nil {
+		t.Error("expected error for review dir outside destination")
+	}
+}
+
+func TestPlanDestinations_PairsShareSuffix(t *testing.T) {
+	dest := filepath.Join("/", "dest")
+	dir := filepath.Join(dest, "2019", "03", "04")
+	jpeg := filepath.Join("/", "src", "IMG_0001.JPG")
+	raw := filepath.Join("/", "src", "IMG_0001.CR2")
+	taken := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	// Another file already has the name of the JPEG: the RAW file takes its suffix too.
+	planned := map[string]bool{filepath.Join(dir, "IMG_0001.JPG"): true}
+	ops, err := PlanDestinations(dest, []string{jpeg, raw}, map[string]time.Time{jpeg: taken, raw: taken}, PlanOptions{
+		Pairs:   map[string]string{jpeg: raw, raw: jpeg},
+		Planned: func(p string) bool { return planned[p] },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "IMG_0001_1.JPG"); ops[0].DestinationPath != want {
+		t.Errorf("got %s, want %s", ops[0].DestinationPath, want)
+	}
+	if want := filepath.Join(dir, "IMG_0001_1.CR2"); ops[1].DestinationPath != want || ops[1].SourcePath != raw {
+		t.Errorf("got %+v, want %s", ops[1], want)
+	}
+}
+
+func TestPlanDestinations_RejectsEscapingUnknownDir(t *testing.T) {
+	if _, err := PlanDestinations("/dest", nil, nil, PlanOptions{UnknownDir: "../outside"}); err == nil {
+		t.Fatalf("expected error for unknown dir outside destination")
+	}
+}
+
+func TestPlanDestinations_PathLimits(t *testing.T) {
+	dest := filepath.Join("/", "dest")
+	src1 := filepath.Join("/", "src", "IMG_20240615_123456_holiday.jpg")
+	src2 := filepath.Join("/", "other", "IMG_20240615_123456_holiday.jpg")
+	created := time.Date(2024, 6, 15, 12, 34, 56, 0, time.UTC)
+	bestCreatedAt := map[string]time.Time{src1: created, src2: created}
+	layout, err := plan.ParseLayout("{year}/{month}/{day}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := plan.PathLimits{MaxLength: 30, MaxDepth: 2}
+	ops, err := PlanDestinations(dest, []string{src1, src2}, bestCreatedAt, PlanOptions{Layout: layout, PathLimits: limits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dest, "2024", "06", "15", "IMG_20240615_123456_holiday.jpg"); ops[0].DestinationPath != want || ops[0].Filename != "" {
+		t.Errorf("without Shorten: got %s (%q), want %s", ops[0].DestinationPath, ops[0].Filename, want)
+	}
+
+	limits.Shorten = true
+	ops, err = PlanDestinations(dest, []string{src1, src2}, bestCreatedAt, PlanOptions{Layout: layout, PathLimits: limits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dest, "2024", "06-15", "IMG_20240615_12.jpg"),
+		filepath.Join(dest, "2024", "06-15", "IMG_20240615_12_1.jpg"),
+	}
+	for i, op := range ops {
+		if op.DestinationPath != want[i] || op.Filename != "IMG_20240615_12.jpg" {
+			t.Errorf("op %d: got %s (%q), want %s", i, op.DestinationPath, op.Filename, want[i])
+		}
+	}
+}
+
+func TestDedupeSourcesScoped_DirectoryKeepsCrossDirectoryCopies(t *testing.T) {
+	tmp := t.TempDir()
+	p1 := filepath.Join(tmp, "a", "x.jpg")
+	p2 := filepath.Join(tmp, "a", "y.jpg")
+	p3 := filepath.Join(tmp, "b", "x.jpg")
+
+	content := []byte("same")
+	for _, p := range []string{p1, p2, p3} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizes := map[string]int64{p1: 4, p2: 4, p3: 4}
+
+	kept, decisions, err := DedupeSourcesScoped(context.Background(), []string{p1, p2, p3}, nil, sizes, DedupeScopeDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0] != p1 || kept[1] != p3 {
+		t.Fatalf("expected to keep %s and %s, got %v", p1, p3, kept)
+	}
+	if decisions[1].Action != ActionSkippedDuplicateSrc || decisions[1].DuplicateOf != p1 {
+		t.Fatalf("expected %s to be a duplicate of %s, got %+v", p2, p1, decisions[1])
+	}
+}
+
+func TestResolveAgainstLibrary_SkipsContentAlreadyInLibrary(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib", "2020", "01", "01", "renamed.jpg")
+	src1 := filepath.Join(tmp, "src", "a.jpg")
+	src2 := filepath.Join(tmp, "src", "b.jpg")
+
+	for path, content := range map[string]string{lib: "same", src1: "same", src2: "diff"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sizes := map[string]int64{src1: 4, src2: 4}
+	kept, decisions, err := ResolveAgainstLibrary(context.Background(), []string{src1, src2}, sizes, map[int64][]string{4: {lib}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0] != src2 {
+		t.Fatalf("expected to keep only %s, got %v", src2, kept)
+	}
+	if len(decisions) != 1 || decisions[0].Action != ActionSkippedIdentical || decisions[0].FinalDestinationPath != lib {
+		t.Fatalf("expected %s to be skipped as identical to %s, got %+v", src1, lib, decisions)
+	}
+}
+
+func TestResolveAgainstDestinationFS_InMemoryDestination(t *testing.T) {
+	tmp := t.TempDir()
+	same := filepath.Join(tmp, "same.jpg")
+	diff := filepath.Join(tmp, "diff.jpg")
+	if err := os.WriteFile(same, []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(diff, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := destfs.NewMem()
+	dstDir := filepath.Join(string(filepath.Separator), "lib", "2020", "01", "01")
+	dst.WriteFile(filepath.Join(dstDir, "same.jpg"), []byte("same"))
+	dst.WriteFile(filepath.Join(dstDir, "diff.jpg"), []byte("old"))
+
+	ops := []plan.Operation{
+		{SourcePath: same, DestinationPath: filepath.Join(dstDir, "same.jpg")},
+		{SourcePath: diff, DestinationPath: filepath.Join(dstDir, "diff.jpg")},
+	}
+	decisions, err := ResolveAgainstDestinationFS(context.Background(), destfs.OS(), dst, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decisions[0].Action != ActionSkippedIdentical {
+		t.Fatalf("expected identical file to be skipped, got %+v", decisions[0])
+	}
+	if decisions[1].Action != ActionCopyRenamed || decisions[1].FinalDestinationPath != filepath.Join(dstDir, "diff_1.jpg") {
+		t.Fatalf("expected conflicting file to be renamed, got %+v", decisions[1])
+	}
+}
+
+func TestResolveAgainstDestination_LinkToSourceIsIdentical(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "IMG_1.jpg")
+	if err := os.WriteFile(src, []byte("media"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	linked := filepath.Join(tmp, "2020", "IMG_1.jpg")
+	if err := os.MkdirAll(filepath.Dir(linked), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(src, linked); err != nil {
+		t.Skipf("no hard links: %v", err)
+	}
+
+	// The file is not read: a link is identical by its inode.
+	decisions, err := ResolveAgainstDestinationFS(context.Background(), unreadableFS{destfs.OS()}, unreadableFS{destfs.OS()},
+		[]plan.Operation{{SourcePath: src, DestinationPath: linked}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decisions[0].Action != ActionSkippedIdentical || decisions[0].FinalDestinationPath != linked {
+		t.Fatalf("expected a hard link to the source to be skipped as identical, got %+v", decisions[0])
+	}
+}
+
+// unreadableFS is a filesystem whose files cannot be opened.
+type unreadableFS struct {
+	destfs.FS
+}
+
+func (unreadableFS) Open(name string) (destfs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func TestResolveAgainstDestinationReserved(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "a.jpg")
+	if err := os.WriteFile(src, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dstDir := filepath.Join(string(filepath.Separator), "lib")
+	reserved := func(p string) bool { return p == filepath.Join(dstDir, "a.jpg") }
+
+	ops := []plan.Operation{{SourcePath: src, DestinationPath: filepath.Join(dstDir, "a.jpg")}}
+	decisions, err := ResolveAgainstDestinationReserved(context.Background(), destfs.OS(), destfs.NewMem(), ops, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decisions[0].Action != ActionCopyRenamed || decisions[0].FinalDestinationPath != filepath.Join(dstDir, "a_1.jpg") {
+		t.Fatalf("expected the reserved path to be passed over, got %+v", decisions[0])
+	}
+}
+
+func TestResolveAgainstDestinationReserved_PairsShareSuffix(t *testing.T) {
+	tmp := t.TempDir()
+	jpeg := filepath.Join(tmp, "IMG_0001.JPG")
+	raw := filepath.Join(tmp, "IMG_0001.CR2")
+	for path, content := range map[string]string{jpeg: "jpeg", raw: "raw"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := destfs.NewMem()
+	dstDir := filepath.Join(string(filepath.Separator), "lib")
+	// Another shot of the same name is in the library as a JPEG only, and its RAW file at _1.
+	dst.WriteFile(filepath.Join(dstDir, "IMG_0001.JPG"), []byte("other jpeg"))
+	dst.WriteFile(filepath.Join(dstDir, "IMG_0001_1.CR2"), []byte("other raw"))
+
+	ops := []plan.Operation{
+		{SourcePath: jpeg, DestinationPath: filepath.Join(dstDir, "IMG_0001.JPG"), PairedWith: raw},
+		{SourcePath: raw, DestinationPath: filepath.Join(dstDir, "IMG_0001.CR2"), PairedWith: jpeg},
+	}
+	decisions, err := ResolveAgainstDestinationFS(context.Background(), destfs.OS(), dst, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"IMG_0001_2.JPG", "IMG_0001_2.CR2"} {
+		if d := decisions[i]; d.SourcePath != ops[i].SourcePath || d.Action != ActionCopyRenamed || d.FinalDestinationPath != filepath.Join(dstDir, want) {
+			t.Errorf("expected %s, got %+v", want, d)
+		}
+	}
+
+	// A file of the pair already in the library is skipped, and the other placed under the first free suffix.
+	dst.WriteFile(filepath.Join(dstDir, "IMG_0001.CR2"), []byte("raw"))
+	decisions, err = ResolveAgainstDestinationFS(context.Background(), destfs.OS(), dst, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := decisions[1]; d.Action != ActionSkippedIdentical || d.FinalDestinationPath != filepath.Join(dstDir, "IMG_0001.CR2") {
+		t.Errorf("expected the RAW file to be skipped, got %+v", d)
+	}
+	if d := decisions[0]; d.Action != ActionCopyRenamed || d.FinalDestinationPath != filepath.Join(dstDir, "IMG_0001_1.JPG") {
+		t.Errorf("expected the JPEG at _1, got %+v", d)
+	}
+}
+
+func TestWithHashes_TrustsListedHashes(t *testing.T) {
+	tmp := t.TempDir()
+	source := filepath.Join(tmp, "source.jpg")
+	archived := filepath.Join(tmp, "archive", "a.jpg")
+	other := filepath.Join(tmp, "archive", "b.jpg")
+	for path, content := range map[string]string{source: "same", archived: "SAME", other: "diff"} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The list records the hash of "same" for both archived files: it is trusted instead of the content
+	// of a, but b has changed size since.
+	list := make(hashlist.List)
+	list.Add(
+		hashlist.Entry{Path: archived, Size: 4, Hashes: []hashlist.Hash{{Algorithm: "sha256", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("same")))}}},
+		hashlist.Entry{Path: other, Size: 5, Hashes: []hashlist.Hash{{Algorithm: "sha256", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("same")))}}},
+	)
+	fsys := WithHashes(destfs.OS(), list)
+	sizes := map[string]int64{source: 4}
+	_, decisions, err := ResolveAgainstLibraryFS(context.Background(), fsys, fsys, []string{source}, sizes, map[int64][]string{4: {other, archived}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 || decisions[0].DestinationPath != archived {
+		t.Fatalf("expected the source to match the listed hash of %s, got %+v", archived, decisions)
+	}
+
+	// Without the list the archived file is read, and differs.
+	_, decisions, err = ResolveAgainstLibraryFS(context.Background(), destfs.OS(), destfs.OS(), []string{source}, sizes, map[int64][]string{4: {archived}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 0 {
+		t.Errorf("expected no match without the list, got %+v", decisions)
+	}
+}
+
+func TestWithHashAlgorithm(t *testing.T) {
+	if _, err := ParseHashAlgorithm("md5"); err == nil {
+		t.Errorf("expected an error for an unsupported algorithm")
+	}
+	tmp := t.TempDir()
+	a, b, c := filepath.Join(tmp, "a.jpg"), filepath.Join(tmp, "b.jpg"), filepath.Join(tmp, "c.jpg")
+	for path, content := range map[string]string{a: "same", b: "diff", c: "same"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizes := map[string]int64{a: 4, b: 4, c: 4}
+
+	for _, s := range []string{"sha256", "BLAKE3", "xxhash128"} {
+		algorithm, err := ParseHashAlgorithm(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys := WithHashAlgorithm(destfs.OS(), algorithm)
+		_, decisions, err := DedupeSourcesScopedFS(context.Background(), fsys, []string{a, b, c}, nil, sizes, DedupeScopeRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decisions[2].Action != ActionSkippedDuplicateSrc || decisions[2].DuplicateOf != a || decisions[1].Action != ActionCopy {
+			t.Errorf("%s: got %+v", algorithm, decisions)
+		}
+		// The files with the same header are hashed once; b differs in its header already.
+		computed := fsys.(*hashedFS).computed
+		for _, p := range []string{a, c} {
+			if got := computed[p]; len(got) != 1 || got[0].Algorithm != string(algorithm) {
+				t.Errorf("%s: computed hashes of %s: %+v", algorithm, p, got)
+			}
+		}
+		if got := computed[b]; len(got) != 0 {
+			t.Errorf("%s: expected b not to be hashed, got %+v", algorithm, got)
+		}
+	}
+
+	// A listed digest of the algorithm is trusted instead of the content.
+	list := make(hashlist.List)
+	list.Add(hashlist.Entry{Path: b, Size: 4, Hashes: []hashlist.Hash{{Algorithm: "sha256", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("same")))}}})
+	fsys := WithHashAlgorithm(WithHashes(destfs.OS(), list), HashSHA256)
+	if identical, err := identicalIn(context.Background(), fsys, a, fsys, b); err != nil || !identical {
+		t.Errorf("expected the listed digest to be trusted, got %v, %v", identical, err)
+	}
+}
+
+// mapCache is a HashCache in memory.
+type mapCache map[string][]hashlist.Hash
+
+func (m mapCache) key(path string, size int64, modTime time.Time) string {
+	return fmt.Sprintf("%s %d %d", path, size, modTime.UnixNano())
+}
+
+func (m mapCache) Hashes(path string, size int64, modTime time.Time) []hashlist.Hash {
+	return m[m.key(path, size, modTime)]
+}
+
+func (m mapCache) AddHash(path string, size int64, modTime time.Time, h hashlist.Hash) {
+	k := m.key(path, size, modTime)
+	m[k] = append(m[k], h)
+}
+
+func TestWithHashCache(t *testing.T) {
+	tmp := t.TempDir()
+	a, b := filepath.Join(tmp, "a.jpg"), filepath.Join(tmp, "b.jpg")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte("same"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sizes := map[string]int64{a: 4, b: 4}
+	cache := make(mapCache)
+
+	// The first run keeps the digests it computes.
+	fsys := WithHashAlgorithm(WithHashCache(destfs.OS(), cache), HashSHA256)
+	_, decisions, err := DedupeSourcesScopedFS(context.Background(), fsys, []string{a, b}, nil, sizes, DedupeScopeRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decisions[1].Action != ActionSkippedDuplicateSrc || len(cache) != 2 {
+		t.Fatalf("got %+v, cache %+v", decisions, cache)
+	}
+
+	// The next run trusts them instead of the content of unchanged files.
+	if err := os.WriteFile(b, []byte("diff"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range cache {
+		delete(cache, k)
+	}
+	sum := hashlist.Hash{Algorithm: "sha256", Sum: fmt.Sprintf("%x", sha256.Sum256([]byte("same")))}
+	cache.AddHash(b, info.Size(), info.ModTime(), sum)
+	fsys = WithHashAlgorithm(WithHashCache(destfs.OS(), cache), HashSHA256)
+	if identical, err := identicalIn(context.Background(), fsys, a, fsys, b); err != nil || !identical {
+		t.Errorf("expected the cached digest to be trusted, got %v, %v", identical, err)
+	}
+
+	// A file that changed since is read again.
+	if err := os.Chtimes(b, time.Now(), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if identical, err := identicalIn(context.Background(), fsys, a, fsys, b); err != nil || identical {
+		t.Errorf("expected the changed file to be read, got %v, %v", identical, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package report writes a static HTML report of the decisions of a run, grouped by date and by what
+// happens to each file, with thumbnails of the photos, so a large dry-run can be reviewed in a browser
+// before it is executed.
+package report
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/quidome/media-organizer-go/pkg/dashboard"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// Kind is the section of the report a file is counted in, by what its decision does with it.
+type Kind string
+
+const (
+	// KindCopy is a file copied (or to be copied) to a dated destination.
+	KindCopy Kind = "copy"
+	// KindUnknown is a file copied without a date, into the directory for unknown dates.
+	KindUnknown Kind = "unknown"
+	// KindDuplicate is a file skipped because another source of the run has the same content.
+	KindDuplicate Kind = "duplicate"
+	// KindSkip is a file skipped for another reason: it is in the library already, or is a burst shot
+	// or version that is not kept.
+	KindSkip Kind = "skip"
+	// KindFailed is a file that failed.
+	KindFailed Kind = "failed"
+)
+
+// kinds lists the kinds in the order the report shows them.
+var kinds = []Kind{KindCopy, KindUnknown, KindDuplicate, KindSkip, KindFailed}
+
+// KindOf returns the kind of decision d, for a file that was dated or not.
+func KindOf(d reconcile.Decision, dated bool) Kind {
+	switch d.Action {
+	case reconcile.ActionCopy, reconcile.ActionCopyRenamed, reconcile.ActionCopied, reconcile.ActionCopiedRenamed:
+		if !dated {
+			return KindUnknown
+		}
+		return KindCopy
+	case reconcile.ActionSkippedDuplicateSrc:
+		return KindDuplicate
+	case reconcile.ActionFailed:
+		return KindFailed
+	}
+	return KindSkip
+}
+
+// OpenFunc opens a source file for reading.
+type OpenFunc = dashboard.OpenFunc
+
+// Options configures a report.
+type Options struct {
+	// Title is shown at the top of the report.
+	Title string
+
+	// Open reads sources for thumbnails; nil leaves the thumbnails out.
+	Open OpenFunc
+}
+
+// ThumbnailDir returns the directory the thumbnails of the report at path go into: the path without
+// its extension, followed by _files, as browsers save a page with its images.
+func ThumbnailDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "_files"
+}
+
+// Write writes the report of res to path, and a JPEG thumbnail of every photo the image decoders of
+// the standard library can read (dashboard.Thumbnailable) into ThumbnailDir(path). Photos that cannot
+// be opened or decoded are listed without a thumbnail.
+func Write(ctx context.Context, path string, res organizer.Result, opts Options) error {
+	v := newView(res, opts)
+	if opts.Open != nil {
+		if err := writeThumbnails(ctx, ThumbnailDir(path), opts.Open, &v); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	if err := page.Execute(w, v); err != nil {
+		f.Close()
+		return fmt.Errorf("write report %s: %w", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("write report %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+//go:embed report.html
+var pageSource string
+
+var page = template.Must(template.New("report").Parse(pageSource))
+
+// row is a file listed in the report.
+type row struct {
+	index       int
+	Kind        Kind
+	Action      reconcile.Action
+	Source      string
+	Taken       string
+	Destination string
+	// Note names the file kept instead, or the error.
+	Note      string
+	Thumbnail string
+}
+
+// day is the files of one date, or of no date.
+type day struct {
+	Date   string
+	Counts []count
+	Rows   []*row
+}
+
+type count struct {
+	Kind Kind
+	N    int
+}
+
+// view is the data of the page template.
+type view struct {
+	Title  string
+	Files  int
+	Counts []count
+	Days   []day
+}
+
+// newView groups the decisions of res by date, in date order, with the files without a date last.
+func newView(res organizer.Result, opts Options) view {
+	v := view{Title: opts.Title, Files: len(res.Decisions)}
+	if v.Title == "" {
+		v.Title = "Organize report"
+	}
+	days := make(map[string]*day)
+	total := make(map[Kind]int)
+	for i, d := range res.Decisions {
+		best := res.Details[d.SourcePath].Best
+		dated := !best.CreatedAt.IsZero()
+		r := &row{
+			index:       i,
+			Kind:        KindOf(d, dated),
+			Action:      d.Action,
+			Source:      d.SourcePath,
+			Destination: d.FinalDestinationPath,
+			Note:        d.DuplicateOf,
+		}
+		date := ""
+		if dated {
+			date = best.CreatedAt.Format("2006-01-02")
+			r.Taken = best.CreatedAt.Format("15:04:05")
+		}
+		if d.Error != nil {
+			r.Note = d.Error.Error()
+		}
+		dy, ok := days[date]
+		if !ok {
+			dy = &day{Date: date}
+			days[date] = dy
+		}
+		dy.Rows = append(dy.Rows, r)
+		total[r.Kind]++
+	}
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	slices.Sort(dates)
+	if len(dates) > 0 && dates[0] == "" {
+		// No date sorts first; list those files last.
+		dates = append(dates[1:], "")
+	}
+	for _, date := range dates {
+		dy := days[date]
+		n := make(map[Kind]int)
+		for _, r := range dy.Rows {
+			n[r.Kind]++
+		}
+		dy.Counts = counts(n)
+		v.Days = append(v.Days, *dy)
+	}
+	v.Counts = counts(total)
+	return v
+}
+
+// counts returns the non-zero counts of n in the order of kinds.
+func counts(n map[Kind]int) []count {
+	var out []count
+	for _, k := range kinds {
+		if n[k] > 0 {
+			out = append(out, count{Kind: k, N: n[k]})
+		}
+	}
+	return out
+}
+
+// writeThumbnails writes the thumbnails of the rows of v into dir, several at a time, and records
+// their paths relative to the report in the rows.
+func writeThumbnails(ctx context.Context, dir string, open OpenFunc, v *view) error {
+	var rows []*row
+	for _, dy := range v.Days {
+		for _, r := range dy.Rows {
+			if dashboard.Thumbnailable(r.Source) {
+				rows = append(rows, r)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create thumbnail directory: %w", err)
+	}
+
+	work := make(chan *row)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var writeErr error
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				name := fmt.Sprintf("%06d.jpg", r.index)
+				ok, err := writeThumbnail(open, r.Source, filepath.Join(dir, name))
+				if err != nil {
+					mu.Lock()
+					if writeErr == nil {
+						writeErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				if ok {
+					r.Thumbnail = filepath.Base(dir) + "/" + name
+				}
+			}
+		}()
+	}
+	for _, r := range rows {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// writeThumbnail writes a thumbnail of the photo at source to path. ok is false when the photo
+// cannot be read or decoded; err is only set when the thumbnail cannot be written.
+func writeThumbnail(open OpenFunc, source, path string) (ok bool, err error) {
+	in, err := open(source)
+	if err != nil {
+		return false, nil
+	}
+	img, _, err := image.Decode(bufio.NewReader(in))
+	in.Close()
+	if err != nil {
+		return false, nil
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return false, fmt.Errorf("write thumbnail: %w", err)
+	}
+	w := bufio.NewWriter(out)
+	err = jpeg.Encode(w, dashboard.Thumbnail(img, dashboard.ThumbnailSize), &jpeg.Options{Quality: 75})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("write thumbnail: %w", err)
+	}
+	return true, nil
+}
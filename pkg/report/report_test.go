@@ -0,0 +1,110 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+	"github.com/quidome/media-organizer-go/pkg/organizer"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+func TestWrite(t *testing.T) {
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 640, 480)), nil); err != nil {
+		t.Fatal(err)
+	}
+	dated := func(t time.Time) createdat.DetailedResult {
+		return createdat.DetailedResult{Best: createdat.Result{CreatedAt: t, Source: createdat.SourceMetadata}}
+	}
+	res := organizer.Result{
+		Decisions: []reconcile.Decision{
+			{SourcePath: "/card/b.jpg", FinalDestinationPath: "/library/2024/01/03/b.jpg", Action: reconcile.ActionCopy},
+			{SourcePath: "/card/a<1>.jpg", FinalDestinationPath: "/library/2024/01/02/a<1>.jpg", Action: reconcile.ActionCopy},
+			{SourcePath: "/card/copy.jpg", Action: reconcile.ActionSkippedDuplicateSrc, DuplicateOf: "/card/a<1>.jpg"},
+			{SourcePath: "/card/scan.png", FinalDestinationPath: "/library/unknown/scan.png", Action: reconcile.ActionCopy},
+			{SourcePath: "/card/c.mov", Action: reconcile.ActionFailed, Error: errors.New("permission denied")},
+		},
+		Details: map[string]createdat.DetailedResult{
+			"/card/a<1>.jpg": dated(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)),
+			"/card/copy.jpg": dated(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)),
+			"/card/b.jpg":    dated(time.Date(2024, 1, 3, 8, 30, 0, 0, time.UTC)),
+		},
+	}
+	path := filepath.Join(t.TempDir(), "plan.html")
+	err := Write(context.Background(), path, res, Options{
+		Title: "card -> library",
+		Open: func(p string) (io.ReadCloser, error) {
+			if p == "/card/scan.png" {
+				return nil, os.ErrNotExist
+			}
+			return io.NopCloser(bytes.NewReader(img.Bytes())), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	for _, want := range []string{
+		"card -&gt; library",
+		"5 files, 2 copy, 1 unknown, 1 duplicate, 1 failed",
+		"/card/a&lt;1&gt;.jpg",
+		`<tr class="unknown">`,
+		"permission denied",
+		`src="plan_files/000001.jpg"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report lacks %q:\n%s", want, page)
+		}
+	}
+	// Dates in order, the files without a date last.
+	first, second, none := strings.Index(page, "2024-01-02"), strings.Index(page, "2024-01-03"), strings.Index(page, "No date")
+	if first < 0 || second < first || none < second {
+		t.Errorf("unexpected order of dates: %d, %d, %d", first, second, none)
+	}
+
+	thumb, err := os.Open(filepath.Join(ThumbnailDir(path), "000001.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer thumb.Close()
+	if cfg, err := jpeg.DecodeConfig(thumb); err != nil || cfg.Width != 160 {
+		t.Errorf("unexpected thumbnail: %+v, %v", cfg, err)
+	}
+	// The photo that could not be read has no thumbnail.
+	if _, err := os.Stat(filepath.Join(ThumbnailDir(path), "000003.jpg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no thumbnail of an unreadable photo, got %v", err)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		action reconcile.Action
+		dated  bool
+		want   Kind
+	}{
+		{reconcile.ActionCopied, true, KindCopy},
+		{reconcile.ActionCopyRenamed, false, KindUnknown},
+		{reconcile.ActionSkippedDuplicateSrc, true, KindDuplicate},
+		{reconcile.ActionSkippedIdentical, true, KindSkip},
+		{reconcile.ActionSkippedBurst, true, KindSkip},
+		{reconcile.ActionFailed, false, KindFailed},
+	} {
+		if got := KindOf(reconcile.Decision{Action: tc.action}, tc.dated); got != tc.want {
+			t.Errorf("KindOf(%s, %v) = %s, want %s", tc.action, tc.dated, got, tc.want)
+		}
+	}
+}
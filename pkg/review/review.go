@@ -0,0 +1,143 @@
+// Package review explains why a file was planned into the review bucket instead of the directory of
+// its date: a JSON note next to the file lists the created_at candidates that were considered, so it
+// can be dated by hand.
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+)
+
+// Suffix is appended to the name of a file in the review bucket to name its note.
+const Suffix = ".review.json"
+
+// NotePath returns the path of the note of the file at path.
+func NotePath(path string) string {
+	return path + Suffix
+}
+
+// Note is the note of a file in the review bucket.
+type Note struct {
+	// SourcePath is the path the file was organized from.
+	SourcePath    string     `json:"source_path"`
+	BestCreatedAt string     `json:"best_created_at,omitempty"`
+	BestSource    string     `json:"best_source"`
+	Confidence    string     `json:"confidence"`
+	Reason        string     `json:"reason"`
+	CreatedAt     Candidates `json:"created_at"`
+}
+
+// Candidates are the created_at candidates of a file, in RFC 3339; absent candidates are empty.
+type Candidates struct {
+	Catalog   string `json:"catalog,omitempty"`
+	Metadata  string `json:"metadata,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	Filestat  string `json:"filestat,omitempty"`
+}
+
+// New returns the note of the file at source with the attribution d.
+func New(source string, d createdat.DetailedResult) Note {
+	return Note{
+		SourcePath:    source,
+		BestCreatedAt: format(d.Best.CreatedAt),
+		BestSource:    string(d.Best.Source),
+		Confidence:    string(d.Confidence()),
+		Reason:        Reason(d),
+		CreatedAt: Candidates{
+			Catalog:   format(d.Catalog),
+			Metadata:  format(d.Metadata),
+			Filename:  format(d.Filename),
+			Directory: format(d.Directory),
+			Filestat:  format(d.Filestat),
+		},
+	}
+}
+
+// Marshal returns the indented JSON of n.
+func (n Note) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ReadNote reads the note at path. A missing note is an error wrapping fs.ErrNotExist.
+func ReadNote(path string) (Note, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Note{}, err
+	}
+	var n Note
+	if err := json.Unmarshal(data, &n); err != nil {
+		return Note{}, fmt.Errorf("review note %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// Best returns the chosen date of n, and false when it has none.
+func (n Note) Best() (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, n.BestCreatedAt)
+	return t, err == nil
+}
+
+// dateLayouts are the layouts ParseDate accepts, most precise first.
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02", "2006-01", "2006"}
+
+// ParseDate parses a date given by hand: RFC 3339, or a date with an optional time (1998-07-14,
+// 1998-07-14 18:30), a month (1998-07) or a year (1998), read in loc.
+func ParseDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (want YYYY-MM-DD, optionally with HH:MM[:SS], YYYY-MM or YYYY)", s)
+}
+
+// Reason explains in a sentence why the date of d cannot be trusted more than its confidence.
+func Reason(d createdat.DetailedResult) string {
+	switch d.Best.Source {
+	case createdat.SourceMetadata:
+		if !d.Filename.IsZero() {
+			return fmt.Sprintf("the metadata and filename dates are %s apart", apart(d.Metadata, d.Filename))
+		}
+		return "dated by its metadata"
+	case createdat.SourceFilename:
+		return "dated only by its filename"
+	case createdat.SourceDirectory:
+		return "dated only by the directory an earlier layout placed it in"
+	case createdat.SourceMtime:
+		return "dated only by its modification time, which copies commonly reset"
+	case createdat.SourceCatalog:
+		return "dated by a photo catalog"
+	default:
+		return "no date found"
+	}
+}
+
+// apart returns the distance between a and b in days, or hours below two days.
+func apart(a, b time.Time) string {
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
+
+func format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,89 @@
+package review
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/createdat"
+)
+
+func TestNew(t *testing.T) {
+	taken := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	d := createdat.DetailedResult{
+		Best:     createdat.Result{CreatedAt: taken, Source: createdat.SourceMetadata},
+		Metadata: taken,
+		Filename: taken.AddDate(0, 0, -400),
+		Filestat: taken.AddDate(5, 0, 0),
+	}
+	data, err := New("/src/a.jpg", d).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n Note
+	if err := json.Unmarshal(data, &n); err != nil {
+		t.Fatal(err)
+	}
+	want := Note{
+		SourcePath:    "/src/a.jpg",
+		BestCreatedAt: "2019-03-04T05:06:07Z",
+		BestSource:    "metadata",
+		Confidence:    "medium",
+		Reason:        "the metadata and filename dates are 400 days apart",
+		CreatedAt: Candidates{
+			Metadata: "2019-03-04T05:06:07Z",
+			Filename: "2018-01-28T05:06:07Z",
+			Filestat: "2024-03-04T05:06:07Z",
+		},
+	}
+	if n != want {
+		t.Errorf("got %+v, want %+v", n, want)
+	}
+	if NotePath("/dst/_review/a.jpg") != "/dst/_review/a.jpg.review.json" {
+		t.Errorf("unexpected note path %s", NotePath("/dst/_review/a.jpg"))
+	}
+}
+
+func TestReadNote(t *testing.T) {
+	path := NotePath(filepath.Join(t.TempDir(), "a.jpg"))
+	data, err := New("/src/a.jpg", createdat.DetailedResult{Best: createdat.Result{Source: createdat.SourceUnknown}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	n, err := ReadNote(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.Best(); ok || n.Reason != "no date found" {
+		t.Errorf("unexpected note %+v", n)
+	}
+	if _, err := ReadNote(path + ".missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing note to be reported as such, got %v", err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	loc := time.FixedZone("TEST", 2*3600)
+	for s, want := range map[string]time.Time{
+		"1998-07-14":                time.Date(1998, 7, 14, 0, 0, 0, 0, loc),
+		" 1998-07-14 18:30 ":        time.Date(1998, 7, 14, 18, 30, 0, 0, loc),
+		"1998-07-14 18:30:05":       time.Date(1998, 7, 14, 18, 30, 5, 0, loc),
+		"1998-07":                   time.Date(1998, 7, 1, 0, 0, 0, 0, loc),
+		"1998":                      time.Date(1998, 1, 1, 0, 0, 0, 0, loc),
+		"1998-07-14T18:30:05+00:00": time.Date(1998, 7, 14, 18, 30, 5, 0, time.UTC),
+	} {
+		if got, err := ParseDate(s, loc); err != nil || !got.Equal(want) {
+			t.Errorf("ParseDate(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseDate("14-07-1998", loc); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -1,11 +1,16 @@
 package scan
 
 import (
+	"context"
 	"io/fs"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/sidecar"
 )
 
 type Options struct {
@@ -13,17 +18,46 @@ type Options struct {
 
 	PhotoExtensions []string
 	VideoExtensions []string
+
+	// SidecarExtensions lists companion file extensions (XMP, AAE, ...) that are attached
+	// to the media file they describe instead of being reported on their own.
+	SidecarExtensions []string
+
+	// ExcludeDirs lists directories, relative to the root and slash-separated, that are not scanned.
+	ExcludeDirs []string
+
+	// IgnoreFile names a marker file: directories holding a file of this name, and everything below
+	// them, are not scanned. Empty scans every directory.
+	IgnoreFile string
+
+	// OnFound, if set, is called after each media file found with the number and total size of the
+	// media files found so far.
+	OnFound func(files int, bytes int64)
+}
+
+// IgnoreFile is the marker file that keeps a library directory, such as a hand-curated album, out of
+// the runs that organize into the library.
+const IgnoreFile = ".media-organizer-ignore"
+
+// RawExtensions returns the extensions of the camera RAW formats scanned by default, whose dates are
+// often only in their XMP sidecar.
+func RawExtensions() []string {
+	return []string{
+		".dng", ".cr2", ".cr3", ".crw", ".nef", ".nrw", ".arw", ".srf", ".sr2", ".raf", ".orf", ".rw2",
+		".rwl", ".pef", ".srw", ".3fr", ".iiq", ".x3f",
+	}
 }
 
 func DefaultOptions() Options {
 	return Options{
 		MaxDepth: -1,
-		PhotoExtensions: []string{
+		PhotoExtensions: append([]string{
 			".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".tif", ".tiff", ".bmp",
-		},
+		}, RawExtensions()...),
 		VideoExtensions: []string{
 			".mp4", ".mov", ".m4v", ".mkv", ".avi", ".webm", ".mts", ".3gp",
 		},
+		SidecarExtensions: sidecar.DefaultExtensions(),
 	}
 }
 
@@ -31,10 +65,13 @@ type Record struct {
 	Path          string    `json:"path"`
 	FileSizeBytes int64     `json:"file_size_bytes"`
 	ModTime       time.Time `json:"mod_time"`
+
+	// Sidecars holds the root-relative paths of companion files belonging to this record.
+	Sidecars []string `json:"sidecars,omitempty"`
 }
 
-func Scan(fsys fs.FS, root string, opts Options) ([]string, error) {
-	records, err := ScanRecords(fsys, root, opts)
+func Scan(ctx context.Context, fsys fs.FS, root string, opts Options) ([]string, error) {
+	records, err := ScanRecords(ctx, fsys, root, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -46,33 +83,91 @@ func Scan(fsys fs.FS, root string, opts Options) ([]string, error) {
 	return matches, nil
 }
 
-func ScanRecords(fsys fs.FS, root string, opts Options) ([]Record, error) {
+func ScanRecords(ctx context.Context, fsys fs.FS, root string, opts Options) ([]Record, error) {
+	var matches []Record
+	err := ScanDirs(ctx, fsys, root, opts, func(records []Record) error {
+		matches = append(matches, records...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Path < matches[j].Path
+	})
+	return matches, nil
+}
+
+// ScanDirs finds the media files under root like ScanRecords, but calls each with those of one directory
+// at a time, sorted by path, as soon as the directory and everything below it is scanned: directories
+// are passed deepest first, and those without media files are left out. Only the directories being
+// scanned are held in memory. An error returned by each stops the scan and is returned.
+func ScanDirs(ctx context.Context, fsys fs.FS, root string, opts Options, each func(records []Record) error) error {
 	if opts.MaxDepth < -1 {
-		return nil, fs.ErrInvalid
+		return fs.ErrInvalid
 	}
 
 	photoExts := normalizeExts(opts.PhotoExtensions)
 	videoExts := normalizeExts(opts.VideoExtensions)
+	sidecarExts := normalizeExts(opts.SidecarExtensions)
+	sidecarExtList := sortedKeys(sidecarExts)
+	excluded := make(map[string]bool, len(opts.ExcludeDirs))
+	for _, dir := range opts.ExcludeDirs {
+		excluded[path.Clean(dir)] = true
+	}
 
-	var matches []Record
+	var found int
+	var foundBytes int64
+	// open holds the directories being scanned, from root down to the one scanned last.
+	var open []*dirScan
+	// closeUntil passes the files of the open directories that p is not inside of to each; all of them
+	// for the empty p.
+	closeUntil := func(p string) error {
+		for len(open) > 0 && (p == "" || !open[len(open)-1].holds(p)) {
+			dir := open[len(open)-1]
+			open = open[:len(open)-1]
+			if records := dir.finish(photoExts, sidecarExtList); len(records) > 0 {
+				if err := each(records); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
 
 	err := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
+			return &errcode.FileError{Op: "scan", Path: path, Kind: errcode.ErrUnreadableSource, Err: err}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := closeUntil(path); err != nil {
 			return err
 		}
 		if d.IsDir() {
-			if opts.MaxDepth >= 0 {
+			if opts.IgnoreFile != "" {
+				if holds(fsys, path, opts.IgnoreFile) {
+					if path == root {
+						return fs.SkipAll
+					}
+					return fs.SkipDir
+				}
+			}
+			if opts.MaxDepth >= 0 || len(excluded) > 0 {
 				rel, relErr := filepath.Rel(root, path)
 				if relErr != nil {
 					return relErr
 				}
-				if rel == "." {
-					return nil
+				if rel != "." && excluded[filepath.ToSlash(rel)] {
+					return fs.SkipDir
 				}
-				if depth(rel) > opts.MaxDepth {
+				if rel != "." && opts.MaxDepth >= 0 && depth(rel) > opts.MaxDepth {
 					return fs.SkipDir
 				}
 			}
+			open = append(open, &dirScan{path: path, sidecars: make(map[string]string)})
 			return nil
 		}
 
@@ -88,31 +183,99 @@ func ScanRecords(fsys fs.FS, root string, opts Options) ([]Record, error) {
 			return nil
 		}
 
+		dir := open[len(open)-1]
 		ext := strings.ToLower(filepath.Ext(rel))
+		if sidecarExts[ext] {
+			p := filepath.ToSlash(rel)
+			dir.sidecars[strings.ToLower(p)] = p
+			return nil
+		}
 		if !(photoExts[ext] || videoExts[ext]) {
 			return nil
 		}
 
 		info, infoErr := d.Info()
 		if infoErr != nil {
-			return infoErr
+			return &errcode.FileError{Op: "stat", Path: path, Kind: errcode.ErrUnreadableSource, Err: infoErr}
 		}
 
-		matches = append(matches, Record{
+		dir.records = append(dir.records, Record{
 			Path:          filepath.ToSlash(rel),
 			FileSizeBytes: info.Size(),
 			ModTime:       info.ModTime(),
 		})
+		found++
+		if opts.OnFound != nil {
+			foundBytes += info.Size()
+			opts.OnFound(found, foundBytes)
+		}
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
+	// The root, and the directories the walk ended in, are still open.
+	return closeUntil("")
+}
 
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].Path < matches[j].Path
+// dirScan is a directory being scanned by ScanDirs: its media files and sidecars so far.
+type dirScan struct {
+	path     string
+	records  []Record
+	sidecars map[string]string // lower-cased path -> path
+}
+
+// holds reports whether the walked path p is inside the directory or is the directory.
+func (d *dirScan) holds(p string) bool {
+	return d.path == "." || p == d.path || strings.HasPrefix(p, d.path+"/")
+}
+
+// finish attaches the sidecars of the directory to its media files and returns them sorted by path.
+func (d *dirScan) finish(photoExts map[string]bool, sidecarExts []string) []Record {
+	if len(d.sidecars) > 0 {
+		// A sidecar belongs to one media file. Photos claim theirs first, so the AAE and XMP
+		// shared by the photo and video of a Live Photo travel with the photo.
+		claimed := make(map[string]bool)
+		for _, photos := range []bool{true, false} {
+			for i := range d.records {
+				if photoExts[strings.ToLower(path.Ext(d.records[i].Path))] == photos {
+					d.records[i].Sidecars = attachSidecars(d.records[i].Path, sidecarExts, d.sidecars, claimed)
+				}
+			}
+		}
+	}
+	sort.Slice(d.records, func(i, j int) bool {
+		return d.records[i].Path < d.records[j].Path
 	})
-	return matches, nil
+	return d.records
+}
+
+// attachSidecars returns the sidecars found next to the media file at p that no other media file
+// has claimed, and claims them.
+func attachSidecars(p string, exts []string, sidecars map[string]string, claimed map[string]bool) []string {
+	dir, name := path.Split(p)
+
+	var out []string
+	for _, candidate := range sidecar.Candidates(name, exts) {
+		key := strings.ToLower(dir + candidate)
+		found, ok := sidecars[key]
+		if !ok || claimed[key] {
+			continue
+		}
+		claimed[key] = true
+		out = append(out, found)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func normalizeExts(exts []string) map[string]bool {
@@ -137,3 +300,9 @@ func depth(rel string) int {
 	}
 	return strings.Count(filepath.ToSlash(rel), "/")
 }
+
+// holds reports whether the directory dir of fsys holds a file named name.
+func holds(fsys fs.FS, dir, name string) bool {
+	_, err := fs.Stat(fsys, path.Join(dir, name))
+	return err == nil
+}
@@ -1,6 +1,8 @@
 package scan
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
 	"testing/fstest"
@@ -42,7 +44,7 @@ func TestScan_MaxDepth(t *testing.T) {
 			opts := DefaultOptions()
 			opts.MaxDepth = tc.maxDepth
 
-			got, err := Scan(fsys, "root", opts)
+			got, err := Scan(context.Background(), fsys, "root", opts)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
@@ -61,7 +63,7 @@ func TestScan_IgnoresNonMedia(t *testing.T) {
 	}
 
 	opts := DefaultOptions()
-	got, err := Scan(fsys, "root", opts)
+	got, err := Scan(context.Background(), fsys, "root", opts)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -71,14 +73,187 @@ func TestScan_IgnoresNonMedia(t *testing.T) {
 	}
 }
 
+func TestScan_ExcludeDirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/a.jpg":                 &fstest.MapFile{Data: []byte("a")},
+		"root/library/b.jpg":         &fstest.MapFile{Data: []byte("b")},
+		"root/library/2024/c.jpg":    &fstest.MapFile{Data: []byte("c")},
+		"root/library-old/d.jpg":     &fstest.MapFile{Data: []byte("d")},
+		"root/sub/library/e.jpg":     &fstest.MapFile{Data: []byte("e")},
+		"root/sub/library/e.jpg.xmp": &fstest.MapFile{Data: []byte("x")},
+	}
+
+	opts := DefaultOptions()
+	opts.ExcludeDirs = []string{"library", "sub/library/"}
+	got, err := Scan(context.Background(), fsys, "root", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"a.jpg", "library-old/d.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected result\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestScan_IgnoreFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/a.jpg":                     &fstest.MapFile{Data: []byte("a")},
+		"root/albums/" + IgnoreFile:      &fstest.MapFile{},
+		"root/albums/b.jpg":              &fstest.MapFile{Data: []byte("b")},
+		"root/albums/2024/c.jpg":         &fstest.MapFile{Data: []byte("c")},
+		"root/2024/d.jpg":                &fstest.MapFile{Data: []byte("d")},
+		"root/2024/ignore/" + IgnoreFile: &fstest.MapFile{},
+		"root/2024/ignore/e.jpg":         &fstest.MapFile{Data: []byte("e")},
+		"other/" + IgnoreFile:            &fstest.MapFile{},
+		"other/f.jpg":                    &fstest.MapFile{Data: []byte("f")},
+	}
+
+	opts := DefaultOptions()
+	opts.IgnoreFile = IgnoreFile
+	got, err := Scan(context.Background(), fsys, "root", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"2024/d.jpg", "a.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected result\n got: %#v\nwant: %#v", got, want)
+	}
+
+	// A marked root is not scanned at all.
+	if got, err := Scan(context.Background(), fsys, "other", opts); err != nil || len(got) != 0 {
+		t.Fatalf("expected nothing in a marked root, got %#v, %v", got, err)
+	}
+}
+
+func TestScanRecords_OnFound(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/a.jpg":     &fstest.MapFile{Data: []byte("aa")},
+		"root/a.xmp":     &fstest.MapFile{Data: []byte("x")},
+		"root/b.txt":     &fstest.MapFile{Data: []byte("b")},
+		"root/sub/c.mov": &fstest.MapFile{Data: []byte("ccc")},
+	}
+
+	var files []int
+	var bytes []int64
+	opts := DefaultOptions()
+	opts.OnFound = func(n int, size int64) {
+		files = append(files, n)
+		bytes = append(bytes, size)
+	}
+	if _, err := ScanRecords(context.Background(), fsys, "root", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(files, []int{1, 2}) || !reflect.DeepEqual(bytes, []int64{2, 5}) {
+		t.Errorf("got files %v, bytes %v; want [1 2], [2 5]", files, bytes)
+	}
+}
+
 func TestScan_InvalidMaxDepth(t *testing.T) {
 	fsys := fstest.MapFS{}
 
 	opts := DefaultOptions()
 	opts.MaxDepth = -2
 
-	_, err := Scan(fsys, "root", opts)
+	_, err := Scan(context.Background(), fsys, "root", opts)
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestScanRecords_CanceledContext(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/a.jpg": &fstest.MapFile{Data: []byte("a")},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ScanRecords(ctx, fsys, "root", DefaultOptions()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestScanRecords_AttachesSidecars(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root/IMG_1.jpg":            &fstest.MapFile{Data: []byte("a")},
+		"root/IMG_1.xmp":            &fstest.MapFile{Data: []byte("x")},
+		"root/IMG_1.jpg.json":       &fstest.MapFile{Data: []byte("j")},
+		"root/IMG_2.mov":            &fstest.MapFile{Data: []byte("b")},
+		"root/orphan.xmp":           &fstest.MapFile{Data: []byte("o")},
+		"root/sub/IMG_1.AAE":        &fstest.MapFile{Data: []byte("e")},
+		"root/sub/IMG_1.heic":       &fstest.MapFile{Data: []byte("h")},
+		"root/other/IMG_2.xmp":      &fstest.MapFile{Data: []byte("y")},
+		"root/other/unrelated.md":   &fstest.MapFile{Data: []byte("z")},
+		"root/live/IMG_3.MOV":       &fstest.MapFile{Data: []byte("m")},
+		"root/live/IMG_3.HEIC":      &fstest.MapFile{Data: []byte("p")},
+		"root/live/IMG_3.AAE":       &fstest.MapFile{Data: []byte("r")},
+		"root/edit/IMG_1234.JPG":    &fstest.MapFile{Data: []byte("i")},
+		"root/edit/IMG_1234.AAE":    &fstest.MapFile{Data: []byte("k")},
+		"root/edit/IMG_O1234.AAE":   &fstest.MapFile{Data: []byte("l")},
+		"root/raw/DSC_0001.NEF":     &fstest.MapFile{Data: []byte("n")},
+		"root/raw/DSC_0001.NEF.xmp": &fstest.MapFile{Data: []byte("d")},
+		"root/raw/_MG_0002.CR3":     &fstest.MapFile{Data: []byte("c")},
+		"root/raw/_MG_0002.xmp":     &fstest.MapFile{Data: []byte("l")},
+	}
+
+	records, err := ScanRecords(context.Background(), fsys, "root", DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, r := range records {
+		got[r.Path] = r.Sidecars
+	}
+	want := map[string][]string{
+		"IMG_1.jpg":         {"IMG_1.jpg.json", "IMG_1.xmp"},
+		"IMG_2.mov":         nil,
+		"sub/IMG_1.heic":    {"sub/IMG_1.AAE"},
+		"live/IMG_3.HEIC":   {"live/IMG_3.AAE"},
+		"live/IMG_3.MOV":    nil,
+		"edit/IMG_1234.JPG": {"edit/IMG_1234.AAE", "edit/IMG_O1234.AAE"},
+		"raw/DSC_0001.NEF":  {"raw/DSC_0001.NEF.xmp"},
+		"raw/_MG_0002.CR3":  {"raw/_MG_0002.xmp"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected sidecars\n got: %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestScanDirs_PassesWholeDirectories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.jpg":          &fstest.MapFile{Data: []byte("a")},
+		"a.xmp":          &fstest.MapFile{Data: []byte("x")},
+		"sub/c.png":      &fstest.MapFile{Data: []byte("c")},
+		"sub/b.jpg":      &fstest.MapFile{Data: []byte("b")},
+		"sub/deep/d.mov": &fstest.MapFile{Data: []byte("d")},
+		"sub/notes.txt":  &fstest.MapFile{Data: []byte("n")},
+		"z/e.jpg":        &fstest.MapFile{Data: []byte("e")},
+		"empty/f.txt":    &fstest.MapFile{Data: []byte("f")},
+	}
+
+	var got [][]string
+	err := ScanDirs(context.Background(), fsys, ".", DefaultOptions(), func(records []Record) error {
+		var paths []string
+		for _, r := range records {
+			paths = append(paths, r.Path)
+		}
+		got = append(got, paths)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]string{{"sub/deep/d.mov"}, {"sub/b.jpg", "sub/c.png"}, {"z/e.jpg"}, {"a.jpg"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected directories\n got: %#v\nwant: %#v", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = ScanDirs(context.Background(), fsys, ".", DefaultOptions(), func([]Record) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected the scan to stop on the first error, got %v after %d calls", err, calls)
+	}
+}
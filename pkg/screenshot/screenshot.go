@@ -0,0 +1,134 @@
+// Package screenshot recognizes screenshots, so they can be kept out of the photo timeline even after
+// they were renamed: by the names screenshot tools give them, by the EXIF UserComment and Software tags
+// phones and desktop tools write, and by PNGs exactly the size of a common screen.
+package screenshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// reName matches the names of screenshots: Screenshot_20240102-030405.png (Android),
+// Screenshot 2024-01-02 at 03.04.05.png (macOS), Screen Shot 2020-01-02 at ... (older macOS).
+var reName = regexp.MustCompile(`(?i)^screen[ _-]?shot`)
+
+// FromName reports whether name is the name a screenshot tool gives its files.
+func FromName(name string) bool {
+	return reName.MatchString(filepath.Base(name))
+}
+
+// IsCandidate reports whether the file name is a JPEG or a PNG, the formats whose metadata is read.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Read reports whether the JPEG or PNG name, read from r, is a screenshot by its metadata: an EXIF
+// UserComment or Software tag, or a PNG text chunk, mentioning a screenshot (iOS writes the
+// UserComment "Screenshot", GNOME the Software "gnome-screenshot"), or a PNG without EXIF data the
+// size of a common phone, tablet or computer screen.
+func Read(r io.Reader, name string) (bool, error) {
+	if strings.EqualFold(filepath.Ext(name), ".png") {
+		return readPNG(r)
+	}
+	x, _ := exif.Decode(r)
+	if x == nil {
+		// Files without EXIF data are no screenshot by their metadata.
+		return false, nil
+	}
+	return exifMentions(x), nil
+}
+
+// exifMentions reports whether the UserComment or Software tag of x mentions a screenshot.
+func exifMentions(x *exif.Exif) bool {
+	for _, name := range []exif.FieldName{exif.UserComment, exif.Software} {
+		tag, err := x.Get(name)
+		if err == nil && mentions(tag.Val) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentions reports whether data mentions a screenshot, ignoring case.
+func mentions(data []byte) bool {
+	return bytes.Contains(bytes.ToLower(data), []byte("screenshot"))
+}
+
+// pngSignature starts every PNG.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// readPNG reports whether the PNG read from r is a screenshot. Only the chunks before the image data
+// are read.
+func readPNG(r io.Reader) (bool, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil || !bytes.Equal(sig[:], pngSignature) {
+		return false, nil
+	}
+	var width, height uint32
+	hasEXIF := false
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		kind := string(header[4:])
+		if kind == "IDAT" || kind == "IEND" || length > 1<<24 {
+			break
+		}
+		// The chunk data followed by its CRC.
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return false, err
+		}
+		data = data[:length]
+		switch kind {
+		case "IHDR":
+			if len(data) >= 8 {
+				width, height = binary.BigEndian.Uint32(data), binary.BigEndian.Uint32(data[4:])
+			}
+		case "tEXt", "iTXt":
+			// Text chunks hold a keyword such as Software or XML:com.adobe.xmp and its text.
+			if mentions(data) {
+				return true, nil
+			}
+		case "eXIf":
+			hasEXIF = true
+			if x, _ := exif.Decode(bytes.NewReader(data)); x != nil && exifMentions(x) {
+				return true, nil
+			}
+		}
+	}
+	return !hasEXIF && isScreenSize(width, height), nil
+}
+
+// screenSizes lists the resolutions, in pixels, of common screens in landscape orientation.
+var screenSizes = map[[2]uint32]bool{
+	// Computers.
+	{1280, 720}: true, {1280, 800}: true, {1366, 768}: true, {1440, 900}: true, {1536, 864}: true,
+	{1600, 900}: true, {1680, 1050}: true, {1920, 1080}: true, {1920, 1200}: true, {2560, 1080}: true,
+	{2560, 1440}: true, {2560, 1600}: true, {2880, 1800}: true, {3024, 1964}: true, {3440, 1440}: true,
+	{3456, 2234}: true, {3840, 2160}: true, {5120, 2880}: true,
+	// iPhones.
+	{1136, 640}: true, {1334, 750}: true, {1792, 828}: true, {2208, 1242}: true, {2436, 1125}: true,
+	{2532, 1170}: true, {2556, 1179}: true, {2688, 1242}: true, {2778, 1284}: true, {2796, 1290}: true,
+	// Android phones.
+	{2340, 1080}: true, {2400, 1080}: true, {3120, 1440}: true, {3200, 1440}: true,
+	// Tablets.
+	{2048, 1536}: true, {2224, 1668}: true, {2360, 1640}: true, {2388, 1668}: true, {2732, 2048}: true,
+}
+
+// isScreenSize reports whether width x height is the resolution of a common screen, in either orientation.
+func isScreenSize(width, height uint32) bool {
+	return screenSizes[[2]uint32{width, height}] || screenSizes[[2]uint32{height, width}]
+}
@@ -0,0 +1,73 @@
+package screenshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/quidome/media-organizer-go/internal/testjpeg"
+)
+
+// chunk returns a PNG chunk of kind holding data.
+func chunk(kind string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, kind...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+// png returns the chunks of a PNG of width x height up to its image data, with extra chunks.
+func png(width, height uint32, extra ...[]byte) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := append([]byte{}, pngSignature...)
+	data = append(data, chunk("IHDR", ihdr)...)
+	for _, c := range extra {
+		data = append(data, c...)
+	}
+	return append(data, chunk("IEND", nil)...)
+}
+
+// jpegWithSoftware returns a minimal JPEG whose EXIF block holds only the Software tag.
+func jpegWithSoftware(software string) []byte {
+	return testjpeg.WithEXIF([]testjpeg.Entry{testjpeg.ASCII(0x0131, software)}, nil, nil)
+}
+
+func TestFromName(t *testing.T) {
+	for _, name := range []string{"Screenshot_20240102-030405.png", "Screenshot 2024-01-02 at 03.04.05.png", "/tmp/Screen Shot 2020-01-02 at 03.04.05.png"} {
+		if !FromName(name) {
+			t.Errorf("FromName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"IMG_1234.PNG", "screens.jpg"} {
+		if FromName(name) {
+			t.Errorf("FromName(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"phone.png", png(1170, 2532), true},
+		{"desktop.png", png(1920, 1080), true},
+		{"landscape-phone.png", png(2532, 1170), true},
+		{"drawing.png", png(800, 600), false},
+		{"gnome.png", png(800, 600, chunk("tEXt", []byte("Software\x00gnome-screenshot"))), true},
+		{"photo.png", png(1920, 1080, chunk("eXIf", []byte("MM\x00\x2A\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"))), false},
+		{"renamed.jpg", jpegWithSoftware("Android Screenshot"), true},
+		{"photo.jpg", jpegWithSoftware("Adobe Lightroom"), false},
+		{"empty.jpg", []byte("not a jpeg"), false},
+	}
+	for _, tc := range tests {
+		got, err := Read(bytes.NewReader(tc.data), tc.name)
+		if err != nil || got != tc.want {
+			t.Errorf("Read(%s) = %v, %v; want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
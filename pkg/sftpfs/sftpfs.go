@@ -0,0 +1,258 @@
+// Package sftpfs implements destfs.FS over SFTP, so media can be organized from or to
+// a remote server without mounting it:
+//
+//	media-organizer organize sftp://user@host/DCIM /local/library
+//
+// Authentication uses the SSH agent (SSH_AUTH_SOCK), unencrypted default keys in ~/.ssh
+// and a password in the URL, in that order. Host keys are verified against ~/.ssh/known_hosts.
+package sftpfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// Scheme is the URL scheme handled by this package.
+const Scheme = "sftp"
+
+// Options configures the SSH connection.
+type Options struct {
+	// KnownHostsFile is the OpenSSH known_hosts file used to verify the server.
+	KnownHostsFile string
+
+	// KeyFiles are private keys tried for public key authentication; missing files are ignored.
+	KeyFiles []string
+
+	// AgentSocket is the SSH agent socket; empty disables the agent.
+	AgentSocket string
+
+	// Timeout limits establishing the connection.
+	Timeout time.Duration
+}
+
+// DefaultOptions returns the OpenSSH defaults of the current user.
+func DefaultOptions() Options {
+	home, _ := os.UserHomeDir()
+	sshDir := filepath.Join(home, ".ssh")
+	return Options{
+		KnownHostsFile: filepath.Join(sshDir, "known_hosts"),
+		KeyFiles: []string{
+			filepath.Join(sshDir, "id_ed25519"),
+			filepath.Join(sshDir, "id_ecdsa"),
+			filepath.Join(sshDir, "id_rsa"),
+		},
+		AgentSocket: os.Getenv("SSH_AUTH_SOCK"),
+		Timeout:     30 * time.Second,
+	}
+}
+
+// FS is a filesystem on an SFTP server. Names are absolute paths on the server.
+type FS struct {
+	client *sftp.Client
+	conn   *ssh.Client
+}
+
+var _ destfs.FS = (*FS)(nil)
+
+// New returns an FS using an established SFTP client. Close closes the client.
+func New(client *sftp.Client) *FS {
+	return &FS{client: client}
+}
+
+// Dial connects to the server of an sftp://[user[:password]@]host[:port]/path URL.
+// The path of the URL is not used; it is the root the caller organizes from or into.
+func Dial(ctx context.Context, u *url.URL, opts Options) (*FS, error) {
+	if u.Scheme != Scheme {
+		return nil, fmt.Errorf("sftp: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("sftp: missing host in %s", u.Redacted())
+	}
+
+	hostKeys, err := knownhosts.New(opts.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: load known hosts: %w", err)
+	}
+
+	user := u.User.Username()
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods(u, opts),
+		HostKeyCallback: hostKeys,
+		Timeout:         opts.Timeout,
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	dialer := net.Dialer{Timeout: opts.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: dial %s: %w", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, config)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("sftp: ssh handshake with %s: %w", addr, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sftp: start session on %s: %w", addr, err)
+	}
+	return &FS{client: client, conn: conn}, nil
+}
+
+func authMethods(u *url.URL, opts Options) []ssh.AuthMethod {
+	var methods []ssh.AuthMethod
+	if opts.AgentSocket != "" {
+		if sock, err := net.Dial("unix", opts.AgentSocket); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(sock).Signers))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, name := range opts.KeyFiles {
+		key, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		// Passphrase-protected keys are left to the agent.
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if password, ok := u.User.Password(); ok {
+		methods = append(methods, ssh.Password(password))
+	}
+	return methods
+}
+
+// Close closes the SFTP session and its SSH connection.
+func (f *FS) Close() error {
+	err := f.client.Close()
+	if f.conn != nil {
+		if connErr := f.conn.Close(); err == nil {
+			err = connErr
+		}
+	}
+	return err
+}
+
+// Stat implements destfs.FS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	info, err := f.client.Stat(remotePath(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// Open implements destfs.FS.
+func (f *FS) Open(name string) (destfs.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile implements destfs.FS.
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	p := remotePath(name)
+	file, err := f.client.OpenFile(p, flag)
+	if err != nil {
+		// Servers report an exclusive create of an existing file as a generic failure.
+		if flag&os.O_EXCL != 0 {
+			if _, statErr := f.client.Stat(p); statErr == nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+			}
+		}
+		return nil, pathError("open", name, err)
+	}
+	if flag&os.O_CREATE != 0 && perm != 0 {
+		// Best effort: some servers do not allow changing permissions.
+		_ = file.Chmod(perm)
+	}
+	return syncFile{file}, nil
+}
+
+// ReadDir implements destfs.FS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.client.ReadDir(remotePath(name))
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// MkdirAll implements destfs.FS.
+func (f *FS) MkdirAll(name string, _ fs.FileMode) error {
+	if err := f.client.MkdirAll(remotePath(name)); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// Remove implements destfs.FS.
+func (f *FS) Remove(name string) error {
+	if err := f.client.Remove(remotePath(name)); err != nil {
+		return pathError("remove", name, err)
+	}
+	return nil
+}
+
+// syncFile treats a server without fsync support as synced; the data has been handed to the server.
+type syncFile struct {
+	*sftp.File
+}
+
+func (f syncFile) Sync() error {
+	err := f.File.Sync()
+	var status *sftp.StatusError
+	if errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxOpUnsupported {
+		return nil
+	}
+	return err
+}
+
+// remotePath converts a pipeline path into an SFTP path, which always uses forward slashes.
+func remotePath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// pathError makes err match the io/fs sentinels and names the path it failed on.
+func pathError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,87 @@
+package sftpfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestFS connects an FS to an in-memory SFTP server.
+func newTestFS(t *testing.T) *FS {
+	t.Helper()
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	server := sftp.NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite}, sftp.InMemHandler())
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(client)
+	t.Cleanup(func() {
+		// Closing the server first ends the client's read loop.
+		server.Close()
+		f.Close()
+	})
+	return f
+}
+
+func TestFS_WriteReadAndList(t *testing.T) {
+	f := newTestFS(t)
+
+	if err := f.MkdirAll("/lib/2023/11", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := f.OpenFile("/lib/2023/11/a.jpg", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	w.Close()
+
+	if _, err := f.OpenFile("/lib/2023/11/a.jpg", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("exclusive create of existing file: got %v, want fs.ErrExist", err)
+	}
+	if _, err := f.Stat("/lib/2023/11/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat missing file: got %v, want fs.ErrNotExist", err)
+	}
+
+	r, err := f.Open("/lib/2023/11/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "data" {
+		t.Fatalf("read = %q, %v", got, err)
+	}
+
+	entries, err := f.ReadDir("/lib/2023/11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "a.jpg" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	if err := f.Remove("/lib/2023/11/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat("/lib/2023/11/a.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat removed file: got %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package sidecar associates companion files (XMP, AAE, JSON) with the media file they describe
+// and plans where they go when the media file is organized.
+package sidecar
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+	"github.com/quidome/media-organizer-go/pkg/plan"
+)
+
+// ErrMissing is reported for media files without a sidecar when the policy is PolicyRequire.
+var ErrMissing = errcode.New(errcode.SidecarMissing, "missing sidecar")
+
+// Policy controls how sidecars are handled when organizing.
+type Policy string
+
+const (
+	// PolicyCopy copies sidecars together with their media file.
+	PolicyCopy Policy = "copy"
+	// PolicySkip leaves sidecars behind.
+	PolicySkip Policy = "skip"
+	// PolicyRequire copies sidecars and refuses to organize media files that have none.
+	PolicyRequire Policy = "require"
+)
+
+// ParsePolicy converts a CLI value into a Policy.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(strings.ToLower(strings.TrimSpace(s))); p {
+	case PolicyCopy, PolicySkip, PolicyRequire:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid sidecar policy %q (want copy, skip or require)", s)
+	}
+}
+
+// DefaultExtensions lists the sidecar extensions recognized by default.
+func DefaultExtensions() []string {
+	return []string{".xmp", ".aae", ".json"}
+}
+
+// Candidates returns the sidecar filenames that may belong to mediaName, for each extension.
+//
+// Both naming conventions are covered: the extension replacing the media extension
+// (IMG_1234.xmp) and the extension appended to the full name (IMG_1234.jpg.xmp). An iPhone
+// photo that was edited may also have the AAE of its original, IMG_O1234.aae, named after the
+// photo the way DestinationPath renames it, such as 2024-01-02_030405_O.aae.
+func Candidates(mediaName string, exts []string) []string {
+	stem := strings.TrimSuffix(mediaName, filepath.Ext(mediaName))
+
+	out := make([]string, 0, 2*len(exts)+1)
+	for _, ext := range exts {
+		out = append(out, stem+ext, mediaName+ext)
+		if strings.EqualFold(ext, ".aae") {
+			out = append(out, originalStem(stem, "O")+ext)
+		}
+	}
+	return out
+}
+
+// reApple matches the stem of an iPhone photo, "IMG_1234".
+var reApple = regexp.MustCompile(`(?i)^IMG_\d{4}$`)
+
+// appleOriginalStem returns the stem iPhone exports give the AAE of the original of the photo with
+// the given stem, IMG_O1234 for IMG_1234, and whether stem is the stem of an iPhone photo.
+func appleOriginalStem(stem string) (string, bool) {
+	if !reApple.MatchString(stem) {
+		return "", false
+	}
+	return stem[:4] + "O" + stem[4:], true
+}
+
+// originalStem returns the stem for the AAE of the original of the photo with the given stem:
+// the marker o follows the IMG_ prefix of an iPhone-style stem, IMG_O1234_1 for IMG_1234_1, and
+// is appended to any other stem, 2024-01-02_030405_O for 2024-01-02_030405.
+func originalStem(stem, o string) string {
+	if hasPrefixFold(stem, "IMG_") {
+		return stem[:4] + o + stem[4:]
+	}
+	return stem + "_" + o
+}
+
+// DestinationPath returns where a sidecar goes when its media file is placed at mediaDst.
+//
+// The sidecar keeps its own suffix but follows any rename of the media file,
+// so IMG_1234.jpg.xmp travels with IMG_1234_1.jpg as IMG_1234_1.jpg.xmp and the AAE
+// of an iPhone original, IMG_O1234.aae, as IMG_O1234_1.aae, or as 2024-01-02_030405_O.aae
+// when the layout renames the photo to 2024-01-02_030405.
+func DestinationPath(mediaSrc, mediaDst, sidecarSrc string) string {
+	srcName := filepath.Base(mediaSrc)
+	dstName := filepath.Base(mediaDst)
+	name := filepath.Base(sidecarSrc)
+	dir := filepath.Dir(mediaDst)
+
+	if hasPrefixFold(name, srcName) {
+		return filepath.Join(dir, dstName+name[len(srcName):])
+	}
+
+	srcStem := strings.TrimSuffix(srcName, filepath.Ext(srcName))
+	dstStem := strings.TrimSuffix(dstName, filepath.Ext(dstName))
+	if hasPrefixFold(name, srcStem) {
+		return filepath.Join(dir, dstStem+name[len(srcStem):])
+	}
+	if apple, ok := appleOriginalStem(srcStem); ok && hasPrefixFold(name, apple) {
+		return filepath.Join(dir, originalStem(dstStem, name[4:5])+name[len(apple):])
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// Plan returns the copy operations for the sidecars of a media file placed at mediaDst.
+func Plan(mediaSrc, mediaDst string, sidecars []string) []plan.Operation {
+	if len(sidecars) == 0 {
+		return nil
+	}
+	ops := make([]plan.Operation, 0, len(sidecars))
+	for _, s := range sidecars {
+		ops = append(ops, plan.Operation{SourcePath: s, DestinationPath: DestinationPath(mediaSrc, mediaDst, s)})
+	}
+	return ops
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
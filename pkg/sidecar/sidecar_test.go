@@ -0,0 +1,79 @@
+package sidecar
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, in := range []string{"copy", "skip", "require", " Require "} {
+		if _, err := ParsePolicy(in); err != nil {
+			t.Fatalf("ParsePolicy(%q): unexpected error %v", in, err)
+		}
+	}
+	if _, err := ParsePolicy("move"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestDestinationPath_FollowsMediaRename(t *testing.T) {
+	mediaSrc := filepath.Join("/src", "IMG_1234.jpg")
+	mediaDst := filepath.Join("/dst", "2024", "01", "02", "IMG_1234_1.jpg")
+
+	tests := []struct {
+		sidecar string
+		want    string
+	}{
+		{"IMG_1234.xmp", "IMG_1234_1.xmp"},
+		{"IMG_1234.jpg.xmp", "IMG_1234_1.jpg.xmp"},
+		{"IMG_1234.JPG.json", "IMG_1234_1.jpg.json"},
+		{"IMG_1234.AAE", "IMG_1234_1.AAE"},
+		{"IMG_O1234.AAE", "IMG_O1234_1.AAE"},
+	}
+
+	for _, tt := range tests {
+		got := DestinationPath(mediaSrc, mediaDst, filepath.Join("/src", tt.sidecar))
+		want := filepath.Join("/dst", "2024", "01", "02", tt.want)
+		if got != want {
+			t.Errorf("DestinationPath(%s) = %s, want %s", tt.sidecar, got, want)
+		}
+	}
+}
+
+func TestDestinationPath_FollowsDateRename(t *testing.T) {
+	mediaSrc := filepath.Join("/src", "IMG_1234.HEIC")
+	mediaDst := filepath.Join("/dst", "2024", "2024-01-02_030405.heic")
+
+	tests := []struct {
+		sidecar string
+		want    string
+	}{
+		{"IMG_1234.AAE", "2024-01-02_030405.AAE"},
+		{"IMG_O1234.AAE", "2024-01-02_030405_O.AAE"},
+		{"IMG_1234.HEIC.xmp", "2024-01-02_030405.heic.xmp"},
+	}
+
+	for _, tt := range tests {
+		got := DestinationPath(mediaSrc, mediaDst, filepath.Join("/src", tt.sidecar))
+		want := filepath.Join("/dst", "2024", tt.want)
+		if got != want {
+			t.Errorf("DestinationPath(%s) = %s, want %s", tt.sidecar, got, want)
+		}
+	}
+}
+
+func TestCandidates_FindsRenamedOriginalAAE(t *testing.T) {
+	for media, want := range map[string]string{
+		"IMG_1234.HEIC":          "IMG_O1234.aae",
+		"IMG_1234_1.HEIC":        "IMG_O1234_1.aae",
+		"2024-01-02_030405.heic": "2024-01-02_030405_O.aae",
+	} {
+		found := false
+		for _, c := range Candidates(media, []string{".aae"}) {
+			found = found || c == want
+		}
+		if !found {
+			t.Errorf("Candidates(%s) = %v, want it to include %s", media, Candidates(media, []string{".aae"}), want)
+		}
+	}
+}
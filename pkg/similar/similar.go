@@ -0,0 +1,153 @@
+// Package similar recognizes near-duplicate photos: copies of a photo scaled to another resolution or
+// saved with another compression, whose bytes and image data differ from the original. Photos are
+// compared by a perceptual hash of their pixels (dHash), which such copies keep.
+package similar
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders of the formats IsCandidate accepts
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"path/filepath"
+	"strings"
+)
+
+// MaxDistance is the largest number of bits, of 64, in which the hashes of a photo and its near-duplicate
+// differ. Scaling and recompression change a few bits; another photo about half. It is below 8, which
+// Index relies on.
+const MaxDistance = 6
+
+// samples is the number of pixels averaged per side of each cell of the hash grid: large photos are
+// sampled rather than read pixel by pixel.
+const samples = 16
+
+// IsCandidate reports whether the file name is a photo format Image can decode: JPEG, PNG or GIF.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// Hash is the perceptual hash of a photo, with its size in pixels.
+type Hash struct {
+	DHash         uint64
+	Width, Height int
+}
+
+// Pixels returns the number of pixels of the photo of h.
+func (h Hash) Pixels() int { return h.Width * h.Height }
+
+// Distance returns the number of bits in which the hashes of h and o differ.
+func (h Hash) Distance(o Hash) int {
+	return bits.OnesCount64(h.DHash ^ o.DHash)
+}
+
+// Similar reports whether h and o are the hashes of the same photo: their hashes differ in at most
+// MaxDistance bits and their aspect ratios in at most 2%, the rounding of a scaled copy.
+func (h Hash) Similar(o Hash) bool {
+	if h.Distance(o) > MaxDistance || h.Height <= 0 || o.Height <= 0 {
+		return false
+	}
+	ratio := float64(h.Width) / float64(h.Height) / (float64(o.Width) / float64(o.Height))
+	return ratio > 0.98 && ratio < 1.02
+}
+
+// Image returns the hash of the photo read from r. The photo is scaled down to 9x8 gray cells, each the
+// mean of a grid of samples, and hashed by the difference of neighboring cells: one bit per pair of
+// horizontal neighbors, set when the left cell is brighter.
+func Image(r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return Hash{}, fmt.Errorf("decode image: %w", err)
+	}
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return Hash{}, errors.New("decode image: no pixels")
+	}
+
+	var cells [8][9]float64
+	for cy := range 8 {
+		for cx := range 9 {
+			x0, x1 := b.Min.X+cx*b.Dx()/9, b.Min.X+(cx+1)*b.Dx()/9
+			y0, y1 := b.Min.Y+cy*b.Dy()/8, b.Min.Y+(cy+1)*b.Dy()/8
+			cells[cy][cx] = mean(img, x0, max(x1, x0+1), y0, max(y1, y0+1))
+		}
+	}
+	var h uint64
+	for y := range 8 {
+		for x := range 8 {
+			h <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				h |= 1
+			}
+		}
+	}
+	return Hash{DHash: h, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// mean returns the mean gray level of up to samples x samples pixels spread over [x0, x1) x [y0, y1).
+func mean(img image.Image, x0, x1, y0, y1 int) float64 {
+	stepX, stepY := max((x1-x0)/samples, 1), max((y1-y0)/samples, 1)
+	var sum float64
+	n := 0
+	for y := y0 + stepY/2; y < y1; y += stepY {
+		for x := x0 + stepX/2; x < x1; x += stepX {
+			sum += gray(img, x, y)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// gray returns the gray level of the pixel of img at x, y, reading the luma of decoded JPEGs directly.
+func gray(img image.Image, x, y int) float64 {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return float64(m.Y[m.YOffset(x, y)])
+	case *image.Gray:
+		return float64(m.Pix[m.PixOffset(x, y)])
+	}
+	return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+}
+
+// Index finds, among the hashes added to it, one similar to a hash without comparing it with all of
+// them: hashes within MaxDistance bits of each other, fewer than 8, have at least one of their 8 bytes
+// in common, so only the hashes sharing a byte are compared.
+type Index struct {
+	hashes  []Hash
+	buckets [8]map[byte][]int
+}
+
+// Add adds h to the index and returns its number, counting from 0 in the order hashes are added.
+func (x *Index) Add(h Hash) int {
+	n := len(x.hashes)
+	x.hashes = append(x.hashes, h)
+	for i := range x.buckets {
+		if x.buckets[i] == nil {
+			x.buckets[i] = make(map[byte][]int)
+		}
+		b := byte(h.DHash >> (8 * i))
+		x.buckets[i][b] = append(x.buckets[i][b], n)
+	}
+	return n
+}
+
+// Find returns the number of the first hash added that is similar to h, and whether there is one.
+func (x *Index) Find(h Hash) (int, bool) {
+	found := -1
+	for i := range x.buckets {
+		for _, n := range x.buckets[i][byte(h.DHash>>(8*i))] {
+			if (found < 0 || n < found) && x.hashes[n].Similar(h) {
+				found = n
+			}
+		}
+	}
+	return found, found >= 0
+}
@@ -0,0 +1,84 @@
+package similar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// scene returns a photo of width x height pixels of a few soft shapes, mirrored when flip is set.
+func scene(width, height int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			if flip {
+				u = 1 - u
+			}
+			l := 128 + 60*math.Sin(6*u) + 50*math.Cos(9*v*u) - 40*v
+			img.Set(x, y, color.RGBA{R: uint8(l), G: uint8(l * 0.9), B: uint8(255 - l), A: 255})
+		}
+	}
+	return img
+}
+
+func hashOf(t *testing.T, encode func(*bytes.Buffer) error) Hash {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	h, err := Image(&buf)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	return h
+}
+
+func TestImage(t *testing.T) {
+	original := hashOf(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, scene(640, 480, false), &jpeg.Options{Quality: 95}) })
+	if original.Width != 640 || original.Height != 480 {
+		t.Errorf("size %dx%d, want 640x480", original.Width, original.Height)
+	}
+	smaller := hashOf(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, scene(320, 240, false), &jpeg.Options{Quality: 40}) })
+	if !original.Similar(smaller) {
+		t.Errorf("expected a scaled, recompressed copy to be similar (distance %d)", original.Distance(smaller))
+	}
+	asPNG := hashOf(t, func(b *bytes.Buffer) error { return png.Encode(b, scene(640, 480, false)) })
+	if !original.Similar(asPNG) {
+		t.Errorf("expected a PNG copy to be similar (distance %d)", original.Distance(asPNG))
+	}
+	other := hashOf(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, scene(640, 480, true), nil) })
+	if original.Similar(other) {
+		t.Errorf("expected another photo not to be similar (distance %d)", original.Distance(other))
+	}
+	cropped := hashOf(t, func(b *bytes.Buffer) error { return jpeg.Encode(b, scene(640, 360, false), nil) })
+	if original.Similar(cropped) {
+		t.Errorf("expected another aspect ratio not to be similar")
+	}
+
+	if _, err := Image(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("expected an error for data that is not an image")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	var x Index
+	a := Hash{DHash: 0x0123456789abcdef, Width: 4, Height: 3}
+	b := Hash{DHash: ^a.DHash, Width: 4, Height: 3}
+	x.Add(a)
+	x.Add(b)
+	if n, ok := x.Find(Hash{DHash: a.DHash ^ 0x0101010101010000, Width: 8, Height: 6}); !ok || n != 0 {
+		t.Errorf("Find = %d, %v; want 0", n, ok)
+	}
+	if n, ok := x.Find(Hash{DHash: b.DHash ^ 0x3f, Width: 4, Height: 3}); !ok || n != 1 {
+		t.Errorf("Find = %d, %v; want 1", n, ok)
+	}
+	if _, ok := x.Find(Hash{DHash: a.DHash ^ 0xff00ff00, Width: 4, Height: 3}); ok {
+		t.Error("expected a hash 16 bits away not to be found")
+	}
+}
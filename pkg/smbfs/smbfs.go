@@ -0,0 +1,185 @@
+// Package smbfs implements destfs.FS over SMB2/3, so Windows shares and NAS exports can be used
+// as source or destination without an OS-level mount:
+//
+//	media-organizer organize smb://alice@nas.local/photos/inbox /local/library
+//
+// The first path element of the URL is the share; the rest is the path within the share.
+// Authentication uses NTLM with the user, optional domain (smb://DOMAIN;user@host/share) and password.
+package smbfs
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+// Scheme is the URL scheme handled by this package.
+const Scheme = "smb"
+
+// Options configures the SMB connection.
+type Options struct {
+	// Password is used when the URL has none.
+	Password string
+
+	// Timeout limits establishing the connection.
+	Timeout time.Duration
+}
+
+// DefaultOptions returns the default connection options.
+func DefaultOptions() Options {
+	return Options{Timeout: 30 * time.Second}
+}
+
+// FS is a mounted SMB share. Names are absolute paths within the share.
+type FS struct {
+	share   *smb2.Share
+	session *smb2.Session
+	conn    net.Conn
+}
+
+var (
+	_ destfs.FS   = (*FS)(nil)
+	_ destfs.File = (*smb2.File)(nil)
+)
+
+// SharePath splits the path of an smb:// URL into the share name and the absolute path within the share.
+func SharePath(u *url.URL) (share, name string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("smb: missing share in %s", u.Redacted())
+	}
+	name = "/"
+	if len(parts) == 2 {
+		name = path.Clean("/" + parts[1])
+	}
+	return parts[0], name, nil
+}
+
+// Dial connects to the server of an smb://[[domain;]user[:password]@]host[:port]/share[/path] URL
+// and mounts its share. Requests are bound to ctx.
+func Dial(ctx context.Context, u *url.URL, opts Options) (*FS, error) {
+	if u.Scheme != Scheme {
+		return nil, fmt.Errorf("smb: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("smb: missing host in %s", u.Redacted())
+	}
+	shareName, _, err := SharePath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, user := "", u.User.Username()
+	if d, usr, ok := strings.Cut(user, ";"); ok {
+		domain, user = d, usr
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		password = opts.Password
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "445"
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	dialer := net.Dialer{Timeout: opts.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("smb: dial %s: %w", addr, err)
+	}
+	d := &smb2.Dialer{Initiator: &smb2.NTLMInitiator{User: user, Password: password, Domain: domain}}
+	session, err := d.DialContext(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("smb: log on to %s: %w", addr, err)
+	}
+	share, err := session.WithContext(ctx).Mount(shareName)
+	if err != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, fmt.Errorf("smb: mount %s: %w", shareName, err)
+	}
+	return &FS{share: share.WithContext(ctx), session: session, conn: conn}, nil
+}
+
+// Close unmounts the share and closes the connection.
+func (f *FS) Close() error {
+	err := f.share.Umount()
+	if logoffErr := f.session.Logoff(); err == nil {
+		err = logoffErr
+	}
+	if closeErr := f.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Stat implements destfs.FS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return f.share.Stat(sharePath(name))
+}
+
+// Open implements destfs.FS.
+func (f *FS) Open(name string) (destfs.File, error) {
+	file, err := f.share.Open(sharePath(name))
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// OpenFile implements destfs.FS.
+func (f *FS) OpenFile(name string, flag int, perm fs.FileMode) (destfs.File, error) {
+	file, err := f.share.OpenFile(sharePath(name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// ReadDir implements destfs.FS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.share.ReadDir(sharePath(name))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// MkdirAll implements destfs.FS.
+func (f *FS) MkdirAll(name string, perm fs.FileMode) error {
+	p := sharePath(name)
+	if p == "" {
+		// The root of the share always exists.
+		return nil
+	}
+	return f.share.MkdirAll(p, perm)
+}
+
+// Remove implements destfs.FS.
+func (f *FS) Remove(name string) error {
+	return f.share.Remove(sharePath(name))
+}
+
+// sharePath converts a pipeline path into a share-relative SMB path: backslash-separated,
+// without a leading separator, and empty for the root of the share.
+func sharePath(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	return strings.ReplaceAll(p, "/", `\`)
+}
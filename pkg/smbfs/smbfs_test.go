@@ -0,0 +1,47 @@
+package smbfs
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSharePath(t *testing.T) {
+	tests := []struct {
+		url, share, name string
+	}{
+		{"smb://nas/photos", "photos", "/"},
+		{"smb://nas/photos/", "photos", "/"},
+		{"smb://alice@nas/photos/inbox/2024", "photos", "/inbox/2024"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		share, name, err := SharePath(u)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if share != tt.share || name != tt.name {
+			t.Fatalf("%s: got (%q, %q), want (%q, %q)", tt.url, share, name, tt.share, tt.name)
+		}
+	}
+
+	u, _ := url.Parse("smb://nas/")
+	if _, _, err := SharePath(u); err == nil {
+		t.Fatalf("expected an error for a URL without share")
+	}
+}
+
+func TestSharePathConversion(t *testing.T) {
+	for in, want := range map[string]string{
+		"/":                   "",
+		"/inbox":              "inbox",
+		"/inbox/2024/a.jpg":   `inbox\2024\a.jpg`,
+		"/inbox/../other/b.x": `other\b.x`,
+	} {
+		if got := sharePath(in); got != want {
+			t.Errorf("sharePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
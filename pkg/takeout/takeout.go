@@ -0,0 +1,73 @@
+// Package takeout reads the album metadata of Google Takeout (Google Photos) exports.
+//
+// Takeout writes every album into its own directory with a metadata.json describing it;
+// the per-year "Photos from 2019" directories have none.
+package takeout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// AlbumMetadataName is the name of the album metadata file in an album directory.
+const AlbumMetadataName = "metadata.json"
+
+// albumMetadata covers both the current format and the older one nesting the title in albumData.
+type albumMetadata struct {
+	Title     string `json:"title"`
+	AlbumData struct {
+		Title string `json:"title"`
+	} `json:"albumData"`
+}
+
+// Album returns the title of the album stored in the slash-separated directory dir of fsys.
+// ok is false when dir has no album metadata or the metadata has no title.
+func Album(fsys fs.FS, dir string) (title string, ok bool, err error) {
+	name := path.Join(dir, AlbumMetadataName)
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read album metadata: %w", err)
+	}
+
+	var meta albumMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", false, fmt.Errorf("parse album metadata %s: %w", name, err)
+	}
+	title = strings.TrimSpace(meta.Title)
+	if title == "" {
+		title = strings.TrimSpace(meta.AlbumData.Title)
+	}
+	return title, title != "", nil
+}
+
+// Albums caches album lookups per directory.
+type Albums struct {
+	fsys  fs.FS
+	cache map[string]string
+}
+
+// NewAlbums returns an album lookup for the tree in fsys.
+func NewAlbums(fsys fs.FS) *Albums {
+	return &Albums{fsys: fsys, cache: make(map[string]string)}
+}
+
+// Of returns the album of the file at the slash-separated path p, or "" if it is not in an album.
+func (a *Albums) Of(p string) (string, error) {
+	dir := path.Dir(p)
+	if title, ok := a.cache[dir]; ok {
+		return title, nil
+	}
+	title, _, err := Album(a.fsys, dir)
+	if err != nil {
+		return "", err
+	}
+	a.cache[dir] = title
+	return title, nil
+}
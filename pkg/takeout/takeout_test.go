@@ -0,0 +1,37 @@
+package takeout
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestAlbums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Google Photos/Trip to Rome/metadata.json": {Data: []byte(`{"title": "Trip to Rome", "description": ""}`)},
+		"Google Photos/Trip to Rome/IMG_1.jpg":     {Data: []byte("a")},
+		"Google Photos/Old Album/metadata.json":    {Data: []byte(`{"albumData": {"title": "Old Album"}}`)},
+		"Google Photos/Old Album/IMG_2.jpg":        {Data: []byte("b")},
+		"Google Photos/Photos from 2019/IMG_3.jpg": {Data: []byte("c")},
+		"Google Photos/Broken/metadata.json":       {Data: []byte(`{`)},
+		"Google Photos/Broken/IMG_4.jpg":           {Data: []byte("d")},
+	}
+	albums := NewAlbums(fsys)
+
+	for p, want := range map[string]string{
+		"Google Photos/Trip to Rome/IMG_1.jpg":     "Trip to Rome",
+		"Google Photos/Old Album/IMG_2.jpg":        "Old Album",
+		"Google Photos/Photos from 2019/IMG_3.jpg": "",
+	} {
+		got, err := albums.Of(p)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %q, want %q", p, got, want)
+		}
+	}
+
+	if _, err := albums.Of("Google Photos/Broken/IMG_4.jpg"); err == nil {
+		t.Errorf("expected an error for malformed album metadata")
+	}
+}
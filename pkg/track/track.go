@@ -0,0 +1,277 @@
+// Package track correlates media with GPS tracks, such as the GPX files of a hiking GPS or a bike
+// computer and GeoJSON exports of a phone's location history: the position of the track at the time a
+// file was taken locates files without a GPS position of their own, and verifies the date of files with one.
+package track
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+)
+
+// Defaults of a Track.
+const (
+	// DefaultMaxGap is how far from the nearest fix a time may be to still be placed on the track.
+	DefaultMaxGap = 10 * time.Minute
+	// DefaultRadiusKm is how far the position of a file may be from the track at its time to agree with it.
+	DefaultRadiusKm = 1
+)
+
+// Fix is a position recorded at a time.
+type Fix struct {
+	Time  time.Time
+	Point geocode.Point
+}
+
+// Track is a set of fixes, read from any number of track files, in time order.
+type Track struct {
+	// MaxGap is how far from the nearest fix a time may be to be placed on the track. Between two fixes
+	// at most MaxGap apart the position is interpolated.
+	MaxGap time.Duration
+	// RadiusKm is how far a position may be from the track to agree with it (Verify).
+	RadiusKm float64
+
+	fixes []Fix
+}
+
+// New returns the track of fixes, with the default MaxGap and RadiusKm.
+func New(fixes []Fix) *Track {
+	fixes = append([]Fix(nil), fixes...)
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Time.Before(fixes[j].Time) })
+	return &Track{MaxGap: DefaultMaxGap, RadiusKm: DefaultRadiusKm, fixes: fixes}
+}
+
+// Load reads the track files at paths into one track: GPX (.gpx) and GeoJSON (.geojson, .json).
+func Load(paths ...string) (*Track, error) {
+	var fixes []Fix
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		read := ReadGPX
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".gpx":
+		case ".geojson", ".json":
+			read = ReadGeoJSON
+		default:
+			f.Close()
+			return nil, fmt.Errorf("track %s: unsupported format (want .gpx, .geojson or .json)", path)
+		}
+		more, err := read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("track %s: %w", path, err)
+		}
+		fixes = append(fixes, more...)
+	}
+	if len(fixes) == 0 {
+		return nil, errors.New("track: no timed positions found")
+	}
+	return New(fixes), nil
+}
+
+// Len returns the number of fixes of t.
+func (t *Track) Len() int { return len(t.fixes) }
+
+// At returns the position of t at time at, and false when at is more than MaxGap from the track.
+func (t *Track) At(at time.Time) (geocode.Point, bool) {
+	i := sort.Search(len(t.fixes), func(i int) bool { return !t.fixes[i].Time.Before(at) })
+	switch {
+	case len(t.fixes) == 0:
+		return geocode.Point{}, false
+	case i == 0:
+		return t.near(t.fixes[0], at)
+	case i == len(t.fixes):
+		return t.near(t.fixes[i-1], at)
+	}
+	prev, next := t.fixes[i-1], t.fixes[i]
+	if gap := next.Time.Sub(prev.Time); gap <= t.MaxGap && gap > 0 {
+		f := float64(at.Sub(prev.Time)) / float64(gap)
+		return geocode.Point{
+			Lat: prev.Point.Lat + f*(next.Point.Lat-prev.Point.Lat),
+			Lon: prev.Point.Lon + f*(next.Point.Lon-prev.Point.Lon),
+		}, true
+	}
+	if at.Sub(prev.Time) < next.Time.Sub(at) {
+		return t.near(prev, at)
+	}
+	return t.near(next, at)
+}
+
+// near returns the position of f when at is at most MaxGap from it.
+func (t *Track) near(f Fix, at time.Time) (geocode.Point, bool) {
+	if d := at.Sub(f.Time); d > t.MaxGap || d < -t.MaxGap {
+		return geocode.Point{}, false
+	}
+	return f.Point, true
+}
+
+// Verify reports whether t was within RadiusKm of p at time at. ok is false when at is not on the track,
+// so it cannot tell.
+func (t *Track) Verify(p geocode.Point, at time.Time) (agrees, ok bool) {
+	q, ok := t.At(at)
+	if !ok {
+		return false, false
+	}
+	return geocode.DistanceKm(p, q) <= t.RadiusKm, true
+}
+
+// gpxPoint is a track, route or waypoint of a GPX file.
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+}
+
+// ReadGPX reads the timed track points, route points and waypoints of a GPX file.
+func ReadGPX(r io.Reader) ([]Fix, error) {
+	var fixes []Fix
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return fixes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gpx: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "trkpt", "rtept", "wpt":
+		default:
+			continue
+		}
+		var p gpxPoint
+		if err := dec.DecodeElement(&p, &start); err != nil {
+			return nil, fmt.Errorf("gpx %s: %w", start.Name.Local, err)
+		}
+		if t, ok := parseTime(p.Time); ok {
+			fixes = append(fixes, Fix{Time: t, Point: geocode.Point{Lat: p.Lat, Lon: p.Lon}})
+		}
+	}
+}
+
+// geoJSON is a GeoJSON object: a feature collection, a feature or a geometry.
+type geoJSON struct {
+	Type        string                     `json:"type"`
+	Features    []geoJSON                  `json:"features"`
+	Geometry    *geoJSON                   `json:"geometry"`
+	Geometries  []geoJSON                  `json:"geometries"`
+	Coordinates json.RawMessage            `json:"coordinates"`
+	Properties  map[string]json.RawMessage `json:"properties"`
+}
+
+// ReadGeoJSON reads the timed positions of a GeoJSON file: Point features with a time or timestamp
+// property, and LineString and MultiLineString features with coordTimes (or times) properties, as
+// written by most GPX converters.
+func ReadGeoJSON(r io.Reader) ([]Fix, error) {
+	var g geoJSON
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, fmt.Errorf("geojson: %w", err)
+	}
+	var fixes []Fix
+	if err := g.fixes(nil, &fixes); err != nil {
+		return nil, fmt.Errorf("geojson: %w", err)
+	}
+	return fixes, nil
+}
+
+// fixes appends the timed positions of g to fixes; props are the properties of the feature g is the geometry of.
+func (g geoJSON) fixes(props map[string]json.RawMessage, fixes *[]Fix) error {
+	switch g.Type {
+	case "FeatureCollection":
+		for _, f := range g.Features {
+			if err := f.fixes(nil, fixes); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if g.Geometry != nil {
+			return g.Geometry.fixes(g.Properties, fixes)
+		}
+	case "GeometryCollection":
+		for _, geometry := range g.Geometries {
+			if err := geometry.fixes(props, fixes); err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var c []float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return fmt.Errorf("point: %w", err)
+		}
+		for _, key := range []string{"time", "timestamp"} {
+			var s string
+			if json.Unmarshal(props[key], &s) != nil {
+				continue
+			}
+			if t, ok := parseTime(s); ok && len(c) >= 2 {
+				*fixes = append(*fixes, Fix{Time: t, Point: geocode.Point{Lat: c[1], Lon: c[0]}})
+				break
+			}
+		}
+	case "LineString":
+		var c [][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return fmt.Errorf("line: %w", err)
+		}
+		var times []string
+		if json.Unmarshal(props["coordTimes"], &times) != nil {
+			_ = json.Unmarshal(props["times"], &times)
+		}
+		appendLine(c, times, fixes)
+	case "MultiLineString":
+		var c [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return fmt.Errorf("lines: %w", err)
+		}
+		var times [][]string
+		if json.Unmarshal(props["coordTimes"], &times) != nil {
+			_ = json.Unmarshal(props["times"], &times)
+		}
+		for i := range c {
+			if i < len(times) {
+				appendLine(c[i], times[i], fixes)
+			}
+		}
+	}
+	return nil
+}
+
+// appendLine appends the positions of a line with the times of its coordinates to fixes.
+func appendLine(coords [][]float64, times []string, fixes *[]Fix) {
+	for i, c := range coords {
+		if i >= len(times) || len(c) < 2 {
+			break
+		}
+		if t, ok := parseTime(times[i]); ok {
+			*fixes = append(*fixes, Fix{Time: t, Point: geocode.Point{Lat: c[1], Lon: c[0]}})
+		}
+	}
+}
+
+// parseTime parses the time of a fix: RFC 3339, or Unix milliseconds as some location history exports write.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), true
+	}
+	return time.Time{}, false
+}
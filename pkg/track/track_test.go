@@ -0,0 +1,121 @@
+package track
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/geocode"
+)
+
+const gpx = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="46.0" lon="14.0"><name>untimed</name></wpt>
+  <trk><trkseg>
+    <trkpt lat="46.3600" lon="14.0900"><ele>475</ele><time>2024-07-14T10:00:00Z</time></trkpt>
+    <trkpt lat="46.3700" lon="14.1100"><ele>480</ele><time>2024-07-14T10:10:00Z</time></trkpt>
+    <trkpt lat="46.5000" lon="14.3000"><time>2024-07-14T12:00:00Z</time></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+const geojson = `{"type": "FeatureCollection", "features": [
+  {"type": "Feature", "properties": {"coordTimes": ["2024-07-15T08:00:00Z", "2024-07-15T08:05:00Z"]},
+   "geometry": {"type": "LineString", "coordinates": [[4.88, 52.37, 0], [4.90, 52.38, 0]]}},
+  {"type": "Feature", "properties": {"time": "2024-07-16T09:00:00+02:00"},
+   "geometry": {"type": "Point", "coordinates": [2.35, 48.85]}}
+]}`
+
+func TestReadGPX(t *testing.T) {
+	fixes, err := ReadGPX(strings.NewReader(gpx))
+	if err != nil {
+		t.Fatalf("ReadGPX: %v", err)
+	}
+	if len(fixes) != 3 {
+		t.Fatalf("expected the 3 timed track points, got %+v", fixes)
+	}
+	if want := (Fix{time.Date(2024, 7, 14, 10, 10, 0, 0, time.UTC), geocode.Point{Lat: 46.37, Lon: 14.11}}); !fixes[1].Time.Equal(want.Time) || fixes[1].Point != want.Point {
+		t.Errorf("got %+v, want %+v", fixes[1], want)
+	}
+	if _, err := ReadGPX(strings.NewReader("<gpx><trk>")); err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	fixes, err := ReadGeoJSON(strings.NewReader(geojson))
+	if err != nil {
+		t.Fatalf("ReadGeoJSON: %v", err)
+	}
+	if len(fixes) != 3 {
+		t.Fatalf("expected 3 fixes, got %+v", fixes)
+	}
+	if fixes[0].Point != (geocode.Point{Lat: 52.37, Lon: 4.88}) || fixes[2].Point != (geocode.Point{Lat: 48.85, Lon: 2.35}) {
+		t.Errorf("expected latitude and longitude in GeoJSON order, got %+v", fixes)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"hike.gpx": gpx, "history.geojson": geojson, "notes.txt": ""} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr, err := Load(filepath.Join(dir, "history.geojson"), filepath.Join(dir, "hike.gpx"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if tr.Len() != 6 {
+		t.Errorf("expected the fixes of both files, got %d", tr.Len())
+	}
+	if _, err := Load(filepath.Join(dir, "notes.txt")); err == nil {
+		t.Errorf("expected an error for an unsupported format")
+	}
+}
+
+func TestAt(t *testing.T) {
+	fixes, err := ReadGPX(strings.NewReader(gpx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := New(fixes)
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	for _, tt := range []struct {
+		name string
+		at   string
+		want geocode.Point
+		ok   bool
+	}{
+		{"interpolated", "2024-07-14T10:05:00Z", geocode.Point{Lat: 46.365, Lon: 14.10}, true},
+		{"in another zone", "2024-07-14T12:05:00+02:00", geocode.Point{Lat: 46.365, Lon: 14.10}, true},
+		{"near the last fix of a gap", "2024-07-14T11:55:00Z", geocode.Point{Lat: 46.5, Lon: 14.3}, true},
+		{"in a gap", "2024-07-14T11:00:00Z", geocode.Point{}, false},
+		{"before the track", "2024-07-14T09:55:00Z", geocode.Point{Lat: 46.36, Lon: 14.09}, true},
+		{"after the track", "2024-07-14T13:00:00Z", geocode.Point{}, false},
+	} {
+		got, ok := tr.At(at(tt.at))
+		if ok != tt.ok || math.Abs(got.Lat-tt.want.Lat) > 1e-9 || math.Abs(got.Lon-tt.want.Lon) > 1e-9 {
+			t.Errorf("%s: got %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if agrees, ok := tr.Verify(geocode.Point{Lat: 46.366, Lon: 14.10}, at("2024-07-14T10:05:00Z")); !agrees || !ok {
+		t.Errorf("expected a nearby position to agree, got %v, %v", agrees, ok)
+	}
+	if agrees, ok := tr.Verify(geocode.Point{Lat: 52.37, Lon: 4.88}, at("2024-07-14T10:05:00Z")); agrees || !ok {
+		t.Errorf("expected a distant position to disagree, got %v, %v", agrees, ok)
+	}
+	if _, ok := tr.Verify(geocode.Point{Lat: 46.366, Lon: 14.10}, at("2024-07-20T10:05:00Z")); ok {
+		t.Errorf("expected a time off the track to be undecided")
+	}
+}
@@ -0,0 +1,65 @@
+//go:build unix
+
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// device returns the device of the file, or nearest existing parent directory, at path.
+func device(path string) (uint64, error) {
+	for {
+		var st syscall.Stat_t
+		err := syscall.Lstat(path, &st)
+		if err == nil {
+			return uint64(st.Dev), nil
+		}
+		parent := filepath.Dir(path)
+		if err != syscall.ENOENT || parent == path {
+			return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+		}
+		path = parent
+	}
+}
+
+// topDir returns the top directory of the mount holding the absolute path: its highest parent on
+// the same device.
+func topDir(path string) (string, error) {
+	dev, err := device(path)
+	if err != nil {
+		return "", err
+	}
+	top := filepath.Dir(path)
+	for top != filepath.Dir(top) {
+		parentDev, err := device(filepath.Dir(top))
+		if err != nil {
+			return "", err
+		}
+		if parentDev != dev {
+			break
+		}
+		top = filepath.Dir(top)
+	}
+	return top, nil
+}
+
+// sameDevice reports whether a and b are on one device.
+func sameDevice(a, b string) (bool, error) {
+	devA, err := device(a)
+	if err != nil {
+		return false, err
+	}
+	devB, err := device(b)
+	if err != nil {
+		return false, err
+	}
+	return devA == devB, nil
+}
+
+// userDir returns the per-user directory name of the trash of a mount, like ".Trash-1000".
+func userDir(prefix string) string {
+	return fmt.Sprintf("%s%d", prefix, os.Getuid())
+}
@@ -0,0 +1,41 @@
+//go:build darwin
+
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OS returns the trash of the Finder: ~/.Trash, or the .Trashes of the volume for files on another
+// device. The Finder cannot put its files back, as it records their origin in a private store.
+func OS() (Trash, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	return finder{home: filepath.Join(home, ".Trash")}, nil
+}
+
+type finder struct {
+	home string
+}
+
+func (t finder) Put(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	dir := t.home
+	if same, err := sameDevice(path, t.home); err != nil {
+		return fmt.Errorf("trash: %w", err)
+	} else if !same {
+		top, err := topDir(path)
+		if err != nil {
+			return fmt.Errorf("trash: %w", err)
+		}
+		dir = filepath.Join(top, ".Trashes", userDir(""))
+	}
+	return Dir{Path: dir}.Put(path)
+}
@@ -0,0 +1,95 @@
+//go:build unix && !darwin
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OS returns the trash of the desktop: the home trash of the freedesktop.org trash specification,
+// or the trash at the top of the mount for files on another device.
+func OS() (Trash, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return freedesktop{home: filepath.Join(data, "Trash")}, nil
+}
+
+// freedesktop is a trash of the freedesktop.org trash specification: files/ holds the files and
+// info/ a .trashinfo for each with its original path and when it was trashed.
+type freedesktop struct {
+	home string
+}
+
+func (t freedesktop) Put(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	dir, original := t.home, path
+	if same, err := sameDevice(path, t.home); err != nil {
+		return fmt.Errorf("trash: %w", err)
+	} else if !same {
+		top, err := topDir(path)
+		if err != nil {
+			return fmt.Errorf("trash: %w", err)
+		}
+		// A trash at the top of a mount records paths relative to that top.
+		dir = filepath.Join(top, userDir(".Trash-"))
+		original, _ = filepath.Rel(top, path)
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return fmt.Errorf("trash: %w", err)
+		}
+	}
+
+	info, name, err := reserve(filepath.Join(dir, "info"), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: original}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = move(path, filepath.Join(dir, "files", name))
+	}
+	if err != nil {
+		_ = os.Remove(info.Name())
+		return fmt.Errorf("trash: %w", err)
+	}
+	return nil
+}
+
+// reserve creates the .trashinfo of the first free name for base in dir: base, or base with a "_N"
+// suffix before its extension. The file is created exclusively, so the name is taken.
+func reserve(dir, base string) (*os.File, string, error) {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	name := base
+	for n := 1; ; n++ {
+		f, err := os.OpenFile(filepath.Join(dir, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			return f, name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, "", err
+		}
+		name = stem + "_" + strconv.Itoa(n) + ext
+	}
+}
@@ -0,0 +1,40 @@
+//go:build unix && !darwin
+
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOS_PutsIntoHomeTrash(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	src := filepath.Join(data, "photos", "a b.jpg")
+	writeFile(t, src, "a")
+
+	bin, err := OS()
+	if err != nil {
+		t.Fatalf("OS: %v", err)
+	}
+	if err := bin.Put(src); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("source still exists: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(data, "Trash", "files", "a b.jpg")); err != nil || string(got) != "a" {
+		t.Fatalf("trashed file = %q, %v", got, err)
+	}
+	info, err := os.ReadFile(filepath.Join(data, "Trash", "info", "a b.jpg.trashinfo"))
+	if err != nil {
+		t.Fatalf("read trashinfo: %v", err)
+	}
+	want := "[Trash Info]\nPath=" + strings.ReplaceAll(src, " ", "%20") + "\nDeletionDate="
+	if !strings.HasPrefix(string(info), want) {
+		t.Fatalf("trashinfo = %q, want prefix %q", info, want)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !(windows && (amd64 || arm64))
+
+package trash
+
+// OS returns ErrUnsupported: there is no trash this package can reach on this platform.
+func OS() (Trash, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,83 @@
+//go:build windows && (amd64 || arm64)
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSHFileOperationW = windows.NewLazySystemDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// The operation and flags of SHFileOperationW that delete to the Recycle Bin without asking.
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+// shFileOpStruct is the SHFILEOPSTRUCTW of the shell, in its 64-bit layout.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// OS returns the Recycle Bin, through the shell. It only takes files on fixed drives: the shell
+// deletes files on network and removable drives for good instead.
+func OS() (Trash, error) {
+	if err := procSHFileOperationW.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	return recycleBin{}, nil
+}
+
+type recycleBin struct{}
+
+func (recycleBin) Put(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(path) + `\`)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	if windows.GetDriveType(root) != windows.DRIVE_FIXED {
+		return fmt.Errorf("trash: %s: the Recycle Bin only takes files on fixed drives", path)
+	}
+	// pFrom is a list of paths, ended by an empty one.
+	from, err := windows.UTF16FromString(path)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofNoErrorUI | fofSilent,
+	}
+	if code, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op))); code != 0 {
+		return fmt.Errorf("trash: %s: SHFileOperation failed with code %#x", path, code)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return fmt.Errorf("trash: %s: the shell aborted moving it to the Recycle Bin", path)
+	}
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("trash: %s: still present after moving it to the Recycle Bin", path)
+	}
+	return nil
+}
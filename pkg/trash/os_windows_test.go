@@ -0,0 +1,36 @@
+//go:build windows && (amd64 || arm64)
+
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOS_PutsIntoRecycleBin(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "a.jpg")
+	writeFile(t, src, "a")
+
+	bin, err := OS()
+	if err != nil {
+		t.Fatalf("OS: %v", err)
+	}
+	if err := bin.Put(src); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("source still exists: %v", err)
+	}
+}
+
+func TestOS_RefusesNetworkFiles(t *testing.T) {
+	bin, err := OS()
+	if err != nil {
+		t.Fatalf("OS: %v", err)
+	}
+	if err := bin.Put(`\\nas\photos\a.jpg`); err == nil || !strings.Contains(err.Error(), "fixed drives") {
+		t.Fatalf("Put of a network file = %v, want it refused", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package trash moves the files a run removes into a trash instead of deleting them: the sources of
+// moved files and the copies an undo reverts. The trash is either that of the operating system, where
+// the desktop can restore them, or a directory below the destination that keeps one subdirectory per
+// run.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirName is the directory below a destination that holds its trash unless another is given.
+const DirName = ".trash"
+
+// ErrUnsupported is returned by OS on platforms without a supported trash.
+var ErrUnsupported = errors.New("no trash on this platform")
+
+// Trash takes the local files a run would otherwise delete.
+type Trash interface {
+	// Put moves the file at path into the trash.
+	Put(path string) error
+}
+
+// Dir is a trash directory. Files below Root keep their path relative to it; others, and all files
+// when Root is empty, keep their name. A name already taken gets a "_N" suffix.
+type Dir struct {
+	Path string
+	Root string
+}
+
+// DestinationDir returns the trash directory of a run started at started that writes to destination:
+// a directory per run in dir below destination, or in DirName when dir is empty.
+func DestinationDir(destination, dir string, started time.Time) string {
+	if dir == "" {
+		dir = DirName
+	}
+	return filepath.Join(destination, dir, started.Format("20060102T150405"))
+}
+
+// Put moves the file at path into d.
+func (d Dir) Put(path string) error {
+	name := filepath.Base(path)
+	if d.Root != "" {
+		if rel, err := filepath.Rel(d.Root, path); err == nil && filepath.IsLocal(rel) {
+			name = rel
+		}
+	}
+	target := filepath.Join(d.Path, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	target, err := unique(target)
+	if err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	if err := move(path, target); err != nil {
+		return fmt.Errorf("trash: %w", err)
+	}
+	return nil
+}
+
+// Parse returns the trash of a CLI value: "os" is the trash of the operating system, "destination"
+// a Dir in dir below destination (DestinationDir) for the run started at started. The empty string is
+// no trash, nil.
+func Parse(s, destination, dir string, started time.Time) (Trash, error) {
+	if dir != "" && !filepath.IsLocal(dir) {
+		return nil, fmt.Errorf("trash directory %q is not inside the destination", dir)
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return nil, nil
+	case "os":
+		t, err := OS()
+		if err != nil {
+			return nil, fmt.Errorf("%w: use --trash destination", err)
+		}
+		return t, nil
+	case "destination":
+		return Dir{Path: DestinationDir(destination, dir, started), Root: destination}, nil
+	default:
+		return nil, fmt.Errorf("invalid trash %q (want os or destination)", s)
+	}
+}
+
+// unique returns path, or path with the first "_N" suffix before its extension that names no file.
+func unique(path string) (string, error) {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+		path = stem + "_" + strconv.Itoa(n) + ext
+	}
+}
+
+// move renames src to dst, or copies it and removes src when they are on different filesystems.
+func move(src, dst string) error {
+	err := os.Rename(src, dst)
+	var linkErr *os.LinkError
+	if err == nil || !errors.As(err, &linkErr) {
+		return err
+	}
+	if _, statErr := os.Lstat(src); statErr != nil {
+		return err
+	}
+	if copyErr := copyFile(src, dst); copyErr != nil {
+		return fmt.Errorf("%w (copy: %w)", err, copyErr)
+	}
+	if err := os.Remove(src); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// copyFile copies the file at src to the new file dst, with its mode and modification time.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
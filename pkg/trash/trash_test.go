@@ -0,0 +1,91 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDir_Put_KeepsPathBelowRoot(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "2024", "01", "a.jpg")
+	writeFile(t, src, "a")
+	outside := filepath.Join(t.TempDir(), "b.jpg")
+	writeFile(t, outside, "b")
+
+	d := Dir{Path: DestinationDir(root, "", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), Root: root}
+	for _, path := range []string{src, outside} {
+		if err := d.Put(path); err != nil {
+			t.Fatalf("Put(%s): %v", path, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists: %v", path, err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(root, ".trash", "20240102T030405", "2024", "01", "a.jpg"): "a",
+		filepath.Join(root, ".trash", "20240102T030405", "b.jpg"):               "b",
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q, %v; want %q", path, got, err, want)
+		}
+	}
+}
+
+func TestDir_Put_KeepsTakenNames(t *testing.T) {
+	d := Dir{Path: filepath.Join(t.TempDir(), "trash")}
+	for _, content := range []string{"first", "second"} {
+		src := filepath.Join(t.TempDir(), "a.jpg")
+		writeFile(t, src, content)
+		if err := d.Put(src); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	for name, want := range map[string]string{"a.jpg": "first", "a_1.jpg": "second"} {
+		got, err := os.ReadFile(filepath.Join(d.Path, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, err := Parse("", "/lib", "", started); got != nil || err != nil {
+		t.Fatalf(`Parse("") = %v, %v; want nil`, got, err)
+	}
+	got, err := Parse("destination", "/lib", "", started)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := (Dir{Path: filepath.Join("/lib", ".trash", "20240102T030405"), Root: "/lib"}); got != want {
+		t.Fatalf("Parse(destination) = %+v, want %+v", got, want)
+	}
+	got, err = Parse("destination", "/lib", "Trash/removed", started)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := (Dir{Path: filepath.Join("/lib", "Trash", "removed", "20240102T030405"), Root: "/lib"}); got != want {
+		t.Fatalf("Parse(destination) in another directory = %+v, want %+v", got, want)
+	}
+	if _, err := Parse("bin", "/lib", "", started); err == nil {
+		t.Fatal("expected an error for an unknown trash")
+	}
+	if _, err := Parse("destination", "/lib", "../trash", started); err == nil {
+		t.Fatal("expected an error for a trash directory outside the destination")
+	}
+}
@@ -0,0 +1,343 @@
+// Package tui provides an interactive terminal frontend for an organize run.
+//
+// The model shows live pipeline stages, a scrolling decision log and the failures of the run,
+// and asks for confirmation before anything is written to the destination.
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+// stages lists the pipeline stages in display order.
+var stages = []string{
+	progress.StageScan,
+	progress.StageAttribute,
+	progress.StageDedupe,
+	progress.StagePlan,
+	progress.StageReconcile,
+	progress.StageCopy,
+}
+
+// PlanFunc computes the decisions of a dry-run, reporting progress to r.
+type PlanFunc func(r progress.Reporter) ([]reconcile.Decision, error)
+
+// ExecuteFunc carries out the copy decisions in place, reporting progress to r.
+type ExecuteFunc func(decisions []reconcile.Decision, r progress.Reporter) error
+
+type phase int
+
+const (
+	phasePlanning phase = iota
+	phaseConfirm
+	phaseExecuting
+	phaseDone
+)
+
+type progressMsg progress.Event
+
+type plannedMsg struct {
+	decisions []reconcile.Decision
+	err       error
+}
+
+type executedMsg struct {
+	err error
+}
+
+// channelReporter forwards progress events to the model.
+type channelReporter chan progress.Event
+
+func (c channelReporter) Report(e progress.Event) { c <- e }
+
+// Model is the bubbletea model of an interactive organize run.
+type Model struct {
+	title   string
+	plan    PlanFunc
+	execute ExecuteFunc
+	events  channelReporter
+
+	phase     phase
+	stages    map[string]progress.Event
+	decisions []reconcile.Decision
+	executed  bool
+	err       error
+
+	offset int
+	height int
+	width  int
+}
+
+// New returns a model that plans with plan and, after confirmation, executes with execute.
+func New(title string, plan PlanFunc, execute ExecuteFunc) *Model {
+	return &Model{
+		title:   title,
+		plan:    plan,
+		execute: execute,
+		events:  make(channelReporter, 256),
+		stages:  make(map[string]progress.Event),
+		height:  24,
+		width:   80,
+	}
+}
+
+// Executed reports whether the user confirmed and the copy stage ran.
+func (m *Model) Executed() bool { return m.executed }
+
+// Decisions returns the decisions of the run, updated by the copy stage when executed.
+func (m *Model) Decisions() []reconcile.Decision { return m.decisions }
+
+// Err returns the error that aborted the run, if any.
+func (m *Model) Err() error { return m.err }
+
+// Init implements tea.Model.
+func (m *Model) Init() tea.Cmd {
+	plan, events := m.plan, m.events
+	return tea.Batch(
+		m.waitForEvent(),
+		func() tea.Msg {
+			decisions, err := plan(events)
+			return plannedMsg{decisions: decisions, err: err}
+		},
+	)
+}
+
+func (m *Model) waitForEvent() tea.Cmd {
+	events := m.events
+	return func() tea.Msg { return progressMsg(<-events) }
+}
+
+// Update implements tea.Model.
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height, m.width = msg.Height, msg.Width
+		m.clampOffset()
+		return m, nil
+
+	case progressMsg:
+		m.stages[msg.Stage] = progress.Event(msg)
+		return m, m.waitForEvent()
+
+	case plannedMsg:
+		m.decisions = msg.decisions
+		if msg.err != nil {
+			m.err = msg.err
+			m.phase = phaseDone
+			return m, nil
+		}
+		m.phase = phaseConfirm
+		if m.pendingCopies() == 0 {
+			m.phase = phaseDone
+		}
+		return m, nil
+
+	case executedMsg:
+		m.executed = true
+		m.err = msg.err
+		m.phase = phaseDone
+		return m, nil
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "q", "esc":
+		if m.phase != phaseExecuting {
+			return m, tea.Quit
+		}
+	case "n":
+		if m.phase == phaseConfirm {
+			return m, tea.Quit
+		}
+	case "y":
+		if m.phase == phaseConfirm {
+			m.phase = phaseExecuting
+			execute, decisions, events := m.execute, m.decisions, m.events
+			return m, func() tea.Msg {
+				return executedMsg{err: execute(decisions, events)}
+			}
+		}
+	case "up", "k":
+		m.offset--
+	case "down", "j":
+		m.offset++
+	case "pgup":
+		m.offset -= m.logHeight()
+	case "pgdown", " ":
+		m.offset += m.logHeight()
+	case "home", "g":
+		m.offset = 0
+	case "end", "G":
+		m.offset = len(m.decisions)
+	}
+	m.clampOffset()
+	return m, nil
+}
+
+// View implements tea.Model.
+func (m *Model) View() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s — %s\n\n", m.title, m.status())
+
+	for _, stage := range stages {
+		e, ok := m.stages[stage]
+		marker := "·"
+		switch {
+		case ok && e.Finished():
+			marker = "✓"
+		case ok:
+			marker = "▸"
+		}
+		line := fmt.Sprintf(" %s %-10s", marker, stage)
+		switch {
+		case ok && e.Total == 0 && !e.Finished():
+			line += fmt.Sprintf(" %d found", e.Done)
+		case ok:
+			line += fmt.Sprintf(" %d/%d", e.Done, e.Total)
+			if e.TotalBytes > 0 {
+				line += fmt.Sprintf("  %s/%s", progress.FormatBytes(e.Bytes), progress.FormatBytes(e.TotalBytes))
+			}
+			if e.Current != "" && e.Done < e.Total {
+				line += "  " + e.Current
+			}
+		}
+		b.WriteString(truncate(line, m.width) + "\n")
+	}
+
+	fmt.Fprintf(&b, "\nDecisions (%d)  ↑/↓ PgUp/PgDn to scroll\n", len(m.decisions))
+	end := m.offset + m.logHeight()
+	if end > len(m.decisions) {
+		end = len(m.decisions)
+	}
+	for _, d := range m.decisions[m.offset:end] {
+		b.WriteString(truncate("  "+decisionLine(d), m.width) + "\n")
+	}
+
+	failures := m.failures()
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\nFailures (%d)\n", len(failures))
+		for i, d := range failures {
+			if i == maxFailureLines {
+				fmt.Fprintf(&b, "  … %d more\n", len(failures)-maxFailureLines)
+				break
+			}
+			b.WriteString(truncate(fmt.Sprintf("  %s: %v", d.SourcePath, d.Error), m.width) + "\n")
+		}
+	}
+
+	b.WriteString("\n" + m.help() + "\n")
+	return b.String()
+}
+
+const maxFailureLines = 5
+
+func (m *Model) status() string {
+	switch m.phase {
+	case phasePlanning:
+		return "planning (dry-run)"
+	case phaseConfirm:
+		return "plan ready"
+	case phaseExecuting:
+		return "copying"
+	default:
+		if m.err != nil {
+			return "aborted: " + m.err.Error()
+		}
+		if m.executed {
+			return "done"
+		}
+		return "nothing to copy"
+	}
+}
+
+func (m *Model) help() string {
+	switch m.phase {
+	case phaseConfirm:
+		return fmt.Sprintf("[y] execute %d copies  [n/q] quit without copying", m.pendingCopies())
+	case phaseExecuting:
+		return "copying… [ctrl+c] abort"
+	case phaseDone:
+		return "[q] quit"
+	default:
+		return "[q] quit"
+	}
+}
+
+func (m *Model) pendingCopies() int {
+	n := 0
+	for _, d := range m.decisions {
+		if d.Action == reconcile.ActionCopy || d.Action == reconcile.ActionCopyRenamed {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Model) failures() []reconcile.Decision {
+	var out []reconcile.Decision
+	for _, d := range m.decisions {
+		if d.Action == reconcile.ActionFailed {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// logHeight is the number of decision lines that fit on screen.
+func (m *Model) logHeight() int {
+	// Title, stages, headers, failures and help take the remaining lines.
+	h := m.height - len(stages) - 6
+	if len(m.failures()) > 0 {
+		h -= maxFailureLines + 3
+	}
+	if h < 3 {
+		h = 3
+	}
+	return h
+}
+
+func (m *Model) clampOffset() {
+	maxOffset := len(m.decisions) - m.logHeight()
+	if m.offset > maxOffset {
+		m.offset = maxOffset
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+}
+
+func decisionLine(d reconcile.Decision) string {
+	switch d.Action {
+	case reconcile.ActionSkippedDuplicateSrc:
+		return fmt.Sprintf("%-24s %s (duplicate of %s)", d.Action, d.SourcePath, d.DuplicateOf)
+	case reconcile.ActionSkippedVersion:
+		return fmt.Sprintf("%-24s %s (other version of %s)", d.Action, d.SourcePath, d.DuplicateOf)
+	case reconcile.ActionSkippedBurst:
+		return fmt.Sprintf("%-24s %s (burst shot, best is %s)", d.Action, d.SourcePath, d.DuplicateOf)
+	case reconcile.ActionFailed:
+		return fmt.Sprintf("%-24s %s", d.Action, d.SourcePath)
+	default:
+		return fmt.Sprintf("%-24s %s -> %s", d.Action, d.SourcePath, d.FinalDestinationPath)
+	}
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 1 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
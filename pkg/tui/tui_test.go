@@ -0,0 +1,92 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/quidome/media-organizer-go/pkg/progress"
+	"github.com/quidome/media-organizer-go/pkg/reconcile"
+)
+
+func key(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestModel_ConfirmExecutes(t *testing.T) {
+	decisions := []reconcile.Decision{
+		{SourcePath: "/src/a.jpg", FinalDestinationPath: "/dst/2024/a.jpg", Action: reconcile.ActionCopy},
+		{SourcePath: "/src/b.jpg", Action: reconcile.ActionFailed, Error: errors.New("boom")},
+	}
+	var executed bool
+	m := New("test", nil, func(ds []reconcile.Decision, r progress.Reporter) error {
+		executed = true
+		ds[0].Action = reconcile.ActionCopied
+		return nil
+	})
+
+	m.Update(progressMsg{Stage: progress.StageScan, Done: 2, Total: 2})
+	m.Update(plannedMsg{decisions: decisions})
+
+	view := m.View()
+	for _, want := range []string{"plan ready", "/src/a.jpg -> /dst/2024/a.jpg", "Failures (1)", "boom", "[y] execute 1 copies"} {
+		if !strings.Contains(view, want) {
+			t.Fatalf("view missing %q:\n%s", want, view)
+		}
+	}
+
+	_, cmd := m.Update(key("y"))
+	if cmd == nil {
+		t.Fatal("expected execute command")
+	}
+	m.Update(cmd())
+	if !executed || !m.Executed() {
+		t.Fatal("expected execute to run after confirmation")
+	}
+	if m.Decisions()[0].Action != reconcile.ActionCopied {
+		t.Fatalf("decisions not updated: %+v", m.Decisions()[0])
+	}
+	if !strings.Contains(m.View(), "done") {
+		t.Fatalf("expected done status:\n%s", m.View())
+	}
+}
+
+func TestModel_DeclineQuits(t *testing.T) {
+	m := New("test", nil, func([]reconcile.Decision, progress.Reporter) error {
+		t.Fatal("execute must not run when declined")
+		return nil
+	})
+	m.Update(plannedMsg{decisions: []reconcile.Decision{{SourcePath: "a", Action: reconcile.ActionCopy}}})
+
+	_, cmd := m.Update(key("n"))
+	if cmd == nil {
+		t.Fatal("expected quit command")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Fatal("expected tea.QuitMsg")
+	}
+	if m.Executed() {
+		t.Fatal("model reports executed after decline")
+	}
+}
+
+func TestModel_ScrollIsClamped(t *testing.T) {
+	m := New("test", nil, nil)
+	var decisions []reconcile.Decision
+	for i := 0; i < 100; i++ {
+		decisions = append(decisions, reconcile.Decision{SourcePath: "src", Action: reconcile.ActionSkippedIdentical})
+	}
+	m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	m.Update(plannedMsg{decisions: decisions})
+
+	m.Update(tea.KeyMsg{Type: tea.KeyUp})
+	if m.offset != 0 {
+		t.Fatalf("offset = %d, want 0", m.offset)
+	}
+	m.Update(key("G"))
+	if want := len(decisions) - m.logHeight(); m.offset != want {
+		t.Fatalf("offset = %d, want %d", m.offset, want)
+	}
+}
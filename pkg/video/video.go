@@ -0,0 +1,246 @@
+// Package video reads the technical metadata of MP4 and QuickTime videos: their resolution, duration,
+// codec and creation time, from the movie header and the first video track of the moov box.
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Info is the technical metadata of a video.
+type Info struct {
+	// Width and Height are the display size of the first video track in pixels, with the rotation
+	// phones record for portrait videos applied, so a portrait video is taller than wide.
+	Width  int
+	Height int
+
+	Duration time.Duration
+
+	// Codec names the video codec, such as "h264", "hevc" or "prores", or is the sample entry
+	// type of the track for codecs without a name here.
+	Codec string
+
+	// CreatedAt is the creation time recorded in the movie header, in UTC, or zero when none is.
+	CreatedAt time.Time
+}
+
+// Resolution returns the display size as "WIDTHxHEIGHT", such as "1920x1080", or "" when unknown.
+func (i Info) Resolution() string {
+	if i.Width == 0 || i.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", i.Width, i.Height)
+}
+
+// IsCandidate reports whether the file name is an MP4 or QuickTime video, the formats read.
+func IsCandidate(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".mp4", ".mov", ".m4v", ".3gp":
+		return true
+	}
+	return false
+}
+
+// maxMoovSize bounds the movie box read into memory; real ones are a few megabytes at most.
+const maxMoovSize = 64 << 20
+
+// Read returns the metadata of the video read from r. ok is false when r is not an MP4 or QuickTime
+// file or has no movie header. The media data is skipped, with Seek when r is an io.Seeker.
+func Read(r io.Reader) (Info, bool, error) {
+	for {
+		kind, size, err := readHeader(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errInvalidBox) {
+			return Info{}, false, nil
+		}
+		if err != nil {
+			return Info{}, false, err
+		}
+		if kind != "moov" {
+			if size < 0 {
+				// The last box runs to the end of the file.
+				return Info{}, false, nil
+			}
+			if err := skip(r, size); err != nil {
+				return Info{}, false, nil
+			}
+			continue
+		}
+		if size < 0 || size > maxMoovSize {
+			return Info{}, false, nil
+		}
+		moov := make([]byte, size)
+		if _, err := io.ReadFull(r, moov); err != nil {
+			return Info{}, false, nil
+		}
+		return parseMoov(moov)
+	}
+}
+
+// errInvalidBox reports a box header with an impossible size, as read from a file that is not a video.
+var errInvalidBox = errors.New("invalid box size")
+
+// readHeader reads a box header and returns the box type and the size of its body, or -1 when the
+// box runs to the end of the file.
+func readHeader(r io.Reader) (string, int64, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	kind := string(header[4:])
+	switch size {
+	case 0:
+		return kind, -1, nil
+	case 1:
+		var large [8]byte
+		if _, err := io.ReadFull(r, large[:]); err != nil {
+			return "", 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(large[:])) - 16
+	default:
+		size -= 8
+	}
+	if size < 0 {
+		return "", 0, errInvalidBox
+	}
+	return kind, size, nil
+}
+
+// skip skips n bytes of r.
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(n, io.SeekCurrent)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// boxes returns the bodies of the boxes of type kind among the boxes of data.
+func boxes(data []byte, kind string) [][]byte {
+	var found [][]byte
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		header := 8
+		if size == 1 && len(data) >= 16 {
+			size, header = int(binary.BigEndian.Uint64(data[8:])), 16
+		}
+		if size == 0 {
+			size = len(data)
+		}
+		if size < header || size > len(data) {
+			break
+		}
+		if string(data[4:8]) == kind {
+			found = append(found, data[header:size])
+		}
+		data = data[size:]
+	}
+	return found
+}
+
+// box returns the body of the box at path, such as "mdia/hdlr", below data.
+func box(data []byte, path string) []byte {
+	for _, kind := range strings.Split(path, "/") {
+		found := boxes(data, kind)
+		if len(found) == 0 {
+			return nil
+		}
+		data = found[0]
+	}
+	return data
+}
+
+// parseMoov reads the movie header and the first video track of a moov box body.
+func parseMoov(moov []byte) (Info, bool, error) {
+	mvhd := box(moov, "mvhd")
+	if len(mvhd) < 20 {
+		return Info{}, false, nil
+	}
+	var info Info
+	var created, timescale, duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return Info{}, false, nil
+		}
+		created = binary.BigEndian.Uint64(mvhd[4:])
+		timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[20:])), binary.BigEndian.Uint64(mvhd[24:])
+	} else {
+		created = uint64(binary.BigEndian.Uint32(mvhd[4:]))
+		timescale, duration = uint64(binary.BigEndian.Uint32(mvhd[12:])), uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	}
+	info.CreatedAt = movieTime(created)
+	if timescale > 0 && duration != 0xFFFFFFFF && duration != 0xFFFFFFFFFFFFFFFF {
+		info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+	for _, trak := range boxes(moov, "trak") {
+		if hdlr := box(trak, "mdia/hdlr"); len(hdlr) < 12 || string(hdlr[8:12]) != "vide" {
+			continue
+		}
+		info.Width, info.Height = trackSize(box(trak, "tkhd"))
+		if stsd := box(trak, "mdia/minf/stbl/stsd"); len(stsd) >= 16 {
+			info.Codec = codecName(string(stsd[12:16]))
+		}
+		break
+	}
+	return info, true, nil
+}
+
+// epoch is the time movie header times count the seconds from.
+var epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// movieTime returns the time secs seconds after epoch, or zero for 0, which cameras without a clock
+// write, and for times too far off to be meant.
+func movieTime(secs uint64) time.Time {
+	// Beyond 2^33 seconds, around the year 2176, the value is garbage.
+	if secs == 0 || secs >= 1<<33 {
+		return time.Time{}
+	}
+	return epoch.Add(time.Duration(secs) * time.Second)
+}
+
+// trackSize returns the display size in a tkhd box body, swapped for a track rotated by 90 or 270 degrees.
+func trackSize(tkhd []byte) (width, height int) {
+	matrix, size := 40, 76
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		matrix, size = 52, 88
+	}
+	if len(tkhd) < size+8 {
+		return 0, 0
+	}
+	// The sizes are 16.16 fixed-point numbers.
+	width = int(binary.BigEndian.Uint32(tkhd[size:]) >> 16)
+	height = int(binary.BigEndian.Uint32(tkhd[size+4:]) >> 16)
+	// The first entries of the transformation matrix are cos and sin of the rotation: a is 0 for
+	// rotations by 90 and 270 degrees.
+	if a := tkhd[matrix : matrix+4]; bytes.Equal(a, []byte{0, 0, 0, 0}) {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// codecs names the video codecs by the type of their sample entry.
+var codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264",
+	"hvc1": "hevc", "hev1": "hevc",
+	"av01": "av1",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"apch": "prores", "apcn": "prores", "apcs": "prores", "apco": "prores", "ap4h": "prores", "ap4x": "prores",
+	"mjpa": "mjpeg", "mjpb": "mjpeg", "jpeg": "mjpeg",
+	"s263": "h263",
+}
+
+// codecName returns the name of the codec with sample entry type kind.
+func codecName(kind string) string {
+	if name, ok := codecs[kind]; ok {
+		return name
+	}
+	return strings.TrimSpace(kind)
+}
@@ -0,0 +1,110 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+// mp4Box returns a box of kind holding the concatenated bodies.
+func mp4Box(kind string, bodies ...[]byte) []byte {
+	var body []byte
+	for _, b := range bodies {
+		body = append(body, b...)
+	}
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(body)+8))
+	data = append(data, kind...)
+	return append(data, body...)
+}
+
+// movie returns an MP4 with a video track of width x height, rotated by 90 degrees when portrait,
+// lasting duration units of timescale, with the codec sample entry type, and its moov after the media data.
+func movie(width, height uint32, portrait bool, timescale, duration uint32, codec string) []byte {
+	bo := binary.BigEndian
+	mvhd := make([]byte, 20)
+	bo.PutUint32(mvhd[12:], timescale)
+	bo.PutUint32(mvhd[16:], duration)
+
+	tkhd := make([]byte, 84)
+	if portrait {
+		bo.PutUint32(tkhd[44:], 0x00010000)
+		bo.PutUint32(tkhd[48:], 0xFFFF0000)
+	} else {
+		bo.PutUint32(tkhd[40:], 0x00010000)
+		bo.PutUint32(tkhd[56:], 0x00010000)
+	}
+	bo.PutUint32(tkhd[76:], width<<16)
+	bo.PutUint32(tkhd[80:], height<<16)
+
+	soundHdlr := append(make([]byte, 8), "soun"...)
+	videHdlr := append(make([]byte, 8), "vide"...)
+	stsd := append(make([]byte, 8), mp4Box(codec)...)
+
+	audio := mp4Box("trak", mp4Box("tkhd", make([]byte, 84)), mp4Box("mdia", mp4Box("hdlr", soundHdlr)))
+	video := mp4Box("trak",
+		mp4Box("tkhd", tkhd),
+		mp4Box("mdia", mp4Box("hdlr", videHdlr), mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd)))),
+	)
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom")),
+		mp4Box("mdat", make([]byte, 1000)),
+		mp4Box("moov", mp4Box("mvhd", mvhd), audio, video),
+	}, nil)
+}
+
+// reader hides the Seek method of a bytes.Reader.
+type reader struct{ io.Reader }
+
+func TestRead(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		want Info
+	}{
+		"landscape": {movie(3840, 2160, false, 600, 1500, "hvc1"), Info{Width: 3840, Height: 2160, Duration: 2500 * time.Millisecond, Codec: "hevc"}},
+		"portrait":  {movie(1920, 1080, true, 1000, 61000, "avc1"), Info{Width: 1080, Height: 1920, Duration: 61 * time.Second, Codec: "h264"}},
+		"unknown":   {movie(640, 480, false, 30, 90, "xyz1"), Info{Width: 640, Height: 480, Duration: 3 * time.Second, Codec: "xyz1"}},
+	}
+	for name, tc := range tests {
+		for _, r := range []io.Reader{bytes.NewReader(tc.data), reader{bytes.NewReader(tc.data)}} {
+			got, ok, err := Read(r)
+			if err != nil || !ok || got != tc.want {
+				t.Errorf("%s: got %+v, %v, %v; want %+v", name, got, ok, err, tc.want)
+			}
+		}
+	}
+	if got := tests["portrait"].want.Resolution(); got != "1080x1920" {
+		t.Errorf("Resolution() = %q", got)
+	}
+}
+
+func TestRead_NotAVideo(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"text":    []byte("not a video at all"),
+		"no moov": mp4Box("ftyp", []byte("isom")),
+		"empty":   nil,
+	} {
+		if _, ok, err := Read(bytes.NewReader(data)); ok || err != nil {
+			t.Errorf("%s: got %v, %v; want not ok", name, ok, err)
+		}
+	}
+}
+
+func TestRead_CreationTime(t *testing.T) {
+	data := movie(1920, 1080, false, 600, 600, "avc1")
+	mvhd := bytes.Index(data, []byte("mvhd")) + 4
+	want := time.Date(2023, 7, 14, 18, 30, 5, 0, time.UTC)
+	binary.BigEndian.PutUint32(data[mvhd+4:], uint32(want.Sub(epoch)/time.Second))
+
+	got, ok, err := Read(bytes.NewReader(data))
+	if err != nil || !ok || !got.CreatedAt.Equal(want) {
+		t.Fatalf("got %v, %v, %v; want %v", got.CreatedAt, ok, err, want)
+	}
+
+	// Cameras without a clock write zero, which is no creation time at all.
+	got, _, _ = Read(bytes.NewReader(movie(1920, 1080, false, 600, 600, "avc1")))
+	if !got.CreatedAt.IsZero() {
+		t.Errorf("unset creation time: got %v, want zero", got.CreatedAt)
+	}
+}
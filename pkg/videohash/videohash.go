@@ -0,0 +1,109 @@
+// Package videohash recognizes re-encoded copies of a video, such as the ones WhatsApp and cloud services
+// make at a lower bitrate, whose bytes differ from the original: by their duration, and by perceptual
+// hashes of frames sampled with ffmpeg.
+package videohash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// DurationTolerance is the largest difference between the durations of a video and its re-encoded
+	// copy: re-encoding keeps the frames, but the container may round the duration to its audio track.
+	DurationTolerance = 200 * time.Millisecond
+
+	// Samples is the number of frames hashed per video, evenly spread over its duration.
+	Samples = 5
+
+	// MaxDistance is the largest mean number of bits, of 64, in which the frame hashes of a video and its
+	// re-encoded copy differ. Scaling and compression artifacts change a few bits; other footage about half.
+	MaxDistance = 10
+)
+
+// ErrNoFFmpeg is returned by Frames when ffmpeg is not found in PATH.
+var ErrNoFFmpeg = errors.New("ffmpeg not found in PATH")
+
+// Hash holds the perceptual hashes of the sampled frames of a video, in the order they are shown.
+type Hash []uint64
+
+// Distance returns the mean number of bits in which the frame hashes of h and o differ, or -1 when they
+// do not hash the same number of frames.
+func (h Hash) Distance(o Hash) int {
+	if len(h) == 0 || len(h) != len(o) {
+		return -1
+	}
+	total := 0
+	for i := range h {
+		total += bits.OnesCount64(h[i] ^ o[i])
+	}
+	return total / len(h)
+}
+
+// Similar reports whether h and o are the frame hashes of the same footage.
+func (h Hash) Similar(o Hash) bool {
+	d := h.Distance(o)
+	return d >= 0 && d <= MaxDistance
+}
+
+// SimilarDuration reports whether a and b are durations a video and its re-encoded copy can have.
+func SimilarDuration(a, b time.Duration) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	return (a - b).Abs() <= DurationTolerance
+}
+
+// Available reports whether ffmpeg is found in PATH, so Frames can hash videos.
+func Available() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// frameSize is the size of a frame as ffmpeg writes it for hashing: 9x8 pixels of 8-bit gray.
+const frameSize = 9 * 8
+
+// Frames returns the frame hashes of the video at path, whose duration is duration. Each frame is scaled
+// down to 9x8 gray pixels by ffmpeg and hashed by the difference of neighboring pixels (dHash), which
+// survives scaling, a lower bitrate and a different codec.
+func Frames(ctx context.Context, path string, duration time.Duration) (Hash, error) {
+	if !Available() {
+		return nil, ErrNoFFmpeg
+	}
+	h := make(Hash, 0, Samples)
+	for n := range Samples {
+		at := duration * time.Duration(2*n+1) / (2 * Samples)
+		out, err := exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-v", "error",
+			"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64), "-i", path,
+			"-frames:v", "1", "-vf", "scale=9:8,format=gray", "-f", "rawvideo", "-").Output()
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg %s: %w", path, err)
+		}
+		if len(out) < frameSize {
+			return nil, fmt.Errorf("ffmpeg %s: no frame at %s", path, at)
+		}
+		h = append(h, dHash(out[:frameSize]))
+	}
+	return h, nil
+}
+
+// dHash returns the difference hash of 9x8 gray pixels: one bit per pair of horizontal neighbors, set
+// when the left pixel is brighter.
+func dHash(pixels []byte) uint64 {
+	var h uint64
+	for y := range 8 {
+		row := pixels[y*9 : y*9+9]
+		for x := range 8 {
+			h <<= 1
+			if row[x] > row[x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
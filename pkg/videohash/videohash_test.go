@@ -0,0 +1,68 @@
+package videohash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDHash(t *testing.T) {
+	// Every row falls from left to right, so every left pixel is brighter.
+	falling := bytes.Repeat([]byte{90, 80, 70, 60, 50, 40, 30, 20, 10}, 8)
+	if got := dHash(falling); got != ^uint64(0) {
+		t.Errorf("falling: %016x", got)
+	}
+	rising := bytes.Repeat([]byte{10, 20, 30, 40, 50, 60, 70, 80, 90}, 8)
+	if got := dHash(rising); got != 0 {
+		t.Errorf("rising: %016x", got)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	a := Hash{0, 0xFF, 0xFFFF}
+	if !a.Similar(Hash{1, 0xFE, 0xFFFF}) {
+		t.Error("expected hashes a few bits apart to be similar")
+	}
+	if a.Similar(Hash{^uint64(0), 0xFF, 0xFFFF}) {
+		t.Error("expected a different frame to count")
+	}
+	if a.Similar(Hash{0, 0xFF}) || a.Similar(nil) {
+		t.Error("expected hashes of a different number of frames to differ")
+	}
+
+	if !SimilarDuration(10*time.Second, 10*time.Second+150*time.Millisecond) {
+		t.Error("expected durations 150ms apart to be similar")
+	}
+	if SimilarDuration(10*time.Second, 11*time.Second) || SimilarDuration(0, 0) {
+		t.Error("unexpected similar durations")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	// A stand-in ffmpeg that writes the same falling frame for every timestamp.
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor i in 1 2 3 4 5 6 7 8; do printf 'ZPF<2(\\036\\024\\012'; done\n"
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	h, err := Frames(context.Background(), "clip.mp4", 10*time.Second)
+	if err != nil {
+		t.Fatalf("Frames: %v", err)
+	}
+	if len(h) != Samples || h[0] != ^uint64(0) {
+		t.Errorf("unexpected hash %x", h)
+	}
+}
+
+func TestFrames_NoFFmpeg(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := Frames(context.Background(), "clip.mp4", time.Second); !errors.Is(err, ErrNoFFmpeg) {
+		t.Errorf("expected ErrNoFFmpeg, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package volume splits a library across several destination volumes, such as external disks for
+// cold storage, with a size cap each.
+//
+// Whole top-level folders of the layout (a year, or a month of a year) are assigned to volumes in
+// order, so every volume holds a contiguous range of them and no folder spans two volumes.
+package volume
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/quidome/media-organizer-go/pkg/errcode"
+)
+
+// ErrFull is reported for the files of a folder no volume has room left for.
+var ErrFull = errcode.New(errcode.VolumeFull, "no volume has room for the folder")
+
+// Volume is a destination root with a cap on the bytes a run copies to it.
+type Volume struct {
+	// Path is the root of the volume, such as the mount point of a disk.
+	Path string
+	// Capacity is the number of bytes a run may copy to the volume.
+	Capacity int64
+}
+
+// Parse parses a CLI value PATH=SIZE, such as /mnt/disk1=2TB. See ParseSize for SIZE.
+func Parse(value string) (Volume, error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return Volume{}, fmt.Errorf("invalid volume %q (want PATH=SIZE, e.g. /mnt/disk1=2TB)", value)
+	}
+	size, err := ParseSize(value[i+1:])
+	if err != nil {
+		return Volume{}, fmt.Errorf("invalid volume %q: %w", value, err)
+	}
+	return Volume{Path: value[:i], Capacity: size}, nil
+}
+
+// units are the size suffixes of ParseSize. Decimal units are powers of 1000, as disks are sold;
+// binary units (KiB, MiB, ...) powers of 1024.
+var units = map[string]float64{
+	"": 1, "B": 1,
+	"K": 1e3, "KB": 1e3, "M": 1e6, "MB": 1e6, "G": 1e9, "GB": 1e9, "T": 1e12, "TB": 1e12, "P": 1e15, "PB": 1e15,
+	"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30, "TIB": 1 << 40, "PIB": 1 << 50,
+}
+
+// ParseSize parses a positive size in bytes with an optional unit, such as 500GB, 1.5T or 4TiB.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := units[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500GB, 2TB or 4TiB)", s)
+	}
+	return int64(n * unit), nil
+}
+
+// Split selects the folders that are kept whole on one volume.
+type Split string
+
+const (
+	// SplitYear keeps the top-level folders of the layout, the years of the default layout, whole.
+	SplitYear Split = "year"
+	// SplitMonth keeps the folders one level deeper, the months of a year in the default layout, whole.
+	SplitMonth Split = "month"
+)
+
+// ParseSplit converts a CLI value into a Split.
+func ParseSplit(s string) (Split, error) {
+	switch sp := Split(strings.ToLower(strings.TrimSpace(s))); sp {
+	case SplitYear, SplitMonth:
+		return sp, nil
+	default:
+		return "", fmt.Errorf("invalid volume split %q (want year or month)", s)
+	}
+}
+
+// Folder returns the folder of the slash-separated destination-relative file path rel that split
+// keeps whole: its first directory, or its first two for SplitMonth. A file directly in the root
+// has the folder ".".
+func (s Split) Folder(rel string) string {
+	depth := 1
+	if s == SplitMonth {
+		depth = 2
+	}
+	dirs := strings.Split(path.Dir(rel), "/")
+	if len(dirs) > depth {
+		dirs = dirs[:depth]
+	}
+	return strings.Join(dirs, "/")
+}
+
+// Folder is a folder to place on a volume.
+type Folder struct {
+	// Path is slash-separated and relative to the volume root.
+	Path string
+	// Bytes is the size of the files to copy into it.
+	Bytes int64
+}
+
+// Assign returns the index into volumes of the volume each folder goes to, or -1 for a folder no
+// volume has room left for. A folder found in existing, a map of folder path to volume index, stays on
+// the volume already holding it. The others are assigned in the order of their paths, each to the
+// first volume with room that is not before the volume of the previous folder, so earlier years fill
+// earlier volumes.
+func Assign(folders []Folder, volumes []Volume, existing map[string]int) []int {
+	assigned := make([]int, len(folders))
+	used := make([]int64, len(volumes))
+	order := make([]int, 0, len(folders))
+	for i, f := range folders {
+		if v, ok := existing[f.Path]; ok {
+			assigned[i] = v
+			used[v] += f.Bytes
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return folders[order[a]].Path < folders[order[b]].Path })
+
+	current := 0
+	for _, i := range order {
+		assigned[i] = -1
+		for v := current; v < len(volumes); v++ {
+			if used[v]+folders[i].Bytes <= volumes[v].Capacity {
+				assigned[i], current = v, v
+				used[v] += folders[i].Bytes
+				break
+			}
+		}
+	}
+	return assigned
+}
@@ -0,0 +1,68 @@
+package volume
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Volume
+		wantErr bool
+	}{
+		{"/mnt/disk1=2TB", Volume{Path: "/mnt/disk1", Capacity: 2e12}, false},
+		{"/mnt/a=b=500g", Volume{Path: "/mnt/a=b", Capacity: 500e9}, false},
+		{"D:\\=1.5T", Volume{Path: "D:\\", Capacity: 1.5e12}, false},
+		{"/mnt/disk1=4TiB", Volume{Path: "/mnt/disk1", Capacity: 4 << 40}, false},
+		{"/mnt/disk1=1024", Volume{Path: "/mnt/disk1", Capacity: 1024}, false},
+		{"/mnt/disk1", Volume{}, true},
+		{"=2TB", Volume{}, true},
+		{"/mnt/disk1=", Volume{}, true},
+		{"/mnt/disk1=0", Volume{}, true},
+		{"/mnt/disk1=2XB", Volume{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSplit_Folder(t *testing.T) {
+	tests := []struct {
+		split Split
+		rel   string
+		want  string
+	}{
+		{SplitYear, "2024/06/15/a.jpg", "2024"},
+		{SplitMonth, "2024/06/15/a.jpg", "2024/06"},
+		{SplitMonth, "unknown/a.jpg", "unknown"},
+		{SplitYear, "a.jpg", "."},
+	}
+	for _, tt := range tests {
+		if got := tt.split.Folder(tt.rel); got != tt.want {
+			t.Errorf("%s.Folder(%q) = %q, want %q", tt.split, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	volumes := []Volume{{Path: "/a", Capacity: 100}, {Path: "/b", Capacity: 100}}
+	folders := []Folder{
+		{Path: "2024", Bytes: 50},
+		{Path: "2020", Bytes: 60},
+		{Path: "2021", Bytes: 25},
+		// Too large for the room left on the first volume; later years do not go back to it.
+		{Path: "2022", Bytes: 40},
+		{Path: "2023", Bytes: 5},
+		// Already on the first volume.
+		{Path: "2019", Bytes: 10},
+		{Path: "2025", Bytes: 200},
+	}
+	got := Assign(folders, volumes, map[string]int{"2019": 0})
+	if want := "[1 0 0 1 1 0 -1]"; fmt.Sprint(got) != want {
+		t.Errorf("Assign = %v, want %v", got, want)
+	}
+}
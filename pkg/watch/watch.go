@@ -0,0 +1,216 @@
+// Package watch waits for files to arrive under a local directory tree, such as a camera upload folder
+// or a Syncthing share, and reports them once they are completely written.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long the tree must be quiet, and a changed file the same size, before the
+// changed files are reported.
+const DefaultDebounce = 2 * time.Second
+
+// Watcher reports the files created or written under a directory tree, including the directories
+// created below it after it started. It is not safe for concurrent use.
+type Watcher struct {
+	root     string
+	debounce time.Duration
+	fsw      *fsnotify.Watcher
+
+	// pending holds the changed files not reported yet, with what they looked like at the last check.
+	pending map[string]state
+	// overflow is set when the OS dropped events, so any file may have changed.
+	overflow bool
+}
+
+// state is the size and modification time of a pending file at its last check.
+type state struct {
+	checked bool
+	size    int64
+	modTime time.Time
+}
+
+// New watches root and the directories below it. A debounce of 0 means DefaultDebounce.
+func New(root string, debounce time.Duration) (*Watcher, error) {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watch %s: %w", root, err)
+	}
+	w := &Watcher{root: root, debounce: debounce, fsw: fsw, pending: make(map[string]state)}
+	if err := w.addTree(root, false); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// Queue marks paths as changed, so the next call of Next checks and reports them again. Use it to
+// retry files that turned out to be incomplete when they were organized.
+func (w *Watcher) Queue(paths ...string) {
+	for _, p := range paths {
+		w.pending[p] = state{}
+	}
+}
+
+// Next waits until files were created or written under the root and then for the tree to settle,
+// and returns the changed files, sorted. The tree has settled when no event arrived for the debounce
+// interval and none of the changed files changed size or modification time over one interval: a file
+// still being written keeps Next waiting. Files removed or renamed in the meantime are left out, as are
+// temporary files (IsTemporary). After the OS dropped events, Next returns once the tree has settled
+// even without files, since any file may have changed. Next returns ctx.Err() when ctx is done.
+func (w *Watcher) Next(ctx context.Context) ([]string, error) {
+	timer := time.NewTimer(w.debounce)
+	defer timer.Stop()
+	var settle <-chan time.Time
+	wait := func() {
+		if len(w.pending) == 0 && !w.overflow {
+			settle = nil
+			return
+		}
+		timer.Reset(w.debounce)
+		settle = timer.C
+	}
+	wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return nil, errors.New("watch: watcher closed")
+			}
+			if err := w.handle(ev); err != nil {
+				return nil, err
+			}
+			wait()
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil, errors.New("watch: watcher closed")
+			}
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				return nil, fmt.Errorf("watch %s: %w", w.root, err)
+			}
+			w.overflow = true
+			wait()
+		case <-settle:
+			if w.settled() && (len(w.pending) > 0 || w.overflow) {
+				files := make([]string, 0, len(w.pending))
+				for p := range w.pending {
+					files = append(files, p)
+				}
+				slices.Sort(files)
+				clear(w.pending)
+				w.overflow = false
+				return files, nil
+			}
+			wait()
+		}
+	}
+}
+
+// handle records the change of ev.
+func (w *Watcher) handle(ev fsnotify.Event) error {
+	if ev.Has(fsnotify.Create) {
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			// Files may have been written into the directory before its watch was added.
+			return w.addTree(ev.Name, true)
+		}
+	}
+	if IsTemporary(filepath.Base(ev.Name)) {
+		return nil
+	}
+	switch {
+	case ev.Has(fsnotify.Create), ev.Has(fsnotify.Write):
+		w.pending[ev.Name] = state{}
+	case ev.Has(fsnotify.Remove), ev.Has(fsnotify.Rename):
+		delete(w.pending, ev.Name)
+	}
+	return nil
+}
+
+// settled checks the pending files and reports whether none of them changed since the last check.
+// Files that are gone or are no regular files are dropped.
+func (w *Watcher) settled() bool {
+	settled := true
+	for p, last := range w.pending {
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(w.pending, p)
+			continue
+		}
+		now := state{checked: true, size: info.Size(), modTime: info.ModTime()}
+		if now != last || !readable(p) {
+			settled = false
+		}
+		w.pending[p] = now
+	}
+	return settled
+}
+
+// readable reports whether the file at path can be opened for reading. Some writers, on Windows,
+// hold a file locked until it is complete.
+func readable(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// addTree watches dir and the directories below it. With queue, the files in them are marked as
+// changed too.
+func (w *Watcher) addTree(dir string, queue bool) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != w.root && errors.Is(err, fs.ErrNotExist) {
+				// Removed again before it was watched.
+				return nil
+			}
+			return fmt.Errorf("watch %s: %w", p, err)
+		}
+		if d.IsDir() {
+			if err := w.fsw.Add(p); err != nil && (p == w.root || !errors.Is(err, fs.ErrNotExist)) {
+				return fmt.Errorf("watch %s: %w", p, err)
+			}
+			return nil
+		}
+		if queue && !IsTemporary(d.Name()) {
+			w.pending[p] = state{}
+		}
+		return nil
+	})
+}
+
+// IsTemporary reports whether the file name is that of a file being transferred, which its writer
+// renames when it is complete: hidden files such as rsync's and Syncthing's (.syncthing.*.tmp),
+// Syncthing's Windows names (~syncthing~*.tmp) and partial downloads (.part, .crdownload).
+func IsTemporary(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tmp", ".part", ".partial", ".crdownload", ".download":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const debounce = 50 * time.Millisecond
+
+func newWatcher(t *testing.T, root string) *Watcher {
+	t.Helper()
+	w, err := New(root, debounce)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func next(t *testing.T, w *Watcher) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	files, err := w.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return files
+}
+
+func TestNext(t *testing.T) {
+	root := t.TempDir()
+	w := newWatcher(t, root)
+
+	a := filepath.Join(root, "IMG_0001.jpg")
+	if err := os.WriteFile(a, []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A directory created after the watcher started, with a file written right away.
+	sub := filepath.Join(root, "2024", "trip")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	b := filepath.Join(sub, "IMG_0002.jpg")
+	if err := os.WriteFile(b, []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Temporary files are left out, and so are files removed again.
+	if err := os.WriteFile(filepath.Join(root, ".syncthing.IMG_0003.jpg.tmp"), []byte("c"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gone := filepath.Join(root, "gone.jpg")
+	if err := os.WriteFile(gone, []byte("d"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := next(t, w), []string{b, a}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+
+	// Queued files are checked and reported again.
+	w.Queue(a)
+	if got, want := next(t, w), []string{a}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestNext_WaitsForGrowingFile(t *testing.T) {
+	root := t.TempDir()
+	w := newWatcher(t, root)
+
+	p := filepath.Join(root, "VID_0001.mp4")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer f.Close()
+		for range 10 {
+			f.Write(make([]byte, 1024))
+			time.Sleep(debounce / 2)
+		}
+	}()
+
+	if got := next(t, w); !reflect.DeepEqual(got, []string{p}) {
+		t.Errorf("Next = %v, want %v", got, []string{p})
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("Next returned while the file was still being written")
+	}
+	if info, err := os.Stat(p); err != nil || info.Size() != 10*1024 {
+		t.Errorf("unexpected file: %v, %v", info, err)
+	}
+}
+
+func TestNext_Canceled(t *testing.T) {
+	w := newWatcher(t, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.Next(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Next = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	for name, want := range map[string]bool{
+		"IMG_0001.jpg":                false,
+		".syncthing.IMG_0001.jpg.tmp": true,
+		"~syncthing~IMG_0001.jpg.tmp": true,
+		".IMG_0001.jpg.Xa81kd":        true,
+		"IMG_0001.jpg.part":           true,
+		"IMG_0001.jpg.crdownload":     true,
+		"VID_0001.MP4":                false,
+	} {
+		if got := IsTemporary(name); got != want {
+			t.Errorf("IsTemporary(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+// Package webdavfs implements destfs.FS over WebDAV, so a Nextcloud or other WebDAV share can be
+// used as source or destination without mounting it:
+//
+//	media-organizer organize /media/card webdavs://user@cloud.example.com/remote.php/dav/files/user/Photos
+//
+// Existence and size checks use PROPFIND; files are read with GET and written with a streaming PUT.
+package webdavfs
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quidome/media-organizer-go/pkg/destfs"
+)
+
+const (
+	// Scheme is the URL scheme for WebDAV over plain HTTP.
+	Scheme = "webdav"
+	// SecureScheme is the URL scheme for WebDAV over HTTPS.
+	SecureScheme = "webdavs"
+)
+
+// Options configures the WebDAV client.
+type Options struct {
+	// Client performs the requests; nil means http.DefaultClient.
+	Client *http.Client
+
+	// Username and Password are sent with basic authentication when Username is set.
+	Username string
+	Password string
+}
+
+// FS is a filesystem on a WebDAV server. Names are absolute paths on the server.
+type FS struct {
+	ctx    context.Context
+	base   *url.URL
+	client *http.Client
+	opts   Options
+}
+
+var _ destfs.FS = (*FS)(nil)
+
+// New returns an FS for the server of a webdav:// or webdavs:// URL (or a plain http:// or https:// URL).
+// Credentials in the URL are used when opts has no Username. Requests are bound to ctx.
+func New(ctx context.Context, u *url.URL, opts Options) (*FS, error) {
+	base := &url.URL{Host: u.Host}
+	switch u.Scheme {
+	case Scheme, "http":
+		base.Scheme = "http"
+	case SecureScheme, "https":
+		base.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("webdav: unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("webdav: missing host in %s", u.Redacted())
+	}
+	if opts.Username == "" && u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &FS{ctx: ctx, base: base, client: client, opts: opts}, nil
+}
+
+// Close implements io.Closer; WebDAV keeps no session.
+func (f *FS) Close() error { return nil }
+
+// Stat implements destfs.FS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	entries, err := f.propfind(name, "0")
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if len(entries) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: errors.New("empty PROPFIND response")}
+	}
+	return entries[0], nil
+}
+
+// ReadDir implements destfs.FS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := f.propfind(name, "1")
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	self := strings.TrimSuffix(remotePath(name), "/")
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		if strings.TrimSuffix(info.path, "/") == self {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// Open implements destfs.FS.
+func (f *FS) Open(name string) (destfs.File, error) {
+	req, err := f.request(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: statusError(resp)}
+	}
+	return &readFile{fs: f, name: name, body: resp.Body}, nil
+}
+
+// OpenFile implements destfs.FS.
+//
+// Files opened for writing are uploaded with a single streaming PUT. The upload is committed by Sync;
+// closing a file without a successful Sync aborts the upload and removes what the server kept of a file
+// that did not exist before, so an interrupted copy leaves no partial file.
+func (f *FS) OpenFile(name string, flag int, _ fs.FileMode) (destfs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f.Open(name)
+	}
+
+	_, err := f.Stat(name)
+	exists := err == nil
+	switch {
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	pr, pw := io.Pipe()
+	req, err := f.request(http.MethodPut, name, pr)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_EXCL != 0 {
+		// Guards against a file created between the PROPFIND above and the upload.
+		req.Header.Set("If-None-Match", "*")
+	}
+
+	w := &writeFile{fs: f, name: name, pw: pw, done: make(chan error, 1), created: !exists}
+	go func() {
+		resp, err := f.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = statusError(resp)
+			}
+		}
+		// Unblock writers when the request ends early.
+		pr.CloseWithError(io.ErrClosedPipe)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// MkdirAll implements destfs.FS.
+func (f *FS) MkdirAll(name string, _ fs.FileMode) error {
+	if info, err := f.Stat(name); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	p := remotePath(name)
+	var prefix string
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		prefix += "/" + part
+		req, err := f.request("MKCOL", prefix, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+		}
+		resp.Body.Close()
+		// 405 Method Not Allowed: the collection already exists.
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return &fs.PathError{Op: "mkdir", Path: prefix, Err: statusError(resp)}
+		}
+	}
+	return nil
+}
+
+// Remove implements destfs.FS.
+func (f *FS) Remove(name string) error {
+	req, err := f.request(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &fs.PathError{Op: "remove", Path: name, Err: statusError(resp)}
+	}
+	return nil
+}
+
+// removeAfterAbort removes name on a best-effort basis, also when the run was canceled.
+func (f *FS) removeAfterAbort(name string) {
+	req, err := f.request(http.MethodDelete, name, nil)
+	if err != nil {
+		return
+	}
+	resp, err := f.client.Do(req.WithContext(context.WithoutCancel(f.ctx)))
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+func (f *FS) request(method, name string, body io.Reader) (*http.Request, error) {
+	u := *f.base
+	u.Path = remotePath(name)
+	req, err := http.NewRequestWithContext(f.ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("webdav: %s %s: %w", method, name, err)
+	}
+	if f.opts.Username != "" {
+		req.SetBasicAuth(f.opts.Username, f.opts.Password)
+	}
+	return req, nil
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// propfind returns the properties of name and, with depth "1", of its members.
+func (f *FS) propfind(name, depth string) ([]fileInfo, error) {
+	req, err := f.request("PROPFIND", name, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError(resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("decode PROPFIND response: %w", err)
+	}
+	infos := make([]fileInfo, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		info, err := r.fileInfo()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href     string     `xml:"DAV: href"`
+	Propstat []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+	} `xml:"DAV: prop"`
+}
+
+func (r response) fileInfo() (fileInfo, error) {
+	href, err := url.Parse(r.Href)
+	if err != nil {
+		return fileInfo{}, fmt.Errorf("parse href %q: %w", r.Href, err)
+	}
+	info := fileInfo{path: href.Path, name: path.Base(strings.TrimSuffix(href.Path, "/"))}
+	for _, ps := range r.Propstat {
+		// Properties the server does not have are reported in a separate 404 propstat.
+		if !strings.Contains(ps.Status, " 200 ") {
+			continue
+		}
+		if ps.Prop.ResourceType.Collection != nil {
+			info.dir = true
+		}
+		if ps.Prop.ContentLength != "" {
+			info.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+		}
+		if ps.Prop.LastModified != "" {
+			info.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+		}
+	}
+	return info, nil
+}
+
+// fileInfo is a PROPFIND result.
+type fileInfo struct {
+	path    string
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// readFile is a file opened with GET.
+type readFile struct {
+	fs   *FS
+	name string
+	body io.ReadCloser
+}
+
+func (f *readFile) Read(p []byte) (int, error) { return f.body.Read(p) }
+
+func (f *readFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) { return f.fs.Stat(f.name) }
+func (f *readFile) Sync() error                { return nil }
+func (f *readFile) Close() error               { return f.body.Close() }
+
+// errUploadAborted aborts an upload that was closed without Sync.
+var errUploadAborted = errors.New("upload aborted")
+
+// writeFile streams its writes into a PUT request.
+type writeFile struct {
+	fs   *FS
+	name string
+	pw   *io.PipeWriter
+	done chan error
+
+	// created reports whether the file did not exist before the upload.
+	created bool
+
+	once   sync.Once
+	result error
+}
+
+func (f *writeFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+}
+
+func (f *writeFile) Write(p []byte) (int, error) { return f.pw.Write(p) }
+
+func (f *writeFile) Stat() (fs.FileInfo, error) { return f.fs.Stat(f.name) }
+
+// Sync completes the upload and reports whether the server stored the file.
+func (f *writeFile) Sync() error {
+	return f.finish(nil)
+}
+
+// Close aborts the upload unless Sync completed it.
+func (f *writeFile) Close() error {
+	f.finish(errUploadAborted)
+	return nil
+}
+
+func (f *writeFile) finish(abort error) error {
+	f.once.Do(func() {
+		if abort != nil {
+			f.pw.CloseWithError(abort)
+		} else {
+			f.pw.Close()
+		}
+		err := <-f.done
+		if abort != nil && f.created {
+			// Some servers keep the part of an aborted upload they received.
+			f.fs.removeAfterAbort(f.name)
+		}
+		if err != nil {
+			err = &fs.PathError{Op: "write", Path: f.name, Err: err}
+		}
+		f.result = err
+	})
+	return f.result
+}
+
+// remotePath converts a pipeline path into a server path, which always uses forward slashes.
+func remotePath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+// statusError maps an unexpected HTTP status onto the io/fs sentinels where one applies.
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%s: %w", resp.Status, fs.ErrPermission)
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("%s: %w", resp.Status, fs.ErrExist)
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
@@ -0,0 +1,114 @@
+package webdavfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newTestFS connects an FS to an in-memory WebDAV server.
+func newTestFS(t *testing.T) *FS {
+	t.Helper()
+	server := httptest.NewServer(&webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()})
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(context.Background(), u, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func writeTestFile(t *testing.T, f *FS, name, content string) {
+	t.Helper()
+	w, err := f.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFS_WriteReadAndList(t *testing.T) {
+	f := newTestFS(t)
+
+	if err := f.MkdirAll("/photos/2023/11", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, f, "/photos/2023/11/a.jpg", "data")
+
+	info, err := f.Stat("/photos/2023/11/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 4 || info.IsDir() {
+		t.Fatalf("unexpected info: size %d dir %v", info.Size(), info.IsDir())
+	}
+	if _, err := f.OpenFile("/photos/2023/11/a.jpg", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("exclusive create of existing file: got %v, want fs.ErrExist", err)
+	}
+	if _, err := f.Stat("/photos/2023/11/missing.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat missing file: got %v, want fs.ErrNotExist", err)
+	}
+
+	r, err := f.Open("/photos/2023/11/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "data" {
+		t.Fatalf("read = %q, %v", got, err)
+	}
+
+	entries, err := f.ReadDir("/photos/2023")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "11" || !entries[0].IsDir() {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+
+	if err := f.Remove("/photos/2023/11/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat("/photos/2023/11/a.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stat removed file: got %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFS_CloseWithoutSyncAbortsUpload(t *testing.T) {
+	f := newTestFS(t)
+
+	w, err := f.OpenFile("/partial.jpg", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "half"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat("/partial.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("aborted upload left a file: stat err = %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package xmpdate reads and writes the photoshop:DateCreated of XMP sidecars: the date the content of
+// a file was created as a person or photo application recorded it, such as the event date of a scanned
+// print, which the file itself does not know.
+package xmpdate
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"time"
+)
+
+// ErrUnsupported is returned by Set for data that is not an XMP packet with an rdf:Description.
+var ErrUnsupported = errors.New("no rdf:Description in XMP data")
+
+// SidecarPath returns the path of a new XMP sidecar of the media file at path, which keeps the
+// extension of the media file so a RAW and a JPEG of one shot do not share it.
+func SidecarPath(path string) string {
+	return path + ".xmp"
+}
+
+var (
+	// dateCreated matches the photoshop:DateCreated of an XMP packet, as an attribute or as an element.
+	dateCreated = regexp.MustCompile(`(photoshop:DateCreated(?:\s*=\s*"|>))\s*([^"<]*?)\s*(["<])`)
+	// createDate matches the xmp:CreateDate of an XMP packet in the same forms.
+	createDate  = regexp.MustCompile(`(xmp:CreateDate(?:\s*=\s*"|>))\s*([^"<]*?)\s*(["<])`)
+	description = regexp.MustCompile(`<rdf:Description\b`)
+)
+
+// layouts are the forms of an XMP date, most precise first. Without an offset, a date is read in the
+// location given to Read.
+var layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Read returns the photoshop:DateCreated of the XMP data, such as an .xmp sidecar, and whether it has
+// a valid one.
+func Read(data []byte, loc *time.Location) (time.Time, bool) {
+	return read(dateCreated, data, loc)
+}
+
+// ReadCreateDate returns the xmp:CreateDate of the XMP data, the date the file itself was created as
+// the application that made it recorded it, and whether it has a valid one.
+func ReadCreateDate(data []byte, loc *time.Location) (time.Time, bool) {
+	return read(createDate, data, loc)
+}
+
+// read returns the date the second group of re matches in data.
+func read(re *regexp.Regexp, data []byte, loc *time.Location) (time.Time, bool) {
+	m := re.FindSubmatch(data)
+	if m == nil {
+		return time.Time{}, false
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, string(m[2]), loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Set returns the XMP data with its photoshop:DateCreated set to t, replacing the one it has or adding
+// one to its first rdf:Description. Empty data gives a new XMP packet.
+func Set(data []byte, t time.Time) ([]byte, error) {
+	value := t.Format("2006-01-02T15:04:05-07:00")
+	if len(bytes.TrimSpace(data)) == 0 {
+		return packet(value), nil
+	}
+	if loc := dateCreated.FindSubmatchIndex(data); loc != nil {
+		out := append([]byte{}, data[:loc[4]]...)
+		out = append(out, value...)
+		return append(out, data[loc[5]:]...), nil
+	}
+
+	loc := description.FindIndex(data)
+	if loc == nil {
+		return nil, ErrUnsupported
+	}
+	attr := ` photoshop:DateCreated="` + value + `"`
+	if !bytes.Contains(data, []byte("xmlns:photoshop=")) {
+		attr = ` xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"` + attr
+	}
+	out := append([]byte{}, data[:loc[1]]...)
+	out = append(out, attr...)
+	return append(out, data[loc[1]:]...), nil
+}
+
+// packet returns a new XMP packet recording value as the photoshop:DateCreated.
+func packet(value string) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""
+    xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+    photoshop:DateCreated="` + value + `"/>` + "\n")
+	b.WriteString(" </rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>` + "\n")
+	return b.Bytes()
+}
@@ -0,0 +1,62 @@
+package xmpdate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	loc := time.FixedZone("TEST", 2*3600)
+	for data, want := range map[string]time.Time{
+		`<rdf:Description photoshop:DateCreated="1998-07-14T18:30:00+00:00"/>`:                        time.Date(1998, 7, 14, 18, 30, 0, 0, time.UTC),
+		`<rdf:Description photoshop:DateCreated="1998-07-14T18:30:00"/>`:                              time.Date(1998, 7, 14, 18, 30, 0, 0, loc),
+		`<rdf:Description><photoshop:DateCreated> 1998-07 </photoshop:DateCreated></rdf:Description>`: time.Date(1998, 7, 1, 0, 0, 0, 0, loc),
+	} {
+		if got, ok := Read([]byte(data), loc); !ok || !got.Equal(want) {
+			t.Errorf("Read(%s) = %v, %v; want %v", data, got, ok, want)
+		}
+	}
+	for _, data := range []string{`<rdf:Description xmp:CreateDate="1998-07-14"/>`, `<rdf:Description photoshop:DateCreated="yesterday"/>`} {
+		if _, ok := Read([]byte(data), loc); ok {
+			t.Errorf("Read(%s): expected no date", data)
+		}
+	}
+}
+
+func TestReadCreateDate(t *testing.T) {
+	loc := time.FixedZone("TEST", 2*3600)
+	data := []byte(`<rdf:Description xmp:CreateDate="2021-03-04T05:06:07" photoshop:DateCreated="1998-07-14"/>`)
+	if got, ok := ReadCreateDate(data, loc); !ok || !got.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, loc)) {
+		t.Errorf("ReadCreateDate = %v, %v", got, ok)
+	}
+	if _, ok := ReadCreateDate([]byte(`<rdf:Description photoshop:DateCreated="1998-07-14"/>`), loc); ok {
+		t.Errorf("expected no xmp:CreateDate")
+	}
+}
+
+func TestSet(t *testing.T) {
+	taken := time.Date(1998, 7, 14, 0, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	lightroom := `<x:xmpmeta><rdf:RDF><rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="4"/></rdf:RDF></x:xmpmeta>`
+	replaced := `<rdf:Description xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"><photoshop:DateCreated>2020-01-01</photoshop:DateCreated></rdf:Description>`
+
+	for _, data := range []string{"", lightroom, replaced} {
+		out, err := Set([]byte(data), taken)
+		if err != nil {
+			t.Fatalf("Set(%q): %v", data, err)
+		}
+		if got, ok := Read(out, time.UTC); !ok || !got.Equal(taken) {
+			t.Errorf("Set(%q): read back %v, %v from %s", data, got, ok, out)
+		}
+		if strings.Count(string(out), "xmlns:photoshop=") != 1 {
+			t.Errorf("Set(%q): expected one photoshop namespace, got %s", data, out)
+		}
+	}
+	if out, _ := Set([]byte(lightroom), taken); !strings.Contains(string(out), `xmp:Rating="4"`) {
+		t.Errorf("expected the other properties to be kept, got %s", out)
+	}
+	if _, err := Set([]byte("<x:xmpmeta/>"), taken); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}